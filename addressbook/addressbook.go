@@ -0,0 +1,283 @@
+// Package addressbook keeps labeled watch-only and contract addresses in a
+// password-encrypted file next to the keystore.
+package addressbook
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// FileName is the name of the address book in the keystore directory.
+	// It does not end in .json so it is never mistaken for a key file.
+	FileName = "addressbook.enc"
+
+	// KindWatch marks an account that is watched but not held in the vault
+	KindWatch = "watch"
+	// KindContract marks a contract address
+	KindContract = "contract"
+
+	// fileFormat identifies an encrypted address book
+	fileFormat = "gosignervaultcli-addressbook"
+	// fileVersion is the current file version; version 1 books were keyed
+	// with keystore.LegacyCipher and are re-encrypted when opened
+	fileVersion = 2
+)
+
+// Entry is a labeled address
+type Entry struct {
+	Label   string         `json:"label"`
+	Address common.Address `json:"address"`
+	Kind    string         `json:"kind"`
+	Note    string         `json:"note,omitempty"`
+	Added   time.Time      `json:"added"`
+	// Device is set for watch-only accounts of a hardware wallet
+	Device *Device `json:"device,omitempty"`
+}
+
+// Device ties a watch-only account to the hardware wallet holding its key
+type Device struct {
+	// Kind is "ledger" or "trezor"
+	Kind string `json:"kind"`
+	// Fingerprint is the device's first account on the default path, which
+	// identifies its seed
+	Fingerprint common.Address `json:"fingerprint"`
+	Path        string         `json:"path"`
+}
+
+// Book is a decrypted address book
+type Book struct {
+	path     string
+	password string
+	entries  []*Entry
+
+	// kdf and aead are derived once and kept for saving; they are nil for
+	// new books until their first Save
+	kdf  *keystore.SealKDF
+	aead cipher.AEAD
+}
+
+// encryptedFile is the on-disk form of an address book
+type encryptedFile struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	Salt       string            `json:"salt,omitempty"`
+	KDF        *keystore.SealKDF `json:"kdf,omitempty"`
+	Nonce      string            `json:"nonce"`
+	CipherText string            `json:"ciphertext"`
+}
+
+// Exists reports whether an address book file exists
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Open decrypts the address book at path. A missing file opens an empty book
+// that is created on the first Save.
+func Open(path, password string) (*Book, error) {
+	if password == "" {
+		return nil, errors.New("address book password is empty")
+	}
+	book := &Book{path: path, password: password}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return book, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read address book: %v", err)
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Format != fileFormat {
+		return nil, fmt.Errorf("%s is not an address book", path)
+	}
+	nonce, err := hexutil.Decode(file.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address book nonce: %v", err)
+	}
+	ciphertext, err := hexutil.Decode(file.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address book ciphertext: %v", err)
+	}
+
+	var aead cipher.AEAD
+	if file.Version < fileVersion {
+		salt, err := hexutil.Decode(file.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address book salt: %v", err)
+		}
+		aead, err = keystore.LegacyCipher(password, salt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create address book cipher: %v", err)
+		}
+	} else {
+		if file.KDF == nil {
+			return nil, fmt.Errorf("address book has no KDF parameters")
+		}
+		if aead, err = file.KDF.Cipher(password); err != nil {
+			return nil, fmt.Errorf("failed to create address book cipher: %v", err)
+		}
+		book.kdf, book.aead = file.KDF, aead
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid address book nonce length")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("wrong address book password")
+	}
+	if err := json.Unmarshal(plaintext, &book.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse address book: %v", err)
+	}
+	if book.aead == nil {
+		if err := book.Save(); err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt address book: %v", err)
+		}
+	}
+	return book, nil
+}
+
+// Save encrypts the address book with a fresh nonce and writes it
+// atomically. New books get a salt and Argon2id key first.
+func (b *Book) Save() error {
+	plaintext, err := json.Marshal(b.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal address book: %v", err)
+	}
+
+	if b.aead == nil {
+		kdf, err := keystore.NewSealKDF(keystore.DefaultSealKDF)
+		if err != nil {
+			return err
+		}
+		aead, err := kdf.Cipher(b.password)
+		if err != nil {
+			return fmt.Errorf("failed to create address book cipher: %v", err)
+		}
+		b.kdf, b.aead = kdf, aead
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(encryptedFile{
+		Format:     fileFormat,
+		Version:    fileVersion,
+		KDF:        b.kdf,
+		Nonce:      hexutil.Encode(nonce),
+		CipherText: hexutil.Encode(b.aead.Seal(nil, nonce, plaintext, nil)),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal address book: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write address book: %v", err)
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write address book: %v", err)
+	}
+	return nil
+}
+
+// Add adds an entry. Labels and addresses must be unique within the book.
+func (b *Book) Add(entry *Entry) error {
+	entry.Label = strings.TrimSpace(entry.Label)
+	if entry.Label == "" {
+		return errors.New("label is empty")
+	}
+	if common.IsHexAddress(entry.Label) {
+		return errors.New("label must not be an address")
+	}
+	switch entry.Kind {
+	case KindWatch, KindContract:
+	default:
+		return fmt.Errorf("unknown kind %q (expected %s or %s)", entry.Kind, KindWatch, KindContract)
+	}
+
+	for _, existing := range b.entries {
+		if strings.EqualFold(existing.Label, entry.Label) {
+			return fmt.Errorf("label %q is already used for %s", existing.Label, existing.Address.Hex())
+		}
+		if existing.Address == entry.Address {
+			return fmt.Errorf("%s is already labeled %q", entry.Address.Hex(), existing.Label)
+		}
+	}
+	if entry.Added.IsZero() {
+		entry.Added = time.Now().UTC()
+	}
+	b.entries = append(b.entries, entry)
+	return nil
+}
+
+// Remove removes the entry with the given label or address
+func (b *Book) Remove(ref string) (*Entry, error) {
+	for i, entry := range b.entries {
+		if entry.matches(ref) {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not in the address book", ref)
+}
+
+// Lookup returns the entry of an address
+func (b *Book) Lookup(address common.Address) (*Entry, bool) {
+	for _, entry := range b.entries {
+		if entry.Address == address {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// Resolve returns the address of a label, or parses ref as an address
+func (b *Book) Resolve(ref string) (common.Address, error) {
+	for _, entry := range b.entries {
+		if entry.matches(ref) {
+			return entry.Address, nil
+		}
+	}
+	if common.IsHexAddress(ref) {
+		return common.HexToAddress(ref), nil
+	}
+	return common.Address{}, fmt.Errorf("%q is neither an address nor a label in the address book", ref)
+}
+
+// Entries returns the entries sorted by label
+func (b *Book) Entries() []*Entry {
+	entries := append([]*Entry(nil), b.entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Label) < strings.ToLower(entries[j].Label)
+	})
+	return entries
+}
+
+// matches reports whether ref is the entry's label or address
+func (e *Entry) matches(ref string) bool {
+	if common.IsHexAddress(ref) {
+		return e.Address == common.HexToAddress(ref)
+	}
+	return strings.EqualFold(e.Label, strings.TrimSpace(ref))
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AllKeys in the keys of a client rule makes every unlocked key visible
+const AllKeys = "*"
+
+// ErrAccessDenied is returned to a client the access rules do not admit
+var ErrAccessDenied = errors.New("access to the agent denied")
+
+// Access decides which processes may use the agent socket and which keys
+// each of them sees. The first rule matching the peer of a connection applies;
+// a connection no rule matches is refused.
+type Access struct {
+	Clients []*ClientRule `json:"clients"`
+}
+
+// ClientRule admits the processes matching all of its conditions. Empty
+// conditions match any process.
+type ClientRule struct {
+	Name string `json:"name"`
+	// UIDs and GIDs restrict the user and primary group of the process
+	UIDs []uint32 `json:"uids,omitempty"`
+	GIDs []uint32 `json:"gids,omitempty"`
+	// Binaries restricts the executable of the process, by absolute path
+	Binaries []string `json:"binaries,omitempty"`
+	// Keys are the key names the client can list and sign with, or "*"
+	Keys []string `json:"keys"`
+	// Manage allows unlocking, locking and stopping
+	Manage bool `json:"manage,omitempty"`
+}
+
+// Peer identifies the process on the other end of a connection
+type Peer struct {
+	PID    int32
+	UID    uint32
+	GID    uint32
+	Binary string
+}
+
+func (p *Peer) String() string {
+	return fmt.Sprintf("pid %d, uid %d, gid %d, %s", p.PID, p.UID, p.GID, p.Binary)
+}
+
+// LoadAccess reads access rules from a JSON file
+func LoadAccess(path string) (*Access, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access rules: %v", err)
+	}
+	var access Access
+	if err := json.Unmarshal(data, &access); err != nil {
+		return nil, fmt.Errorf("failed to parse access rules: %v", err)
+	}
+	if len(access.Clients) == 0 {
+		return nil, errors.New("access rules admit no clients")
+	}
+	for i, rule := range access.Clients {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("client %d", i+1)
+		}
+		for j, binary := range rule.Binaries {
+			if !filepath.IsAbs(binary) {
+				return nil, fmt.Errorf("%s: binary %q is not an absolute path", rule.Name, binary)
+			}
+			// The kernel reports the resolved executable
+			if resolved, err := filepath.EvalSymlinks(binary); err == nil {
+				rule.Binaries[j] = resolved
+			}
+		}
+	}
+	return &access, nil
+}
+
+// Shared reports whether the rules admit processes of other users, so the
+// socket must be accessible beyond its owner
+func (a *Access) Shared() bool {
+	uid := uint32(os.Getuid())
+	for _, rule := range a.Clients {
+		if len(rule.UIDs) == 0 || len(rule.GIDs) > 0 {
+			return true
+		}
+		for _, ruleUID := range rule.UIDs {
+			if ruleUID != uid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize returns the rule admitting a peer
+func (a *Access) authorize(peer *Peer) (*ClientRule, error) {
+	for _, rule := range a.Clients {
+		if rule.matches(peer) {
+			return rule, nil
+		}
+	}
+	return nil, ErrAccessDenied
+}
+
+// matches reports whether a peer meets every condition of the rule
+func (r *ClientRule) matches(peer *Peer) bool {
+	if len(r.UIDs) > 0 && !containsID(r.UIDs, peer.UID) {
+		return false
+	}
+	if len(r.GIDs) > 0 && !containsID(r.GIDs, peer.GID) {
+		return false
+	}
+	if len(r.Binaries) > 0 {
+		found := false
+		for _, binary := range r.Binaries {
+			found = found || binary == peer.Binary
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// visible reports whether the client may see and use a key
+func (r *ClientRule) visible(name string) bool {
+	for _, key := range r.Keys {
+		if key == AllKeys || key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the keys visible to the client
+func (r *ClientRule) filter(keys []KeyInfo) []KeyInfo {
+	visible := make([]KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		if r.visible(key.Name) {
+			visible = append(visible, key)
+		}
+	}
+	return visible
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []uint32, id uint32) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EnvSocket overrides the socket the agent listens on and clients connect to
+const EnvSocket = "GOSIGNERVAULT_AGENT_SOCK"
+
+// DefaultIdleTimeout is how long unlocked keys stay unlocked without being used
+const DefaultIdleTimeout = 15 * time.Minute
+
+// DefaultSocket is the default location of the agent socket
+var DefaultSocket = filepath.Join(paths.DataDir(), "agent.sock")
+
+// Socket returns the socket named by $GOSIGNERVAULT_AGENT_SOCK, or the default
+func Socket() string {
+	if socket := os.Getenv(EnvSocket); socket != "" {
+		return socket
+	}
+	return DefaultSocket
+}
+
+// Operations of the agent protocol
+const (
+	opAdd  = "add"
+	opList = "list"
+	opSign = "sign"
+	opLock = "lock"
+	opStop = "stop"
+)
+
+// request is a message from a client. Every connection carries one request
+// and one response.
+type request struct {
+	Op       string `json:"op"`
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password,omitempty"`
+	Hash     []byte `json:"hash,omitempty"`
+}
+
+// response is the agent's answer to a request
+type response struct {
+	Error     string  `json:"error,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Signature []byte  `json:"signature,omitempty"`
+	Status    *Status `json:"status,omitempty"`
+}
+
+// Status describes a running agent
+type Status struct {
+	// Keystore is the directory the agent decrypts keys from
+	Keystore string    `json:"keystore"`
+	Keys     []KeyInfo `json:"keys"`
+	// LocksAt is when the keys lock unless they are used before
+	LocksAt *time.Time `json:"locksAt,omitempty"`
+}
+
+// KeyInfo describes a key unlocked in the agent
+type KeyInfo struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// Agent holds decrypted keys for other processes. Keys are decrypted by the
+// agent itself, so key material never crosses the socket, and are kept in
+// memory that is locked against swapping.
+type Agent struct {
+	dir     string
+	manager *keystore.Manager
+	timeout time.Duration
+	// access restricts the clients of the socket, if set
+	access *Access
+
+	mu       sync.Mutex
+	keys     map[string]*securemem.Key
+	lastUsed time.Time
+	listener net.Listener
+}
+
+// New creates an agent serving keys of a keystore directory. Keys are locked
+// after timeout without use; a zero timeout keeps them until 'agent lock'.
+func New(keystoreDir string, timeout time.Duration) (*Agent, error) {
+	dir, err := filepath.Abs(keystoreDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore directory: %v", err)
+	}
+	manager, err := keystore.NewManager(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore manager: %v", err)
+	}
+	return &Agent{dir: dir, manager: manager, timeout: timeout, keys: make(map[string]*securemem.Key)}, nil
+}
+
+// SetAccess restricts which processes may use the socket and which keys
+// each of them sees. It must be called before Listen.
+func (a *Agent) SetAccess(access *Access) error {
+	if !peerCredentials {
+		return errors.New("access rules need peer credentials, which are only supported on Linux")
+	}
+	a.access = access
+	return nil
+}
+
+// MemoryLocked reports whether keys are protected from being swapped to disk
+// on this platform
+func MemoryLocked() bool {
+	return securemem.Locked()
+}
+
+// Add decrypts a key of the keystore into the agent
+func (a *Agent) Add(name, password string) (common.Address, error) {
+	// Names come from clients of the socket and must not leave the keystore
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return common.Address{}, fmt.Errorf("invalid key name %q", name)
+	}
+	encryptedKey, err := a.manager.LoadKey(name)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to load key: %v", err)
+	}
+	if err := encryptedKey.CheckState(); err != nil {
+		return common.Address{}, fmt.Errorf("%s: %w", name, err)
+	}
+	privateKey, err := keystore.DecryptKey(encryptedKey, password)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	key, err := securemem.NewKey(privateKey)
+	if err != nil {
+		securemem.WipeKey(privateKey)
+		return common.Address{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if old, ok := a.keys[name]; ok {
+		old.Destroy()
+	}
+	a.keys[name] = key
+	a.lastUsed = time.Now()
+	return key.Address(), nil
+}
+
+// Lock wipes every unlocked key
+func (a *Agent) Lock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lock()
+}
+
+// lock wipes every unlocked key; the caller holds mu
+func (a *Agent) lock() {
+	for name, key := range a.keys {
+		key.Destroy()
+		delete(a.keys, name)
+	}
+}
+
+// Keys returns the unlocked keys, sorted by name
+func (a *Agent) Keys() []KeyInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	infos := make([]KeyInfo, 0, len(a.keys))
+	for name, key := range a.keys {
+		infos = append(infos, KeyInfo{Name: name, Address: key.Address().Hex()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// sign signs a digest with an unlocked key, returning [R || S || V] with V
+// being 0 or 1
+func (a *Agent) sign(name string, hash []byte) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key, ok := a.keys[name]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not unlocked in the agent", name)
+	}
+	if len(hash) != 32 {
+		return nil, fmt.Errorf("hash must be 32 bytes, got %d", len(hash))
+	}
+	// The key may have been suspended since it was unlocked
+	if err := a.manager.CheckState(name); err != nil {
+		return nil, err
+	}
+	a.lastUsed = time.Now()
+	return key.SignHash(hash)
+}
+
+// Status returns the keystore, the unlocked keys and when they lock
+func (a *Agent) Status() *Status {
+	status := &Status{Keystore: a.dir, Keys: a.Keys()}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timeout > 0 && len(a.keys) > 0 {
+		at := a.lastUsed.Add(a.timeout)
+		status.LocksAt = &at
+	}
+	return status
+}
+
+// Listen opens the agent socket, refusing to replace one an agent still
+// answers on. The socket is only accessible to the current user, unless the
+// access rules admit other users. Its directory is then left to the operator
+// and must already let them through; a directory this creates is private.
+func (a *Agent) Listen(socket string) error {
+	dir := filepath.Dir(socket)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	shared := a.access != nil && a.access.Shared()
+	if shared {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read socket directory: %v", err)
+		}
+		if info.Mode().Perm()&0011 == 0 {
+			return fmt.Errorf("the access rules admit other users, but socket directory %s is accessible only to its owner; move the socket to a directory they can enter", dir)
+		}
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", socket)
+	}
+	// Left behind by an agent that did not shut down cleanly
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socket, err)
+	}
+	mode := os.FileMode(0600)
+	if shared {
+		mode = 0666
+	}
+	if err := os.Chmod(socket, mode); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict socket permissions: %v", err)
+	}
+	a.listener = listener
+	return nil
+}
+
+// Serve answers requests until Close is called or a client sends stop, and
+// locks idle keys. The keys are wiped when it returns.
+func (a *Agent) Serve() error {
+	if a.listener == nil {
+		return errors.New("agent is not listening")
+	}
+	defer a.Lock()
+
+	done := make(chan struct{})
+	defer close(done)
+	if a.timeout > 0 {
+		go a.lockIdle(done)
+	}
+
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("agent failed: %v", err)
+		}
+		go a.handle(conn)
+	}
+}
+
+// Close stops the agent
+func (a *Agent) Close() error {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Close()
+}
+
+// lockIdle locks the keys once they have not been used for the timeout
+func (a *Agent) lockIdle(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			a.mu.Lock()
+			if len(a.keys) > 0 && now.Sub(a.lastUsed) >= a.timeout {
+				a.lock()
+				log.Printf("Locked all keys after %s without use", a.timeout)
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// handle answers the request of one connection
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var client *ClientRule
+	if a.access != nil {
+		peer, err := peerOf(conn)
+		if err == nil {
+			client, err = a.access.authorize(peer)
+		}
+		if err != nil {
+			log.Printf("Refused connection (%s): %v", describePeer(peer), err)
+			json.NewEncoder(conn).Encode(response{Error: ErrAccessDenied.Error()})
+			return
+		}
+	}
+
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		json.NewEncoder(conn).Encode(response{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	var resp response
+	switch {
+	case client != nil && (req.Op == opAdd || req.Op == opLock || req.Op == opStop) && !client.Manage:
+		log.Printf("Refused %s from %s", req.Op, client.Name)
+		resp.Error = fmt.Sprintf("%s may not %s", client.Name, req.Op)
+	case req.Op == opAdd:
+		address, err := a.Add(req.Name, req.Password)
+		if err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		log.Printf("Unlocked %s (%s)", req.Name, address.Hex())
+		resp.Address = address.Hex()
+	case req.Op == opList:
+		resp.Status = a.Status()
+		if client != nil {
+			resp.Status.Keys = client.filter(resp.Status.Keys)
+		}
+	case req.Op == opSign:
+		// Keys a client may not see are reported as not unlocked
+		if client != nil && !client.visible(req.Name) {
+			resp.Error = fmt.Sprintf("key %s is not unlocked in the agent", req.Name)
+			break
+		}
+		signature, err := a.sign(req.Name, req.Hash)
+		if err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		resp.Signature = signature
+	case req.Op == opLock:
+		a.Lock()
+		log.Printf("Locked all keys")
+	case req.Op == opStop:
+		defer a.Close()
+		log.Printf("Stopping")
+	default:
+		resp.Error = fmt.Sprintf("unknown operation %q", req.Op)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// describePeer formats a peer for the log, which may be unknown
+func describePeer(peer *Peer) string {
+	if peer == nil {
+		return "unknown peer"
+	}
+	return peer.String()
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Client talks to a running agent
+type Client struct {
+	socket string
+}
+
+// NewClient creates a client for the agent on a socket
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// call sends a request and reads the response
+func (c *Client) call(req request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.socket, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("no agent running on %s: %v", c.socket, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request to agent: %v", err)
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read agent response: %v", err)
+	}
+	if resp.Error == ErrAccessDenied.Error() {
+		return nil, fmt.Errorf("%w by the agent on %s", ErrAccessDenied, c.socket)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Add has the agent decrypt and hold a key of its keystore
+func (c *Client) Add(name, password string) (common.Address, error) {
+	resp, err := c.call(request{Op: opAdd, Name: name, Password: password})
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.HexToAddress(resp.Address), nil
+}
+
+// Status returns the keystore and unlocked keys of the agent
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.call(request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == nil {
+		return nil, errors.New("agent sent no status")
+	}
+	return resp.Status, nil
+}
+
+// Lock wipes every key held by the agent
+func (c *Client) Lock() error {
+	_, err := c.call(request{Op: opLock})
+	return err
+}
+
+// Stop shuts the agent down
+func (c *Client) Stop() error {
+	_, err := c.call(request{Op: opStop})
+	return err
+}
+
+// Signer returns a signer for a key of a keystore directory unlocked in the
+// agent
+func (c *Client) Signer(keystoreDir, name string) (*Signer, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	if dir, err := filepath.Abs(keystoreDir); err != nil || dir != status.Keystore {
+		return nil, fmt.Errorf("the agent serves keys of %s, not %s", status.Keystore, keystoreDir)
+	}
+	for _, key := range status.Keys {
+		if key.Name == name {
+			return &Signer{client: c, name: name, address: common.HexToAddress(key.Address)}, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s is not unlocked in the agent", name)
+}
+
+// Signer signs with a key held by the agent
+type Signer struct {
+	client  *Client
+	name    string
+	address common.Address
+}
+
+// Address returns the Ethereum address of the key
+func (s *Signer) Address() common.Address {
+	return s.address
+}
+
+// SignHash has the agent sign a digest
+func (s *Signer) SignHash(hash []byte) ([]byte, error) {
+	resp, err := s.client.call(request{Op: opSign, Name: s.name, Hash: hash})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
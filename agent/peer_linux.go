@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// peerCredentials reports whether access rules can be enforced
+const peerCredentials = true
+
+// peerOf reads the credentials of the process on the other end of a unix
+// socket connection from the kernel, and its executable from /proc
+func peerOf(conn net.Conn) (*Peer, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a unix socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer credentials: %v", err)
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read peer credentials: %v", err)
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("failed to read peer credentials: %v", credErr)
+	}
+
+	peer := &Peer{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}
+	// An executable that cannot be read matches no binary allowlist
+	if binary, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", cred.Pid)); err == nil {
+		peer.Binary = binary
+	}
+	return peer, nil
+}
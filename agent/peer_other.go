@@ -0,0 +1,16 @@
+//go:build !linux
+
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials reports whether access rules can be enforced
+const peerCredentials = false
+
+// peerOf is only implemented on Linux; access rules cannot be enforced elsewhere
+func peerOf(conn net.Conn) (*Peer, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultAnchorFile is the default location of the audit anchors
+var DefaultAnchorFile = filepath.Join(paths.DataDir(), "audit", "anchors.log")
+
+// Anchor counter-signs the head of an audit trail with a key kept apart from
+// the audit key, e.g. on a hardware wallet. An attacker holding the audit key
+// can rewrite the trail and re-sign it, but not the anchors over it. Anchors
+// are numbered and chained, and the signed message names the trail, so an
+// anchor cannot be replayed for another trail or in another position.
+type Anchor struct {
+	Counter uint64    `json:"counter"`
+	Time    time.Time `json:"time"`
+	// Trail is the hash of the first record, identifying the audit trail
+	Trail common.Hash `json:"trail"`
+	Seq   uint64      `json:"seq"`
+	Head  common.Hash `json:"head"`
+	// Prev is the digest of the previous anchor
+	Prev      common.Hash    `json:"prev"`
+	Signer    common.Address `json:"signer"`
+	Signature hexutil.Bytes  `json:"signature"`
+
+	// Chain and TxHash locate the transaction carrying the digest on-chain
+	Chain  string       `json:"chain,omitempty"`
+	TxHash *common.Hash `json:"txHash,omitempty"`
+}
+
+// NewAnchor returns the unsigned anchor following anchors over the latest
+// record of an audit trail
+func NewAnchor(records []*Record, anchors []*Anchor) (*Anchor, error) {
+	if len(records) == 0 {
+		return nil, errors.New("audit log has no records")
+	}
+	head := records[len(records)-1]
+	anchor := &Anchor{
+		Counter: 1,
+		Time:    time.Now().UTC().Truncate(time.Second),
+		Trail:   records[0].Hash,
+		Seq:     head.Seq,
+		Head:    head.Hash,
+	}
+	if len(anchors) > 0 {
+		last := anchors[len(anchors)-1]
+		anchor.Counter = last.Counter + 1
+		anchor.Prev = last.Digest()
+	}
+	return anchor, nil
+}
+
+// Message returns the message the anchor key signs as an EIP-191 personal
+// message, readable on a hardware wallet screen
+func (a *Anchor) Message() []byte {
+	return []byte(fmt.Sprintf("GoSignerVault audit anchor #%d\ntrail: %s\nrecord: %d\nhead: %s\nprevious: %s\ntime: %s",
+		a.Counter, a.Trail.Hex(), a.Seq, a.Head.Hex(), a.Prev.Hex(), a.Time.UTC().Format(time.RFC3339)))
+}
+
+// Digest returns the hash of the anchor message, which later anchors chain
+// to and on-chain anchors carry as calldata
+func (a *Anchor) Digest() common.Hash {
+	return crypto.Keccak256Hash(a.Message())
+}
+
+// ReadAnchors reads the anchors of an anchor file. A missing file has no anchors.
+func ReadAnchors(path string) ([]*Anchor, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit anchors: %v", err)
+	}
+
+	var anchors []*Anchor
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var anchor Anchor
+		if err := json.Unmarshal(scanner.Bytes(), &anchor); err != nil {
+			return nil, fmt.Errorf("audit anchor line %d: failed to parse anchor: %v", line, err)
+		}
+		anchors = append(anchors, &anchor)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit anchors: %v", err)
+	}
+	return anchors, nil
+}
+
+// AppendAnchor appends a signed anchor to an anchor file
+func AppendAnchor(path string, anchor *Anchor) error {
+	line, err := json.Marshal(anchor)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit anchor: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit anchors: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit anchors: %v", err)
+	}
+	return nil
+}
+
+// VerifyAnchors checks that anchors are numbered and chained, signed by the
+// anchor key and match the records they cover. Records must be verified
+// with Verify first.
+func VerifyAnchors(records []*Record, anchors []*Anchor, signer common.Address) error {
+	if len(anchors) == 0 {
+		return errors.New("no audit anchors")
+	}
+	if len(records) == 0 {
+		return errors.New("audit log has no records")
+	}
+
+	var prev common.Hash
+	var seq uint64
+	for i, anchor := range anchors {
+		if anchor.Counter != uint64(i+1) {
+			return fmt.Errorf("anchor %d has number %d; anchors were removed or reordered", i+1, anchor.Counter)
+		}
+		if anchor.Prev != prev {
+			return fmt.Errorf("anchor %d does not follow anchor %d", anchor.Counter, anchor.Counter-1)
+		}
+		recovered, err := core.RecoverMessageSigner(anchor.Message(), anchor.Signature, false)
+		if err != nil {
+			return fmt.Errorf("anchor %d has an invalid signature: %v", anchor.Counter, err)
+		}
+		if recovered != signer || anchor.Signer != signer {
+			return fmt.Errorf("anchor %d is signed by %s, not by the anchor key %s", anchor.Counter, recovered.Hex(), signer.Hex())
+		}
+		if anchor.Trail != records[0].Hash {
+			return fmt.Errorf("anchor %d covers another audit trail (first record %s)", anchor.Counter, anchor.Trail.Hex())
+		}
+		if anchor.Seq < seq {
+			return fmt.Errorf("anchor %d covers record %d, before anchor %d", anchor.Counter, anchor.Seq, anchor.Counter-1)
+		}
+		if anchor.Seq == 0 || anchor.Seq > uint64(len(records)) {
+			return fmt.Errorf("anchor %d covers record %d, but the audit log ends at record %d; records were removed", anchor.Counter, anchor.Seq, len(records))
+		}
+		if records[anchor.Seq-1].Hash != anchor.Head {
+			return fmt.Errorf("record %d differs from the one anchor %d covers; the audit log was rewritten", anchor.Seq, anchor.Counter)
+		}
+		prev = anchor.Digest()
+		seq = anchor.Seq
+	}
+	return nil
+}
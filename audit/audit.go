@@ -0,0 +1,289 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EnvOperator names the operator recorded in audit records
+const EnvOperator = "GOSIGNERVAULT_OPERATOR"
+
+// Operations recorded in the audit trail
+const (
+	OpSignTransaction = "sign-transaction"
+	OpSignMessage     = "sign-message"
+	OpSignTypedData   = "sign-typed-data"
+	OpSignSafe        = "sign-safe"
+	OpApproveRequest  = "approve-request"
+	OpRejectRequest   = "reject-request"
+	OpBroadcast       = "broadcast"
+	OpImportKey       = "import-key"
+	OpExportKey       = "export-key"
+	OpKeyState        = "key-state"
+	OpSignBundle      = "sign-bundle"
+	OpApplyBundle     = "apply-bundle"
+	OpDeleteKey       = "delete-key"
+)
+
+// Outcomes of recorded operations
+const (
+	OutcomeSigned    = "signed"
+	OutcomeRefused   = "refused"
+	OutcomeBroadcast = "broadcast"
+	OutcomeScheduled = "scheduled"
+	OutcomeWithdrawn = "withdrawn"
+	OutcomeFailed    = "failed"
+	OutcomeImported  = "imported"
+	OutcomeRevealed  = "revealed"
+	OutcomeChanged   = "changed"
+	OutcomeInstalled = "installed"
+	OutcomeDeleted   = "deleted"
+)
+
+var (
+	// DefaultLogFile is the default location of the audit trail
+	DefaultLogFile = filepath.Join(paths.DataDir(), "audit", "audit.log")
+	// DefaultKeyFile is the default location of the key that signs audit records
+	DefaultKeyFile = filepath.Join(paths.DataDir(), "audit", "audit.key")
+)
+
+// Record is one entry of the audit trail. Every record commits to its
+// predecessor through PrevHash and is signed by the audit key, so removing,
+// reordering or editing records breaks the chain.
+type Record struct {
+	Seq         uint64       `json:"seq"`
+	Time        time.Time    `json:"time"`
+	Operation   string       `json:"operation"`
+	Outcome     string       `json:"outcome"`
+	Operator    string       `json:"operator"`
+	Key         string       `json:"key,omitempty"`
+	Signer      string       `json:"signer,omitempty"`
+	Chain       string       `json:"chain,omitempty"`
+	ChainID     string       `json:"chainId,omitempty"`
+	PayloadHash common.Hash  `json:"payloadHash"`
+	TxHash      *common.Hash `json:"txHash,omitempty"`
+	Policy      []string     `json:"policy,omitempty"`
+	Detail      string       `json:"detail,omitempty"`
+	// Confirmation is the phrase the operator typed to confirm a destructive
+	// operation
+	Confirmation string        `json:"confirmation,omitempty"`
+	PrevHash     common.Hash   `json:"prevHash"`
+	Hash         common.Hash   `json:"hash"`
+	Signature    hexutil.Bytes `json:"signature"`
+}
+
+// digest returns the hash a record is signed over: its JSON encoding without
+// the hash and signature
+func (r *Record) digest() (common.Hash, error) {
+	body := *r
+	body.Hash = common.Hash{}
+	body.Signature = nil
+	data, err := json.Marshal(&body)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
+// Log is an append-only audit trail with one JSON record per line
+type Log struct {
+	path string
+	key  *ecdsa.PrivateKey
+
+	mu sync.Mutex
+}
+
+// Open opens the audit trail at path, loading the audit key from keyPath or
+// creating it on first use
+func Open(path, keyPath string) (*Log, error) {
+	key, err := loadOrCreateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %v", err)
+	}
+	return &Log{path: path, key: key}, nil
+}
+
+// Signer returns the address of the audit key
+func (l *Log) Signer() common.Address {
+	return crypto.PubkeyToAddress(l.key.PublicKey)
+}
+
+// Append chains, signs and appends a record. Seq, Time, PrevHash, Hash and
+// Signature are filled in; Operator defaults to the current operator.
+func (l *Log) Append(record *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := Read(l.path)
+	if err != nil {
+		return err
+	}
+	record.Seq = 1
+	record.PrevHash = common.Hash{}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		record.Seq = last.Seq + 1
+		record.PrevHash = last.Hash
+	}
+	record.Time = time.Now().UTC()
+	if record.Operator == "" {
+		record.Operator = Operator()
+	}
+
+	record.Hash, err = record.digest()
+	if err != nil {
+		return err
+	}
+	record.Signature, err = crypto.Sign(record.Hash[:], l.key)
+	if err != nil {
+		return fmt.Errorf("failed to sign audit record: %v", err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+// Read reads the records of an audit trail. A missing file has no records.
+func Read(path string) ([]*Record, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	var records []*Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("audit log line %d: failed to parse record: %v", line, err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	return records, nil
+}
+
+// Verify checks the sequence, hash chain and signatures of records and
+// returns the address of the key that signed them all
+func Verify(records []*Record) (common.Address, error) {
+	if len(records) == 0 {
+		return common.Address{}, errors.New("audit log has no records")
+	}
+
+	var signer common.Address
+	var prev common.Hash
+	for i, record := range records {
+		if record.Seq != uint64(i+1) {
+			return signer, fmt.Errorf("record %d has sequence number %d; records were removed or reordered", i+1, record.Seq)
+		}
+		if record.PrevHash != prev {
+			return signer, fmt.Errorf("record %d does not follow record %d", record.Seq, record.Seq-1)
+		}
+		digest, err := record.digest()
+		if err != nil {
+			return signer, err
+		}
+		if digest != record.Hash {
+			return signer, fmt.Errorf("record %d was modified after it was written", record.Seq)
+		}
+
+		pub, err := crypto.SigToPub(record.Hash[:], record.Signature)
+		if err != nil {
+			return signer, fmt.Errorf("record %d has an invalid signature: %v", record.Seq, err)
+		}
+		address := crypto.PubkeyToAddress(*pub)
+		if i == 0 {
+			signer = address
+		} else if address != signer {
+			return signer, fmt.Errorf("record %d is signed by %s, not by the audit key %s", record.Seq, address.Hex(), signer.Hex())
+		}
+		prev = record.Hash
+	}
+	return signer, nil
+}
+
+// Operator returns the operator recorded in audit records: $GOSIGNERVAULT_OPERATOR,
+// or the user and host running the CLI
+func Operator() string {
+	if operator := os.Getenv(EnvOperator); operator != "" {
+		return operator
+	}
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// KeyAddress returns the address of the audit key at keyPath without creating it
+func KeyAddress(keyPath string) (common.Address, error) {
+	key, err := crypto.LoadECDSA(keyPath)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to load audit key: %v", err)
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// loadOrCreateKey loads the audit key or generates it on first use
+func loadOrCreateKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.LoadECDSA(path)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load audit key: %v", err)
+	}
+
+	key, err = crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate audit key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %v", err)
+	}
+	if err := crypto.SaveECDSA(path, key); err != nil {
+		return nil, fmt.Errorf("failed to save audit key: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader lists the columns of a CSV export
+var csvHeader = []string{
+	"seq", "time", "operation", "outcome", "operator", "key", "signer", "chain", "chainId",
+	"payloadHash", "txHash", "policy", "detail", "confirmation", "prevHash", "hash", "signature",
+}
+
+// Filter selects records for export. Zero fields match everything.
+type Filter struct {
+	Since     time.Time
+	Until     time.Time
+	Operation string
+}
+
+// Select returns the records matching a filter
+func Select(records []*Record, filter Filter) []*Record {
+	var selected []*Record
+	for _, record := range records {
+		if !filter.Since.IsZero() && record.Time.Before(filter.Since) {
+			continue
+		}
+		if !filter.Until.IsZero() && record.Time.After(filter.Until) {
+			continue
+		}
+		if filter.Operation != "" && record.Operation != filter.Operation {
+			continue
+		}
+		selected = append(selected, record)
+	}
+	return selected
+}
+
+// Export writes records as "json" (an array of records, verifiable on its own
+// if nothing was filtered out) or "csv" for spreadsheets
+func Export(w io.Writer, records []*Record, format string) error {
+	switch format {
+	case "json":
+		if records == nil {
+			records = []*Record{}
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit records: %v", err)
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, record := range records {
+			txHash := ""
+			if record.TxHash != nil {
+				txHash = record.TxHash.Hex()
+			}
+			if err := writer.Write([]string{
+				strconv.FormatUint(record.Seq, 10),
+				record.Time.Format(time.RFC3339Nano),
+				record.Operation,
+				record.Outcome,
+				record.Operator,
+				record.Key,
+				record.Signer,
+				record.Chain,
+				record.ChainID,
+				record.PayloadHash.Hex(),
+				txHash,
+				strings.Join(record.Policy, "; "),
+				record.Detail,
+				record.Confirmation,
+				record.PrevHash.Hex(),
+				record.Hash.Hex(),
+				record.Signature.String(),
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	default:
+		return fmt.Errorf("unknown export format %q (expected json or csv)", format)
+	}
+}
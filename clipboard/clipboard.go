@@ -0,0 +1,166 @@
+// Package clipboard places values on the system clipboard through the tools of
+// each platform and clears them again, so addresses, signatures and signed
+// transactions do not linger in the clipboard and its managers
+package clipboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultClearAfter is how long a copied value stays on the clipboard
+const DefaultClearAfter = 30 * time.Second
+
+// ErrUnavailable is returned when no clipboard tool is installed
+var ErrUnavailable = errors.New("no clipboard tool found")
+
+// tool holds the commands that copy stdin to the clipboard, print it and
+// clear it. A tool without a clear command is cleared by copying nothing.
+type tool struct {
+	copy  []string
+	paste []string
+	clear []string
+}
+
+// tools returns the clipboard tools of this platform in order of preference.
+// Wayland and X11 sessions are told apart by their display variables.
+func tools() []tool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []tool{{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}}
+	case "windows":
+		return []tool{{
+			copy:  []string{"clip"},
+			paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard"},
+		}}
+	}
+
+	var found []tool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		found = append(found, tool{
+			copy:  []string{"wl-copy"},
+			paste: []string{"wl-paste", "--no-newline"},
+			clear: []string{"wl-copy", "--clear"},
+		})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		found = append(found,
+			tool{
+				copy:  []string{"xclip", "-selection", "clipboard", "-in"},
+				paste: []string{"xclip", "-selection", "clipboard", "-out"},
+			},
+			tool{
+				copy:  []string{"xsel", "--clipboard", "--input"},
+				paste: []string{"xsel", "--clipboard", "--output"},
+				clear: []string{"xsel", "--clipboard", "--clear"},
+			})
+	}
+	return found
+}
+
+// detect returns the first installed clipboard tool
+func detect() (*tool, error) {
+	candidates := tools()
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no Wayland or X11 display on %s", ErrUnavailable, runtime.GOOS)
+	}
+	var names []string
+	for i := range candidates {
+		if _, err := exec.LookPath(candidates[i].copy[0]); err == nil {
+			return &candidates[i], nil
+		}
+		names = append(names, candidates[i].copy[0])
+	}
+	return nil, fmt.Errorf("%w: install %s", ErrUnavailable, strings.Join(names, " or "))
+}
+
+// Copy places a value on the clipboard
+func Copy(value string) error {
+	t, err := detect()
+	if err != nil {
+		return err
+	}
+	return run(t.copy, value, nil)
+}
+
+// Read returns the text on the clipboard without a trailing newline
+func Read() (string, error) {
+	t, err := detect()
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := run(t.paste, "", &out); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
+
+// Clear empties the clipboard
+func Clear() error {
+	t, err := detect()
+	if err != nil {
+		return err
+	}
+	if t.clear != nil {
+		return run(t.clear, "", nil)
+	}
+	return run(t.copy, "", nil)
+}
+
+// ClearIf empties the clipboard if it still holds the value with the given
+// digest, so a value the user copied since is left alone. A clipboard that
+// cannot be read is cleared.
+func ClearIf(digest string) error {
+	if current, err := Read(); err == nil && Digest(current) != digest {
+		return nil
+	}
+	return Clear()
+}
+
+// Digest identifies a copied value without holding it, so the process that
+// clears the clipboard later never sees the value itself
+func Digest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// run runs a clipboard command with stdin. The error output is only kept
+// when reading: xclip and wl-copy leave a child serving the clipboard, which
+// would hold a captured stderr open and block until the clipboard changes.
+func run(args []string, stdin string, stdout *bytes.Buffer) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	if stdout != nil {
+		cmd.Stdout, cmd.Stderr = stdout, &stderr
+	}
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s: %v: %s", args[0], err, message)
+		}
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	return nil
+}
+
+// ScheduleClear starts a detached process that runs args, a command clearing
+// the clipboard after a delay, so the clipboard is cleared after this process
+// has exited. The process outlives the terminal it was started from.
+func ScheduleClear(args []string, env []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.SysProcAttr = detached()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the clipboard clearing process: %v", err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package clipboard
+
+import "syscall"
+
+// detached leaves the process attached; this platform has no sessions
+func detached() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package clipboard
+
+import "syscall"
+
+// detached starts the process in a session of its own, so closing the
+// terminal does not stop it
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package clipboard
+
+import "syscall"
+
+// Process creation flags of a process without a console
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// detached starts the process without the console, so closing it does not
+// stop the process
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
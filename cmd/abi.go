@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	abiName   string
+	abiTopics []string
+)
+
+// ABICmd is the root command for managing the ABI library
+var ABICmd = &cobra.Command{
+	Use:   "abi",
+	Short: "Manage contract ABIs and decode calldata and event logs",
+	Long: `The ABI library holds contract ABIs used to decode calldata and event logs. Stored
+ABIs are applied automatically to transaction previews, simulation output and the history,
+alongside the built-in ERC-20, ERC-721 and Safe ABIs.`,
+}
+
+var abiAddCmd = &cobra.Command{
+	Use:   "add [file]",
+	Short: "Add an ABI or compiler artifact to the library",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := abiName
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		}
+		path, err := core.SaveABI(core.ABIDir, name, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added ABI %s: %s\n", name, path)
+		return nil
+	},
+}
+
+var abiListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the ABIs of the library",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stored, err := core.ListABIs(core.ABIDir)
+		if err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			fmt.Println("No ABIs stored; add one with 'abi add'")
+			return nil
+		}
+		for _, entry := range stored {
+			fmt.Printf("%-20s %3d functions %3d events\n", entry.Name, len(entry.ABI.Methods), len(entry.ABI.Events))
+		}
+		return nil
+	},
+}
+
+var abiShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the functions and events of a stored ABI",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stored, err := core.ListABIs(core.ABIDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range stored {
+			if entry.Name != args[0] {
+				continue
+			}
+			var functions, events []string
+			for _, method := range entry.ABI.Methods {
+				functions = append(functions, fmt.Sprintf("0x%x %s", method.ID, method.Sig))
+			}
+			for _, event := range entry.ABI.Events {
+				events = append(events, fmt.Sprintf("%s %s", event.ID.Hex(), event.Sig))
+			}
+			sort.Strings(functions)
+			sort.Strings(events)
+
+			fmt.Printf("%s (%s)\n", entry.Name, entry.Path)
+			fmt.Println("Functions:")
+			for _, line := range functions {
+				fmt.Printf("  %s\n", line)
+			}
+			fmt.Println("Events:")
+			for _, line := range events {
+				fmt.Printf("  %s\n", line)
+			}
+			return nil
+		}
+		return fmt.Errorf("no ABI named %q; see 'abi list'", args[0])
+	},
+}
+
+var abiRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove an ABI from the library",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := core.RemoveABI(core.ABIDir, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed ABI %s\n", args[0])
+		return nil
+	},
+}
+
+var abiDecodeCmd = &cobra.Command{
+	Use:   "decode [hex]",
+	Short: "Decode calldata or, with --topic, the data of an event log",
+	Long: `Decode raw calldata into its function and arguments. With --topic the input is the
+data of an event log instead, given with all its topics in order: the event signature hash
+first, then the indexed arguments.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := decodeHexInput(args[0])
+		if err != nil {
+			return err
+		}
+		decoder, err := newCallDecoder()
+		if err != nil {
+			return err
+		}
+
+		if len(abiTopics) > 0 {
+			topics := make([]common.Hash, len(abiTopics))
+			for i, topic := range abiTopics {
+				value, err := hexutil.Decode(topic)
+				if err != nil || len(value) != common.HashLength {
+					return fmt.Errorf("invalid topic %q: expected 32 hex-encoded bytes", topic)
+				}
+				topics[i] = common.BytesToHash(value)
+			}
+			event, err := decoder.DecodeLog(topics, data)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Event:    %s\n", event.Signature)
+			printDecodedArgs("  ", event.Args)
+			return nil
+		}
+
+		call, err := decoder.Decode(data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Function: %s\n", call.Signature)
+		printDecodedArgs("  ", call.Args)
+		return nil
+	},
+}
+
+// decodeHexInput decodes hex data with or without its 0x prefix
+func decodeHexInput(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "0x") && !strings.HasPrefix(value, "0X") {
+		value = "0x" + value
+	}
+	data, err := hexutil.Decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %v", err)
+	}
+	return data, nil
+}
+
+// printDecodedArgs prints decoded arguments, naming known addresses
+func printDecodedArgs(indent string, args []core.DecodedArg) {
+	for _, arg := range args {
+		value := arg.Value
+		if arg.Type == "address" && common.IsHexAddress(value) {
+			value = nickname(common.HexToAddress(value))
+		}
+		typ := arg.Type
+		if arg.Indexed {
+			typ += ", indexed"
+		}
+		fmt.Printf("%s%s (%s): %s\n", indent, arg.Name, typ, value)
+	}
+}
+
+func init() {
+	// Add flags
+	abiAddCmd.Flags().StringVar(&abiName, "name", "", "Name of the ABI in the library (defaults to the file name)")
+	abiDecodeCmd.Flags().StringSliceVar(&abiTopics, "topic", nil, "Topic of the event log to decode (repeatable, in order)")
+	abiDecodeCmd.Flags().StringSliceVar(&abiFiles, "abi", nil, "Additional ABI files used to decode")
+	abiDecodeCmd.Flags().StringVar(&signatureDB, "4byte-db", "", "Local 4byte signature database (JSON selector -> signatures)")
+
+	// Add commands
+	ABICmd.AddCommand(abiAddCmd)
+	ABICmd.AddCommand(abiListCmd)
+	ABICmd.AddCommand(abiShowCmd)
+	ABICmd.AddCommand(abiRemoveCmd)
+	ABICmd.AddCommand(abiDecodeCmd)
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	accountAddress string
+	accountChains  []string
+	allChains      bool
+	accountTokens  []string
+	watchAccounts  bool
+)
+
+// AccountCmd is the root command for account inspection
+var AccountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Inspect accounts on chain",
+	Long:  `Inspect the on-chain state of wallet keys and addresses.`,
+}
+
+var accountInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show balances and nonces of an account",
+	Long: `Show the native balance, nonce and ERC-20 token balances of a key or address on one or more
+chains, to check an account is funded before signing and broadcasting. --address also accepts
+an address book label; --watch shows every watch-only account of the address book.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		book, err := loadAddressBook()
+		if err != nil {
+			return err
+		}
+
+		var addresses []common.Address
+		if watchAccounts {
+			if book == nil {
+				return errors.New("--watch needs an unlocked address book")
+			}
+			for _, entry := range book.Entries() {
+				if entry.Kind == addressbook.KindWatch {
+					addresses = append(addresses, entry.Address)
+				}
+			}
+			if len(addresses) == 0 {
+				return errors.New("address book has no watch-only accounts")
+			}
+		} else {
+			address, err := resolveAccountAddress(book)
+			if err != nil {
+				return err
+			}
+			addresses = append(addresses, address)
+		}
+
+		tokens, err := parseAddresses(accountTokens)
+		if err != nil {
+			return err
+		}
+
+		chains := accountChains
+		if allChains {
+			chains, err = core.ChainNames()
+			if err != nil {
+				return err
+			}
+		}
+
+		// Query each chain, reporting failures without hiding the other chains
+		var failed []string
+		for i, address := range addresses {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("Account %s\n", labeled(book, address))
+
+			for _, name := range chains {
+				if err := printAccountInfo(name, address, tokens); err != nil {
+					fmt.Printf("\n%s: %v\n", name, err)
+					failed = append(failed, name)
+				}
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to query %d of %d chains: %v", len(failed), len(chains)*len(addresses), failed)
+		}
+		return nil
+	},
+}
+
+// printAccountInfo queries and prints the state of an address on a chain
+func printAccountInfo(name string, address common.Address, extraTokens []common.Address) error {
+	chain, err := core.GetChainConfig(name)
+	if err != nil {
+		return fmt.Errorf("failed to get chain config: %v", err)
+	}
+
+	// Tokens configured for the chain are always included
+	tokens, err := parseAddresses(chain.Tokens)
+	if err != nil {
+		return err
+	}
+	tokens = append(tokens, extraTokens...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := tx.FetchAccountInfo(ctx, chain.RPCURL, address, tokens)
+	if err != nil {
+		return err
+	}
+	if info.ChainID.Cmp(chain.ChainID) != 0 {
+		return fmt.Errorf("RPC reports chain ID %s, expected %s", info.ChainID, chain.ChainID)
+	}
+
+	fmt.Printf("\n%s (ID %s) at block %d\n", chain.Name, chain.ChainID, info.BlockNumber)
+	fmt.Printf("  Balance: %s\n", formatNative(chain, info.Balance))
+	fmt.Printf("  Nonce:   %d", info.Nonce)
+	if info.PendingNonce != info.Nonce {
+		fmt.Printf(" (%d pending)", info.PendingNonce-info.Nonce)
+	}
+	fmt.Println()
+	if info.IsContract {
+		fmt.Printf("  Code:    contract, code hash %s\n", info.CodeHash.Hex())
+	}
+	for _, token := range info.Tokens {
+		fmt.Printf("  %s: %s (%s)\n", token.Symbol, core.FormatTokenAmount(token.Balance, token.Decimals), token.Address.Hex())
+	}
+	return nil
+}
+
+// resolveAccountAddress returns the address given by --address, directly or by
+// its address book label, or the address of the key selected by --name
+func resolveAccountAddress(book *addressbook.Book) (common.Address, error) {
+	switch {
+	case accountAddress != "" && keyName != "":
+		return common.Address{}, errors.New("--address and --name are mutually exclusive")
+	case accountAddress != "" && book != nil:
+		address, err := book.Resolve(accountAddress)
+		if err != nil && core.IsENSName(accountAddress) {
+			return resolveENSName(accountAddress)
+		}
+		return address, err
+	case accountAddress != "" && core.IsENSName(accountAddress):
+		return resolveENSName(accountAddress)
+	case accountAddress != "":
+		if !common.IsHexAddress(accountAddress) {
+			return common.Address{}, fmt.Errorf("invalid address: %s", accountAddress)
+		}
+		return common.HexToAddress(accountAddress), nil
+	case keyName == "":
+		return common.Address{}, errors.New("--address or --name is required")
+	}
+
+	// Keystore files record their address, so no password is needed
+	if keystoreBackend == "file" {
+		manager, err := keystore.NewManager(keystoreDir)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to create keystore manager: %v", err)
+		}
+		encryptedKey, err := manager.LoadKey(keyName)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to load key: %v", err)
+		}
+		return common.HexToAddress(encryptedKey.Address), nil
+	}
+
+	signer, err := openSigner()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return signer.Address(), nil
+}
+
+func init() {
+	// Add flags
+	AccountCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	addKeystoreBackendFlags(AccountCmd)
+	addAddressBookFlags(AccountCmd)
+
+	accountInfoCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	accountInfoCmd.Flags().StringVar(&accountAddress, "address", "", "Address, ENS name or address book label to inspect instead of a stored key")
+	accountInfoCmd.Flags().BoolVar(&watchAccounts, "watch", false, "Inspect every watch-only account of the address book")
+	accountInfoCmd.Flags().StringSliceVar(&accountChains, "chain", []string{"ethereum"}, "Chain name (repeatable)")
+	accountInfoCmd.Flags().BoolVar(&allChains, "all-chains", false, "Query every configured chain")
+	accountInfoCmd.Flags().StringSliceVar(&accountTokens, "token", nil, "Additional ERC-20 token to show the balance of (repeatable)")
+
+	// Add commands
+	AccountCmd.AddCommand(accountInfoCmd)
+}
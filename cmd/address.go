@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+// bookPasswordEnv supplies the address book password when --book-password is not given
+const bookPasswordEnv = "GOSIGNERVAULT_BOOK_PASSWORD"
+
+var (
+	addressBookFile string
+	bookPassword    string
+
+	entryLabel    string
+	entryContract bool
+	entryNote     string
+)
+
+// AddressCmd is the root command for the address book
+var AddressCmd = &cobra.Command{
+	Use:   "address",
+	Short: "Manage the address book",
+	Long: `Label watch-only accounts and contract addresses. Labels are shown in transaction previews,
+history listings and account output, and signing to an address missing from the book warns.
+The book is encrypted with --book-password (or $GOSIGNERVAULT_BOOK_PASSWORD) and kept next
+to the keystore.`,
+}
+
+var addressAddCmd = &cobra.Command{
+	Use:   "add <address|ens-name>",
+	Short: "Add a labeled address",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var address common.Address
+		switch {
+		case core.IsENSName(args[0]):
+			resolved, err := resolveENSName(args[0])
+			if err != nil {
+				return err
+			}
+			address = resolved
+		case common.IsHexAddress(args[0]):
+			address = common.HexToAddress(args[0])
+		default:
+			return fmt.Errorf("invalid address: %s", args[0])
+		}
+		book, err := openAddressBookForEdit()
+		if err != nil {
+			return err
+		}
+
+		entry := &addressbook.Entry{
+			Label:   entryLabel,
+			Address: address,
+			Kind:    addressbook.KindWatch,
+			Note:    entryNote,
+		}
+		if entryContract {
+			entry.Kind = addressbook.KindContract
+		}
+		if err := book.Add(entry); err != nil {
+			return err
+		}
+		if err := book.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added %s as %q (%s)\n", entry.Address.Hex(), entry.Label, entry.Kind)
+		return nil
+	},
+}
+
+var addressListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List labeled addresses",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		book, err := openAddressBookForEdit()
+		if err != nil {
+			return err
+		}
+
+		entries := book.Entries()
+		if len(entries) == 0 {
+			fmt.Println("Address book is empty")
+			return nil
+		}
+		for _, entry := range entries {
+			fmt.Printf("%-20s %-8s %s", entry.Label, entry.Kind, entry.Address.Hex())
+			if entry.Note != "" {
+				fmt.Printf("  %s", entry.Note)
+			}
+			if entry.Device != nil {
+				fmt.Printf("  (%s %s, device %s)", entry.Device.Kind, entry.Device.Path, entry.Device.Fingerprint.Hex())
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var addressRemoveCmd = &cobra.Command{
+	Use:   "remove <label|address>",
+	Short: "Remove an address from the book",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		book, err := openAddressBookForEdit()
+		if err != nil {
+			return err
+		}
+		entry, err := book.Remove(args[0])
+		if err != nil {
+			return err
+		}
+		if err := book.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed %q (%s)\n", entry.Label, entry.Address.Hex())
+		return nil
+	},
+}
+
+// addAddressBookFlags adds the flags locating and unlocking the address book
+func addAddressBookFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&addressBookFile, "address-book", "", "Address book file (defaults to addressbook.enc in the keystore directory)")
+	cmd.PersistentFlags().StringVar(&bookPassword, "book-password", "", "Address book password (defaults to $"+bookPasswordEnv+")")
+}
+
+// addressBookPath returns the address book file in use
+func addressBookPath() string {
+	if addressBookFile != "" {
+		return addressBookFile
+	}
+	return filepath.Join(firstNonEmpty(keystoreDir, keystore.DefaultKeystoreDir), addressbook.FileName)
+}
+
+// openAddressBookForEdit opens the address book, creating it if needed
+func openAddressBookForEdit() (*addressbook.Book, error) {
+	password := firstNonEmpty(bookPassword, os.Getenv(bookPasswordEnv))
+	if password == "" {
+		return nil, fmt.Errorf("--book-password or $%s is required", bookPasswordEnv)
+	}
+	return addressbook.Open(addressBookPath(), password)
+}
+
+// loadAddressBook opens the address book for labels. It returns nil without
+// an error if there is no book, or if it is locked and no password was given.
+func loadAddressBook() (*addressbook.Book, error) {
+	path := addressBookPath()
+	if !addressbook.Exists(path) {
+		return nil, nil
+	}
+	password := firstNonEmpty(bookPassword, os.Getenv(bookPasswordEnv))
+	if password == "" {
+		fmt.Printf("Note: address book %s is locked; pass --book-password to show labels\n", path)
+		return nil, nil
+	}
+	return addressbook.Open(path, password)
+}
+
+// labeled formats an address with its address book label, the keystore key
+// holding it and the ENS name it was given as, if any. With --raw it is
+// printed bare.
+func labeled(book *addressbook.Book, address common.Address) string {
+	if rawAddresses {
+		return address.Hex()
+	}
+	var names []string
+	if book != nil {
+		if entry, ok := book.Lookup(address); ok {
+			names = append(names, entry.Label)
+		}
+	}
+	if name, ok := keyNickname(address); ok {
+		names = append(names, name)
+	}
+	if name, ok := ensNames[address]; ok {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return address.Hex()
+	}
+	return fmt.Sprintf("%s (%s)", address.Hex(), strings.Join(names, ", "))
+}
+
+// warnUnknownAddress warns when a destination is missing from the address book
+func warnUnknownAddress(book *addressbook.Book, address common.Address, role string) {
+	if book == nil {
+		return
+	}
+	if _, ok := book.Lookup(address); !ok {
+		fmt.Printf("  Warning: %s %s is not in the address book\n", role, address.Hex())
+	}
+}
+
+func init() {
+	// Add flags
+	AddressCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	addAddressBookFlags(AddressCmd)
+
+	addressAddCmd.Flags().StringVar(&entryLabel, "label", "", "Label of the address")
+	addressAddCmd.Flags().BoolVar(&entryContract, "contract", false, "Mark the address as a contract instead of a watch-only account")
+	addressAddCmd.Flags().StringVar(&entryNote, "note", "", "Free-form note")
+
+	// Mark required flags
+	addressAddCmd.MarkFlagRequired("label")
+
+	// Add commands
+	AddressCmd.AddCommand(addressAddCmd)
+	AddressCmd.AddCommand(addressListCmd)
+	AddressCmd.AddCommand(addressRemoveCmd)
+}
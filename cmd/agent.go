@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/agent"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentSocket  string
+	agentKeys    []string
+	agentTimeout time.Duration
+	agentAccess  string
+)
+
+// AgentCmd is the root command for the signing agent
+var AgentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Keep keys unlocked for a session",
+	Long: `Run an agent, similar to ssh-agent, that decrypts file keystore keys once and signs for
+later commands over a unix socket, so a batch of transactions does not need the password
+for every one. Commands of the file keystore use a key unlocked in the agent when no
+--password is given. Keys lock after --timeout without use or on 'agent lock'.`,
+}
+
+var agentStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the agent and unlock keys",
+	Long: `Start the agent in the foreground and unlock the keys given with --name, asking for each
+password unless --password is given. Key material stays in the agent's memory, locked against
+swapping where the platform allows it. Stop it with Ctrl-C or 'agent stop'.
+
+On Linux, --access restricts the socket to the clients of a rules file. Each connection is
+matched by the user, primary group and executable of the process on the other end, as
+reported by the kernel, against the rules in order; the first match decides which keys it can
+list and sign with and whether it may unlock, lock or stop. Connections no rule admits are
+refused and logged:
+
+  {"clients": [
+    {"name": "ci", "uids": [1001], "binaries": ["/usr/local/bin/gosignervaultcli"], "keys": ["payroll"]},
+    {"name": "owner", "uids": [1000], "keys": ["*"], "manage": true}
+  ]}
+
+Rules admitting other users make the socket accessible to them. Its directory must already
+let them in (e.g. --socket /run/gosignervault/agent.sock in a group directory); the agent
+refuses to start on a directory only its owner can enter, like the default data directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := agent.New(keystoreDir, agentTimeout)
+		if err != nil {
+			return err
+		}
+		if agentAccess != "" {
+			access, err := agent.LoadAccess(agentAccess)
+			if err != nil {
+				return err
+			}
+			if err := a.SetAccess(access); err != nil {
+				return err
+			}
+			fmt.Printf("Clients restricted to the %d rule(s) of %s\n", len(access.Clients), agentAccess)
+		}
+		if err := a.Listen(agentSocket); err != nil {
+			return err
+		}
+		defer a.Close()
+
+		if !agent.MemoryLocked() {
+			fmt.Println("Warning: this platform cannot lock memory; unlocked keys may be swapped to disk")
+		}
+		for _, name := range agentKeys {
+			keyPassword := password
+			if keyPassword == "" {
+				keyPassword, err = promptSecret(fmt.Sprintf("Password of %s", name))
+				if err != nil {
+					return err
+				}
+			}
+			address, err := a.Add(name, keyPassword)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Unlocked %s (%s)\n", name, address.Hex())
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			a.Close()
+		}()
+
+		fmt.Printf("Agent listening on %s\n", agentSocket)
+		if agentSocket != agent.DefaultSocket {
+			fmt.Printf("Point other commands at it with: export %s=%s\n", agent.EnvSocket, agentSocket)
+		}
+		if agentTimeout > 0 {
+			fmt.Printf("Keys lock after %s without use\n", agentTimeout)
+		}
+		return a.Serve()
+	},
+}
+
+var agentAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Unlock a key in the running agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Check the agent is running before asking for the password
+		client := agent.NewClient(agentSocket)
+		status, err := client.Status()
+		if err != nil {
+			return err
+		}
+		keyPassword := password
+		if keyPassword == "" {
+			keyPassword, err = promptSecret(fmt.Sprintf("Password of %s", keyName))
+			if err != nil {
+				return err
+			}
+		}
+		address, err := client.Add(keyName, keyPassword)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Unlocked %s (%s) from %s\n", keyName, address.Hex(), status.Keystore)
+		return nil
+	},
+}
+
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the keys unlocked in the agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, err := agent.NewClient(agentSocket).Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Agent on %s serving %s\n", agentSocket, status.Keystore)
+		if len(status.Keys) == 0 {
+			fmt.Println("No keys unlocked")
+			return nil
+		}
+		for _, key := range status.Keys {
+			fmt.Printf("  %s  %s\n", key.Address, key.Name)
+		}
+		if status.LocksAt != nil {
+			fmt.Printf("Keys lock at %s unless used\n", status.LocksAt.Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock every key in the agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := agent.NewClient(agentSocket).Lock(); err != nil {
+			return err
+		}
+		fmt.Println("All keys locked")
+		return nil
+	},
+}
+
+var agentStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Lock every key and stop the agent",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := agent.NewClient(agentSocket).Stop(); err != nil {
+			return err
+		}
+		fmt.Println("Agent stopped")
+		return nil
+	},
+}
+
+// agentSigner returns the signer of a key unlocked in a running agent that
+// serves the --keystore directory
+func agentSigner(name string) (keystore.Signer, error) {
+	signer, err := agent.NewClient(agent.Socket()).Signer(keystoreDir, name)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+func init() {
+	// Add flags
+	AgentCmd.PersistentFlags().StringVar(&agentSocket, "socket", agent.Socket(), "Agent socket (defaults to $"+agent.EnvSocket+")")
+
+	agentStartCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	agentStartCmd.Flags().StringSliceVar(&agentKeys, "name", nil, "Key to unlock (repeatable)")
+	agentStartCmd.Flags().StringVar(&password, "password", "", "Key password (prompted for if not given)")
+	agentStartCmd.Flags().StringVar(&agentAccess, "access", "", "Rules file restricting which processes may use the socket and see which keys (Linux)")
+	agentStartCmd.Flags().DurationVar(&agentTimeout, "timeout", agent.DefaultIdleTimeout, "Lock keys after this long without use (0 keeps them until 'agent lock')")
+
+	agentAddCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	agentAddCmd.Flags().StringVar(&password, "password", "", "Key password (prompted for if not given)")
+
+	// Mark required flags
+	agentAddCmd.MarkFlagRequired("name")
+
+	// Add commands
+	AgentCmd.AddCommand(agentStartCmd)
+	AgentCmd.AddCommand(agentAddCmd)
+	AgentCmd.AddCommand(agentListCmd)
+	AgentCmd.AddCommand(agentLockCmd)
+	AgentCmd.AddCommand(agentStopCmd)
+}
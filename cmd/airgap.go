@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/qr"
+	"github.com/aryehky/gosignervaultcli/tx"
+)
+
+var (
+	offlineMode        bool
+	qrMode             bool
+	qrInterval         time.Duration
+	allowNetworkIfaces bool
+)
+
+// offlineTransport refuses every HTTP request made while offline mode is enabled
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, tx.ErrOffline
+}
+
+// enforceOffline disables all network access for the rest of the process and,
+// unless --allow-network-interfaces is set, refuses to run while any
+// non-loopback network interface is up with an address assigned
+func enforceOffline() error {
+	tx.SetOffline(true)
+	http.DefaultTransport = offlineTransport{}
+	http.DefaultClient.Transport = offlineTransport{}
+
+	if allowNetworkIfaces {
+		return nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return fmt.Errorf("failed to list network interfaces: %v", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		return fmt.Errorf("offline mode: network interface %s is up (%s); disconnect it or pass --allow-network-interfaces",
+			iface.Name, addrs[0])
+	}
+
+	return nil
+}
+
+// scanUR reads UR parts from stdin, one per line (as typed by a QR scanner),
+// until the payload is complete
+func scanUR(urType string) ([]byte, error) {
+	decoder := qr.NewDecoder(urType)
+	fmt.Fprintf(os.Stderr, "Scan the %s QR code(s), one part per line:\n", urType)
+
+	for !decoder.Complete() {
+		line, err := stdin.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			if recvErr := decoder.Receive(line); recvErr != nil {
+				fmt.Fprintf(os.Stderr, "Ignoring part: %v\n", recvErr)
+			} else {
+				received, total := decoder.Progress()
+				fmt.Fprintf(os.Stderr, "Received %d of %d parts\n", received, total)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read QR input: %v", err)
+		}
+	}
+
+	if !decoder.Complete() {
+		return nil, errors.New("input ended before all QR parts were received")
+	}
+	return decoder.Result()
+}
+
+// displayUR shows a payload as a (possibly animated) QR code until interrupted
+func displayUR(urType string, payload []byte) error {
+	parts, err := qr.EncodeUR(urType, payload, qr.DefaultFragmentLen)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return qr.Display(ctx, os.Stdout, parts, qrInterval)
+}
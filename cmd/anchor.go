@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	anchorFile       string
+	anchorSigner     string
+	anchorChain      string
+	anchorEvery      time.Duration
+	anchorCheckChain bool
+)
+
+var auditAnchorCmd = &cobra.Command{
+	Use:   "anchor",
+	Short: "Counter-sign the head of the audit trail with a separate key",
+	Long: `Sign the latest record of the audit trail with a key kept apart from the audit key, such as
+a hardware wallet, and append the anchor to --anchors. The audit key sits on the same disk
+as the trail, so an attacker with full disk access could rewrite and re-sign the whole trail;
+they cannot forge anchors. Anchors are numbered and chained to their predecessor, and the
+signed message names the trail, so an anchor cannot be replayed elsewhere.
+
+With --chain the anchor digest is also sent as the calldata of a zero-value transaction to
+the anchor key itself, fixing its time on-chain even if the anchor file is lost. With --every
+the trail is anchored again at that interval whenever it has new records.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if anchorChain != "" && anchorEvery > 0 && !assumeYes {
+			return fmt.Errorf("--every with --chain needs --yes")
+		}
+		var chain *core.ChainConfig
+		if anchorChain != "" {
+			if offlineMode {
+				return fmt.Errorf("on-chain anchors need network access")
+			}
+			var err error
+			if chain, err = core.GetChainConfig(anchorChain); err != nil {
+				return fmt.Errorf("failed to get chain config: %v", err)
+			}
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if err := core.CheckCapability(signer, core.CapMessages); err != nil {
+			return err
+		}
+
+		// Records of the anchor transactions alone do not call for a new anchor
+		var anchoredHead uint64
+		for {
+			anchor, err := anchorAuditTrail(cmd, signer, chain, anchoredHead)
+			if err != nil {
+				return err
+			}
+			if anchor != nil && anchor.TxHash != nil {
+				if records, err := audit.Read(auditFile); err == nil && len(records) > 0 {
+					anchoredHead = records[len(records)-1].Seq
+				}
+			}
+			if anchor == nil {
+				fmt.Println("Audit trail has no records since the last anchor")
+			} else {
+				fmt.Printf("Anchor #%d covers record %d (%s), signed by %s\n", anchor.Counter, anchor.Seq, anchor.Head.Hex(), nickname(anchor.Signer))
+				if anchor.TxHash != nil {
+					fmt.Printf("Anchored on %s in transaction %s\n", anchor.Chain, anchor.TxHash.Hex())
+				}
+			}
+			if anchorEvery <= 0 {
+				return nil
+			}
+			time.Sleep(anchorEvery)
+		}
+	},
+}
+
+// anchorAuditTrail signs an anchor over the head of the audit trail, or
+// returns nil if the last anchor already covers it or it is record skipHead.
+// The trail and earlier anchors are verified first so a tampered trail is
+// never anchored.
+func anchorAuditTrail(cmd *cobra.Command, signer core.Signer, chain *core.ChainConfig, skipHead uint64) (*audit.Anchor, error) {
+	records, err := audit.Read(auditFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := audit.Verify(records); err != nil {
+		return nil, fmt.Errorf("refusing to anchor: audit trail %s is not intact: %v", auditFile, err)
+	}
+	anchors, err := audit.ReadAnchors(anchorFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(anchors) > 0 {
+		if err := audit.VerifyAnchors(records, anchors, signer.Address()); err != nil {
+			return nil, fmt.Errorf("refusing to anchor: anchors %s do not match: %v", anchorFile, err)
+		}
+		if head := records[len(records)-1].Seq; head == anchors[len(anchors)-1].Seq || head == skipHead {
+			return nil, nil
+		}
+	}
+
+	anchor, err := audit.NewAnchor(records, anchors)
+	if err != nil {
+		return nil, err
+	}
+	anchor.Signer = signer.Address()
+	if anchor.Signature, err = signer.SignMessage(anchor.Message()); err != nil {
+		return nil, fmt.Errorf("failed to sign anchor: %v", err)
+	}
+	if chain != nil {
+		if err := anchorOnChain(cmd, signer, chain, anchor); err != nil {
+			return nil, err
+		}
+	}
+	if err := audit.AppendAnchor(anchorFile, anchor); err != nil {
+		return nil, err
+	}
+	return anchor, nil
+}
+
+// anchorOnChain sends the digest of an anchor as the calldata of a
+// zero-value transaction from the anchor key to itself
+func anchorOnChain(cmd *cobra.Command, signer core.Signer, chain *core.ChainConfig, anchor *audit.Anchor) error {
+	from := signer.Address()
+	digest := anchor.Digest()
+	transaction := &core.Transaction{
+		To:      &from,
+		Value:   big.NewInt(0),
+		Data:    digest.Bytes(),
+		ChainID: chain.ChainID,
+	}
+	if err := fillTransaction(chain, transaction, from); err != nil {
+		return err
+	}
+
+	// Anchor transactions are signed like any other transaction
+	fmt.Printf("Anchor #%d on %s (digest %s)\n", anchor.Counter, chain.Name, digest.Hex())
+	hash, err := signAndBroadcast(cmd, signer, chain, transaction, "Sign and broadcast the anchor transaction?")
+	if err != nil {
+		return err
+	}
+
+	anchor.Chain, anchor.TxHash = chain.Name, &hash
+	return nil
+}
+
+// verifyAuditAnchors checks the anchors over a verified audit trail against
+// the pinned anchor key and, with --check-chain, their on-chain transactions
+func verifyAuditAnchors(records []*audit.Record) error {
+	anchors, err := audit.ReadAnchors(anchorFile)
+	if err != nil {
+		return err
+	}
+	if len(anchors) == 0 {
+		if anchorSigner != "" {
+			return fmt.Errorf("no audit anchors in %s", anchorFile)
+		}
+		return nil
+	}
+
+	signer := anchors[0].Signer
+	if anchorSigner != "" {
+		if !common.IsHexAddress(anchorSigner) {
+			return fmt.Errorf("invalid --anchor-signer address: %s", anchorSigner)
+		}
+		signer = common.HexToAddress(anchorSigner)
+	}
+	if err := audit.VerifyAnchors(records, anchors, signer); err != nil {
+		return fmt.Errorf("audit anchors %s do not match the trail: %v", anchorFile, err)
+	}
+
+	last := anchors[len(anchors)-1]
+	fmt.Printf("Anchors intact:     %d anchors signed by %s\n", len(anchors), signer.Hex())
+	fmt.Printf("Latest anchor:      #%d at %s covers record %d\n", last.Counter, last.Time.Format("2006-01-02 15:04:05"), last.Seq)
+	if unanchored := uint64(len(records)) - last.Seq; unanchored > 0 {
+		fmt.Printf("Unanchored records: %d\n", unanchored)
+	}
+	if anchorSigner == "" {
+		fmt.Println("Warning: anchor key not pinned; pass --anchor-signer to pin the expected anchor key")
+	}
+
+	if anchorCheckChain {
+		for _, anchor := range anchors {
+			if anchor.TxHash == nil {
+				continue
+			}
+			block, err := checkOnChainAnchor(anchor)
+			if err != nil {
+				return fmt.Errorf("anchor %d: %v", anchor.Counter, err)
+			}
+			fmt.Printf("  Anchor #%d found on %s in block %s\n", anchor.Counter, anchor.Chain, block)
+		}
+	}
+	return nil
+}
+
+// checkOnChainAnchor checks that the transaction of an anchor was sent by the
+// anchor key and carries the anchor digest, returning its block
+func checkOnChainAnchor(anchor *audit.Anchor) (*big.Int, error) {
+	chain, err := core.GetChainConfig(anchor.Chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain config: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	included, block, err := tx.FetchIncluded(ctx, chain.RPCURL, *anchor.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if included.From != anchor.Signer {
+		return nil, fmt.Errorf("transaction %s was sent by %s, not by the anchor key", anchor.TxHash.Hex(), included.From.Hex())
+	}
+	if digest := anchor.Digest(); !bytes.Equal(included.Transaction.Data(), digest.Bytes()) {
+		return nil, fmt.Errorf("transaction %s does not carry the anchor digest %s", anchor.TxHash.Hex(), digest.Hex())
+	}
+	return block, nil
+}
+
+func init() {
+	// Add flags
+	auditAnchorCmd.Flags().StringVar(&anchorFile, "anchors", audit.DefaultAnchorFile, "File the anchors are appended to")
+	auditAnchorCmd.Flags().StringVar(&anchorChain, "chain", "", "Also anchor the digest on this chain")
+	auditAnchorCmd.Flags().DurationVar(&anchorEvery, "every", 0, "Anchor again at this interval until interrupted")
+	auditAnchorCmd.Flags().StringVar(&gasPreset, "gas-preset", "", "Gas oracle preset of the anchor transaction (slow, standard, fast)")
+	addGasOracleFlags(auditAnchorCmd)
+	auditAnchorCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	auditAnchorCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	auditAnchorCmd.Flags().StringVar(&password, "password", "", "Key password")
+	auditAnchorCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	auditAnchorCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	auditAnchorCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	auditAnchorCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	auditAnchorCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	auditAnchorCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	auditAnchorCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	auditAnchorCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	auditAnchorCmd.Flags().BoolVar(&override, "override", false, "Sign even if the anchor transaction violates the policy")
+	addSimulationCacheFlags(auditAnchorCmd.Flags())
+	auditAnchorCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addKeystoreBackendFlags(auditAnchorCmd)
+	addSignerFlags(auditAnchorCmd)
+	auditVerifyCmd.Flags().StringVar(&anchorFile, "anchors", audit.DefaultAnchorFile, "Anchors to check the trail against")
+	auditVerifyCmd.Flags().StringVar(&anchorSigner, "anchor-signer", "", "Expected address of the anchor key")
+	auditVerifyCmd.Flags().BoolVar(&anchorCheckChain, "check-chain", false, "Also check the on-chain transactions of anchors")
+
+	// Add commands
+	AuditCmd.AddCommand(auditAnchorCmd)
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/server"
+	"github.com/spf13/cobra"
+)
+
+var serveApproveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Sign an approval token for a request held by a signing daemon",
+	Long: `Review a request exported by a signing daemon whose policy requires approvals
+(GET /v1/approvals/<id>) and approve it with your own vault key, on any machine. The payload
+hash and request ID are recomputed from the export before anything is shown, so the token
+only approves what you reviewed. Submit the token with POST /v1/approvals; the daemon
+releases the signature once enough approvers of its policy approved the request.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read request: %v", err)
+		}
+		var request server.ApprovalRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			return fmt.Errorf("failed to parse request: %v", err)
+		}
+		if err := request.Verify(); err != nil {
+			return fmt.Errorf("refusing to approve request: %v", err)
+		}
+
+		if err := printApprovalRequest(&request); err != nil {
+			return err
+		}
+		expiry := time.Unix(request.Expiry, 0)
+		if !time.Now().Before(expiry) {
+			return fmt.Errorf("request expired at %s", expiry.Format(time.RFC3339))
+		}
+
+		if err := checkSelectedSigner(cmd, core.CapMessages); err != nil {
+			return err
+		}
+		ok, err := confirm("Approve this request?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("approval aborted by user")
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		signature, err := signer.SignMessage(server.ApprovalMessage(request.ID))
+		if err != nil {
+			return err
+		}
+		token := &server.ApprovalToken{Request: request.ID, Approver: signer.Address(), Signature: signature}
+
+		result, err := json.MarshalIndent(token, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal approval token: %v", err)
+		}
+		if err := os.WriteFile(outputFile, result, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		if err := recordAudit(&audit.Record{
+			Operation:   audit.OpApproveRequest,
+			Outcome:     audit.OutcomeSigned,
+			Key:         signerName(),
+			Signer:      token.Approver.Hex(),
+			PayloadHash: request.PayloadHash,
+			Detail:      fmt.Sprintf("request %s (%s by %s)", request.ID.Hex(), request.Operation, request.Signer.Hex()),
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Request approved by %s; token saved to: %s\n", nickname(token.Approver), outputFile)
+		return nil
+	},
+}
+
+// printApprovalRequest shows what an approval releases
+func printApprovalRequest(request *server.ApprovalRequest) error {
+	fmt.Printf("Request:    %s\n", request.ID.Hex())
+	fmt.Printf("Operation:  %s\n", request.Operation)
+	fmt.Printf("Signer:     %s (key %s)\n", nickname(request.Signer), request.Key)
+	fmt.Printf("Expires:    %s\n", time.Unix(request.Expiry, 0).Format(time.RFC3339))
+	fmt.Printf("Approvals:  %d of %d\n", len(request.Approvals), request.Threshold)
+	for _, approver := range request.Approvals {
+		fmt.Printf("  %s\n", nickname(approver))
+	}
+
+	switch request.Operation {
+	case audit.OpSignTransaction:
+		transaction, err := request.UnsignedTransaction()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Chain ID:   %s\n", request.ChainID)
+		if transaction.To() == nil {
+			fmt.Println("To:         contract creation")
+		} else {
+			fmt.Printf("To:         %s\n", nickname(*transaction.To()))
+		}
+		fmt.Printf("Value:      %s\n", formatApprovalValue(request, transaction.Value()))
+		fmt.Printf("Nonce:      %d\n", transaction.Nonce())
+		fmt.Printf("Gas limit:  %d\n", transaction.Gas())
+		if len(transaction.Data()) > 0 && transaction.To() != nil {
+			decoder, err := newCallDecoder()
+			if err != nil {
+				return err
+			}
+			call, err := decoder.Decode(transaction.Data())
+			if err != nil {
+				fmt.Printf("Data:       0x%x\n", transaction.Data())
+				break
+			}
+			fmt.Printf("Function:   %s\n", call.Signature)
+			printDecodedArgs("  ", call.Args)
+		} else if len(transaction.Data()) > 0 {
+			fmt.Printf("Data:       %d bytes of contract code\n", len(transaction.Data()))
+		}
+	case audit.OpSignMessage:
+		if utf8.Valid(request.Message) {
+			fmt.Printf("Message:    %q\n", string(request.Message))
+		} else {
+			fmt.Printf("Message:    %s\n", request.Message)
+		}
+	case audit.OpSignTypedData:
+		typedData, err := request.ParsedTypedData()
+		if err != nil {
+			return err
+		}
+		summary, err := typedData.Summary()
+		if err != nil {
+			return err
+		}
+		fmt.Print(summary)
+	}
+	return nil
+}
+
+// formatApprovalValue formats a value in the native currency of the request's
+// chain, or in wei if the chain is not configured here
+func formatApprovalValue(request *server.ApprovalRequest, value *big.Int) string {
+	if chain := chainOfRequest(request); chain != nil {
+		return formatNative(chain, value)
+	}
+	return value.String() + " wei"
+}
+
+// chainOfRequest returns the configured chain of a request's chain ID, or nil
+func chainOfRequest(request *server.ApprovalRequest) *core.ChainConfig {
+	if request.ChainID == nil {
+		return nil
+	}
+	chains, err := core.Chains()
+	if err != nil {
+		return nil
+	}
+	for _, chain := range chains {
+		if chain.ChainID.Cmp(request.ChainID) == 0 {
+			return chain
+		}
+	}
+	return nil
+}
+
+func init() {
+	// Add flags
+	serveApproveCmd.Flags().StringVar(&inputFile, "input", "", "Request exported by the signing daemon")
+	serveApproveCmd.Flags().StringVar(&outputFile, "output", "", "Output approval token file")
+	serveApproveCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	serveApproveCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	serveApproveCmd.Flags().StringVar(&password, "password", "", "Key password")
+	serveApproveCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	serveApproveCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	serveApproveCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	serveApproveCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	serveApproveCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	addKeystoreBackendFlags(serveApproveCmd)
+	addSignerFlags(serveApproveCmd)
+	addAuditFlags(serveApproveCmd)
+
+	// Mark required flags
+	serveApproveCmd.MarkFlagRequired("input")
+	serveApproveCmd.MarkFlagRequired("output")
+
+	// Add commands
+	ServeCmd.AddCommand(serveApproveCmd)
+}
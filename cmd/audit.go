@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFile      string
+	auditKeyFile   string
+	auditOperator  string
+	auditSigner    string
+	auditFormat    string
+	auditSince     string
+	auditOperation string
+)
+
+// AuditCmd is the root command for the audit trail
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Verify and export the audit trail",
+	Long: `Every signing and broadcast operation appends a record to the audit trail: the key used,
+the hash of the signed payload, the chain, the time, the policy decisions and the operator.
+Each record includes the hash of the previous one and is signed by a dedicated audit key, so
+removed, reordered or edited records are detected by 'audit verify'. 'audit anchor'
+counter-signs the trail with a separate key, so even a rewrite re-signed with the audit key
+is detected.`,
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the hash chain and signatures of the audit trail",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := audit.Read(auditFile)
+		if err != nil {
+			return err
+		}
+		signer, err := audit.Verify(records)
+		if err != nil {
+			return fmt.Errorf("audit trail %s is not intact: %v", auditFile, err)
+		}
+
+		// Pin the audit key so a rewritten trail with a new key is caught
+		expected := auditSigner
+		if expected == "" {
+			if address, err := audit.KeyAddress(auditKeyFile); err == nil {
+				expected = address.Hex()
+			}
+		}
+		if expected != "" {
+			if !common.IsHexAddress(expected) {
+				return fmt.Errorf("invalid --signer address: %s", expected)
+			}
+			if common.HexToAddress(expected) != signer {
+				return fmt.Errorf("audit trail is signed by %s, not by %s", signer.Hex(), expected)
+			}
+		}
+
+		last := records[len(records)-1]
+		fmt.Printf("Audit trail intact: %d records signed by %s\n", len(records), signer.Hex())
+		fmt.Printf("Latest record:      %d at %s, hash %s\n", last.Seq, last.Time.Format("2006-01-02 15:04:05"), last.Hash.Hex())
+		if expected == "" {
+			fmt.Println("Warning: no audit key to compare with; pass --signer to pin the expected audit key")
+		}
+		return verifyAuditAnchors(records)
+	},
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the audit trail as JSON or CSV",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := audit.Read(auditFile)
+		if err != nil {
+			return err
+		}
+
+		filter := audit.Filter{Operation: auditOperation}
+		if auditSince != "" {
+			if age, err := time.ParseDuration(auditSince); err == nil {
+				filter.Since = time.Now().Add(-age)
+			} else if filter.Since, err = time.Parse(time.RFC3339, auditSince); err != nil {
+				return fmt.Errorf("invalid --since: %v", err)
+			}
+		}
+		records = audit.Select(records, filter)
+
+		var w io.Writer = os.Stdout
+		if outputFile != "" {
+			f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %v", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := audit.Export(w, records, auditFormat); err != nil {
+			return err
+		}
+
+		if outputFile != "" {
+			fmt.Printf("Exported %d records to: %s\n", len(records), outputFile)
+		}
+		return nil
+	},
+}
+
+// addAuditFlags adds the audit trail flags to a command and its subcommands
+func addAuditFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&auditFile, "audit-log", audit.DefaultLogFile, "Audit trail of signing and broadcast operations")
+	cmd.PersistentFlags().StringVar(&auditKeyFile, "audit-key", audit.DefaultKeyFile, "Key that signs audit records")
+	cmd.PersistentFlags().StringVar(&auditOperator, "operator", "", "Operator recorded in the audit trail (default $"+audit.EnvOperator+" or user@host)")
+}
+
+// recordAudit appends a record to the audit trail
+func recordAudit(record *audit.Record) error {
+	trail, err := audit.Open(firstNonEmpty(auditFile, audit.DefaultLogFile), firstNonEmpty(auditKeyFile, audit.DefaultKeyFile))
+	if err != nil {
+		return err
+	}
+	record.Operator = auditOperator
+	if record.Confirmation == "" {
+		record.Confirmation = confirmation
+	}
+	if err := trail.Append(record); err != nil {
+		return fmt.Errorf("failed to write audit record: %v", err)
+	}
+	return nil
+}
+
+// auditTransaction records a signing decision on a transaction
+func auditTransaction(outcome, chain, key string, from common.Address, transaction *core.Transaction, txHash *common.Hash, decisions []string) error {
+	return recordAudit(&audit.Record{
+		Operation:   audit.OpSignTransaction,
+		Outcome:     outcome,
+		Key:         key,
+		Signer:      from.Hex(),
+		Chain:       chain,
+		ChainID:     transaction.ChainID.String(),
+		PayloadHash: signingHash(transaction),
+		TxHash:      txHash,
+		Policy:      decisions,
+	})
+}
+
+// auditRefusal records a transaction the policy refused to sign, except in a
+// dry run. The refusal itself is returned, since it matters more than a
+// failure to record it.
+func auditRefusal(chain, key string, from common.Address, transaction *core.Transaction, decisions []string, refusal error) error {
+	if output.DryRun() {
+		return refusal
+	}
+	if err := auditTransaction(audit.OutcomeRefused, chain, key, from, transaction, nil, decisions); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return refusal
+}
+
+// auditBroadcast records the submission of a signed payload; hash is the
+// transaction that was submitted or included
+func auditBroadcast(outcome string, payload *tx.SignedPayload, hash common.Hash, detail string) error {
+	record := &audit.Record{
+		Operation:   audit.OpBroadcast,
+		Outcome:     outcome,
+		Chain:       firstNonEmpty(payload.Chain, chainName),
+		PayloadHash: payload.Hash,
+		Detail:      detail,
+	}
+	if payload.ChainID != nil {
+		record.ChainID = payload.ChainID.String()
+	}
+	if hash != (common.Hash{}) {
+		record.TxHash = &hash
+	}
+	return recordAudit(record)
+}
+
+// signingHash returns the hash a transaction's signature commits to
+func signingHash(transaction *core.Transaction) common.Hash {
+	return types.LatestSignerForChainID(transaction.ChainID).Hash(transaction.ToEthereumTx())
+}
+
+// signerName names the key or hardware wallet used for signing
+func signerName() string {
+	if useHW {
+		if signerSpec != "" {
+			return signerSpec
+		}
+		return fmt.Sprintf("hardware #%d", hwDevice)
+	}
+	return keyName
+}
+
+func init() {
+	// Add flags
+	addAuditFlags(AuditCmd)
+	auditVerifyCmd.Flags().StringVar(&auditSigner, "signer", "", "Expected address of the audit key (defaults to the local audit key)")
+	auditExportCmd.Flags().StringVar(&auditFormat, "format", "json", "Export format (json, csv)")
+	auditExportCmd.Flags().StringVar(&outputFile, "output", "", "Output file (prints to stdout if empty)")
+	auditExportCmd.Flags().StringVar(&auditSince, "since", "", "Only export records since this RFC 3339 time or duration ago (e.g. 720h)")
+	auditExportCmd.Flags().StringVar(&auditOperation, "operation", "", "Only export records of this operation (e.g. sign-transaction, broadcast)")
+
+	// Add commands
+	AuditCmd.AddCommand(auditVerifyCmd)
+	AuditCmd.AddCommand(auditExportCmd)
+}
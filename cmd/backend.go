@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keystoreBackend string
+	vaultAddr       string
+	vaultToken      string
+	vaultMount      string
+	vaultPath       string
+	awsRegion       string
+	gcpKeyRing      string
+	gcpToken        string
+	signerSpec      string
+)
+
+// addKeystoreBackendFlags adds the flags selecting and configuring a keystore backend
+func addKeystoreBackendFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&keystoreBackend, "keystore-backend", "file", "Keystore backend: file, vault, awskms or gcpkms")
+	cmd.PersistentFlags().StringVar(&vaultAddr, "vault-addr", "", "Vault server address (defaults to $VAULT_ADDR)")
+	cmd.PersistentFlags().StringVar(&vaultToken, "vault-token", "", "Vault token or secret reference (defaults to $VAULT_TOKEN)")
+	cmd.PersistentFlags().StringVar(&vaultMount, "vault-mount", keystore.DefaultVaultMount, "Vault KV version 2 secrets engine mount")
+	cmd.PersistentFlags().StringVar(&vaultPath, "vault-path", keystore.DefaultVaultPath, "Path of keys within the Vault mount")
+	cmd.PersistentFlags().StringVar(&awsRegion, "aws-region", "", "AWS KMS region (defaults to $AWS_REGION)")
+	cmd.PersistentFlags().StringVar(&gcpKeyRing, "gcp-key-ring", "", "Cloud KMS key ring (projects/P/locations/L/keyRings/R)")
+	cmd.PersistentFlags().StringVar(&gcpToken, "gcp-token", "", "Google Cloud access token or secret reference (defaults to $GOOGLE_OAUTH_ACCESS_TOKEN)")
+}
+
+// openKeyStore opens the backend selected by --keystore-backend
+func openKeyStore() (keystore.KeyStore, error) {
+	switch keystoreBackend {
+	case "file":
+		manager, err := keystore.NewManager(keystoreDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create keystore manager: %v", err)
+		}
+		return manager, nil
+	case "vault":
+		addr := firstNonEmpty(vaultAddr, os.Getenv("VAULT_ADDR"))
+		client, err := tx.HTTPClient(addr)
+		if err != nil {
+			return nil, err
+		}
+		token, err := secrets.Resolve(firstNonEmpty(vaultToken, os.Getenv("VAULT_TOKEN")))
+		if err != nil {
+			return nil, err
+		}
+		return keystore.NewVaultKeyStore(addr, token, vaultMount, vaultPath, client)
+	case "awskms":
+		region := firstNonEmpty(awsRegion, os.Getenv("AWS_REGION"))
+		client, err := tx.HTTPClient("https://" + keystore.AWSKMSHost(region))
+		if err != nil {
+			return nil, err
+		}
+		return keystore.NewAWSKMSKeyStore(region, client)
+	case "gcpkms":
+		client, err := tx.HTTPClient(keystore.GCPKMSAPI)
+		if err != nil {
+			return nil, err
+		}
+		token, err := secrets.Resolve(gcpToken)
+		if err != nil {
+			return nil, err
+		}
+		return keystore.NewGCPKMSKeyStore(gcpKeyRing, token, client)
+	default:
+		return nil, fmt.Errorf("unknown keystore backend %q (expected file, vault, awskms or gcpkms)", keystoreBackend)
+	}
+}
+
+// openSigner returns a signer for the key selected by --name. Keys of the
+// file backend are decrypted with --password; remote backends sign with their
+// own credentials.
+func openSigner() (keystore.Signer, error) {
+	if keyName == "" {
+		return nil, errors.New("--name is required")
+	}
+	return openNamedSigner(keyName)
+}
+
+// openNamedSigner returns the signer of a named key of --backend. Keys in the
+// file keystore are decrypted with --password, or signed for by the agent
+// without one, if their lifecycle state lets them sign.
+func openNamedSigner(name string) (keystore.Signer, error) {
+	if keystoreBackend == "file" {
+		if err := checkKeyState(name); err != nil {
+			return nil, err
+		}
+		if password == "" {
+			signer, err := agentSigner(name)
+			if err != nil {
+				return nil, fmt.Errorf("--password is required unless the key is unlocked in the agent (%v)", err)
+			}
+			return signer, nil
+		}
+		privateKey, err := loadKey(name, password)
+		if err != nil {
+			return nil, err
+		}
+		return keystore.NewKeySigner(privateKey)
+	}
+
+	store, err := openKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.(keystore.RemoteKeyStore).Signer(name)
+}
+
+// addSignerFlags adds --signer, which selects the signing key of any backend
+func addSignerFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&signerSpec, "signer", "", "Signing key as software:NAME, ledger:PATH, trezor:PATH, kms:KEYID, gcpkms:KEY or vault:NAME (replaces --name, --hardware and --keystore-backend)")
+	addProfileFlags(cmd)
+}
+
+// applySignerSpec translates --signer into the key, backend and hardware
+// wallet flags it replaces, and with --all-profiles routes a file key to the
+// profile holding it
+func applySignerSpec(cmd *cobra.Command) error {
+	if signerSpec == "" {
+		return routeKeyToProfile()
+	}
+	for _, flag := range []string{"name", "hardware", "keystore-backend"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--signer and --%s are mutually exclusive", flag)
+		}
+	}
+
+	kind, value, _ := strings.Cut(signerSpec, ":")
+	switch kind {
+	case "ledger", "trezor":
+		// The path is optional; --account-index selects an account on the default path
+		useHW, hwKind, hwPath = true, kind, value
+		return nil
+	case "software":
+		keystoreBackend = "file"
+	case "kms", "awskms":
+		keystoreBackend = "awskms"
+	case "gcpkms", "vault":
+		keystoreBackend = kind
+	default:
+		return fmt.Errorf("unknown signer %q (expected software:NAME, ledger:PATH, trezor:PATH, kms:KEYID, gcpkms:KEY or vault:NAME)", signerSpec)
+	}
+	if value == "" {
+		return fmt.Errorf("--signer %s: needs a key name", kind)
+	}
+	keyName = value
+	return routeKeyToProfile()
+}
+
+// openSelectedSigner opens the key selected by --signer, or else by --name,
+// --keystore-backend and --hardware. The returned function releases it.
+func openSelectedSigner(cmd *cobra.Command) (core.Signer, func(), error) {
+	if err := applySignerSpec(cmd); err != nil {
+		return nil, nil, err
+	}
+
+	if useHW {
+		hw, err := openHardwareWallet(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := hw.Signer()
+		if err != nil {
+			hw.Close()
+			return nil, nil, err
+		}
+		return signer, func() { hw.Close() }, nil
+	}
+
+	signer, err := openSigner()
+	if err != nil {
+		return nil, nil, err
+	}
+	return core.NewSigner(signer), func() {}, nil
+}
+
+// checkSelectedSigner refuses a kind of signature the selected signer cannot
+// make, before anything is shown for confirmation or a key is unlocked. Only
+// hardware wallets lack capabilities; their kind is looked up without opening
+// the device.
+func checkSelectedSigner(cmd *cobra.Command, capability core.Capability) error {
+	if err := applySignerSpec(cmd); err != nil {
+		return err
+	}
+	if !useHW {
+		return nil
+	}
+
+	kind := hwKind
+	if kind == "" {
+		wallets, err := core.ListHardwareWallets()
+		if err != nil || hwDevice < 0 || hwDevice >= len(wallets) {
+			// Opening the device reports the problem
+			return nil
+		}
+		kind = wallets[hwDevice].URL().Scheme
+	}
+	if !core.DeviceSupports(kind, capability) {
+		return fmt.Errorf("%w: a %s device cannot sign %s", core.ErrUnsupported, kind, capability)
+	}
+	return nil
+}
+
+// formatCapabilities lists kinds of signature for display
+func formatCapabilities(capabilities []core.Capability) string {
+	if len(capabilities) == 0 {
+		return "nothing"
+	}
+	names := make([]string, len(capabilities))
+	for i, capability := range capabilities {
+		names[i] = string(capability)
+	}
+	return strings.Join(names, ", ")
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
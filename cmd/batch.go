@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fetchNonces bool
+	hwDevices   []int
+)
+
+var signBatchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Sign a batch of transactions",
+	Long: `Sign a JSON array of transactions. Each entry may select its own "key" and "chain"
+(defaulting to the key of --name or --signer and to --chain). Senders get sequential nonces per chain, starting at
+the entry's "nonce" or, with --fetch-nonces, at the account's pending nonce. Failed
+entries are reported without aborting the batch and do not use up a nonce.
+
+With --hardware the batch is fanned out to several hardware wallets (--devices, or every
+connected one), which sign in parallel, each asking for the confirmation of its own entries.
+Entries name their sender address as "key" (defaulting to the account of the first device) and
+go to the devices holding it. The output records which device signed each entry. If a device
+fails to sign an entry, the later nonces of that sender are discarded, so no gap is left.`,
+	Example: `  # Sign payouts with sequential nonces from the chain
+  gosignervaultcli sign batch --input payouts.json --name payroll --fetch-nonces --output signed.json
+
+  # Fan the batch out to three hardware wallets signing in parallel
+  gosignervaultcli sign batch --input payouts.json --hardware --devices 0,1,2 --output signed.json
+
+  # Write a sample payouts.json and the broadcast loop with 'examples init batch'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Read batch file
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		entries, err := core.ParseBatch(data)
+		if err != nil {
+			return err
+		}
+		if fetchNonces && offlineMode {
+			return fmt.Errorf("--fetch-nonces needs network access; set nonces in the batch file instead")
+		}
+
+		// --signer picks the default key; entries name keys of the same backend
+		if err := applySignerSpec(cmd); err != nil {
+			return err
+		}
+		if len(hwDevices) > 0 && !useHW {
+			return fmt.Errorf("--devices needs --hardware")
+		}
+		defaultKey := keyName
+		var devices []core.BatchDevice
+		if useHW {
+			var release func()
+			devices, release, err = openBatchDevices(cmd)
+			if err != nil {
+				return err
+			}
+			defer release()
+			defaultKey = devices[0].Signer.Address().Hex()
+		}
+
+		// Load signing policy and history
+		signingPolicy, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+
+		// Show what is being signed and ask for confirmation
+		book, err := loadAddressBook()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Batch of %d transactions\n", len(entries))
+		for i, entry := range entries {
+			to := "(contract creation)"
+			if entry.To != nil {
+				to = labeled(book, *entry.To)
+			}
+			fmt.Printf("  %3d  %-12s %-10s to %s, value %s\n", i, firstNonEmpty(entry.Key, defaultKey),
+				firstNonEmpty(entry.Chain, chainName), to, formatWei(entry.Value))
+			if entry.To != nil {
+				warnUnknownAddress(book, *entry.To, "destination")
+			}
+		}
+		ok, err := confirm(fmt.Sprintf("Sign these %d transactions?", len(entries)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		// Sign as a job, so an interrupted or failed batch stays visible and can be retried
+		job := newJob(cmd, args, "sign-batch", fmt.Sprintf("Sign %d transactions of %s", len(entries), inputFile))
+		return runJob(cmd.Context(), job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+			// Sign entries in order, or on the devices in parallel
+			signer := core.NewBatchSigner(func(name string) (core.Signer, error) {
+				if useHW {
+					return deviceSigner(devices, name)
+				}
+				key, err := openNamedSigner(name)
+				if err != nil {
+					return nil, err
+				}
+				return core.NewSigner(key), nil
+			})
+			if fetchNonces {
+				signer.NonceAt = pendingNonce
+			}
+			decisions := make(map[*core.BatchEntry][]string)
+			signed := 0
+			signer.Check = func(entry *core.BatchEntry, transaction *core.Transaction, key core.Signer) error {
+				// A cancelled job fails the entries it has not signed yet
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := checkDuplicate(cmd, signingPolicy, history, transaction); err != nil {
+					return err
+				}
+				entryChain, entryKey := firstNonEmpty(entry.Chain, chainName), firstNonEmpty(entry.Key, defaultKey)
+				chain, err := core.GetChainConfig(entryChain)
+				if err != nil {
+					return err
+				}
+				if err := checkChainCapabilities(chain, transaction.ToEthereumTx()); err != nil {
+					return err
+				}
+				decisions[entry], err = enforcePolicy(signingPolicy, history, transaction, key, entryKey)
+				if err != nil {
+					return auditRefusal(entryChain, entryKey, key.Address(), transaction, decisions[entry], err)
+				}
+				// Devices sign after all checks, so later checks count this entry
+				if useHW {
+					history.Hold(signedRecord(transaction, key.Address(), ""))
+				}
+				return nil
+			}
+			signer.Signed = func(entry *core.BatchEntry, transaction *core.Transaction, from common.Address, rawTx string) error {
+				if err := history.RecordSigned(signedRecord(transaction, from, rawTx)); err != nil {
+					return fmt.Errorf("failed to record transaction in history: %v", err)
+				}
+				hash := core.TransactionHash(rawTx)
+				signed++
+				progress(signed, len(entries), "signed "+hash.Hex())
+				return auditTransaction(audit.OutcomeSigned, firstNonEmpty(entry.Chain, chainName),
+					firstNonEmpty(entry.Key, defaultKey), from, transaction, &hash, decisions[entry])
+			}
+			var results []core.BatchSignResult
+			if useHW {
+				results = signer.SignBatchOnDevices(entries, defaultKey, chainName, devices)
+			} else {
+				results = signer.SignBatch(entries, keyName, chainName)
+			}
+
+			// Write the combined output, failed entries included
+			output, err := core.BatchSignResultToJSON(results)
+			if err != nil {
+				return "", err
+			}
+			if err := ioutil.WriteFile(outputFile, []byte(output), 0644); err != nil {
+				return "", fmt.Errorf("failed to write output file: %v", err)
+			}
+
+			// Report per-entry results
+			failed := 0
+			for _, result := range results {
+				if result.Error != "" {
+					failed++
+					fmt.Printf("  %3d  failed: %s\n", result.Index, result.Error)
+					continue
+				}
+				fmt.Printf("  %3d  %s nonce %d: %s\n", result.Index, result.From, *result.Nonce, result.Hash.Hex())
+				if result.Device != "" {
+					fmt.Printf("       signed on %s\n", result.Device)
+				}
+				if result.Contract != "" {
+					fmt.Printf("       deploys %s\n", result.Contract)
+				}
+			}
+			fmt.Printf("Signed %d of %d transactions, saved to: %s\n", len(results)-failed, len(results), outputFile)
+
+			if failed > 0 {
+				return "", fmt.Errorf("%d of %d transactions failed", failed, len(results))
+			}
+			return fmt.Sprintf("signed %d of %d transactions to %s", len(results)-failed, len(results), outputFile), nil
+		})
+	},
+}
+
+// openBatchDevices opens the hardware wallets of --devices, or else of --device
+// or every connected one, at the account of --derivation-path or --account-index.
+// The returned function closes them.
+func openBatchDevices(cmd *cobra.Command) ([]core.BatchDevice, func(), error) {
+	indexes := hwDevices
+	if len(indexes) == 0 && cmd.Flags().Changed("device") {
+		indexes = []int{hwDevice}
+	}
+	if len(indexes) == 0 {
+		wallets, err := core.ListHardwareWallets()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, wallet := range wallets {
+			if hwKind == "" || wallet.URL().Scheme == hwKind {
+				indexes = append(indexes, len(indexes))
+			}
+		}
+		if len(indexes) == 0 {
+			return nil, nil, fmt.Errorf("no hardware wallet found")
+		}
+	}
+
+	var wallets []*core.HardwareWallet
+	release := func() {
+		for _, hw := range wallets {
+			hw.Close()
+		}
+	}
+	var devices []core.BatchDevice
+	for _, index := range indexes {
+		hwDevice = index
+		hw, err := openHardwareWallet(cmd)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		wallets = append(wallets, hw)
+		signer, err := hw.Signer()
+		if err != nil {
+			release()
+			return nil, nil, fmt.Errorf("device %d: %v", index, err)
+		}
+		fmt.Printf("  device %d holds %s\n", index, signer.Address().Hex())
+		devices = append(devices, core.BatchDevice{Name: hw.URL(), Signer: signer})
+	}
+	return devices, release, nil
+}
+
+// deviceSigner returns the signer of the first device holding the address a
+// batch entry names as its key
+func deviceSigner(devices []core.BatchDevice, key string) (core.Signer, error) {
+	if !common.IsHexAddress(key) {
+		return nil, fmt.Errorf("entries signed on hardware wallets name their sender address as key, not %q", key)
+	}
+	for _, device := range devices {
+		if device.Signer.Address() == common.HexToAddress(key) {
+			return device.Signer, nil
+		}
+	}
+	return nil, fmt.Errorf("no device holds %s on the selected derivation path", key)
+}
+
+// pendingNonce returns the pending nonce of an account from the chain's RPC
+func pendingNonce(chain *core.ChainConfig, from common.Address) (uint64, error) {
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		return 0, err
+	}
+	defer simulator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	nonce, err := simulator.PendingNonce(ctx, from)
+	if err != nil {
+		return 0, err
+	}
+	explain("nonce", "batch nonces of %s on %s start at its pending nonce %d (eth_getTransactionCount at %s)",
+		from.Hex(), chain.Name, nonce, endpointName(chain.RPCURL))
+	return nonce, nil
+}
+
+func init() {
+	// Add flags
+	signBatchCmd.Flags().StringVar(&inputFile, "input", "", "Batch file with a JSON array of transactions")
+	signBatchCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain of entries that name none")
+	signBatchCmd.Flags().IntSliceVar(&hwDevices, "devices", nil, "Hardware wallets signing in parallel, as indexes shown by 'hardware list' (default: every connected one)")
+	signBatchCmd.Flags().BoolVar(&fetchNonces, "fetch-nonces", false, "Start each sender's nonces at its pending nonce from the chain")
+	signBatchCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	signBatchCmd.Flags().StringVar(&historyPassword, "history-password", "", "Encrypt the history with this password (append-only)")
+	signBatchCmd.Flags().StringVar(&duplicateMode, "duplicate-policy", tx.DefaultDuplicatePolicy().Mode, "Handling of recently signed identical transactions (warn, block, off)")
+	signBatchCmd.Flags().DurationVar(&duplicateWindow, "duplicate-window", tx.DefaultDuplicatePolicy().Window, "Window in which identical transactions count as duplicates")
+	signBatchCmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Sign even if the duplicate policy would block")
+	signBatchCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	signBatchCmd.Flags().BoolVar(&override, "override", false, "Sign even if a transaction violates the policy")
+	addSimulationCacheFlags(signBatchCmd.Flags())
+
+	// Mark required flags
+	signBatchCmd.MarkFlagRequired("input")
+
+	// Add commands
+	SignCmd.AddCommand(signBatchCmd)
+}
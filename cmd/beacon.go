@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/server"
+	"github.com/aryehky/gosignervaultcli/tx"
+)
+
+var (
+	beaconURL      string
+	beaconToken    string
+	beaconInstance string
+	beaconInterval time.Duration
+)
+
+// newBeacon sets up the health beacon of the daemon from the --beacon flags
+func newBeacon(srv *server.Server, schedule *tx.Schedule) (*server.Beacon, error) {
+	url, err := secrets.Expand(beaconURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --beacon: %v", err)
+	}
+	token, err := secrets.Expand(beaconToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --beacon-token: %v", err)
+	}
+	instance := beaconInstance
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to read hostname (pass --beacon-instance): %v", err)
+		}
+	}
+
+	// The policy was loaded at start; a changed file is not in effect yet
+	started := time.Now().UTC()
+	loadedPolicy := fileHash(policyFile)
+	return &server.Beacon{
+		URL:      url,
+		Token:    token,
+		Interval: beaconInterval,
+		Report: func() *server.HealthReport {
+			report := &server.HealthReport{
+				Instance:   instance,
+				Version:    buildVersion(),
+				GoVersion:  runtime.Version(),
+				Started:    started,
+				Time:       time.Now().UTC(),
+				PolicyHash: loadedPolicy,
+			}
+			report.Keys, report.KeyInventory = srv.Inventory()
+			report.Problems = srv.KeyProblems()
+
+			if current := fileHash(policyFile); current != loadedPolicy {
+				report.Problems = append(report.Problems, "policy file changed since start; restart the daemon to apply it")
+			}
+			state, err := policy.LoadBundleState(policy.DefaultBundleStateFile)
+			if err != nil {
+				report.Problems = append(report.Problems, err.Error())
+			} else if state != nil {
+				report.BundleOrganization, report.BundleVersion = state.Organization, state.Version
+			}
+			if entries, err := schedule.Entries(); err != nil {
+				report.Problems = append(report.Problems, err.Error())
+			} else {
+				held := 0
+				for _, entry := range entries {
+					if entry.Status == tx.ScheduleWaiting && entry.Retry != nil {
+						held++
+					}
+				}
+				if held > 0 {
+					report.Problems = append(report.Problems, fmt.Sprintf("%d broadcast(s) held for unreachable endpoints", held))
+				}
+			}
+
+			report.Status = server.HealthOK
+			if len(report.Problems) > 0 {
+				report.Status = server.HealthDegraded
+			}
+			return report
+		},
+	}, nil
+}
+
+// fileHash returns the SHA-256 of a file, "none" if it does not exist or
+// "unreadable" if it cannot be read
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "none"
+	}
+	if err != nil {
+		return "unreadable"
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// buildVersion returns the module version of the executable, or its VCS
+// revision if the build has no version
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	version := "(devel)"
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision":
+			version += " " + setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true":
+			version += " (modified)"
+		}
+	}
+	return version
+}
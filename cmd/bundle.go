@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleOrg          string
+	bundleVersion      uint64
+	bundleChainsFile   string
+	bundleDenylistFile string
+	bundleContactsFile string
+	bundleAdmins       []string
+	bundleStateFile    string
+)
+
+// PolicyCmd is the root command for the signing policy
+var PolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage the signing policy",
+}
+
+var policyBundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Distribute a signed organization policy to many vaults",
+	Long: `A policy bundle packages the signing policy, chain configurations, a denylist and an
+allowlist of contacts of an organization. An administrator signs it with 'policy bundle create'
+and distributes the file to every operator machine, where 'policy bundle apply' installs it
+once it has checked the administrator's signature and that the bundle is newer than the
+installed one.`,
+}
+
+var policyBundleCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Package and sign a policy bundle",
+	Long: `Package the signing policy (--policy), chains (--chains, in the format of chains.json), a
+denylist (--denylist, one address per line, # comments) and contacts (--contacts, a JSON array
+of {"label", "address", "note"}) into a bundle and sign it with an administrator key. The
+signature is an EIP-191 message naming the organization, version and SHA-256 of the bundle,
+so a hardware wallet shows what it signs.
+
+Versions must increase: vaults refuse a bundle whose version is not above the installed one.
+--admin hands trust to a new set of administrators for the bundles after this one.`,
+	Example: `  gosignervaultcli policy bundle create --org acme --version 7 --denylist denied.txt \
+    --contacts contacts.json --hardware --output acme-7.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		admins, err := parseAdmins()
+		if err != nil {
+			return err
+		}
+		if err := checkSelectedSigner(cmd, core.CapMessages); err != nil {
+			return err
+		}
+
+		signingPolicy, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		bundle := &policy.Bundle{
+			Organization: bundleOrg,
+			Version:      bundleVersion,
+			Created:      time.Now().UTC(),
+			Policy:       signingPolicy,
+			Admins:       admins,
+		}
+		if bundleChainsFile != "" {
+			if bundle.Chains, err = core.LoadChainConfig(bundleChainsFile); err != nil {
+				return err
+			}
+		}
+		if bundleDenylistFile != "" {
+			if bundle.Denylist, err = policy.ReadAddressList(bundleDenylistFile); err != nil {
+				return err
+			}
+		}
+		if bundleContactsFile != "" {
+			data, err := ioutil.ReadFile(bundleContactsFile)
+			if err != nil {
+				return fmt.Errorf("failed to read contacts: %v", err)
+			}
+			if err := json.Unmarshal(data, &bundle.Contacts); err != nil {
+				return fmt.Errorf("failed to parse contacts: %v", err)
+			}
+		}
+		encoded, err := policy.EncodeBundle(bundle)
+		if err != nil {
+			return err
+		}
+
+		printBundle(bundle)
+		ok, err := confirm("Sign this bundle?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		message := policy.BundleMessage(bundle.Organization, bundle.Version, encoded)
+		signature, err := signer.SignMessage(message)
+		if err != nil {
+			return err
+		}
+		signed := &policy.SignedBundle{Bundle: encoded, Signer: signer.Address(), Signature: signature}
+		data, err := json.MarshalIndent(signed, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal bundle: %v", err)
+		}
+		if err := ioutil.WriteFile(outputFile, data, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+		if err := recordAudit(&audit.Record{
+			Operation:   audit.OpSignBundle,
+			Outcome:     audit.OutcomeSigned,
+			Key:         signerName(),
+			Signer:      signer.Address().Hex(),
+			PayloadHash: common.BytesToHash(core.MessageHash(message, false)),
+			Detail:      fmt.Sprintf("%s version %d", bundle.Organization, bundle.Version),
+		}); err != nil {
+			return err
+		}
+
+		output.Result(map[string]interface{}{
+			"organization": bundle.Organization,
+			"version":      bundle.Version,
+			"signer":       signer.Address(),
+			"hash":         signed.Hash(),
+			"output":       outputFile,
+		})
+		fmt.Printf("Bundle signed by %s and saved to: %s\n", signer.Address().Hex(), outputFile)
+		return nil
+	},
+}
+
+var policyBundleApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Verify and install a policy bundle",
+	Long: `Install a signed policy bundle: its policy replaces the signing policy, with the denylist
+added to the denied destinations and the contacts to the allowed destinations; its chains are
+merged over chains.json by name; and its contacts are added to the address book when it is
+unlocked with --book-password.
+
+The bundle must be signed by a trusted administrator and have a higher version than the
+installed bundle of the same organization. The first bundle installed on a vault is checked
+against the administrators given with --admin; later bundles against the administrators
+recorded then, which only a signed bundle can change.`,
+	Example: `  gosignervaultcli policy bundle apply --input acme-7.json --admin 0xAdminAddress   # first install
+  gosignervaultcli policy bundle apply --input acme-8.json --yes`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signed, bundle, err := policy.LoadSignedBundle(inputFile)
+		if err != nil {
+			return err
+		}
+		state, err := policy.LoadBundleState(bundleStateFile)
+		if err != nil {
+			return err
+		}
+		admins, err := parseAdmins()
+		if err != nil {
+			return err
+		}
+		switch {
+		case state == nil && len(admins) == 0:
+			return fmt.Errorf("no bundle is installed yet; pass --admin with the administrators to trust")
+		case state == nil:
+			state = &policy.BundleState{Admins: admins}
+		case len(admins) > 0:
+			return fmt.Errorf("this vault already trusts the administrators of %s; they only change through a signed bundle", state.Organization)
+		}
+
+		if err := state.Verify(signed, bundle); err != nil {
+			if auditErr := recordAudit(&audit.Record{
+				Operation: audit.OpApplyBundle,
+				Outcome:   audit.OutcomeRefused,
+				Signer:    signed.Signer.Hex(),
+				Detail:    fmt.Sprintf("%s version %d: %v", bundle.Organization, bundle.Version, err),
+			}); auditErr != nil {
+				return auditErr
+			}
+			return err
+		}
+
+		printBundle(bundle)
+		fmt.Printf("Signed by %s, replacing version %d\n", signed.Signer.Hex(), state.Version)
+		ok, err := confirm("Install this bundle?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("bundle installation aborted by user")
+		}
+
+		if err := policy.Save(policyFile, bundle.InstalledPolicy()); err != nil {
+			return err
+		}
+		if len(bundle.Chains) > 0 {
+			user, err := core.LoadUserChains()
+			if err != nil {
+				return err
+			}
+			for name, chain := range bundle.Chains {
+				user[strings.ToLower(name)] = chain
+			}
+			if err := core.SaveChainConfig(core.UserChainsFile, user); err != nil {
+				return err
+			}
+		}
+		if len(bundle.Contacts) > 0 {
+			if err := addBundleContacts(bundle); err != nil {
+				return err
+			}
+		}
+
+		installed := state.Installed(signed, bundle)
+		if err := policy.SaveBundleState(bundleStateFile, installed); err != nil {
+			return err
+		}
+		if err := recordAudit(&audit.Record{
+			Operation: audit.OpApplyBundle,
+			Outcome:   audit.OutcomeInstalled,
+			Signer:    signed.Signer.Hex(),
+			Detail:    fmt.Sprintf("%s version %d (sha256 %s)", bundle.Organization, bundle.Version, installed.Hash),
+		}); err != nil {
+			return err
+		}
+
+		output.Result(installed)
+		fmt.Printf("Installed version %d of the %s bundle\n", bundle.Version, bundle.Organization)
+		return nil
+	},
+}
+
+var policyBundleStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the installed policy bundle",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		state, err := policy.LoadBundleState(bundleStateFile)
+		if err != nil {
+			return err
+		}
+		output.Result(state)
+		if state == nil {
+			fmt.Println("No policy bundle installed")
+			return nil
+		}
+		fmt.Printf("Organization: %s\n", state.Organization)
+		fmt.Printf("Version:      %d\n", state.Version)
+		fmt.Printf("SHA-256:      %s\n", state.Hash)
+		fmt.Printf("Signed by:    %s\n", state.Signer.Hex())
+		fmt.Printf("Installed:    %s\n", state.InstalledAt.Format(time.RFC3339))
+		for _, admin := range state.Admins {
+			fmt.Printf("Admin:        %s\n", admin.Hex())
+		}
+		return nil
+	},
+}
+
+// parseAdmins parses the --admin addresses
+func parseAdmins() ([]common.Address, error) {
+	admins := make([]common.Address, 0, len(bundleAdmins))
+	for _, admin := range bundleAdmins {
+		if !common.IsHexAddress(admin) {
+			return nil, fmt.Errorf("invalid --admin address: %s", admin)
+		}
+		admins = append(admins, common.HexToAddress(admin))
+	}
+	return admins, nil
+}
+
+// printBundle summarizes what a bundle installs
+func printBundle(bundle *policy.Bundle) {
+	fmt.Printf("Policy bundle of %s, version %d\n", bundle.Organization, bundle.Version)
+	installed := bundle.InstalledPolicy()
+	fmt.Printf("  Policy:   %d allowed and %d denied destination(s), %d chain restriction(s), %d daily limit(s)\n",
+		len(installed.AllowedDestinations), len(installed.DeniedDestinations), len(installed.AllowedChains), len(installed.DailyLimits))
+	if len(bundle.Chains) > 0 {
+		names := make([]string, 0, len(bundle.Chains))
+		for name := range bundle.Chains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("  Chains:   %s\n", strings.Join(names, ", "))
+	}
+	fmt.Printf("  Denylist: %d address(es)\n", len(bundle.Denylist))
+	fmt.Printf("  Contacts: %d\n", len(bundle.Contacts))
+	for _, admin := range bundle.Admins {
+		fmt.Printf("  Next admin: %s\n", admin.Hex())
+	}
+}
+
+// addBundleContacts adds the contacts of a bundle that are not in the address
+// book yet, if it is unlocked
+func addBundleContacts(bundle *policy.Bundle) error {
+	book, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+	if book == nil {
+		fmt.Println("Note: contacts were only added to the policy allowlist, not to an address book")
+		return nil
+	}
+	for _, contact := range bundle.Contacts {
+		if _, ok := book.Lookup(contact.Address); ok {
+			continue
+		}
+		entry := &addressbook.Entry{Label: contact.Label, Address: contact.Address, Kind: addressbook.KindWatch, Note: contact.Note}
+		if err := book.Add(entry); err != nil {
+			fmt.Printf("Skipped contact %s: %v\n", contact.Label, err)
+		}
+	}
+	return book.Save()
+}
+
+func init() {
+	// Add flags
+	policyBundleCreateCmd.Flags().StringVar(&bundleOrg, "org", "", "Organization the bundle is for")
+	policyBundleCreateCmd.Flags().Uint64Var(&bundleVersion, "version", 0, "Version of the bundle, above every earlier one")
+	policyBundleCreateCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy to package")
+	policyBundleCreateCmd.Flags().StringVar(&bundleChainsFile, "chains", "", "Chain configurations to package")
+	policyBundleCreateCmd.Flags().StringVar(&bundleDenylistFile, "denylist", "", "Denied addresses, one per line")
+	policyBundleCreateCmd.Flags().StringVar(&bundleContactsFile, "contacts", "", "Contacts to allow, as a JSON array")
+	policyBundleCreateCmd.Flags().StringSliceVar(&bundleAdmins, "admin", nil, "Administrator trusted to sign later bundles (repeatable; default keeps the current ones)")
+	policyBundleCreateCmd.Flags().StringVar(&outputFile, "output", "policy-bundle.json", "Signed bundle file")
+	policyBundleCreateCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	policyBundleCreateCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	policyBundleCreateCmd.Flags().StringVar(&password, "password", "", "Key password")
+	policyBundleCreateCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	policyBundleCreateCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	policyBundleCreateCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	policyBundleCreateCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	policyBundleCreateCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	addKeystoreBackendFlags(policyBundleCreateCmd)
+	addSignerFlags(policyBundleCreateCmd)
+	addAuditFlags(policyBundleCreateCmd)
+
+	policyBundleApplyCmd.Flags().StringVar(&inputFile, "input", "", "Signed bundle file")
+	policyBundleApplyCmd.Flags().StringSliceVar(&bundleAdmins, "admin", nil, "Administrator to trust on the first install (repeatable)")
+	policyBundleApplyCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy to replace")
+	policyBundleApplyCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory holding the address book")
+	policyBundleApplyCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	addAddressBookFlags(policyBundleApplyCmd)
+	addAuditFlags(policyBundleApplyCmd)
+
+	policyBundleCmd.PersistentFlags().StringVar(&bundleStateFile, "bundle-state", policy.DefaultBundleStateFile, "Record of the installed bundle")
+
+	// Mark required flags
+	policyBundleCreateCmd.MarkFlagRequired("org")
+	policyBundleCreateCmd.MarkFlagRequired("version")
+	policyBundleApplyCmd.MarkFlagRequired("input")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(policyBundleStatusCmd)
+
+	// Add commands
+	policyBundleCmd.AddCommand(policyBundleCreateCmd)
+	policyBundleCmd.AddCommand(policyBundleApplyCmd)
+	policyBundleCmd.AddCommand(policyBundleStatusCmd)
+	PolicyCmd.AddCommand(policyBundleCmd)
+}
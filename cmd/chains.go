@@ -0,0 +1,447 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	chainIDValue   uint64
+	chainRPCs      []string
+	chainSymbol    string
+	chainExplorer  string
+	chainTestnet   bool
+	chainLabel     string
+	skipChainCheck bool
+	showTestnets   bool
+
+	chainNo1559           bool
+	chainLegacyOnly       bool
+	chainBlobs            bool
+	chainGasToken         string
+	chainGasTokenDecimals uint8
+	chainBlockTime        time.Duration
+	chainL1Fees           string
+	chainPriceID          string
+	chainUSDFeed          string
+)
+
+// ChainsCmd is the root command for chain configuration
+var ChainsCmd = &cobra.Command{
+	Use:     "chains",
+	Aliases: []string{"chain"},
+	Short:   "Manage chain configurations",
+	Long: `List the built-in chains and add, change or remove your own. User chains are kept in
+chains.json in the config directory and merged over the built-in ones, so set-rpc on a
+built-in chain only replaces its RPC endpoints. Every chain can have fallback endpoints that
+are tried in order when the first one does not answer.
+
+With --env <name>, environments/<name>/chains.json in the config directory is merged over
+those, e.g. to use staging or production RPC keys. A chain with "extends" inherits every
+field it does not set from another chain.`,
+}
+
+var chainsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured chains",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		chains, err := core.Chains()
+		if err != nil {
+			return err
+		}
+		user, err := core.LoadUserChains()
+		if err != nil {
+			return err
+		}
+		names, err := core.ChainNames()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCHAIN ID\tSYMBOL\tFEES\tSOURCE\tRPC")
+		for _, name := range names {
+			chain := chains[name]
+			if chain.IsTestnet && !showTestnets {
+				continue
+			}
+			source := "built-in"
+			if _, ok := user[name]; ok {
+				source = "user"
+				if _, builtin := core.DefaultChains[name]; builtin {
+					source = "modified"
+				}
+			}
+			rpc := endpointName(chain.RPCURL)
+			if len(chain.FallbackRPCs) > 0 {
+				rpc += fmt.Sprintf(" (+%d fallback)", len(chain.FallbackRPCs))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", name, chain.ChainID, chain.Symbol, chainFees(chain), source, rpc)
+		}
+		return w.Flush()
+	},
+}
+
+var chainsEffectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "Show the effective configuration of a chain",
+	Long: `Show the configuration of a chain after merging the built-in chains, chains.json, the
+overlay of the selected environment (--env) and the chain it extends, and list the sources
+that contributed to it. RPC URL paths, which often hold API keys, are hidden.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return err
+		}
+		sources, err := core.ChainSources(chainName)
+		if err != nil {
+			return err
+		}
+
+		shown := *chain
+		shown.RPCURL = redactEndpoint(chain.RPCURL)
+		shown.FallbackRPCs = make([]string, len(chain.FallbackRPCs))
+		for i, endpoint := range chain.FallbackRPCs {
+			shown.FallbackRPCs[i] = redactEndpoint(endpoint)
+		}
+		data, err := json.MarshalIndent(&shown, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal chain config: %v", err)
+		}
+
+		environment := "none"
+		if core.Environment != "" {
+			environment = core.Environment
+		}
+		fmt.Printf("Chain %s (environment: %s)\n", chainName, environment)
+		for i, source := range sources {
+			fmt.Printf("  %d. %s\n", i+1, source)
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
+
+var chainsAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a chain",
+	Long: `Add a chain under a short name used with --chain. The first --rpc is the primary endpoint
+and any others are fallbacks. The chain ID reported by the primary endpoint is checked
+against --chain-id unless --skip-check is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.ToLower(args[0])
+		chains, err := core.Chains()
+		if err != nil {
+			return err
+		}
+		if _, ok := chains[name]; ok {
+			return fmt.Errorf("chain %s already exists; change its endpoints with 'chains set-rpc'", name)
+		}
+		for existing, chain := range chains {
+			if chain.ChainID.Uint64() == chainIDValue {
+				fmt.Printf("Warning: chain %s also has chain ID %d\n", existing, chainIDValue)
+			}
+		}
+
+		if chainL1Fees != "" && chainL1Fees != core.L1FeesOPStack && chainL1Fees != core.L1FeesArbitrum {
+			return fmt.Errorf("unknown --l1-fees %q (expected %s or %s)", chainL1Fees, core.L1FeesOPStack, core.L1FeesArbitrum)
+		}
+		if chainUSDFeed != "" && !common.IsHexAddress(chainUSDFeed) {
+			return fmt.Errorf("invalid --usd-feed address: %s", chainUSDFeed)
+		}
+
+		chainID := new(big.Int).SetUint64(chainIDValue)
+		if err := checkChainRPCs(chainID, chainRPCs); err != nil {
+			return err
+		}
+
+		user, err := core.LoadUserChains()
+		if err != nil {
+			return err
+		}
+		chain := &core.ChainConfig{
+			Name:          firstNonEmpty(chainLabel, name),
+			ChainID:       chainID,
+			RPCURL:        chainRPCs[0],
+			FallbackRPCs:  chainRPCs[1:],
+			Symbol:        chainSymbol,
+			Explorer:      strings.TrimSuffix(chainExplorer, "/"),
+			IsTestnet:     chainTestnet,
+			SupportsBlobs: chainBlobs,
+			LegacyOnly:    chainLegacyOnly,
+			GasToken:      chainGasToken,
+			BlockTime:     chainBlockTime.Seconds(),
+			L1Fees:        chainL1Fees,
+			PriceID:       chainPriceID,
+			USDFeed:       chainUSDFeed,
+		}
+		if chainNo1559 {
+			supported := false
+			chain.Supports1559 = &supported
+		}
+		if cmd.Flags().Changed("gas-token-decimals") {
+			chain.GasTokenDecimals = &chainGasTokenDecimals
+		}
+		user[name] = chain
+		if err := core.SaveChainConfig(core.UserChainsFile, user); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added chain %s (chain ID %d) to %s\n", name, chainIDValue, core.UserChainsFile)
+		return nil
+	},
+}
+
+var chainsSetRPCCmd = &cobra.Command{
+	Use:   "set-rpc <name> <url> [fallback-url...]",
+	Short: "Set the RPC endpoints of a chain",
+	Long: `Replace the RPC endpoints of a chain. The first URL is the primary endpoint and any others
+are fallbacks, tried in order when the primary does not answer.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.ToLower(args[0])
+		chain, err := core.GetChainConfig(name)
+		if err != nil {
+			return err
+		}
+		if err := checkChainRPCs(chain.ChainID, args[1:]); err != nil {
+			return err
+		}
+
+		user, err := core.LoadUserChains()
+		if err != nil {
+			return err
+		}
+		entry, ok := user[name]
+		if !ok {
+			// Built-in chains only store what differs from the default
+			entry = &core.ChainConfig{}
+			user[name] = entry
+		}
+		entry.RPCURL = args[1]
+		entry.FallbackRPCs = args[2:]
+		if err := core.SaveChainConfig(core.UserChainsFile, user); err != nil {
+			return err
+		}
+
+		fmt.Printf("Chain %s now uses %s", name, endpointName(args[1]))
+		if len(args) > 2 {
+			fmt.Printf(" with %d fallback(s)", len(args)-2)
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+var chainsRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a user chain or restore a built-in one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.ToLower(args[0])
+		user, err := core.LoadUserChains()
+		if err != nil {
+			return err
+		}
+		if _, ok := user[name]; !ok {
+			if _, builtin := core.DefaultChains[name]; builtin {
+				return fmt.Errorf("chain %s is built in and cannot be removed", name)
+			}
+			return fmt.Errorf("chain %s not found", name)
+		}
+
+		delete(user, name)
+		if err := core.SaveChainConfig(core.UserChainsFile, user); err != nil {
+			return err
+		}
+
+		if _, builtin := core.DefaultChains[name]; builtin {
+			fmt.Printf("Restored the built-in configuration of chain %s\n", name)
+			return nil
+		}
+		fmt.Printf("Removed chain %s\n", name)
+		return nil
+	},
+}
+
+// chainFees summarizes the transaction types a chain accepts
+func chainFees(chain *core.ChainConfig) string {
+	fees := "legacy"
+	switch {
+	case chain.LegacyOnly:
+		fees = "legacy only"
+	case chain.DynamicFees():
+		fees = "eip-1559"
+	}
+	if chain.SupportsBlobs {
+		fees += ", blobs"
+	}
+	return fees
+}
+
+// redactEndpoint hides the path and query of an RPC URL
+func redactEndpoint(rpcURL string) string {
+	name := endpointName(rpcURL)
+	if u, err := url.Parse(rpcURL); err == nil && (strings.Trim(u.Path, "/") != "" || u.RawQuery != "") {
+		name += "/..."
+	}
+	return name
+}
+
+// ConfigureEnvironment selects the overlays of --env (or $GOSIGNERVAULT_ENV):
+// its chains.json is merged over the chains and its policy.json replaces the
+// signing policy, unless --policy was given
+func ConfigureEnvironment(c *cobra.Command, env string) error {
+	if env == "" {
+		env = os.Getenv(core.EnvEnvironment)
+	}
+	if err := core.SetEnvironment(env); err != nil {
+		return err
+	}
+	if env == "" {
+		return nil
+	}
+
+	envPolicy := filepath.Join(core.EnvironmentDir(env), "policy.json")
+	if f := c.Flags().Lookup("policy"); f != nil && !f.Changed {
+		if _, err := os.Stat(envPolicy); err == nil {
+			policyFile = envPolicy
+		}
+	}
+	return nil
+}
+
+// checkChainRPCs validates RPC URLs and, unless --skip-check is given, that the
+// primary endpoint serves the expected chain
+func checkChainRPCs(chainID *big.Int, urls []string) error {
+	for _, rpcURL := range urls {
+		// References are only resolved when the chain is used
+		if secrets.IsReference(rpcURL) {
+			continue
+		}
+		u, err := url.Parse(rpcURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid RPC URL: %s", rpcURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+		default:
+			return fmt.Errorf("unsupported RPC URL scheme %q in %s", u.Scheme, endpointName(rpcURL))
+		}
+	}
+	if skipChainCheck {
+		return nil
+	}
+
+	simulator, err := tx.NewSimulator(urls[0])
+	if err != nil {
+		return err
+	}
+	defer simulator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	reported, err := simulator.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check %s (pass --skip-check to add it anyway): %v", endpointName(urls[0]), err)
+	}
+	if reported.Cmp(chainID) != 0 {
+		return fmt.Errorf("%s serves chain ID %s, not %s", endpointName(urls[0]), reported, chainID)
+	}
+	return nil
+}
+
+// checkChainCapabilities refuses a transaction whose type or fees the chain
+// does not accept
+func checkChainCapabilities(chain *core.ChainConfig, transaction *types.Transaction) error {
+	problems := tx.NewValidator().ValidateForChain(transaction, chain)
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Message
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// chainWithID returns the configured chain with a chain ID, or nil if none has it
+func chainWithID(chainID *big.Int) (*core.ChainConfig, error) {
+	names, err := core.ChainNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		chain, err := core.GetChainConfig(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain config: %v", err)
+		}
+		if chain.ChainID.Cmp(chainID) == 0 {
+			return chain, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkRawCapabilities decodes a raw signed transaction and checks it against
+// the chain's capabilities
+func checkRawCapabilities(chain *core.ChainConfig, rawTx []byte) error {
+	var signedTx types.Transaction
+	if err := signedTx.UnmarshalBinary(rawTx); err != nil {
+		return fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	return checkChainCapabilities(chain, &signedTx)
+}
+
+func init() {
+	// Add flags
+	chainsListCmd.Flags().BoolVar(&showTestnets, "testnets", false, "Include testnets")
+	chainsEffectiveCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+
+	chainsAddCmd.Flags().Uint64Var(&chainIDValue, "chain-id", 0, "Chain ID")
+	chainsAddCmd.Flags().StringSliceVar(&chainRPCs, "rpc", nil, "RPC endpoint (repeatable; later ones are fallbacks)")
+	chainsAddCmd.Flags().StringVar(&chainSymbol, "symbol", "ETH", "Symbol of the native currency")
+	chainsAddCmd.Flags().StringVar(&chainExplorer, "explorer", "", "Block explorer URL")
+	chainsAddCmd.Flags().BoolVar(&chainTestnet, "testnet", false, "Mark the chain as a testnet")
+	chainsAddCmd.Flags().StringVar(&chainLabel, "display-name", "", "Display name (defaults to the chain name)")
+	chainsAddCmd.Flags().BoolVar(&skipChainCheck, "skip-check", false, "Do not check the chain ID served by the RPC endpoint")
+	chainsAddCmd.Flags().BoolVar(&chainNo1559, "no-1559", false, "The chain has no EIP-1559 fee market; fees are legacy gas prices")
+	chainsAddCmd.Flags().BoolVar(&chainLegacyOnly, "legacy-only", false, "The chain only accepts legacy (untyped) transactions")
+	chainsAddCmd.Flags().BoolVar(&chainBlobs, "blobs", false, "The chain accepts EIP-4844 blob transactions")
+	chainsAddCmd.Flags().StringVar(&chainGasToken, "gas-token", "", "Symbol of the token paying for gas (defaults to --symbol)")
+	chainsAddCmd.Flags().Uint8Var(&chainGasTokenDecimals, "gas-token-decimals", 18, "Decimals of the native gas token")
+	chainsAddCmd.Flags().DurationVar(&chainBlockTime, "block-time", 0, "Average block time, e.g. 2s")
+	chainsAddCmd.Flags().StringVar(&chainL1Fees, "l1-fees", "", "L1 data fee model of a rollup (op-stack or arbitrum)")
+	chainsAddCmd.Flags().StringVar(&chainPriceID, "price-id", "", "CoinGecko ID of the gas token")
+	chainsAddCmd.Flags().StringVar(&chainUSDFeed, "usd-feed", "", "Chainlink feed on the chain pricing the gas token in USD")
+	chainsSetRPCCmd.Flags().BoolVar(&skipChainCheck, "skip-check", false, "Do not check the chain ID served by the RPC endpoint")
+
+	// Mark required flags
+	chainsAddCmd.MarkFlagRequired("chain-id")
+	chainsAddCmd.MarkFlagRequired("rpc")
+
+	// Add commands
+	ChainsCmd.AddCommand(chainsListCmd)
+	ChainsCmd.AddCommand(chainsEffectiveCmd)
+	ChainsCmd.AddCommand(chainsAddCmd)
+	ChainsCmd.AddCommand(chainsSetRPCCmd)
+	ChainsCmd.AddCommand(chainsRemoveCmd)
+}
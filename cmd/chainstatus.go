@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+// maxHeadAge is the head age beyond which an endpoint counts as stale, unless
+// the chain's block time allows more
+const maxHeadAge = time.Minute
+
+var chainsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the chain head and finality of every endpoint of a chain",
+	Long: `Query every RPC endpoint of a chain for its latest, safe and finalized blocks, base fee,
+sync state and peer count, and compare the timestamp of its latest block with the local
+clock. Endpoints serving another chain, syncing, lagging behind the others or with a stale
+head are flagged, to pick a healthy endpoint before critical operations. Endpoints are
+queried directly, without fallbacks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+
+		endpoints := chain.Endpoints()
+		statuses := make([]*tx.EndpointStatus, len(endpoints))
+		var wg sync.WaitGroup
+		for i, endpoint := range endpoints {
+			wg.Add(1)
+			go func(i int, endpoint string) {
+				defer wg.Done()
+				statuses[i] = tx.CheckEndpoint(ctx, endpoint)
+			}(i, endpoint)
+		}
+		wg.Wait()
+
+		// Lag is measured against the highest head of the right chain
+		var best uint64
+		for _, status := range statuses {
+			if status.Latest != nil && status.ChainID.Cmp(chain.ChainID) == 0 && *status.Latest > best {
+				best = *status.Latest
+			}
+		}
+		staleAfter := maxHeadAge
+		if interval := 5 * chain.BlockInterval(); interval > staleAfter {
+			staleAfter = interval
+		}
+
+		fmt.Printf("Chain %s (chain ID %s)\n", chainName, chain.ChainID)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ENDPOINT\tLATEST\tSAFE\tFINALIZED\tBASE FEE\tHEAD AGE\tPEERS\tLATENCY\tSTATUS")
+		healthy := 0
+		for i, status := range statuses {
+			name := redactEndpoint(endpoints[i])
+			if status.Error != "" {
+				fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\t-\terror: %s\n", name, status.Error)
+				continue
+			}
+			problems := endpointProblems(status, chain, best, staleAfter)
+			if len(problems) == 0 {
+				healthy++
+				problems = []string{"ok"}
+			}
+			baseFee := "-"
+			if status.BaseFee != nil {
+				baseFee = core.FormatTokenAmount(status.BaseFee, 9) + " gwei"
+			}
+			peers := "-"
+			if status.Peers != nil {
+				peers = fmt.Sprint(*status.Peers)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, blockNumber(status.Latest),
+				blockNumber(status.Safe), blockNumber(status.Finalized), baseFee,
+				status.HeadAge.Round(time.Second), peers, status.Latency.Round(time.Millisecond),
+				strings.Join(problems, ", "))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			status.Endpoint = redactEndpoint(status.Endpoint)
+		}
+		output.Result(statuses)
+		if healthy == 0 {
+			return fmt.Errorf("no healthy endpoint for %s", chainName)
+		}
+		return nil
+	},
+}
+
+// endpointProblems lists what is wrong with an endpoint that answered
+func endpointProblems(status *tx.EndpointStatus, chain *core.ChainConfig, best uint64, staleAfter time.Duration) []string {
+	if status.ChainID.Cmp(chain.ChainID) != 0 {
+		return []string{fmt.Sprintf("serves chain ID %s", status.ChainID)}
+	}
+	var problems []string
+	if status.Syncing {
+		problems = append(problems, fmt.Sprintf("syncing (%d of %d)", status.SyncCurrent, status.SyncHighest))
+	}
+	if lag := best - *status.Latest; lag > 2 {
+		problems = append(problems, fmt.Sprintf("%d blocks behind", lag))
+	}
+	switch {
+	case status.HeadAge > staleAfter:
+		problems = append(problems, "stale head")
+	case status.HeadAge < -5*time.Second:
+		// A block from the future means the local clock is behind
+		problems = append(problems, fmt.Sprintf("local clock %s behind", (-status.HeadAge).Round(time.Second)))
+	}
+	if status.Peers != nil && *status.Peers == 0 {
+		problems = append(problems, "no peers")
+	}
+	return problems
+}
+
+// blockNumber formats an optional block number
+func blockNumber(number *uint64) string {
+	if number == nil {
+		return "-"
+	}
+	return fmt.Sprint(*number)
+}
+
+func init() {
+	// Add flags
+	chainsStatusCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+
+	// Add commands
+	ChainsCmd.AddCommand(chainsStatusCmd)
+}
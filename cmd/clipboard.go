@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/clipboard"
+	"github.com/spf13/cobra"
+)
+
+// EnvClipboardDigest passes the digest of a copied value to the process that
+// clears it, so a value copied since is left on the clipboard
+const EnvClipboardDigest = "GOSIGNERVAULT_CLIPBOARD_DIGEST"
+
+var (
+	copyOutput     bool
+	copyClearAfter time.Duration
+	clearDelay     time.Duration
+)
+
+// ClipboardCmd is the root command for the clipboard
+var ClipboardCmd = &cobra.Command{
+	Use:   "clipboard",
+	Short: "Manage values copied with --copy",
+}
+
+var clipboardClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear the clipboard",
+	Long: `Clear the system clipboard, after --after if given. Commands run with --copy start this
+command in the background to clear the value they copied; it then only clears the clipboard
+if it still holds that value.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		time.Sleep(clearDelay)
+		if digest := os.Getenv(EnvClipboardDigest); digest != "" {
+			return clipboard.ClearIf(digest)
+		}
+		if err := clipboard.Clear(); err != nil {
+			return err
+		}
+		fmt.Println("Clipboard cleared")
+		return nil
+	},
+}
+
+// copyToClipboard places a value printed by a command on the clipboard with
+// --copy and schedules its removal after --clipboard-timeout. The value is
+// already saved or printed, so a missing clipboard only warns.
+func copyToClipboard(label, value string) {
+	if !copyOutput {
+		return
+	}
+	if err := clipboard.Copy(value); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s not copied: %v\n", label, err)
+		return
+	}
+	if copyClearAfter <= 0 {
+		fmt.Fprintf(os.Stderr, "Copied %s to the clipboard\n", label)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		err = clipboard.ScheduleClear(
+			[]string{exe, "clipboard", "clear", "--after", copyClearAfter.String()},
+			[]string{EnvClipboardDigest + "=" + clipboard.Digest(value)},
+		)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the clipboard will not be cleared: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Copied %s to the clipboard; it is cleared in %s\n", label, copyClearAfter)
+}
+
+// addCopyFlags adds --copy and its timeout to a command
+func addCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&copyOutput, "copy", false, "Copy the result to the clipboard")
+	cmd.Flags().DurationVar(&copyClearAfter, "clipboard-timeout", clipboard.DefaultClearAfter, "Clear the copied result from the clipboard after this long (0 to keep it)")
+}
+
+func init() {
+	// Add flags
+	clipboardClearCmd.Flags().DurationVar(&clearDelay, "after", 0, "Wait this long before clearing")
+
+	// Add commands
+	ClipboardCmd.AddCommand(clipboardClearCmd)
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotAddresses []string
+	snapshotTokens    []string
+	snapshotFile      string
+	snapshotSigner    string
+)
+
+// ContextCmd is the root command for offline confirmation context
+var ContextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Capture and inspect chain data snapshots",
+	Long: `Capture chain data (balances, nonces, fees, code hashes, token metadata) on an online
+machine into a signed snapshot that an offline signer can display without network access.`,
+}
+
+var contextSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Capture a signed chain data snapshot",
+	Long:  `Capture chain data for the given addresses and tokens and sign it with a stored wallet key.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		addresses, err := parseAddresses(snapshotAddresses)
+		if err != nil {
+			return err
+		}
+		tokens, err := parseAddresses(snapshotTokens)
+		if err != nil {
+			return err
+		}
+
+		// Capture chain data
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		var snapshot *tx.Snapshot
+		if verifyState {
+			lc, err := newLightClient(chain)
+			if err != nil {
+				return err
+			}
+			snapshot, err = tx.TakeVerifiedSnapshot(ctx, lc, chain.RPCURL, chainName, addresses, tokens)
+			if err != nil {
+				return err
+			}
+		} else {
+			snapshot, err = tx.TakeSnapshot(ctx, chain.RPCURL, chainName, addresses, tokens)
+			if err != nil {
+				return err
+			}
+		}
+		if snapshot.ChainID.Cmp(chain.ChainID) != 0 {
+			return fmt.Errorf("RPC reports chain ID %s, expected %s", snapshot.ChainID, chain.ChainID)
+		}
+
+		// Sign snapshot
+		privateKey, err := loadPrivateKey()
+		if err != nil {
+			return err
+		}
+		defer securemem.WipeKey(privateKey)
+		if err := snapshot.Sign(privateKey); err != nil {
+			return err
+		}
+
+		if err := tx.SaveSnapshot(outputFile, snapshot); err != nil {
+			return err
+		}
+
+		fmt.Printf("Snapshot of block %d signed by %s and saved to: %s\n",
+			snapshot.BlockNumber, snapshot.Signer.Hex(), outputFile)
+		return nil
+	},
+}
+
+var contextShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Verify and display a chain data snapshot",
+	Long:  `Verify the signature on a snapshot file and display its contents. Requires no network access.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshot, err := loadSnapshot(snapshotFile, false)
+		if err != nil {
+			return err
+		}
+
+		printSnapshot(snapshot)
+		return nil
+	},
+}
+
+// loadSnapshot loads a snapshot and checks it was signed by --snapshot-signer.
+// A valid signature only shows the snapshot was not modified, not who took it,
+// so signing refuses snapshots without a trusted signer; elsewhere they are
+// shown with a warning.
+func loadSnapshot(path string, requireSigner bool) (*tx.Snapshot, error) {
+	snapshot, err := tx.LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshotSigner == "" {
+		if requireSigner {
+			return nil, fmt.Errorf("snapshot signer %s is not trusted; pass --snapshot-signer with the address that takes your snapshots", snapshot.Signer.Hex())
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: UNVERIFIED SNAPSHOT SIGNER %s\n", snapshot.Signer.Hex())
+		fmt.Fprintf(os.Stderr, "Anyone can sign a snapshot; pass --snapshot-signer with the address you trust.\n")
+		return snapshot, nil
+	}
+	if !common.IsHexAddress(snapshotSigner) {
+		return nil, fmt.Errorf("invalid snapshot signer address: %s", snapshotSigner)
+	}
+	if common.HexToAddress(snapshotSigner) != snapshot.Signer {
+		return nil, fmt.Errorf("snapshot was signed by %s, expected %s", snapshot.Signer.Hex(), snapshotSigner)
+	}
+
+	return snapshot, nil
+}
+
+// printSnapshot prints a snapshot in human-readable form
+func printSnapshot(snapshot *tx.Snapshot) {
+	fmt.Printf("Chain:      %s (ID %s)\n", snapshot.Chain, snapshot.ChainID)
+	fmt.Printf("Block:      %d (%s)\n", snapshot.BlockNumber, snapshot.BlockHash.Hex())
+	fmt.Printf("Taken at:   %s (%s ago)\n", snapshot.BlockTime.Format(time.RFC3339),
+		time.Since(snapshot.BlockTime).Round(time.Second))
+	fmt.Printf("Signed by:  %s\n", snapshot.Signer.Hex())
+	if snapshot.Verified {
+		fmt.Printf("Verified:   account state proven against a verified block header\n")
+	} else {
+		fmt.Printf("Verified:   no, reported by a single RPC provider\n")
+	}
+	fmt.Printf("Gas price:  %s wei\n", snapshot.GasPrice)
+	if snapshot.BaseFee != nil {
+		fmt.Printf("Base fee:   %s wei\n", snapshot.BaseFee)
+	}
+	if snapshot.GasTipCap != nil {
+		fmt.Printf("Tip cap:    %s wei\n", snapshot.GasTipCap)
+	}
+
+	for _, account := range snapshot.Accounts {
+		printAccountSnapshot("Account", &account)
+	}
+
+	for _, token := range snapshot.Tokens {
+		fmt.Printf("Token %s: %s (%s), %d decimals\n", token.Address.Hex(), token.Name, token.Symbol, token.Decimals)
+	}
+}
+
+// printAccountSnapshot prints the captured state of a single address
+func printAccountSnapshot(label string, account *tx.AccountSnapshot) {
+	kind := "EOA"
+	if account.IsContract {
+		kind = "contract, code hash " + account.CodeHash.Hex()
+	}
+	fmt.Printf("%s %s: balance %s wei, nonce %d, %s\n",
+		label, account.Address.Hex(), account.Balance, account.Nonce, kind)
+}
+
+// parseAddresses converts hex strings and ENS names into addresses
+func parseAddresses(values []string) ([]common.Address, error) {
+	var addresses []common.Address
+	for _, value := range values {
+		if core.IsENSName(value) {
+			address, err := resolveENSName(value)
+			if err != nil {
+				return nil, err
+			}
+			addresses = append(addresses, address)
+			continue
+		}
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid address: %s", value)
+		}
+		addresses = append(addresses, common.HexToAddress(value))
+	}
+	return addresses, nil
+}
+
+func init() {
+	// Add flags
+	contextSnapshotCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	contextSnapshotCmd.Flags().StringSliceVar(&snapshotAddresses, "address", nil, "Address to capture (repeatable)")
+	contextSnapshotCmd.Flags().StringSliceVar(&snapshotTokens, "token", nil, "ERC-20 token to capture metadata for (repeatable)")
+	contextSnapshotCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	contextSnapshotCmd.Flags().StringVar(&keyName, "name", "", "Key name used to sign the snapshot")
+	contextSnapshotCmd.Flags().StringVar(&password, "password", "", "Key password")
+	contextSnapshotCmd.Flags().StringVar(&outputFile, "output", "", "Output file")
+	addLightClientFlags(contextSnapshotCmd)
+
+	contextShowCmd.Flags().StringVar(&snapshotFile, "input", "", "Snapshot file")
+	contextShowCmd.Flags().StringVar(&snapshotSigner, "snapshot-signer", "", "Address the snapshot must be signed by (warns if not given)")
+
+	// Mark required flags
+	contextSnapshotCmd.MarkFlagRequired("address")
+	contextSnapshotCmd.MarkFlagRequired("name")
+	contextSnapshotCmd.MarkFlagRequired("password")
+	contextSnapshotCmd.MarkFlagRequired("output")
+	contextShowCmd.MarkFlagRequired("input")
+
+	// Add commands
+	ContextCmd.AddCommand(contextSnapshotCmd)
+	ContextCmd.AddCommand(contextShowCmd)
+}
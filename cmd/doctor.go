@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+const (
+	doctorPass = "PASS"
+	doctorFail = "FAIL"
+	doctorSkip = "SKIP"
+)
+
+var (
+	doctorChains       []string
+	doctorSkipNetwork  bool
+	doctorSkipHardware bool
+)
+
+// doctorResult is one cell of the self-test matrix
+type doctorResult struct {
+	Check  string
+	Target string
+	Status string
+	Detail string
+}
+
+// DoctorCmd runs an end-to-end self-test of the vault
+var DoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Run an end-to-end self-test before a signing session",
+	Long: `Run an end-to-end self-test with a throwaway key: encrypt and decrypt it through a
+temporary keystore, sign and verify a message and a legacy and an EIP-1559 transaction for
+every chain, check hardware wallet connectivity, RPC reachability and chain IDs, and the
+permissions of the keystore, history and policy files. No real key is touched.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		chains, err := doctorChainNames()
+		if err != nil {
+			return err
+		}
+
+		var results []doctorResult
+		add := func(check, target string, err error, detail string) {
+			result := doctorResult{Check: check, Target: target, Status: doctorPass, Detail: detail}
+			if err != nil {
+				result.Status, result.Detail = doctorFail, err.Error()
+			}
+			results = append(results, result)
+		}
+
+		// Keystore round trip with a throwaway key
+		wallet, err := core.NewWallet()
+		if err != nil {
+			return err
+		}
+		add("keystore", "encrypt/decrypt", checkKeystoreRoundTrip(wallet), wallet.Address.Hex())
+
+		// Signatures for every chain
+		for _, name := range chains {
+			chain, err := core.GetChainConfig(name)
+			if err != nil {
+				return err
+			}
+			add("sign message", name, checkMessageSignature(wallet), "")
+			add("sign legacy tx", name, checkTransactionSignature(wallet, chain, false), "chain ID "+chain.ChainID.String())
+			add("sign 1559 tx", name, checkTransactionSignature(wallet, chain, true), "chain ID "+chain.ChainID.String())
+		}
+
+		// Hardware wallets
+		if doctorSkipHardware {
+			results = append(results, doctorResult{Check: "hardware", Target: "usb", Status: doctorSkip, Detail: "--skip-hardware"})
+		} else {
+			results = append(results, checkHardware())
+		}
+
+		// RPC endpoints
+		for _, name := range chains {
+			if doctorSkipNetwork {
+				results = append(results, doctorResult{Check: "rpc", Target: name, Status: doctorSkip, Detail: "--skip-network"})
+				continue
+			}
+			chain, _ := core.GetChainConfig(name)
+			detail, err := checkRPC(chain)
+			add("rpc", name, err, detail)
+		}
+
+		// File permissions
+		results = append(results, checkPermissions()...)
+
+		// Print the matrix
+		failed := 0
+		for _, result := range results {
+			if result.Status == doctorFail {
+				failed++
+			}
+			fmt.Printf("%-4s  %-15s %-18s %s\n", result.Status, result.Check, result.Target, result.Detail)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(results))
+		}
+		fmt.Printf("All %d checks passed\n", len(results))
+		return nil
+	},
+}
+
+// doctorChainNames returns the chains to test, all configured chains by default
+func doctorChainNames() ([]string, error) {
+	if len(doctorChains) > 0 {
+		for _, name := range doctorChains {
+			if _, err := core.GetChainConfig(name); err != nil {
+				return nil, err
+			}
+		}
+		return doctorChains, nil
+	}
+
+	return core.ChainNames()
+}
+
+// checkKeystoreRoundTrip saves a key to a temporary keystore, loads it back
+// and checks that it decrypts to the same key
+func checkKeystoreRoundTrip(wallet *core.Wallet) error {
+	dir, err := os.MkdirTemp("", "gosignervault-doctor")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary keystore: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manager, err := keystore.NewManager(dir)
+	if err != nil {
+		return err
+	}
+	encryptedKey, err := keystore.EncryptKey(crypto.FromECDSA(wallet.PrivateKey), "doctor")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key: %v", err)
+	}
+	if err := manager.SaveKey(encryptedKey, "doctor"); err != nil {
+		return err
+	}
+	loaded, err := manager.LoadKey("doctor")
+	if err != nil {
+		return err
+	}
+
+	if _, err := keystore.DecryptKey(loaded, "wrong"); err == nil {
+		return fmt.Errorf("key decrypted with a wrong password")
+	}
+	privateKey, err := keystore.DecryptKey(loaded, "doctor")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(crypto.FromECDSA(privateKey), crypto.FromECDSA(wallet.PrivateKey)) {
+		return fmt.Errorf("decrypted key differs from the original")
+	}
+	return nil
+}
+
+// checkMessageSignature signs a message and verifies it against the address
+func checkMessageSignature(wallet *core.Wallet) error {
+	message := []byte("gosignervault doctor")
+	signature, err := core.SignMessage(message, wallet.PrivateKey, false)
+	if err != nil {
+		return err
+	}
+	ok, err := core.VerifyMessage(message, signature, wallet.Address, false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("signature does not verify")
+	}
+	return nil
+}
+
+// checkTransactionSignature signs a transaction for a chain, decodes it and
+// checks that the sender and chain ID are recovered
+func checkTransactionSignature(wallet *core.Wallet, chain *core.ChainConfig, dynamicFee bool) error {
+	to := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	transaction := &core.Transaction{
+		To:       &to,
+		Value:    big.NewInt(1),
+		GasLimit: 21000,
+		ChainID:  chain.ChainID,
+	}
+	if dynamicFee {
+		transaction.MaxFeePerGas = big.NewInt(30_000_000_000)
+		transaction.MaxPriorityFeePerGas = big.NewInt(1_000_000_000)
+	} else {
+		transaction.GasPrice = big.NewInt(30_000_000_000)
+	}
+
+	rawTx, err := core.SignTransaction(transaction, wallet.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	var signedTx types.Transaction
+	if err := signedTx.UnmarshalBinary(common.FromHex(rawTx)); err != nil {
+		return fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	if signedTx.ChainId().Cmp(chain.ChainID) != 0 {
+		return fmt.Errorf("signed for chain ID %s instead of %s", signedTx.ChainId(), chain.ChainID)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chain.ChainID), &signedTx)
+	if err != nil {
+		return fmt.Errorf("failed to recover sender: %v", err)
+	}
+	if from != wallet.Address {
+		return fmt.Errorf("recovered sender %s instead of %s", from.Hex(), wallet.Address.Hex())
+	}
+	return nil
+}
+
+// checkHardware lists hardware wallets and derives the first account of each
+func checkHardware() doctorResult {
+	result := doctorResult{Check: "hardware", Target: "usb"}
+	wallets, err := core.ListHardwareWallets()
+	if err != nil {
+		result.Status, result.Detail = doctorFail, err.Error()
+		return result
+	}
+	if len(wallets) == 0 {
+		result.Status, result.Detail = doctorSkip, "no devices connected"
+		return result
+	}
+
+	for i, wallet := range wallets {
+		if err := wallet.Open(""); err != nil {
+			result.Status, result.Detail = doctorFail, fmt.Sprintf("device %d: failed to open: %v", i, err)
+			return result
+		}
+		_, err := wallet.Derive(core.AccountDerivationPath(0), false)
+		wallet.Close()
+		if err != nil {
+			result.Status, result.Detail = doctorFail, fmt.Sprintf("device %d: failed to derive: %v", i, err)
+			return result
+		}
+	}
+	result.Status, result.Detail = doctorPass, fmt.Sprintf("%d devices", len(wallets))
+	return result
+}
+
+// checkRPC checks that a chain's RPC endpoint answers with its chain ID
+func checkRPC(chain *core.ChainConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		return "", err
+	}
+	defer simulator.Close()
+
+	chainID, err := simulator.ChainID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if chainID.Cmp(chain.ChainID) != 0 {
+		return "", fmt.Errorf("endpoint serves chain ID %s instead of %s", chainID, chain.ChainID)
+	}
+	return fmt.Sprintf("chain ID %s in %s", chainID, time.Since(start).Round(time.Millisecond)), nil
+}
+
+// checkPermissions checks that keys, history and policy cannot be read or
+// changed by other users
+func checkPermissions() []doctorResult {
+	if runtime.GOOS == "windows" {
+		return []doctorResult{{Check: "permissions", Target: "files", Status: doctorSkip, Detail: "not checked on Windows"}}
+	}
+
+	var results []doctorResult
+	check := func(path string, forbidden os.FileMode, what string) {
+		result := doctorResult{Check: "permissions", Target: filepath.Base(path), Status: doctorPass}
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			result.Status, result.Detail = doctorSkip, path+" does not exist"
+		case err != nil:
+			result.Status, result.Detail = doctorFail, err.Error()
+		case info.Mode().Perm()&forbidden != 0:
+			result.Status, result.Detail = doctorFail, fmt.Sprintf("%s is %s; it must not be %s by others", path, info.Mode().Perm(), what)
+		default:
+			result.Detail = fmt.Sprintf("%s is %s", path, info.Mode().Perm())
+		}
+		results = append(results, result)
+	}
+
+	// Key files must be private, the policy and history must not be writable by others
+	check(keystoreDir, 0077, "accessible")
+	if entries, err := os.ReadDir(keystoreDir); err == nil {
+		for _, entry := range entries {
+			if filepath.Ext(entry.Name()) == ".json" {
+				check(filepath.Join(keystoreDir, entry.Name()), 0077, "accessible")
+			}
+		}
+	}
+	check(historyFile, 0022, "writable")
+	check(policyFile, 0022, "writable")
+	return results
+}
+
+func init() {
+	// Add flags
+	DoctorCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	DoctorCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	DoctorCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	DoctorCmd.Flags().StringSliceVar(&doctorChains, "chain", nil, "Chains to test (default all configured chains)")
+	DoctorCmd.Flags().BoolVar(&doctorSkipNetwork, "skip-network", false, "Do not contact RPC endpoints")
+	DoctorCmd.Flags().BoolVar(&doctorSkipHardware, "skip-hardware", false, "Do not look for hardware wallets")
+}
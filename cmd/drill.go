@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	drillKeyFile string
+	drillMessage string
+)
+
+// DrillCmd is the root command for recovery drills
+var DrillCmd = &cobra.Command{
+	Use:   "drill",
+	Short: "Prove that backups can be restored",
+}
+
+var drillRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup into a throwaway keystore and check it against production",
+	Long: `Restore a backup written by 'keys backup' (--input) or a raw private key (--key-file) into a
+temporary keystore, unlock every restored key with --password, check that the derived
+addresses match the keys of the production keystore, and sign and verify a test message
+with each. Production keys missing from the backup fail the drill. The production keystore
+is only read, and the temporary keystore is deleted afterwards.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (inputFile == "") == (drillKeyFile == "") {
+			return fmt.Errorf("pass either --input or --key-file")
+		}
+
+		// Production inventory, read without unlocking anything
+		production, err := keystore.NewManager(keystoreDir)
+		if err != nil {
+			return fmt.Errorf("failed to create keystore manager: %v", err)
+		}
+		inventory, err := keyInventory(production)
+		if err != nil {
+			return err
+		}
+
+		var results []doctorResult
+		add := func(check, target string, err error, detail string) {
+			result := doctorResult{Check: check, Target: target, Status: doctorPass, Detail: detail}
+			if err != nil {
+				result.Status, result.Detail = doctorFail, err.Error()
+			}
+			results = append(results, result)
+		}
+		message := []byte(drillMessage)
+
+		if drillKeyFile != "" {
+			privateKey, err := readDrillKey(drillKeyFile)
+			if err != nil {
+				return err
+			}
+			address := crypto.PubkeyToAddress(privateKey.PublicKey)
+			name, err := matchInventory(inventory, keyName, address)
+			add("inventory", firstNonEmpty(name, keyName, "key file"), err, address.Hex())
+			add("sign message", firstNonEmpty(name, keyName, "key file"), checkDrillSignature(privateKey, address, message), "")
+		} else {
+			dir, err := os.MkdirTemp("", "gosignervault-drill")
+			if err != nil {
+				return fmt.Errorf("failed to create temporary keystore: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := keystore.RestoreBackup(inputFile, dir, backupPassword); err != nil {
+				return err
+			}
+			restored, err := keystore.NewManager(dir)
+			if err != nil {
+				return fmt.Errorf("failed to open restored keystore: %v", err)
+			}
+			backup, err := keyInventory(restored)
+			if err != nil {
+				return err
+			}
+			add("restore", inputFile, nil, fmt.Sprintf("%d key(s)", len(backup)))
+
+			for _, name := range sortedNames(backup) {
+				results = append(results, drillRestoredKey(restored, name, backup[name], inventory, message)...)
+			}
+			for _, name := range sortedNames(inventory) {
+				if _, ok := backup[name]; !ok {
+					add("inventory", name, fmt.Errorf("%s is missing from the backup", inventory[name].Hex()), "")
+				}
+			}
+		}
+
+		// Print the matrix
+		failed := 0
+		for _, result := range results {
+			if result.Status == doctorFail {
+				failed++
+			}
+			fmt.Printf("%-4s  %-15s %-18s %s\n", result.Status, result.Check, result.Target, result.Detail)
+		}
+		if failed > 0 {
+			return fmt.Errorf("recovery drill failed: %d of %d checks failed", failed, len(results))
+		}
+		fmt.Printf("Recovery drill passed: all %d checks passed\n", len(results))
+		return nil
+	},
+}
+
+// drillRestoredKey unlocks a restored key, compares it with the production key
+// of the same name and signs the test message with it
+func drillRestoredKey(restored *keystore.Manager, name string, recorded common.Address, inventory map[string]common.Address, message []byte) []doctorResult {
+	var results []doctorResult
+	add := func(check string, err error, detail string) {
+		result := doctorResult{Check: check, Target: name, Status: doctorPass, Detail: detail}
+		if err != nil {
+			result.Status, result.Detail = doctorFail, err.Error()
+		}
+		results = append(results, result)
+	}
+
+	switch address, ok := inventory[name]; {
+	case !ok:
+		results = append(results, doctorResult{Check: "inventory", Target: name, Status: doctorSkip, Detail: "not in the production keystore"})
+	case address != recorded:
+		add("inventory", fmt.Errorf("backup holds %s, production holds %s", recorded.Hex(), address.Hex()), "")
+	default:
+		add("inventory", nil, recorded.Hex())
+	}
+
+	encryptedKey, err := restored.LoadKey(name)
+	if err != nil {
+		add("unlock", err, "")
+		return results
+	}
+	privateKey, err := keystore.DecryptKey(encryptedKey, password)
+	if err != nil {
+		add("unlock", err, "")
+		return results
+	}
+	defer securemem.WipeKey(privateKey)
+	derived := crypto.PubkeyToAddress(privateKey.PublicKey)
+	if derived != recorded {
+		add("unlock", fmt.Errorf("key derives %s, file records %s", derived.Hex(), recorded.Hex()), "")
+		return results
+	}
+	add("unlock", nil, derived.Hex())
+	add("sign message", checkDrillSignature(privateKey, derived, message), "")
+	return results
+}
+
+// checkDrillSignature signs the test message and checks the signature
+// recovers to the expected address
+func checkDrillSignature(privateKey *ecdsa.PrivateKey, address common.Address, message []byte) error {
+	signature, err := core.SignMessage(message, privateKey, false)
+	if err != nil {
+		return err
+	}
+	signer, err := core.RecoverMessageSigner(message, common.FromHex(signature), false)
+	if err != nil {
+		return err
+	}
+	if signer != address {
+		return fmt.Errorf("signature recovers to %s", signer.Hex())
+	}
+	return nil
+}
+
+// keyInventory returns the address recorded in every key file of a keystore
+func keyInventory(manager *keystore.Manager) (map[string]common.Address, error) {
+	names, err := manager.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+	inventory := make(map[string]common.Address, len(names))
+	for _, name := range names {
+		key, err := manager.LoadKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %v", name, err)
+		}
+		inventory[name] = common.HexToAddress(key.Address)
+	}
+	return inventory, nil
+}
+
+// matchInventory finds the production key of a restored address, by name if
+// one is given
+func matchInventory(inventory map[string]common.Address, name string, address common.Address) (string, error) {
+	if name != "" {
+		expected, ok := inventory[name]
+		if !ok {
+			return name, fmt.Errorf("key %s is not in the production keystore", name)
+		}
+		if expected != address {
+			return name, fmt.Errorf("key file derives %s, production holds %s", address.Hex(), expected.Hex())
+		}
+		return name, nil
+	}
+	for _, candidate := range sortedNames(inventory) {
+		if inventory[candidate] == address {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s matches no key of the production keystore", address.Hex())
+}
+
+// readDrillKey reads a hex private key from a file
+func readDrillKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %v", path, err)
+	}
+	return privateKey, nil
+}
+
+// sortedNames returns the key names of an inventory in order
+func sortedNames(inventory map[string]common.Address) []string {
+	names := make([]string, 0, len(inventory))
+	for name := range inventory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	// Add flags
+	drillRestoreCmd.Flags().StringVar(&inputFile, "input", "", "Backup archive written by 'keys backup'")
+	drillRestoreCmd.Flags().StringVar(&backupPassword, "backup-password", "", "Password of the backup")
+	drillRestoreCmd.Flags().StringVar(&drillKeyFile, "key-file", "", "File holding a hex private key to check instead of a backup")
+	drillRestoreCmd.Flags().StringVar(&password, "password", "", "Password of the restored keys")
+	drillRestoreCmd.Flags().StringVar(&keyName, "name", "", "Production key the --key-file should match (default: any)")
+	drillRestoreCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Production keystore to compare against")
+	drillRestoreCmd.Flags().StringVar(&drillMessage, "message", "GoSignerVault recovery drill "+time.Now().UTC().Format("2006-01-02"), "Test message to sign")
+
+	// Add commands
+	DrillCmd.AddCommand(drillRestoreCmd)
+}
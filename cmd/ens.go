@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// ensResolvers caches a resolver per chain for the lifetime of a command
+	ensResolvers = make(map[string]*core.ENSResolver)
+	// ensNames holds the ENS names addresses were given as, shown next to
+	// them in previews
+	ensNames = make(map[common.Address]string)
+)
+
+// ENSCmd is the root command for ENS names
+var ENSCmd = &cobra.Command{
+	Use:   "ens",
+	Short: "Resolve ENS names",
+	Long: `Resolve ENS names against the registry of --chain. Names are also accepted wherever an address
+is, e.g. tx build --to vitalik.eth, and previews show the name next to the address it resolved to.`,
+}
+
+var ensResolveCmd = &cobra.Command{
+	Use:   "resolve <name|address>",
+	Short: "Resolve an ENS name, or look up the primary name of an address",
+	Long: `Resolve an ENS name to its address and check whether the address claims the name back as its
+primary name, or look up the primary name of an address. Primary names are only shown if they
+resolve back to the address.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resolver, err := ensResolver(chainName)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if common.IsHexAddress(args[0]) {
+			address := common.HexToAddress(args[0])
+			name, err := resolver.LookupAddress(ctx, address)
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				fmt.Printf("%s has no verified primary name\n", address.Hex())
+				return nil
+			}
+			fmt.Printf("%s: %s\n", address.Hex(), name)
+			return nil
+		}
+
+		name, err := core.NormalizeENSName(args[0])
+		if err != nil {
+			return err
+		}
+		address, err := resolver.Resolve(ctx, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", name, address.Hex())
+
+		primary, err := resolver.LookupAddress(ctx, address)
+		switch {
+		case err != nil:
+			fmt.Printf("Warning: %v\n", err)
+		case primary == name:
+			fmt.Println("Primary name of the address: yes")
+		case primary == "":
+			fmt.Println("Primary name of the address: none set")
+		default:
+			fmt.Printf("Primary name of the address: %s\n", primary)
+		}
+		return nil
+	},
+}
+
+// ensResolver returns the cached resolver of a chain
+func ensResolver(name string) (*core.ENSResolver, error) {
+	if resolver, ok := ensResolvers[name]; ok {
+		return resolver, nil
+	}
+	chain, err := core.GetChainConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain config: %v", err)
+	}
+	resolver, err := tx.NewENSResolver(chain)
+	if err != nil {
+		return nil, err
+	}
+	ensResolvers[name] = resolver
+	return resolver, nil
+}
+
+// resolveENSName resolves an ENS name on the chain of --chain, at --block
+// when building, and remembers the name for previews
+func resolveENSName(value string) (common.Address, error) {
+	name, err := core.NormalizeENSName(value)
+	if err != nil {
+		return common.Address{}, err
+	}
+	resolver, err := ensResolver(chainName)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if buildBlock != 0 {
+		resolver.Block = new(big.Int).SetUint64(buildBlock)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	address, err := resolver.Resolve(ctx, name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	ensNames[address] = name
+	fmt.Fprintf(os.Stderr, "Resolved %s to %s\n", name, address.Hex())
+	return address, nil
+}
+
+// recordENSNames records the ENS names a transaction was built from, so the
+// signer's preview can show them
+func recordENSNames(build *tx.BuildContext) {
+	for address, name := range ensNames {
+		if build.ENS == nil {
+			build.ENS = make(map[string]common.Address)
+		}
+		build.ENS[name] = address
+	}
+}
+
+// loadPayloadENSNames shows the ENS names recorded in a payload in previews.
+// They are marked as taken from the payload since an offline signer cannot
+// check them.
+func loadPayloadENSNames(build *tx.BuildContext) {
+	if build == nil {
+		return
+	}
+	for name, address := range build.ENS {
+		if _, ok := ensNames[address]; !ok {
+			ensNames[address] = name + " per payload"
+		}
+	}
+}
+
+func init() {
+	// Add flags
+	ensResolveCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain whose ENS registry is used")
+
+	// Add commands
+	ENSCmd.AddCommand(ensResolveCmd)
+}
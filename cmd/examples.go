@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	examplesDir   string
+	examplesForce bool
+)
+
+// exampleFlow is a worked end-to-end example with the sample files its
+// commands read
+type exampleFlow struct {
+	Name  string            `json:"name"`
+	Short string            `json:"short"`
+	Steps string            `json:"steps"`
+	Files map[string]string `json:"files"`
+}
+
+// sampleTransaction is the unsigned transaction of the single-transaction flows
+const sampleTransaction = `{
+  "nonce": 0,
+  "to": "0x1111111111111111111111111111111111111111",
+  "value": 10000000000000000,
+  "gasLimit": 21000,
+  "maxFeePerGas": 30000000000,
+  "maxPriorityFeePerGas": 1500000000
+}
+`
+
+// exampleFlows are the flows listed by 'examples'. The Example fields of the
+// commands they use point back to them.
+var exampleFlows = []*exampleFlow{
+	{
+		Name:  "airgap",
+		Short: "Prepare online, sign on an offline machine, broadcast online, all over QR codes",
+		Steps: `# Online machine: fill in nonce and fees for the sender, show the payload as a QR code
+gosignervaultcli tx prepare --input rawTx.json --chain ethereum --from 0xYourAddress --qr
+
+# Offline machine: scan the parts, check the preview, sign and show the result
+gosignervaultcli sign tx --qr --name mywallet --output signedTx.txt
+
+# Online machine: scan the signed payload and broadcast it
+gosignervaultcli tx broadcast --qr --chain ethereum`,
+		Files: map[string]string{"rawTx.json": sampleTransaction},
+	},
+	{
+		Name:  "hardware",
+		Short: "Find the account of a hardware wallet and sign a transaction on it",
+		Steps: `# List connected devices, what they sign and their first accounts
+gosignervaultcli hardware list
+
+# Find the account holding funds if it is not on the default path
+gosignervaultcli hardware accounts --count 10 --chain ethereum
+
+# Sign on the device; it shows the transaction for confirmation
+gosignervaultcli sign tx --signer "ledger:m/44'/60'/0'/0/0" --input rawTx.json --output signedTx.txt
+
+# Broadcast it
+gosignervaultcli tx broadcast --input signedTx.txt --chain ethereum`,
+		Files: map[string]string{"rawTx.json": sampleTransaction},
+	},
+	{
+		Name:  "batch",
+		Short: "Sign a payout batch with sequential nonces and broadcast every transaction",
+		Steps: `# Sign every entry; nonces start at the pending nonce of each sender
+gosignervaultcli sign batch --input payouts.json --name payroll --fetch-nonces --output signed.json
+
+# Or fan the batch out to the connected hardware wallets
+gosignervaultcli sign batch --input payouts.json --hardware --output signed.json
+
+# Broadcast each signed entry on its chain; failed entries carry no rawTransaction
+jq -r '.[] | select(.rawTransaction) | "\(.chain) \(.rawTransaction)"' signed.json |
+while read chain raw; do
+  echo "$raw" > entry.hex && gosignervaultcli tx broadcast --input entry.hex --chain "$chain"
+done`,
+		Files: map[string]string{"payouts.json": `[
+  { "to": "0x1111111111111111111111111111111111111111", "value": 1000000000000000000, "gasLimit": 21000, "maxFeePerGas": 30000000000, "maxPriorityFeePerGas": 1500000000 },
+  { "to": "0x2222222222222222222222222222222222222222", "value": 2500000000000000000, "gasLimit": 21000, "maxFeePerGas": 30000000000, "maxPriorityFeePerGas": 1500000000 },
+  { "chain": "polygon", "to": "0x3333333333333333333333333333333333333333", "value": 5000000000000000000, "gasLimit": 21000, "maxFeePerGas": 60000000000, "maxPriorityFeePerGas": 30000000000 }
+]
+`},
+	},
+	{
+		Name:  "safe",
+		Short: "Collect owner signatures for a Safe transaction and build its execTransaction",
+		Steps: `# Check the SafeTxHash every owner signs
+gosignervaultcli safe hash --input safe-tx.json
+
+# Each owner signs, with a key or a Ledger
+gosignervaultcli safe sign --input safe-tx.json --name owner1 --output sig1.json
+gosignervaultcli safe sign --input safe-tx.json --hardware --output sig2.json
+
+# Build the execTransaction call once enough owners signed, then sign and broadcast it
+gosignervaultcli safe execute --input safe-tx.json --signature sig1.json --signature sig2.json --threshold 2 --output exec.json
+gosignervaultcli sign tx --input exec.json --name executor --output signedExec.txt
+gosignervaultcli tx broadcast --input signedExec.txt --chain ethereum`,
+		Files: map[string]string{"safe-tx.json": `{
+  "safe": "0x4444444444444444444444444444444444444444",
+  "chainId": 1,
+  "to": "0x1111111111111111111111111111111111111111",
+  "value": 10000000000000000,
+  "data": "0x",
+  "operation": 0,
+  "nonce": 0
+}
+`},
+	},
+}
+
+// ExamplesCmd is the root command for the worked examples
+var ExamplesCmd = &cobra.Command{
+	Use:   "examples",
+	Short: "List worked end-to-end examples and scaffold their sample files",
+	Long: `List worked examples of complete flows: air-gapped signing, hardware wallet signing, batch
+payouts and Safe multisig signing. 'examples show' prints the commands of a flow and 'examples
+init' writes the sample input files it uses into a working directory to adapt.
+
+The sample files use placeholder addresses such as 0x1111...1111 and a nonce of 0. Replace
+them with your own before signing anything.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output.Result(exampleFlows)
+		for _, flow := range exampleFlows {
+			fmt.Printf("%-10s %s\n", flow.Name, flow.Short)
+		}
+		fmt.Println("Show a flow with 'examples show <name>', scaffold its files with 'examples init <name>'")
+		return nil
+	},
+}
+
+var examplesShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Print the commands of a worked example",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flow, err := findExampleFlow(args[0])
+		if err != nil {
+			return err
+		}
+		output.Result(flow)
+
+		fmt.Printf("%s\n\n%s\n\nSample files: %s\n", flow.Short, flow.Steps, strings.Join(exampleFileNames(flow), ", "))
+		return nil
+	},
+}
+
+var examplesInitCmd = &cobra.Command{
+	Use:   "init [name...]",
+	Short: "Write the sample input files of worked examples into a directory",
+	Long: `Write the sample input files of the named flows (all flows if none are named) into --dir,
+along with a <name>.sh file holding the commands of each flow. Existing files are kept unless
+--force is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flows := exampleFlows
+		if len(args) > 0 {
+			flows = nil
+			for _, name := range args {
+				flow, err := findExampleFlow(name)
+				if err != nil {
+					return err
+				}
+				flows = append(flows, flow)
+			}
+		}
+
+		if err := os.MkdirAll(examplesDir, 0700); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		// Flows share sample files such as rawTx.json
+		files := make(map[string]string)
+		for _, flow := range flows {
+			files[flow.Name+".sh"] = "#!/bin/sh\n# " + flow.Short + "\n\n" + flow.Steps + "\n"
+			for name, content := range flow.Files {
+				files[name] = content
+			}
+		}
+		var written []string
+		for _, name := range sortedFileNames(files) {
+			path := filepath.Join(examplesDir, name)
+			if err := writeExampleFile(path, files[name]); err != nil {
+				if errors.Is(err, os.ErrExist) {
+					fmt.Printf("Kept existing %s\n", path)
+					continue
+				}
+				return err
+			}
+			written = append(written, path)
+			fmt.Printf("Wrote %s\n", path)
+		}
+		output.Result(written)
+		fmt.Println("Replace the placeholder addresses, values and nonces before signing")
+		return nil
+	},
+}
+
+// findExampleFlow returns the flow with the given name
+func findExampleFlow(name string) (*exampleFlow, error) {
+	var names []string
+	for _, flow := range exampleFlows {
+		if flow.Name == name {
+			return flow, nil
+		}
+		names = append(names, flow.Name)
+	}
+	return nil, fmt.Errorf("unknown example %q (expected %s)", name, strings.Join(names, ", "))
+}
+
+// exampleFileNames returns the sample file names of a flow in order
+func exampleFileNames(flow *exampleFlow) []string {
+	return sortedFileNames(flow.Files)
+}
+
+// sortedFileNames returns the names of files in order
+func sortedFileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeExampleFile writes a sample file, refusing to replace an existing one
+// unless --force is given
+func writeExampleFile(path, content string) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !examplesForce {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+func init() {
+	// Add flags
+	examplesInitCmd.Flags().StringVar(&examplesDir, "dir", ".", "Working directory to write the files to")
+	examplesInitCmd.Flags().BoolVar(&examplesForce, "force", false, "Replace existing files")
+
+	// Add commands
+	ExamplesCmd.AddCommand(examplesShowCmd)
+	ExamplesCmd.AddCommand(examplesInitCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/secrets"
+)
+
+// explainTopics are the kinds of decisions --explain can report
+var explainTopics = []string{"nonce", "fees", "gas", "amounts", "rpc"}
+
+// explaining holds the topics selected with --explain
+var explaining = make(map[string]bool)
+
+// ConfigureExplain selects the topics whose decisions are explained; "all"
+// selects every topic
+func ConfigureExplain(topics []string) error {
+	for _, topic := range topics {
+		topic = strings.ToLower(strings.TrimSpace(topic))
+		if topic == "all" {
+			for _, name := range explainTopics {
+				explaining[name] = true
+			}
+			continue
+		}
+		if !containsTopic(topic) {
+			return fmt.Errorf("unknown --explain topic %q (expected %s or all)", topic, strings.Join(explainTopics, ", "))
+		}
+		explaining[topic] = true
+	}
+	return nil
+}
+
+// explain reports how a derived value was computed. Explanations go to
+// stderr so they never mix with payloads written to stdout.
+func explain(topic, format string, args ...interface{}) {
+	if !explaining[topic] {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "explain [%s] %s\n", topic, fmt.Sprintf(format, args...))
+}
+
+// endpointName shortens an RPC URL to its scheme and host, leaving out
+// API keys carried in the path or query
+func endpointName(rpcURL string) string {
+	// A reference names its secret without revealing it
+	if secrets.IsReference(rpcURL) {
+		return rpcURL
+	}
+	u, err := url.Parse(rpcURL)
+	if err != nil || u.Host == "" {
+		return "(invalid URL)"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// containsTopic reports whether topic is a known explain topic
+func containsTopic(topic string) bool {
+	for _, name := range explainTopics {
+		if name == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gasPreset         string
+	feeHistoryBlocks  int
+	gasPercentiles    []string
+	baseFeeMultiplier string
+)
+
+var txGasCmd = &cobra.Command{
+	Use:   "gas",
+	Short: "Gas fee suggestions",
+	Long:  `Suggest EIP-1559 fees from the chain's recent fee history.`,
+}
+
+var txGasSuggestCmd = &cobra.Command{
+	Use:   "suggest",
+	Short: "Suggest slow, standard and fast fees",
+	Long: `Suggest maxFeePerGas and maxPriorityFeePerGas for the slow, standard and fast presets.
+The priority fee of a preset is the median of its reward percentile over the sampled
+blocks; maxFeePerGas adds it to a multiple of the next block's base fee.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		fees, err := suggestFees(chain)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Fee suggestions for %s from %d blocks starting at %s\n", chain.Name, fees.Blocks, fees.OldestBlock)
+		if fees.Legacy() {
+			fmt.Println("Chain has no base fee; suggestions are legacy gas prices")
+		} else {
+			fmt.Printf("Next base fee: %s gwei\n", core.FormatTokenAmount(fees.BaseFee, 9))
+			if !chain.DynamicFees() {
+				fmt.Println("Chain does not support EIP-1559 fees; the max fee is used as a legacy gas price")
+			}
+		}
+		for _, suggestion := range fees.Suggestions {
+			fmt.Printf("  %-9s (p%s)  max fee %s gwei, priority fee %s gwei\n", suggestion.Preset, suggestion.Percentile,
+				core.FormatTokenAmount(suggestion.MaxFeePerGas, 9), core.FormatTokenAmount(suggestion.MaxPriorityFeePerGas, 9))
+		}
+		return nil
+	},
+}
+
+// addGasOracleFlags registers the flags configuring the gas oracle
+func addGasOracleFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&feeHistoryBlocks, "fee-blocks", tx.DefaultFeeHistoryBlocks, "Number of recent blocks sampled for fee suggestions")
+	cmd.Flags().StringSliceVar(&gasPercentiles, "percentiles", []string{"10", "50", "90"}, "Priority fee percentiles of the slow, standard and fast presets")
+	cmd.Flags().StringVar(&baseFeeMultiplier, "base-fee-multiplier", tx.DefaultBaseFeeMultiplier, "Multiple of the next base fee covered by maxFeePerGas, e.g. 1.5")
+}
+
+// gasOracleConfig builds the gas oracle configuration from the flags
+func gasOracleConfig() (*tx.GasOracleConfig, error) {
+	if len(gasPercentiles) != len(tx.GasPresets) {
+		return nil, fmt.Errorf("--percentiles needs %d values (slow, standard, fast), got %d", len(tx.GasPresets), len(gasPercentiles))
+	}
+
+	config := tx.DefaultGasOracleConfig()
+	config.Blocks = feeHistoryBlocks
+
+	var err error
+	if config.BaseFeeMultiplier, err = core.ParseDecimal(baseFeeMultiplier); err != nil {
+		return nil, fmt.Errorf("invalid --base-fee-multiplier: %v", err)
+	}
+	for i, preset := range tx.GasPresets {
+		if config.Percentiles[preset], err = core.ParseDecimal(gasPercentiles[i]); err != nil {
+			return nil, fmt.Errorf("invalid --percentiles: %v", err)
+		}
+	}
+	return config, config.Validate()
+}
+
+// suggestFees queries the chain's fee history for suggestions
+func suggestFees(chain *core.ChainConfig) (*tx.FeeSuggestions, error) {
+	config, err := gasOracleConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	defer simulator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return simulator.SuggestFees(ctx, config)
+}
+
+// applyGasPreset sets the fees of a transaction to the --gas-preset suggestion.
+// Chains without a base fee or EIP-1559 support get a legacy gas price.
+func applyGasPreset(chain *core.ChainConfig, transaction *core.Transaction) error {
+	fees, err := suggestFees(chain)
+	if err != nil {
+		return err
+	}
+	suggestion, err := fees.Preset(gasPreset)
+	if err != nil {
+		return err
+	}
+	explain("fees", "preset %s: priority fee %s gwei is the median p%s reward of %d blocks from block %s (eth_feeHistory at %s)",
+		gasPreset, core.FormatTokenAmount(suggestion.MaxPriorityFeePerGas, 9), suggestion.Percentile, fees.Blocks, fees.OldestBlock, endpointName(chain.RPCURL))
+
+	if fees.Legacy() || !chain.DynamicFees() {
+		transaction.GasPrice = suggestion.MaxFeePerGas
+		transaction.MaxFeePerGas, transaction.MaxPriorityFeePerGas = nil, nil
+		if fees.Legacy() {
+			explain("fees", "chain has no base fee, so the gas price is the priority fee alone")
+		} else {
+			explain("fees", "%s does not support EIP-1559 fees, so the gas price is the max fee of the preset", chain.Name)
+		}
+		fmt.Printf("Gas preset %s: gas price %s gwei\n", gasPreset, core.FormatTokenAmount(suggestion.MaxFeePerGas, 9))
+		return nil
+	}
+
+	transaction.GasPrice = nil
+	transaction.MaxFeePerGas = suggestion.MaxFeePerGas
+	transaction.MaxPriorityFeePerGas = suggestion.MaxPriorityFeePerGas
+	explain("fees", "max fee %s gwei = next base fee %s gwei x %s (rounded up) + priority fee",
+		core.FormatTokenAmount(suggestion.MaxFeePerGas, 9), core.FormatTokenAmount(fees.BaseFee, 9), baseFeeMultiplier)
+	fmt.Printf("Gas preset %s: max fee %s gwei, priority fee %s gwei\n", gasPreset,
+		core.FormatTokenAmount(suggestion.MaxFeePerGas, 9), core.FormatTokenAmount(suggestion.MaxPriorityFeePerGas, 9))
+	return nil
+}
+
+func init() {
+	// Add flags
+	txGasSuggestCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	addGasOracleFlags(txGasSuggestCmd)
+
+	// Add commands
+	txGasCmd.AddCommand(txGasSuggestCmd)
+	TxCmd.AddCommand(txGasCmd)
+}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hwDevice       int
+	hwKind         string
+	hwPath         string
+	hwAccountIndex uint32
+	hwAccounts     uint32
+
+	hwCount         uint32
+	hwStart         uint32
+	hwTemplate      string
+	hwBalanceChains []string
+	hwVerify        []uint
+	hwSave          []uint
+	hwSaveLabel     string
+)
+
+// HardwareCmd is the root command for hardware wallet operations
+var HardwareCmd = &cobra.Command{
+	Use:   "hardware",
+	Short: "Manage hardware wallets",
+	Long:  `Inspect connected Ledger and Trezor hardware wallets.`,
+}
+
+var hardwareListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List connected hardware wallets and accounts",
+	Long:  `List connected hardware wallets and the first accounts on the default derivation path of each.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wallets, err := core.ListHardwareWallets()
+		if err != nil {
+			return err
+		}
+
+		if len(wallets) == 0 {
+			fmt.Println("No hardware wallets found")
+			return nil
+		}
+
+		for i, wallet := range wallets {
+			fmt.Printf("[%d] %s\n", i, wallet.URL())
+
+			if err := wallet.Open(""); err != nil {
+				fmt.Printf("    failed to open: %v\n", err)
+				continue
+			}
+
+			status, _ := wallet.Status()
+			fmt.Printf("    status: %s\n", status)
+			fmt.Printf("    signs: %s\n", formatCapabilities(core.DeviceCapabilities(wallet.URL().Scheme)))
+
+			for index := uint32(0); index < hwAccounts; index++ {
+				path := core.AccountDerivationPath(index)
+				account, err := wallet.Derive(path, false)
+				if err != nil {
+					fmt.Printf("    %s: failed to derive: %v\n", path, err)
+					break
+				}
+				fmt.Printf("    [%d] %s %s\n", index, path, account.Address.Hex())
+			}
+
+			wallet.Close()
+		}
+		return nil
+	},
+}
+
+var hardwareAccountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "Derive many accounts of a hardware wallet to find where funds are",
+	Long: `Derive --count accounts of a hardware wallet on a path template and list their addresses, so
+you can find the derivation your funds live on when wallets disagree. The x component of the
+template is the account index. --path-template also takes the name of a derivation preset
+(see 'keys hd presets list'):
+
+  metamask, trezor   m/44'/60'/0'/0/x   MetaMask, Trezor Suite and most wallets (default)
+  ledger-live        m/44'/60'/x'/0/0   Ledger Live
+  legacy-mew         m/44'/60'/0'/x     MyEtherWallet and the Ledger Chrome app before Ledger Live
+
+--chain looks up the balance and transaction count of every account on those chains.
+--verify has the device sign a check message for the listed account indexes; the signature,
+confirmed on the device, proves the device holds the key of each address at its path. Nothing
+is sent on-chain. --save stores the listed indexes as watch-only address book entries labeled
+--label-<index>, tied to the device and path.`,
+	Example: `  # Ledger Live accounts 0-19 with their balances on two chains
+  gosignervaultcli hardware accounts --count 20 --path-template ledger-live --chain ethereum --chain polygon
+
+  # Confirm account 3 on the device and keep it as a watch-only address book entry
+  gosignervaultcli hardware accounts --path-template "m/44'/60'/x'/0/0" --verify 3 --save 3 --label ledger-live`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		template, err := core.ResolvePathTemplate(hwTemplate)
+		if err != nil {
+			return err
+		}
+		opts := core.DefaultHardwareOptions()
+		opts.Kind = hwKind
+		opts.Device = hwDevice
+		hw, err := core.NewHardwareWallet(opts)
+		if err != nil {
+			return err
+		}
+		defer hw.Close()
+
+		if len(hwVerify) > 0 && !hw.Supports(core.CapTypedData) {
+			return fmt.Errorf("--verify needs typed data signing, which a %s device does not support", hw.Kind())
+		}
+		derived, err := hw.DeriveAccounts(template, hwStart, hwCount)
+		if err != nil {
+			return err
+		}
+		rows := make([]*derivedAccountRow, len(derived))
+		byIndex := make(map[uint]*derivedAccountRow)
+		for i := range derived {
+			rows[i] = &derivedAccountRow{DerivedAccount: derived[i]}
+			byIndex[uint(derived[i].Index)] = rows[i]
+		}
+		for _, index := range append(append([]uint{}, hwVerify...), hwSave...) {
+			if byIndex[index] == nil {
+				return fmt.Errorf("account index %d is not among the listed accounts %d-%d", index, hwStart, hwStart+hwCount-1)
+			}
+		}
+
+		// Query each chain, reporting failures without hiding the other chains
+		chains := make([]*core.ChainConfig, 0, len(hwBalanceChains))
+		var failed []string
+		for _, name := range hwBalanceChains {
+			chain, err := core.GetChainConfig(name)
+			if err != nil {
+				return fmt.Errorf("failed to get chain config: %v", err)
+			}
+			if err := fetchDerivedBalances(chain, rows); err != nil {
+				fmt.Printf("%s: %v\n", name, err)
+				failed = append(failed, name)
+				continue
+			}
+			chains = append(chains, chain)
+		}
+
+		fmt.Printf("Accounts of %s on %s\n", hw.URL(), template)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "INDEX\tPATH\tADDRESS"
+		for _, chain := range chains {
+			header += "\t" + strings.ToUpper(chain.Name)
+		}
+		fmt.Fprintln(w, header)
+		for _, row := range rows {
+			line := fmt.Sprintf("%d\t%s\t%s", row.Index, row.Path, row.Address.Hex())
+			for _, chain := range chains {
+				snapshot := row.Balances[chain.Name]
+				line += "\t" + formatNative(chain, snapshot.Balance)
+				if snapshot.Nonce > 0 {
+					line += fmt.Sprintf(" (%d txs)", snapshot.Nonce)
+				}
+			}
+			fmt.Fprintln(w, line)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, index := range hwVerify {
+			row := byIndex[index]
+			fmt.Printf("Confirm the account check of %s at %s on the device\n", row.Address.Hex(), row.Path)
+			if err := hw.VerifyAccount(row.DerivedAccount); err != nil {
+				return fmt.Errorf("failed to verify account %d: %v", index, err)
+			}
+			row.Verified = true
+			fmt.Printf("Verified: the device holds the key of %s at %s\n", row.Address.Hex(), row.Path)
+		}
+
+		if len(hwSave) > 0 {
+			if err := saveDerivedAccounts(hw, byIndex); err != nil {
+				return err
+			}
+		}
+
+		output.Result(rows)
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to query %d of %d chains: %v", len(failed), len(hwBalanceChains), failed)
+		}
+		return nil
+	},
+}
+
+// derivedAccountRow is an account listed by 'hardware accounts'
+type derivedAccountRow struct {
+	core.DerivedAccount
+	Balances map[string]*tx.AccountSnapshot `json:"balances,omitempty"`
+	Verified bool                           `json:"verified,omitempty"`
+	Label    string                         `json:"label,omitempty"`
+}
+
+// fetchDerivedBalances looks up the balances of the listed accounts on a chain
+func fetchDerivedBalances(chain *core.ChainConfig, rows []*derivedAccountRow) error {
+	addresses := make([]common.Address, len(rows))
+	for i, row := range rows {
+		addresses[i] = row.Address
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	snapshots, err := tx.FetchBalances(ctx, chain.RPCURL, addresses)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if row.Balances == nil {
+			row.Balances = make(map[string]*tx.AccountSnapshot)
+		}
+		row.Balances[chain.Name] = &snapshots[i]
+	}
+	return nil
+}
+
+// saveDerivedAccounts adds the accounts of --save to the address book as
+// watch-only entries of the device
+func saveDerivedAccounts(hw *core.HardwareWallet, byIndex map[uint]*derivedAccountRow) error {
+	book, err := openAddressBookForEdit()
+	if err != nil {
+		return err
+	}
+	fingerprint, err := hw.Fingerprint()
+	if err != nil {
+		return err
+	}
+	for _, index := range hwSave {
+		row := byIndex[index]
+		if existing, ok := book.Lookup(row.Address); ok {
+			fmt.Printf("%s is already labeled %q\n", row.Address.Hex(), existing.Label)
+			continue
+		}
+		entry := &addressbook.Entry{
+			Label:   fmt.Sprintf("%s-%d", hwSaveLabel, index),
+			Address: row.Address,
+			Kind:    addressbook.KindWatch,
+			Device: &addressbook.Device{
+				Kind:        hw.Kind(),
+				Fingerprint: fingerprint,
+				Path:        row.Path.String(),
+			},
+		}
+		if err := book.Add(entry); err != nil {
+			return err
+		}
+		row.Label = entry.Label
+		fmt.Printf("Saved %s as %q\n", row.Address.Hex(), entry.Label)
+	}
+	return book.Save()
+}
+
+// openHardwareWallet opens the device and account selected by --device,
+// --derivation-path and --account-index
+func openHardwareWallet(cmd *cobra.Command) (*core.HardwareWallet, error) {
+	opts := core.DefaultHardwareOptions()
+	opts.Kind = hwKind
+	opts.Device = hwDevice
+	opts.Path = core.AccountDerivationPath(hwAccountIndex)
+
+	if hwPath != "" {
+		if cmd.Flags().Changed("account-index") {
+			return nil, fmt.Errorf("--derivation-path and --account-index are mutually exclusive")
+		}
+		path, err := accounts.ParseDerivationPath(hwPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path: %v", err)
+		}
+		opts.Path = path
+	}
+
+	hw, err := core.NewHardwareWallet(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Using hardware wallet %s at %s\n", hw.URL(), hw.Path())
+	return hw, nil
+}
+
+func init() {
+	// Add flags
+	hardwareListCmd.Flags().Uint32Var(&hwAccounts, "accounts", 5, "Number of accounts to show per device")
+	hardwareAccountsCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	hardwareAccountsCmd.Flags().Uint32Var(&hwCount, "count", 10, "Number of accounts to derive")
+	hardwareAccountsCmd.Flags().Uint32Var(&hwStart, "start", 0, "First account index")
+	hardwareAccountsCmd.Flags().StringVar(&hwTemplate, "path-template", core.DefaultPathTemplate, "Derivation path with x in place of the account index, or a derivation preset name")
+	hardwareAccountsCmd.Flags().StringSliceVar(&hwBalanceChains, "chain", nil, "Look up balances on this chain (repeatable)")
+	hardwareAccountsCmd.Flags().UintSliceVar(&hwVerify, "verify", nil, "Account indexes to verify with a signature confirmed on the device")
+	hardwareAccountsCmd.Flags().UintSliceVar(&hwSave, "save", nil, "Account indexes to save as watch-only address book entries")
+	hardwareAccountsCmd.Flags().StringVar(&hwSaveLabel, "label", "hardware", "Label prefix of saved accounts")
+	hardwareAccountsCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	addAddressBookFlags(hardwareAccountsCmd)
+
+	// Add commands
+	HardwareCmd.AddCommand(hardwareListCmd)
+	HardwareCmd.AddCommand(hardwareAccountsCmd)
+}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hdPassphrase  bool
+	hdGap         uint32
+	hdTemplate    string
+	hdStart       uint32
+	hdCount       uint32
+	hdDescription string
+)
+
+// Outcomes of re-deriving a key
+const (
+	hdMatch       = "match"
+	hdMismatch    = "mismatch"
+	hdInvalidPath = "invalid-path"
+)
+
+// hdAuditResult is the outcome of re-deriving a key from the seed
+type hdAuditResult struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Address string `json:"address"`
+	Derived string `json:"derived,omitempty"`
+	Status  string `json:"status"`
+	// Found is a path of the seed that does derive the stored address
+	Found  string `json:"found,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var keysHDCmd = &cobra.Command{
+	Use:   "hd",
+	Short: "Check keys derived from a recovery phrase",
+}
+
+var keysHDAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Re-derive HD keys from the recovery phrase and check their addresses",
+	Long: `Re-derive every key of the file keystore that records a derivation path (set with
+'keys tag --derivation-path') from the recovery phrase, and check that the path derives the
+stored address. A key whose recorded path is mislabeled or whose address was corrupted
+cannot be reproduced from the seed, so funds sent to it would depend on the key file alone.
+
+The derivation paths are part of the encrypted key metadata and need the metadata password.
+The recovery phrase is read from a hidden prompt or stdin; --passphrase also asks for the
+BIP-39 passphrase. No key file is decrypted. When a key does not match, the first --gap
+accounts of every derivation preset are searched for its address and the path that derives
+it is reported. The command fails if any key does not match.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+		if _, err := requireMetaPassword(); err != nil {
+			return fmt.Errorf("the derivation paths are in the key metadata: %v", err)
+		}
+		infos, err := listKeyInfos(manager, nil)
+		if err != nil {
+			return err
+		}
+		var derivedKeys []*keyInfo
+		for _, info := range infos {
+			if info.KeyProfile != nil && info.DerivationPath != "" {
+				derivedKeys = append(derivedKeys, info)
+			}
+		}
+		if len(derivedKeys) == 0 {
+			return fmt.Errorf("no key records a derivation path; set it with 'keys tag --derivation-path'")
+		}
+
+		seed, err := readHDSeed()
+		if err != nil {
+			return err
+		}
+		defer seed.Wipe()
+		presets, err := core.DerivationPresets()
+		if err != nil {
+			return err
+		}
+
+		results := make([]*hdAuditResult, len(derivedKeys))
+		failed := 0
+		for i, info := range derivedKeys {
+			results[i] = auditHDKey(seed, info, presets)
+			if results[i].Status != hdMatch {
+				failed++
+			}
+		}
+		output.Result(results)
+
+		for _, result := range results {
+			fmt.Printf("- %-16s %-22s %s  %s\n", result.Name, result.Path, result.Address, result.Status)
+			if result.Derived != "" && result.Status != hdMatch {
+				fmt.Printf("    path derives %s\n", result.Derived)
+			}
+			if result.Found != "" {
+				fmt.Printf("    stored address is derived by %s\n", result.Found)
+			}
+			if result.Detail != "" {
+				fmt.Printf("    %s\n", result.Detail)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d HD keys cannot be reproduced from the seed at their recorded path", failed, len(results))
+		}
+		fmt.Printf("All %d HD keys match the seed\n", len(results))
+		return nil
+	},
+}
+
+var keysHDAccountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "List the accounts a recovery phrase derives on a path",
+	Long: `Derive --count accounts of a recovery phrase on a path template or derivation preset and list
+their addresses, to find the path an imported wallet used. Nothing is stored and no key
+leaves memory.`,
+	Example: `  # The first 10 Ledger Live accounts of a phrase
+  gosignervaultcli keys hd accounts --path-template ledger-live`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		template, err := core.ResolvePathTemplate(hdTemplate)
+		if err != nil {
+			return err
+		}
+		seed, err := readHDSeed()
+		if err != nil {
+			return err
+		}
+		defer seed.Wipe()
+
+		var derived []core.DerivedAccount
+		for index := hdStart; index < hdStart+hdCount; index++ {
+			path, err := core.PathFromTemplate(template, index)
+			if err != nil {
+				return err
+			}
+			address, err := deriveHDAddress(seed, path)
+			if err != nil {
+				return err
+			}
+			derived = append(derived, core.DerivedAccount{Index: index, Path: path, Address: address})
+		}
+		output.Result(derived)
+
+		fmt.Printf("Accounts on %s\n", template)
+		for _, account := range derived {
+			fmt.Printf("%4d  %-22s %s\n", account.Index, account.Path, account.Address.Hex())
+		}
+		return nil
+	},
+}
+
+var keysHDPresetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "Manage the derivation presets of wallets",
+	Long: `Derivation presets name the account path templates of wallets, so 'keys hd accounts' and
+'hardware accounts' take --path-template ledger-live instead of the path. metamask, trezor,
+ledger-live and legacy-mew are built in; add the paths of other wallets as your own presets.`,
+}
+
+var keysHDPresetsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the derivation presets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		presets, err := core.DerivationPresets()
+		if err != nil {
+			return err
+		}
+		output.Result(presets)
+		for _, preset := range presets {
+			origin := "user"
+			if preset.Builtin {
+				origin = "built-in"
+			}
+			fmt.Printf("- %-14s %-20s %-9s %s\n", preset.Name, preset.Template, origin, preset.Description)
+		}
+		return nil
+	},
+}
+
+var keysHDPresetsAddCmd = &cobra.Command{
+	Use:     "add NAME TEMPLATE",
+	Short:   "Add a derivation preset",
+	Args:    cobra.ExactArgs(2),
+	Example: `  gosignervaultcli keys hd presets add coinbase-wallet "m/44'/60'/0'/0/x" --description "Coinbase Wallet"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := core.AddDerivationPreset(args[0], args[1], hdDescription); err != nil {
+			return err
+		}
+		fmt.Printf("Added preset %s: %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var keysHDPresetsRemoveCmd = &cobra.Command{
+	Use:   "remove NAME",
+	Short: "Remove a derivation preset",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := core.RemoveDerivationPreset(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed preset %s\n", args[0])
+		return nil
+	},
+}
+
+// readHDSeed reads the recovery phrase, and the BIP-39 passphrase with
+// --passphrase, from hidden prompts or stdin
+func readHDSeed() (*core.HDSeed, error) {
+	mnemonic, err := promptSecret("Recovery phrase")
+	if err != nil {
+		return nil, err
+	}
+	passphrase := ""
+	if hdPassphrase {
+		if passphrase, err = promptSecret("BIP-39 passphrase"); err != nil {
+			return nil, err
+		}
+	}
+	return core.NewHDSeed(mnemonic, passphrase)
+}
+
+// auditHDKey re-derives a key at its recorded path and compares the address.
+// A mismatched key is looked for on the account paths of the presets.
+func auditHDKey(seed *core.HDSeed, info *keyInfo, presets []core.DerivationPreset) *hdAuditResult {
+	result := &hdAuditResult{Name: info.Name, Path: info.DerivationPath, Address: info.Address}
+	stored := common.HexToAddress(info.Address)
+
+	path, err := accounts.ParseDerivationPath(info.DerivationPath)
+	if err != nil {
+		result.Status, result.Detail = hdInvalidPath, err.Error()
+	} else {
+		derived, err := deriveHDAddress(seed, path)
+		if err != nil {
+			result.Status, result.Detail = hdInvalidPath, err.Error()
+		} else {
+			result.Derived = derived.Hex()
+			result.Status = hdMismatch
+			if derived == stored {
+				result.Status = hdMatch
+				return result
+			}
+		}
+	}
+
+	// Look for the path the key really came from
+	searched := make(map[string]bool)
+	var names []string
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+		if searched[preset.Template] {
+			continue
+		}
+		searched[preset.Template] = true
+		for index := uint32(0); index < hdGap; index++ {
+			candidate, err := core.PathFromTemplate(preset.Template, index)
+			if err != nil {
+				break
+			}
+			if derived, err := deriveHDAddress(seed, candidate); err == nil && derived == stored {
+				result.Found = fmt.Sprintf("%s (%s)", candidate, preset.Name)
+				return result
+			}
+		}
+	}
+	if result.Status == hdMismatch {
+		result.Detail = fmt.Sprintf("the address is not among the first %d accounts of the presets %s", hdGap, strings.Join(names, ", "))
+	}
+	return result
+}
+
+// deriveHDAddress derives the address at a path, wiping the key
+func deriveHDAddress(seed *core.HDSeed, path accounts.DerivationPath) (common.Address, error) {
+	privateKey, err := seed.DeriveKey(path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer securemem.WipeKey(privateKey)
+	return crypto.PubkeyToAddress(privateKey.PublicKey), nil
+}
+
+func init() {
+	// Add flags
+	keysHDAuditCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+	keysHDAuditCmd.Flags().BoolVar(&hdPassphrase, "passphrase", false, "Ask for the BIP-39 passphrase of the recovery phrase")
+	keysHDAuditCmd.Flags().Uint32Var(&hdGap, "gap", 20, "Accounts per derivation preset searched for the address of a mismatched key")
+	keysHDAccountsCmd.Flags().BoolVar(&hdPassphrase, "passphrase", false, "Ask for the BIP-39 passphrase of the recovery phrase")
+	keysHDAccountsCmd.Flags().StringVar(&hdTemplate, "path-template", core.DefaultPathTemplate, "Derivation path with x in place of the account index, or a derivation preset name")
+	keysHDAccountsCmd.Flags().Uint32Var(&hdStart, "start", 0, "First account index")
+	keysHDAccountsCmd.Flags().Uint32Var(&hdCount, "count", 10, "Number of accounts to derive")
+	keysHDPresetsAddCmd.Flags().StringVar(&hdDescription, "description", "", "Wallets using the path")
+
+	// Add commands
+	keysHDCmd.AddCommand(keysHDAuditCmd)
+	keysHDCmd.AddCommand(keysHDAccountsCmd)
+	keysHDCmd.AddCommand(keysHDPresetsCmd)
+	keysHDPresetsCmd.AddCommand(keysHDPresetsListCmd)
+	keysHDPresetsCmd.AddCommand(keysHDPresetsAddCmd)
+	keysHDPresetsCmd.AddCommand(keysHDPresetsRemoveCmd)
+	KeysCmd.AddCommand(keysHDCmd)
+}
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyPassword string
+	historySince    string
+	historyUntil    string
+	historyAddress  string
+	historyChain    string
+	historyStatus   string
+	historyPage     int
+	historyPageSize int
+	historyFormat   string
+	ledgerMapping   string
+	historyRedact   bool
+	redactSaltFile  string
+)
+
+var txHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Query and export the transaction history",
+	Long:  `List and export locally recorded transactions, filtered by date range, address, chain and status.`,
+}
+
+var txHistoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded transactions",
+	Long:  `List recorded transactions matching the filters, newest first, one page at a time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if historyPage < 1 || historyPageSize < 1 {
+			return fmt.Errorf("--page and --page-size must be positive")
+		}
+
+		filter, err := historyFilter()
+		if err != nil {
+			return err
+		}
+		filter.Offset = (historyPage - 1) * historyPageSize
+		filter.Limit = historyPageSize
+
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+
+		records := history.Query(filter)
+		if records == nil {
+			records = []*tx.TransactionRecord{}
+		}
+		output.Result(records)
+		if len(records) == 0 {
+			fmt.Println("No transactions found")
+			return nil
+		}
+
+		book, err := loadAddressBook()
+		if err != nil {
+			return err
+		}
+		label := func(address string) string {
+			if !common.IsHexAddress(address) {
+				return address
+			}
+			return labeled(book, common.HexToAddress(address))
+		}
+
+		for _, record := range records {
+			fmt.Printf("%s  chain %-6s %-10s %s\n", record.Timestamp.Format(time.RFC3339), record.ChainID, record.Status, record.Hash.Hex())
+			fmt.Printf("    %s -> %s, value %s wei\n", label(record.From), label(record.To), record.Value)
+			if record.Function != "" {
+				fmt.Printf("    calls %s\n", record.Function)
+			}
+		}
+		fmt.Printf("Page %d (%d transactions)\n", historyPage, len(records))
+		return nil
+	},
+}
+
+var txHistoryExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export recorded transactions for accounting",
+	Long: `Export all recorded transactions matching the filters as CSV or JSON, or
+export confirmed transactions, their fees and token transfers as Beancount or
+Ledger-CLI entries. A --mapping file assigns addresses to ledger accounts.
+
+With --redact the CSV or JSON export can be shared for support and debugging
+without revealing the accounts behind it: addresses and hashes are replaced by
+pseudonyms keyed with a local salt (the same address gets the same pseudonym in
+every export), values become ranges, gas amounts are rounded, times are cut to
+the hour, and calldata, block numbers and timelines are left out. Delete the
+--redact-salt file to start new pseudonyms that cannot be linked to earlier ones.
+
+--currency values each transaction in one or more fiat currencies at the price of the
+gas token on the day it was recorded, as accounting requires, rather than today's price.
+The CSV gains price, value and fee columns per currency, the JSON a fiat object per
+transaction, and Beancount and Ledger exports price directives for each day. Prices come
+from --price-source (coingecko by default, or file:PATH with daily prices by symbol, day
+and currency) and past days are cached in --price-cache, so a repeated export needs no
+network access. Transactions on testnets are not valued.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := historyFilter()
+		if err != nil {
+			return err
+		}
+
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+		records := history.Query(filter)
+
+		var redactor *tx.Redactor
+		if historyRedact {
+			if historyFormat != "csv" && historyFormat != "json" {
+				return fmt.Errorf("--redact supports the csv and json formats")
+			}
+			if len(fiatCurrencies) > 0 {
+				return fmt.Errorf("--currency would reveal the values --redact turns into ranges")
+			}
+			salt, err := tx.LoadRedactionSalt(redactSaltFile)
+			if err != nil {
+				return err
+			}
+			redactor = tx.NewRedactor(salt)
+		}
+		values, err := fiatValues(cmd.Context(), records)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if outputFile != "" {
+			f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %v", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch {
+		case redactor != nil && historyFormat == "csv":
+			err = tx.WriteRedactedCSV(w, redactor.Redact(records))
+		case redactor != nil:
+			err = tx.WriteRedactedJSON(w, redactor.Redact(records))
+		case historyFormat == "csv":
+			err = tx.WriteHistoryCSV(w, records, values)
+		case historyFormat == "json":
+			err = tx.WriteHistoryJSON(w, records, values)
+		case historyFormat == "beancount" || historyFormat == "ledger":
+			err = writeLedgerExport(w, records, values)
+		default:
+			return fmt.Errorf("unknown format %q (expected csv, json, beancount or ledger)", historyFormat)
+		}
+		if err != nil {
+			return err
+		}
+
+		if outputFile != "" {
+			fmt.Printf("Exported %d transactions to: %s\n", len(records), outputFile)
+		}
+		return nil
+	},
+}
+
+var txHistorySyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Update pending transactions from their receipts",
+	Long: `Look up the receipts of the recorded transactions on --chain that are not final yet
+(such as signed or pending) and record the block, gas used and outcome of those that were
+mined. The sync runs as a job: an interrupted sync keeps the records it updated and can be
+resumed with 'jobs retry'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if historyChain == "" {
+			return fmt.Errorf("--chain is required to sync the history")
+		}
+		chain, err := core.GetChainConfig(historyChain)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+
+		job := newJob(cmd, args, "history-sync", fmt.Sprintf("Sync the history of %s", chain.Name))
+		return runJob(cmd.Context(), job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+			updated, err := history.Sync(ctx, chain.RPCURL, chain.ChainID.String(), func(done, total int, detail string) {
+				if detail != "" {
+					fmt.Printf("  %s\n", detail)
+				}
+				progress(done, total, detail)
+			})
+			if err != nil {
+				return "", err
+			}
+			fmt.Printf("Updated %d transactions on %s\n", updated, chain.Name)
+			return fmt.Sprintf("%d transactions updated on %s", updated, chain.Name), nil
+		})
+	},
+}
+
+// writeLedgerExport writes records as Beancount or Ledger-CLI entries
+func writeLedgerExport(w io.Writer, records []*tx.TransactionRecord, values *tx.FiatValues) error {
+	mapping := tx.DefaultLedgerMapping()
+	if ledgerMapping != "" {
+		var err error
+		if mapping, err = tx.LoadLedgerMapping(ledgerMapping); err != nil {
+			return err
+		}
+	}
+
+	entries, err := tx.BuildLedgerEntries(records, mapping)
+	if err != nil {
+		return fmt.Errorf("failed to build ledger entries: %v", err)
+	}
+
+	if historyFormat == "beancount" {
+		return tx.WriteBeancount(w, entries, values)
+	}
+	return tx.WriteLedger(w, entries, values)
+}
+
+// openHistory opens --history, decrypting it with --history-password if given
+func openHistory() (*tx.History, error) {
+	if historyPassword != "" {
+		return tx.OpenEncryptedHistory(historyFile, historyPassword)
+	}
+	return tx.OpenHistory(historyFile)
+}
+
+// historyFilter builds a history filter from the history command flags
+func historyFilter() (tx.HistoryFilter, error) {
+	var filter tx.HistoryFilter
+	var err error
+
+	if historySince != "" {
+		if filter.Since, err = parseDate(historySince); err != nil {
+			return filter, fmt.Errorf("invalid --since: %v", err)
+		}
+	}
+	if historyUntil != "" {
+		if filter.Until, err = parseDate(historyUntil); err != nil {
+			return filter, fmt.Errorf("invalid --until: %v", err)
+		}
+	}
+	if historyChain != "" {
+		chain, err := core.GetChainConfig(historyChain)
+		if err != nil {
+			return filter, fmt.Errorf("failed to get chain config: %v", err)
+		}
+		filter.ChainID = chain.ChainID.String()
+	}
+	filter.Address = historyAddress
+	filter.Status = historyStatus
+
+	return filter, nil
+}
+
+// parseDate parses an RFC 3339 time or a date such as 2024-01-31 (UTC midnight)
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func init() {
+	// Add flags
+	txHistoryCmd.PersistentFlags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	txHistoryCmd.PersistentFlags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	txHistoryCmd.PersistentFlags().StringVar(&historySince, "since", "", "Only transactions at or after this date (2006-01-02 or RFC 3339)")
+	txHistoryCmd.PersistentFlags().StringVar(&historyUntil, "until", "", "Only transactions before this date (2006-01-02 or RFC 3339)")
+	txHistoryCmd.PersistentFlags().StringVar(&historyAddress, "address", "", "Only transactions from or to this address")
+	txHistoryCmd.PersistentFlags().StringVar(&historyChain, "chain", "", "Only transactions on this chain")
+	addAddressBookFlags(txHistoryCmd)
+	txHistoryCmd.PersistentFlags().StringVar(&historyStatus, "status", "", "Only transactions with this status (e.g. signed, success, failed)")
+
+	txHistoryListCmd.Flags().IntVar(&historyPage, "page", 1, "Page to show")
+	txHistoryListCmd.Flags().IntVar(&historyPageSize, "page-size", 20, "Transactions per page")
+
+	txHistoryExportCmd.Flags().StringVar(&historyFormat, "format", "csv", "Export format (csv, json, beancount or ledger)")
+	txHistoryExportCmd.Flags().StringVar(&ledgerMapping, "mapping", "", "JSON file mapping addresses, commodities and tokens to ledger accounts")
+	txHistoryExportCmd.Flags().StringVar(&outputFile, "output", "", "Output file (prints to stdout if empty)")
+	txHistoryExportCmd.Flags().BoolVar(&historyRedact, "redact", false, "Pseudonymize addresses and hashes, turn values into ranges and strip calldata for sharing")
+	txHistoryExportCmd.Flags().StringVar(&redactSaltFile, "redact-salt", tx.DefaultRedactionSaltFile, "Local salt of the pseudonyms (created on first use)")
+	addFiatFlags(txHistoryExportCmd)
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(txHistoryListCmd)
+
+	// Add commands
+	txHistoryCmd.AddCommand(txHistoryListCmd)
+	txHistoryCmd.AddCommand(txHistoryExportCmd)
+	txHistoryCmd.AddCommand(txHistorySyncCmd)
+	TxCmd.AddCommand(txHistoryCmd)
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/spf13/cobra"
+)
+
+// InitCmd is the guided first-run setup
+var InitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up the keystore, first key, chains and backup interactively",
+	Long: `Walk through a first-run setup: choose where the keystore lives (the standard location
+or a portable vault), create or import the first key and pick its key derivation strength,
+select the chains you use and their RPC providers, and write the first encrypted backup.
+Every step uses the same files as the individual commands, so the result can be changed
+later with 'keys', 'chains' and 'portable'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Println("GoSignerVaultCLI setup. Press Enter to accept the default in brackets.")
+
+		// 1. Keystore location
+		fmt.Println("\n1. Keystore location")
+		if err := initKeystoreLocation(cmd); err != nil {
+			return err
+		}
+		manager, err := keystore.NewManager(keystoreDir)
+		if err != nil {
+			return fmt.Errorf("failed to create keystore manager: %v", err)
+		}
+		fmt.Printf("Keys are stored in %s\n", keystoreDir)
+
+		// 2. First key
+		fmt.Println("\n2. First key")
+		name, address, err := initKey(manager)
+		if err != nil {
+			return err
+		}
+
+		// 3. Chains and RPC providers
+		fmt.Println("\n3. Chains and RPC providers")
+		chains, err := initChains()
+		if err != nil {
+			return err
+		}
+
+		// 4. Backup
+		fmt.Println("\n4. Backup")
+		backup, err := initBackup()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("\nSetup complete")
+		fmt.Printf("  Key:       %s (%s)\n", name, address)
+		fmt.Printf("  Keystore:  %s\n", keystoreDir)
+		fmt.Printf("  Chains:    %s (%s)\n", strings.Join(chains, ", "), core.UserChainsFile)
+		if backup != "" {
+			fmt.Printf("  Backup:    %s\n", backup)
+		}
+		if root := paths.PortableRoot(); root != "" {
+			fmt.Printf("Run commands with --portable %s, or copy the executable into it.\n", root)
+		}
+		fmt.Printf("Check the account with: account info --name %s --chain %s\n", name, chains[0])
+		return nil
+	},
+}
+
+// initKeystoreLocation switches to a portable vault if the user asks for one
+func initKeystoreLocation(cmd *cobra.Command) error {
+	if root := paths.PortableRoot(); root != "" {
+		fmt.Printf("Using the portable vault %s\n", root)
+		return nil
+	}
+	if cmd.Flags().Changed("keystore") {
+		return nil
+	}
+
+	fmt.Printf("  standard  %s\n", keystoreDir)
+	fmt.Println("  portable  a portable vault directory, e.g. on an encrypted USB stick")
+	for {
+		choice, err := prompt("Keystore location", "standard")
+		if err != nil {
+			return err
+		}
+		switch choice {
+		case "standard":
+			return nil
+		case "portable":
+		default:
+			fmt.Println("Answer standard or portable")
+			continue
+		}
+
+		dir, err := prompt("Vault directory", "")
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, paths.ManifestFile)); os.IsNotExist(err) {
+			if err := paths.InitPortable(dir); err != nil {
+				return err
+			}
+			fmt.Printf("Created portable vault in %s\n", dir)
+		}
+		return ConfigurePortable(cmd, dir)
+	}
+}
+
+// initKey creates or imports the first key of the file keystore
+func initKey(manager *keystore.Manager) (string, string, error) {
+	name, err := prompt("Key name", "default")
+	if err != nil {
+		return "", "", err
+	}
+	if manager.HasKey(name) {
+		return "", "", fmt.Errorf("key %s already exists; choose another name", name)
+	}
+
+	source, err := prompt("Create a new key or import an existing private key (new/import)", "new")
+	if err != nil {
+		return "", "", err
+	}
+	var wallet *core.Wallet
+	switch source {
+	case "new":
+		wallet, err = core.NewWallet()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate wallet: %v", err)
+		}
+	case "import":
+		privateKey, err := readPrivateKey()
+		if err != nil {
+			return "", "", err
+		}
+		wallet = core.NewWalletFromPrivateKey(privateKey)
+	default:
+		return "", "", fmt.Errorf("unknown answer %q (expected new or import)", source)
+	}
+	defer wallet.Wipe()
+
+	fmt.Println("  light     fast to unlock, for keys guarding little value")
+	fmt.Println("  standard  as strong as geth key files")
+	fmt.Println("  strong    several seconds to unlock, for cold storage")
+	answer, err := prompt("Key derivation strength", string(keystore.KDFStandard))
+	if err != nil {
+		return "", "", err
+	}
+	strength, err := keystore.ParseKDFStrength(answer)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := promptNewPassword("Key password")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := saveFileKey(manager, name, wallet.PrivateKey, password, strength); err != nil {
+		return "", "", err
+	}
+	address := wallet.GetAddress()
+	fmt.Printf("Saved key %s: %s\n", name, address)
+	return name, address, nil
+}
+
+// initChains asks for the chains in use and sets their RPC endpoints in the
+// user's chain config
+func initChains() ([]string, error) {
+	names, err := core.ChainNames()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Available chains: %s\n", strings.Join(names, ", "))
+	answer, err := prompt("Chains you use (comma separated)", "ethereum")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := core.LoadUserChains()
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, name := range strings.Split(answer, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		chain, err := core.GetChainConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, name)
+
+		fmt.Printf("%s uses %s. Enter a provider URL to replace it; API keys can be kept out of the\n", chain.Name, endpointName(chain.RPCURL))
+		fmt.Println("config with a reference such as https://eth-mainnet.example/v2/${env:RPC_KEY}.")
+		rpcURL, err := initRPC(name, chain)
+		if err != nil {
+			return nil, err
+		}
+		if rpcURL == "" {
+			continue
+		}
+		entry, ok := user[name]
+		if !ok {
+			// Built-in chains only store what differs from the default
+			entry = &core.ChainConfig{}
+			user[name] = entry
+		}
+		entry.RPCURL = rpcURL
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("select at least one chain")
+	}
+
+	if err := core.SaveChainConfig(core.UserChainsFile, user); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// initRPC asks for the RPC endpoint of a chain until one passes the chain ID
+// check or the user accepts it anyway. It returns "" to keep the current one.
+func initRPC(name string, chain *core.ChainConfig) (string, error) {
+	for {
+		rpcURL, err := prompt(fmt.Sprintf("RPC endpoint of %s", name), "keep")
+		if err != nil || rpcURL == "keep" {
+			return "", err
+		}
+		err = checkChainRPCs(chain.ChainID, []string{rpcURL})
+		if err == nil {
+			return rpcURL, nil
+		}
+
+		// An air-gapped machine cannot reach any endpoint
+		fmt.Printf("Warning: %v\n", err)
+		answer, err := prompt("Use it anyway (y/N)", "n")
+		if err != nil {
+			return "", err
+		}
+		if answer = strings.ToLower(answer); answer == "y" || answer == "yes" {
+			return rpcURL, nil
+		}
+	}
+}
+
+// initBackup writes the first encrypted backup of the keystore, returning its
+// path or "" if the user skipped it
+func initBackup() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	def := filepath.Join(home, fmt.Sprintf("gosignervault-backup-%s.zip", time.Now().Format("20060102")))
+	fmt.Println("Write the backup to media other than the disk holding the keystore, or enter skip.")
+	path, err := prompt("Backup file", def)
+	if err != nil {
+		return "", err
+	}
+	if path == "skip" {
+		fmt.Println("No backup written; create one later with 'keys backup'")
+		return "", nil
+	}
+
+	password, err := promptNewPassword("Backup password")
+	if err != nil {
+		return "", err
+	}
+	if err := keystore.CreateBackup(keystoreDir, path, password); err != nil {
+		return "", err
+	}
+	fmt.Printf("Backup written to %s; restore it with 'keys restore --input %s'\n", path, path)
+	return path, nil
+}
+
+func init() {
+	// Add flags
+	InitCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// EnvJob names the queued job a command runs instead of queuing a new one.
+// 'jobs retry' sets it for the command it starts.
+const EnvJob = "GOSIGNERVAULT_JOB"
+
+var jobState string
+
+// JobsCmd is the root command for long-running jobs
+var JobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "List, retry and cancel long-running jobs",
+	Long: `Batch signing, history syncs, backups and the scheduler and benchmarks of the signing
+daemon run as jobs of a persistent queue, so their progress and outcome outlive the process.
+A job whose process dies without finishing shows up as failed and can be retried.`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List jobs with their state and progress",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := tx.OpenJobs(tx.DefaultJobFile)
+		if err != nil {
+			return err
+		}
+		all, err := jobs.List()
+		if err != nil {
+			return err
+		}
+
+		listed := []*tx.Job{}
+		for _, job := range all {
+			if jobState == "" || job.State == jobState {
+				listed = append(listed, job)
+			}
+		}
+		output.Result(listed)
+		if len(listed) == 0 {
+			fmt.Println("No jobs found")
+			return nil
+		}
+
+		for _, job := range listed {
+			fmt.Printf("%s  %-14s %-10s %s  %s\n", job.ID, job.Kind, job.State, formatJobProgress(job), job.Description)
+			if job.Error != "" {
+				fmt.Printf("          error: %s\n", job.Error)
+			}
+		}
+		return nil
+	},
+}
+
+var jobsInspectCmd = &cobra.Command{
+	Use:   "inspect <id>",
+	Short: "Show a job and its log",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := tx.OpenJobs(tx.DefaultJobFile)
+		if err != nil {
+			return err
+		}
+		job, err := jobs.Get(args[0])
+		if err != nil {
+			return err
+		}
+		output.Result(job)
+
+		fmt.Printf("Job %s (%s)\n", job.ID, job.Kind)
+		fmt.Printf("  Description: %s\n", job.Description)
+		fmt.Printf("  State:       %s\n", job.State)
+		fmt.Printf("  Progress:    %s\n", formatJobProgress(job))
+		fmt.Printf("  Attempts:    %d\n", job.Attempts)
+		fmt.Printf("  Created:     %s\n", job.Created.Format(time.RFC3339))
+		if job.State == tx.JobRunning {
+			fmt.Printf("  Process:     %d, last heartbeat %s\n", job.PID, job.Heartbeat.Format(time.RFC3339))
+		}
+		if len(job.Command) > 0 {
+			fmt.Printf("  Command:     %s\n", strings.Join(job.Command, " "))
+		}
+		if job.Result != "" {
+			fmt.Printf("  Result:      %s\n", job.Result)
+		}
+		if job.Error != "" {
+			fmt.Printf("  Error:       %s\n", job.Error)
+		}
+		fmt.Println("  Log:")
+		for _, event := range job.Log {
+			fmt.Printf("    %s %s", event.Time.Format(time.RFC3339), event.Event)
+			if event.Detail != "" {
+				fmt.Printf(": %s", event.Detail)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry <id> [-- flags...]",
+	Short: "Run a failed or cancelled job again",
+	Long: `Run the command of a failed or cancelled job again as a new attempt of the same job.
+Passwords and other secrets given literally are not kept in the queue: pass them again after
+--, e.g. 'jobs retry 1a2b3c4d -- --password ...', or use the agent or secret references
+(env:NAME, file:PATH, ...), which are kept.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := tx.OpenJobs(tx.DefaultJobFile)
+		if err != nil {
+			return err
+		}
+		job, err := jobs.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if len(job.Command) == 0 {
+			return fmt.Errorf("job %s ran inside the signing daemon; restart 'serve' to run it again", job.ID)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate this executable: %v", err)
+		}
+		if job, err = jobs.Requeue(job.ID); err != nil {
+			return err
+		}
+
+		fmt.Printf("Retrying job %s: %s\n", job.ID, job.Description)
+		retry := exec.Command(exe, append(job.Command, args[1:]...)...)
+		retry.Env = append(os.Environ(), EnvJob+"="+job.ID)
+		retry.Stdin, retry.Stdout, retry.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := retry.Run(); err != nil {
+			// A command that failed before starting leaves the job queued
+			if queued, getErr := jobs.Get(job.ID); getErr == nil && queued.State == tx.JobQueued {
+				jobs.Cancel(job.ID)
+			}
+			return fmt.Errorf("job %s failed again: %v", job.ID, err)
+		}
+		return nil
+	},
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a queued or running job",
+	Long: `Cancel a job. A running job stops at its next heartbeat, within a few seconds; work
+it already finished, such as transactions it signed, is kept.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := tx.OpenJobs(tx.DefaultJobFile)
+		if err != nil {
+			return err
+		}
+		job, err := jobs.Cancel(args[0])
+		if err != nil {
+			return err
+		}
+		if job.State == tx.JobCancelled {
+			fmt.Printf("Cancelled job %s\n", job.ID)
+		} else {
+			fmt.Printf("Asked job %s (process %d) to stop\n", job.ID, job.PID)
+		}
+		return nil
+	},
+}
+
+// newJob describes a job run by a command, or the queued job named by
+// $GOSIGNERVAULT_JOB that 'jobs retry' started the command for
+func newJob(cmd *cobra.Command, args []string, kind, description string) *tx.Job {
+	return &tx.Job{
+		ID:          os.Getenv(EnvJob),
+		Kind:        kind,
+		Description: description,
+		Command:     jobCommand(cmd, args),
+	}
+}
+
+// runJob runs fn as a job of the queue, queuing it first unless it is
+// already queued for a retry
+func runJob(ctx context.Context, job *tx.Job, fn func(ctx context.Context, progress tx.JobProgress) (string, error)) error {
+	jobs, err := tx.OpenJobs(tx.DefaultJobFile)
+	if err != nil {
+		return err
+	}
+	if job.ID == "" {
+		if err := jobs.Add(job); err != nil {
+			return err
+		}
+	}
+	err = jobs.Run(ctx, job.ID, fn)
+	switch {
+	case errors.Is(err, tx.ErrJobCancelled):
+		fmt.Printf("Job %s was cancelled\n", job.ID)
+	case err != nil && len(job.Command) > 0:
+		fmt.Printf("Job %s failed; run it again with 'jobs retry %s'\n", job.ID, job.ID)
+	}
+	return err
+}
+
+// jobCommand returns the command line that runs a command again, leaving out
+// the literal values of secret flags
+func jobCommand(cmd *cobra.Command, args []string) []string {
+	command := strings.Fields(cmd.CommandPath())[1:]
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if secretFlag(f.Name) && !secrets.IsReference(f.Value.String()) {
+			return
+		}
+		if values, ok := f.Value.(pflag.SliceValue); ok {
+			for _, value := range values.GetSlice() {
+				command = append(command, fmt.Sprintf("--%s=%s", f.Name, value))
+			}
+			return
+		}
+		command = append(command, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	return append(command, args...)
+}
+
+// secretFlag reports whether a flag takes a password or an API token, whose
+// literal values are never written to the job queue
+func secretFlag(name string) bool {
+	return strings.HasSuffix(name, "password") || name == "vault-token" || name == "gcp-token"
+}
+
+// formatJobProgress describes how far a job got
+func formatJobProgress(job *tx.Job) string {
+	switch {
+	case job.Total > 0:
+		return fmt.Sprintf("%d/%d", job.Done, job.Total)
+	case job.Finished():
+		return "-"
+	default:
+		return "..."
+	}
+}
+
+func init() {
+	// Add flags
+	jobsListCmd.Flags().StringVar(&jobState, "state", "", "Only list jobs in this state (queued, running, succeeded, failed, cancelled)")
+
+	// Add commands
+	JobsCmd.AddCommand(jobsListCmd)
+	JobsCmd.AddCommand(jobsInspectCmd)
+	JobsCmd.AddCommand(jobsRetryCmd)
+	JobsCmd.AddCommand(jobsCancelCmd)
+}
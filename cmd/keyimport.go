@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/qr"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importPrivateKey bool
+	importKeyFile    string
+	importPassword   string
+
+	revealPrivateKey bool
+	paperFile        string
+	revealCooldown   time.Duration
+)
+
+var keysImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import an existing private key or key file",
+	Long: `Import an existing key into the keystore under --name. With --private-key the key is read as
+hex from a hidden prompt, or from stdin when it is piped in; it is never accepted as an
+argument, where it would end up in the shell history and the process list. With --json the
+key is decrypted from a Web3 Secret Storage key file as written by geth, MetaMask or
+MyEtherWallet, using --json-password or a prompt.
+
+The file backend encrypts the imported key under --password, prompting for a new password
+when it is not given.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.New("the private key is read from the prompt or stdin; never pass it on the command line")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if importPrivateKey == (importKeyFile != "") {
+			return fmt.Errorf("give either --private-key or --json")
+		}
+		store, err := openKeyStore()
+		if err != nil {
+			return err
+		}
+		keys, err := store.ListKeys()
+		if err != nil {
+			return fmt.Errorf("failed to list keys: %v", err)
+		}
+		for _, key := range keys {
+			if key == keyName {
+				return fmt.Errorf("key %s already exists; choose another name", keyName)
+			}
+		}
+
+		var privateKey *ecdsa.PrivateKey
+		source := "private key"
+		if importPrivateKey {
+			privateKey, err = readPrivateKey()
+		} else {
+			privateKey, err = readKeyFile(importKeyFile)
+			source = "key file " + importKeyFile
+		}
+		if err != nil {
+			return err
+		}
+		address := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+		switch store := store.(type) {
+		case *keystore.Manager:
+			strength, err := keystore.ParseKDFStrength(kdfStrength)
+			if err != nil {
+				return err
+			}
+			if password == "" {
+				if password, err = promptNewPassword("Password of the imported key"); err != nil {
+					return err
+				}
+			}
+			if err := saveFileKey(store, keyName, privateKey, password, strength); err != nil {
+				return err
+			}
+		case *keystore.VaultKeyStore:
+			if err := store.ImportKey(keyName, privateKey); err != nil {
+				return fmt.Errorf("failed to save key: %v", err)
+			}
+		default:
+			return fmt.Errorf("the %s backend cannot import keys; import them with the KMS tools", keystoreBackend)
+		}
+
+		if err := recordAudit(&audit.Record{
+			Operation: audit.OpImportKey,
+			Outcome:   audit.OutcomeImported,
+			Key:       keyName,
+			Signer:    address.Hex(),
+			Detail:    "from " + source,
+		}); err != nil {
+			return err
+		}
+
+		output.Result(map[string]string{"name": keyName, "address": address.Hex(), "backend": keystoreBackend})
+		fmt.Printf("Imported key %s: %s\n", keyName, address.Hex())
+		copyToClipboard("address", address.Hex())
+		return nil
+	},
+}
+
+var keysExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Reveal the private key of a key or print it as a paper wallet",
+	Long: `Reveal the private key of a key of the file keystore with --reveal-private-key, or write it
+with its address as printable QR codes to the HTML page --paper. Anyone who sees the
+private key controls the account, so the export asks for a phrase of random words to be typed
+back and then waits --cooldown before revealing anything; press Ctrl-C to abort. A policy that
+exempts export-key from phrases asks for the key name instead. Every export is recorded in the
+audit trail with the phrase.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !revealPrivateKey && paperFile == "" {
+			return fmt.Errorf("give --reveal-private-key, --paper or both")
+		}
+		if paperFile != "" {
+			if _, err := os.Stat(paperFile); err == nil {
+				return fmt.Errorf("%s already exists; refusing to overwrite it", paperFile)
+			}
+		}
+		if _, err := fileKeyStore(); err != nil {
+			return err
+		}
+		rules, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		if password == "" {
+			if password, err = promptSecret("Key password"); err != nil {
+				return err
+			}
+		}
+		privateKey, err := loadKey(keyName, password)
+		if err != nil {
+			return err
+		}
+		defer securemem.WipeKey(privateKey)
+		address := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+		// Make the user stop and think before the key leaves the keystore
+		fmt.Printf("WARNING: anyone who sees the private key of %s controls its funds.\n", nickname(address))
+		fmt.Println("Make sure the screen is not shared or recorded and no one is watching.")
+		if paperFile != "" {
+			fmt.Println("Print the paper wallet on a printer that is not networked and delete the file afterwards.")
+		}
+		ok, err := confirmPhrase(rules, policy.PhraseExportKey, "Revealing the private key of "+keyName, func() (bool, error) {
+			answer, err := prompt(fmt.Sprintf("Type the key name %q to continue", keyName), "")
+			return answer == keyName, err
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("export aborted by user")
+		}
+		for left := revealCooldown.Round(time.Second); left > 0; left -= time.Second {
+			fmt.Printf("\rRevealing in %2d s, press Ctrl-C to abort", left/time.Second)
+			time.Sleep(time.Second)
+		}
+		if revealCooldown > 0 {
+			fmt.Println()
+		}
+
+		detail := "private key revealed"
+		if paperFile != "" {
+			detail = "paper wallet written to " + paperFile
+			if revealPrivateKey {
+				detail = "private key revealed and " + detail
+			}
+		}
+		if err := recordAudit(&audit.Record{
+			Operation: audit.OpExportKey,
+			Outcome:   audit.OutcomeRevealed,
+			Key:       keyName,
+			Signer:    address.Hex(),
+			Detail:    detail,
+		}); err != nil {
+			return err
+		}
+
+		hexKey := fmt.Sprintf("0x%x", crypto.FromECDSA(privateKey))
+		if paperFile != "" {
+			if err := writePaperWallet(paperFile, keyName, address, hexKey); err != nil {
+				return err
+			}
+			fmt.Printf("Paper wallet written to: %s\n", paperFile)
+		}
+		output.Result(map[string]string{"name": keyName, "address": address.Hex(), "paper": paperFile})
+		if revealPrivateKey {
+			fmt.Printf("Address:     %s\n", address.Hex())
+			fmt.Printf("Private key: %s\n", hexKey)
+		}
+		return nil
+	},
+}
+
+// readPrivateKey reads a hex private key from a hidden prompt or stdin
+func readPrivateKey() (*ecdsa.PrivateKey, error) {
+	hexKey, err := promptSecret("Private key (hex)")
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	return privateKey, nil
+}
+
+// readKeyFile decrypts a Web3 Secret Storage key file with --json-password
+// or a prompted password
+func readKeyFile(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+	keyPassword := importPassword
+	if keyPassword == "" {
+		if keyPassword, err = promptSecret("Password of the key file"); err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err := keystore.DecryptKeyJSON(data, keyPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key file: %w", err)
+	}
+	return privateKey, nil
+}
+
+// writePaperWallet writes a printable page with the address and private key
+// of a key as text and QR codes
+func writePaperWallet(path, name string, address common.Address, hexKey string) error {
+	addressCode, err := qr.Encode([]byte(address.Hex()))
+	if err != nil {
+		return err
+	}
+	keyCode, err := qr.Encode([]byte(hexKey))
+	if err != nil {
+		return err
+	}
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Paper wallet %[1]s</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.code { display: inline-block; width: 45%%; vertical-align: top; text-align: center; }
+.text { font-family: monospace; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Paper wallet %[1]s</h1>
+<p>Created %[2]s. Keep this page as safe as the funds it controls; anyone who can read the private key can spend them.</p>
+<div class="code">
+<h2>Address (share)</h2>
+%[3]s
+<p class="text">%[4]s</p>
+</div>
+<div class="code">
+<h2>Private key (secret)</h2>
+%[5]s
+<p class="text">%[6]s</p>
+</div>
+</body>
+</html>
+`, html.EscapeString(name), time.Now().Format("2006-01-02"), qr.SVG(addressCode, 6), address.Hex(), qr.SVG(keyCode, 6), hexKey)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create paper wallet: %v", err)
+	}
+	if _, err := file.WriteString(page); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write paper wallet: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write paper wallet: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	// Add flags
+	keysImportCmd.Flags().StringVar(&keyName, "name", "", "Name of the imported key")
+	keysImportCmd.Flags().BoolVar(&importPrivateKey, "private-key", false, "Import a hex private key read from the prompt or stdin")
+	keysImportCmd.Flags().StringVar(&importKeyFile, "json", "", "Import a Web3 Secret Storage key file")
+	keysImportCmd.Flags().StringVar(&importPassword, "json-password", "", "Password of the key file (prompted if not given)")
+	keysImportCmd.Flags().StringVar(&password, "password", "", "Encryption password (file backend, prompted if not given)")
+	keysImportCmd.Flags().StringVar(&kdfStrength, "kdf", string(keystore.KDFStandard), "Key derivation strength: light, standard or strong (file backend)")
+	addCopyFlags(keysImportCmd)
+	addAuditFlags(keysImportCmd)
+
+	keysExportCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	keysExportCmd.Flags().StringVar(&password, "password", "", "Key password (prompted if not given)")
+	keysExportCmd.Flags().BoolVar(&revealPrivateKey, "reveal-private-key", false, "Print the private key")
+	keysExportCmd.Flags().StringVar(&paperFile, "paper", "", "Write a printable paper wallet to this HTML file")
+	keysExportCmd.Flags().DurationVar(&revealCooldown, "cooldown", 10*time.Second, "Time to abort between confirmation and reveal")
+	addPhrasePolicyFlag(keysExportCmd)
+	addAuditFlags(keysExportCmd)
+
+	// Mark required flags
+	keysImportCmd.MarkFlagRequired("name")
+	keysExportCmd.MarkFlagRequired("name")
+
+	// Add commands
+	KeysCmd.AddCommand(keysImportCmd)
+	KeysCmd.AddCommand(keysExportCmd)
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/spf13/cobra"
+)
+
+// metaPasswordEnv supplies the key metadata password when --meta-password is not given
+const metaPasswordEnv = "GOSIGNERVAULT_META_PASSWORD"
+
+var (
+	metaPassword string
+	listTags     []string
+	listJSON     bool
+
+	tagRemove     []string
+	profileLabel  string
+	profileNotes  string
+	profilePath   string
+	profileChains []string
+	clearChains   bool
+	showKeyAsJSON bool
+)
+
+// keyInfo describes a key for 'keys list' and 'keys show'
+type keyInfo struct {
+	Name       string     `json:"name"`
+	Address    string     `json:"address,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	KDF        string     `json:"kdf,omitempty"`
+	ReplacedBy string     `json:"replacedBy,omitempty"`
+	Replaces   string     `json:"replaces,omitempty"`
+	// State is the lifecycle state of keys of the file keystore
+	State          keystore.KeyState `json:"state,omitempty"`
+	StateChangedAt *time.Time        `json:"stateChangedAt,omitempty"`
+	StateReason    string            `json:"stateReason,omitempty"`
+	// Locked is set when the key has a profile but no metadata password was given
+	Locked bool `json:"locked,omitempty"`
+	// Profile and Keystore name the keystore holding the key when several
+	// keystore profiles are searched
+	Profile  string `json:"profile,omitempty"`
+	Keystore string `json:"keystore,omitempty"`
+	*keystore.KeyProfile
+}
+
+var keysShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the address and metadata of a key",
+	Long: `Show the address, lifecycle state, creation date, key derivation and rotation history of a
+key of the file keystore, and its label, tags, derivation path, chains and notes when the metadata password
+is given with --meta-password or $` + metaPasswordEnv + `.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+		info, err := describeKey(manager, keyName)
+		if err != nil {
+			return err
+		}
+
+		if showKeyAsJSON {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal key: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Printf("Key %s\n", info.Name)
+		fmt.Printf("  Address:    %s\n", info.Address)
+		fmt.Printf("  State:      %s\n", describeState(info))
+		if info.CreatedAt != nil {
+			fmt.Printf("  Created:    %s\n", info.CreatedAt.Format(time.RFC3339))
+		}
+		fmt.Printf("  KDF:        %s\n", info.KDF)
+		if info.Replaces != "" {
+			fmt.Printf("  Replaces:   %s\n", info.Replaces)
+		}
+		if info.ReplacedBy != "" {
+			fmt.Printf("  Replaced by: %s\n", info.ReplacedBy)
+		}
+		switch {
+		case info.Locked:
+			fmt.Printf("  Metadata is locked; pass --meta-password or set $%s\n", metaPasswordEnv)
+		case info.KeyProfile != nil:
+			printProfile(info.KeyProfile)
+		}
+		return nil
+	},
+}
+
+var keysTagCmd = &cobra.Command{
+	Use:   "tag [tag...]",
+	Short: "Set the tags, label and other metadata of a key",
+	Long: `Add tags to a key of the file keystore, remove them with --remove, and set its label,
+derivation path, chains and notes. The metadata is encrypted in the key file with the
+metadata password (--meta-password or $` + metaPasswordEnv + `), which is shared by all
+keys and independent of the key passwords, so keys can be listed and filtered by tag without
+unlocking them. Chains are recorded for reference; restrict signing with the signing policy.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+		password, err := requireMetaPassword()
+		if err != nil {
+			return err
+		}
+		profile, err := manager.LoadProfile(keyName, password)
+		if err != nil {
+			return err
+		}
+
+		profile.SetTags(args, tagRemove)
+		flags := cmd.Flags()
+		if flags.Changed("label") {
+			profile.Label = profileLabel
+		}
+		if flags.Changed("notes") {
+			profile.Notes = profileNotes
+		}
+		if flags.Changed("derivation-path") {
+			profile.DerivationPath = profilePath
+		}
+		if flags.Changed("allowed-chain") {
+			profile.AllowedChains = profileChains
+		}
+		if clearChains {
+			profile.AllowedChains = nil
+		}
+
+		if err := manager.SaveProfile(keyName, password, profile); err != nil {
+			return err
+		}
+		fmt.Printf("Updated metadata of key %s\n", keyName)
+		printProfile(profile)
+		return nil
+	},
+}
+
+// describeKey reads a key file and its profile, leaving the profile locked
+// if no metadata password was given
+func describeKey(manager *keystore.Manager, name string) (*keyInfo, error) {
+	key, err := manager.LoadKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &keyInfo{Name: name, Address: key.Address, KDF: key.Crypto.KDF, State: key.State()}
+	if strength := key.Strength(); strength != "" {
+		info.KDF += " (" + string(strength) + ")"
+	}
+	if key.Legacy() {
+		info.KDF = "legacy single hash; re-encrypt with keys change-password"
+	}
+	if key.Metadata != nil {
+		if !key.Metadata.CreatedAt.IsZero() {
+			createdAt := key.Metadata.CreatedAt
+			info.CreatedAt = &createdAt
+		}
+		info.ReplacedBy = key.Metadata.ReplacedBy
+		info.Replaces = key.Metadata.Replaces
+		info.StateChangedAt = key.Metadata.StateChangedAt
+		info.StateReason = key.Metadata.StateReason
+	}
+	if key.Profile == nil {
+		return info, nil
+	}
+
+	password := firstNonEmpty(metaPassword, os.Getenv(metaPasswordEnv))
+	if password == "" {
+		info.Locked = true
+		return info, nil
+	}
+	info.KeyProfile, err = key.Profile.Open(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata of key %s: %v", name, err)
+	}
+	return info, nil
+}
+
+// describeState formats the lifecycle state of a key with when and why it
+// was set
+func describeState(info *keyInfo) string {
+	state := string(info.State)
+	if info.StateChangedAt != nil {
+		state += " since " + info.StateChangedAt.Format(time.RFC3339)
+	}
+	if info.StateReason != "" {
+		state += " (" + info.StateReason + ")"
+	}
+	return state
+}
+
+// listKeyInfos describes the keys of the file keystore carrying every tag
+func listKeyInfos(manager *keystore.Manager, tags []string) ([]*keyInfo, error) {
+	names, err := manager.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+
+	infos := make([]*keyInfo, 0, len(names))
+	for _, name := range names {
+		info, err := describeKey(manager, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 {
+			if info.Locked {
+				return nil, fmt.Errorf("filtering by tag needs the metadata password (--meta-password or $%s)", metaPasswordEnv)
+			}
+			if !hasTags(info.KeyProfile, tags) {
+				continue
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// hasTags reports whether a profile carries all of the tags
+func hasTags(profile *keystore.KeyProfile, tags []string) bool {
+	if profile == nil {
+		return false
+	}
+	for _, tag := range tags {
+		if !profile.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// requireMetaPassword returns the metadata password from --meta-password or
+// the environment
+func requireMetaPassword() (string, error) {
+	password := firstNonEmpty(metaPassword, os.Getenv(metaPasswordEnv))
+	if password == "" {
+		return "", errors.New("--meta-password or $" + metaPasswordEnv + " is required")
+	}
+	return password, nil
+}
+
+// printProfile prints the set fields of a key profile
+func printProfile(profile *keystore.KeyProfile) {
+	if profile.Label != "" {
+		fmt.Printf("  Label:      %s\n", profile.Label)
+	}
+	if len(profile.Tags) > 0 {
+		fmt.Printf("  Tags:       %s\n", strings.Join(profile.Tags, ", "))
+	}
+	if profile.DerivationPath != "" {
+		fmt.Printf("  Path:       %s\n", profile.DerivationPath)
+	}
+	if len(profile.AllowedChains) > 0 {
+		fmt.Printf("  Chains:     %s\n", strings.Join(profile.AllowedChains, ", "))
+	}
+	if profile.Notes != "" {
+		fmt.Printf("  Notes:      %s\n", profile.Notes)
+	}
+}
+
+func init() {
+	// Add flags
+	keysShowCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	keysShowCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+	keysShowCmd.Flags().BoolVar(&showKeyAsJSON, "json", false, "Print the key as JSON")
+
+	keysTagCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	keysTagCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+	keysTagCmd.Flags().StringSliceVar(&tagRemove, "remove", nil, "Tag to remove (repeatable)")
+	keysTagCmd.Flags().StringVar(&profileLabel, "label", "", "Label describing the key's purpose")
+	keysTagCmd.Flags().StringVar(&profileNotes, "notes", "", "Free-form notes")
+	keysTagCmd.Flags().StringVar(&profilePath, "derivation-path", "", "Derivation path the key came from, if any")
+	keysTagCmd.Flags().StringSliceVar(&profileChains, "allowed-chain", nil, "Chain the key is meant for (repeatable)")
+	keysTagCmd.Flags().BoolVar(&clearChains, "clear-chains", false, "Remove the recorded chains")
+
+	listCmd.Flags().StringSliceVar(&listTags, "tag", nil, "Only keys with this tag (repeatable, all must match)")
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Print the keys as JSON")
+	listCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+
+	// Mark required flags
+	keysShowCmd.MarkFlagRequired("name")
+	keysTagCmd.MarkFlagRequired("name")
+
+	// Add commands
+	KeysCmd.AddCommand(keysShowCmd)
+	KeysCmd.AddCommand(keysTagCmd)
+}
@@ -1,10 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
 
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
 	"github.com/aryehky/gosignervaultcli/core"
 	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 )
@@ -13,6 +26,17 @@ var (
 	keystoreDir string
 	keyName     string
 	password    string
+	newPassword string
+	kdfStrength string
+
+	backupFile     string
+	backupPassword string
+
+	sweepValue    string
+	sweepNonce    uint64
+	sweepGasPrice string
+	sweepGasLimit uint64
+	sweepOutput   string
 )
 
 // KeysCmd is the root command for key management
@@ -27,10 +51,10 @@ var generateCmd = &cobra.Command{
 	Short: "Generate a new wallet key",
 	Long:  `Generate a new Ethereum wallet key and save it to the keystore.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create keystore manager
-		manager, err := keystore.NewManager(keystoreDir)
+		// Open keystore backend
+		store, err := openKeyStore()
 		if err != nil {
-			return fmt.Errorf("failed to create keystore manager: %v", err)
+			return err
 		}
 
 		// Generate new wallet
@@ -38,19 +62,42 @@ var generateCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to generate wallet: %v", err)
 		}
+		defer wallet.Wipe()
 
-		// Encrypt private key
-		encryptedKey, err := keystore.EncryptKey(crypto.FromECDSA(wallet.PrivateKey), password)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt key: %v", err)
+		switch store := store.(type) {
+		case *keystore.Manager:
+			if password == "" {
+				return fmt.Errorf("--password is required for the file backend")
+			}
+			strength, err := keystore.ParseKDFStrength(kdfStrength)
+			if err != nil {
+				return err
+			}
+			if output.DryRun() {
+				break
+			}
+			if err := saveFileKey(store, keyName, wallet.PrivateKey, password, strength); err != nil {
+				return err
+			}
+		case *keystore.VaultKeyStore:
+			if output.DryRun() {
+				break
+			}
+			if err := store.ImportKey(keyName, wallet.PrivateKey); err != nil {
+				return fmt.Errorf("failed to save key: %v", err)
+			}
+		default:
+			return fmt.Errorf("keys of the %s backend are created in the KMS with a secp256k1 key spec", keystoreBackend)
 		}
 
-		// Save to keystore
-		if err := manager.SaveKey(encryptedKey, keyName); err != nil {
-			return fmt.Errorf("failed to save key: %v", err)
+		if output.DryRun() {
+			output.Result(map[string]string{"name": keyName, "backend": keystoreBackend})
+			fmt.Printf("Dry run, key %s was not generated\n", keyName)
+			return nil
 		}
-
+		output.Result(map[string]string{"name": keyName, "address": wallet.GetAddress(), "backend": keystoreBackend})
 		fmt.Printf("Generated new wallet: %s\n", wallet.GetAddress())
+		copyToClipboard("address", wallet.GetAddress())
 		return nil
 	},
 }
@@ -58,28 +105,81 @@ var generateCmd = &cobra.Command{
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all wallet keys",
-	Long:  `List all wallet keys stored in the keystore.`,
+	Long: `List all wallet keys stored in the keystore. Keys of the file keystore are shown with their
+address and lifecycle state, and with their label and tags when the metadata password is
+given; --tag lists only keys carrying the tag and --json prints machine-readable output.
+--all-profiles lists the keys of every keystore profile with the profile holding them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create keystore manager
-		manager, err := keystore.NewManager(keystoreDir)
+		// Open keystore backend
+		store, err := openKeyStore()
 		if err != nil {
-			return fmt.Errorf("failed to create keystore manager: %v", err)
+			return err
 		}
 
 		// List keys
-		keys, err := manager.ListKeys()
-		if err != nil {
-			return fmt.Errorf("failed to list keys: %v", err)
+		var infos []*keyInfo
+		if allProfiles {
+			if keystoreBackend != "file" {
+				return fmt.Errorf("--all-profiles searches file keystores only")
+			}
+			if infos, err = listProfileKeys(listTags); err != nil {
+				return err
+			}
+		} else if manager, ok := store.(*keystore.Manager); ok {
+			infos, err = listKeyInfos(manager, listTags)
+			if err != nil {
+				return err
+			}
+		} else {
+			if len(listTags) > 0 {
+				return fmt.Errorf("keys of the %s backend have no tags", keystoreBackend)
+			}
+			keys, err := store.ListKeys()
+			if err != nil {
+				return fmt.Errorf("failed to list keys: %v", err)
+			}
+			for _, key := range keys {
+				infos = append(infos, &keyInfo{Name: key})
+			}
 		}
 
-		if len(keys) == 0 {
+		if infos == nil {
+			infos = []*keyInfo{}
+		}
+		output.Result(infos)
+		if listJSON {
+			data, err := json.MarshalIndent(infos, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal keys: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(infos) == 0 {
 			fmt.Println("No keys found in keystore")
 			return nil
 		}
 
 		fmt.Println("Available keys:")
-		for _, key := range keys {
-			fmt.Printf("- %s\n", key)
+		for _, info := range infos {
+			line := "- " + info.Name
+			if info.Profile != "" {
+				line = "- " + info.Profile + ":" + info.Name
+			}
+			if info.Address != "" {
+				line += "  " + info.Address
+			}
+			if info.State != "" {
+				line += "  " + string(info.State)
+			}
+			if info.KeyProfile != nil && info.Label != "" {
+				line += "  " + info.Label
+			}
+			if info.KeyProfile != nil && len(info.Tags) > 0 {
+				line += "  [" + strings.Join(info.Tags, ", ") + "]"
+			}
+			fmt.Println(line)
 		}
 		return nil
 	},
@@ -88,38 +188,371 @@ var listCmd = &cobra.Command{
 var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete a wallet key",
-	Long:  `Delete a wallet key from the keystore.`,
+	Long: `Delete a wallet key from the keystore. A key without a backup cannot be recovered, so the
+deletion is confirmed by typing back a phrase of random words and recorded in the audit trail.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create keystore manager
-		manager, err := keystore.NewManager(keystoreDir)
+		// Open keystore backend
+		store, err := openKeyStore()
 		if err != nil {
-			return fmt.Errorf("failed to create keystore manager: %v", err)
+			return err
+		}
+		rules, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+
+		address := ""
+		if manager, ok := store.(*keystore.Manager); ok {
+			key, err := manager.LoadKey(keyName)
+			if err != nil {
+				return err
+			}
+			address = key.Address
+			fmt.Printf("Key %s controls %s\n", keyName, common.HexToAddress(address).Hex())
+		}
+		ok, err := confirmPhrase(rules, policy.PhraseDeleteKey, "Deleting key "+keyName, func() (bool, error) {
+			return confirm(fmt.Sprintf("Delete key %s?", keyName))
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("deletion aborted by user")
 		}
 
 		// Delete key
-		if err := manager.DeleteKey(keyName); err != nil {
+		if err := store.DeleteKey(keyName); err != nil {
 			return fmt.Errorf("failed to delete key: %v", err)
 		}
+		if err := recordAudit(&audit.Record{
+			Operation: audit.OpDeleteKey,
+			Outcome:   audit.OutcomeDeleted,
+			Key:       keyName,
+			Signer:    address,
+		}); err != nil {
+			return err
+		}
 
 		fmt.Printf("Deleted key: %s\n", keyName)
 		return nil
 	},
 }
 
+var changePasswordCmd = &cobra.Command{
+	Use:   "change-password",
+	Short: "Re-encrypt a wallet key under a new password",
+	Long:  `Re-encrypt a key of the file keystore under a new password. The key and its address stay the same.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+
+		if err := manager.ChangePassword(keyName, password, newPassword); err != nil {
+			return err
+		}
+
+		fmt.Printf("Changed password of key: %s\n", keyName)
+		return nil
+	},
+}
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace a wallet key with a fresh one",
+	Long: `Generate a fresh key under the name of an existing key of the file keystore. The old key
+is kept as <name>-<address prefix> and both keys record the old→new address mapping.
+With --sweep-value, a transaction moving funds from the old to the new address is signed
+with the old key for later broadcast.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+
+		// Build the sweep template before rotating so bad flags change nothing
+		var sweep *core.Transaction
+		var chain *core.ChainConfig
+		if sweepValue != "" {
+			if sweepOutput == "" || !cmd.Flags().Changed("sweep-nonce") {
+				return fmt.Errorf("--sweep-value requires --sweep-nonce and --sweep-output")
+			}
+			sweep, chain, err = sweepTemplate()
+			if err != nil {
+				return err
+			}
+		}
+		rules, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+
+		rotation, err := manager.Rotate(keyName, password, newPassword)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotated key %s: %s -> %s\n", rotation.Name, rotation.OldAddress, rotation.NewAddress)
+		fmt.Printf("Old key kept as: %s\n", rotation.RetiredName)
+
+		if sweep == nil {
+			return nil
+		}
+		return signSweep(cmd, sweep, chain, rotation, rules)
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write an encrypted backup of the keystore",
+	Long: `Write every key file of the keystore into one archive encrypted with --backup-password.
+Keep it away from the machine holding the keystore, e.g. on offline media.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+		keys, err := manager.ListKeys()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("keystore %s has no keys to back up", keystoreDir)
+		}
+
+		job := newJob(cmd, args, "backup", fmt.Sprintf("Back up %d key(s) of %s", len(keys), keystoreDir))
+		return runJob(cmd.Context(), job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+			if err := keystore.CreateBackup(keystoreDir, backupFile, backupPassword); err != nil {
+				return "", err
+			}
+			fmt.Printf("Backed up %d key(s) to %s\n", len(keys), backupFile)
+			return fmt.Sprintf("%d key(s) backed up to %s", len(keys), backupFile), nil
+		})
+	},
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check a backup without restoring it",
+	Long: `Authenticate the manifest of a backup written by 'keys backup' with --backup-password and
+decrypt every key file against the SHA-256 it lists, without writing anything. Fails if a file
+is missing, added, truncated or altered.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, err := keystore.VerifyBackup(backupFile, backupPassword)
+		if err != nil {
+			return err
+		}
+		for _, entry := range manifest.Entries {
+			fmt.Printf("  %-40s %8d bytes  %s\n", entry.Path, entry.Size, entry.SHA256)
+		}
+		fmt.Printf("Backup %s is intact: %d key file(s), written %s\n", backupFile, len(manifest.Entries),
+			time.Unix(manifest.Timestamp, 0).Format(time.RFC3339))
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore keys from an encrypted backup",
+	Long:  `Restore the key files of a backup written by 'keys backup' into the keystore. Keys of the same name are replaced.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := fileKeyStore(); err != nil {
+			return err
+		}
+		if err := keystore.RestoreBackup(backupFile, keystoreDir, backupPassword); err != nil {
+			return err
+		}
+		fmt.Printf("Restored keys from %s into %s\n", backupFile, keystoreDir)
+		return nil
+	},
+}
+
+// saveFileKey encrypts a new key with the given KDF strength and saves it to
+// the file keystore
+func saveFileKey(manager *keystore.Manager, name string, privateKey *ecdsa.PrivateKey, password string, strength keystore.KDFStrength) error {
+	plaintext := crypto.FromECDSA(privateKey)
+	defer securemem.Wipe(plaintext)
+	encryptedKey, err := keystore.EncryptKeyWithKDF(plaintext, password, strength)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key: %v", err)
+	}
+	encryptedKey.Metadata = &keystore.KeyMetadata{CreatedAt: time.Now().UTC()}
+
+	if err := manager.SaveKey(encryptedKey, name); err != nil {
+		return fmt.Errorf("failed to save key: %v", err)
+	}
+	return nil
+}
+
+// fileKeyStore returns the file keystore, refusing other backends
+func fileKeyStore() (*keystore.Manager, error) {
+	if keystoreBackend != "file" {
+		return nil, fmt.Errorf("the %s backend manages its own key material; use its tools instead", keystoreBackend)
+	}
+	return keystore.NewManager(keystoreDir)
+}
+
+// sweepTemplate builds the unsigned sweep transaction from the --sweep flags;
+// the recipient is filled in once the new key exists
+func sweepTemplate() (*core.Transaction, *core.ChainConfig, error) {
+	chain, err := core.GetChainConfig(chainName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get chain config: %v", err)
+	}
+	value, err := core.ParseAmount(sweepValue, rounding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --sweep-value: %v", err)
+	}
+	gasPrice, err := core.ParseAmount(sweepGasPrice, rounding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --sweep-gas-price: %v", err)
+	}
+
+	return &core.Transaction{
+		Nonce:    sweepNonce,
+		GasPrice: gasPrice,
+		GasLimit: sweepGasLimit,
+		Value:    value,
+		ChainID:  chain.ChainID,
+	}, chain, nil
+}
+
+// signSweep signs the sweep from the retired key to its successor and writes it
+// to --sweep-output, once confirmed with a phrase
+func signSweep(cmd *cobra.Command, sweep *core.Transaction, chain *core.ChainConfig, rotation *keystore.Rotation, rules *policy.Policy) error {
+	to := common.HexToAddress(rotation.NewAddress)
+	sweep.To = &to
+
+	privateKey, err := loadKey(rotation.RetiredName, password)
+	if err != nil {
+		return err
+	}
+	defer securemem.WipeKey(privateKey)
+	key, err := keystore.NewKeySigner(privateKey)
+	if err != nil {
+		return err
+	}
+	signer := core.NewSigner(key)
+	from := signer.Address()
+
+	// The sweep is checked like any other transaction of the old key
+	history, err := openHistory()
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicate(cmd, rules, history, sweep); err != nil {
+		return err
+	}
+	decisions, err := enforcePolicy(rules, history, sweep, signer, rotation.RetiredName)
+	if err != nil {
+		return auditRefusal(chainName, rotation.RetiredName, from, sweep, decisions, err)
+	}
+
+	// Show what is being signed and ask for confirmation
+	if err := previewTransaction(sweep, chain, from); err != nil {
+		return err
+	}
+	total := new(big.Int).Mul(sweep.GasPrice, new(big.Int).SetUint64(sweep.GasLimit))
+	total.Add(total, sweep.Value)
+	fmt.Printf("  Total:      %s must be available at %s\n", formatNative(chain, total), from.Hex())
+	ok, err := confirmPhrase(rules, policy.PhraseSweep, "Sweeping the funds of "+from.Hex(), func() (bool, error) {
+		return confirm("Sign the sweep transaction?")
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Printf("Sweep not signed; sign it later with --name %s\n", rotation.RetiredName)
+		return nil
+	}
+
+	signedTx, err := signer.SignTx(sweep)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(sweepOutput, []byte(signedTx), 0600); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+
+	if err := history.RecordSigned(signedRecord(sweep, from, signedTx)); err != nil {
+		return fmt.Errorf("failed to record transaction in history: %v", err)
+	}
+	hash := core.TransactionHash(signedTx)
+	if err := auditTransaction(audit.OutcomeSigned, chainName, rotation.RetiredName, from, sweep, &hash, append(decisions, "key rotation sweep")); err != nil {
+		return err
+	}
+
+	fmt.Printf("Sweep transaction signed and saved to: %s\n", sweepOutput)
+	return nil
+}
+
 func init() {
 	// Add flags
-	KeysCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", ".keystore", "Keystore directory")
+	KeysCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	addKeystoreBackendFlags(KeysCmd)
 	generateCmd.Flags().StringVar(&keyName, "name", "", "Key name")
-	generateCmd.Flags().StringVar(&password, "password", "", "Encryption password")
+	generateCmd.Flags().StringVar(&password, "password", "", "Encryption password (file backend)")
+	generateCmd.Flags().StringVar(&kdfStrength, "kdf", string(keystore.KDFStandard), "Key derivation strength: light, standard or strong (file backend)")
+	addCopyFlags(generateCmd)
 	deleteCmd.Flags().StringVar(&keyName, "name", "", "Key name to delete")
+	deleteCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip the y/N confirmation of a policy exempting delete-key from phrases")
+	addPhrasePolicyFlag(deleteCmd)
+	addAuditFlags(deleteCmd)
+
+	changePasswordCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	changePasswordCmd.Flags().StringVar(&password, "password", "", "Current password")
+	changePasswordCmd.Flags().StringVar(&newPassword, "new-password", "", "New password")
+
+	rotateCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	rotateCmd.Flags().StringVar(&password, "password", "", "Password of the current key")
+	rotateCmd.Flags().StringVar(&newPassword, "new-password", "", "Password of the new key (defaults to --password)")
+	rotateCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain of the sweep transaction")
+	rotateCmd.Flags().StringVar(&sweepValue, "sweep-value", "", "Sign a sweep of this amount to the new key, e.g. 1.5ether")
+	rotateCmd.Flags().Uint64Var(&sweepNonce, "sweep-nonce", 0, "Nonce of the old key for the sweep")
+	rotateCmd.Flags().StringVar(&sweepGasPrice, "sweep-gas-price", "30gwei", "Gas price of the sweep")
+	rotateCmd.Flags().Uint64Var(&sweepGasLimit, "sweep-gas-limit", 21000, "Gas limit of the sweep")
+	rotateCmd.Flags().StringVar(&sweepOutput, "sweep-output", "", "Output file of the signed sweep")
+	rotateCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	rotateCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file applied to the sweep")
+	rotateCmd.Flags().BoolVar(&override, "override", false, "Sign the sweep even if it violates the policy")
+	rotateCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	rotateCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	rotateCmd.Flags().StringVar(&duplicateMode, "duplicate-policy", tx.DefaultDuplicatePolicy().Mode, "Handling of recently signed identical transactions (warn, block, off)")
+	rotateCmd.Flags().DurationVar(&duplicateWindow, "duplicate-window", tx.DefaultDuplicatePolicy().Window, "Window in which identical transactions count as duplicates")
+	rotateCmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Sign the sweep even if the duplicate policy would block")
+	addSimulationCacheFlags(rotateCmd.Flags())
+	addAuditFlags(rotateCmd)
+	backupCmd.Flags().StringVar(&backupFile, "output", "", "Backup archive to write")
+	backupCmd.Flags().StringVar(&backupPassword, "backup-password", "", "Password encrypting the backup")
+	backupVerifyCmd.Flags().StringVar(&backupFile, "input", "", "Backup archive to verify")
+	backupVerifyCmd.Flags().StringVar(&backupPassword, "backup-password", "", "Password of the backup")
+	restoreCmd.Flags().StringVar(&backupFile, "input", "", "Backup archive to restore")
+	restoreCmd.Flags().StringVar(&backupPassword, "backup-password", "", "Password of the backup")
 
 	// Mark required flags
 	generateCmd.MarkFlagRequired("name")
-	generateCmd.MarkFlagRequired("password")
 	deleteCmd.MarkFlagRequired("name")
+	changePasswordCmd.MarkFlagRequired("name")
+	changePasswordCmd.MarkFlagRequired("password")
+	changePasswordCmd.MarkFlagRequired("new-password")
+	rotateCmd.MarkFlagRequired("name")
+	rotateCmd.MarkFlagRequired("password")
+	backupCmd.MarkFlagRequired("output")
+	backupCmd.MarkFlagRequired("backup-password")
+	backupVerifyCmd.MarkFlagRequired("input")
+	backupVerifyCmd.MarkFlagRequired("backup-password")
+	restoreCmd.MarkFlagRequired("input")
+	restoreCmd.MarkFlagRequired("backup-password")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(generateCmd, listCmd)
 
 	// Add commands
 	KeysCmd.AddCommand(generateCmd)
 	KeysCmd.AddCommand(listCmd)
 	KeysCmd.AddCommand(deleteCmd)
+	KeysCmd.AddCommand(changePasswordCmd)
+	KeysCmd.AddCommand(rotateCmd)
+	KeysCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupVerifyCmd)
+	KeysCmd.AddCommand(restoreCmd)
 }
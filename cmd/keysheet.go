@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/qr"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sheetFile  string
+	sheetTitle string
+	sheetTags  []string
+)
+
+// sheetEntry is an address on a printed inventory sheet
+type sheetEntry struct {
+	Label   string         `json:"label"`
+	Address common.Address `json:"address"`
+	Key     string         `json:"key,omitempty"`
+	Path    string         `json:"path,omitempty"`
+	Device  string         `json:"device,omitempty"`
+	Words   []string       `json:"words"`
+}
+
+var keysPrintSheetCmd = &cobra.Command{
+	Use:   "print-sheet [key|label|address...]",
+	Short: "Write a printable inventory sheet of addresses with QR codes",
+	Long: `Write a printable HTML page listing addresses with their QR codes, labels, derivation paths
+and checksum words, to keep on paper next to hardware wallet backups. Print it, or print it to
+PDF from the browser. Name keys of the file keystore, address book labels or plain addresses,
+or select keys with --tag. Labels and paths of keys come from their metadata when the metadata
+password is given; hardware wallet accounts saved by 'hardware accounts --save' show their
+device and path.
+
+The sheet never holds private material: no keys, passwords or recovery phrases. The checksum
+words are derived from each address alone, to check it when read out or typed back; they are
+not a recovery phrase and restore nothing.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && len(sheetTags) == 0 {
+			return fmt.Errorf("name keys, labels or addresses, or select keys with --tag")
+		}
+		entries, err := sheetEntries(args)
+		if err != nil {
+			return err
+		}
+		output.Result(entries)
+
+		if err := writeInventorySheet(sheetFile, sheetTitle, entries); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			fmt.Printf("%-20s %s  %s\n", firstNonEmpty(entry.Label, "-"), entry.Address.Hex(), strings.Join(entry.Words, " "))
+		}
+		fmt.Printf("Inventory sheet of %d addresses written to: %s\n", len(entries), sheetFile)
+		return nil
+	},
+}
+
+// sheetEntries resolves the keys carrying every --tag and the named keys,
+// labels and addresses, leaving out repeated addresses
+func sheetEntries(refs []string) ([]*sheetEntry, error) {
+	manager, err := fileKeyStore()
+	if err != nil && len(sheetTags) > 0 {
+		return nil, err
+	}
+
+	var entries []*sheetEntry
+	seen := make(map[common.Address]bool)
+	add := func(entry *sheetEntry) {
+		if !seen[entry.Address] {
+			seen[entry.Address] = true
+			entry.Words = core.ChecksumWords(entry.Address)
+			entries = append(entries, entry)
+		}
+	}
+	addKey := func(info *keyInfo) {
+		entry := &sheetEntry{Label: info.Name, Address: common.HexToAddress(info.Address), Key: info.Name}
+		if info.KeyProfile != nil {
+			entry.Label = firstNonEmpty(info.Label, info.Name)
+			entry.Path = info.DerivationPath
+		}
+		add(entry)
+	}
+
+	if len(sheetTags) > 0 {
+		infos, err := listKeyInfos(manager, sheetTags)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			addKey(info)
+		}
+	}
+
+	var book *addressbook.Book
+	var bookLoaded bool
+	for _, ref := range refs {
+		if manager != nil && manager.HasKey(ref) {
+			info, err := describeKey(manager, ref)
+			if err != nil {
+				return nil, err
+			}
+			addKey(info)
+			continue
+		}
+
+		if !bookLoaded {
+			if book, err = loadAddressBook(); err != nil {
+				return nil, err
+			}
+			bookLoaded = true
+		}
+		if book == nil {
+			if !common.IsHexAddress(ref) {
+				return nil, fmt.Errorf("%q is neither a key, an address nor a label in the address book", ref)
+			}
+			add(&sheetEntry{Address: common.HexToAddress(ref)})
+			continue
+		}
+		address, err := book.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		entry := &sheetEntry{Address: address}
+		if labeled, ok := book.Lookup(address); ok {
+			entry.Label = labeled.Label
+			if labeled.Device != nil {
+				entry.Path = labeled.Device.Path
+				entry.Device = fmt.Sprintf("%s, seed %s", labeled.Device.Kind, labeled.Device.Fingerprint.Hex())
+			}
+		}
+		add(entry)
+	}
+	return entries, nil
+}
+
+// writeInventorySheet writes a printable page with an address, its QR code
+// and checksum words per entry
+func writeInventorySheet(path, title string, entries []*sheetEntry) error {
+	var body strings.Builder
+	for _, entry := range entries {
+		code, err := qr.Encode([]byte(entry.Address.Hex()))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&body, "<div class=\"entry\">\n%s\n<div class=\"details\">\n<h2>%s</h2>\n<p class=\"text\">%s</p>\n",
+			qr.SVG(code, 4), html.EscapeString(firstNonEmpty(entry.Label, "(no label)")), groupHex(entry.Address.Hex()))
+		if entry.Key != "" {
+			fmt.Fprintf(&body, "<p>Keystore key: %s</p>\n", html.EscapeString(entry.Key))
+		}
+		if entry.Path != "" {
+			fmt.Fprintf(&body, "<p>Derivation path: <span class=\"text\">%s</span></p>\n", html.EscapeString(entry.Path))
+		}
+		if entry.Device != "" {
+			fmt.Fprintf(&body, "<p>Device: %s</p>\n", html.EscapeString(entry.Device))
+		}
+		fmt.Fprintf(&body, "<p>Checksum words: <b>%s</b></p>\n</div>\n</div>\n", strings.Join(entry.Words, " "))
+	}
+
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.entry { display: flex; gap: 1.5em; align-items: center; border-top: 1px solid #999; padding: 1em 0; page-break-inside: avoid; }
+.entry h2 { margin: 0 0 0.3em 0; }
+.entry p { margin: 0.2em 0; }
+.text { font-family: monospace; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>%[1]s</h1>
+<p>Printed %[2]s. Addresses only: this sheet holds no private keys or recovery phrases. The checksum
+words are derived from each address to check it when read out; they are not a recovery phrase.</p>
+%[3]s</body>
+</html>
+`, html.EscapeString(title), time.Now().Format("2006-01-02"), body.String())
+
+	if err := os.WriteFile(path, []byte(page), 0644); err != nil {
+		return fmt.Errorf("failed to write inventory sheet: %v", err)
+	}
+	return nil
+}
+
+// groupHex splits the digits of a hex address into groups of four, which are
+// easier to compare by eye
+func groupHex(address string) string {
+	digits := strings.TrimPrefix(address, "0x")
+	var groups []string
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:min(i+4, len(digits))])
+	}
+	return "0x" + strings.Join(groups, " ")
+}
+
+func init() {
+	// Add flags
+	keysPrintSheetCmd.Flags().StringVar(&sheetFile, "output", "", "HTML file to write the sheet to")
+	keysPrintSheetCmd.Flags().StringVar(&sheetTitle, "title", "Cold storage inventory", "Heading of the sheet")
+	keysPrintSheetCmd.Flags().StringSliceVar(&sheetTags, "tag", nil, "Also list the keys with this tag (repeatable, all must match)")
+	keysPrintSheetCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+	addAddressBookFlags(keysPrintSheetCmd)
+
+	// Mark required flags
+	keysPrintSheetCmd.MarkFlagRequired("output")
+
+	// Add commands
+	KeysCmd.AddCommand(keysPrintSheetCmd)
+}
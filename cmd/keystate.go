@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/spf13/cobra"
+)
+
+var stateReason string
+
+var keysStateCmd = &cobra.Command{
+	Use:   "state <active|suspended|retired|compromised>",
+	Short: "Change the lifecycle state of a key",
+	Long: `Move a key of the file keystore to another lifecycle state. Only active keys sign: suspended,
+retired and compromised keys are refused by every signing command, the agent and the 'serve'
+daemon, each with its own error, also when they were unlocked before the change.
+
+  active       the key signs (keys without a recorded state are active)
+  suspended    temporarily out of service; can be made active again
+  retired      out of service for good; can only be marked compromised
+  compromised  the key is known or suspected to be in other hands; final
+
+The state is recorded in the key file, readable without any password, together with the time
+and --reason of the change. Every change asks for confirmation and is recorded in the audit
+trail; retiring a key or marking it compromised is confirmed by typing back a phrase of random
+words. Retired and compromised keys can still be exported and swept with 'keys rotate'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		state, err := keystore.ParseKeyState(args[0])
+		if err != nil {
+			return err
+		}
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+		key, err := manager.LoadKey(keyName)
+		if err != nil {
+			return err
+		}
+
+		rules, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+
+		from := key.State()
+		fmt.Printf("Key %s (%s) is %s\n", keyName, key.Address, from)
+		ask := func() (bool, error) {
+			return confirm(fmt.Sprintf("Change its state to %s?", state))
+		}
+		var ok bool
+		if state == keystore.KeyRetired || state == keystore.KeyCompromised {
+			// Retired and compromised keys never sign again
+			ok, err = confirmPhrase(rules, policy.PhraseRetireKey, fmt.Sprintf("Marking key %s %s", keyName, state), ask)
+		} else {
+			ok, err = ask()
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("state change aborted by user")
+		}
+
+		if _, err := manager.SetState(keyName, state, stateReason); err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("%s -> %s", from, state)
+		if stateReason != "" {
+			detail += ": " + stateReason
+		}
+		if err := recordAudit(&audit.Record{
+			Operation: audit.OpKeyState,
+			Outcome:   audit.OutcomeChanged,
+			Key:       keyName,
+			Signer:    key.Address,
+			Detail:    detail,
+		}); err != nil {
+			return err
+		}
+
+		output.Result(map[string]string{"name": keyName, "address": key.Address, "from": string(from), "state": string(state)})
+		fmt.Printf("Key %s is now %s\n", keyName, state)
+		return nil
+	},
+}
+
+// checkKeyState refuses a key of the file keystore that may not sign because
+// of its lifecycle state
+func checkKeyState(name string) error {
+	manager, err := keystore.NewManager(keystoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to create keystore manager: %v", err)
+	}
+	return manager.CheckState(name)
+}
+
+func init() {
+	// Add flags
+	keysStateCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	keysStateCmd.Flags().StringVar(&stateReason, "reason", "", "Reason for the change, recorded with the state")
+	keysStateCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	addPhrasePolicyFlag(keysStateCmd)
+	addAuditFlags(keysStateCmd)
+
+	// Mark required flags
+	keysStateCmd.MarkFlagRequired("name")
+
+	// Add commands
+	KeysCmd.AddCommand(keysStateCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyState      bool
+	verifyRPCs       []string
+	verifyQuorum     int
+	verifyCheckpoint string
+)
+
+// addLightClientFlags registers the flags controlling light-client verification
+func addLightClientFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&verifyState, "verify", false, "Verify chain data with Merkle proofs instead of trusting the RPC provider")
+	cmd.Flags().StringSliceVar(&verifyRPCs, "verify-rpc", nil, "Independent RPC endpoint used to cross-check block headers (repeatable)")
+	cmd.Flags().IntVar(&verifyQuorum, "quorum", 0, "Number of endpoints that must agree on a block header (default: majority)")
+	cmd.Flags().StringVar(&verifyCheckpoint, "checkpoint", "", "Trusted finalized execution block hash, e.g. from a beacon light client")
+}
+
+// newLightClient creates a light client over the chain's RPC URL and the --verify-rpc endpoints
+func newLightClient(chain *core.ChainConfig) (*tx.LightClient, error) {
+	endpoints := append([]string{chain.RPCURL}, verifyRPCs...)
+	lc, err := tx.NewLightClient(endpoints, verifyQuorum)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifyCheckpoint != "" {
+		hash := common.FromHex(verifyCheckpoint)
+		if len(hash) != common.HashLength {
+			return nil, fmt.Errorf("invalid checkpoint block hash: %s", verifyCheckpoint)
+		}
+		lc.SetCheckpoint(common.BytesToHash(hash))
+	}
+
+	if len(endpoints) == 1 && verifyCheckpoint == "" {
+		fmt.Println("Warning: verifying against a single RPC provider; add --verify-rpc or --checkpoint for independent headers")
+	}
+	return lc, nil
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	linkPayloadURL string
+	linkCallback   string
+)
+
+// linkDesktopFile is the desktop entry handling gosigner:// links on Linux
+const linkDesktopFile = "gosignervaultcli-link.desktop"
+
+var signLinkCmd = &cobra.Command{
+	Use:   "link <gosigner://sign?...>",
+	Short: "Sign the request of a gosigner:// deep link",
+	Long: `Sign the transaction requested by a gosigner:// deep link, as handed over by web tools and
+dashboards. The link carries the unsigned payload, or its URL and keccak256 hash; a fetched
+payload must match the hash. The payload is then checked, previewed and confirmed exactly like
+with 'sign tx'. If the link names a callback, the signed payload is posted there as JSON after
+a second confirmation.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		link, err := tx.ParseSignLink(args[0])
+		if err != nil {
+			return err
+		}
+
+		// The link's chain applies unless --chain names another one
+		if link.Chain != "" {
+			if cmd.Flags().Changed("chain") && chainName != link.Chain {
+				return fmt.Errorf("link is for chain %s, but --chain is %s", link.Chain, chainName)
+			}
+			chainName = link.Chain
+		}
+
+		if link.Payload != nil {
+			fmt.Println("Sign request with the payload in the link")
+		} else {
+			fmt.Printf("Sign request for payload %s from %s\n", link.PayloadHash.Hex(), linkHost(link.PayloadURL))
+		}
+		if link.Callback != "" {
+			fmt.Printf("The signed transaction is to be sent to %s\n", linkHost(link.Callback))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		data, err := link.FetchPayload(ctx)
+		if err != nil {
+			return err
+		}
+		if tx.IsUnsignedPayload(data) && link.Chain != "" {
+			payload, err := tx.ParseUnsignedPayload(data)
+			if err != nil {
+				return err
+			}
+			if payload.Chain != "" && payload.Chain != link.Chain {
+				return fmt.Errorf("link is for chain %s, but its payload is for %s", link.Chain, payload.Chain)
+			}
+		}
+
+		payload, err := signTransaction(cmd, data)
+		if err != nil || payload == nil || link.Callback == "" {
+			return err
+		}
+
+		ok, err := confirm(fmt.Sprintf("Send the signed transaction to %s?", linkHost(link.Callback)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("The signed transaction was not sent")
+			return nil
+		}
+		if err := link.PostSigned(ctx, payload); err != nil {
+			return err
+		}
+		fmt.Printf("Signed transaction sent to %s\n", linkHost(link.Callback))
+		return nil
+	},
+}
+
+// LinkCmd creates gosigner:// deep links and registers their handler
+var LinkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Create and handle gosigner:// signature request links",
+	Long: `Signature request deep links hand a transaction from a web tool to the local signer with one
+click. 'sign link' signs the request of a link; the commands here create links and register
+'sign link' as the handler of gosigner:// links with the desktop.`,
+}
+
+var linkCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a deep link for an unsigned payload",
+	Long: `Create a gosigner:// link requesting the signature of the unsigned payload in --input. The
+payload is carried in the link, or with --payload-url only its hash is, and the payload is
+fetched from that URL when the link is opened.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		hash := crypto.Keccak256Hash(data)
+		link := &tx.SignLink{
+			Chain:       chainName,
+			PayloadHash: &hash,
+			Callback:    linkCallback,
+		}
+		if linkPayloadURL != "" {
+			link.PayloadURL = linkPayloadURL
+		} else {
+			link.Payload = data
+		}
+
+		// Check the link the way it will be opened
+		if _, err := tx.ParseSignLink(link.String()); err != nil {
+			return err
+		}
+		fmt.Println(link.String())
+		return nil
+	},
+}
+
+var linkRegisterCmd = &cobra.Command{
+	Use:   "register [-- sign link flags...]",
+	Short: "Open gosigner:// links with 'sign link'",
+	Long: `Register this executable as the handler of gosigner:// links, so that opening a link runs
+'sign link' in a terminal. Arguments after -- are passed to 'sign link', e.g. the key and the
+output file:
+
+  gosignervaultcli link register -- --name ops --output ~/signed/tx.txt
+
+Linux desktops are registered through a desktop entry and xdg-mime, Windows through the
+registry of the current user. macOS only opens URI schemes with application bundles.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the executable: %v", err)
+		}
+		command := append([]string{exe, "sign", "link"}, args...)
+
+		switch runtime.GOOS {
+		case "linux", "freebsd":
+			return registerDesktopEntry(command)
+		case "windows":
+			return registerWindowsHandler(command)
+		}
+		return fmt.Errorf("registering URI schemes is not supported on %s; open links with '%s sign link <link>'", runtime.GOOS, filepath.Base(exe))
+	},
+}
+
+// linkHost returns the host of a link URL, which is what the user is asked to trust
+func linkHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// registerDesktopEntry installs a desktop entry for gosigner:// links and
+// makes it the default handler of the scheme
+func registerDesktopEntry(command []string) error {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dir := filepath.Join(dataHome, "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = desktopQuote(arg)
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=GoSignerVaultCLI sign request
+Exec=%s %%u
+Terminal=true
+NoDisplay=true
+MimeType=x-scheme-handler/%s;
+`, strings.Join(quoted, " "), tx.LinkScheme)
+
+	path := filepath.Join(dir, linkDesktopFile)
+	if err := ioutil.WriteFile(path, []byte(entry), 0644); err != nil {
+		return fmt.Errorf("failed to write desktop entry: %v", err)
+	}
+	if output, err := exec.Command("xdg-mime", "default", linkDesktopFile, "x-scheme-handler/"+tx.LinkScheme).CombinedOutput(); err != nil {
+		return fmt.Errorf("wrote %s but xdg-mime failed: %v %s", path, err, strings.TrimSpace(string(output)))
+	}
+	fmt.Printf("gosigner:// links now open with %s\n", path)
+	return nil
+}
+
+// desktopQuote quotes an argument of a desktop entry's Exec key
+func desktopQuote(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"'\\$`%") {
+		return arg
+	}
+	replacer := strings.NewReplacer(`\`, `\\\\`, `"`, `\\"`, "`", "\\\\`", "$", `\\$`, "%", "%%")
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// registerWindowsHandler registers gosigner:// links in the registry of the
+// current user
+func registerWindowsHandler(command []string) error {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+	key := `HKCU\Software\Classes\` + tx.LinkScheme
+	for _, args := range [][]string{
+		{"add", key, "/ve", "/d", "URL:GoSignerVaultCLI sign request", "/f"},
+		{"add", key, "/v", "URL Protocol", "/d", "", "/f"},
+		{"add", key + `\shell\open\command`, "/ve", "/d", strings.Join(quoted, " ") + ` "%1"`, "/f"},
+	} {
+		if output, err := exec.Command("reg", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to register the link handler: %v %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	fmt.Printf("gosigner:// links now open with %s\n", command[0])
+	return nil
+}
+
+func init() {
+	// Add flags
+	signLinkCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name, if the link names none")
+	addSignTxFlags(signLinkCmd)
+
+	linkCreateCmd.Flags().StringVar(&inputFile, "input", "", "Unsigned payload to request a signature for")
+	linkCreateCmd.Flags().StringVar(&chainName, "chain", "", "Chain to sign on, if the payload names none")
+	linkCreateCmd.Flags().StringVar(&linkPayloadURL, "payload-url", "", "Link to the payload at this URL instead of carrying it")
+	linkCreateCmd.Flags().StringVar(&linkCallback, "callback", "", "URL the signed payload is posted to")
+
+	// Mark required flags
+	linkCreateCmd.MarkFlagRequired("input")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(signLinkCmd)
+
+	// Add commands
+	SignCmd.AddCommand(signLinkCmd)
+	LinkCmd.AddCommand(linkCreateCmd)
+	LinkCmd.AddCommand(linkRegisterCmd)
+}
@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+)
+
+// Statuses of a transaction in a multi-chain broadcast
+const (
+	multiStatusRefused   = "refused"
+	multiStatusFailed    = "failed"
+	multiStatusBroadcast = "broadcast"
+	multiStatusIncluded  = "included"
+	multiStatusReverted  = "reverted"
+	multiStatusPending   = "pending"
+)
+
+var (
+	multiChains []string
+	multiWait   time.Duration
+	multiReport string
+)
+
+// multiChainResult is the outcome of the transaction on one chain
+type multiChainResult struct {
+	Chain          string       `json:"chain"`
+	ChainID        *big.Int     `json:"chainId"`
+	Status         string       `json:"status"`
+	Nonce          *uint64      `json:"nonce,omitempty"`
+	Hash           *common.Hash `json:"hash,omitempty"`
+	Block          *big.Int     `json:"block,omitempty"`
+	Contract       string       `json:"contract,omitempty"`
+	RawTransaction string       `json:"rawTransaction,omitempty"`
+	Error          string       `json:"error,omitempty"`
+
+	chain       *core.ChainConfig
+	transaction *core.Transaction
+}
+
+var txBroadcastMultiCmd = &cobra.Command{
+	Use:   "broadcast-multi",
+	Short: "Sign and broadcast one transaction on several chains",
+	Long: `Sign a variant of one unsigned transaction for each of --chains and broadcast them
+concurrently, for deploying the same contract or sending the same governance action
+everywhere. Each variant gets the chain's ID, the sender's pending nonce on it, fees from the
+gas oracle (--gas-preset) and its own gas estimate; nonces, fees and gas limits of the input
+are ignored. Every variant is checked against the signing policy and shown before one
+confirmation. Chains share a pool of RPC connections. A chain that fails does not stop the
+others; the status of each chain is reported at the end and, with --report, written as JSON
+together with the signed transactions so failed chains can be retried with 'tx broadcast'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if offlineMode {
+			return fmt.Errorf("broadcast-multi needs network access")
+		}
+
+		// Read the transaction shared by all chains
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		data, built, err := tx.UnwrapTransaction(data)
+		if err != nil {
+			return err
+		}
+		if built != nil {
+			loadPayloadENSNames(built.Build)
+		}
+		var template core.Transaction
+		if err := json.Unmarshal(data, &template); err != nil {
+			return fmt.Errorf("failed to parse transaction: %v", err)
+		}
+
+		chains, err := resolveMultiChains(multiChains)
+		if err != nil {
+			return err
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		from := signer.Address()
+
+		signingPolicy, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+
+		// Chain queries and broadcasts share one connection per endpoint
+		pool := tx.NewClientPool()
+		defer pool.Close()
+		tx.UseClientPool(pool)
+		defer tx.UseClientPool(nil)
+
+		// Build and check the variant of each chain
+		results := make([]*multiChainResult, len(chains))
+		decisions := make([][]string, len(chains))
+		ready := 0
+		for i, chain := range chains {
+			result := &multiChainResult{Chain: chain.Name, ChainID: chain.ChainID, chain: chain}
+			results[i] = result
+			fmt.Printf("== %s (chain ID %s)\n", chain.Name, chain.ChainID)
+
+			transaction, err := multiChainVariant(&template, chain, from)
+			if err == nil {
+				err = checkDuplicate(cmd, signingPolicy, history, transaction)
+			}
+			if err == nil {
+				decisions[i], err = enforcePolicy(signingPolicy, history, transaction, signer, keyName)
+				if err != nil {
+					err = auditRefusal(chain.Name, signerName(), from, transaction, decisions[i], err)
+				}
+			}
+			if err == nil {
+				err = previewTransaction(transaction, chain, from)
+			}
+			if err != nil {
+				result.Status, result.Error = multiStatusRefused, err.Error()
+				fmt.Printf("  Skipped: %v\n", err)
+				continue
+			}
+			result.transaction = transaction
+			ready++
+		}
+		if ready == 0 {
+			return fmt.Errorf("the transaction cannot be sent on any of the chains")
+		}
+
+		ok, err := confirm(fmt.Sprintf("Sign and broadcast on %d of %d chains?", ready, len(chains)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		// Sign one chain at a time, as hardware wallets need
+		for i, result := range results {
+			if result.transaction == nil {
+				continue
+			}
+			signedTx, err := signer.SignTx(result.transaction)
+			if err != nil {
+				result.Status, result.Error, result.transaction = multiStatusFailed, err.Error(), nil
+				continue
+			}
+			hash := core.TransactionHash(signedTx)
+			nonce := result.transaction.Nonce
+			result.Nonce, result.Hash, result.RawTransaction = &nonce, &hash, signedTx
+			if result.transaction.IsContractCreation() {
+				result.Contract = result.transaction.ContractAddress(from).Hex()
+			}
+			if err := history.RecordSigned(signedRecord(result.transaction, from, signedTx)); err != nil {
+				return fmt.Errorf("failed to record transaction in history: %v", err)
+			}
+			if err := auditTransaction(audit.OutcomeSigned, result.Chain, signerName(), from, result.transaction, &hash, decisions[i]); err != nil {
+				return err
+			}
+		}
+
+		// Broadcast all chains at once
+		var wg sync.WaitGroup
+		for _, result := range results {
+			if result.RawTransaction == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(result *multiChainResult) {
+				defer wg.Done()
+				broadcastVariant(pool, result)
+			}(result)
+		}
+		wg.Wait()
+
+		// Record the outcomes once no broadcast is running
+		for _, result := range results {
+			if result.RawTransaction == "" || result.Hash == nil {
+				continue
+			}
+			payload := &tx.SignedPayload{
+				Version:        tx.PayloadVersion,
+				Chain:          result.Chain,
+				ChainID:        result.ChainID,
+				Hash:           *result.Hash,
+				RawTransaction: result.RawTransaction,
+			}
+			outcome, detail := audit.OutcomeBroadcast, ""
+			if result.Status == multiStatusFailed {
+				outcome, detail = audit.OutcomeFailed, result.Error
+			}
+			if err := auditBroadcast(outcome, payload, *result.Hash, detail); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			if outcome == audit.OutcomeBroadcast {
+				if err := markLeaseBroadcast(common.FromHex(result.RawTransaction)); err != nil {
+					fmt.Printf("Warning: failed to update nonce lease: %v\n", err)
+				}
+			}
+		}
+
+		// Report the status of every chain
+		failed := 0
+		fmt.Println("Results:")
+		for _, result := range results {
+			line := fmt.Sprintf("  %-12s %-9s", result.Chain, result.Status)
+			if result.Hash != nil {
+				line += " " + result.Hash.Hex()
+			}
+			if result.Block != nil {
+				line += fmt.Sprintf(" (block %s)", result.Block)
+			}
+			if result.Error != "" {
+				line += ": " + result.Error
+			}
+			fmt.Println(line)
+			if result.Contract != "" && result.Status != multiStatusFailed {
+				fmt.Printf("  %-12s contract %s\n", "", result.Contract)
+			}
+			switch result.Status {
+			case multiStatusRefused, multiStatusFailed, multiStatusReverted:
+				failed++
+			}
+		}
+
+		if multiReport != "" {
+			report, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report: %v", err)
+			}
+			if err := ioutil.WriteFile(multiReport, report, 0644); err != nil {
+				return fmt.Errorf("failed to write report: %v", err)
+			}
+			fmt.Printf("Report saved to: %s\n", multiReport)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d chains failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+// resolveMultiChains looks up the chains of --chains, refusing duplicates
+func resolveMultiChains(names []string) ([]*core.ChainConfig, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--chains is required")
+	}
+	var chains []*core.ChainConfig
+	seen := make(map[string]string)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		chain, err := core.GetChainConfig(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain config: %v", err)
+		}
+		if other, ok := seen[chain.ChainID.String()]; ok {
+			return nil, fmt.Errorf("chains %s and %s both have chain ID %s", other, name, chain.ChainID)
+		}
+		seen[chain.ChainID.String()] = name
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// multiChainVariant copies the shared transaction for a chain and fills in
+// the chain ID, nonce, fees and gas limit from that chain
+func multiChainVariant(template *core.Transaction, chain *core.ChainConfig, from common.Address) (*core.Transaction, error) {
+	variant := *template
+	variant.ChainID = chain.ChainID
+	variant.Nonce, variant.GasLimit = 0, 0
+	variant.GasPrice, variant.MaxFeePerGas, variant.MaxPriorityFeePerGas = nil, nil, nil
+
+	if err := fillTransaction(chain, &variant, from); err != nil {
+		return nil, err
+	}
+	if err := variant.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkChainCapabilities(chain, variant.ToEthereumTx()); err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// broadcastVariant submits the signed transaction of one chain and, with
+// --wait, waits for its receipt
+func broadcastVariant(pool *tx.ClientPool, result *multiChainResult) {
+	chain := result.chain
+	broadcaster, err := tx.NewBroadcaster([]string{chain.RPCURL})
+	if err != nil {
+		result.Status, result.Error = multiStatusFailed, err.Error()
+		return
+	}
+	broadcaster.PollInterval = chain.BlockInterval()
+	broadcaster.OnAttempt = func(endpoint string, err error) {
+		if err != nil {
+			explain("rpc", "%s: %s rejected the transaction: %v", chain.Name, endpointName(endpoint), err)
+			return
+		}
+		explain("rpc", "%s: %s accepted the transaction", chain.Name, endpointName(endpoint))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute+multiWait)
+	defer cancel()
+	if _, err := broadcaster.Broadcast(ctx, common.FromHex(result.RawTransaction)); err != nil {
+		result.Status, result.Error = multiStatusFailed, err.Error()
+		return
+	}
+	result.Status = multiStatusBroadcast
+	if multiWait <= 0 {
+		return
+	}
+
+	waitCtx, cancelWait := context.WithTimeout(ctx, multiWait)
+	defer cancelWait()
+	receipt, err := pool.WaitReceipt(waitCtx, chain.RPCURL, *result.Hash, chain.BlockInterval())
+	if err != nil {
+		result.Status = multiStatusPending
+		return
+	}
+	result.Block = receipt.BlockNumber
+	result.Status = multiStatusIncluded
+	if receipt.Status == types.ReceiptStatusFailed {
+		result.Status = multiStatusReverted
+	}
+}
+
+func init() {
+	// Add flags
+	txBroadcastMultiCmd.Flags().StringVar(&inputFile, "input", "", "Unsigned transaction file or payload shared by all chains")
+	txBroadcastMultiCmd.Flags().StringSliceVar(&multiChains, "chains", nil, "Chains to sign and broadcast on, e.g. ethereum,polygon,arbitrum")
+	txBroadcastMultiCmd.Flags().DurationVar(&multiWait, "wait", 0, "Wait up to this long for every transaction to be included")
+	txBroadcastMultiCmd.Flags().StringVar(&multiReport, "report", "", "Write the status and signed transaction of each chain to this JSON file")
+	txBroadcastMultiCmd.Flags().StringVar(&gasPreset, "gas-preset", "standard", "Gas oracle preset setting the fees on each chain (slow, standard, fast)")
+	addGasOracleFlags(txBroadcastMultiCmd)
+	txBroadcastMultiCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	txBroadcastMultiCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	txBroadcastMultiCmd.Flags().StringVar(&password, "password", "", "Key password")
+	txBroadcastMultiCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	txBroadcastMultiCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	txBroadcastMultiCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	txBroadcastMultiCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	txBroadcastMultiCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	txBroadcastMultiCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	txBroadcastMultiCmd.Flags().StringVar(&historyPassword, "history-password", "", "Encrypt the history with this password (append-only)")
+	txBroadcastMultiCmd.Flags().StringVar(&duplicateMode, "duplicate-policy", tx.DefaultDuplicatePolicy().Mode, "Handling of recently signed identical transactions (warn, block, off)")
+	txBroadcastMultiCmd.Flags().DurationVar(&duplicateWindow, "duplicate-window", tx.DefaultDuplicatePolicy().Window, "Window in which identical transactions count as duplicates")
+	txBroadcastMultiCmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Sign even if the duplicate policy would block")
+	txBroadcastMultiCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	txBroadcastMultiCmd.Flags().BoolVar(&override, "override", false, "Sign even if a transaction violates the policy")
+	addSimulationCacheFlags(txBroadcastMultiCmd.Flags())
+	txBroadcastMultiCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addKeystoreBackendFlags(txBroadcastMultiCmd)
+	addSignerFlags(txBroadcastMultiCmd)
+	addAuditFlags(txBroadcastMultiCmd)
+
+	// Mark required flags
+	txBroadcastMultiCmd.MarkFlagRequired("input")
+	txBroadcastMultiCmd.MarkFlagRequired("chains")
+
+	// Add commands
+	TxCmd.AddCommand(txBroadcastMultiCmd)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+// rpcSessionFile is where the session recorded with --record-rpc is saved
+var rpcSessionFile string
+
+// ConfigureNetwork applies the global --proxy and --doh settings and any
+// per-chain proxies, certificate pins and RPC fallbacks to every outbound connection
+func ConfigureNetwork(proxy, doh string) error {
+	if err := tx.SetProxy(proxy); err != nil {
+		return err
+	}
+	if err := tx.SetDoH(doh); err != nil {
+		return err
+	}
+	// Secrets in Vault are fetched over the same network settings
+	secrets.HTTPClient = tx.HTTPClient
+
+	chains, err := core.Chains()
+	if err != nil {
+		return err
+	}
+	for name, chain := range chains {
+		// Fallbacks get the chain's proxy and pins too; a pinned chain
+		// thereby fails closed on fallbacks serving other certificates
+		for _, endpoint := range chain.Endpoints() {
+			// Endpoints whose references failed to resolve report it when dialed
+			if _, err := secrets.Expand(endpoint); err != nil {
+				continue
+			}
+			if chain.Proxy != "" {
+				if err := tx.SetEndpointProxy(endpoint, chain.Proxy); err != nil {
+					return fmt.Errorf("failed to configure proxy for chain %s: %v", name, err)
+				}
+			}
+			if len(chain.PinnedKeys) > 0 {
+				if err := tx.SetEndpointPins(endpoint, chain.PinnedKeys); err != nil {
+					return fmt.Errorf("failed to configure certificate pins for chain %s: %v", name, err)
+				}
+			}
+		}
+		if len(chain.FallbackRPCs) > 0 {
+			tx.SetEndpointFallbacks(chain.RPCURL, chain.FallbackRPCs)
+		}
+	}
+
+	// Endpoints with fallbacks are tried in the order of their benchmarks
+	benchmarks, err := tx.OpenBenchmarks(tx.DefaultBenchmarkFile)
+	if err != nil {
+		return err
+	}
+	tx.UseBenchmarks(benchmarks)
+	return nil
+}
+
+// ConfigureRetry applies the global --rpc-attempts, --rpc-timeout and
+// --rpc-failover settings to every RPC call
+func ConfigureRetry(attempts int, timeout time.Duration, failover bool) error {
+	policy := tx.DefaultRetryPolicy
+	policy.Attempts = attempts
+	policy.Timeout = timeout
+	tx.SetRateLimitFailover(failover)
+	return tx.SetRetryPolicy(policy)
+}
+
+// ReportRateLimits warns about the providers that rate limited requests of
+// the command, once it has finished
+func ReportRateLimits() {
+	for _, summary := range tx.RateLimits() {
+		message := fmt.Sprintf("Warning: you are being rate limited by %s (%d requests refused", summary.Provider, summary.Refused)
+		if summary.Waited > 0 {
+			message += fmt.Sprintf(", %s spent waiting", summary.Waited.Round(time.Millisecond))
+		}
+		if summary.FailedOver > 0 {
+			message += fmt.Sprintf(", %d sent to fallbacks", summary.FailedOver)
+		}
+		fmt.Fprintln(os.Stderr, message+")")
+	}
+}
+
+// ConfigureRPCSession applies the global --record-rpc and --replay-rpc
+// settings. A recorded session is saved by SaveRPCSession once the command
+// has finished.
+func ConfigureRPCSession(c *cobra.Command, record, replay, backend string) error {
+	if record == "" && replay == "" {
+		return nil
+	}
+	if record != "" && replay != "" {
+		return fmt.Errorf("--record-rpc and --replay-rpc cannot be combined")
+	}
+	if backend != "rpc" {
+		return fmt.Errorf("RPC sessions are recorded and replayed with --backend rpc only")
+	}
+	if replay != "" {
+		session, err := tx.LoadRPCSession(replay)
+		if err != nil {
+			return err
+		}
+		tx.ReplayRPC(session)
+		fmt.Fprintf(os.Stderr, "Replaying %d RPC calls of '%s' recorded %s\n", len(session.Calls), session.Command, session.Recorded.Format(time.RFC3339))
+		return nil
+	}
+	rpcSessionFile = record
+	tx.RecordRPC(c.CommandPath())
+	return nil
+}
+
+// SaveRPCSession writes the session recorded with --record-rpc, also when the
+// command failed, since those sessions are the ones bug reports need
+func SaveRPCSession() {
+	if rpcSessionFile == "" {
+		return
+	}
+	session, err := tx.SaveRPCSession(rpcSessionFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %d RPC calls to %s\n", len(session.Calls), rpcSessionFile)
+	if len(session.Unrecorded) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: WebSocket endpoints are not recorded: %s\n", strings.Join(session.Unrecorded, ", "))
+	}
+}
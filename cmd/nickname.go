@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// rawAddresses prints bare addresses instead of their nicknames
+	rawAddresses bool
+
+	nicknamesOnce sync.Once
+	nicknameBook  *addressbook.Book
+	// keyNicknames names the addresses of the file keystore's keys
+	keyNicknames map[common.Address]string
+)
+
+// ConfigureNicknames selects whether addresses are printed with the names
+// they are known by or, with --raw, bare
+func ConfigureNicknames(raw bool) {
+	rawAddresses = raw
+}
+
+// nickname formats an address with the names it is known by, for outputs
+// that have not opened the address book themselves. A book or keystore that
+// cannot be read only costs the names.
+func nickname(address common.Address) string {
+	if rawAddresses {
+		return address.Hex()
+	}
+	nicknamesOnce.Do(func() {
+		book, err := loadAddressBook()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: address book labels unavailable: %v\n", err)
+		}
+		nicknameBook = book
+	})
+	return labeled(nicknameBook, address)
+}
+
+// nicknameOf formats an address recorded as a string, leaving values that are
+// not addresses, such as an empty recipient, as they are
+func nicknameOf(address string) string {
+	if !common.IsHexAddress(address) {
+		return address
+	}
+	return nickname(common.HexToAddress(address))
+}
+
+// keyNickname returns the name of the file keystore key holding an address,
+// with its label when the metadata password is available
+func keyNickname(address common.Address) (string, bool) {
+	if keyNicknames == nil {
+		keyNicknames = make(map[common.Address]string)
+		if keystoreBackend != "" && keystoreBackend != "file" {
+			return "", false
+		}
+		manager, err := keystore.NewManager(keystoreDir)
+		if err != nil {
+			return "", false
+		}
+		// Without the metadata password the key names still apply
+		infos, err := listKeyInfos(manager, nil)
+		if err != nil {
+			return "", false
+		}
+		for _, info := range infos {
+			name := "key " + info.Name
+			if info.KeyProfile != nil && info.Label != "" {
+				name += ": " + info.Label
+			}
+			keyNicknames[common.HexToAddress(info.Address)] = name
+		}
+	}
+	name, ok := keyNicknames[address]
+	return name, ok
+}
+
+// nicknameKey prefixes a state change key, which starts with an address, with
+// the address's nickname
+func nicknameKey(key string) string {
+	if len(key) < common.AddressLength*2+2 || !common.IsHexAddress(key[:common.AddressLength*2+2]) {
+		return key
+	}
+	prefix := key[:common.AddressLength*2+2]
+	return nickname(common.HexToAddress(prefix)) + key[len(prefix):]
+}
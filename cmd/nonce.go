@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	nonceLeaseFile string
+	nonceLeaseTTL  time.Duration
+	nonceHolder    string
+	nonceValue     uint64
+	useNonceLease  bool
+)
+
+// NonceCmd is the root command for shared nonce coordination
+var NonceCmd = &cobra.Command{
+	Use:   "nonce",
+	Short: "Coordinate nonces between operators sharing an address",
+	Long: `Lease nonces atomically from a lease table shared by several operators signing from the
+same address. Leases that are never broadcast expire and their nonces are reclaimed.`,
+}
+
+var nonceLeaseCmd = &cobra.Command{
+	Use:   "lease",
+	Short: "Lease the next free nonce",
+	Long:  `Lease the lowest nonce at or above the account's pending nonce that no other operator holds.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := parseAddress("address", fromAddress)
+		if err != nil {
+			return err
+		}
+
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		lease, err := leaseNonce(chain, from)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(lease.Nonce)
+		return nil
+	},
+}
+
+var nonceReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Release an unbroadcast nonce lease",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := parseAddress("address", fromAddress)
+		if err != nil {
+			return err
+		}
+
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		allocator, err := tx.NewNonceAllocator(nonceLeaseFile, nonceLeaseTTL)
+		if err != nil {
+			return err
+		}
+		if err := allocator.Release(from, chain.ChainID.String(), nonceValue); err != nil {
+			return err
+		}
+
+		fmt.Printf("Released nonce %d of %s\n", nonceValue, nickname(from))
+		return nil
+	},
+}
+
+var nonceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the nonce leases of an address",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, err := parseAddress("address", fromAddress)
+		if err != nil {
+			return err
+		}
+
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		allocator, err := tx.NewNonceAllocator(nonceLeaseFile, nonceLeaseTTL)
+		if err != nil {
+			return err
+		}
+		leases, err := allocator.Leases(from, chain.ChainID.String())
+		if err != nil {
+			return err
+		}
+
+		if len(leases) == 0 {
+			fmt.Println("No active nonce leases")
+			return nil
+		}
+		for _, lease := range leases {
+			fmt.Println(lease)
+		}
+		return nil
+	},
+}
+
+// leaseNonce leases the next free nonce of an address from the shared lease table
+func leaseNonce(chain *core.ChainConfig, from common.Address) (*tx.NonceLease, error) {
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	defer simulator.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pending, err := simulator.PendingNonce(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	allocator, err := tx.NewNonceAllocator(nonceLeaseFile, nonceLeaseTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	holder := nonceHolder
+	if holder == "" {
+		holder = defaultHolder()
+	}
+
+	lease, err := allocator.Lease(from, chain.ChainID.String(), pending, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Leased nonce %d of %s until %s\n", lease.Nonce, nickname(from), lease.ExpiresAt.Format(time.RFC3339))
+	return lease, nil
+}
+
+// markLeaseBroadcast marks the nonce lease of a broadcast transaction, if the
+// lease table exists and holds one
+func markLeaseBroadcast(rawTx []byte) error {
+	if _, err := os.Stat(nonceLeaseFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	var signedTx types.Transaction
+	if err := signedTx.UnmarshalBinary(rawTx); err != nil {
+		return fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(signedTx.ChainId()), &signedTx)
+	if err != nil {
+		return fmt.Errorf("failed to recover sender: %v", err)
+	}
+
+	allocator, err := tx.NewNonceAllocator(nonceLeaseFile, nonceLeaseTTL)
+	if err != nil {
+		return err
+	}
+	_, err = allocator.MarkBroadcast(from, signedTx.ChainId().String(), signedTx.Nonce(), signedTx.Hash())
+	return err
+}
+
+// defaultHolder identifies this operator in the lease table as user@host
+func defaultHolder() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+func init() {
+	// Add flags
+	NonceCmd.PersistentFlags().StringVar(&fromAddress, "address", "", "Shared sender address")
+	NonceCmd.PersistentFlags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	NonceCmd.PersistentFlags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table")
+	NonceCmd.PersistentFlags().DurationVar(&nonceLeaseTTL, "ttl", tx.DefaultNonceLeaseTTL, "Time before an unbroadcast lease is reclaimed")
+
+	nonceLeaseCmd.Flags().StringVar(&nonceHolder, "holder", "", "Operator name recorded with the lease (default user@host)")
+	nonceReleaseCmd.Flags().Uint64Var(&nonceValue, "nonce", 0, "Leased nonce to release")
+
+	// Mark required flags
+	NonceCmd.MarkPersistentFlagRequired("address")
+	nonceReleaseCmd.MarkFlagRequired("nonce")
+
+	// Add commands
+	NonceCmd.AddCommand(nonceLeaseCmd)
+	NonceCmd.AddCommand(nonceReleaseCmd)
+	NonceCmd.AddCommand(nonceListCmd)
+}
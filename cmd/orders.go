@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/addressbook"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	orderFile   string
+	orderChain  string
+	orderStatus string
+	orderWait   time.Duration
+)
+
+// OrdersCmd is the root command for signed off-chain orders
+var OrdersCmd = &cobra.Command{
+	Use:   "orders",
+	Short: "Track and cancel signed off-chain orders",
+	Long: `Orders signed with 'sign order' are kept in --orders with their expiry. An order stays
+fillable by anyone holding its signature until it expires or is cancelled on-chain, so list
+the open orders and cancel those no longer wanted with 'orders cancel-onchain'.`,
+}
+
+var signOrderCmd = &cobra.Command{
+	Use:   "order",
+	Short: "Sign a Seaport, 0x or CoW Swap order",
+	Long: `Sign the EIP-712 typed data of an off-chain order. Seaport (OrderComponents), 0x v4
+(LimitOrder, RfqOrder) and CoW Swap (GPv2 Order) orders are recognized by their domain and
+decoded into what the order gives and gets, its counterparty and its expiry before
+confirmation. Signing costs no gas; the signed order is recorded in --orders so it can be
+listed and cancelled on-chain later. Orders that have expired are refused; orders without an
+expiry are signed with a warning.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		typedData, err := core.ParseTypedData(string(data))
+		if err != nil {
+			return err
+		}
+		if err := typedData.Validate(); err != nil {
+			return err
+		}
+		order, err := core.DecodeOrder(typedData)
+		if err != nil {
+			return err
+		}
+		chain, err := resolveOrderChain(order.ChainID)
+		if err != nil {
+			return err
+		}
+		hash, err := typedData.Hash()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !order.Expiry.IsZero() && !order.Expiry.After(now) {
+			return fmt.Errorf("order expired at %s", order.Expiry.Format(time.RFC3339))
+		}
+
+		if err := checkSelectedSigner(cmd, core.CapTypedData); err != nil {
+			return err
+		}
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		from := signer.Address()
+		if order.Maker != (common.Address{}) && order.Maker != from {
+			return fmt.Errorf("order is made by %s, not by the signing key %s", order.Maker.Hex(), from.Hex())
+		}
+
+		// Show what the order does
+		if err := previewOrder(order, chain, hash, now); err != nil {
+			return err
+		}
+		if output.DryRun() {
+			output.Result(order)
+			fmt.Println("Dry run, the order was not signed")
+			return nil
+		}
+		ok, err := confirm("Sign this order?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		signature, err := signer.SignTypedData(typedData)
+		if err != nil {
+			return err
+		}
+		if err := saveTypedDataSignature(typedData, signature, "order "+order.Protocol); err != nil {
+			return err
+		}
+
+		book, err := tx.OpenOrderBook(orderFile)
+		if err != nil {
+			return err
+		}
+		if err := book.Add(&tx.SignedOrder{
+			Hash:      hash,
+			Protocol:  order.Protocol,
+			Chain:     chain.Name,
+			ChainID:   order.ChainID,
+			Contract:  order.Contract,
+			Signer:    from,
+			Signed:    now.UTC().Truncate(time.Second),
+			Expiry:    order.Expiry,
+			Signature: signature,
+			TypedData: typedData,
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Order %s recorded in %s\n", hash.Hex(), orderFile)
+		return nil
+	},
+}
+
+var ordersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List signed orders with their status and expiry",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		book, err := tx.OpenOrderBook(orderFile)
+		if err != nil {
+			return err
+		}
+		orders, err := book.Orders()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		listed := []*orderListing{}
+		for _, order := range orders {
+			state := order.State(now)
+			if orderStatus != "" && state != orderStatus {
+				continue
+			}
+			listed = append(listed, &orderListing{SignedOrder: order, State: state})
+		}
+		output.Result(listed)
+		if len(listed) == 0 {
+			fmt.Println("No orders found")
+			return nil
+		}
+
+		for _, order := range listed {
+			fmt.Printf("%s  %-7s %-10s %-10s %s\n", order.Hash.Hex(), order.Protocol, order.Chain, order.State, formatOrderExpiry(order.Expiry, now))
+			line := fmt.Sprintf("    signed by %s on %s", nickname(order.Signer), order.Signed.Format(time.RFC3339))
+			if order.CancelTx != nil {
+				line += ", cancelled in " + order.CancelTx.Hex()
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+var ordersCancelCmd = &cobra.Command{
+	Use:   "cancel-onchain [order hash]",
+	Short: "Cancel a signed order with a transaction to its protocol contract",
+	Long: `Send the transaction that invalidates a signed order: Seaport cancel(), 0x
+cancelLimitOrder() or cancelRfqOrder(), or CoW Swap invalidateOrder(). It must come from the
+key that signed the order and goes through the signing policy and history like any other
+transaction. The order is marked cancelling until the transaction is included; with --wait
+the command waits for the receipt. The order hash may be abbreviated to a unique prefix.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if offlineMode {
+			return fmt.Errorf("cancelling an order on-chain needs network access")
+		}
+		book, err := tx.OpenOrderBook(orderFile)
+		if err != nil {
+			return err
+		}
+		signed, err := book.Find(args[0])
+		if err != nil {
+			return err
+		}
+		switch state := signed.State(time.Now()); state {
+		case tx.OrderCancelled:
+			return fmt.Errorf("order %s was already cancelled in %s", signed.Hash.Hex(), signed.CancelTx.Hex())
+		case tx.OrderExpired:
+			return fmt.Errorf("order %s expired at %s and can no longer be filled", signed.Hash.Hex(), signed.Expiry.Format(time.RFC3339))
+		}
+
+		order, err := core.DecodeOrder(signed.TypedData)
+		if err != nil {
+			return err
+		}
+		calldata, err := order.CancelData(signed.Signer, signed.Hash)
+		if err != nil {
+			return err
+		}
+		chain, err := core.GetChainConfig(signed.Chain)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		from := signer.Address()
+		if from != signed.Signer {
+			return fmt.Errorf("order was signed by %s; only that key can cancel it, not %s", signed.Signer.Hex(), from.Hex())
+		}
+
+		transaction := &core.Transaction{
+			To:      &signed.Contract,
+			Value:   big.NewInt(0),
+			Data:    calldata,
+			ChainID: chain.ChainID,
+		}
+		if err := fillTransaction(chain, transaction, from); err != nil {
+			return err
+		}
+		fmt.Printf("Cancelling %s order %s\n", order.Protocol, signed.Hash.Hex())
+		hash, err := signAndBroadcast(cmd, signer, chain, transaction, "Sign and broadcast the cancellation?")
+		if err != nil {
+			return err
+		}
+		if err := book.SetStatus(signed.Hash, tx.OrderCancelling, &hash); err != nil {
+			return err
+		}
+		output.Result(map[string]string{"order": signed.Hash.Hex(), "transaction": hash.Hex()})
+		fmt.Printf("Cancellation broadcast: %s\n", hash.Hex())
+		if orderWait <= 0 {
+			return nil
+		}
+
+		// Only an included and successful cancellation settles the order
+		pool := tx.NewClientPool()
+		defer pool.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), orderWait)
+		defer cancel()
+		receipt, err := pool.WaitReceipt(ctx, chain.RPCURL, hash, chain.BlockInterval())
+		if err != nil {
+			fmt.Printf("Cancellation not included after %s; the order stays marked cancelling\n", orderWait)
+			return nil
+		}
+		if receipt.Status == 0 {
+			if err := book.SetStatus(signed.Hash, tx.OrderOpen, nil); err != nil {
+				return err
+			}
+			return fmt.Errorf("cancellation %s reverted in block %s; the order is still open", hash.Hex(), receipt.BlockNumber)
+		}
+		if err := book.SetStatus(signed.Hash, tx.OrderCancelled, &hash); err != nil {
+			return err
+		}
+		fmt.Printf("Order cancelled in block %s\n", receipt.BlockNumber)
+		return nil
+	},
+}
+
+// orderListing is an order with its current state in 'orders list'
+type orderListing struct {
+	*tx.SignedOrder
+	State string `json:"state"`
+}
+
+// resolveOrderChain returns the chain of --chain, checking that it has the
+// order's chain ID, or else the configured chain with that ID
+func resolveOrderChain(chainID *big.Int) (*core.ChainConfig, error) {
+	if orderChain != "" {
+		chain, err := core.GetChainConfig(orderChain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain config: %v", err)
+		}
+		if chain.ChainID.Cmp(chainID) != 0 {
+			return nil, fmt.Errorf("order is for chain ID %s but chain %s has ID %s", chainID, chain.Name, chain.ChainID)
+		}
+		return chain, nil
+	}
+
+	chain, err := chainWithID(chainID)
+	if err != nil || chain != nil {
+		return chain, err
+	}
+	return nil, fmt.Errorf("no configured chain has the order's chain ID %s; add it with 'chains add'", chainID)
+}
+
+// previewOrder prints what an order gives and gets and when it expires
+func previewOrder(order *core.Order, chain *core.ChainConfig, hash common.Hash, now time.Time) error {
+	book, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Order preview")
+	fmt.Printf("  Protocol:   %s %s\n", order.Protocol, order.Type)
+	fmt.Printf("  Chain:      %s (chain ID %s)\n", chain.Name, order.ChainID)
+	fmt.Printf("  Contract:   %s\n", labeled(book, order.Contract))
+	if order.Maker != (common.Address{}) {
+		fmt.Printf("  Maker:      %s\n", labeled(book, order.Maker))
+	}
+	fmt.Printf("  Order hash: %s\n", hash.Hex())
+	fmt.Println("  Gives:")
+	for _, asset := range order.Gives {
+		fmt.Printf("    %s\n", formatOrderAsset(book, chain, asset))
+	}
+	fmt.Println("  Gets:")
+	for _, asset := range order.Gets {
+		fmt.Printf("    %s\n", formatOrderAsset(book, chain, asset))
+	}
+	if !order.Start.IsZero() && order.Start.After(now) {
+		fmt.Printf("  Starts:     %s\n", order.Start.Format(time.RFC3339))
+	}
+	fmt.Printf("  Expires:    %s\n", formatOrderExpiry(order.Expiry, now))
+	if order.Expiry.IsZero() {
+		fmt.Println("  Warning: the order never expires; it can be filled until it is cancelled on-chain")
+	}
+	return nil
+}
+
+// formatOrderAsset describes an amount of a token an order gives or gets
+func formatOrderAsset(book *addressbook.Book, chain *core.ChainConfig, asset core.OrderAsset) string {
+	var text string
+	switch asset.Kind {
+	case core.AssetNative:
+		text = formatNative(chain, asset.Amount)
+		if asset.EndAmount != nil {
+			text += " to " + formatNative(chain, asset.EndAmount)
+		}
+	case core.AssetERC721, core.AssetERC1155:
+		text = fmt.Sprintf("%s of %s %s", asset.Amount, asset.Kind, labeled(book, asset.Token))
+		if asset.ID != nil {
+			text += " #" + asset.ID.String()
+		} else {
+			text += " (any token matching the criteria)"
+		}
+	default:
+		text = fmt.Sprintf("%s base units", asset.Amount)
+		if asset.EndAmount != nil {
+			text += fmt.Sprintf(" to %s base units", asset.EndAmount)
+		}
+		text += " of " + labeled(book, asset.Token)
+	}
+	if asset.Recipient != nil {
+		text += " to " + labeled(book, *asset.Recipient)
+	}
+	return text
+}
+
+// formatOrderExpiry formats an expiry with the time left until it
+func formatOrderExpiry(expiry, now time.Time) string {
+	if expiry.IsZero() {
+		return "never"
+	}
+	if !expiry.After(now) {
+		return expiry.Format(time.RFC3339) + " (expired)"
+	}
+	return fmt.Sprintf("%s (in %s)", expiry.Format(time.RFC3339), expiry.Sub(now).Round(time.Minute))
+}
+
+func init() {
+	// Add flags
+	OrdersCmd.PersistentFlags().StringVar(&orderFile, "orders", tx.DefaultOrderFile, "Book of signed off-chain orders")
+	addAddressBookFlags(OrdersCmd)
+	addAuditFlags(OrdersCmd)
+	ordersListCmd.Flags().StringVar(&orderStatus, "status", "", "Only orders with this status (open, expired, cancelling, cancelled)")
+	ordersCancelCmd.Flags().DurationVar(&orderWait, "wait", 0, "Wait up to this long for the cancellation to be included")
+	ordersCancelCmd.Flags().StringVar(&gasPreset, "gas-preset", "", "Gas oracle preset of the cancellation (slow, standard, fast)")
+	addGasOracleFlags(ordersCancelCmd)
+	ordersCancelCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	ordersCancelCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	ordersCancelCmd.Flags().StringVar(&password, "password", "", "Key password")
+	ordersCancelCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	ordersCancelCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	ordersCancelCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	ordersCancelCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	ordersCancelCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	ordersCancelCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	ordersCancelCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	ordersCancelCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	ordersCancelCmd.Flags().BoolVar(&override, "override", false, "Sign even if the cancellation violates the policy")
+	addSimulationCacheFlags(ordersCancelCmd.Flags())
+	ordersCancelCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addKeystoreBackendFlags(ordersCancelCmd)
+	addSignerFlags(ordersCancelCmd)
+
+	signOrderCmd.Flags().StringVar(&inputFile, "input", "", "Typed data of the order")
+	signOrderCmd.Flags().StringVar(&orderChain, "chain", "", "Chain of the order (defaults to the configured chain with its chain ID)")
+	signOrderCmd.Flags().StringVar(&orderFile, "orders", tx.DefaultOrderFile, "Book of signed off-chain orders")
+
+	// Mark required flags
+	signOrderCmd.MarkFlagRequired("input")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(signOrderCmd, ordersListCmd)
+
+	// Add commands
+	OrdersCmd.AddCommand(ordersListCmd)
+	OrdersCmd.AddCommand(ordersCancelCmd)
+	SignCmd.AddCommand(signOrderCmd)
+}
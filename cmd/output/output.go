@@ -0,0 +1,183 @@
+// Package output selects between text and JSON output and maps failures to
+// stable exit codes, so scripts can use results without parsing text
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// FormatText prints human-readable text
+	FormatText = "text"
+	// FormatJSON prints a single JSON document on stdout
+	FormatJSON = "json"
+)
+
+// Exit codes by failure class
+const (
+	ExitOK          = 0
+	ExitFailure     = 1
+	ExitUsage       = 2
+	ExitBadPassword = 3
+	ExitPolicy      = 4
+	ExitRPC         = 5
+)
+
+// dryRunAnnotation marks commands that honour --dry-run
+const dryRunAnnotation = "dryRun"
+
+var (
+	format = FormatText
+	dryRun bool
+	// stdout is where the JSON document goes; text moves to stderr in JSON mode
+	stdout = os.Stdout
+	result interface{}
+)
+
+// Error carries the exit code of a failure
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns err with an exit code
+func WithCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Configure selects the output format and dry-run mode. In JSON mode the text
+// output of commands moves to stderr so stdout carries only the JSON document.
+func Configure(outputFormat string, dry bool) error {
+	switch outputFormat {
+	case FormatText:
+	case FormatJSON:
+		stdout = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		return WithCode(ExitUsage, fmt.Errorf("unknown output format %q (expected text or json)", outputFormat))
+	}
+	format, dryRun = outputFormat, dry
+	return nil
+}
+
+// JSON reports whether results are printed as JSON
+func JSON() bool {
+	return format == FormatJSON
+}
+
+// DryRun reports whether commands stop before changing anything
+func DryRun() bool {
+	return dryRun
+}
+
+// Result sets the result of the command, printed in JSON mode
+func Result(v interface{}) {
+	result = v
+}
+
+// AllowDryRun marks commands that honour --dry-run
+func AllowDryRun(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		if c.Annotations == nil {
+			c.Annotations = make(map[string]string)
+		}
+		c.Annotations[dryRunAnnotation] = "true"
+	}
+}
+
+// CheckDryRun refuses --dry-run for a command that does not honour it, rather
+// than letting it run for real
+func CheckDryRun(c *cobra.Command) error {
+	if dryRun && c.Annotations[dryRunAnnotation] == "" {
+		return WithCode(ExitUsage, fmt.Errorf("%s does not support --dry-run", c.CommandPath()))
+	}
+	return nil
+}
+
+// ExitCode returns the exit code for the class of a failure
+func ExitCode(err error) int {
+	var coded *Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &coded):
+		return coded.Code
+	case errors.Is(err, keystore.ErrWrongPassword), errors.Is(err, keystore.ErrWrongMetadataPassword),
+		errors.Is(err, secrets.ErrWrongMasterPassword):
+		return ExitBadPassword
+	case errors.Is(err, policy.ErrPolicyDenied):
+		return ExitPolicy
+	case errors.Is(err, tx.ErrRPCUnavailable):
+		return ExitRPC
+	}
+	return ExitFailure
+}
+
+// class names the failure class of an exit code
+func class(code int) string {
+	switch code {
+	case ExitUsage:
+		return "usage"
+	case ExitBadPassword:
+		return "bad-password"
+	case ExitPolicy:
+		return "policy"
+	case ExitRPC:
+		return "rpc"
+	}
+	return "failure"
+}
+
+// document is the JSON document printed in JSON mode
+type document struct {
+	OK       bool        `json:"ok"`
+	DryRun   bool        `json:"dryRun,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Class    string      `json:"class,omitempty"`
+	ExitCode int         `json:"exitCode,omitempty"`
+}
+
+// Finish reports the outcome of a command and returns the exit code. In JSON
+// mode it prints {"ok":true,"result":...} or {"ok":false,"error":...,"class":...}.
+func Finish(err error) int {
+	code := ExitCode(err)
+	if !JSON() {
+		if err != nil {
+			fmt.Println(err)
+		}
+		return code
+	}
+
+	doc := &document{OK: err == nil, DryRun: dryRun, Result: result}
+	if err != nil {
+		doc.Error, doc.Class, doc.ExitCode = err.Error(), class(code), code
+	}
+	data, marshalErr := json.MarshalIndent(doc, "", "  ")
+	if marshalErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal output: %v\n", marshalErr)
+		return ExitFailure
+	}
+	fmt.Fprintln(stdout, string(data))
+	return code
+}
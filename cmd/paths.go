@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/spf13/cobra"
+)
+
+// MigratePathsCmd moves data from the working-directory locations of earlier
+// versions to the OS default locations
+var MigratePathsCmd = &cobra.Command{
+	Use:   "migrate-paths",
+	Short: "Move .keystore, .history and policy.json to the OS default locations",
+	Long: `Move data kept in the working directory by earlier versions to the OS default
+locations: $XDG_DATA_HOME and $XDG_CONFIG_HOME on Linux, ~/Library/Application Support
+on macOS and %APPDATA% on Windows. Set GOSIGNERVAULT_HOME to use a single directory
+instead. Until it is migrated, existing data keeps being used where it is.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrated := 0
+		for _, loc := range paths.Locations() {
+			if loc.Current == loc.Legacy || !loc.InLegacy() {
+				fmt.Printf("%-9s %s\n", loc.Name, loc.Current)
+				continue
+			}
+
+			fmt.Printf("%-9s %s -> %s\n", loc.Name, loc.Legacy, loc.Current)
+			if output.DryRun() {
+				continue
+			}
+			if err := loc.Migrate(); err != nil {
+				return fmt.Errorf("failed to migrate %s: %v", loc.Name, err)
+			}
+			migrated++
+		}
+
+		if output.DryRun() {
+			fmt.Println("Dry run, nothing was moved")
+		} else {
+			fmt.Printf("Migrated %d locations\n", migrated)
+		}
+		return nil
+	},
+}
+
+// WarnLegacyPaths prints a notice for data still kept in legacy locations
+func WarnLegacyPaths(c *cobra.Command) {
+	if c == MigratePathsCmd {
+		return
+	}
+	for _, loc := range paths.Locations() {
+		if loc.Current == loc.Legacy || !loc.InLegacy() {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Note: using %s from %s; run migrate-paths to move it to %s\n", loc.Name, loc.Legacy, loc.Current)
+	}
+}
+
+func init() {
+	output.AllowDryRun(MigratePathsCmd)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/spf13/cobra"
+)
+
+// confirmation is the phrase typed to confirm a destructive operation of this
+// command; recordAudit adds it to the records written afterwards
+var confirmation string
+
+// confirmPhrase has a destructive operation confirmed by typing back a phrase
+// of random words, which unlike y/N cannot be given out of habit. --yes does
+// not skip it. Operations the policy exempts are confirmed with fallback
+// instead, or not at all if it is nil.
+func confirmPhrase(rules *policy.Policy, operation, action string, fallback func() (bool, error)) (bool, error) {
+	count := rules.PhraseWords(operation)
+	if count == 0 {
+		if fallback == nil {
+			return true, nil
+		}
+		return fallback()
+	}
+
+	words, err := core.RandomWords(count)
+	if err != nil {
+		return false, err
+	}
+	phrase := strings.Join(words, " ")
+	fmt.Printf("%s cannot be undone. To confirm, type the words: %s\n", action, phrase)
+	answer, err := prompt("Words", "")
+	if err != nil {
+		return false, err
+	}
+	if strings.Join(strings.Fields(strings.ToLower(answer)), " ") != phrase {
+		fmt.Println("The words do not match")
+		return false, nil
+	}
+	confirmation = fmt.Sprintf("%s confirmed with %q", operation, phrase)
+	return true, nil
+}
+
+// addPhrasePolicyFlag adds the policy holding the confirmation rule to a
+// command that does not sign
+func addPhrasePolicyFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file, whose confirmation rule applies")
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/agent"
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/aryehky/gosignervaultcli/templates"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	portableCopyBinary bool
+
+	// portableVerified is set once the portable vault matched its manifest,
+	// so only a vault that was intact before the command is sealed again
+	portableVerified bool
+)
+
+// PortableCmd represents the portable command
+var PortableCmd = &cobra.Command{
+	Use:   "portable",
+	Short: "Manage a portable vault on removable media",
+	Long: `A portable vault keeps the keystore, policy, history and logs in one relocatable
+directory, e.g. on an encrypted USB stick. Use it with --portable <dir>, or place the
+executable in the vault directory to use it automatically. The keystore, policy and history
+are covered by an integrity manifest that is checked before and sealed after every command.`,
+}
+
+var portableInitCmd = &cobra.Command{
+	Use:   "init <dir>",
+	Short: "Create a portable vault",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := args[0]
+		if err := paths.InitPortable(root); err != nil {
+			return err
+		}
+
+		// Carry the executable along so the vault is detected on any machine
+		if portableCopyBinary {
+			if err := copyExecutable(root); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("Created portable vault in %s\n", root)
+		return nil
+	},
+}
+
+var portableVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the portable vault against its manifest",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := requirePortable()
+		if err != nil {
+			return err
+		}
+		changes, err := paths.Verify(root)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			fmt.Printf("Portable vault %s matches its manifest\n", root)
+			return nil
+		}
+		for _, change := range changes {
+			fmt.Printf("  %-8s %s\n", change.Change, change.Path)
+		}
+		return fmt.Errorf("%d files differ from the manifest", len(changes))
+	},
+}
+
+var portableSealCmd = &cobra.Command{
+	Use:   "seal",
+	Short: "Accept the current contents of the portable vault",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, err := requirePortable()
+		if err != nil {
+			return err
+		}
+		if err := paths.Seal(root); err != nil {
+			return err
+		}
+		fmt.Printf("Sealed portable vault %s\n", root)
+		return nil
+	},
+}
+
+// ConfigurePortable switches to a portable vault, moves the defaults of path
+// flags the user did not set into it and checks its integrity
+func ConfigurePortable(c *cobra.Command, dir string) error {
+	if err := paths.SetPortable(dir); err != nil {
+		return err
+	}
+	root := paths.PortableRoot()
+	if root == "" {
+		return nil
+	}
+
+	// Flag defaults were bound before the vault was known
+	keystore.DefaultKeystoreDir = paths.Resolve("keystore")
+	audit.DefaultLogFile = filepath.Join(paths.DataDir(), "audit", "audit.log")
+	audit.DefaultKeyFile = filepath.Join(paths.DataDir(), "audit", "audit.key")
+	audit.DefaultAnchorFile = filepath.Join(paths.DataDir(), "audit", "anchors.log")
+	core.UserChainsFile = filepath.Join(paths.ConfigDir(), "chains.json")
+	core.EnvironmentsDir = filepath.Join(paths.ConfigDir(), "environments")
+	agent.DefaultSocket = filepath.Join(paths.DataDir(), "agent.sock")
+	templates.Dir = filepath.Join(paths.ConfigDir(), "templates")
+	core.ABIDir = filepath.Join(paths.ConfigDir(), "abis")
+	secrets.DefaultStoreFile = filepath.Join(paths.DataDir(), "secrets.json")
+	tx.DefaultJobFile = filepath.Join(paths.Resolve("history"), "jobs.json")
+	policy.DefaultBundleStateFile = filepath.Join(paths.ConfigDir(), "bundle-state.json")
+	keystore.DefaultProfilesFile = filepath.Join(paths.ConfigDir(), "profiles.json")
+	core.PresetsFile = filepath.Join(paths.ConfigDir(), "derivation-presets.json")
+	defaults := map[string]string{
+		"keystore":      keystore.DefaultKeystoreDir,
+		"token-file":    filepath.Join(keystore.DefaultKeystoreDir, "serve.token"),
+		"policy":        paths.Resolve("policy"),
+		"log-file":      filepath.Join(paths.LogDir(), "serve.log"),
+		"audit-log":     audit.DefaultLogFile,
+		"audit-key":     audit.DefaultKeyFile,
+		"anchors":       audit.DefaultAnchorFile,
+		"socket":        agent.Socket(),
+		"templates":     templates.Dir,
+		"secrets-store": secrets.DefaultStoreFile,
+		"bundle-state":  policy.DefaultBundleStateFile,
+		"profiles":      keystore.DefaultProfilesFile,
+	}
+	historyFiles := map[string]bool{"history": true, "leases": true, "schedule": true, "simulation-cache": true, "orders": true, "price-cache": true}
+	var err error
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || err != nil {
+			return
+		}
+		value, ok := defaults[f.Name]
+		if historyFiles[f.Name] {
+			value, ok = filepath.Join(paths.Resolve("history"), filepath.Base(f.DefValue)), true
+		}
+		if ok {
+			err = f.Value.Set(value)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply portable defaults: %v", err)
+	}
+
+	// The portable commands inspect and repair the manifest themselves
+	for p := c; p != nil; p = p.Parent() {
+		if p == PortableCmd {
+			return nil
+		}
+	}
+
+	changes, err := paths.Verify(root)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		var list []string
+		for _, change := range changes {
+			list = append(list, change.Change+" "+change.Path)
+		}
+		return fmt.Errorf("portable vault %s does not match its manifest (%s); review with 'portable verify' and accept with 'portable seal'",
+			root, strings.Join(list, ", "))
+	}
+	portableVerified = true
+	return nil
+}
+
+// SealPortable records the changes a command made to a verified portable vault
+func SealPortable() error {
+	if !portableVerified {
+		return nil
+	}
+	if err := paths.Seal(paths.PortableRoot()); err != nil {
+		return fmt.Errorf("failed to seal portable vault: %v", err)
+	}
+	return nil
+}
+
+// requirePortable returns the root of the portable vault in use
+func requirePortable() (string, error) {
+	root := paths.PortableRoot()
+	if root == "" {
+		return "", fmt.Errorf("no portable vault in use; pass --portable <dir>")
+	}
+	return root, nil
+}
+
+// copyExecutable copies the running executable into a directory
+func copyExecutable(dir string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %v", err)
+	}
+	in, err := os.Open(exe)
+	if err != nil {
+		return fmt.Errorf("failed to open executable: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(filepath.Join(dir, filepath.Base(exe)), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to copy executable: %v", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy executable: %v", err)
+	}
+	return out.Close()
+}
+
+func init() {
+	// Add flags
+	portableInitCmd.Flags().BoolVar(&portableCopyBinary, "copy-binary", false, "Copy this executable into the vault so it is used automatically")
+
+	// Add commands
+	PortableCmd.AddCommand(portableInitCmd)
+	PortableCmd.AddCommand(portableVerifyCmd)
+	PortableCmd.AddCommand(portableSealCmd)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	abiFiles    []string
+	signatureDB string
+	lookup4byte bool
+)
+
+// newCallDecoder creates a calldata decoder from the built-in ABIs, the ABI
+// library, --abi files and the --4byte-db signature database
+func newCallDecoder() (*core.CallDecoder, error) {
+	decoder := core.NewCallDecoder()
+	if err := decoder.LoadABIDir(core.ABIDir); err != nil {
+		return nil, err
+	}
+	for _, path := range abiFiles {
+		if err := decoder.LoadABIFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if signatureDB != "" {
+		if err := decoder.LoadSignatureDatabase(signatureDB); err != nil {
+			return nil, err
+		}
+	}
+	return decoder, nil
+}
+
+// previewTransaction prints a human-readable summary of the transaction
+func previewTransaction(transaction *core.Transaction, chain *core.ChainConfig, from common.Address) error {
+	book, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Transaction preview")
+	fmt.Printf("  Chain:      %s (chain ID %s)\n", chain.Name, transaction.ChainID)
+	fmt.Printf("  From:       %s\n", labeled(book, from))
+	if transaction.To != nil {
+		fmt.Printf("  To:         %s\n", labeled(book, *transaction.To))
+		warnUnknownAddress(book, *transaction.To, "destination")
+	} else {
+		fmt.Printf("  To:         (contract creation at %s)\n", transaction.ContractAddress(from).Hex())
+	}
+	fmt.Printf("  Value:      %s\n", formatNative(chain, transaction.Value))
+	fmt.Printf("  Nonce:      %d\n", transaction.Nonce)
+	fmt.Printf("  Gas limit:  %d\n", transaction.GasLimit)
+	if transaction.IsDynamicFee() {
+		fmt.Printf("  Max fee/gas: %s gwei (priority %s gwei)\n", core.FormatTokenAmount(transaction.MaxFeePerGas, 9),
+			core.FormatTokenAmount(transaction.MaxPriorityFeePerGas, 9))
+	} else if transaction.GasPrice != nil {
+		fmt.Printf("  Gas price:  %s gwei\n", core.FormatTokenAmount(transaction.GasPrice, 9))
+	}
+	if feeCap := transaction.FeeCap(); feeCap != nil {
+		maxFee := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(transaction.GasLimit))
+		fmt.Printf("  Max fee:    %s\n", formatNative(chain, maxFee))
+	}
+	if transaction.IsBlob() {
+		blobGas := new(big.Int).SetUint64(uint64(len(transaction.BlobHashes)) * params.BlobTxBlobGasPerBlob)
+		fmt.Printf("  Blobs:      %d (max %s gwei per blob gas, up to %s)\n", len(transaction.BlobHashes),
+			core.FormatTokenAmount(transaction.MaxFeePerBlobGas, 9), formatNative(chain, new(big.Int).Mul(blobGas, transaction.MaxFeePerBlobGas)))
+		if transaction.Sidecar == nil {
+			fmt.Println("  Warning: the payload carries no blobs; the signed transaction cannot be broadcast without them")
+		}
+	}
+
+	if len(transaction.Data) == 0 || transaction.To == nil {
+		if len(transaction.Data) > 0 {
+			fmt.Printf("  Data:       %d bytes of contract code\n", len(transaction.Data))
+		}
+		return nil
+	}
+
+	decoder, err := newCallDecoder()
+	if err != nil {
+		return err
+	}
+
+	// Ask the 4byte directory about selectors no local ABI knows
+	var selector [4]byte
+	copy(selector[:], transaction.Data)
+	if lookup4byte && len(transaction.Data) >= 4 && !decoder.HasSelector(selector) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		signatures, err := tx.LookupSelector(ctx, selector)
+		cancel()
+		if err != nil {
+			fmt.Printf("  Warning: 4byte lookup failed: %v\n", err)
+		}
+		for _, signature := range signatures {
+			_ = decoder.AddSignature(signature)
+		}
+	}
+
+	call, err := decoder.Decode(transaction.Data)
+	if err != nil {
+		fmt.Printf("  Function:   %v\n", err)
+		fmt.Printf("  Data:       0x%x\n", transaction.Data)
+		fmt.Println("  Warning: calldata could not be decoded; verify it independently before signing")
+		return nil
+	}
+
+	fmt.Printf("  Function:   %s\n", call.Signature)
+	for _, arg := range call.Args {
+		value := arg.Value
+		if arg.Type == "address" && common.IsHexAddress(value) {
+			value = labeled(book, common.HexToAddress(value))
+		}
+		fmt.Printf("    %s (%s): %s\n", arg.Name, arg.Type, value)
+	}
+
+	// A token transfer really goes to the recipient in its calldata
+	if recipient, _, err := core.DecodeERC20Transfer(transaction.Data); err == nil {
+		warnUnknownAddress(book, recipient, "token recipient")
+	}
+	return nil
+}
+
+// formatWei formats a wei amount in whole ether units
+func formatWei(value *big.Int) string {
+	return core.FormatTokenAmount(value, 18)
+}
+
+// formatNative formats an amount of the chain's native currency with its symbol
+func formatNative(chain *core.ChainConfig, value *big.Int) string {
+	symbol, decimals := chain.GasTokenInfo()
+	return core.FormatTokenAmount(value, decimals) + " " + symbol
+}
+
+func init() {
+	signTxCmd.Flags().StringSliceVar(&abiFiles, "abi", nil, "ABI files used to decode calldata")
+	signTxCmd.Flags().StringVar(&signatureDB, "4byte-db", "", "Local 4byte signature database (JSON selector -> signatures)")
+	signTxCmd.Flags().BoolVar(&lookup4byte, "4byte-lookup", false, "Look up unknown selectors in the online 4byte directory")
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profilesFile  string
+	allProfiles   bool
+	profileRouted bool
+)
+
+var keysProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "Manage the keystore profiles searched with --all-profiles",
+	Long: `Name file keystores kept in other directories, such as a work keystore or one on a USB
+drive, as profiles. 'keys list', 'keys find' and the signing commands take --all-profiles to
+search every profile and the --keystore in use for a key, so a key can be named or given by
+address without remembering which keystore holds it.`,
+}
+
+var keysProfilesAddCmd = &cobra.Command{
+	Use:   "add NAME KEYSTORE_DIR",
+	Short: "Add a keystore profile",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := keystore.AddProfile(profilesFile, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Added profile %s\n", args[0])
+		return nil
+	},
+}
+
+var keysProfilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the keystore profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := keystore.SearchProfiles(profilesFile, keystoreDir)
+		if err != nil {
+			return err
+		}
+		output.Result(profiles)
+		for _, profile := range profiles {
+			available := ""
+			if _, err := os.Stat(profile.Keystore); err != nil {
+				available = "  (not available)"
+			}
+			fmt.Printf("- %-12s %s%s\n", profile.Name, profile.Keystore, available)
+		}
+		return nil
+	},
+}
+
+var keysProfilesRemoveCmd = &cobra.Command{
+	Use:   "remove NAME",
+	Short: "Remove a keystore profile, leaving its keystore untouched",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := keystore.RemoveProfile(profilesFile, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed profile %s\n", args[0])
+		return nil
+	},
+}
+
+var keysFindCmd = &cobra.Command{
+	Use:   "find NAME|ADDRESS",
+	Short: "Find the keystore holding a key",
+	Long: `Look up a key by name or address in the --keystore in use, or with --all-profiles in every
+keystore profile, and show which profile and directory hold it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matches, err := findProfileKeys(args[0])
+		if err != nil {
+			return err
+		}
+		if matches == nil {
+			matches = []*keyInfo{}
+		}
+		output.Result(matches)
+		if listJSON {
+			data, err := json.MarshalIndent(matches, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal keys: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if len(matches) == 0 {
+			return fmt.Errorf("%w: %s", keystore.ErrKeyNotFound, args[0])
+		}
+		for _, info := range matches {
+			fmt.Printf("- %s  %s  %s  %s  %s\n", info.Profile, info.Name, info.Address, info.State, info.Keystore)
+		}
+		return nil
+	},
+}
+
+// searchedProfiles returns the profiles to search: every profile with
+// --all-profiles, otherwise only the --keystore in use
+func searchedProfiles() ([]keystore.StoreProfile, error) {
+	profiles, err := keystore.SearchProfiles(profilesFile, keystoreDir)
+	if err != nil || allProfiles {
+		return profiles, err
+	}
+	return profiles[:1], nil
+}
+
+// listProfileKeys lists the keys of the searched profiles. Keystores that
+// are not available, such as an unmounted drive, are skipped with a warning.
+func listProfileKeys(tags []string) ([]*keyInfo, error) {
+	profiles, err := searchedProfiles()
+	if err != nil {
+		return nil, err
+	}
+	var infos []*keyInfo
+	for _, profile := range profiles {
+		// The manager would create a missing directory
+		if _, err := os.Stat(profile.Keystore); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: keystore of profile %s is not available: %v\n", profile.Name, err)
+			continue
+		}
+		manager, err := keystore.NewManager(profile.Keystore)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := listKeyInfos(manager, tags)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+		for _, info := range keys {
+			info.Profile, info.Keystore = profile.Name, profile.Keystore
+		}
+		infos = append(infos, keys...)
+	}
+	return infos, nil
+}
+
+// findProfileKeys returns the keys of the searched profiles named by query,
+// a key name or an address
+func findProfileKeys(query string) ([]*keyInfo, error) {
+	infos, err := listProfileKeys(nil)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*keyInfo
+	for _, info := range infos {
+		if common.IsHexAddress(query) {
+			if strings.EqualFold(info.Address, common.HexToAddress(query).Hex()) {
+				matches = append(matches, info)
+			}
+		} else if info.Name == query {
+			matches = append(matches, info)
+		}
+	}
+	return matches, nil
+}
+
+// routeKeyToProfile points --keystore and --name at the profile holding the
+// key named by --name, a key name or address, when --all-profiles is given.
+// A key found in several profiles must be picked with --keystore instead.
+func routeKeyToProfile() error {
+	if !allProfiles || profileRouted || useHW || keystoreBackend != "file" || keyName == "" {
+		return nil
+	}
+	matches, err := findProfileKeys(keyName)
+	if err != nil {
+		return err
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("%w in any profile: %s", keystore.ErrKeyNotFound, keyName)
+	case 1:
+	default:
+		found := make([]string, len(matches))
+		for i, info := range matches {
+			found[i] = info.Profile + ":" + info.Name
+		}
+		return fmt.Errorf("key %s is held by several profiles (%s); select one with --keystore", keyName, strings.Join(found, ", "))
+	}
+
+	// The address book stays the one of the keystore in use
+	if addressBookFile == "" {
+		addressBookFile = addressBookPath()
+	}
+	keystoreDir, keyName = matches[0].Keystore, matches[0].Name
+	profileRouted = true
+	if matches[0].Profile != keystore.DefaultProfileName {
+		fmt.Fprintf(os.Stderr, "Using key %s of profile %s (%s)\n", keyName, matches[0].Profile, keystoreDir)
+	}
+	return nil
+}
+
+// addProfileFlags adds --all-profiles and the profiles file to a command
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&allProfiles, "all-profiles", false, "Search every keystore profile for the key (see 'keys profiles')")
+	cmd.PersistentFlags().StringVar(&profilesFile, "profiles", keystore.DefaultProfilesFile, "Keystore profiles file")
+}
+
+func init() {
+	// Add flags
+	keysProfilesCmd.PersistentFlags().StringVar(&profilesFile, "profiles", keystore.DefaultProfilesFile, "Keystore profiles file")
+	addProfileFlags(keysFindCmd)
+	addProfileFlags(listCmd)
+	keysFindCmd.Flags().StringVar(&metaPassword, "meta-password", "", "Key metadata password (defaults to $"+metaPasswordEnv+")")
+	keysFindCmd.Flags().BoolVar(&listJSON, "json", false, "Print the keys as JSON")
+
+	// Add commands
+	keysProfilesCmd.AddCommand(keysProfilesAddCmd)
+	keysProfilesCmd.AddCommand(keysProfilesListCmd)
+	keysProfilesCmd.AddCommand(keysProfilesRemoveCmd)
+	KeysCmd.AddCommand(keysProfilesCmd)
+	KeysCmd.AddCommand(keysFindCmd)
+}
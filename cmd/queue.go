@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	queueMaxBaseFee    string
+	queueAfter         string
+	queueConfirmations uint64
+	queueExpires       string
+)
+
+var txQueueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Hold signed transactions until a time or chain condition",
+	Long: `Hold transactions signed now in the schedule of the 'serve' daemon and broadcast them once
+their start time has come and their release conditions are met: the base fee has dropped to a
+threshold, or an earlier transaction has enough confirmations. Keys stay locked at broadcast time.`,
+}
+
+var txQueueAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Hold a signed transaction until its release conditions are met",
+	Long: `Hold a signed transaction for the 'serve' daemon. It is released once --not-before has
+passed (default: now) and every condition given is met: the base fee of the latest block is at
+most --max-base-fee, and the --after transaction succeeded with --confirmations confirmations.
+Once released it must be included within --deadline, releasing the fee levels of a ladder
+across that window. A transaction whose conditions are not met by --expires is aborted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := resolveNotifyTemplate(); err != nil {
+			return err
+		}
+		payload, err := readSignedPayload()
+		if err != nil {
+			return err
+		}
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+		if err := checkRawCapabilities(chain, common.FromHex(payload.RawTransaction)); err != nil {
+			return err
+		}
+
+		endpoints := rpcURLs
+		if len(endpoints) == 0 {
+			endpoints = []string{chain.RPCURL}
+		}
+		return scheduleBroadcast(payload, chain, endpoints)
+	},
+}
+
+var txQueueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List held transactions with their conditions and timeline",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listScheduled()
+	},
+}
+
+var txQueueReleaseCmd = &cobra.Command{
+	Use:   "release <hash>",
+	Short: "Broadcast a held transaction without waiting for its conditions",
+	Long: `Release a waiting transaction: the 'serve' daemon submits it at its next poll, ignoring its
+start time and release conditions. The hash may be shortened to a unique prefix.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schedule, err := tx.OpenSchedule(scheduleFile)
+		if err != nil {
+			return err
+		}
+		entry, err := schedule.Release(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Released %s; the 'serve' daemon submits it within a few seconds\n", entry.ID)
+		return nil
+	},
+}
+
+var txQueueCancelCmd = &cobra.Command{
+	Use:   "cancel <hash>",
+	Short: "Withdraw a held transaction before it is broadcast",
+	Long: `Withdraw a waiting transaction from the schedule, so it is never broadcast. The transaction
+stays valid: anyone holding the signed payload can still submit it until its nonce is used, e.g.
+with 'tx cancel'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schedule, err := tx.OpenSchedule(scheduleFile)
+		if err != nil {
+			return err
+		}
+		entry, err := schedule.Cancel(args[0])
+		if err != nil {
+			return err
+		}
+		if err := auditBroadcast(audit.OutcomeWithdrawn, entry.Payload, common.Hash{}, "withdrawn from the schedule"); err != nil {
+			return err
+		}
+		fmt.Printf("Withdrew %s from the schedule\n", entry.ID)
+		return nil
+	},
+}
+
+// releaseConditions builds the release conditions of 'tx queue add', or nil
+// if none are given
+func releaseConditions() (*tx.ReleaseConditions, error) {
+	if queueMaxBaseFee == "" && queueAfter == "" {
+		if queueExpires != "" {
+			return nil, fmt.Errorf("--expires needs --max-base-fee or --after")
+		}
+		return nil, nil
+	}
+
+	conditions := &tx.ReleaseConditions{}
+	if queueMaxBaseFee != "" {
+		fee, err := core.ParseAmount(queueMaxBaseFee, rounding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --max-base-fee: %v", err)
+		}
+		conditions.MaxBaseFee = fee
+	}
+	if queueAfter != "" {
+		hashBytes := common.FromHex(queueAfter)
+		if len(hashBytes) != common.HashLength {
+			return nil, fmt.Errorf("invalid --after transaction hash: %s", queueAfter)
+		}
+		hash := common.BytesToHash(hashBytes)
+		conditions.After = &hash
+		conditions.Confirmations = queueConfirmations
+	}
+	if queueExpires != "" {
+		expires, err := parseTimeOrDelay(queueExpires)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expires: %v", err)
+		}
+		conditions.Expires = expires
+	}
+	return conditions, nil
+}
+
+// listScheduled prints the broadcasts of --schedule with their conditions and timeline
+func listScheduled() error {
+	schedule, err := tx.OpenSchedule(scheduleFile)
+	if err != nil {
+		return err
+	}
+	entries, err := schedule.Entries()
+	if err != nil {
+		return err
+	}
+	output.Result(entries)
+
+	if len(entries) == 0 {
+		fmt.Println("No scheduled broadcasts")
+		return nil
+	}
+
+	for _, entry := range entries {
+		deadline := entry.Deadline.Format(time.RFC3339)
+		if entry.Deadline.IsZero() {
+			deadline = fmt.Sprintf("%s after release", entry.Window)
+		}
+		fmt.Printf("%s on %s: %s, %s to %s\n", entry.ID, entry.Chain, entry.Status,
+			entry.NotBefore.Format(time.RFC3339), deadline)
+		if entry.Conditions != nil {
+			fmt.Printf("  released on: %s\n", entry.Conditions)
+		}
+		if entry.Retry != nil && entry.Status == tx.ScheduleWaiting {
+			fmt.Printf("  held for unreachable endpoints: %d attempts, next at %s, expires %s\n", entry.Retry.Attempts,
+				entry.Retry.NextAttempt.Format(time.RFC3339), entry.Retry.Expires.Format(time.RFC3339))
+		}
+		for _, event := range entry.Timeline {
+			fmt.Printf("  %s %s", event.Time.Format(time.RFC3339), event.Event)
+			if event.Detail != "" {
+				fmt.Printf(": %s", event.Detail)
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+func init() {
+	// Add flags
+	txQueueAddCmd.Flags().StringVar(&inputFile, "input", "", "Signed transaction file")
+	txQueueAddCmd.Flags().BoolVar(&qrMode, "qr", false, "Scan the signed transaction from QR codes")
+	txQueueAddCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	txQueueAddCmd.Flags().StringSliceVar(&rpcURLs, "rpc", nil, "RPC endpoint to broadcast through and check conditions at (repeatable, defaults to the chain's RPC URL)")
+	txQueueAddCmd.Flags().StringVar(&notBefore, "not-before", "", "Hold the transaction until this RFC 3339 time or delay (e.g. 2h)")
+	txQueueAddCmd.Flags().StringVar(&queueMaxBaseFee, "max-base-fee", "", "Release once the base fee is at most this amount (e.g. 15gwei)")
+	txQueueAddCmd.Flags().StringVar(&queueAfter, "after", "", "Release once this transaction succeeded with --confirmations confirmations")
+	txQueueAddCmd.Flags().Uint64Var(&queueConfirmations, "confirmations", 1, "Confirmations of the --after transaction")
+	txQueueAddCmd.Flags().StringVar(&queueExpires, "expires", "", "Abort if the conditions are not met by this RFC 3339 time or delay")
+	txQueueAddCmd.Flags().DurationVar(&ladderDeadline, "deadline", 5*time.Minute, "Time after release by which the transaction must be included; ladder levels are released across it")
+	txQueueAddCmd.Flags().StringVar(&notifyURL, "notify", "", "Webhook or smtp:// address (or secret reference) notified if the transaction is aborted")
+	txQueueAddCmd.Flags().StringVar(&notifyTemplate, "notify-template", tx.NotifyTemplateJSON, "Notification content: json, slack, text or a Go template file (see 'tx broadcast --help')")
+	txQueueAddCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addAuditFlags(txQueueAddCmd)
+
+	addAuditFlags(txQueueCancelCmd)
+	txQueueCmd.PersistentFlags().StringVar(&scheduleFile, "schedule", tx.DefaultScheduleFile, "Schedule of held transactions")
+
+	// Add commands
+	txQueueCmd.AddCommand(txQueueAddCmd)
+	txQueueCmd.AddCommand(txQueueListCmd)
+	txQueueCmd.AddCommand(txQueueReleaseCmd)
+	txQueueCmd.AddCommand(txQueueCancelCmd)
+	TxCmd.AddCommand(txQueueCmd)
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var gasBump string
+
+var txSpeedupCmd = &cobra.Command{
+	Use:   "speedup <hash>",
+	Short: "Replace a pending transaction with the same one at a higher fee",
+	Long: `Fetch a pending transaction, re-sign it with the same nonce at fees raised by --gas-bump (and
+to at least what the chain currently suggests) and broadcast the replacement. --input takes the
+signed original when the RPC endpoint no longer knows it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return replaceTransaction(cmd, args[0], false)
+	},
+}
+
+var txCancelCmd = &cobra.Command{
+	Use:   "cancel <hash>",
+	Short: "Replace a pending transaction with a zero-value self-send",
+	Long: `Fetch a pending transaction and replace it with a zero-value transfer from the sender to itself
+with the same nonce at fees raised by --gas-bump. Once the replacement is included the original
+can no longer be. --input takes the signed original when the RPC endpoint no longer knows it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return replaceTransaction(cmd, args[0], true)
+	},
+}
+
+// replaceTransaction signs and broadcasts a replacement of a pending
+// transaction: the same transaction for a speed-up, or a self-send to cancel it
+func replaceTransaction(cmd *cobra.Command, hashArg string, cancel bool) error {
+	hashBytes := common.FromHex(hashArg)
+	if len(hashBytes) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash: %s", hashArg)
+	}
+	hash := common.BytesToHash(hashBytes)
+	bump, err := core.ParsePercent(gasBump)
+	if err != nil {
+		return fmt.Errorf("invalid --gas-bump: %v", err)
+	}
+
+	// Load chain config
+	chain, err := core.GetChainConfig(chainName)
+	if err != nil {
+		return fmt.Errorf("failed to get chain config: %v", err)
+	}
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancelCtx()
+
+	// Find the original on the chain or in the signed file
+	original, err := readReplaceable(ctx, chain, hash)
+	if err != nil {
+		return err
+	}
+	if chainID := original.Transaction.ChainId(); original.Transaction.Protected() && chainID.Cmp(chain.ChainID) != 0 {
+		return fmt.Errorf("transaction is for chain ID %s, not %s (%s)", chainID, chain.ChainID, chain.Name)
+	}
+	if err := original.CheckNonceOpen(ctx, chain.RPCURL); err != nil {
+		return err
+	}
+
+	build := original.SpeedUp
+	if cancel {
+		build = original.Cancel
+	}
+	transaction, err := build()
+	if err != nil {
+		return err
+	}
+	transaction.ChainID = chain.ChainID
+	if err := tx.BumpFees(ctx, chain.RPCURL, transaction, bump); err != nil {
+		return err
+	}
+	explain("nonce", "nonce %d reused from %s", transaction.Nonce, hash.Hex())
+	explain("fees", "fees raised by %s over the original and to at least the current suggestion of %s", gasBump, endpointName(chain.RPCURL))
+	if err := checkChainCapabilities(chain, transaction.ToEthereumTx()); err != nil {
+		return err
+	}
+
+	// Open the key's backend or the hardware wallet
+	signer, release, err := openSelectedSigner(cmd)
+	if err != nil {
+		return err
+	}
+	defer release()
+	from := signer.Address()
+	if from != original.From {
+		return fmt.Errorf("transaction was sent by %s, not by the selected key %s", original.From.Hex(), from.Hex())
+	}
+
+	// Replacements are signed like any other transaction. The duplicate check
+	// is skipped since a speed-up repeats the original on purpose.
+	signingPolicy, err := loadPolicy(cmd)
+	if err != nil {
+		return err
+	}
+	history, err := openHistory()
+	if err != nil {
+		return err
+	}
+	decisions, err := enforcePolicy(signingPolicy, history, transaction, signer, keyName)
+	if err != nil {
+		return auditRefusal(chainName, signerName(), from, transaction, decisions, err)
+	}
+
+	// Show what is being signed and ask for confirmation
+	action := "Speed up"
+	if cancel {
+		action = "Cancel"
+	}
+	fmt.Printf("%s %s (nonce %d)\n", action, hash.Hex(), transaction.Nonce)
+	if err := previewTransaction(transaction, chain, from); err != nil {
+		return err
+	}
+	ok, err := confirm("Sign and broadcast the replacement?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("replacement aborted by user")
+	}
+
+	// Sign replacement
+	signedTx, err := signer.SignTx(transaction)
+	if err != nil {
+		return err
+	}
+	payload := &tx.SignedPayload{
+		Version:        tx.PayloadVersion,
+		Chain:          chainName,
+		ChainID:        chain.ChainID,
+		Hash:           crypto.Keccak256Hash(common.FromHex(signedTx)),
+		RawTransaction: signedTx,
+	}
+	if err := history.RecordSigned(signedRecord(transaction, from, signedTx)); err != nil {
+		return fmt.Errorf("failed to record transaction in history: %v", err)
+	}
+	if err := auditTransaction(audit.OutcomeSigned, chainName, signerName(), from, transaction, &payload.Hash, decisions); err != nil {
+		return err
+	}
+	if outputFile != "" {
+		if err := ioutil.WriteFile(outputFile, []byte(signedTx), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+	}
+
+	// Broadcast replacement
+	broadcaster, err := tx.NewBroadcaster([]string{chain.RPCURL})
+	if err != nil {
+		return err
+	}
+	rawTx := common.FromHex(signedTx)
+	replacement, err := broadcaster.Broadcast(ctx, rawTx)
+	if err != nil {
+		if auditErr := auditBroadcast(audit.OutcomeFailed, payload, common.Hash{}, err.Error()); auditErr != nil {
+			fmt.Printf("Warning: %v\n", auditErr)
+		}
+		return err
+	}
+	if err := auditBroadcast(audit.OutcomeBroadcast, payload, replacement, ""); err != nil {
+		return err
+	}
+
+	// Point the original's history at its replacement
+	event := tx.TimelineEvent{Time: time.Now(), Event: "replaced", Hash: &replacement, Detail: action}
+	if err := history.RecordTimeline(hash, chain.ChainID.String(), tx.StatusReplaced, []tx.TimelineEvent{event}); err != nil {
+		fmt.Printf("Warning: failed to record replacement in history: %v\n", err)
+	}
+	if err := markLeaseBroadcast(rawTx); err != nil {
+		fmt.Printf("Warning: failed to update nonce lease: %v\n", err)
+	}
+
+	fmt.Printf("Replacement broadcast: %s\n", replacement.Hex())
+	if chain.Explorer != "" {
+		fmt.Printf("Explorer: %s/tx/%s\n", chain.Explorer, replacement.Hex())
+	}
+	return nil
+}
+
+// readReplaceable returns the transaction to replace from the chain, or from
+// the signed file given with --input
+func readReplaceable(ctx context.Context, chain *core.ChainConfig, hash common.Hash) (*tx.Replaceable, error) {
+	if inputFile == "" {
+		original, err := tx.FetchReplaceable(ctx, chain.RPCURL, hash)
+		if errors.Is(err, tx.ErrTransactionUnknown) {
+			return nil, fmt.Errorf("%v on %s; pass the signed original with --input", err, endpointName(chain.RPCURL))
+		}
+		return original, err
+	}
+
+	payload, err := readSignedPayload()
+	if err != nil {
+		return nil, err
+	}
+	var transaction types.Transaction
+	if err := transaction.UnmarshalBinary(common.FromHex(payload.RawTransaction)); err != nil {
+		return nil, fmt.Errorf("failed to decode signed transaction: %v", err)
+	}
+	if transaction.Hash() != hash {
+		return nil, fmt.Errorf("--input holds transaction %s, not %s", transaction.Hash().Hex(), hash.Hex())
+	}
+	return tx.NewReplaceable(&transaction)
+}
+
+// addReplaceFlags adds the flags shared by speedup and cancel
+func addReplaceFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	cmd.PersistentFlags().StringVar(&inputFile, "input", "", "Signed original, if the RPC endpoint no longer knows it")
+	cmd.PersistentFlags().StringVar(&gasBump, "gas-bump", tx.DefaultReplacementBump, "Fee increase over the original in percent (at least 10%)")
+	cmd.PersistentFlags().StringVar(&outputFile, "output", "", "Also save the signed replacement to this file")
+	cmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	cmd.PersistentFlags().StringVar(&keyName, "name", "", "Key name")
+	cmd.PersistentFlags().StringVar(&password, "password", "", "Key password")
+	cmd.PersistentFlags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	cmd.PersistentFlags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	cmd.PersistentFlags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	cmd.PersistentFlags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	cmd.PersistentFlags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	cmd.PersistentFlags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	cmd.PersistentFlags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	cmd.PersistentFlags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	cmd.PersistentFlags().BoolVar(&override, "override", false, "Sign even if the replacement violates the policy")
+	addSimulationCacheFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addKeystoreBackendFlags(cmd)
+	addSignerFlags(cmd)
+	addAddressBookFlags(cmd)
+	addAuditFlags(cmd)
+}
+
+func init() {
+	// Add flags
+	addReplaceFlags(txSpeedupCmd)
+	addReplaceFlags(txCancelCmd)
+
+	// Add commands
+	TxCmd.AddCommand(txSpeedupCmd)
+	TxCmd.AddCommand(txCancelCmd)
+}
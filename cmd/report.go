@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportKeys     []string
+	reportFormat   string
+	reportTop      int
+	fiatCurrencies []string
+	priceCacheFile string
+)
+
+// ReportCmd is the root command for reports built from the history
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report on recorded transactions",
+	Long:  `Aggregate the transaction history into reports, e.g. for finance teams running operational wallets.`,
+}
+
+var reportSpendingCmd = &cobra.Command{
+	Use:   "spending",
+	Short: "Report value sent, fees, counterparties and failures per key and chain",
+	Long: `Aggregate the recorded transactions of keys per chain: transactions sent, confirmed, failed
+and pending, the failure rate of mined transactions, the value of confirmed transactions,
+the gas fees paid and the counterparties by value received. --key takes file keystore key
+names or addresses and may be repeated; without it every sender in the history is reported.
+Replaced transactions are left out, since their replacement carries the nonce.
+
+--currency adds the value and fees in fiat currencies, each transaction priced on the day
+it was recorded (see 'tx history export --help').
+
+--format table prints amounts in the chain's currency; csv and json give them in wei. The CSV
+has one totals row per key and chain, followed by one row per counterparty.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := reportSenders(reportKeys)
+		if err != nil {
+			return err
+		}
+		filter, err := historyFilter()
+		if err != nil {
+			return err
+		}
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+		records := history.Query(filter)
+		values, err := fiatValues(cmd.Context(), records)
+		if err != nil {
+			return err
+		}
+		reports := tx.BuildSpendingReports(records, keys, values)
+		output.Result(reports)
+
+		var w io.Writer = os.Stdout
+		if outputFile != "" {
+			f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %v", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch reportFormat {
+		case "table":
+			err = writeSpendingTable(w, reports)
+		case "csv":
+			var currencies []string
+			if values != nil {
+				currencies = values.Currencies
+			}
+			err = tx.WriteSpendingCSV(w, reports, currencies)
+		case "json":
+			err = tx.WriteSpendingJSON(w, reports)
+		default:
+			return fmt.Errorf("unknown format %q (expected table, csv or json)", reportFormat)
+		}
+		if err != nil {
+			return err
+		}
+		if outputFile != "" {
+			fmt.Printf("Wrote spending of %d senders to: %s\n", len(reports), outputFile)
+		}
+		return nil
+	},
+}
+
+// reportSenders maps the addresses of --key values to their key names. Key
+// names are looked up in the file keystore; addresses are taken as they are.
+func reportSenders(values []string) (map[string]string, error) {
+	senders := make(map[string]string)
+	var names []string
+	for _, value := range values {
+		if common.IsHexAddress(value) {
+			senders[strings.ToLower(common.HexToAddress(value).Hex())] = ""
+		} else {
+			names = append(names, value)
+		}
+	}
+	if len(names) == 0 {
+		return senders, nil
+	}
+
+	manager, err := keystore.NewManager(keystoreDir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := listKeyInfos(manager, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		found := false
+		for _, info := range infos {
+			if info.Name == name {
+				senders[strings.ToLower(info.Address)] = name
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", keystore.ErrKeyNotFound, name)
+		}
+	}
+	return senders, nil
+}
+
+// addFiatFlags adds the flags valuing transactions in fiat currencies
+func addFiatFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&fiatCurrencies, "currency", nil, "Value transactions in these fiat currencies at the price of their day (e.g. USD,EUR)")
+	cmd.Flags().StringVar(&priceSource, "price-source", "", "Historical prices from coingecko (default) or file:PATH")
+	cmd.Flags().StringVar(&priceCacheFile, "price-cache", tx.DefaultPriceCacheFile, "Cache of daily prices (empty to disable)")
+}
+
+// fiatValues values records in the --currency currencies at the prices of
+// their days, or returns nil without --currency
+func fiatValues(ctx context.Context, records []*tx.TransactionRecord) (*tx.FiatValues, error) {
+	if len(fiatCurrencies) == 0 {
+		return nil, nil
+	}
+	source, err := tx.NewHistoricalPriceSource(firstNonEmpty(priceSource, "coingecko"))
+	if err != nil {
+		return nil, err
+	}
+	prices, err := tx.NewPriceHistory(source, priceCacheFile)
+	if err != nil {
+		return nil, err
+	}
+	values, err := prices.ValueRecords(ctx, records, fiatCurrencies)
+	// Keep the days priced before a failure for the next attempt
+	if saveErr := prices.Save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return values, err
+}
+
+// writeSpendingTable prints reports with amounts in each chain's currency
+func writeSpendingTable(w io.Writer, reports []*tx.SpendingReport) error {
+	if len(reports) == 0 {
+		_, err := fmt.Fprintln(w, "No transactions found")
+		return err
+	}
+	chains, err := core.Chains()
+	if err != nil {
+		return err
+	}
+	amount := func(chainID string, value *big.Int) string {
+		for _, chain := range chains {
+			if chain.ChainID.String() == chainID {
+				symbol, decimals := chain.GasTokenInfo()
+				return core.FormatTokenAmount(value, decimals) + " " + symbol
+			}
+		}
+		return value.String() + " wei"
+	}
+
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s on chain %s\n", nicknameOf(report.From), report.ChainID)
+		fmt.Fprintf(w, "  transactions  %d (%d confirmed, %d failed, %d pending)\n",
+			report.Transactions, report.Confirmed, report.Failed, report.Pending)
+		fmt.Fprintf(w, "  failure rate  %.1f%%\n", 100*report.FailureRate)
+		fmt.Fprintf(w, "  value sent    %s%s\n", amount(report.ChainID, report.Value), fiatTotals(report, func(t *tx.FiatTotal) float64 { return t.Value }))
+		fmt.Fprintf(w, "  gas fees      %s%s\n", amount(report.ChainID, report.Fees), fiatTotals(report, func(t *tx.FiatTotal) float64 { return t.Fees }))
+		for i, party := range report.Counterparties {
+			if i == reportTop {
+				fmt.Fprintf(w, "  ... %d more counterparties\n", len(report.Counterparties)-reportTop)
+				break
+			}
+			to := "(contract creation)"
+			if party.Address != "" {
+				to = nicknameOf(party.Address)
+			}
+			fmt.Fprintf(w, "  -> %s: %s in %d transactions\n", to, amount(report.ChainID, party.Value), party.Transactions)
+		}
+	}
+	return nil
+}
+
+// fiatTotals formats one of the fiat totals of a report in every currency,
+// e.g. " (4712.30 USD, 4390.12 EUR)"
+func fiatTotals(report *tx.SpendingReport, total func(*tx.FiatTotal) float64) string {
+	if len(report.Fiat) == 0 {
+		return ""
+	}
+	currencies := make([]string, 0, len(report.Fiat))
+	for currency := range report.Fiat {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	parts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		parts[i] = fmt.Sprintf("%.2f %s", total(report.Fiat[currency]), currency)
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func init() {
+	// Add flags
+	reportSpendingCmd.Flags().StringSliceVar(&reportKeys, "key", nil, "Key name or address to report on (repeatable; default: every sender)")
+	reportSpendingCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	reportSpendingCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	reportSpendingCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	reportSpendingCmd.Flags().StringVar(&historySince, "since", "", "Only transactions at or after this date (2006-01-02 or RFC 3339)")
+	reportSpendingCmd.Flags().StringVar(&historyUntil, "until", "", "Only transactions before this date (2006-01-02 or RFC 3339)")
+	reportSpendingCmd.Flags().StringVar(&historyChain, "chain", "", "Only transactions on this chain")
+	reportSpendingCmd.Flags().StringVar(&reportFormat, "format", "table", "Output format (table, csv or json)")
+	reportSpendingCmd.Flags().IntVar(&reportTop, "top", 5, "Counterparties to show per key and chain in the table")
+	reportSpendingCmd.Flags().StringVar(&outputFile, "output", "", "Output file (prints to stdout if empty)")
+	addFiatFlags(reportSpendingCmd)
+	addAddressBookFlags(reportSpendingCmd)
+
+	// Add commands
+	ReportCmd.AddCommand(reportSpendingCmd)
+}
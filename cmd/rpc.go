@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+// DefaultBenchSamples is how many calls each endpoint gets per benchmark
+const DefaultBenchSamples = 10
+
+var (
+	benchChains  []string
+	benchSamples int
+)
+
+// RPCCmd is the root command for RPC endpoint tools
+var RPCCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Inspect the configured RPC endpoints",
+}
+
+var rpcBenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Benchmark RPC endpoints and rank them for fallback selection",
+	Long: `Call eth_blockNumber on every endpoint of a chain --samples times and report the p50 and
+p95 latency, failed calls and how far each head trails the best head among the endpoints.
+Endpoints serving another chain, failing half their calls or trailing by more than two blocks
+are unhealthy.
+
+Results are saved, and for chains with fallback RPCs the endpoints are then tried fastest
+healthy first, then unbenchmarked ones in their configured order, then unhealthy ones.
+Results older than six hours are ignored. The signing daemon re-runs the benchmark every
+--rpc-bench-interval. Without --chain every chain with fallback RPCs is benchmarked.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := benchmarkTargets(benchChains)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no chain has fallback RPCs; pick one with --chain")
+		}
+		benchmarks, err := tx.OpenBenchmarks(tx.DefaultBenchmarkFile)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHAIN\tENDPOINT\tP50\tP95\tHEAD\tLAG\tERRORS\tSTATUS")
+		all := make(map[string][]*tx.EndpointBenchmark)
+		for _, target := range targets {
+			results := tx.BenchmarkEndpoints(ctx, target.ChainID, target.Endpoints, benchSamples)
+			if err := benchmarks.Record(target.Endpoints, results); err != nil {
+				return err
+			}
+			all[target.Name] = results
+			for i, result := range results {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", target.Name, redactEndpoint(target.Endpoints[i]), benchmarkRow(result))
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		for _, target := range targets {
+			if len(target.Endpoints) < 2 {
+				continue
+			}
+			var order []string
+			for _, endpoint := range benchmarks.Rank(target.Endpoints) {
+				order = append(order, redactEndpoint(endpoint))
+			}
+			fmt.Printf("%s endpoints in order of preference: %s\n", target.Name, strings.Join(order, ", "))
+		}
+		output.Result(all)
+		return nil
+	},
+}
+
+// benchmarkRow formats the columns of a benchmark after the endpoint
+func benchmarkRow(result *tx.EndpointBenchmark) string {
+	if result.Error != "" {
+		return fmt.Sprintf("-\t-\t-\t-\t%d/%d\terror: %s", result.Errors, result.Samples, result.Error)
+	}
+	status := "ok"
+	switch {
+	case result.WrongChain:
+		status = fmt.Sprintf("serves chain ID %s", result.ChainID)
+	case !result.Healthy && result.Lag > 2:
+		status = fmt.Sprintf("%d blocks behind", result.Lag)
+	case !result.Healthy:
+		status = "too many errors"
+	}
+	return fmt.Sprintf("%s\t%s\t%d\t%d\t%d/%d\t%s", result.P50.Round(time.Millisecond), result.P95.Round(time.Millisecond),
+		result.Head, result.Lag, result.Errors, result.Samples, status)
+}
+
+// benchmarkTargets returns the endpoints of the named chains, or of every
+// chain with fallback RPCs if none are named
+func benchmarkTargets(names []string) ([]tx.BenchmarkTarget, error) {
+	if len(names) == 0 {
+		all, err := core.ChainNames()
+		if err != nil {
+			return nil, err
+		}
+		chains, err := core.Chains()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range all {
+			if len(chains[name].FallbackRPCs) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+
+	var targets []tx.BenchmarkTarget
+	for _, name := range names {
+		chain, err := core.GetChainConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, tx.BenchmarkTarget{Name: name, ChainID: chain.ChainID, Endpoints: chain.Endpoints()})
+	}
+	return targets, nil
+}
+
+func init() {
+	// Add flags
+	rpcBenchCmd.Flags().StringSliceVar(&benchChains, "chain", nil, "Chain to benchmark (repeatable; default: every chain with fallback RPCs)")
+	rpcBenchCmd.Flags().IntVar(&benchSamples, "samples", DefaultBenchSamples, "Calls per endpoint")
+
+	// Add commands
+	RPCCmd.AddCommand(rpcBenchCmd)
+}
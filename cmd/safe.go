@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	safeSignatureFiles []string
+	safeThreshold      int
+)
+
+// SafeCmd is the root command for Gnosis Safe multisig operations
+var SafeCmd = &cobra.Command{
+	Use:   "safe",
+	Short: "Sign and execute Gnosis Safe transactions",
+	Long: `Compute SafeTxHashes, sign Safe transactions as one of the owners and aggregate the
+collected owner signatures into the final execTransaction call.`,
+}
+
+var safeHashCmd = &cobra.Command{
+	Use:   "hash",
+	Short: "Print the SafeTxHash of a Safe transaction",
+	Long:  `Compute the EIP-712 SafeTxHash of a Safe transaction file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		safeTx, err := core.LoadSafeTransaction(inputFile)
+		if err != nil {
+			return err
+		}
+
+		hash, err := safeTx.Hash()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(hash.Hex())
+		return nil
+	},
+}
+
+var safeSignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a Safe transaction as an owner",
+	Long:  `Sign the SafeTxHash of a Safe transaction with a stored wallet key or a hardware wallet.`,
+	Example: `  # Sign as an owner with a key of the file keystore, or on a Ledger
+  gosignervaultcli safe sign --input safe-tx.json --name owner1 --output sig1.json
+  gosignervaultcli safe sign --input safe-tx.json --hardware --output sig2.json
+
+  # Write a sample safe-tx.json and the full flow with 'examples init safe'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		safeTx, err := core.LoadSafeTransaction(inputFile)
+		if err != nil {
+			return err
+		}
+
+		if err := checkSelectedSigner(cmd, core.CapTypedData); err != nil {
+			return err
+		}
+
+		// Show what is being signed
+		typedData := safeTx.TypedData()
+		summary, err := typedData.Summary()
+		if err != nil {
+			return err
+		}
+		fmt.Print(summary)
+
+		hash, err := safeTx.Hash()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("SafeTxHash: %s\n", hash.Hex())
+		if safeTx.Operation == core.SafeOperationDelegateCall {
+			fmt.Println("Warning: DELEGATECALL runs the target's code with full control over the Safe")
+		}
+
+		ok, err := confirm("Sign this Safe transaction?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		// Sign SafeTxHash
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		raw, err := signer.SignTypedData(typedData)
+		if err != nil {
+			return err
+		}
+		signature, err := safeTx.NewSignature(raw)
+		if err != nil {
+			return err
+		}
+
+		result, err := json.MarshalIndent(signature, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal signature: %v", err)
+		}
+
+		// Write output
+		if err := ioutil.WriteFile(outputFile, result, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		if err := recordAudit(&audit.Record{
+			Operation:   audit.OpSignSafe,
+			Outcome:     audit.OutcomeSigned,
+			Key:         signerName(),
+			Signer:      signature.Signer.Hex(),
+			ChainID:     safeTx.ChainID.String(),
+			PayloadHash: hash,
+			Detail:      fmt.Sprintf("safe %s nonce %s", safeTx.Safe.Hex(), safeTx.Nonce),
+		}); err != nil {
+			return err
+		}
+
+		fmt.Printf("Safe transaction signed by %s and saved to: %s\n", nickname(signature.Signer), outputFile)
+		return nil
+	},
+}
+
+var safeExecuteCmd = &cobra.Command{
+	Use:   "execute",
+	Short: "Aggregate owner signatures into an execTransaction call",
+	Long: `Verify the collected owner signatures and build the unsigned execTransaction transaction
+to the Safe, ready to be signed with 'sign tx' by any account.`,
+	Example: `  # Build the execTransaction call from two owner signatures, then sign it as any account
+  gosignervaultcli safe execute --input safe-tx.json --signature sig1.json --signature sig2.json --threshold 2 --output exec.json
+  gosignervaultcli sign tx --input exec.json --name executor --output signedExec.txt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		safeTx, err := core.LoadSafeTransaction(inputFile)
+		if err != nil {
+			return err
+		}
+
+		// Load collected signatures
+		var signatures []*core.SafeSignature
+		for _, path := range safeSignatureFiles {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read signature file: %v", err)
+			}
+			var signature core.SafeSignature
+			if err := json.Unmarshal(data, &signature); err != nil {
+				return fmt.Errorf("failed to parse signature file %s: %v", path, err)
+			}
+			signatures = append(signatures, &signature)
+		}
+		if len(signatures) < safeThreshold {
+			return fmt.Errorf("collected %d signatures, the Safe threshold is %d", len(signatures), safeThreshold)
+		}
+
+		packed, err := safeTx.AggregateSignatures(signatures)
+		if err != nil {
+			return err
+		}
+
+		data, err := safeTx.ExecTransactionData(packed)
+		if err != nil {
+			return err
+		}
+
+		safe := safeTx.Safe
+		transaction := &core.Transaction{
+			To:      &safe,
+			Value:   new(big.Int),
+			Data:    data,
+			ChainID: safeTx.ChainID,
+		}
+
+		result, err := json.MarshalIndent(transaction, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal transaction: %v", err)
+		}
+
+		// Write output
+		if outputFile == "" {
+			fmt.Println(string(result))
+			return nil
+		}
+		if err := ioutil.WriteFile(outputFile, result, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		fmt.Printf("execTransaction with %d signatures saved to: %s\n", len(signatures), outputFile)
+		return nil
+	},
+}
+
+func init() {
+	// Add flags
+	SafeCmd.PersistentFlags().StringVar(&inputFile, "input", "", "Safe transaction file")
+
+	safeSignCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	safeSignCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	safeSignCmd.Flags().StringVar(&password, "password", "", "Key password")
+	safeSignCmd.Flags().StringVar(&outputFile, "output", "", "Output signature file")
+	safeSignCmd.Flags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	safeSignCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	safeSignCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	safeSignCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	safeSignCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	addKeystoreBackendFlags(safeSignCmd)
+	addSignerFlags(safeSignCmd)
+	addAuditFlags(safeSignCmd)
+
+	safeExecuteCmd.Flags().StringSliceVar(&safeSignatureFiles, "signature", nil, "Owner signature file produced by 'safe sign' (repeatable)")
+	safeExecuteCmd.Flags().IntVar(&safeThreshold, "threshold", 0, "Minimum number of signatures required by the Safe")
+	safeExecuteCmd.Flags().StringVar(&outputFile, "output", "", "Output transaction file (prints to stdout if empty)")
+
+	// Mark required flags
+	SafeCmd.MarkPersistentFlagRequired("input")
+	safeSignCmd.MarkFlagRequired("output")
+	safeExecuteCmd.MarkFlagRequired("signature")
+
+	// Add commands
+	SafeCmd.AddCommand(safeHashCmd)
+	SafeCmd.AddCommand(safeSignCmd)
+	SafeCmd.AddCommand(safeExecuteCmd)
+}
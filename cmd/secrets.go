@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/spf13/cobra"
+)
+
+var (
+	secretStoreFile      string
+	masterPassword       string
+	newMasterPassword    string
+	secretEnvFile        string
+	secretPrefix         string
+	removeSecretsEnvFile bool
+)
+
+// SecretsCmd is the root command for the local secrets store
+var SecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Keep API keys and tokens in the local encrypted secrets store",
+	Long: `Store small secrets such as RPC API keys, vault tokens and webhook secrets encrypted under a
+master password, instead of in plaintext .env files next to the keystore. Chain configs,
+schedules and secret-bearing flags refer to a stored secret as local:NAME, or embed it as
+${local:NAME}; it is decrypted when first used. The master password is read from
+--master-password, $` + secrets.EnvMasterPassword + ` or a prompt. Secret names are stored in the clear.`,
+}
+
+var secretsSetCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Store a secret, replacing one of the same name",
+	Long: `Store a secret under a name. The value is read from a hidden prompt, or from stdin when it
+is piped in, never from the command line. The first secret creates the store and asks for a
+new master password.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := secrets.OpenStore(secretStoreFile)
+		password, err := storePassword(store)
+		if err != nil {
+			return err
+		}
+		value, err := promptSecret("Value of " + args[0])
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return fmt.Errorf("the value of %s is empty", args[0])
+		}
+		if err := store.Set(args[0], value, password); err != nil {
+			return err
+		}
+		fmt.Printf("Stored secret %s; refer to it as local:%s\n", args[0], args[0])
+		return nil
+	},
+}
+
+var secretsGetCmd = &cobra.Command{
+	Use:   "get [name]",
+	Short: "Print a stored secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := secrets.OpenStore(secretStoreFile)
+		password, err := storePassword(store)
+		if err != nil {
+			return err
+		}
+		value, err := store.Get(args[0], password)
+		if err != nil {
+			return err
+		}
+		output.Result(map[string]string{"name": args[0], "value": value})
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored secrets without revealing them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		infos, err := secrets.OpenStore(secretStoreFile).List()
+		if err != nil {
+			return err
+		}
+		output.Result(infos)
+		if len(infos) == 0 {
+			fmt.Println("No secrets stored")
+			return nil
+		}
+		for _, info := range infos {
+			fmt.Printf("%-32s updated %s\n", info.Name, info.Updated.Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+var secretsDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete a stored secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := secrets.OpenStore(secretStoreFile).Delete(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted secret %s\n", args[0])
+		return nil
+	},
+}
+
+var secretsChangePasswordCmd = &cobra.Command{
+	Use:   "change-password",
+	Short: "Re-encrypt the secrets store under a new master password",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := secrets.OpenStore(secretStoreFile)
+		password, err := storePassword(store)
+		if err != nil {
+			return err
+		}
+		newPassword := newMasterPassword
+		if newPassword == "" {
+			if newPassword, err = promptNewPassword("New master password"); err != nil {
+				return err
+			}
+		}
+		if err := store.ChangePassword(password, newPassword); err != nil {
+			return err
+		}
+		fmt.Println("Changed the master password of the secrets store")
+		return nil
+	},
+}
+
+var secretsImportEnvCmd = &cobra.Command{
+	Use:   "import-env",
+	Short: "Move the variables of a .env file into the secrets store",
+	Long: `Store every NAME=VALUE line of a .env file as a secret, named with --prefix followed by
+the variable name. Comments, blank lines and a leading 'export' are skipped, and values may
+be quoted. With --remove the file is deleted once every variable is stored.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		variables, err := readEnvFile(secretEnvFile)
+		if err != nil {
+			return err
+		}
+		if len(variables) == 0 {
+			return fmt.Errorf("%s has no variables", secretEnvFile)
+		}
+		store := secrets.OpenStore(secretStoreFile)
+		password, err := storePassword(store)
+		if err != nil {
+			return err
+		}
+
+		values := make(map[string]string, len(variables))
+		for _, variable := range variables {
+			values[secretPrefix+variable[0]] = variable[1]
+		}
+		if err := store.SetMany(values, password); err != nil {
+			return err
+		}
+		for _, variable := range variables {
+			fmt.Printf("Stored %s as local:%s\n", variable[0], secretPrefix+variable[0])
+		}
+		if removeSecretsEnvFile {
+			if err := os.Remove(secretEnvFile); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", secretEnvFile, err)
+			}
+			fmt.Printf("Removed %s\n", secretEnvFile)
+		} else {
+			fmt.Printf("Delete %s once the references work\n", secretEnvFile)
+		}
+		return nil
+	},
+}
+
+// storePassword returns the master password of a store from the flag, the
+// environment or a prompt, asking for a new one twice if the store is new
+func storePassword(store *secrets.Store) (string, error) {
+	if password := firstNonEmpty(masterPassword, os.Getenv(secrets.EnvMasterPassword)); password != "" {
+		return password, nil
+	}
+	if !store.Exists() {
+		fmt.Println("Creating the secrets store; choose its master password")
+		return promptNewPassword("Master password")
+	}
+	return promptSecret("Master password")
+}
+
+// promptMasterPassword asks for the master password when a local: reference
+// is resolved and $GOSIGNERVAULT_MASTER_PASSWORD is not set. Without a
+// terminal it fails rather than consume input meant for the command.
+func promptMasterPassword() (string, error) {
+	if password := os.Getenv(secrets.EnvMasterPassword); password != "" {
+		return password, nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 || runtime.GOOS == "windows" {
+		return "", fmt.Errorf("$%s is not set", secrets.EnvMasterPassword)
+	}
+	return promptSecret("Master password of the secrets store")
+}
+
+// readEnvFile reads the NAME=VALUE pairs of a .env file in order
+func readEnvFile(path string) ([][2]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var variables [][2]string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimSpace(strings.TrimPrefix(text, "export "))
+		name, value, ok := strings.Cut(text, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		variables = append(variables, [2]string{strings.TrimSpace(name), value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return variables, nil
+}
+
+func init() {
+	secrets.MasterPassword = func() (string, error) {
+		if masterPassword != "" {
+			return masterPassword, nil
+		}
+		return promptMasterPassword()
+	}
+
+	// Add flags
+	SecretsCmd.PersistentFlags().StringVar(&secretStoreFile, "secrets-store", secrets.DefaultStoreFile, "Local secrets store")
+	SecretsCmd.PersistentFlags().StringVar(&masterPassword, "master-password", "", "Master password of the secrets store (defaults to $"+secrets.EnvMasterPassword+")")
+	secretsChangePasswordCmd.Flags().StringVar(&newMasterPassword, "new-master-password", "", "New master password (prompted if not given)")
+	secretsImportEnvCmd.Flags().StringVar(&secretEnvFile, "input", ".env", ".env file to import")
+	secretsImportEnvCmd.Flags().StringVar(&secretPrefix, "prefix", "", "Prefix of the secret names")
+	secretsImportEnvCmd.Flags().BoolVar(&removeSecretsEnvFile, "remove", false, "Delete the .env file once imported")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(secretsListCmd)
+
+	// Add commands
+	SecretsCmd.AddCommand(secretsSetCmd)
+	SecretsCmd.AddCommand(secretsGetCmd)
+	SecretsCmd.AddCommand(secretsListCmd)
+	SecretsCmd.AddCommand(secretsDeleteCmd)
+	SecretsCmd.AddCommand(secretsChangePasswordCmd)
+	SecretsCmd.AddCommand(secretsImportEnvCmd)
+}
@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/server"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen    string
+	serveKeys      []string
+	serveTokenFile string
+	serveLogFile   string
+
+	serveHWName    string
+	serveHWTimeout time.Duration
+	serveHWQueue   int
+	serveMaxExpiry time.Duration
+
+	serveBenchInterval time.Duration
+)
+
+// ServeCmd runs the signing daemon
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a localhost signing daemon",
+	Long: `Expose the vault over a localhost HTTP API so CI systems and dapps can sign without
+shelling out for every signature. JSON-RPC is served on "/" (account_list, account_signTransaction,
+account_signData, account_signTypedData and their eth_* equivalents); the same operations are
+available as REST endpoints under /v1/. Every request must carry "Authorization: Bearer <token>"
+and every transaction is checked against the signing policy, with no way to override it.
+Sign requests must also carry an X-Sign-Expiry header (unix time or RFC 3339) at most
+--max-expiry ahead; a signature that is not ready before the expiry is discarded.
+
+With --hardware an attached hardware wallet account is served as well, under the key name
+--hardware-name for policy rules. Its requests wait in a queue until the device is free and
+must be confirmed on the device; a request not confirmed within --hardware-timeout fails.
+
+A policy with an "approvals" rule holds every request until enough of its approvers sent
+approval tokens made with 'serve approve' to POST /v1/approvals, or until it expires. Held
+requests are exported at GET /v1/approvals. A rejection token from any approver refuses the
+request; 'tui --daemon' approves and rejects held requests in bulk.
+
+Every --rpc-bench-interval the endpoints of chains with fallback RPCs are benchmarked as
+with 'rpc bench', so requests go to the fastest healthy endpoint.
+
+--beacon opts in to a heartbeat posted to a central endpoint every --beacon-interval, so an
+organization can spot outdated or misconfigured instances. It reports the version, the
+installed policy bundle, a hash of the policy and of the served key names and addresses, and
+problems such as suspended keys or broadcasts held for unreachable endpoints. It never sends
+keys, passwords, tokens or transactions, and the endpoint's answer is ignored.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkLoopback(serveListen); err != nil {
+			return err
+		}
+		if len(serveKeys) == 0 && !useHW {
+			return errors.New("--name or --hardware is required")
+		}
+		if len(serveKeys) > 0 && password == "" {
+			return errors.New("--password is required")
+		}
+
+		// Keep the request log next to the console output
+		if serveLogFile != "" {
+			if err := os.MkdirAll(filepath.Dir(serveLogFile), 0700); err != nil {
+				return fmt.Errorf("failed to create log directory: %v", err)
+			}
+			logFile, err := os.OpenFile(serveLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %v", err)
+			}
+			defer logFile.Close()
+			log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+		}
+
+		token, err := loadOrCreateToken(serveTokenFile)
+		if err != nil {
+			return err
+		}
+
+		// Load signing policy
+		signingPolicy, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+
+		var simCache *tx.SimulationCache
+		if signingPolicy.RequireSimulation {
+			simCache, err = tx.NewSimulationCache(simCacheFile, simCacheBlocks)
+			if err != nil {
+				return err
+			}
+		}
+
+		auditLog, err := audit.Open(auditFile, auditKeyFile)
+		if err != nil {
+			return err
+		}
+
+		srv, err := server.New(server.Config{
+			Token:           token,
+			Policy:          signingPolicy,
+			History:         history,
+			SimulationCache: simCache,
+			HeadBlock:       headBlock,
+			Audit:           auditLog,
+			Operator:        auditOperator,
+			HardwareTimeout: serveHWTimeout,
+			HardwareQueue:   serveHWQueue,
+			MaxExpiry:       serveMaxExpiry,
+			KeyState:        checkKeyState,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Unlock keys
+		for _, name := range serveKeys {
+			if err := checkKeyState(name); err != nil {
+				return err
+			}
+			privateKey, err := loadKey(name, password)
+			if err != nil {
+				return err
+			}
+			account, err := srv.AddAccount(name, privateKey)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Unlocked %s (%s)\n", name, account.Address.Hex())
+		}
+		if useHW {
+			hw, err := openHardwareWallet(cmd)
+			if err != nil {
+				return err
+			}
+			defer hw.Close()
+
+			account, err := srv.AddHardwareAccount(serveHWName, hw)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Serving %s (%s) from the hardware wallet; confirm each request on the device\n", serveHWName, account.Address.Hex())
+		}
+
+		httpServer := &http.Server{
+			Addr:              serveListen,
+			Handler:           srv.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Submit transactions held by 'tx broadcast --not-before'
+		schedule, err := tx.OpenSchedule(scheduleFile)
+		if err != nil {
+			return err
+		}
+		scheduler := tx.NewScheduler(schedule, history)
+		scheduler.Describe = describeNotification
+		// Daemon jobs record their final state before the daemon exits
+		var jobs sync.WaitGroup
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job := &tx.Job{Kind: "scheduler", Description: "Submit the broadcasts of " + scheduleFile}
+			err := runJob(ctx, job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+				scheduler.OnEvent = func(entry *tx.ScheduledBroadcast, event tx.TimelineEvent) {
+					fmt.Printf("Scheduled %s: %s %s\n", entry.ID, event.Event, event.Detail)
+					progress(0, 0, fmt.Sprintf("%s %s %s", entry.ID, event.Event, event.Detail))
+				}
+				return "stopped with the daemon", scheduler.Run(ctx)
+			})
+			if err != nil {
+				fmt.Printf("Scheduler stopped: %v\n", err)
+			}
+		}()
+
+		// Keep fallback selection on the fastest healthy endpoint
+		if serveBenchInterval > 0 {
+			targets, err := benchmarkTargets(nil)
+			if err != nil {
+				return err
+			}
+			benchmarks, err := tx.OpenBenchmarks(tx.DefaultBenchmarkFile)
+			if err != nil {
+				return err
+			}
+			tx.UseBenchmarks(benchmarks)
+			jobs.Add(1)
+			go func() {
+				defer jobs.Done()
+				job := &tx.Job{Kind: "benchmarks", Description: fmt.Sprintf("Benchmark RPC endpoints every %s", serveBenchInterval)}
+				err := runJob(ctx, job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+					return "stopped with the daemon", benchmarks.Run(ctx, targets, serveBenchInterval, DefaultBenchSamples)
+				})
+				if err != nil {
+					fmt.Printf("Endpoint benchmarks stopped: %v\n", err)
+				}
+			}()
+		}
+
+		// Report health to the fleet endpoint; the daemon never listens for it
+		if beaconURL != "" {
+			beacon, err := newBeacon(srv, schedule)
+			if err != nil {
+				return err
+			}
+			beacon.OnError = func(err error) {
+				log.Printf("Health beacon: %v", err)
+			}
+			jobs.Add(1)
+			go func() {
+				defer jobs.Done()
+				job := &tx.Job{Kind: "beacon", Description: fmt.Sprintf("Report health every %s", beaconInterval)}
+				err := runJob(ctx, job, func(ctx context.Context, progress tx.JobProgress) (string, error) {
+					return "stopped with the daemon", beacon.Run(ctx)
+				})
+				if err != nil {
+					fmt.Printf("Health beacon stopped: %v\n", err)
+				}
+			}()
+		}
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			httpServer.Shutdown(shutdownCtx)
+		}()
+
+		fmt.Printf("Signing daemon listening on http://%s (token in %s)\n", serveListen, serveTokenFile)
+		err = httpServer.ListenAndServe()
+		stop()
+		jobs.Wait()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("signing daemon failed: %v", err)
+		}
+		return nil
+	},
+}
+
+// checkLoopback refuses listen addresses reachable from other machines
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("refusing to listen on non-loopback address %s", addr)
+	}
+	return nil
+}
+
+// describeNotification adds the decoded call of a scheduled broadcast and the
+// policy decisions recorded when it was signed to its notification
+func describeNotification(n *tx.Notification) {
+	var transaction types.Transaction
+	if err := transaction.UnmarshalBinary(common.FromHex(n.Broadcast.Payload.RawTransaction)); err == nil &&
+		transaction.To() != nil && len(transaction.Data()) >= 4 {
+		if decoder, err := newCallDecoder(); err == nil {
+			if call, err := decoder.Decode(transaction.Data()); err == nil {
+				n.Call = call
+			}
+		}
+	}
+
+	records, err := audit.Read(firstNonEmpty(auditFile, audit.DefaultLogFile))
+	if err != nil {
+		return
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.Operation == audit.OpSignTransaction && record.TxHash != nil && *record.TxHash == n.Broadcast.Payload.Hash {
+			n.Policy = record.Policy
+			return
+		}
+	}
+}
+
+// loadOrCreateToken reads the auth token file, generating a random token if it does not exist
+func loadOrCreateToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("auth token file %s is empty", path)
+		}
+		return token, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read auth token: %v", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate auth token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create auth token directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write auth token: %v", err)
+	}
+
+	fmt.Printf("Generated new auth token in %s\n", path)
+	return token, nil
+}
+
+func init() {
+	// Add flags
+	ServeCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8550", "Loopback address to listen on")
+	ServeCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	ServeCmd.Flags().StringSliceVar(&serveKeys, "name", nil, "Key to unlock (repeatable)")
+	ServeCmd.Flags().StringVar(&password, "password", "", "Key password")
+	ServeCmd.Flags().StringVar(&serveTokenFile, "token-file", filepath.Join(keystore.DefaultKeystoreDir, "serve.token"), "Auth token file (generated if missing)")
+	ServeCmd.Flags().StringVar(&serveLogFile, "log-file", "", "Also append the request log to this file")
+	ServeCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	ServeCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	ServeCmd.Flags().StringVar(&historyPassword, "history-password", "", "Encrypt the history with this password (append-only)")
+	addSimulationCacheFlags(ServeCmd.Flags())
+	ServeCmd.Flags().StringVar(&scheduleFile, "schedule", tx.DefaultScheduleFile, "Schedule of held transactions to submit")
+	ServeCmd.Flags().BoolVar(&useHW, "hardware", false, "Also serve an account of a connected hardware wallet")
+	ServeCmd.Flags().StringVar(&serveHWName, "hardware-name", "hardware", "Key name of the hardware wallet account in policy rules")
+	ServeCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	ServeCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	ServeCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	ServeCmd.Flags().DurationVar(&serveHWTimeout, "hardware-timeout", server.DefaultHardwareTimeout, "Time a request may wait for confirmation on the hardware wallet")
+	ServeCmd.Flags().IntVar(&serveHWQueue, "hardware-queue", server.DefaultHardwareQueue, "Number of requests that may wait for the hardware wallet")
+	ServeCmd.Flags().DurationVar(&serveMaxExpiry, "max-expiry", server.DefaultMaxExpiry, "Furthest ahead a sign request may set its expiry")
+	ServeCmd.Flags().StringVar(&beaconURL, "beacon", "", "Endpoint (or secret reference) to post health heartbeats to (disabled by default)")
+	ServeCmd.Flags().StringVar(&beaconToken, "beacon-token", "", "Bearer token (or secret reference) of the heartbeat endpoint")
+	ServeCmd.Flags().StringVar(&beaconInstance, "beacon-instance", "", "Instance name reported in heartbeats (defaults to the hostname)")
+	ServeCmd.Flags().DurationVar(&beaconInterval, "beacon-interval", server.DefaultBeaconInterval, "Interval between health heartbeats")
+	ServeCmd.Flags().DurationVar(&serveBenchInterval, "rpc-bench-interval", 15*time.Minute, "Interval between benchmarks of RPC endpoints with fallbacks (0 disables)")
+	addAuditFlags(ServeCmd)
+}
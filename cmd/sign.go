@@ -1,13 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
 
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
 	"github.com/aryehky/gosignervaultcli/core"
 	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -15,6 +25,26 @@ var (
 	outputFile string
 	chainName  string
 	message    string
+	rawMessage bool
+	assumeYes  bool
+	useHW      bool
+
+	historyFile     string
+	duplicateMode   string
+	duplicateWindow time.Duration
+	allowDuplicate  bool
+
+	policyFile   string
+	override     bool
+	simCacheFile string
+	// simCacheBlocks is how many blocks a cached simulation stays valid
+	simCacheBlocks uint64
+	// overrideConfirmed is set once --override was confirmed with a phrase
+	overrideConfirmed bool
+
+	submitStrategy string
+	ladderSteps    int
+	ladderBump     string
 )
 
 // SignCmd is the root command for signing operations
@@ -22,126 +52,874 @@ var SignCmd = &cobra.Command{
 	Use:   "sign",
 	Short: "Sign transactions and messages",
 	Long:  `Sign Ethereum transactions and messages using stored wallet keys.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if offlineMode || qrMode {
+			return enforceOffline()
+		}
+		return nil
+	},
 }
 
 var signTxCmd = &cobra.Command{
 	Use:   "tx",
 	Short: "Sign a transaction",
 	Long:  `Sign an Ethereum transaction using a stored wallet key.`,
+	Example: `  # Sign a transaction file with a key of the file keystore
+  gosignervaultcli sign tx --input rawTx.json --name mywallet --output signedTx.txt
+
+  # Sign on a Ledger at a derivation path
+  gosignervaultcli sign tx --signer "ledger:m/44'/60'/0'/0/0" --input rawTx.json --output signedTx.txt
+
+  # Air-gapped: scan the payload of 'tx prepare --qr' and show the signed result as QR codes
+  gosignervaultcli sign tx --qr --name mywallet --output signedTx.txt
+
+  # Write rawTx.json and the full flows with 'examples init airgap hardware'`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Load chain config
-		chain, err := core.GetChainConfig(chainName)
+		_, err := signTransaction(cmd, nil)
+		return err
+	},
+}
+
+// signTransaction runs the checks, preview and confirmation of 'sign tx' and
+// signs an unsigned transaction, read from --input or scanned QR codes when
+// data is nil. It returns the signed payload, or nil in dry runs.
+func signTransaction(cmd *cobra.Command, data []byte) (*tx.SignedPayload, error) {
+	transaction, chain, chainKey, err := readUnsignedTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set fees from the gas oracle
+	if gasPreset != "" {
+		if offlineMode || qrMode {
+			return nil, fmt.Errorf("--gas-preset needs network access; use 'tx prepare --gas-preset' on an online machine instead")
+		}
+		if err := applyGasPreset(chain, transaction); err != nil {
+			return nil, err
+		}
+	} else {
+		explainInputFees(transaction)
+	}
+	explain("nonce", "nonce %d taken from the input", transaction.Nonce)
+	explain("gas", "gas limit %d taken from the input", transaction.GasLimit)
+
+	// Randomize fee and gas metadata
+	if privacyMode {
+		if err := applyPrivacy(transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	// Refuse malformed deployments and blob transactions and the
+	// transaction types the chain does not accept
+	if err := transaction.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkChainCapabilities(chain, transaction.ToEthereumTx()); err != nil {
+		return nil, err
+	}
+
+	// Open the key's backend or the hardware wallet
+	signer, release, err := openSelectedSigner(cmd)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	from := signer.Address()
+
+	// Show offline context for the sender and destination
+	if snapshotFile != "" {
+		if err := showTransactionContext(transaction, from); err != nil {
+			return nil, err
+		}
+	}
+
+	// Load signing policy
+	signingPolicy, err := loadPolicy(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for an identical transaction signed recently
+	history, err := openHistory()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDuplicate(cmd, signingPolicy, history, transaction); err != nil {
+		return nil, err
+	}
+
+	// Enforce policy rules
+	decisions, err := enforcePolicy(signingPolicy, history, transaction, signer, keyName)
+	if err != nil {
+		return nil, auditRefusal(chainKey, signerName(), from, transaction, decisions, err)
+	}
+
+	// Compare the simulated balance changes with the declared ones
+	if len(expectedEffects) > 0 {
+		if err := checkSimulatedEffects(transaction, chain, from); err != nil {
+			return nil, auditRefusal(chainKey, signerName(), from, transaction, append(decisions, "effects mismatch"), err)
+		}
+		decisions = append(decisions, "effects matched")
+	}
+
+	// Compute the fee levels of a ladder; dynamic fee transactions bump
+	// the fee cap and the priority fee alike
+	var ladderPrices, ladderTips []*big.Int
+	switch submitStrategy {
+	case "single":
+	case "ladder":
+		bump, err := core.ParsePercent(ladderBump)
 		if err != nil {
-			return fmt.Errorf("failed to get chain config: %v", err)
+			return nil, fmt.Errorf("invalid --ladder-bump: %v", err)
 		}
+		ladderPrices, err = tx.LadderGasPrices(transaction.FeeCap(), ladderSteps, bump)
+		if err != nil {
+			return nil, err
+		}
+		explain("fees", "ladder of %d levels from %s gwei, each %s above the previous and rounded up to the wei", len(ladderPrices),
+			core.FormatTokenAmount(ladderPrices[0], 9), ladderBump)
+		if transaction.IsDynamicFee() {
+			ladderTips, err = tx.LadderGasPrices(transaction.MaxPriorityFeePerGas, ladderSteps, bump)
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown strategy %q (expected single or ladder)", submitStrategy)
+	}
 
-		// Read input file
-		data, err := ioutil.ReadFile(inputFile)
+	// Show what is being signed and ask for confirmation
+	if err := previewTransaction(transaction, chain, from); err != nil {
+		return nil, err
+	}
+	if ladderPrices != nil {
+		fmt.Printf("  Fee ladder: %d levels up to %s gwei\n", len(ladderPrices),
+			core.FormatTokenAmount(ladderPrices[len(ladderPrices)-1], 9))
+	}
+	result := newSignedTxResult(chainKey, transaction, from, decisions)
+	if output.DryRun() {
+		output.Result(result)
+		fmt.Println("Dry run, the transaction was not signed")
+		return nil, nil
+	}
+	ok, err := confirm("Sign this transaction?")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errSigningAborted
+	}
+
+	// Sign transaction
+	signedTx, err := signer.SignTx(transaction)
+	if err != nil {
+		return nil, err
+	}
+	payload := &tx.SignedPayload{
+		Version:        tx.PayloadVersion,
+		Chain:          chainKey,
+		ChainID:        chain.ChainID,
+		Hash:           core.TransactionHash(signedTx),
+		RawTransaction: signedTx,
+	}
+
+	// Pre-sign the replacements at higher fees with the same nonce
+	for i := 1; i < len(ladderPrices); i++ {
+		level := *transaction
+		if level.IsDynamicFee() {
+			level.MaxFeePerGas, level.MaxPriorityFeePerGas = ladderPrices[i], ladderTips[i]
+		} else {
+			level.GasPrice = ladderPrices[i]
+		}
+		rawTx, err := signer.SignTx(&level)
 		if err != nil {
-			return fmt.Errorf("failed to read input file: %v", err)
+			return nil, err
 		}
+		payload.Ladder = append(payload.Ladder, tx.LadderLevel{
+			GasPrice:       ladderPrices[i],
+			Hash:           core.TransactionHash(rawTx),
+			RawTransaction: rawTx,
+		})
+	}
 
-		// Parse transaction
-		var tx core.Transaction
-		if err := json.Unmarshal(data, &tx); err != nil {
-			return fmt.Errorf("failed to parse transaction: %v", err)
+	// Write output; ladders need the payload envelope to carry every level
+	content := []byte(signedTx)
+	if payload.Ladder != nil {
+		content, err = json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal signed payload: %v", err)
 		}
+	}
+	if err := ioutil.WriteFile(outputFile, content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write output file: %v", err)
+	}
+
+	// Record the signed transaction for later duplicate checks. Only the
+	// lowest ladder level is recorded since at most one level can be included.
+	if err := history.RecordSigned(signedRecord(transaction, from, signedTx)); err != nil {
+		return nil, fmt.Errorf("failed to record transaction in history: %v", err)
+	}
+	if err := auditTransaction(audit.OutcomeSigned, chainKey, signerName(), from, transaction, &payload.Hash, decisions); err != nil {
+		return nil, err
+	}
 
-		// Set chain ID
-		tx.ChainID = chain.ChainID
+	result.Hash, result.RawTransaction, result.Ladder, result.Output = &payload.Hash, signedTx, payload.Ladder, outputFile
+	output.Result(result)
+	fmt.Printf("Transaction signed and saved to: %s\n", outputFile)
+	if transaction.IsContractCreation() {
+		fmt.Printf("Contract address: %s\n", transaction.ContractAddress(from).Hex())
+	}
+	copyToClipboard("signed transaction", signedTx)
 
-		// Load key
-		manager, err := keystore.NewManager(keystoreDir)
+	// Hand the signed transaction back across the air gap
+	if qrMode {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal signed payload: %v", err)
+		}
+		return payload, displayUR(tx.URTypeSigned, data)
+	}
+	return payload, nil
+}
+
+var signMsgCmd = &cobra.Command{
+	Use:   "message",
+	Short: "Sign a message",
+	Long: `Sign a message using a stored wallet key or a hardware wallet. The message is signed with
+the EIP-191 "\x19Ethereum Signed Message:\n" prefix like personal_sign, so the signature
+verifies in MetaMask, ethers and 'verify message'. --raw signs keccak256 of the bare message instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !rawMessage {
+			if err := checkSelectedSigner(cmd, core.CapMessages); err != nil {
+				return err
+			}
+		}
+		signer, release, err := openSelectedSigner(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to create keystore manager: %v", err)
+			return err
+		}
+		defer release()
+
+		// A dry run stops once the key is unlocked
+		if output.DryRun() {
+			output.Result(&signatureResult{Signer: signer.Address(), Hash: common.BytesToHash(core.MessageHash([]byte(message), rawMessage))})
+			fmt.Println("Dry run, the message was not signed")
+			return nil
+		}
+
+		// Sign message; raw mode needs a key that signs bare hashes
+		var signature string
+		if rawMessage {
+			hashSigner, ok := signer.(core.HashSigner)
+			if !ok {
+				return fmt.Errorf("hardware wallets only sign messages with the EIP-191 prefix; drop --raw")
+			}
+			signature, err = core.SignMessageWithSigner([]byte(message), hashSigner, true)
+			if err != nil {
+				return err
+			}
+		} else {
+			sig, err := signer.SignMessage([]byte(message))
+			if err != nil {
+				return err
+			}
+			signature = fmt.Sprintf("0x%x", sig)
+		}
+
+		return saveMessageSignature([]byte(message), rawMessage, signer.Address(), signature, "")
+	},
+}
+
+var signTypedCmd = &cobra.Command{
+	Use:   "typed",
+	Short: "Sign EIP-712 typed data",
+	Long:  `Sign an EIP-712 typed data message using a stored wallet key or a hardware wallet.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkSelectedSigner(cmd, core.CapTypedData); err != nil {
+			return err
 		}
 
-		encryptedKey, err := manager.LoadKey(keyName)
+		// Read input file
+		data, err := ioutil.ReadFile(inputFile)
 		if err != nil {
-			return fmt.Errorf("failed to load key: %v", err)
+			return fmt.Errorf("failed to read input file: %v", err)
 		}
 
-		// Decrypt key
-		privateKey, err := keystore.DecryptKey(encryptedKey, password)
+		// Parse typed data
+		typedData, err := core.ParseTypedData(string(data))
 		if err != nil {
-			return fmt.Errorf("failed to decrypt key: %v", err)
+			return err
 		}
 
-		// Sign transaction
-		signedTx, err := core.SignTransaction(&tx, privateKey)
+		// Show what is being signed
+		summary, err := typedData.Summary()
 		if err != nil {
-			return fmt.Errorf("failed to sign transaction: %v", err)
+			return err
 		}
+		fmt.Print(summary)
 
-		// Write output
-		if err := ioutil.WriteFile(outputFile, []byte(signedTx), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %v", err)
+		if !output.DryRun() {
+			ok, err := confirm("Sign this typed data?")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errSigningAborted
+			}
 		}
 
-		fmt.Printf("Transaction signed and saved to: %s\n", outputFile)
-		return nil
+		// Sign typed data
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if output.DryRun() {
+			hash, err := typedData.Hash()
+			if err != nil {
+				return err
+			}
+			output.Result(&signatureResult{Signer: signer.Address(), Hash: hash})
+			fmt.Println("Dry run, the typed data was not signed")
+			return nil
+		}
+		signature, err := signer.SignTypedData(typedData)
+		if err != nil {
+			return err
+		}
+
+		return saveTypedDataSignature(typedData, signature, typedData.PrimaryType)
 	},
 }
 
-var signMsgCmd = &cobra.Command{
-	Use:   "message",
-	Short: "Sign a message",
-	Long:  `Sign an arbitrary message using a stored wallet key.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// Load key
-		manager, err := keystore.NewManager(keystoreDir)
+// saveMessageSignature writes a message signature to --output and records it
+// in the audit trail
+func saveMessageSignature(message []byte, raw bool, from common.Address, signature, detail string) error {
+	// Write output
+	if err := ioutil.WriteFile(outputFile, []byte(signature), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	if err := recordAudit(&audit.Record{
+		Operation:   audit.OpSignMessage,
+		Outcome:     audit.OutcomeSigned,
+		Key:         signerName(),
+		Signer:      from.Hex(),
+		PayloadHash: common.BytesToHash(core.MessageHash(message, raw)),
+		Detail:      detail,
+	}); err != nil {
+		return err
+	}
+
+	output.Result(&signatureResult{
+		Signer:    from,
+		Hash:      common.BytesToHash(core.MessageHash(message, raw)),
+		Signature: signature,
+		Output:    outputFile,
+	})
+	fmt.Printf("Message signed and saved to: %s\n", outputFile)
+	copyToClipboard("signature", signature)
+	return nil
+}
+
+// saveTypedDataSignature writes a typed data signature with the recovered
+// signer to --output and records it in the audit trail
+func saveTypedDataSignature(typedData *core.TypedData, signature []byte, detail string) error {
+	// Recover signer so the output can be checked independently
+	signer, err := core.VerifyTypedDataSignature(typedData, signature)
+	if err != nil {
+		return err
+	}
+	hash, err := typedData.Hash()
+	if err != nil {
+		return err
+	}
+
+	result, err := json.MarshalIndent(map[string]string{
+		"signature": fmt.Sprintf("0x%x", signature),
+		"signer":    signer.Hex(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal signature: %v", err)
+	}
+
+	// Write output
+	if err := ioutil.WriteFile(outputFile, result, 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+
+	if err := recordAudit(&audit.Record{
+		Operation:   audit.OpSignTypedData,
+		Outcome:     audit.OutcomeSigned,
+		Key:         signerName(),
+		Signer:      signer.Hex(),
+		PayloadHash: hash,
+		Detail:      detail,
+	}); err != nil {
+		return err
+	}
+
+	output.Result(&signatureResult{Signer: signer, Hash: hash, Signature: fmt.Sprintf("0x%x", signature), Output: outputFile})
+	fmt.Printf("Typed data signed by %s and saved to: %s\n", nickname(signer), outputFile)
+	copyToClipboard("signature", fmt.Sprintf("0x%x", signature))
+	return nil
+}
+
+// signedTxResult is the result of 'sign tx' in JSON output; a dry run leaves
+// out the signed fields
+type signedTxResult struct {
+	Chain           string           `json:"chain"`
+	ChainID         *big.Int         `json:"chainId"`
+	From            common.Address   `json:"from"`
+	Nonce           uint64           `json:"nonce"`
+	SigningHash     common.Hash      `json:"signingHash"`
+	Policy          []string         `json:"policy,omitempty"`
+	ContractAddress *common.Address  `json:"contractAddress,omitempty"`
+	Hash            *common.Hash     `json:"hash,omitempty"`
+	RawTransaction  string           `json:"rawTransaction,omitempty"`
+	Ladder          []tx.LadderLevel `json:"ladder,omitempty"`
+	Output          string           `json:"output,omitempty"`
+}
+
+// newSignedTxResult describes a transaction that passed the checks for signing
+func newSignedTxResult(chainKey string, transaction *core.Transaction, from common.Address, decisions []string) *signedTxResult {
+	result := &signedTxResult{
+		Chain:       chainKey,
+		ChainID:     transaction.ChainID,
+		From:        from,
+		Nonce:       transaction.Nonce,
+		SigningHash: signingHash(transaction),
+		Policy:      decisions,
+	}
+	if transaction.IsContractCreation() {
+		address := transaction.ContractAddress(from)
+		result.ContractAddress = &address
+	}
+	return result
+}
+
+// signatureResult is the result of message and typed data signing in JSON output
+type signatureResult struct {
+	Signer    common.Address `json:"signer"`
+	Hash      common.Hash    `json:"hash"`
+	Signature string         `json:"signature,omitempty"`
+	Output    string         `json:"output,omitempty"`
+}
+
+// readUnsignedTransaction reads the transaction to sign from data or, when
+// data is nil, from --input or, with --qr, from scanned UR parts. Both bare
+// transactions and payload envelopes produced by 'tx prepare' are accepted.
+func readUnsignedTransaction(data []byte) (*core.Transaction, *core.ChainConfig, string, error) {
+	var err error
+	switch {
+	case data != nil:
+	case qrMode:
+		data, err = scanUR(tx.URTypeUnsigned)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	default:
+		if inputFile == "" {
+			return nil, nil, "", fmt.Errorf("--input is required unless --qr is given")
+		}
+		data, err = ioutil.ReadFile(inputFile)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to read input file: %v", err)
+		}
+	}
+
+	name := chainName
+	var expectedChainID *big.Int
+	if tx.IsUnsignedPayload(data) {
+		payload, err := tx.ParseUnsignedPayload(data)
 		if err != nil {
-			return fmt.Errorf("failed to create keystore manager: %v", err)
+			return nil, nil, "", err
+		}
+		if payload.Chain != "" {
+			name = payload.Chain
+		}
+		expectedChainID = payload.ChainID
+		data = payload.Transaction
+		loadPayloadENSNames(payload.Build)
+	}
+
+	// Parse transaction
+	var transaction core.Transaction
+	if err := json.Unmarshal(data, &transaction); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to parse transaction: %v", err)
+	}
+
+	// Load chain config
+	chain, err := core.GetChainConfig(name)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get chain config: %v", err)
+	}
+	if expectedChainID != nil && expectedChainID.Cmp(chain.ChainID) != 0 {
+		return nil, nil, "", fmt.Errorf("payload is for chain ID %s but chain %s has ID %s", expectedChainID, name, chain.ChainID)
+	}
+
+	// Set chain ID
+	transaction.ChainID = chain.ChainID
+	return &transaction, chain, name, nil
+}
+
+// showTransactionContext prints snapshot data relevant to the transaction
+func showTransactionContext(transaction *core.Transaction, from common.Address) error {
+	snapshot, err := loadSnapshot(snapshotFile, true)
+	if err != nil {
+		return err
+	}
+	if snapshot.ChainID.Cmp(transaction.ChainID) != 0 {
+		return fmt.Errorf("snapshot is for chain %s, transaction is for chain %s", snapshot.ChainID, transaction.ChainID)
+	}
+
+	fmt.Printf("Context from block %d (%s), signed by %s\n", snapshot.BlockNumber,
+		snapshot.BlockTime.Format(time.RFC3339), snapshot.Signer.Hex())
+	if !snapshot.Verified {
+		fmt.Println("Warning: snapshot state was not verified with Merkle proofs")
+	}
+
+	if account, ok := snapshot.Account(from); ok {
+		printAccountSnapshot("Sender", account)
+		if account.Nonce != transaction.Nonce {
+			fmt.Printf("Warning: transaction nonce %d differs from snapshot nonce %d\n", transaction.Nonce, account.Nonce)
+		}
+	}
+	if transaction.To != nil {
+		if account, ok := snapshot.Account(*transaction.To); ok {
+			printAccountSnapshot("Destination", account)
 		}
+		if token, ok := snapshot.Token(*transaction.To); ok {
+			fmt.Printf("Destination is token %s (%s), %d decimals\n", token.Name, token.Symbol, token.Decimals)
+		}
+	}
+	return nil
+}
+
+// loadPolicy loads the signing policy. A missing default policy file means no rules apply.
+func loadPolicy(cmd *cobra.Command) (*policy.Policy, error) {
+	if _, err := os.Stat(policyFile); os.IsNotExist(err) && !cmd.Flags().Changed("policy") {
+		return &policy.Policy{}, nil
+	}
+	return policy.Load(policyFile)
+}
+
+// enforcePolicy evaluates the policy and refuses to continue on violations unless --override is set
+func enforcePolicy(signingPolicy *policy.Policy, history *tx.History, transaction *core.Transaction, signer core.Signer, key string) ([]string, error) {
+	_, _, _, chainID := transactionKey(transaction)
+	from := signer.Address()
+
+	req := &policy.Request{
+		KeyName:    key,
+		To:         transaction.To,
+		Value:      transaction.Value,
+		Data:       transaction.Data,
+		ChainID:    transaction.ChainID,
+		SpentToday: history.SpentSince(from.Hex(), chainID, time.Now().Add(-24*time.Hour)),
+	}
 
-		encryptedKey, err := manager.LoadKey(keyName)
+	// Look for a successful simulation of this exact payload
+	if signingPolicy.RequireSimulation {
+		simulated, err := wasSimulated(transaction, from)
 		if err != nil {
-			return fmt.Errorf("failed to load key: %v", err)
+			return nil, err
 		}
+		req.Simulated = simulated
+	}
 
-		// Decrypt key
-		privateKey, err := keystore.DecryptKey(encryptedKey, password)
+	violations := signingPolicy.Evaluate(req)
+	if len(violations) == 0 {
+		return []string{"policy passed"}, nil
+	}
+
+	var decisions []string
+	for _, v := range violations {
+		fmt.Printf("Policy violation: %s\n", v)
+		decisions = append(decisions, "violation: "+v.String())
+	}
+	if !override {
+		return decisions, fmt.Errorf("%w; use --override to sign anyway", &policy.ViolationError{Violations: violations})
+	}
+	// One phrase confirms the overrides of a whole batch
+	if !overrideConfirmed {
+		ok, err := confirmPhrase(signingPolicy, policy.PhraseOverride, "Signing despite the policy violations", nil)
 		if err != nil {
-			return fmt.Errorf("failed to decrypt key: %v", err)
+			return decisions, err
+		}
+		if !ok {
+			return decisions, fmt.Errorf("%w; the override was not confirmed", &policy.ViolationError{Violations: violations})
 		}
+		overrideConfirmed = true
+	}
+	fmt.Println("Warning: policy violations overridden")
+	return append(decisions, "violations overridden"), nil
+}
+
+// wasSimulated reports whether the simulation cache holds a successful result for the transaction
+func wasSimulated(transaction *core.Transaction, from common.Address) (bool, error) {
+	result, err := cachedSimulation(transaction, from)
+	if err != nil {
+		return false, err
+	}
+	return result != nil && result.Success, nil
+}
+
+// checkSimulatedEffects checks the cached simulation of the transaction
+// against --expect. The exact payload must have been simulated with a trace.
+func checkSimulatedEffects(transaction *core.Transaction, chain *core.ChainConfig, from common.Address) error {
+	result, err := cachedSimulation(transaction, from)
+	if err != nil {
+		return err
+	}
+	if result == nil || !result.Success {
+		return fmt.Errorf("--expect needs a successful simulation of this exact transaction; run 'tx simulate' first")
+	}
+	if result.Effects != nil {
+		printEffects(result.Effects, chain)
+	}
+	return checkExpectedEffects(result, chain)
+}
+
+// cachedSimulation returns the cached simulation result of the transaction,
+// or nil if it was not simulated within --simulation-window blocks of the head
+func cachedSimulation(transaction *core.Transaction, from common.Address) (*tx.SimulationResult, error) {
+	cache, err := tx.NewSimulationCache(simCacheFile, simCacheBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash, err := tx.PayloadHash(&tx.Transaction{
+		From:     from,
+		To:       transaction.To,
+		Value:    transaction.Value,
+		Gas:      transaction.GasLimit,
+		GasPrice: transaction.FeeCap(),
+		Data:     transaction.Data,
+		Nonce:    transaction.Nonce,
+		ChainID:  transaction.ChainID,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Sign message
-		signature, err := core.SignMessage([]byte(message), privateKey)
+	head, err := simulationHead(transaction.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := cache.Get(payloadHash, head)
+	if !ok {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// simulationHead returns the block the age of cached simulations is measured
+// at: the head of the chain, or the block of the --snapshot when offline
+func simulationHead(chainID *big.Int) (uint64, error) {
+	if snapshotFile != "" {
+		snapshot, err := loadSnapshot(snapshotFile, true)
 		if err != nil {
-			return fmt.Errorf("failed to sign message: %v", err)
+			return 0, err
+		}
+		if snapshot.ChainID.Cmp(chainID) != 0 {
+			return 0, fmt.Errorf("snapshot is for chain %s, transaction is for chain %s", snapshot.ChainID, chainID)
+		}
+		return snapshot.BlockNumber, nil
+	}
+	if offlineMode || qrMode {
+		return 0, fmt.Errorf("the age of the cached simulation cannot be checked offline; pass a --snapshot of chain %s", chainID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	head, err := headBlock(ctx, chainID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the age of the cached simulation: %v", err)
+	}
+	return head, nil
+}
+
+// headBlock reads the latest block of the configured chain with a chain ID
+func headBlock(ctx context.Context, chainID *big.Int) (uint64, error) {
+	chain, err := chainConfigByID(chainID)
+	if err != nil {
+		return 0, err
+	}
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		return 0, err
+	}
+	defer simulator.Close()
+	return simulator.BlockNumber(ctx)
+}
+
+// chainConfigByID returns the configured chain with a chain ID, preferring
+// the one named by --chain
+func chainConfigByID(chainID *big.Int) (*core.ChainConfig, error) {
+	if chain, err := core.GetChainConfig(chainName); err == nil && chain.ChainID.Cmp(chainID) == 0 {
+		return chain, nil
+	}
+	names, err := core.ChainNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		chain, err := core.GetChainConfig(name)
+		if err == nil && chain.ChainID.Cmp(chainID) == 0 {
+			return chain, nil
 		}
+	}
+	return nil, fmt.Errorf("no chain with ID %s is configured", chainID)
+}
 
-		// Write output
-		if err := ioutil.WriteFile(outputFile, []byte(signature), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %v", err)
+// checkDuplicate applies the duplicate signing policy to a transaction. Flags
+// given on the command line take precedence over the policy file.
+func checkDuplicate(cmd *cobra.Command, signingPolicy *policy.Policy, history *tx.History, transaction *core.Transaction) error {
+	dupPolicy := tx.DuplicatePolicy{Mode: duplicateMode, Window: duplicateWindow}
+	if rule := signingPolicy.Duplicates; rule != nil {
+		if rule.Mode != "" && !cmd.Flags().Changed("duplicate-policy") {
+			dupPolicy.Mode = rule.Mode
+		}
+		if rule.Window != "" && !cmd.Flags().Changed("duplicate-window") {
+			dupPolicy.Window, _ = time.ParseDuration(rule.Window)
 		}
+	}
+	if err := dupPolicy.Validate(); err != nil {
+		return err
+	}
 
-		fmt.Printf("Message signed and saved to: %s\n", outputFile)
+	to, value, data, chainID := transactionKey(transaction)
+	record, block := dupPolicy.Check(history, to, value, data, chainID)
+	if record == nil {
 		return nil
-	},
+	}
+
+	msg := fmt.Sprintf("an identical transaction (%s) was signed at %s",
+		record.Hash.Hex(), record.Timestamp.Format(time.RFC3339))
+	if record.Status == tx.StatusHeld {
+		msg = "an identical transaction is signed earlier in this batch"
+	}
+	if block && !allowDuplicate {
+		return fmt.Errorf("%s; use --allow-duplicate to sign it again", msg)
+	}
+	fmt.Printf("Warning: %s\n", msg)
+	return nil
+}
+
+// transactionKey returns the fields used to identify duplicate transactions
+func transactionKey(transaction *core.Transaction) (to, value, data, chainID string) {
+	if transaction.To != nil {
+		to = transaction.To.Hex()
+	}
+	if transaction.Value != nil {
+		value = transaction.Value.String()
+	}
+	if transaction.ChainID != nil {
+		chainID = transaction.ChainID.String()
+	}
+	return to, value, fmt.Sprintf("0x%x", transaction.Data), chainID
+}
+
+// signedRecord builds the history record for a locally signed transaction
+func signedRecord(transaction *core.Transaction, from common.Address, signedTx string) *tx.TransactionRecord {
+	to, value, data, chainID := transactionKey(transaction)
+
+	record := &tx.TransactionRecord{
+		Hash:    core.TransactionHash(signedTx),
+		From:    from.Hex(),
+		To:      to,
+		Value:   value,
+		Data:    data,
+		ChainID: chainID,
+	}
+	if feeCap := transaction.FeeCap(); feeCap != nil {
+		record.GasPrice = feeCap.String()
+	}
+
+	// Name the called function so the history reads without the ABI at hand
+	if transaction.To != nil && len(transaction.Data) >= 4 {
+		if decoder, err := newCallDecoder(); err == nil {
+			if call, err := decoder.Decode(transaction.Data); err == nil {
+				record.Function = call.Signature
+			}
+		}
+	}
+	return record
+}
+
+// addSignTxFlags adds the flags of 'sign tx' that apply to any transaction
+// being signed, wherever it is read from
+func addSignTxFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&privacyMode, "privacy", false, "Randomize the rounding of fees and the padding of the gas limit")
+	cmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	cmd.Flags().StringVar(&historyPassword, "history-password", "", "Encrypt the history with this password (append-only)")
+	cmd.Flags().StringVar(&duplicateMode, "duplicate-policy", tx.DefaultDuplicatePolicy().Mode, "Handling of recently signed identical transactions (warn, block, off)")
+	cmd.Flags().DurationVar(&duplicateWindow, "duplicate-window", tx.DefaultDuplicatePolicy().Window, "Window in which identical transactions count as duplicates")
+	cmd.Flags().BoolVar(&allowDuplicate, "allow-duplicate", false, "Sign even if the duplicate policy would block")
+	cmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	cmd.Flags().BoolVar(&override, "override", false, "Sign even if the transaction violates the policy")
+	cmd.Flags().StringVar(&snapshotFile, "snapshot", "", "Chain data snapshot to display as confirmation context")
+	cmd.Flags().StringVar(&snapshotSigner, "snapshot-signer", "", "Address the snapshot must be signed by (required with --snapshot)")
+	cmd.Flags().StringVar(&submitStrategy, "strategy", "single", "Submission strategy: single, or ladder to pre-sign replacements at ascending fees")
+	cmd.Flags().IntVar(&ladderSteps, "ladder-steps", tx.DefaultLadderSteps, "Number of fee levels of a ladder")
+	cmd.Flags().StringVar(&ladderBump, "ladder-bump", tx.DefaultLadderBump, "Fee increase between ladder levels in percent, e.g. 12.5%")
+	cmd.Flags().StringVar(&gasPreset, "gas-preset", "", "Set EIP-1559 fees from the gas oracle before signing (slow, standard, fast; needs network access)")
+	addGasOracleFlags(cmd)
+	addSimulationCacheFlags(cmd.Flags())
+	cmd.Flags().StringArrayVar(&expectedEffects, "expect", nil, "Require the cached simulation to show this balance change of the sender, e.g. \"send 1 ETH\" (repeatable)")
+	addCopyFlags(cmd)
+}
+
+// addSimulationCacheFlags adds the flags of the simulation cache that the
+// requireSimulation rule and --expect read
+func addSimulationCacheFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&simCacheFile, "simulation-cache", tx.DefaultSimulationCacheFile, "Simulation cache used for the requireSimulation rule")
+	flags.Uint64Var(&simCacheBlocks, "simulation-window", tx.DefaultSimulationCacheBlocks, "Blocks after which a cached simulation no longer counts")
 }
 
 func init() {
 	// Add flags
-	SignCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", ".keystore", "Keystore directory")
+	SignCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
 	SignCmd.PersistentFlags().StringVar(&keyName, "name", "", "Key name")
 	SignCmd.PersistentFlags().StringVar(&password, "password", "", "Key password")
 	SignCmd.PersistentFlags().StringVar(&outputFile, "output", "", "Output file")
+	SignCmd.PersistentFlags().BoolVar(&assumeYes, "yes", false, "Skip interactive confirmation")
+	SignCmd.PersistentFlags().BoolVar(&offlineMode, "offline", false, "Refuse all network access while signing")
+	SignCmd.PersistentFlags().BoolVar(&allowNetworkIfaces, "allow-network-interfaces", false, "Allow offline mode while network interfaces are up")
+	SignCmd.PersistentFlags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	SignCmd.PersistentFlags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	SignCmd.PersistentFlags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	SignCmd.PersistentFlags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	addKeystoreBackendFlags(SignCmd)
+	addSignerFlags(SignCmd)
+	addAddressBookFlags(SignCmd)
+	addAuditFlags(SignCmd)
 
 	signTxCmd.Flags().StringVar(&inputFile, "input", "", "Input transaction file")
 	signTxCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	signTxCmd.Flags().BoolVar(&qrMode, "qr", false, "Scan the unsigned transaction from QR codes and display the result as QR codes (implies --offline)")
+	signTxCmd.Flags().DurationVar(&qrInterval, "qr-interval", 500*time.Millisecond, "Frame interval of animated QR codes")
+	addSignTxFlags(signTxCmd)
 
 	signMsgCmd.Flags().StringVar(&message, "message", "", "Message to sign")
+	signMsgCmd.Flags().BoolVar(&rawMessage, "raw", false, "Sign keccak256 of the message without the EIP-191 prefix")
+
+	signTypedCmd.Flags().StringVar(&inputFile, "input", "", "Input typed data file")
+
+	addCopyFlags(signMsgCmd)
+	addCopyFlags(signTypedCmd)
 
 	// Mark required flags
-	SignCmd.MarkPersistentFlagRequired("name")
-	SignCmd.MarkPersistentFlagRequired("password")
 	SignCmd.MarkPersistentFlagRequired("output")
 
-	signTxCmd.MarkFlagRequired("input")
 	signMsgCmd.MarkFlagRequired("message")
+	signTypedCmd.MarkFlagRequired("input")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(signTxCmd, signMsgCmd, signTypedCmd)
 
 	// Add commands
 	SignCmd.AddCommand(signTxCmd)
 	SignCmd.AddCommand(signMsgCmd)
+	SignCmd.AddCommand(signTypedCmd)
 }
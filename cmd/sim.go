@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	simListen      string
+	simFund        []string
+	simBalance     string
+	simBlockPeriod uint64
+)
+
+// SimCmd is the root command for the simulated chain
+var SimCmd = &cobra.Command{
+	Use:   "sim",
+	Short: "Run a simulated chain for testing and training",
+	Long: `Run an in-memory chain with the chain ID of --chain, so the full signing, broadcast and
+monitoring pipeline can be exercised without real funds or networks. Point any command at it
+with --backend sim.`,
+}
+
+var simStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a simulated chain",
+	Long: `Start a simulated chain serving HTTP and WebSocket RPC on --listen until interrupted. The keys
+in the keystore and every --fund address start with --balance. Blocks are sealed as soon as a
+transaction arrives, or every --block-time seconds. State is discarded on exit. The chain is
+only part of builds with the sim tag ('make build-sim').`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+		balance, err := core.ParseAmount(simBalance, rounding)
+		if err != nil {
+			return fmt.Errorf("invalid --balance: %v", err)
+		}
+		funded, err := simAccounts()
+		if err != nil {
+			return err
+		}
+
+		alloc := make(map[common.Address]*big.Int, len(funded))
+		for _, address := range funded {
+			alloc[address] = balance
+		}
+		sim, err := tx.NewSimulatedChain(tx.SimulatedChainConfig{
+			ChainID:     chain.ChainID,
+			Alloc:       alloc,
+			Listen:      simListen,
+			BlockPeriod: simBlockPeriod,
+		})
+		if err != nil {
+			return err
+		}
+		defer sim.Close()
+
+		fmt.Printf("Simulating %s (chain ID %s) at %s\n", chain.Name, chain.ChainID, sim.URL())
+		for _, address := range funded {
+			fmt.Printf("  %s  %s\n", address.Hex(), formatNative(chain, balance))
+		}
+		fmt.Printf("Transactions signed for the simulation are valid on %s too; train with keys that hold no real funds.\n", chain.Name)
+		fmt.Println("Use --backend sim to send commands here; press Ctrl+C to stop.")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		return nil
+	},
+}
+
+// simAccounts returns the addresses funded at genesis: the keys of the file
+// keystore and the --fund addresses
+func simAccounts() ([]common.Address, error) {
+	addresses, err := parseAddresses(simFund)
+	if err != nil {
+		return nil, err
+	}
+
+	manager, err := keystore.NewManager(keystoreDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore manager: %v", err)
+	}
+	names, err := manager.ListKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+	for _, name := range names {
+		key, err := manager.LoadKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %v", name, err)
+		}
+		addresses = append(addresses, common.HexToAddress(key.Address))
+	}
+	return addresses, nil
+}
+
+// ConfigureBackend selects where RPC requests go. With --backend sim they go to
+// --sim-url, and history, nonce leases, schedules and the simulation cache
+// move to a sim directory next to them unless given explicitly.
+func ConfigureBackend(c *cobra.Command, backend, simURL string) error {
+	switch backend {
+	case "rpc":
+		tx.UseSimulator("")
+		return nil
+	case "sim":
+	default:
+		return fmt.Errorf("unknown backend %q (expected rpc or sim)", backend)
+	}
+
+	// 'sim start' runs the simulation itself
+	if c == simStartCmd {
+		return nil
+	}
+	tx.UseSimulator(simURL)
+
+	stateFiles := map[string]bool{"history": true, "leases": true, "schedule": true, "simulation-cache": true}
+	var err error
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || err != nil || !stateFiles[f.Name] {
+			return
+		}
+		current := f.Value.String()
+		err = f.Value.Set(filepath.Join(filepath.Dir(current), "sim", filepath.Base(current)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply simulation defaults: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	// Add flags
+	simStartCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain whose chain ID is simulated")
+	simStartCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	simStartCmd.Flags().StringVar(&simListen, "listen", "127.0.0.1:8545", "Address serving HTTP and WebSocket RPC")
+	simStartCmd.Flags().StringSliceVar(&simFund, "fund", nil, "Additional address to fund (repeatable)")
+	simStartCmd.Flags().StringVar(&simBalance, "balance", "1000ether", "Starting balance of every funded address")
+	simStartCmd.Flags().Uint64Var(&simBlockPeriod, "block-time", 0, "Seconds between blocks (0 seals a block per transaction)")
+
+	// Add commands
+	SimCmd.AddCommand(simStartCmd)
+}
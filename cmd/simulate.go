@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	traceRPC        string
+	priceSource     string
+	expectedEffects []string
+)
+
+var txSimulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Simulate a transaction and show what it will do",
+	Long: `Simulate an unsigned transaction against the latest block. Nonce, gas price and gas
+limit are filled in from the chain when unset. Where the RPC supports debug_traceCall (or
+--trace-rpc points at one that does, e.g. a Tenderly node), the output shows the internal
+call tree, token transfers and storage diffs; otherwise the call falls back to eth_call.
+Successful results are cached for the requireSimulation policy rule; sign the transaction
+written by --output so the signed payload matches the simulated one.
+
+The cost includes the L1 data fee on OP-stack and Arbitrum chains. --price-source adds its
+value in USD, priced by coingecko, chainlink or file:PATH (a JSON object of USD prices by
+token symbol, e.g. {"ETH": 3150.5}, for offline use).
+
+Traced simulations also show the net native and ERC-20 balance changes of every touched
+address. Each --expect declares a change of the sender's balances, as "send 1.0 ETH",
+"receive >=1800 USDC" or "fee <=0.01 ETH"; the simulation fails unless the sender's changes
+match the declarations exactly, so calldata doing more than advertised is caught. 'sign tx
+--expect' checks the same declarations against the cached simulation before signing.`,
+	Example: `  # Simulate a swap and require it to only trade 1 ETH for at least 1800 USDC
+  gosignervaultcli tx simulate --input swap.json --from 0xYourAddress --output swap.sim.json \
+    --expect "send 1 ETH" --expect "receive >=1800 USDC"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+		from, err := parseAddress("from", fromAddress)
+		if err != nil {
+			return err
+		}
+
+		// Read and complete the transaction
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		data, _, err = tx.UnwrapTransaction(data)
+		if err != nil {
+			return err
+		}
+		var transaction core.Transaction
+		if err := json.Unmarshal(data, &transaction); err != nil {
+			return fmt.Errorf("failed to parse transaction: %v", err)
+		}
+		if transaction.To == nil {
+			return fmt.Errorf("contract creation cannot be simulated")
+		}
+		transaction.ChainID = chain.ChainID
+		if err := fillTransaction(chain, &transaction, from); err != nil {
+			return err
+		}
+
+		// Simulate with the cache used by the requireSimulation rule
+		simulator, err := tx.NewSimulator(chain.RPCURL)
+		if err != nil {
+			return err
+		}
+		defer simulator.Close()
+		if traceRPC != "" {
+			if err := simulator.SetTraceRPC(traceRPC); err != nil {
+				return err
+			}
+		}
+		cache, err := tx.NewSimulationCache(simCacheFile, simCacheBlocks)
+		if err != nil {
+			return err
+		}
+		simulator.SetCache(cache)
+		if err := simulator.SetL1Fees(chain.L1Fees); err != nil {
+			return err
+		}
+		var prices tx.PriceSource
+		if priceSource != "" {
+			if prices, err = tx.NewPriceSource(priceSource); err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		result, err := simulator.SimulateTransaction(ctx, &tx.Transaction{
+			From:     from,
+			To:       transaction.To,
+			Value:    transaction.Value,
+			Gas:      transaction.GasLimit,
+			GasPrice: transaction.FeeCap(),
+			Data:     transaction.Data,
+			Nonce:    transaction.Nonce,
+			ChainID:  transaction.ChainID,
+		})
+		if err != nil {
+			return err
+		}
+		if err := result.PriceCost(ctx, chain, prices); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		if err := printSimulation(result, chain); err != nil {
+			return err
+		}
+		output.Result(&simulationResult{Simulation: result, Transaction: &transaction})
+		if result.Success {
+			if err := checkExpectedEffects(result, chain); err != nil {
+				return err
+			}
+		}
+
+		// Write the completed transaction for signing
+		if outputFile != "" && !output.DryRun() {
+			content, err := json.MarshalIndent(&transaction, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal transaction: %v", err)
+			}
+			if err := ioutil.WriteFile(outputFile, content, 0644); err != nil {
+				return fmt.Errorf("failed to write output file: %v", err)
+			}
+			fmt.Printf("Simulated transaction saved to: %s\n", outputFile)
+		}
+
+		if !result.Success {
+			return fmt.Errorf("transaction would fail")
+		}
+		return nil
+	},
+}
+
+// simulationResult is the result of 'tx simulate' in JSON output
+type simulationResult struct {
+	Simulation  *tx.SimulationResult `json:"simulation"`
+	Transaction *core.Transaction    `json:"transaction"`
+}
+
+// printSimulation prints a simulation result with decoded calls
+func printSimulation(result *tx.SimulationResult, chain *core.ChainConfig) error {
+	if result.Success {
+		fmt.Println("Result:     success")
+		fmt.Printf("Gas used:   %d\n", result.GasUsed)
+		fmt.Printf("Cost:       %s\n", formatNative(chain, result.TotalCost))
+		if result.L1Fee != nil {
+			fmt.Printf("L1 fee:     %s\n", formatNative(chain, result.L1Fee))
+		}
+		if result.TotalCostUSD != nil {
+			fmt.Printf("Cost (USD): $%.2f (%s)\n", *result.TotalCostUSD, result.PriceSource)
+		}
+	} else {
+		fmt.Printf("Result:     failed: %s\n", result.Error)
+		if result.RevertReason != "" {
+			fmt.Printf("Reason:     %s\n", result.RevertReason)
+		}
+	}
+
+	if !result.Traced {
+		fmt.Printf("Trace:      unavailable, simulated with eth_call (%s)\n", result.TraceError)
+		return nil
+	}
+
+	// Name the functions of internal calls where an ABI knows them
+	decoder, err := newCallDecoder()
+	if err != nil {
+		return err
+	}
+	label := func(input []byte) string {
+		call, err := decoder.Decode(input)
+		if err != nil {
+			return ""
+		}
+		return call.Signature
+	}
+	fmt.Println("Calls:")
+	for _, line := range tx.FormatCallTrace(result.Calls, label, nickname) {
+		fmt.Printf("  %s\n", line)
+	}
+
+	if len(result.TokenTransfers) > 0 {
+		fmt.Println("Token transfers:")
+		for _, transfer := range result.TokenTransfers {
+			amount := fmt.Sprintf("%s base units", transfer.Value)
+			if transfer.TokenID != nil {
+				amount = "token #" + transfer.TokenID.String()
+			}
+			fmt.Printf("  %s: %s from %s to %s\n", nickname(transfer.Token), amount, nickname(transfer.From), nickname(transfer.To))
+		}
+	}
+
+	if logs := tx.EventLogs(result.Calls); len(logs) > 0 {
+		fmt.Println("Events:")
+		for _, log := range logs {
+			event, err := decoder.DecodeLog(log.Topics, log.Data)
+			if err != nil {
+				fmt.Printf("  %s: %s\n", nickname(log.Address), err)
+				continue
+			}
+			fmt.Printf("  %s: %s\n", nickname(log.Address), event.Signature)
+			printDecodedArgs("    ", event.Args)
+		}
+	}
+
+	if len(result.StateChanges) > 0 {
+		fmt.Println("State changes:")
+		for _, key := range tx.SortedStateChanges(result.StateChanges) {
+			fmt.Printf("  %s: %s\n", nicknameKey(key), result.StateChanges[key])
+		}
+	}
+
+	if result.Effects != nil {
+		printEffects(result.Effects, chain)
+	}
+	return nil
+}
+
+// printEffects prints the net balance changes of a simulation, the sender's
+// in one summary line
+func printEffects(effects *tx.Effects, chain *core.ChainConfig) {
+	symbol, decimals := chain.GasTokenInfo()
+	fmt.Printf("Effects:    %s\n", effects.Summary(symbol, decimals))
+	for _, change := range effects.Changes {
+		sign := "+"
+		if change.Delta.Sign() < 0 {
+			sign = "-"
+		}
+		amount := new(big.Int).Abs(change.Delta)
+		fmt.Printf("  %s: %s%s\n", nickname(change.Account), sign, change.Format(amount, symbol, decimals))
+	}
+}
+
+// checkExpectedEffects compares the balance changes of a simulation with the
+// changes declared by --expect and fails on any mismatch
+func checkExpectedEffects(result *tx.SimulationResult, chain *core.ChainConfig) error {
+	if len(expectedEffects) == 0 {
+		return nil
+	}
+	expectations := make([]*tx.Expectation, 0, len(expectedEffects))
+	for _, value := range expectedEffects {
+		expectation, err := tx.ParseExpectation(value)
+		if err != nil {
+			return err
+		}
+		expectations = append(expectations, expectation)
+	}
+	if result.Effects == nil {
+		return fmt.Errorf("--expect needs the balance changes of a traced simulation (%s)", firstNonEmpty(result.TraceError, "not traced"))
+	}
+
+	symbol, decimals := chain.GasTokenInfo()
+	mismatches := result.Effects.Check(expectations, symbol, decimals)
+	if len(mismatches) == 0 {
+		fmt.Println("Effects match the expectations")
+		return nil
+	}
+	for _, mismatch := range mismatches {
+		fmt.Printf("Unexpected effect: %s\n", mismatch)
+	}
+	return fmt.Errorf("transaction effects do not match the %d expectation(s)", len(expectations))
+}
+
+func init() {
+	// Add flags
+	txSimulateCmd.Flags().StringVar(&inputFile, "input", "", "Unsigned transaction file")
+	txSimulateCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	txSimulateCmd.Flags().StringVar(&fromAddress, "from", "", "Sender address")
+	txSimulateCmd.Flags().StringVar(&outputFile, "output", "", "Write the completed transaction to this file for signing")
+	txSimulateCmd.Flags().StringVar(&traceRPC, "trace-rpc", "", "RPC endpoint supporting debug_traceCall (defaults to the chain's RPC URL)")
+	txSimulateCmd.Flags().StringVar(&priceSource, "price-source", "", "Show the cost in USD, priced by coingecko, chainlink or file:PATH")
+	addSimulationCacheFlags(txSimulateCmd.Flags())
+	txSimulateCmd.Flags().StringSliceVar(&abiFiles, "abi", nil, "ABI files used to decode internal calls")
+	txSimulateCmd.Flags().StringVar(&signatureDB, "4byte-db", "", "Local 4byte signature database (JSON selector -> signatures)")
+	txSimulateCmd.Flags().StringArrayVar(&expectedEffects, "expect", nil, "Declared balance change of the sender, e.g. \"send 1 ETH\" or \"receive >=1800 USDC\" (repeatable)")
+
+	// Mark required flags
+	txSimulateCmd.MarkFlagRequired("input")
+	txSimulateCmd.MarkFlagRequired("from")
+
+	// Mark commands honouring --dry-run
+	output.AllowDryRun(txSimulateCmd)
+
+	// Add commands
+	TxCmd.AddCommand(txSimulateCmd)
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	templatesDir   string
+	templateParams []string
+)
+
+// TemplatesCmd is the root command for inspecting signing templates
+var TemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List and inspect message and typed data templates",
+	Long: `Templates are parameterized EIP-712 typed data and EIP-191 messages signed with
+'sign template use'. Built-in templates cover EIP-2612 permits (permit), Sign-In with
+Ethereum (siwe), Safe transactions (safe-tx) and Governor votes (vote). An organization adds
+its own as <name>.json files in --templates, which replace built-in templates of the same name.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available templates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := templates.List(templatesDir)
+		if err != nil {
+			return err
+		}
+		for _, template := range list {
+			fmt.Printf("%-16s %-10s %s\n", template.Name, template.Kind, template.Description)
+			if template.Source != templates.SourceBuiltin {
+				fmt.Printf("%-16s %-10s from %s\n", "", "", template.Source)
+			}
+		}
+		return nil
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the parameters and body of a template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		template, err := templates.Find(templatesDir, args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (%s, %s)\n", template.Name, template.Kind, template.Source)
+		if template.Description != "" {
+			fmt.Printf("  %s\n", template.Description)
+		}
+		fmt.Println("Parameters:")
+		for _, param := range template.Params {
+			line := fmt.Sprintf("  %-16s %-9s", param.Name, param.Type)
+			if param.Default != nil {
+				line += fmt.Sprintf(" (default %q)", *param.Default)
+			}
+			if param.Description != "" {
+				line += " " + param.Description
+			}
+			fmt.Println(line)
+		}
+		fmt.Println("Body:")
+		if template.Kind == templates.KindMessage {
+			fmt.Println(template.Message)
+		} else {
+			fmt.Println(string(template.TypedData))
+		}
+		return nil
+	},
+}
+
+var signTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Sign messages and typed data from templates",
+}
+
+var signTemplateUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Instantiate a template and sign it",
+	Long: `Fill a template with --param name=value and sign the result. Parameters left out take
+their defaults; defaults may refer to the signing address, the chain ID of --chain, the
+current time or a random nonce. Values are checked against their parameter types and typed
+data against its EIP-712 types before anything is shown for confirmation. Address
+parameters accept ENS names. See 'templates list' and 'templates show'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		template, err := templates.Find(templatesDir, args[0])
+		if err != nil {
+			return err
+		}
+		values, err := parseTemplateParams(template)
+		if err != nil {
+			return err
+		}
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		capability := core.CapMessages
+		if template.Kind == templates.KindTypedData {
+			capability = core.CapTypedData
+		}
+		if err := checkSelectedSigner(cmd, capability); err != nil {
+			return err
+		}
+
+		// Open the key first; defaults may use its address
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		from := signer.Address()
+
+		instance, err := template.Instantiate(values, templates.Context{
+			Signer:  from,
+			ChainID: chain.ChainID,
+			Now:     time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Show what is being signed
+		fmt.Printf("Template %s (%s)\n", template.Name, template.Source)
+		if instance.TypedData != nil {
+			summary, err := instance.TypedData.Summary()
+			if err != nil {
+				return err
+			}
+			fmt.Print(summary)
+		} else {
+			fmt.Printf("Message:\n%s\n", instance.Message)
+		}
+		ok, err := confirm("Sign this?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errSigningAborted
+		}
+
+		detail := "template " + template.Name
+		if instance.TypedData != nil {
+			signature, err := signer.SignTypedData(instance.TypedData)
+			if err != nil {
+				return err
+			}
+			return saveTypedDataSignature(instance.TypedData, signature, detail)
+		}
+		signature, err := signer.SignMessage([]byte(instance.Message))
+		if err != nil {
+			return err
+		}
+		return saveMessageSignature([]byte(instance.Message), false, from, fmt.Sprintf("0x%x", signature), detail)
+	},
+}
+
+// parseTemplateParams parses the --param name=value pairs, resolving ENS
+// names given for address parameters
+func parseTemplateParams(template *templates.Template) (map[string]string, error) {
+	types := make(map[string]string)
+	for _, param := range template.Params {
+		types[param.Name] = param.Type
+	}
+
+	values := make(map[string]string)
+	for _, pair := range templateParams {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --param %q: expected name=value", pair)
+		}
+		if _, dup := values[name]; dup {
+			return nil, fmt.Errorf("--param %s given twice", name)
+		}
+		if types[name] == "address" && core.IsENSName(value) {
+			address, err := resolveENSName(value)
+			if err != nil {
+				return nil, err
+			}
+			value = address.Hex()
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func init() {
+	// Add flags
+	TemplatesCmd.PersistentFlags().StringVar(&templatesDir, "templates", templates.Dir, "Directory of organization templates")
+
+	signTemplateCmd.PersistentFlags().StringVar(&templatesDir, "templates", templates.Dir, "Directory of organization templates")
+	signTemplateUseCmd.Flags().StringArrayVar(&templateParams, "param", nil, "Template parameter as name=value (repeatable)")
+	signTemplateUseCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain of the {{chainId}} default and ENS names")
+
+	// Add commands
+	TemplatesCmd.AddCommand(templatesListCmd)
+	TemplatesCmd.AddCommand(templatesShowCmd)
+
+	signTemplateCmd.AddCommand(signTemplateUseCmd)
+	SignCmd.AddCommand(signTemplateCmd)
+}
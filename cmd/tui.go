@@ -0,0 +1,690 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/server"
+	"github.com/aryehky/gosignervaultcli/tx"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tuiChains      []string
+	tuiRefresh     time.Duration
+	tuiRecent      int
+	tuiDaemon      string
+	tuiDaemonToken string
+	tuiApprover    string
+)
+
+// TuiCmd is the interactive dashboard
+var TuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Live dashboard of keys, balances, pending transactions and history",
+	Long: `Show the keys of the file keystore with their balances on every --chain, the transactions
+being watched until they are final and the latest history records in one live view. Signed
+transactions of the history that are not final yet are watched automatically.
+
+With --daemon the approvals pane lists the requests a signing daemon holds for approval, each
+with its decoded summary, the verdict of the local --policy and the balance changes of its
+simulation. Approving or rejecting signs tokens with the --approver key, as 'serve approve'
+does, and submits them to the daemon. One rejection refuses a request.
+
+Keys:
+  tab / shift+tab  switch pane          up / down  select
+  n                new transaction from the selected key
+  p                preview the new transaction
+  s                sign and broadcast the new transaction
+  w                watch the selected history transaction
+  space            mark the selected request (approvals pane)
+  *                mark or unmark all requests (approvals pane)
+  a / x            approve / reject the marked or selected requests (approvals pane)
+  r                refresh now          q          quit
+
+Previews, signing and approvals suspend the dashboard and run on the plain terminal, with the
+same policy checks, confirmation, history records and audit trail as 'sign tx', 'tx speedup'
+and 'serve approve'. Every approval and rejection is recorded in the audit trail.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var chains []*core.ChainConfig
+		for _, name := range tuiChains {
+			chain, err := core.GetChainConfig(name)
+			if err != nil {
+				return fmt.Errorf("failed to get chain config: %v", err)
+			}
+			chains = append(chains, chain)
+		}
+		if len(chains) == 0 {
+			return fmt.Errorf("at least one --chain is required")
+		}
+
+		manager, err := fileKeyStore()
+		if err != nil {
+			return err
+		}
+
+		// Review the requests held by a signing daemon
+		var daemon *server.ApprovalClient
+		if tuiDaemon != "" {
+			if tuiApprover == "" {
+				return fmt.Errorf("--approver is required with --daemon")
+			}
+			token, err := os.ReadFile(tuiDaemonToken)
+			if err != nil {
+				return fmt.Errorf("failed to read daemon auth token: %v", err)
+			}
+			daemon = server.NewApprovalClient(tuiDaemon, strings.TrimSpace(string(token)))
+		}
+
+		dashboard := newDashboard(cmd, chains, manager, daemon)
+		defer dashboard.close()
+		_, err = tea.NewProgram(dashboard, tea.WithAltScreen()).Run()
+		return err
+	},
+}
+
+// Panes of the dashboard, in tab order
+const (
+	paneKeys = iota
+	panePending
+	paneHistory
+	paneApprovals
+	paneCount
+)
+
+// Fields of the new transaction form
+var draftFields = []string{"Chain", "To", "Amount", "Data"}
+
+// keyRow is a key of the keystore with its balance on every chain
+type keyRow struct {
+	name     string
+	address  common.Address
+	balances []string
+}
+
+// watchedTx is a transaction followed by the monitor of its chain
+type watchedTx struct {
+	chain *core.ChainConfig
+	hash  common.Hash
+}
+
+// draft is the transaction being built in the dashboard
+type draft struct {
+	key         string
+	from        common.Address
+	chain       *core.ChainConfig
+	transaction *core.Transaction
+}
+
+// dashboard is the bubbletea model of the tui command
+type dashboard struct {
+	cmd     *cobra.Command
+	chains  []*core.ChainConfig
+	manager *keystore.Manager
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	monitors map[string]*tx.Monitor
+	watched  []watchedTx
+
+	keys   []keyRow
+	recent []*tx.TransactionRecord
+
+	daemon    *server.ApprovalClient
+	approvals []*approvalRow
+	marked    map[common.Hash]bool
+
+	focus  int
+	cursor [paneCount]int
+	form   []string // field values while the new transaction form is open
+	field  int
+	draft  *draft
+	status string
+	width  int
+}
+
+// Messages of the dashboard
+type (
+	refreshedMsg struct {
+		keys   []keyRow
+		recent []*tx.TransactionRecord
+		err    error
+	}
+	tickMsg        struct{}
+	refreshTickMsg struct{}
+	draftMsg       struct {
+		draft *draft
+		err   error
+	}
+	signedMsg struct {
+		chain *core.ChainConfig
+		hash  common.Hash
+		err   error
+	}
+)
+
+func newDashboard(cmd *cobra.Command, chains []*core.ChainConfig, manager *keystore.Manager, daemon *server.ApprovalClient) *dashboard {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dashboard{
+		cmd:      cmd,
+		chains:   chains,
+		manager:  manager,
+		ctx:      ctx,
+		cancel:   cancel,
+		monitors: make(map[string]*tx.Monitor),
+		daemon:   daemon,
+		marked:   make(map[common.Hash]bool),
+		status:   "Loading...",
+	}
+}
+
+// close stops all monitors
+func (d *dashboard) close() {
+	d.cancel()
+	for _, monitor := range d.monitors {
+		monitor.Close()
+	}
+}
+
+func (d *dashboard) Init() tea.Cmd {
+	return tea.Batch(d.refresh(), d.refreshApprovals(), tick(), refreshTick())
+}
+
+// tick redraws the pending transactions every second
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+// refreshTick reloads balances and history every --refresh
+func refreshTick() tea.Cmd {
+	return tea.Tick(tuiRefresh, func(time.Time) tea.Msg { return refreshTickMsg{} })
+}
+
+// refresh loads keys, balances and history in the background
+func (d *dashboard) refresh() tea.Cmd {
+	chains, manager := d.chains, d.manager
+	return func() tea.Msg {
+		infos, err := listKeyInfos(manager, nil)
+		if err != nil {
+			return refreshedMsg{err: err}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		keys := make([]keyRow, 0, len(infos))
+		for _, info := range infos {
+			row := keyRow{name: info.Name, address: common.HexToAddress(info.Address)}
+			for _, chain := range chains {
+				account, err := tx.FetchAccountInfo(ctx, chain.RPCURL, row.address, nil)
+				if err != nil {
+					row.balances = append(row.balances, "unavailable")
+					continue
+				}
+				row.balances = append(row.balances, formatNative(chain, account.Balance))
+			}
+			keys = append(keys, row)
+		}
+
+		history, err := openHistory()
+		if err != nil {
+			return refreshedMsg{keys: keys, err: err}
+		}
+		defer history.Close()
+		return refreshedMsg{keys: keys, recent: history.GetRecentTransactions(tuiRecent)}
+	}
+}
+
+// watch follows a transaction on its chain's monitor until it is final
+func (d *dashboard) watch(chain *core.ChainConfig, hash common.Hash) error {
+	for _, watched := range d.watched {
+		if watched.hash == hash && watched.chain.Name == chain.Name {
+			return nil
+		}
+	}
+	monitor, ok := d.monitors[chain.Name]
+	if !ok {
+		var err error
+		if monitor, err = tx.NewMonitor(chain.RPCURL); err != nil {
+			return err
+		}
+		if interval := chain.BlockInterval(); interval > 0 {
+			monitor.PollInterval = interval
+		}
+		d.monitors[chain.Name] = monitor
+	}
+	if err := monitor.MonitorTransaction(d.ctx, hash); err != nil {
+		return err
+	}
+	d.watched = append(d.watched, watchedTx{chain: chain, hash: hash})
+	return nil
+}
+
+// chainOf returns the dashboard chain of a history record, or nil
+func (d *dashboard) chainOf(record *tx.TransactionRecord) *core.ChainConfig {
+	for _, chain := range d.chains {
+		if chain.ChainID.String() == record.ChainID {
+			return chain
+		}
+	}
+	return nil
+}
+
+func (d *dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		d.width = msg.Width
+
+	case tickMsg:
+		return d, tick()
+
+	case refreshTickMsg:
+		return d, tea.Batch(d.refresh(), d.refreshApprovals(), refreshTick())
+
+	case refreshedMsg:
+		if msg.err != nil {
+			d.status = msg.err.Error()
+		} else {
+			d.status = "Updated " + time.Now().Format("15:04:05")
+		}
+		d.keys, d.recent = msg.keys, msg.recent
+		// Signed transactions are watched until they are final
+		for _, record := range d.recent {
+			if chain := d.chainOf(record); chain != nil && (record.Status == tx.StatusSigned || record.Status == "pending") {
+				if err := d.watch(chain, record.Hash); err != nil {
+					d.status = err.Error()
+				}
+			}
+		}
+		d.clampCursors()
+
+	case draftMsg:
+		if msg.err != nil {
+			d.status = msg.err.Error()
+			return d, nil
+		}
+		d.draft = msg.draft
+		d.status = "Transaction ready: p to preview, s to sign and broadcast"
+
+	case approvalsMsg:
+		if msg.err != nil {
+			d.status = msg.err.Error()
+			return d, nil
+		}
+		d.approvals = msg.rows
+		// Forget the marks of requests no longer held
+		held := make(map[common.Hash]bool, len(d.approvals))
+		for _, row := range d.approvals {
+			held[row.request.ID] = d.marked[row.request.ID]
+		}
+		d.marked = held
+		d.clampCursors()
+
+	case decidedMsg:
+		verb := "Approved"
+		if msg.reject {
+			verb = "Rejected"
+		}
+		d.status = fmt.Sprintf("%s %d request(s)", verb, msg.decided)
+		if msg.err != nil {
+			d.status += ": " + msg.err.Error()
+		}
+		d.marked = make(map[common.Hash]bool)
+		return d, d.refreshApprovals()
+
+	case signedMsg:
+		if msg.err != nil {
+			d.status = msg.err.Error()
+			return d, nil
+		}
+		d.draft = nil
+		d.status = "Broadcast " + msg.hash.Hex()
+		if err := d.watch(msg.chain, msg.hash); err != nil {
+			d.status = err.Error()
+		}
+		return d, d.refresh()
+
+	case tea.KeyMsg:
+		if d.form != nil {
+			return d, d.editForm(msg)
+		}
+		return d, d.handleKey(msg)
+	}
+	return d, nil
+}
+
+// handleKey handles a key press outside the new transaction form
+func (d *dashboard) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if cmd, ok := d.handleApprovalKey(msg.String()); ok {
+		return cmd
+	}
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "tab":
+		d.focus = (d.focus + 1) % d.panes()
+	case "shift+tab":
+		d.focus = (d.focus + d.panes() - 1) % d.panes()
+	case "up", "k":
+		if d.cursor[d.focus] > 0 {
+			d.cursor[d.focus]--
+		}
+	case "down", "j":
+		d.cursor[d.focus]++
+		d.clampCursors()
+	case "r":
+		d.status = "Refreshing..."
+		return tea.Batch(d.refresh(), d.refreshApprovals())
+	case "n":
+		if len(d.keys) == 0 {
+			d.status = "The keystore has no keys"
+			return nil
+		}
+		d.form, d.field = []string{d.chains[0].Name, "", "", ""}, 1
+	case "w":
+		if d.focus != paneHistory || len(d.recent) == 0 {
+			d.status = "Select a transaction in the history pane to watch it"
+			return nil
+		}
+		record := d.recent[d.cursor[paneHistory]]
+		chain := d.chainOf(record)
+		if chain == nil {
+			d.status = fmt.Sprintf("Chain ID %s is not one of the dashboard's chains", record.ChainID)
+			return nil
+		}
+		if err := d.watch(chain, record.Hash); err != nil {
+			d.status = err.Error()
+		}
+	case "p":
+		if d.draft == nil {
+			d.status = "No transaction to preview; press n to create one"
+			return nil
+		}
+		current := d.draft
+		return tea.Exec(terminalFlow(func() error {
+			return previewTransaction(current.transaction, current.chain, current.from)
+		}), func(error) tea.Msg { return nil })
+	case "s":
+		if d.draft == nil {
+			d.status = "No transaction to sign; press n to create one"
+			return nil
+		}
+		return d.sign(d.draft)
+	}
+	return nil
+}
+
+// editForm handles a key press in the new transaction form
+func (d *dashboard) editForm(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		d.form = nil
+		d.status = "Cancelled"
+	case tea.KeyTab, tea.KeyDown:
+		d.field = (d.field + 1) % len(draftFields)
+	case tea.KeyShiftTab, tea.KeyUp:
+		d.field = (d.field + len(draftFields) - 1) % len(draftFields)
+	case tea.KeyBackspace:
+		if value := d.form[d.field]; value != "" {
+			d.form[d.field] = value[:len(value)-1]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		d.form[d.field] += string(msg.Runes)
+	case tea.KeyEnter:
+		if d.field < len(draftFields)-1 {
+			d.field++
+			return nil
+		}
+		values := d.form
+		d.form = nil
+		if len(d.keys) == 0 {
+			d.status = "The keystore has no keys"
+			return nil
+		}
+		key := d.keys[d.cursor[paneKeys]]
+		d.status = "Filling in nonce, fees and gas..."
+		return func() tea.Msg {
+			built, err := d.buildDraft(key, values)
+			return draftMsg{draft: built, err: err}
+		}
+	}
+	return nil
+}
+
+// buildDraft builds a transaction from the form values and fills in its
+// nonce, fees and gas limit from the chain
+func (d *dashboard) buildDraft(key keyRow, values []string) (*draft, error) {
+	chain, err := core.GetChainConfig(strings.TrimSpace(values[0]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain config: %v", err)
+	}
+	to, err := parseAddress("to", strings.TrimSpace(values[1]))
+	if err != nil {
+		return nil, err
+	}
+	transaction := &core.Transaction{
+		To:      &to,
+		Value:   new(big.Int),
+		ChainID: chain.ChainID,
+	}
+	if amount := strings.TrimSpace(values[2]); amount != "" {
+		_, decimals := chain.GasTokenInfo()
+		if transaction.Value, err = core.ParseTokenAmount(amount, decimals, rounding); err != nil {
+			return nil, err
+		}
+	}
+	if data := strings.TrimSpace(values[3]); data != "" {
+		if !isHex(data) {
+			return nil, fmt.Errorf("invalid data: %s", data)
+		}
+		transaction.Data = common.FromHex(data)
+	}
+
+	if err := fillTransaction(chain, transaction, key.address); err != nil {
+		return nil, err
+	}
+	if err := checkChainCapabilities(chain, transaction.ToEthereumTx()); err != nil {
+		return nil, err
+	}
+	return &draft{key: key.name, from: key.address, chain: chain, transaction: transaction}, nil
+}
+
+// sign suspends the dashboard to sign and broadcast the draft on the terminal
+func (d *dashboard) sign(current *draft) tea.Cmd {
+	var hash common.Hash
+	flow := terminalFlow(func() error {
+		signer, err := unlockDashboardKey(current.key)
+		if err != nil {
+			return err
+		}
+		hash, err = signAndBroadcast(d.cmd, signer, current.chain, current.transaction, "Sign and broadcast this transaction?")
+		if err == nil {
+			fmt.Printf("Transaction hash: %s\n", hash.Hex())
+		}
+		return err
+	})
+	return tea.Exec(flow, func(err error) tea.Msg {
+		return signedMsg{chain: current.chain, hash: hash, err: err}
+	})
+}
+
+// panes returns the number of panes shown; the approvals pane needs --daemon
+func (d *dashboard) panes() int {
+	if d.daemon == nil {
+		return paneApprovals
+	}
+	return paneCount
+}
+
+// unlockDashboardKey opens a key of the keystore on the terminal, asking for
+// its password unless --password is set or the agent holds the key
+func unlockDashboardKey(name string) (core.Signer, error) {
+	keyName = name
+	defer func(previous string) { password = previous }(password)
+	if password == "" {
+		if _, err := agentSigner(keyName); err != nil {
+			secret, err := promptSecret("Password of " + keyName)
+			if err != nil {
+				return nil, err
+			}
+			password = secret
+		}
+	}
+	signer, err := openSigner()
+	if err != nil {
+		return nil, err
+	}
+	return core.NewSigner(signer), nil
+}
+
+// clampCursors keeps the selection of every pane within its rows
+func (d *dashboard) clampCursors() {
+	for pane, rows := range []int{len(d.keys), len(d.watched), len(d.recent), len(d.approvals)} {
+		if d.cursor[pane] >= rows {
+			d.cursor[pane] = rows - 1
+		}
+		if d.cursor[pane] < 0 {
+			d.cursor[pane] = 0
+		}
+	}
+}
+
+func (d *dashboard) View() string {
+	var b strings.Builder
+
+	var header []string
+	for _, chain := range d.chains {
+		header = append(header, chain.Name)
+	}
+	d.section(&b, paneKeys, "Keys ("+strings.Join(header, ", ")+")")
+	for i, key := range d.keys {
+		d.row(&b, paneKeys, i, fmt.Sprintf("%-16s %s  %s", key.name, nickname(key.address), strings.Join(key.balances, "  ")))
+	}
+
+	d.section(&b, panePending, "Watched transactions")
+	for i, watched := range d.watched {
+		line := fmt.Sprintf("%-10s %s  ", watched.chain.Name, shortHash(watched.hash))
+		if status, err := d.monitors[watched.chain.Name].GetStatus(watched.hash); err == nil {
+			line += fmt.Sprintf("%-8s %d conf", status.Status, status.Confirmations)
+			if status.Error != "" {
+				line += "  " + status.Error
+			} else if status.Event != "" {
+				line += "  " + status.Event
+			}
+		}
+		d.row(&b, panePending, i, line)
+	}
+
+	d.section(&b, paneHistory, "Recent history")
+	for i, record := range d.recent {
+		d.row(&b, paneHistory, i, fmt.Sprintf("%s  %s  %-8s %s -> %s",
+			record.Timestamp.Format("01-02 15:04"), shortHash(record.Hash), record.Status, nicknameOf(record.From), nicknameOf(record.To)))
+	}
+
+	if d.daemon != nil {
+		d.section(&b, paneApprovals, "Approvals ("+tuiDaemon+")")
+		for i, row := range d.approvals {
+			d.row(&b, paneApprovals, i, d.approvalLine(row))
+			// Details of the selected request
+			if d.focus == paneApprovals && i == d.cursor[paneApprovals] {
+				if row.invalid != "" {
+					b.WriteString("      invalid: " + row.invalid + "\n")
+					continue
+				}
+				b.WriteString("      " + row.policy + "\n")
+				b.WriteString("      effects: " + row.effects + "\n")
+			}
+		}
+	}
+
+	b.WriteString("\n")
+	if d.form != nil && len(d.keys) > 0 {
+		b.WriteString("New transaction from " + d.keys[d.cursor[paneKeys]].name + " (enter: next/build, esc: cancel)\n")
+		for i, name := range draftFields {
+			marker := "  "
+			if i == d.field {
+				marker = "> "
+			}
+			fmt.Fprintf(&b, "%s%-7s %s\n", marker, name+":", d.form[i])
+		}
+	} else if d.draft != nil {
+		fmt.Fprintf(&b, "Ready: %s to %s on %s, nonce %d\n", formatNative(d.draft.chain, d.draft.transaction.Value),
+			nickname(*d.draft.transaction.To), d.draft.chain.Name, d.draft.transaction.Nonce)
+	}
+	b.WriteString("\n" + d.status + "\n")
+	b.WriteString("tab: pane  n: new  p: preview  s: sign  w: watch  r: refresh  q: quit\n")
+	if d.daemon != nil {
+		b.WriteString("approvals: space: mark  *: mark all  a: approve  x: reject\n")
+	}
+	return b.String()
+}
+
+// section writes the title of a pane, marking the focused one
+func (d *dashboard) section(b *strings.Builder, pane int, title string) {
+	if pane == d.focus {
+		title = "[" + title + "]"
+	}
+	b.WriteString("\n" + title + "\n")
+	if d.width > 0 {
+		b.WriteString(strings.Repeat("-", d.width) + "\n")
+	}
+}
+
+// row writes a row of a pane, marking the selected one
+func (d *dashboard) row(b *strings.Builder, pane, index int, line string) {
+	marker := "  "
+	if pane == d.focus && index == d.cursor[pane] {
+		marker = "> "
+	}
+	b.WriteString(marker + line + "\n")
+}
+
+// terminalFlow is a step of the dashboard that needs the plain terminal, such
+// as a preview or a password prompt. It runs while the dashboard is suspended.
+type terminalFlow func() error
+
+func (f terminalFlow) Run() error {
+	err := f()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+	}
+	fmt.Print("Press Enter to return to the dashboard")
+	stdin.ReadString('\n')
+	return err
+}
+
+// The flow uses the process' own stdin and stdout
+func (terminalFlow) SetStdin(io.Reader)  {}
+func (terminalFlow) SetStdout(io.Writer) {}
+func (terminalFlow) SetStderr(io.Writer) {}
+
+func init() {
+	// Add flags
+	TuiCmd.Flags().StringSliceVar(&tuiChains, "chain", []string{"ethereum"}, "Chains to show balances and watch transactions on (repeatable)")
+	TuiCmd.Flags().DurationVar(&tuiRefresh, "refresh", 30*time.Second, "How often balances and history are refreshed")
+	TuiCmd.Flags().IntVar(&tuiRecent, "recent", 10, "Number of history records shown")
+	TuiCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	TuiCmd.Flags().StringVar(&password, "password", "", "Key password (prompted for when signing otherwise)")
+	TuiCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	TuiCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	TuiCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	TuiCmd.Flags().BoolVar(&override, "override", false, "Sign even if the transaction violates the policy")
+	addSimulationCacheFlags(TuiCmd.Flags())
+	TuiCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	TuiCmd.Flags().StringVar(&tuiDaemon, "daemon", "", "URL of a signing daemon whose held requests to review, e.g. http://127.0.0.1:8550")
+	TuiCmd.Flags().StringVar(&tuiDaemonToken, "daemon-token-file", filepath.Join(keystore.DefaultKeystoreDir, "serve.token"), "Auth token file of the signing daemon")
+	TuiCmd.Flags().StringVar(&tuiApprover, "approver", "", "Key that signs approvals and rejections of held requests")
+	addKeystoreBackendFlags(TuiCmd)
+	addAddressBookFlags(TuiCmd)
+	addAuditFlags(TuiCmd)
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/server"
+	"github.com/aryehky/gosignervaultcli/tx"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// approvalRow is a request held by the signing daemon with its decoded
+// summary, the local policy's verdict and the effects of its simulation
+type approvalRow struct {
+	request *server.ApprovalRequest
+	summary string
+	policy  string
+	effects string
+	// invalid is set when the export does not match its payload hash or ID
+	invalid string
+}
+
+// Messages of the approvals pane
+type (
+	approvalsMsg struct {
+		rows []*approvalRow
+		err  error
+	}
+	decidedMsg struct {
+		decided int
+		reject  bool
+		err     error
+	}
+)
+
+// refreshApprovals loads the requests held by the daemon in the background.
+// Requests seen before keep their evaluation so they are simulated only once.
+func (d *dashboard) refreshApprovals() tea.Cmd {
+	if d.daemon == nil {
+		return nil
+	}
+	daemon, known := d.daemon, make(map[common.Hash]*approvalRow, len(d.approvals))
+	for _, row := range d.approvals {
+		known[row.request.ID] = row
+	}
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		requests, err := daemon.Pending(ctx)
+		if err != nil {
+			return approvalsMsg{err: err}
+		}
+		rows := make([]*approvalRow, 0, len(requests))
+		for _, request := range requests {
+			if row, ok := known[request.ID]; ok {
+				// Approvals change while the request is held
+				updated := *row
+				updated.request = request
+				rows = append(rows, &updated)
+				continue
+			}
+			rows = append(rows, evaluateApproval(ctx, request))
+		}
+		return approvalsMsg{rows: rows}
+	}
+}
+
+// evaluateApproval verifies a held request, summarizes it and, for
+// transactions, checks it against the local policy and simulates it
+func evaluateApproval(ctx context.Context, request *server.ApprovalRequest) *approvalRow {
+	row := &approvalRow{request: request, policy: "-", effects: "-"}
+	if err := request.Verify(); err != nil {
+		row.invalid = err.Error()
+		row.summary = "invalid request"
+		return row
+	}
+
+	switch request.Operation {
+	case audit.OpSignMessage:
+		row.summary = fmt.Sprintf("message of %d bytes", len(request.Message))
+		return row
+	case audit.OpSignTypedData:
+		row.summary = "typed data"
+		if typedData, err := request.ParsedTypedData(); err == nil {
+			row.summary = "typed data " + typedData.PrimaryType
+		}
+		return row
+	}
+
+	transaction, err := request.UnsignedTransaction()
+	if err != nil {
+		row.invalid = err.Error()
+		return row
+	}
+	to := "contract creation"
+	if transaction.To() != nil {
+		to = nickname(*transaction.To())
+	}
+	row.summary = fmt.Sprintf("%s to %s", formatApprovalValue(request, transaction.Value()), to)
+	if transaction.To() != nil && len(transaction.Data()) >= 4 {
+		if decoder, err := newCallDecoder(); err == nil {
+			if call, err := decoder.Decode(transaction.Data()); err == nil {
+				row.summary += " " + call.Signature
+			}
+		}
+	}
+
+	// What the local policy says about the request
+	row.policy = "policy passed"
+	if signingPolicy, err := loadPolicy(TuiCmd); err != nil {
+		row.policy = err.Error()
+	} else {
+		req := &policy.Request{
+			KeyName: request.Key,
+			To:      transaction.To(),
+			Value:   transaction.Value(),
+			Data:    transaction.Data(),
+			ChainID: request.ChainID,
+		}
+		if history, err := openHistory(); err == nil {
+			req.SpentToday = history.SpentSince(request.Signer.Hex(), request.ChainID.String(), time.Now().Add(-24*time.Hour))
+			history.Close()
+		}
+		if violations := signingPolicy.Evaluate(req); len(violations) > 0 {
+			messages := make([]string, len(violations))
+			for i, v := range violations {
+				messages[i] = v.String()
+			}
+			row.policy = "violations: " + strings.Join(messages, "; ")
+		}
+	}
+
+	// What the transaction does to the balances
+	chain := chainOfRequest(request)
+	if chain == nil {
+		row.effects = fmt.Sprintf("not simulated, chain ID %s is not configured", request.ChainID)
+		return row
+	}
+	if transaction.To() == nil {
+		row.effects = "not simulated, contract creation"
+		return row
+	}
+	simulator, err := tx.NewSimulator(chain.RPCURL)
+	if err != nil {
+		row.effects = err.Error()
+		return row
+	}
+	defer simulator.Close()
+	if err := simulator.SetL1Fees(chain.L1Fees); err != nil {
+		row.effects = err.Error()
+		return row
+	}
+	result, err := simulator.SimulateTransaction(ctx, &tx.Transaction{
+		From:     request.Signer,
+		To:       transaction.To(),
+		Value:    transaction.Value(),
+		Gas:      transaction.Gas(),
+		GasPrice: transaction.GasFeeCap(),
+		Data:     transaction.Data(),
+		Nonce:    transaction.Nonce(),
+		ChainID:  request.ChainID,
+	})
+	symbol, decimals := chain.GasTokenInfo()
+	switch {
+	case err != nil:
+		row.effects = err.Error()
+	case !result.Success:
+		row.effects = "would fail: " + firstNonEmpty(result.RevertReason, result.Error)
+	case result.Effects == nil:
+		row.effects = "succeeds, balance changes unavailable without debug_traceCall"
+	default:
+		row.effects = result.Effects.Summary(symbol, decimals)
+	}
+	return row
+}
+
+// selectedApprovals returns the marked requests, or the selected one if none
+// is marked
+func (d *dashboard) selectedApprovals() []*approvalRow {
+	var rows []*approvalRow
+	for _, row := range d.approvals {
+		if d.marked[row.request.ID] {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 && len(d.approvals) > 0 {
+		rows = append(rows, d.approvals[d.cursor[paneApprovals]])
+	}
+	return rows
+}
+
+// handleApprovalKey handles the keys of the approvals pane, reporting
+// whether the key was one of them
+func (d *dashboard) handleApprovalKey(key string) (tea.Cmd, bool) {
+	if d.focus != paneApprovals {
+		return nil, false
+	}
+	switch key {
+	case " ":
+		if len(d.approvals) > 0 {
+			id := d.approvals[d.cursor[paneApprovals]].request.ID
+			d.marked[id] = !d.marked[id]
+		}
+	case "*":
+		all := true
+		for _, row := range d.approvals {
+			all = all && d.marked[row.request.ID]
+		}
+		for _, row := range d.approvals {
+			d.marked[row.request.ID] = !all
+		}
+	case "a", "x":
+		rows := d.selectedApprovals()
+		if len(rows) == 0 {
+			d.status = "No request awaits approval"
+			return nil, true
+		}
+		return d.decide(rows, key == "x"), true
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// decide suspends the dashboard to review the requests on the terminal and
+// approve or reject them all with the approver key, recording each decision
+// in the audit trail
+func (d *dashboard) decide(rows []*approvalRow, reject bool) tea.Cmd {
+	verb, done := "Approve", "Approved"
+	if reject {
+		verb, done = "Reject", "Rejected"
+	}
+	decided := 0
+	flow := terminalFlow(func() error {
+		for _, row := range rows {
+			if row.invalid != "" {
+				return fmt.Errorf("refusing to decide request %s: %s", row.request.ID.Hex(), row.invalid)
+			}
+			if err := printApprovalRequest(row.request); err != nil {
+				return err
+			}
+			fmt.Printf("Policy:     %s\n", row.policy)
+			fmt.Printf("Effects:    %s\n\n", row.effects)
+		}
+		ok, err := confirm(fmt.Sprintf("%s %d request(s) as %s?", verb, len(rows), tuiApprover))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s aborted by user", strings.ToLower(verb))
+		}
+
+		signer, err := unlockDashboardKey(tuiApprover)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for _, row := range rows {
+			if err := decideApproval(ctx, d.daemon, signer, row.request, reject); err != nil {
+				return err
+			}
+			decided++
+			fmt.Printf("%s request %s\n", done, row.request.ID.Hex())
+		}
+		return nil
+	})
+	return tea.Exec(flow, func(err error) tea.Msg {
+		return decidedMsg{decided: decided, reject: reject, err: err}
+	})
+}
+
+// decideApproval signs an approval or rejection token for a request, submits
+// it to the daemon and records the decision in the audit trail
+func decideApproval(ctx context.Context, daemon *server.ApprovalClient, signer core.Signer, request *server.ApprovalRequest, reject bool) error {
+	token := &server.ApprovalToken{Request: request.ID, Approver: signer.Address(), Reject: reject}
+	signature, err := signer.SignMessage(token.Message())
+	if err != nil {
+		return err
+	}
+	token.Signature = signature
+
+	record := &audit.Record{
+		Operation:   audit.OpApproveRequest,
+		Outcome:     audit.OutcomeSigned,
+		Key:         tuiApprover,
+		Signer:      token.Approver.Hex(),
+		PayloadHash: request.PayloadHash,
+		Detail:      fmt.Sprintf("request %s (%s by %s)", request.ID.Hex(), request.Operation, request.Signer.Hex()),
+	}
+	if reject {
+		record.Operation, record.Outcome = audit.OpRejectRequest, audit.OutcomeRefused
+	}
+	if _, err := daemon.Submit(ctx, token); err != nil {
+		record.Outcome = audit.OutcomeFailed
+		record.Detail += ": " + err.Error()
+		if auditErr := recordAudit(record); auditErr != nil {
+			fmt.Printf("Warning: %v\n", auditErr)
+		}
+		return err
+	}
+	return recordAudit(record)
+}
+
+// approvalLine formats a request of the approvals pane
+func (d *dashboard) approvalLine(row *approvalRow) string {
+	mark := "[ ]"
+	if d.marked[row.request.ID] {
+		mark = "[x]"
+	}
+	expires := time.Until(time.Unix(row.request.Expiry, 0)).Truncate(time.Second)
+	return fmt.Sprintf("%s %s  %-16s %-12s %d/%d  %s  expires in %s", mark, shortHash(row.request.ID), row.request.Operation,
+		row.request.Key, len(row.request.Approvals), row.request.Threshold, row.summary, expires)
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+)
+
+// stdin is shared so buffered input isn't lost between prompts
+var stdin = bufio.NewReader(os.Stdin)
+
+// rounding is how amounts with more decimals than their token supports are handled
+var rounding = core.RoundExact
+
+// ConfigureRounding applies the global --rounding mode to decimal inputs
+func ConfigureRounding(mode string) error {
+	var err error
+	rounding, err = core.ParseRounding(mode)
+	return err
+}
+
+// loadPrivateKey loads and decrypts the key selected by --name and --password
+// for signing, refusing keys that are not active
+func loadPrivateKey() (*ecdsa.PrivateKey, error) {
+	if keyName == "" {
+		return nil, errors.New("--name is required")
+	}
+	if password == "" {
+		return nil, errors.New("--password is required")
+	}
+	if err := checkKeyState(keyName); err != nil {
+		return nil, err
+	}
+	return loadKey(keyName, password)
+}
+
+// loadKey loads and decrypts a named key from --keystore. Callers wipe the
+// key with securemem.WipeKey once done, or seal it in a keystore.KeySigner.
+func loadKey(name, password string) (*ecdsa.PrivateKey, error) {
+	// Load key
+	manager, err := keystore.NewManager(keystoreDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore manager: %v", err)
+	}
+
+	encryptedKey, err := manager.LoadKey(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key: %v", err)
+	}
+
+	// Decrypt key
+	privateKey, err := keystore.DecryptKey(encryptedKey, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return privateKey, nil
+}
+
+// errSigningAborted is returned when the user declines to sign
+var errSigningAborted = errors.New("signing aborted by user")
+
+// confirm asks the user a yes/no question on stdin unless --yes was given
+func confirm(prompt string) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+
+	fmt.Printf("%s [y/N]: ", prompt)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read confirmation: %v", err)
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// prompt asks for a line of input, returning def if the answer is empty
+func prompt(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read answer: %v", err)
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// promptSecret asks for a secret such as a password without echoing it when
+// stdin is a terminal
+func promptSecret(question string) (string, error) {
+	fmt.Printf("%s: ", question)
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && runtime.GOOS != "windows" {
+		if setEcho(false) == nil {
+			defer func() {
+				setEcho(true)
+				fmt.Println()
+			}()
+		}
+	}
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read answer: %v", err)
+	}
+	return strings.TrimRight(answer, "\r\n"), nil
+}
+
+// promptNewPassword asks for a new password twice
+func promptNewPassword(question string) (string, error) {
+	for {
+		first, err := promptSecret(question)
+		if err != nil {
+			return "", err
+		}
+		if first == "" {
+			fmt.Println("The password must not be empty")
+			continue
+		}
+		second, err := promptSecret("Repeat the password")
+		if err != nil {
+			return "", err
+		}
+		if first == second {
+			return first, nil
+		}
+		fmt.Println("The passwords do not match")
+	}
+}
+
+// setEcho turns terminal echo of stdin on or off
+func setEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	stty := exec.Command("stty", mode)
+	stty.Stdin = os.Stdin
+	return stty.Run()
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifySignature string
+	verifyAddress   string
+)
+
+// VerifyCmd is the root command for signature verification
+var VerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Recover the signer of a signature",
+	Long: `Recover the address that signed a message or EIP-712 typed data. With --address the
+signer must match it. --signature takes the hex signature or the output file of 'sign message'
+or 'sign typed'.`,
+}
+
+var verifyMessageCmd = &cobra.Command{
+	Use:   "message",
+	Short: "Recover the signer of a message",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signature, err := readSignature(verifySignature)
+		if err != nil {
+			return err
+		}
+		signer, err := core.RecoverMessageSigner([]byte(message), signature, rawMessage)
+		if err != nil {
+			return err
+		}
+		return reportSigner(signer)
+	},
+}
+
+var verifyTypedCmd = &cobra.Command{
+	Use:   "typed",
+	Short: "Recover the signer of EIP-712 typed data",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %v", err)
+		}
+		typedData, err := core.ParseTypedData(string(data))
+		if err != nil {
+			return err
+		}
+		signature, err := readSignature(verifySignature)
+		if err != nil {
+			return err
+		}
+
+		summary, err := typedData.Summary()
+		if err != nil {
+			return err
+		}
+		fmt.Print(summary)
+
+		signer, err := core.VerifyTypedDataSignature(typedData, signature)
+		if err != nil {
+			return err
+		}
+		return reportSigner(signer)
+	},
+}
+
+// readSignature decodes a hex signature, or reads it from a file holding the
+// hex signature or the JSON output of 'sign typed'
+func readSignature(value string) ([]byte, error) {
+	if !strings.HasPrefix(value, "0x") {
+		data, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature file: %v", err)
+		}
+		value = strings.TrimSpace(string(data))
+
+		var output struct {
+			Signature string `json:"signature"`
+		}
+		if strings.HasPrefix(value, "{") {
+			if err := json.Unmarshal([]byte(value), &output); err != nil {
+				return nil, fmt.Errorf("failed to parse signature file: %v", err)
+			}
+			value = output.Signature
+		}
+	}
+
+	signature, err := hexutil.Decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %v", err)
+	}
+	return signature, nil
+}
+
+// reportSigner prints the recovered signer and checks it against --address
+func reportSigner(signer common.Address) error {
+	book, err := loadAddressBook()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signer: %s\n", labeled(book, signer))
+
+	if verifyAddress == "" {
+		return nil
+	}
+	expected, err := parseAddress("address", verifyAddress)
+	if err != nil {
+		return err
+	}
+	if expected != signer {
+		return fmt.Errorf("signature was made by %s, not %s", signer.Hex(), expected.Hex())
+	}
+	fmt.Println("Signature matches the expected address")
+	return nil
+}
+
+func init() {
+	// Add flags
+	VerifyCmd.PersistentFlags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	addAddressBookFlags(VerifyCmd)
+	VerifyCmd.PersistentFlags().StringVar(&verifySignature, "signature", "", "Hex signature or a file holding it")
+	VerifyCmd.PersistentFlags().StringVar(&verifyAddress, "address", "", "Expected signer address")
+	verifyMessageCmd.Flags().StringVar(&message, "message", "", "Signed message")
+	verifyMessageCmd.Flags().BoolVar(&rawMessage, "raw", false, "The signature covers keccak256 of the message without the EIP-191 prefix")
+	verifyTypedCmd.Flags().StringVar(&inputFile, "input", "", "Typed data file")
+
+	// Mark required flags
+	VerifyCmd.MarkPersistentFlagRequired("signature")
+	verifyMessageCmd.MarkFlagRequired("message")
+	verifyTypedCmd.MarkFlagRequired("input")
+
+	// Add commands
+	VerifyCmd.AddCommand(verifyMessageCmd)
+	VerifyCmd.AddCommand(verifyTypedCmd)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchConfirmations uint64
+	watchTimeout       time.Duration
+)
+
+var txWatchCmd = &cobra.Command{
+	Use:   "watch <hash>...",
+	Short: "Follow transactions until they are final",
+	Long: `Follow transactions block by block until they have --confirmations confirmations, printing
+inclusion, confirmation depth and reorgs that drop a transaction back to pending. WebSocket
+endpoints deliver new blocks through a newHeads subscription; other endpoints are polled
+at the chain's block time.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var hashes []common.Hash
+		for _, arg := range args {
+			hashBytes := common.FromHex(arg)
+			if len(hashBytes) != common.HashLength {
+				return fmt.Errorf("invalid transaction hash: %s", arg)
+			}
+			hashes = append(hashes, common.BytesToHash(hashBytes))
+		}
+
+		// Load chain config
+		chain, err := core.GetChainConfig(chainName)
+		if err != nil {
+			return fmt.Errorf("failed to get chain config: %v", err)
+		}
+
+		monitor, err := tx.NewMonitor(chain.RPCURL)
+		if err != nil {
+			return err
+		}
+		defer monitor.Close()
+
+		monitor.Confirmations = watchConfirmations
+		if interval := chain.BlockInterval(); interval > 0 {
+			monitor.PollInterval = interval
+		}
+		monitor.OnSource = func(source string) {
+			explain("rpc", "new blocks of %s come from %s via %s", chain.Name, endpointName(chain.RPCURL), source)
+		}
+
+		// Recorded transactions are shown with their sender and recipient
+		history, err := openHistory()
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), watchTimeout)
+		defer cancel()
+
+		// Every transaction reports once when it is final or fails
+		done := make(chan *tx.TransactionStatus, len(hashes))
+		for _, hash := range hashes {
+			monitor.AddCallback(hash, func(status *tx.TransactionStatus) {
+				fmt.Printf("%s  %s  %s\n", status.Timestamp.Format("15:04:05"), shortHash(status.Hash), status.Event)
+				if status.Final || status.Status == "error" {
+					done <- status
+				}
+			})
+			if err := monitor.MonitorTransaction(ctx, hash); err != nil {
+				return err
+			}
+			fmt.Printf("Watching %s on %s for %d confirmations\n", hash.Hex(), chain.Name, watchConfirmations)
+			if history != nil {
+				if record, err := history.GetTransaction(chain.ChainID.String(), hash); err == nil {
+					fmt.Printf("    %s -> %s\n", nicknameOf(record.From), nicknameOf(record.To))
+				}
+			}
+		}
+
+		var failed int
+		for range hashes {
+			select {
+			case status := <-done:
+				switch {
+				case status.Status == "error":
+					failed++
+					fmt.Printf("%s: %s\n", status.Hash.Hex(), status.Error)
+				case status.Status == "failed":
+					failed++
+					fmt.Printf("%s: final in block %d but reverted\n", status.Hash.Hex(), status.BlockNum)
+				default:
+					fmt.Printf("%s: final in block %d after %d reorg(s)\n", status.Hash.Hex(), status.BlockNum, status.Reorgs)
+				}
+			case <-ctx.Done():
+				for _, hash := range hashes {
+					if status, err := monitor.GetStatus(hash); err == nil && !status.Final && status.Status != "error" {
+						fmt.Printf("%s: %s with %d confirmations when --timeout expired\n", hash.Hex(), status.Status, status.Confirmations)
+					}
+				}
+				return fmt.Errorf("transactions not final within %s", watchTimeout)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d transactions failed", failed, len(hashes))
+		}
+		return nil
+	},
+}
+
+// shortHash abbreviates a hash for live status lines
+func shortHash(hash common.Hash) string {
+	hex := hash.Hex()
+	return hex[:10] + "..." + hex[len(hex)-4:]
+}
+
+func init() {
+	// Add flags
+	txWatchCmd.Flags().StringVar(&chainName, "chain", "ethereum", "Chain name")
+	txWatchCmd.Flags().Uint64Var(&watchConfirmations, "confirmations", tx.DefaultConfirmations, "Confirmations after which a transaction is final")
+	txWatchCmd.Flags().DurationVar(&watchTimeout, "timeout", time.Hour, "Give up if the transactions are not final by then")
+	txWatchCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	txWatchCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+
+	// Add commands
+	TxCmd.AddCommand(txWatchCmd)
+}
@@ -0,0 +1,550 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/aryehky/gosignervaultcli/walletconnect"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+// envWCProjectID is the WalletConnect project ID used without --project-id
+const envWCProjectID = "WALLETCONNECT_PROJECT_ID"
+
+// wcMethods are the dapp requests that are signed
+var wcMethods = []string{"eth_sendTransaction", "personal_sign", "eth_signTypedData", "eth_signTypedData_v4"}
+
+// wcMethodCapabilities are the kinds of signature the wcMethods need
+var wcMethodCapabilities = map[string]core.Capability{
+	"eth_sendTransaction":  core.CapTransactions,
+	"personal_sign":        core.CapMessages,
+	"eth_signTypedData":    core.CapTypedData,
+	"eth_signTypedData_v4": core.CapTypedData,
+}
+
+// wcMetadata is how the vault introduces itself to dapps
+var wcMetadata = walletconnect.Metadata{
+	Name:        "GoSignerVaultCLI",
+	Description: "Command-line wallet and transaction signer",
+	URL:         "https://github.com/aryehky/GoSignerVaultCLI",
+	Icons:       []string{},
+}
+
+var (
+	wcProjectID   string
+	wcRelay       string
+	wcPairTimeout time.Duration
+)
+
+// WCCmd is the root command for WalletConnect sessions
+var WCCmd = &cobra.Command{
+	Use:   "wc",
+	Short: "Sign dapp requests over WalletConnect v2",
+}
+
+var wcConnectCmd = &cobra.Command{
+	Use:   "connect <uri>",
+	Short: "Pair with a dapp and sign its requests",
+	Long: `Pair with a dapp through the "wc:" URI of its WalletConnect dialog (copy it from the QR code
+modal) and serve its requests until the dapp disconnects or the command is interrupted.
+
+The session grants the signing key on every configured chain the dapp asks for; a dapp requiring
+a chain that is not configured is refused. eth_sendTransaction is filled, checked against the
+signing policy, previewed and confirmed as with 'sign tx', then signed, recorded and broadcast, and
+its hash returned to the dapp. personal_sign and eth_signTypedData(_v4) are checked against the
+signatures rule, allowed chains and denied destinations of the policy, which --override does not
+lift, then shown and confirmed before the signature is returned. Other methods, including eth_sign, are refused. There is no
+--yes: every request is confirmed at the terminal. The name and URL a dapp presents are its own
+claim and not verified.
+
+The relay requires a WalletConnect Cloud project ID, from --project-id or $WALLETCONNECT_PROJECT_ID.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if offlineMode {
+			return fmt.Errorf("WalletConnect needs network access")
+		}
+		uri, err := walletconnect.ParseURI(args[0])
+		if err != nil {
+			return err
+		}
+		projectID := firstNonEmpty(wcProjectID, os.Getenv(envWCProjectID))
+		if projectID == "" {
+			return fmt.Errorf("--project-id or $%s is required by the WalletConnect relay", envWCProjectID)
+		}
+
+		signer, release, err := openSelectedSigner(cmd)
+		if err != nil {
+			return err
+		}
+		defer release()
+		from := signer.Address()
+
+		// Messages and typed data are checked against the policy loaded once
+		// for the session; transactions load it per request like 'sign tx'
+		signingPolicy, err := loadPolicy(cmd)
+		if err != nil {
+			return err
+		}
+
+		dialer, err := tx.WebSocketDialer(wcRelay)
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		client, err := walletconnect.Dial(ctx, wcRelay, projectID, dialer, wcMetadata)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		fmt.Println("Waiting for the dapp's session proposal...")
+		pairCtx, cancel := context.WithTimeout(ctx, wcPairTimeout)
+		proposal, err := client.Pair(pairCtx, uri)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("no session proposal received: %v", err)
+		}
+
+		chains, err := sessionChains(proposal)
+		if err != nil {
+			if reason := new(walletconnect.Error); errors.As(err, &reason) {
+				client.Reject(ctx, proposal, reason)
+			}
+			return err
+		}
+		fmt.Println("Session proposal")
+		fmt.Printf("  Dapp:     %s (%s, not verified)\n", proposal.Proposer.Name, proposal.Proposer.URL)
+		if proposal.Proposer.Description != "" {
+			fmt.Printf("  About:    %s\n", proposal.Proposer.Description)
+		}
+		fmt.Printf("  Account:  %s\n", nickname(from))
+		names := make([]string, len(chains))
+		for i, chain := range chains {
+			names[i] = chain.Name
+		}
+		fmt.Printf("  Chains:   %s\n", strings.Join(names, ", "))
+		ok, err := confirm("Connect to this dapp?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			client.Reject(ctx, proposal, walletconnect.Rejected("User rejected."))
+			return fmt.Errorf("session rejected by user")
+		}
+
+		chainIDs := make([]*big.Int, len(chains))
+		accounts := make([]string, len(chains))
+		byID := make(map[string]*core.ChainConfig)
+		for i, chain := range chains {
+			chainIDs[i] = chain.ChainID
+			accounts[i] = fmt.Sprintf("eip155:%s:%s", chain.ChainID, from.Hex())
+			byID[chain.ChainID.String()] = chain
+		}
+		// Methods the dapp insists on are granted so it connects; the ones
+		// not in wcMethods or that the signer cannot sign are refused when
+		// requested
+		var methods []string
+		granted := make(map[string]bool)
+		for _, method := range wcMethods {
+			if signer.Supports(wcMethodCapabilities[method]) {
+				granted[method] = true
+				methods = append(methods, method)
+			}
+		}
+		for _, method := range proposal.Methods() {
+			if !granted[method] {
+				granted[method] = true
+				methods = append(methods, method)
+			}
+		}
+		session, err := client.Approve(ctx, proposal, chainIDs, accounts, methods, []string{"chainChanged", "accountsChanged"})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Connected to %s until %s; waiting for requests (Ctrl-C disconnects)\n", proposal.Proposer.Name, session.Expiry.Format(time.RFC3339))
+
+		dapp := &dappSession{cmd: cmd, signer: signer, policy: signingPolicy, chains: byID, peer: session.Peer}
+		err = session.Serve(ctx, dapp.handle)
+		switch {
+		case errors.Is(err, walletconnect.ErrSessionDeleted):
+			fmt.Println("The dapp ended the session")
+			return nil
+		case ctx.Err() != nil:
+			disconnectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := session.Disconnect(disconnectCtx); err != nil {
+				fmt.Printf("Warning: failed to tell the dapp about the disconnect: %v\n", err)
+			}
+			fmt.Println("Disconnected")
+			return nil
+		}
+		return err
+	},
+}
+
+// sessionChains returns the configured chains a proposal gets: every chain the
+// dapp requires, which must all be configured, and the configured optional ones
+func sessionChains(proposal *walletconnect.Proposal) ([]*core.ChainConfig, error) {
+	required, optional, err := proposal.EIP155Chains()
+	if err != nil {
+		return nil, err
+	}
+	var chains []*core.ChainConfig
+	seen := make(map[string]bool)
+	for i, chainID := range append(required, optional...) {
+		chain, err := chainWithID(chainID)
+		if err != nil {
+			return nil, err
+		}
+		if chain == nil {
+			if i < len(required) {
+				return nil, &walletconnect.Error{
+					Code:    walletconnect.CodeUnsupportedChains,
+					Message: fmt.Sprintf("the dapp requires chain ID %s, which is not configured; add it with 'chains add'", chainID),
+				}
+			}
+			continue
+		}
+		if !seen[chain.Name] {
+			seen[chain.Name] = true
+			chains = append(chains, chain)
+		}
+	}
+	if len(chains) == 0 {
+		return nil, &walletconnect.Error{Code: walletconnect.CodeUnsupportedChains, Message: "the dapp asks for no configured EVM chain"}
+	}
+	return chains, nil
+}
+
+// dappSession signs the requests of a connected dapp
+type dappSession struct {
+	cmd    *cobra.Command
+	signer core.Signer
+	policy *policy.Policy
+	chains map[string]*core.ChainConfig
+	peer   walletconnect.Metadata
+}
+
+// handle routes a dapp request through the same checks, preview and
+// confirmation as the equivalent command
+func (d *dappSession) handle(ctx context.Context, request *walletconnect.Request) (interface{}, error) {
+	chain, ok := d.chains[request.ChainID.String()]
+	if !ok {
+		return nil, &walletconnect.Error{Code: walletconnect.CodeUnsupportedChains, Message: fmt.Sprintf("chain ID %s is not part of the session", request.ChainID)}
+	}
+	fmt.Printf("\n%s requests %s on %s\n", d.peer.Name, request.Method, chain.Name)
+	if capability, ok := wcMethodCapabilities[request.Method]; ok && !d.signer.Supports(capability) {
+		err := &walletconnect.Error{Code: walletconnect.CodeUnsupportedMethods, Message: fmt.Sprintf("the signing key cannot sign %s", capability)}
+		fmt.Printf("Request refused: %v\n", err)
+		return nil, err
+	}
+
+	var result interface{}
+	var err error
+	switch request.Method {
+	case "eth_sendTransaction":
+		result, err = d.sendTransaction(chain, request.Params)
+	case "personal_sign":
+		result, err = d.personalSign(request.Params)
+	case "eth_signTypedData", "eth_signTypedData_v4":
+		result, err = d.signTypedData(chain, request.Params)
+	default:
+		err = &walletconnect.Error{Code: walletconnect.CodeUnsupportedMethods, Message: fmt.Sprintf("method %s is not supported", request.Method)}
+	}
+	if errors.Is(err, errSigningAborted) {
+		err = walletconnect.Rejected("User rejected the request.")
+	}
+	if err != nil {
+		fmt.Printf("Request refused: %v\n", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// dappTransaction is the transaction object of eth_sendTransaction
+type dappTransaction struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Value                *hexutil.Big    `json:"value"`
+	Data                 hexutil.Bytes   `json:"data"`
+	Input                hexutil.Bytes   `json:"input"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+}
+
+// sendTransaction fills, checks, signs and broadcasts a dapp's transaction.
+// The nonce is always the account's own; the gas limit and fees the dapp
+// suggests are kept unless --gas-preset replaces the fees.
+func (d *dappSession) sendTransaction(chain *core.ChainConfig, raw json.RawMessage) (interface{}, error) {
+	var params []dappTransaction
+	if err := json.Unmarshal(raw, &params); err != nil || len(params) == 0 {
+		return nil, fmt.Errorf("invalid eth_sendTransaction parameters")
+	}
+	request := params[0]
+	from := d.signer.Address()
+	if request.From != from {
+		return nil, fmt.Errorf("transaction is from %s, not from the session account %s", request.From.Hex(), from.Hex())
+	}
+	data := request.Data
+	if len(data) == 0 {
+		data = request.Input
+	}
+	transaction := &core.Transaction{
+		To:      request.To,
+		Value:   big.NewInt(0),
+		Data:    data,
+		ChainID: chain.ChainID,
+	}
+	if request.Value != nil {
+		transaction.Value = request.Value.ToInt()
+	}
+	if request.Gas != nil {
+		transaction.GasLimit = uint64(*request.Gas)
+	}
+	if request.MaxFeePerGas != nil {
+		transaction.MaxFeePerGas = request.MaxFeePerGas.ToInt()
+		transaction.MaxPriorityFeePerGas = big.NewInt(0)
+		if request.MaxPriorityFeePerGas != nil {
+			transaction.MaxPriorityFeePerGas = request.MaxPriorityFeePerGas.ToInt()
+		}
+	} else if request.GasPrice != nil {
+		transaction.GasPrice = request.GasPrice.ToInt()
+	}
+
+	if err := fillTransaction(chain, transaction, from); err != nil {
+		return nil, err
+	}
+	if err := checkChainCapabilities(chain, transaction.ToEthereumTx()); err != nil {
+		return nil, err
+	}
+	hash, err := signAndBroadcast(d.cmd, d.signer, chain, transaction, fmt.Sprintf("Sign and broadcast this transaction for %s?", d.peer.Name))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Transaction broadcast: %s\n", hash.Hex())
+	return hash, nil
+}
+
+// personalSign shows and signs an EIP-191 message; the message arrives hex
+// encoded, followed by the account
+func (d *dappSession) personalSign(raw json.RawMessage) (interface{}, error) {
+	var params []string
+	if err := json.Unmarshal(raw, &params); err != nil || len(params) < 2 {
+		return nil, fmt.Errorf("invalid personal_sign parameters")
+	}
+	// Some dapps send the account first
+	encoded, account := params[0], params[1]
+	if common.IsHexAddress(encoded) && !common.IsHexAddress(account) {
+		encoded, account = account, encoded
+	}
+	from := d.signer.Address()
+	if !common.IsHexAddress(account) || common.HexToAddress(account) != from {
+		return nil, fmt.Errorf("message is for %s, not for the session account %s", account, from.Hex())
+	}
+	message := []byte(encoded)
+	if decoded, err := hexutil.Decode(encoded); err == nil {
+		message = decoded
+	}
+	payloadHash := common.BytesToHash(core.MessageHash(message, false))
+	if err := d.checkSignaturePolicy(&policy.SignatureRequest{KeyName: keyName}, audit.OpSignMessage, "", payloadHash); err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Message to sign")
+	if printable(message) {
+		for _, line := range strings.Split(string(message), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	} else {
+		fmt.Printf("  0x%x (%d bytes, not text)\n", message, len(message))
+	}
+	ok, err := confirm(fmt.Sprintf("Sign this message for %s?", d.peer.Name))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errSigningAborted
+	}
+
+	signature, err := d.signer.SignMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAudit(&audit.Record{
+		Operation:   audit.OpSignMessage,
+		Outcome:     audit.OutcomeSigned,
+		Key:         signerName(),
+		Signer:      from.Hex(),
+		PayloadHash: payloadHash,
+		Policy:      []string{"policy passed"},
+		Detail:      "walletconnect " + d.peer.URL,
+	}); err != nil {
+		return nil, err
+	}
+	fmt.Println("Message signed")
+	return hexutil.Bytes(signature), nil
+}
+
+// signTypedData shows and signs EIP-712 typed data, passed as a JSON string or
+// object after the account
+func (d *dappSession) signTypedData(chain *core.ChainConfig, raw json.RawMessage) (interface{}, error) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil || len(params) < 2 {
+		return nil, fmt.Errorf("invalid eth_signTypedData parameters")
+	}
+	var account, text string
+	if err := json.Unmarshal(params[0], &account); err != nil {
+		return nil, fmt.Errorf("invalid eth_signTypedData account")
+	}
+	from := d.signer.Address()
+	if !common.IsHexAddress(account) || common.HexToAddress(account) != from {
+		return nil, fmt.Errorf("typed data is for %s, not for the session account %s", account, from.Hex())
+	}
+	if err := json.Unmarshal(params[1], &text); err != nil {
+		text = string(params[1])
+	}
+	typedData, err := core.ParseTypedData(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := typedData.Validate(); err != nil {
+		return nil, err
+	}
+	if domainChain := typedData.Domain.ChainId; domainChain != nil && (*big.Int)(domainChain).Cmp(chain.ChainID) != 0 {
+		return nil, fmt.Errorf("typed data is for chain ID %s, but the request is on %s", (*big.Int)(domainChain), chain.Name)
+	}
+	hash, err := typedData.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkSignaturePolicy(policy.NewTypedDataRequest(keyName, typedData), audit.OpSignTypedData, chain.ChainID.String(), hash); err != nil {
+		return nil, err
+	}
+
+	summary, err := typedData.Summary()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print(summary)
+	ok, err := confirm(fmt.Sprintf("Sign this typed data for %s?", d.peer.Name))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errSigningAborted
+	}
+
+	signature, err := d.signer.SignTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	// Dapps expect V as 27/28 like MetaMask returns it
+	if signature[crypto.RecoveryIDOffset] < 27 {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
+	if err := recordAudit(&audit.Record{
+		Operation:   audit.OpSignTypedData,
+		Outcome:     audit.OutcomeSigned,
+		Key:         signerName(),
+		Signer:      from.Hex(),
+		ChainID:     chain.ChainID.String(),
+		PayloadHash: hash,
+		Policy:      []string{"policy passed"},
+		Detail:      "walletconnect " + d.peer.URL + " " + typedData.PrimaryType,
+	}); err != nil {
+		return nil, err
+	}
+	fmt.Println("Typed data signed")
+	return hexutil.Bytes(signature), nil
+}
+
+// checkSignaturePolicy refuses a message or typed data request that violates
+// the signing policy. As in the daemon, a dapp's signature request cannot be
+// overridden; the refusal is recorded in the audit trail.
+func (d *dappSession) checkSignaturePolicy(req *policy.SignatureRequest, operation, chainID string, payloadHash common.Hash) error {
+	violations := d.policy.EvaluateSignature(req)
+	if len(violations) == 0 {
+		return nil
+	}
+	var decisions []string
+	for _, v := range violations {
+		fmt.Printf("Policy violation: %s\n", v)
+		decisions = append(decisions, "violation: "+v.String())
+	}
+	if err := recordAudit(&audit.Record{
+		Operation:   operation,
+		Outcome:     audit.OutcomeRefused,
+		Key:         signerName(),
+		Signer:      d.signer.Address().Hex(),
+		ChainID:     chainID,
+		PayloadHash: payloadHash,
+		Policy:      decisions,
+		Detail:      "walletconnect " + d.peer.URL,
+	}); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	return &policy.ViolationError{Violations: violations}
+}
+
+// printable reports whether a message is text that can be shown as is
+func printable(message []byte) bool {
+	if !utf8.Valid(message) {
+		return false
+	}
+	for _, r := range string(message) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	// Add flags
+	wcConnectCmd.Flags().StringVar(&wcProjectID, "project-id", "", "WalletConnect Cloud project ID (defaults to $"+envWCProjectID+")")
+	wcConnectCmd.Flags().StringVar(&wcRelay, "relay", walletconnect.DefaultRelayURL, "WalletConnect relay")
+	wcConnectCmd.Flags().DurationVar(&wcPairTimeout, "pair-timeout", 2*time.Minute, "Time to wait for the dapp's session proposal")
+	wcConnectCmd.Flags().StringVar(&gasPreset, "gas-preset", "", "Replace the fees dapps suggest with a gas oracle preset (slow, standard, fast)")
+	addGasOracleFlags(wcConnectCmd)
+	wcConnectCmd.Flags().StringVar(&keystoreDir, "keystore", keystore.DefaultKeystoreDir, "Keystore directory")
+	wcConnectCmd.Flags().StringVar(&keyName, "name", "", "Key name")
+	wcConnectCmd.Flags().StringVar(&password, "password", "", "Key password")
+	wcConnectCmd.Flags().BoolVar(&useHW, "hardware", false, "Sign with a connected hardware wallet")
+	wcConnectCmd.Flags().IntVar(&hwDevice, "device", 0, "Hardware wallet index as shown by 'hardware list'")
+	wcConnectCmd.Flags().StringVar(&hwPath, "derivation-path", "", "Full derivation path of the hardware wallet account")
+	wcConnectCmd.Flags().Uint32Var(&hwAccountIndex, "account-index", 0, "Account index on the default derivation path")
+	wcConnectCmd.Flags().StringVar(&historyFile, "history", tx.DefaultHistoryFile, "Transaction history file")
+	wcConnectCmd.Flags().StringVar(&historyPassword, "history-password", "", "Password of an encrypted history")
+	wcConnectCmd.Flags().StringVar(&policyFile, "policy", policy.DefaultPolicyFile, "Signing policy file")
+	wcConnectCmd.Flags().BoolVar(&override, "override", false, "Sign even if a transaction violates the policy")
+	addSimulationCacheFlags(wcConnectCmd.Flags())
+	wcConnectCmd.Flags().StringVar(&nonceLeaseFile, "leases", tx.DefaultNonceLeaseFile, "Shared nonce lease table to update")
+	addKeystoreBackendFlags(wcConnectCmd)
+	addSignerFlags(wcConnectCmd)
+	addAddressBookFlags(WCCmd)
+	addAuditFlags(WCCmd)
+
+	// Add commands
+	WCCmd.AddCommand(wcConnectCmd)
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// ABIDir holds the ABI library, one <name>.json bare JSON ABI each. Stored
+// ABIs are used to decode calldata and event logs everywhere.
+var ABIDir = filepath.Join(paths.ConfigDir(), "abis")
+
+// abiNamePattern restricts ABI names to safe file names
+var abiNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// StoredABI is an ABI of the library
+type StoredABI struct {
+	Name string
+	Path string
+	ABI  abi.ABI
+}
+
+// ReadABIFile reads and parses a JSON ABI file. Both bare ABIs and compiler
+// artifacts with an "abi" field are accepted; the bare ABI is returned.
+func ReadABIFile(path string) ([]byte, abi.ABI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, abi.ABI{}, fmt.Errorf("failed to read ABI file: %v", err)
+	}
+
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if json.Unmarshal(data, &artifact) == nil && len(artifact.ABI) > 0 {
+		data = artifact.ABI
+	}
+
+	contractABI, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, abi.ABI{}, fmt.Errorf("failed to parse ABI file %s: %v", path, err)
+	}
+	return data, contractABI, nil
+}
+
+// SaveABI adds the ABI of a file to the library under a name, replacing an
+// ABI of the same name. It returns the path of the stored ABI.
+func SaveABI(dir, name, path string) (string, error) {
+	if !abiNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid ABI name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	data, contractABI, err := ReadABIFile(path)
+	if err != nil {
+		return "", err
+	}
+	if len(contractABI.Methods) == 0 && len(contractABI.Events) == 0 {
+		return "", fmt.Errorf("ABI file %s has no functions or events", path)
+	}
+
+	var formatted bytes.Buffer
+	if err := json.Indent(&formatted, data, "", "  "); err != nil {
+		return "", fmt.Errorf("failed to format ABI: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create ABI directory: %v", err)
+	}
+	stored := filepath.Join(dir, name+".json")
+	if err := os.WriteFile(stored, append(formatted.Bytes(), '\n'), 0600); err != nil {
+		return "", fmt.Errorf("failed to save ABI: %v", err)
+	}
+	return stored, nil
+}
+
+// ListABIs returns the ABIs of the library sorted by name. A missing
+// directory is an empty library.
+func ListABIs(dir string) ([]StoredABI, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ABIs: %v", err)
+	}
+	sort.Strings(files)
+
+	var stored []StoredABI
+	for _, file := range files {
+		_, contractABI, err := ReadABIFile(file)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, StoredABI{
+			Name: strings.TrimSuffix(filepath.Base(file), ".json"),
+			Path: file,
+			ABI:  contractABI,
+		})
+	}
+	return stored, nil
+}
+
+// RemoveABI removes an ABI from the library
+func RemoveABI(dir, name string) error {
+	if !abiNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid ABI name %q", name)
+	}
+	if err := os.Remove(filepath.Join(dir, name+".json")); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no ABI named %q; see 'abi list'", name)
+		}
+		return fmt.Errorf("failed to remove ABI: %v", err)
+	}
+	return nil
+}
+
+// LoadABIDir registers the functions and events of every ABI of the library
+func (d *CallDecoder) LoadABIDir(dir string) error {
+	stored, err := ListABIs(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range stored {
+		d.AddABI(entry.ABI)
+	}
+	return nil
+}
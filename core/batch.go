@@ -2,77 +2,317 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
-// BatchSigner handles signing multiple transactions in parallel
+// BatchEntry is one transaction of a batch file. Key and Chain select the
+// signing key and chain of the entry, falling back to the batch defaults. A
+// nonce given in the entry restarts the sequence of its sender.
+type BatchEntry struct {
+	Key   string  `json:"key,omitempty"`
+	Chain string  `json:"chain,omitempty"`
+	Nonce *uint64 `json:"nonce,omitempty"`
+	Transaction
+}
+
+// BatchSignResult represents the result of signing one batch entry
+type BatchSignResult struct {
+	Index          int          `json:"index"`
+	Key            string       `json:"key"`
+	Chain          string       `json:"chain"`
+	From           string       `json:"from,omitempty"`
+	Nonce          *uint64      `json:"nonce,omitempty"`
+	Hash           *common.Hash `json:"hash,omitempty"`
+	Contract       string       `json:"contract,omitempty"`
+	RawTransaction string       `json:"rawTransaction,omitempty"`
+	// Device is the hardware wallet that signed the entry
+	Device string `json:"device,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchDevice is a hardware wallet signing its share of a batch
+type BatchDevice struct {
+	// Name identifies the device in the results, e.g. its URL
+	Name   string
+	Signer Signer
+}
+
+// BatchSigner signs batch entries in order. Every sender gets sequential
+// nonces per chain; an entry that fails does not use up its nonce, so the
+// signed transactions of a sender never leave a gap.
 type BatchSigner struct {
-	wallet *Wallet
+	// OpenKey returns the signer of a named key
+	OpenKey func(name string) (Signer, error)
+	// NonceAt returns the first nonce of a sender whose first entry has no
+	// nonce. Without it such entries fail.
+	NonceAt func(chain *ChainConfig, from common.Address) (uint64, error)
+	// Check is called with the final transaction before it is signed, e.g.
+	// to enforce the signing policy
+	Check func(entry *BatchEntry, transaction *Transaction, signer Signer) error
+	// Signed is called after an entry was signed, e.g. to record it in the
+	// history. It is called in the order of the entries, also when devices
+	// sign in parallel.
+	Signed func(entry *BatchEntry, transaction *Transaction, from common.Address, rawTx string) error
+
+	keys   map[string]Signer
+	nonces map[string]uint64
 }
 
 // NewBatchSigner creates a new batch signer
-func NewBatchSigner(wallet *Wallet) *BatchSigner {
+func NewBatchSigner(openKey func(name string) (Signer, error)) *BatchSigner {
 	return &BatchSigner{
-		wallet: wallet,
+		OpenKey: openKey,
+		keys:    make(map[string]Signer),
+		nonces:  make(map[string]uint64),
 	}
 }
 
-// BatchSignResult represents the result of a batch signing operation
-type BatchSignResult struct {
-	TransactionID string `json:"transactionId"`
-	Signature     []byte `json:"signature"`
-	Error         string `json:"error,omitempty"`
+// ParseBatch parses a JSON array of batch entries
+func ParseBatch(data []byte) ([]*BatchEntry, error) {
+	var entries []*BatchEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse batch: %v", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("batch contains no transactions")
+	}
+	return entries, nil
 }
 
-// SignBatch signs multiple transactions in parallel
-func (bs *BatchSigner) SignBatch(transactions []*Transaction) []BatchSignResult {
-	var wg sync.WaitGroup
-	results := make([]BatchSignResult, len(transactions))
+// SignBatch signs every entry, using defaultKey and defaultChain for entries
+// that name none. Errors are reported per entry without aborting the batch.
+func (bs *BatchSigner) SignBatch(entries []*BatchEntry, defaultKey, defaultChain string) []BatchSignResult {
+	results := make([]BatchSignResult, len(entries))
+	for i, entry := range entries {
+		result := BatchSignResult{
+			Index: i,
+			Key:   firstNonEmpty(entry.Key, defaultKey),
+			Chain: firstNonEmpty(entry.Chain, defaultChain),
+		}
+		if err := bs.sign(entry, &result); err != nil {
+			result.Error = err.Error()
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// preparedEntry is a checked batch entry waiting for its signature
+type preparedEntry struct {
+	entry       *BatchEntry
+	result      *BatchSignResult
+	transaction Transaction
+	signer      Signer
+	chain       *ChainConfig
+	rawTx       string
+	err         error
+}
+
+// sign signs one entry and fills in its result
+func (bs *BatchSigner) sign(entry *BatchEntry, result *BatchSignResult) error {
+	p, err := bs.prepare(entry, result)
+	if err != nil {
+		return err
+	}
+	rawTx, err := p.signer.SignTx(&p.transaction)
+	if err != nil {
+		return err
+	}
+
+	// Only a signed transaction uses up its nonce
+	bs.nonces[nonceKey(p.chain.ChainID, p.signer.Address())] = p.transaction.Nonce + 1
+	return bs.finish(p, rawTx)
+}
+
+// prepare assigns the nonce of an entry and checks its final transaction
+func (bs *BatchSigner) prepare(entry *BatchEntry, result *BatchSignResult) (*preparedEntry, error) {
+	if result.Key == "" {
+		return nil, errors.New("no key given for the entry and no default key")
+	}
+	chain, err := GetChainConfig(result.Chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain config: %v", err)
+	}
+
+	signer, err := bs.key(result.Key)
+	if err != nil {
+		return nil, err
+	}
+	from := signer.Address()
+	result.From = from.Hex()
+
+	// Assign the next nonce of the sender on this chain
+	nonce, err := bs.nextNonce(chain, from, entry.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	result.Nonce = &nonce
 
-	// Create a channel to collect results
-	resultChan := make(chan struct {
-		index  int
-		result BatchSignResult
-	}, len(transactions))
+	transaction := entry.Transaction
+	transaction.Nonce = nonce
+	transaction.ChainID = chain.ChainID
+	if err := transaction.Validate(); err != nil {
+		return nil, err
+	}
+	if transaction.FeeCap() == nil {
+		return nil, errors.New("transaction has no gas price or maxFeePerGas")
+	}
 
-	// Sign each transaction in a goroutine
-	for i, tx := range transactions {
+	if bs.Check != nil {
+		if err := bs.Check(entry, &transaction, signer); err != nil {
+			return nil, err
+		}
+	}
+	return &preparedEntry{entry: entry, result: result, transaction: transaction, signer: signer, chain: chain}, nil
+}
+
+// finish fills in the result of a signed entry
+func (bs *BatchSigner) finish(p *preparedEntry, rawTx string) error {
+	from := p.signer.Address()
+	hash := TransactionHash(rawTx)
+	p.result.Hash = &hash
+	p.result.RawTransaction = rawTx
+	if p.transaction.IsContractCreation() {
+		p.result.Contract = p.transaction.ContractAddress(from).Hex()
+	}
+
+	if bs.Signed != nil {
+		if err := bs.Signed(p.entry, &p.transaction, from, rawTx); err != nil {
+			return fmt.Errorf("signed but %v", err)
+		}
+	}
+	return nil
+}
+
+// SignBatchOnDevices signs a batch on several hardware wallets in parallel,
+// each device asking for the confirmation of its own entries. Entries are
+// checked and get their nonces in order first; each is then signed by one of
+// the devices holding its sender, spreading the entries of a sender over the
+// devices holding the same account. If a device fails to sign an entry, the
+// later nonces of its sender on that chain are discarded as well, so the
+// signed transactions never leave a gap.
+func (bs *BatchSigner) SignBatchOnDevices(entries []*BatchEntry, defaultKey, defaultChain string, devices []BatchDevice) []BatchSignResult {
+	results := make([]BatchSignResult, len(entries))
+	queues := make([][]*preparedEntry, len(devices))
+	var prepared []*preparedEntry
+	for i, entry := range entries {
+		results[i] = BatchSignResult{
+			Index: i,
+			Key:   firstNonEmpty(entry.Key, defaultKey),
+			Chain: firstNonEmpty(entry.Chain, defaultChain),
+		}
+		p, err := bs.prepare(entry, &results[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		// Give the entry to the least busy device holding its sender
+		from := p.signer.Address()
+		device := -1
+		for d := range devices {
+			if devices[d].Signer.Address() == from && (device < 0 || len(queues[d]) < len(queues[device])) {
+				device = d
+			}
+		}
+		if device < 0 {
+			results[i].Error = fmt.Sprintf("no device holds %s", from.Hex())
+			continue
+		}
+		results[i].Device = devices[device].Name
+		queues[device] = append(queues[device], p)
+		prepared = append(prepared, p)
+		bs.nonces[nonceKey(p.chain.ChainID, from)] = p.transaction.Nonce + 1
+	}
+
+	// Each device signs its queue in order
+	var wg sync.WaitGroup
+	for d := range devices {
 		wg.Add(1)
-		go func(index int, transaction *Transaction) {
+		go func(signer Signer, queue []*preparedEntry) {
 			defer wg.Done()
-
-			result := BatchSignResult{
-				TransactionID: fmt.Sprintf("tx_%d", index),
+			for _, p := range queue {
+				p.rawTx, p.err = signer.SignTx(&p.transaction)
 			}
+		}(devices[d].Signer, queues[d])
+	}
+	wg.Wait()
 
-			// Sign the transaction
-			signature, err := bs.wallet.SignTransaction(transaction)
-			if err != nil {
-				result.Error = err.Error()
-			} else {
-				result.Signature = signature
+	// The first unsigned nonce of each sequence invalidates the later ones
+	gaps := make(map[string]uint64)
+	for _, p := range prepared {
+		key := nonceKey(p.chain.ChainID, p.signer.Address())
+		if gap, ok := gaps[key]; p.err != nil && (!ok || p.transaction.Nonce < gap) {
+			gaps[key] = p.transaction.Nonce
+		}
+	}
+	for _, p := range prepared {
+		key := nonceKey(p.chain.ChainID, p.signer.Address())
+		switch gap, ok := gaps[key]; {
+		case p.err != nil:
+			p.result.Error = p.err.Error()
+		case ok && p.transaction.Nonce > gap:
+			p.result.Error = fmt.Sprintf("discarded after nonce %d of %s failed", gap, p.result.From)
+		default:
+			if err := bs.finish(p, p.rawTx); err != nil {
+				p.result.Error = err.Error()
 			}
+		}
+	}
+	return results
+}
 
-			resultChan <- struct {
-				index  int
-				result BatchSignResult
-			}{index, result}
-		}(i, tx)
+// key opens a named key once per batch
+func (bs *BatchSigner) key(name string) (Signer, error) {
+	if signer, ok := bs.keys[name]; ok {
+		return signer, nil
 	}
+	signer, err := bs.OpenKey(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key %s: %v", name, err)
+	}
+	bs.keys[name] = signer
+	return signer, nil
+}
 
-	// Close the channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+// nextNonce returns the nonce of a sender's next entry
+func (bs *BatchSigner) nextNonce(chain *ChainConfig, from common.Address, explicit *uint64) (uint64, error) {
+	if explicit != nil {
+		return *explicit, nil
+	}
 
-	// Collect results
-	for result := range resultChan {
-		results[result.index] = result.result
+	key := nonceKey(chain.ChainID, from)
+	if nonce, ok := bs.nonces[key]; ok {
+		return nonce, nil
 	}
+	if bs.NonceAt == nil {
+		return 0, fmt.Errorf("no nonce for the first transaction of %s on %s; set one in the entry", from.Hex(), chain.Name)
+	}
+	nonce, err := bs.NonceAt(chain, from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get nonce of %s: %v", from.Hex(), err)
+	}
+	return nonce, nil
+}
 
-	return results
+// nonceKey identifies the nonce sequence of a sender on a chain
+func nonceKey(chainID *big.Int, from common.Address) string {
+	return chainID.String() + ":" + from.Hex()
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
 
 // BatchSignResultToJSON converts a batch sign result to JSON
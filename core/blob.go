@@ -0,0 +1,236 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+const (
+	// BlobSize is the size of an EIP-4844 blob
+	BlobSize = len(kzg4844.Blob{})
+	// MaxBlobsPerTransaction is the most blobs a block, and so a transaction, can carry
+	MaxBlobsPerTransaction = params.MaxBlobGasPerBlock / params.BlobTxBlobGasPerBlob
+
+	// blobFieldElements is the number of 32-byte field elements in a blob
+	blobFieldElements = BlobSize / 32
+	// BlobDataCapacity is the data a blob holds with EncodeBlobData, which
+	// leaves the top byte of every field element zero
+	BlobDataCapacity = blobFieldElements * 31
+)
+
+// BlobSidecar carries the blobs of a blob transaction with their KZG
+// commitments and proofs. Only the versioned hashes of the commitments are
+// signed; the sidecar is sent along with the transaction to the mempool.
+type BlobSidecar struct {
+	Blobs       []hexutil.Bytes
+	Commitments []hexutil.Bytes
+	Proofs      []hexutil.Bytes
+}
+
+// NewBlobSidecar computes the commitments and proofs of blobs. Blobs shorter
+// than BlobSize are padded with zeros.
+func NewBlobSidecar(blobs [][]byte) (*BlobSidecar, error) {
+	if len(blobs) == 0 {
+		return nil, errors.New("no blobs given")
+	}
+	if len(blobs) > MaxBlobsPerTransaction {
+		return nil, fmt.Errorf("too many blobs: %d > %d", len(blobs), MaxBlobsPerTransaction)
+	}
+
+	sidecar := &BlobSidecar{}
+	for i, data := range blobs {
+		if len(data) > BlobSize {
+			return nil, fmt.Errorf("blob %d is %d bytes, more than %d", i, len(data), BlobSize)
+		}
+		var blob kzg4844.Blob
+		copy(blob[:], data)
+
+		commitment, err := kzg4844.BlobToCommitment(blob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to commit to blob %d: %v", i, err)
+		}
+		proof, err := kzg4844.ComputeBlobProof(blob, commitment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute proof of blob %d: %v", i, err)
+		}
+		sidecar.Blobs = append(sidecar.Blobs, blob[:])
+		sidecar.Commitments = append(sidecar.Commitments, commitment[:])
+		sidecar.Proofs = append(sidecar.Proofs, proof[:])
+	}
+	return sidecar, nil
+}
+
+// EncodeBlobData packs arbitrary data into blobs, 31 bytes to each field
+// element with a zero top byte so that every element is below the BLS
+// modulus. The last blob is padded with zeros.
+func EncodeBlobData(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("no blob data given")
+	}
+	var blobs [][]byte
+	for len(data) > 0 {
+		blob := make([]byte, BlobSize)
+		for element := 0; element < blobFieldElements && len(data) > 0; element++ {
+			n := copy(blob[element*32+1:element*32+32], data)
+			data = data[n:]
+		}
+		blobs = append(blobs, blob)
+	}
+	if len(blobs) > MaxBlobsPerTransaction {
+		return nil, fmt.Errorf("blob data needs %d blobs, more than %d", len(blobs), MaxBlobsPerTransaction)
+	}
+	return blobs, nil
+}
+
+// Hashes returns the versioned hashes of the sidecar's commitments
+func (s *BlobSidecar) Hashes() []common.Hash {
+	return s.toEthereum().BlobHashes()
+}
+
+// Verify checks the proofs of the sidecar and that its commitments match
+// the versioned hashes of a transaction
+func (s *BlobSidecar) Verify(hashes []common.Hash) error {
+	if len(s.Blobs) != len(s.Commitments) || len(s.Blobs) != len(s.Proofs) {
+		return fmt.Errorf("blob sidecar has %d blobs, %d commitments and %d proofs", len(s.Blobs), len(s.Commitments), len(s.Proofs))
+	}
+	if len(s.Blobs) != len(hashes) {
+		return fmt.Errorf("blob sidecar has %d blobs for %d blob hashes", len(s.Blobs), len(hashes))
+	}
+	for i := range s.Blobs {
+		if len(s.Blobs[i]) != BlobSize || len(s.Commitments[i]) != len(kzg4844.Commitment{}) || len(s.Proofs[i]) != len(kzg4844.Proof{}) {
+			return fmt.Errorf("blob %d of the sidecar has the wrong size", i)
+		}
+	}
+
+	sidecar := s.toEthereum()
+	for i, hash := range sidecar.BlobHashes() {
+		if hash != hashes[i] {
+			return fmt.Errorf("blob %d does not match blob hash %s", i, hashes[i].Hex())
+		}
+		if err := kzg4844.VerifyBlobProof(sidecar.Blobs[i], sidecar.Commitments[i], sidecar.Proofs[i]); err != nil {
+			return fmt.Errorf("invalid proof of blob %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// toEthereum converts the sidecar to the go-ethereum sidecar, padding or
+// cutting parts of the wrong size that Verify refuses
+func (s *BlobSidecar) toEthereum() *types.BlobTxSidecar {
+	sidecar := &types.BlobTxSidecar{
+		Blobs:       make([]kzg4844.Blob, len(s.Blobs)),
+		Commitments: make([]kzg4844.Commitment, len(s.Commitments)),
+		Proofs:      make([]kzg4844.Proof, len(s.Proofs)),
+	}
+	for i := range s.Blobs {
+		copy(sidecar.Blobs[i][:], s.Blobs[i])
+	}
+	for i := range s.Commitments {
+		copy(sidecar.Commitments[i][:], s.Commitments[i])
+	}
+	for i := range s.Proofs {
+		copy(sidecar.Proofs[i][:], s.Proofs[i])
+	}
+	return sidecar
+}
+
+// IsBlob reports whether the transaction is an EIP-4844 blob transaction
+func (tx *Transaction) IsBlob() bool {
+	return len(tx.BlobHashes) > 0
+}
+
+// IsContractCreation reports whether the transaction deploys a contract
+func (tx *Transaction) IsContractCreation() bool {
+	return tx.To == nil
+}
+
+// ContractAddress returns the address of the contract a deployment from an
+// address creates
+func (tx *Transaction) ContractAddress(from common.Address) common.Address {
+	return crypto.CreateAddress(from, tx.Nonce)
+}
+
+// Validate checks the parts of a transaction that decide its type: a
+// deployment needs init code and a blob transaction needs a recipient,
+// EIP-1559 fees, a blob fee and, if it carries one, a matching sidecar
+func (tx *Transaction) Validate() error {
+	if tx.IsContractCreation() && len(tx.Data) == 0 {
+		return errors.New("transaction has no recipient and no init code to deploy")
+	}
+	if !tx.IsBlob() {
+		if tx.MaxFeePerBlobGas != nil || tx.Sidecar != nil {
+			return errors.New("transaction has blob fields but no blob hashes")
+		}
+		return nil
+	}
+
+	if tx.IsContractCreation() {
+		return errors.New("blob transactions cannot deploy contracts")
+	}
+	if !tx.IsDynamicFee() {
+		return errors.New("blob transactions need maxFeePerGas")
+	}
+	if tx.ChainID == nil {
+		return errors.New("blob transaction has no chain ID")
+	}
+	if tx.MaxFeePerBlobGas == nil {
+		return errors.New("blob transaction has no maxFeePerBlobGas")
+	}
+	if len(tx.BlobHashes) > MaxBlobsPerTransaction {
+		return fmt.Errorf("too many blob hashes: %d > %d", len(tx.BlobHashes), MaxBlobsPerTransaction)
+	}
+	for _, value := range []*big.Int{tx.ChainID, tx.Value, tx.MaxFeePerGas, tx.MaxPriorityFeePerGas, tx.MaxFeePerBlobGas} {
+		if value != nil && (value.Sign() < 0 || value.BitLen() > 256) {
+			return fmt.Errorf("blob transaction value %s is out of range", value)
+		}
+	}
+	if tx.Sidecar != nil {
+		if err := tx.Sidecar.Verify(tx.BlobHashes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobTx builds the go-ethereum blob transaction. Missing and out of range
+// fields, which Validate refuses before signing, become zero.
+func (tx *Transaction) blobTx() *types.Transaction {
+	var to common.Address
+	if tx.To != nil {
+		to = *tx.To
+	}
+	blobTx := &types.BlobTx{
+		ChainID:    toUint256(tx.ChainID),
+		Nonce:      tx.Nonce,
+		GasTipCap:  toUint256(tx.MaxPriorityFeePerGas),
+		GasFeeCap:  toUint256(tx.MaxFeePerGas),
+		Gas:        tx.GasLimit,
+		To:         to,
+		Value:      toUint256(tx.Value),
+		Data:       tx.Data,
+		BlobFeeCap: toUint256(tx.MaxFeePerBlobGas),
+		BlobHashes: tx.BlobHashes,
+	}
+	if tx.Sidecar != nil {
+		blobTx.Sidecar = tx.Sidecar.toEthereum()
+	}
+	return types.NewTx(blobTx)
+}
+
+// toUint256 converts an optional amount to a uint256
+func toUint256(value *big.Int) *uint256.Int {
+	if value == nil || value.Sign() < 0 {
+		return new(uint256.Int)
+	}
+	converted, _ := uint256.FromBig(value)
+	return converted
+}
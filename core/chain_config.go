@@ -5,27 +5,149 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-// ChainConfig represents the configuration for an EVM-compatible chain
+// ChainConfig represents the configuration for an EVM-compatible chain.
+// FallbackRPCs are tried in order when RPCURL does not answer.
 type ChainConfig struct {
-	Name      string   `json:"name"`
-	ChainID   *big.Int `json:"chainId"`
-	RPCURL    string   `json:"rpcUrl"`
-	Symbol    string   `json:"symbol"`
-	Explorer  string   `json:"explorer"`
-	IsTestnet bool     `json:"isTestnet"`
+	Name         string   `json:"name"`
+	ChainID      *big.Int `json:"chainId"`
+	RPCURL       string   `json:"rpcUrl"`
+	FallbackRPCs []string `json:"fallbackRpcUrls,omitempty"`
+	Symbol       string   `json:"symbol"`
+	Explorer     string   `json:"explorer"`
+	IsTestnet    bool     `json:"isTestnet"`
+	Proxy        string   `json:"proxy,omitempty"`
+	PinnedKeys   []string `json:"pinnedKeys,omitempty"`
+	Tokens       []string `json:"tokens,omitempty"`
+
+	// Extends names a chain whose configuration this one inherits
+	Extends string `json:"extends,omitempty"`
+
+	// Capabilities; unset fields describe a standard EIP-1559 chain that pays
+	// gas in its native currency with 18 decimals
+	Supports1559     *bool   `json:"supports1559,omitempty"`
+	SupportsBlobs    bool    `json:"supportsBlobs,omitempty"`
+	LegacyOnly       bool    `json:"legacyOnly,omitempty"`
+	GasToken         string  `json:"gasToken,omitempty"`
+	GasTokenDecimals *uint8  `json:"gasTokenDecimals,omitempty"`
+	BlockTime        float64 `json:"blockTime,omitempty"` // seconds
+
+	// ENSRegistry is the address of the chain's ENS registry, if it has one
+	ENSRegistry string `json:"ensRegistry,omitempty"`
+
+	// L1Fees names the fee model of rollups that also charge for posting
+	// transactions to L1 (L1FeesOPStack or L1FeesArbitrum)
+	L1Fees string `json:"l1Fees,omitempty"`
+	// PriceID is the CoinGecko ID of the gas token, and USDFeed the address
+	// of a Chainlink feed on the chain that prices it in USD
+	PriceID string `json:"priceId,omitempty"`
+	USDFeed string `json:"usdFeed,omitempty"`
+}
+
+// L1 fee models of rollups
+const (
+	// L1FeesOPStack chains charge an L1 data fee on top of the L2 gas
+	L1FeesOPStack = "op-stack"
+	// L1FeesArbitrum chains charge for L1 data in L2 gas
+	L1FeesArbitrum = "arbitrum"
+)
+
+// EnvEnvironment selects the environment overlay when --env is not given
+const EnvEnvironment = "GOSIGNERVAULT_ENV"
+
+var (
+	// UserChainsFile holds the chains added or changed with the 'chains' commands
+	UserChainsFile = filepath.Join(paths.ConfigDir(), "chains.json")
+	// EnvironmentsDir holds one directory of overlays per environment
+	EnvironmentsDir = filepath.Join(paths.ConfigDir(), "environments")
+	// Environment is the environment whose overlays are merged over the chains
+	Environment string
+)
+
+// environmentPattern restricts environment names to safe directory names
+var environmentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// EnvironmentDir returns the overlay directory of an environment
+func EnvironmentDir(env string) string {
+	return filepath.Join(EnvironmentsDir, env)
+}
+
+// SetEnvironment selects the environment overlay; an empty name selects none
+func SetEnvironment(env string) error {
+	if env == "" {
+		Environment = ""
+		return nil
+	}
+	if !environmentPattern.MatchString(env) {
+		return fmt.Errorf("invalid environment name %q (lowercase letters, digits, - and _)", env)
+	}
+	if _, err := os.Stat(EnvironmentDir(env)); err != nil {
+		return fmt.Errorf("environment %s has no overlay directory %s", env, EnvironmentDir(env))
+	}
+	Environment = env
+	return nil
+}
+
+// Endpoints returns the RPC URL of the chain followed by its fallbacks
+func (c *ChainConfig) Endpoints() []string {
+	return append([]string{c.RPCURL}, c.FallbackRPCs...)
+}
+
+// DynamicFees reports whether the chain accepts EIP-1559 fees. Legacy-only
+// chains accept no typed transactions at all.
+func (c *ChainConfig) DynamicFees() bool {
+	return !c.LegacyOnly && (c.Supports1559 == nil || *c.Supports1559)
+}
+
+// GasTokenInfo returns the symbol and decimals of the native currency that
+// pays for gas and is sent as transaction value
+func (c *ChainConfig) GasTokenInfo() (string, uint8) {
+	symbol, decimals := c.Symbol, uint8(18)
+	if c.GasToken != "" {
+		symbol = c.GasToken
+	}
+	if c.GasTokenDecimals != nil {
+		decimals = *c.GasTokenDecimals
+	}
+	return symbol, decimals
+}
+
+// BlockInterval returns the average block time, or zero if it is not configured
+func (c *ChainConfig) BlockInterval() time.Duration {
+	return time.Duration(c.BlockTime * float64(time.Second))
+}
+
+// ENS returns the address of the chain's ENS registry
+func (c *ChainConfig) ENS() (common.Address, bool) {
+	if !common.IsHexAddress(c.ENSRegistry) {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(c.ENSRegistry), true
 }
 
 // DefaultChains contains predefined chain configurations
 var DefaultChains = map[string]*ChainConfig{
 	"ethereum": {
-		Name:      "Ethereum Mainnet",
-		ChainID:   big.NewInt(1),
-		RPCURL:    "https://mainnet.infura.io/v3/YOUR-PROJECT-ID",
-		Symbol:    "ETH",
-		Explorer:  "https://etherscan.io",
-		IsTestnet: false,
+		Name:          "Ethereum Mainnet",
+		ChainID:       big.NewInt(1),
+		RPCURL:        "https://mainnet.infura.io/v3/YOUR-PROJECT-ID",
+		FallbackRPCs:  []string{"https://ethereum-rpc.publicnode.com"},
+		Symbol:        "ETH",
+		Explorer:      "https://etherscan.io",
+		IsTestnet:     false,
+		SupportsBlobs: true,
+		BlockTime:     12,
+		ENSRegistry:   DefaultENSRegistry,
+		USDFeed:       "0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419",
 	},
 	"polygon": {
 		Name:      "Polygon Mainnet",
@@ -34,14 +156,17 @@ var DefaultChains = map[string]*ChainConfig{
 		Symbol:    "MATIC",
 		Explorer:  "https://polygonscan.com",
 		IsTestnet: false,
+		BlockTime: 2,
 	},
 	"bsc": {
-		Name:      "BNB Smart Chain",
-		ChainID:   big.NewInt(56),
-		RPCURL:    "https://bsc-dataseed.binance.org",
-		Symbol:    "BNB",
-		Explorer:  "https://bscscan.com",
-		IsTestnet: false,
+		Name:         "BNB Smart Chain",
+		ChainID:      big.NewInt(56),
+		RPCURL:       "https://bsc-dataseed.binance.org",
+		Symbol:       "BNB",
+		Explorer:     "https://bscscan.com",
+		IsTestnet:    false,
+		Supports1559: boolPtr(false),
+		BlockTime:    3,
 	},
 	"avalanche": {
 		Name:      "Avalanche C-Chain",
@@ -50,7 +175,117 @@ var DefaultChains = map[string]*ChainConfig{
 		Symbol:    "AVAX",
 		Explorer:  "https://snowtrace.io",
 		IsTestnet: false,
+		BlockTime: 2,
+	},
+	"arbitrum": {
+		Name:         "Arbitrum One",
+		ChainID:      big.NewInt(42161),
+		RPCURL:       "https://arb1.arbitrum.io/rpc",
+		FallbackRPCs: []string{"https://arbitrum-one-rpc.publicnode.com"},
+		Symbol:       "ETH",
+		Explorer:     "https://arbiscan.io",
+		IsTestnet:    false,
+		BlockTime:    0.25,
+		L1Fees:       L1FeesArbitrum,
+	},
+	"optimism": {
+		Name:         "OP Mainnet",
+		ChainID:      big.NewInt(10),
+		RPCURL:       "https://mainnet.optimism.io",
+		FallbackRPCs: []string{"https://optimism-rpc.publicnode.com"},
+		Symbol:       "ETH",
+		Explorer:     "https://optimistic.etherscan.io",
+		IsTestnet:    false,
+		BlockTime:    2,
+		L1Fees:       L1FeesOPStack,
+	},
+	"base": {
+		Name:         "Base",
+		ChainID:      big.NewInt(8453),
+		RPCURL:       "https://mainnet.base.org",
+		FallbackRPCs: []string{"https://base-rpc.publicnode.com"},
+		Symbol:       "ETH",
+		Explorer:     "https://basescan.org",
+		IsTestnet:    false,
+		BlockTime:    2,
+		L1Fees:       L1FeesOPStack,
+	},
+	"gnosis": {
+		Name:      "Gnosis Chain",
+		ChainID:   big.NewInt(100),
+		RPCURL:    "https://rpc.gnosischain.com",
+		Symbol:    "xDAI",
+		Explorer:  "https://gnosisscan.io",
+		IsTestnet: false,
+		BlockTime: 5,
+	},
+	"sepolia": {
+		Name:          "Sepolia",
+		ChainID:       big.NewInt(11155111),
+		RPCURL:        "https://rpc.sepolia.org",
+		FallbackRPCs:  []string{"https://ethereum-sepolia-rpc.publicnode.com"},
+		Symbol:        "ETH",
+		Explorer:      "https://sepolia.etherscan.io",
+		IsTestnet:     true,
+		SupportsBlobs: true,
+		BlockTime:     12,
+		ENSRegistry:   DefaultENSRegistry,
+	},
+	"holesky": {
+		Name:          "Holesky",
+		ChainID:       big.NewInt(17000),
+		RPCURL:        "https://ethereum-holesky-rpc.publicnode.com",
+		Symbol:        "ETH",
+		Explorer:      "https://holesky.etherscan.io",
+		IsTestnet:     true,
+		SupportsBlobs: true,
+		BlockTime:     12,
+		ENSRegistry:   DefaultENSRegistry,
+	},
+	"arbitrum-sepolia": {
+		Name:      "Arbitrum Sepolia",
+		ChainID:   big.NewInt(421614),
+		RPCURL:    "https://sepolia-rollup.arbitrum.io/rpc",
+		Symbol:    "ETH",
+		Explorer:  "https://sepolia.arbiscan.io",
+		IsTestnet: true,
+		BlockTime: 0.25,
+		L1Fees:    L1FeesArbitrum,
 	},
+	"optimism-sepolia": {
+		Name:      "OP Sepolia",
+		ChainID:   big.NewInt(11155420),
+		RPCURL:    "https://sepolia.optimism.io",
+		Symbol:    "ETH",
+		Explorer:  "https://sepolia-optimism.etherscan.io",
+		IsTestnet: true,
+		BlockTime: 2,
+		L1Fees:    L1FeesOPStack,
+	},
+	"base-sepolia": {
+		Name:      "Base Sepolia",
+		ChainID:   big.NewInt(84532),
+		RPCURL:    "https://sepolia.base.org",
+		Symbol:    "ETH",
+		Explorer:  "https://sepolia.basescan.org",
+		IsTestnet: true,
+		BlockTime: 2,
+		L1Fees:    L1FeesOPStack,
+	},
+	"polygon-amoy": {
+		Name:      "Polygon Amoy",
+		ChainID:   big.NewInt(80002),
+		RPCURL:    "https://rpc-amoy.polygon.technology",
+		Symbol:    "POL",
+		Explorer:  "https://amoy.polygonscan.com",
+		IsTestnet: true,
+		BlockTime: 2,
+	},
+}
+
+// boolPtr returns a pointer to a bool for optional capability flags
+func boolPtr(value bool) *bool {
+	return &value
 }
 
 // LoadChainConfig loads chain configurations from a JSON file
@@ -75,6 +310,9 @@ func SaveChainConfig(path string, configs map[string]*ChainConfig) error {
 		return fmt.Errorf("failed to marshal chain configs: %v", err)
 	}
 
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write chain config file: %v", err)
 	}
@@ -82,9 +320,235 @@ func SaveChainConfig(path string, configs map[string]*ChainConfig) error {
 	return nil
 }
 
+// LoadUserChains loads the chains in UserChainsFile. A missing file has none.
+func LoadUserChains() (map[string]*ChainConfig, error) {
+	if _, err := os.Stat(UserChainsFile); os.IsNotExist(err) {
+		return make(map[string]*ChainConfig), nil
+	}
+	configs, err := LoadChainConfig(UserChainsFile)
+	if err != nil {
+		return nil, err
+	}
+	if configs == nil {
+		configs = make(map[string]*ChainConfig)
+	}
+	return configs, nil
+}
+
+// ChainLayer is one source of chain configurations, in merge order
+type ChainLayer struct {
+	Source string
+	Chains map[string]*ChainConfig
+}
+
+// ChainLayers returns the built-in chains, the user's chains and the overlay
+// of the selected environment, in the order they are merged
+func ChainLayers() ([]ChainLayer, error) {
+	user, err := LoadUserChains()
+	if err != nil {
+		return nil, err
+	}
+	layers := []ChainLayer{
+		{Source: "built-in", Chains: DefaultChains},
+		{Source: UserChainsFile, Chains: user},
+	}
+
+	if Environment != "" {
+		path := filepath.Join(EnvironmentDir(Environment), "chains.json")
+		if _, err := os.Stat(path); err == nil {
+			overlay, err := LoadChainConfig(path)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, ChainLayer{Source: path, Chains: overlay})
+		}
+	}
+	return layers, nil
+}
+
+// Chains returns the effective chains: every layer merged over the previous
+// ones, then each chain merged over the chain it extends. An entry for a known
+// chain only replaces the fields it sets.
+func Chains() (map[string]*ChainConfig, error) {
+	chains, _, err := resolveChains()
+	return chains, err
+}
+
+// ChainSources returns the sources that contributed to a chain, in merge order
+func ChainSources(name string) ([]string, error) {
+	chains, sources, err := resolveChains()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := chains[name]; !ok {
+		return nil, fmt.Errorf("chain %s not found", name)
+	}
+	return sources[name], nil
+}
+
+// resolveChains merges the chain layers and resolves inheritance, recording
+// the sources of every chain
+func resolveChains() (map[string]*ChainConfig, map[string][]string, error) {
+	layers, err := ChainLayers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := make(map[string]*ChainConfig)
+	sources := make(map[string][]string)
+	for _, layer := range layers {
+		for name, chain := range layer.Chains {
+			if base, ok := merged[name]; ok {
+				chain = mergeChain(base, chain)
+			}
+			merged[name] = chain
+			sources[name] = append(sources[name], layer.Source)
+		}
+	}
+
+	chains := make(map[string]*ChainConfig, len(merged))
+	var resolve func(name string, visiting map[string]bool) (*ChainConfig, error)
+	resolve = func(name string, visiting map[string]bool) (*ChainConfig, error) {
+		if chain, ok := chains[name]; ok {
+			return chain, nil
+		}
+		chain, ok := merged[name]
+		if !ok {
+			return nil, fmt.Errorf("chain %s not found", name)
+		}
+		if chain.Extends != "" {
+			if visiting[name] {
+				return nil, fmt.Errorf("chain %s extends itself through %s", name, chain.Extends)
+			}
+			visiting[name] = true
+			parent, err := resolve(chain.Extends, visiting)
+			if err != nil {
+				return nil, fmt.Errorf("chain %s extends %s: %v", name, chain.Extends, err)
+			}
+			chain = mergeChain(parent, chain)
+			sources[name] = append([]string{"extends " + chain.Extends}, sources[name]...)
+		}
+		if chain.ChainID == nil || chain.RPCURL == "" {
+			return nil, fmt.Errorf("chain %s needs a chainId and an rpcUrl", name)
+		}
+		chain = expandEndpoints(chain)
+		chains[name] = chain
+		return chain, nil
+	}
+	for name := range merged {
+		if _, err := resolve(name, make(map[string]bool)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return chains, sources, nil
+}
+
+// ChainNames returns the names of all chains in order
+func ChainNames() ([]string, error) {
+	chains, err := Chains()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// expandEndpoints resolves the secret references and $VAR environment
+// variables in the RPC URLs of a copy of chain, so API keys can stay out of
+// config files. URLs that fail to resolve are left in place; dialing them
+// reports the failure.
+func expandEndpoints(chain *ChainConfig) *ChainConfig {
+	expand := func(value string) string {
+		expanded, err := secrets.Expand(value)
+		if err != nil {
+			return value
+		}
+		return expanded
+	}
+
+	expanded := *chain
+	expanded.RPCURL = expand(chain.RPCURL)
+	if len(chain.FallbackRPCs) > 0 {
+		expanded.FallbackRPCs = make([]string, len(chain.FallbackRPCs))
+		for i, endpoint := range chain.FallbackRPCs {
+			expanded.FallbackRPCs[i] = expand(endpoint)
+		}
+	}
+	return &expanded
+}
+
+// mergeChain overlays the fields set in override on a copy of base
+func mergeChain(base, override *ChainConfig) *ChainConfig {
+	merged := *base
+	if override.Name != "" {
+		merged.Name = override.Name
+	}
+	if override.ChainID != nil {
+		merged.ChainID = override.ChainID
+	}
+	if override.RPCURL != "" {
+		merged.RPCURL = override.RPCURL
+		merged.FallbackRPCs = override.FallbackRPCs
+	}
+	if override.Symbol != "" {
+		merged.Symbol = override.Symbol
+	}
+	if override.Explorer != "" {
+		merged.Explorer = override.Explorer
+	}
+	merged.IsTestnet = merged.IsTestnet || override.IsTestnet
+	if override.Proxy != "" {
+		merged.Proxy = override.Proxy
+	}
+	if override.PinnedKeys != nil {
+		merged.PinnedKeys = override.PinnedKeys
+	}
+	if override.Tokens != nil {
+		merged.Tokens = override.Tokens
+	}
+	if override.Extends != "" {
+		merged.Extends = override.Extends
+	}
+	if override.Supports1559 != nil {
+		merged.Supports1559 = override.Supports1559
+	}
+	merged.SupportsBlobs = merged.SupportsBlobs || override.SupportsBlobs
+	merged.LegacyOnly = merged.LegacyOnly || override.LegacyOnly
+	if override.GasToken != "" {
+		merged.GasToken = override.GasToken
+	}
+	if override.GasTokenDecimals != nil {
+		merged.GasTokenDecimals = override.GasTokenDecimals
+	}
+	if override.BlockTime != 0 {
+		merged.BlockTime = override.BlockTime
+	}
+	if override.ENSRegistry != "" {
+		merged.ENSRegistry = override.ENSRegistry
+	}
+	if override.L1Fees != "" {
+		merged.L1Fees = override.L1Fees
+	}
+	if override.PriceID != "" {
+		merged.PriceID = override.PriceID
+	}
+	if override.USDFeed != "" {
+		merged.USDFeed = override.USDFeed
+	}
+	return &merged
+}
+
 // GetChainConfig returns a chain configuration by name
 func GetChainConfig(name string) (*ChainConfig, error) {
-	config, ok := DefaultChains[name]
+	chains, err := Chains()
+	if err != nil {
+		return nil, err
+	}
+	config, ok := chains[name]
 	if !ok {
 		return nil, fmt.Errorf("chain %s not found", name)
 	}
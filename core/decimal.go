@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Amounts, fee multipliers and percentages are parsed into exact rationals and
+// only converted to integers through an explicit rounding mode. No value that
+// ends up in a signed transaction ever passes through float64.
+
+// Rounding selects how a decimal is converted to an integer
+type Rounding int
+
+const (
+	// RoundExact rejects values that are not exact integers after scaling
+	RoundExact Rounding = iota
+	// RoundDown rounds toward zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundHalfEven rounds to the nearest integer, ties to even
+	RoundHalfEven
+)
+
+// maxExponent bounds exponents so "1e999999999" cannot exhaust memory
+const maxExponent = 80
+
+// decimalPattern matches plain decimal numbers with an optional exponent
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE]([+-]?\d+))?$`)
+
+// amountUnits are the denominations accepted by ParseAmount, as powers of ten of wei
+var amountUnits = map[string]uint8{
+	"wei":    0,
+	"kwei":   3,
+	"mwei":   6,
+	"gwei":   9,
+	"szabo":  12,
+	"finney": 15,
+	"ether":  18,
+	"eth":    18,
+}
+
+// ParseRounding parses a rounding mode name
+func ParseRounding(name string) (Rounding, error) {
+	switch strings.ToLower(name) {
+	case "exact":
+		return RoundExact, nil
+	case "down":
+		return RoundDown, nil
+	case "up":
+		return RoundUp, nil
+	case "half-even":
+		return RoundHalfEven, nil
+	default:
+		return 0, fmt.Errorf("unknown rounding mode %q (expected exact, down, up or half-even)", name)
+	}
+}
+
+// String returns the name of the rounding mode
+func (r Rounding) String() string {
+	switch r {
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundHalfEven:
+		return "half-even"
+	default:
+		return "exact"
+	}
+}
+
+// ParseDecimal parses a decimal such as "12.5", ".5" or "1.5e3" exactly
+func ParseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	match := decimalPattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	if match[3] != "" {
+		if exp, err := strconv.Atoi(match[3]); err != nil || exp > maxExponent || exp < -maxExponent {
+			return nil, fmt.Errorf("exponent of %q is out of range", s)
+		}
+	}
+
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return value, nil
+}
+
+// RoundRat converts a rational to an integer with the given rounding mode
+func RoundRat(value *big.Rat, mode Rounding) (*big.Int, error) {
+	if value.IsInt() {
+		return new(big.Int).Set(value.Num()), nil
+	}
+
+	// Truncate toward zero, then adjust by the remainder
+	quo, rem := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	away := big.NewInt(int64(value.Sign()))
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		quo.Add(quo, away)
+	case RoundHalfEven:
+		// Compare twice the remainder with the denominator
+		twice := new(big.Int).Abs(rem)
+		twice.Lsh(twice, 1)
+		if cmp := twice.Cmp(value.Denom()); cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+			quo.Add(quo, away)
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a whole number", value.FloatString(18))
+	}
+	return quo, nil
+}
+
+// ToBaseUnits scales a decimal by 10^decimals and rounds it to an integer. It
+// also reports whether the value was exact, so callers can show rounding.
+func ToBaseUnits(value *big.Rat, decimals uint8, mode Rounding) (*big.Int, bool, error) {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(scale))
+
+	result, err := RoundRat(scaled, mode)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s has more than %d decimal places", value.FloatString(int(decimals)+1), decimals)
+	}
+	return result, scaled.IsInt(), nil
+}
+
+// MulDecimal multiplies an integer by a decimal factor, e.g. a fee multiplier
+func MulDecimal(value *big.Int, factor *big.Rat, mode Rounding) (*big.Int, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt(value), factor)
+	return RoundRat(product, mode)
+}
+
+// ParsePercent parses a percentage such as "12.5" or "12.5%" into a fraction (0.125)
+func ParsePercent(s string) (*big.Rat, error) {
+	value, err := ParseDecimal(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid percentage %q", s)
+	}
+	return value.Quo(value, big.NewRat(100, 1)), nil
+}
+
+// ParseAmount parses a non-negative native amount with a unit, e.g. "1.5 ether",
+// "20gwei" or "100 wei". A bare integer is taken as wei; a bare decimal is
+// rejected since its unit would be ambiguous.
+func ParseAmount(s string, mode Rounding) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	number := strings.TrimRightFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' })
+	unit := strings.ToLower(strings.TrimSpace(s[len(number):]))
+	number = strings.TrimSpace(number)
+
+	// A dangling exponent marker as in "1e gwei" is not a number
+	if strings.HasSuffix(number, "e") || strings.HasSuffix(number, "E") {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+
+	decimals, ok := amountUnits[unit]
+	if unit == "" {
+		if strings.ContainsAny(number, ".eE") {
+			return nil, fmt.Errorf("amount %q needs a unit (wei, gwei or ether)", s)
+		}
+		decimals, ok = 0, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q in amount %q", unit, s)
+	}
+
+	value, err := ParseDecimal(number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("amount %q is negative", s)
+	}
+
+	amount, _, err := ToBaseUnits(value, decimals, mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %v", s, err)
+	}
+	return amount, nil
+}
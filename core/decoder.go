@@ -0,0 +1,278 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// CallDecoder decodes contract calldata and event logs using known ABIs and
+// function signatures
+type CallDecoder struct {
+	methods map[[4]byte][]abi.Method
+	events  map[common.Hash][]abi.Event
+}
+
+// DecodedArg is a single decoded function or event argument
+type DecodedArg struct {
+	Name    string
+	Type    string
+	Value   string
+	Indexed bool
+}
+
+// DecodedCall is a decoded contract call
+type DecodedCall struct {
+	Selector  [4]byte
+	Signature string
+	Args      []DecodedArg
+}
+
+// DecodedEvent is a decoded event log
+type DecodedEvent struct {
+	Topic     common.Hash
+	Signature string
+	Args      []DecodedArg
+}
+
+// NewCallDecoder creates a decoder that knows the built-in ERC-20, ERC-721 and Safe
+// functions and events
+func NewCallDecoder() *CallDecoder {
+	d := &CallDecoder{
+		methods: make(map[[4]byte][]abi.Method),
+		events:  make(map[common.Hash][]abi.Event),
+	}
+	d.AddABI(erc20ABI)
+	d.AddABI(erc721ABI)
+	d.AddABI(safeABI)
+	return d
+}
+
+// AddABI registers all functions and events of a contract ABI
+func (d *CallDecoder) AddABI(contractABI abi.ABI) {
+	for _, method := range contractABI.Methods {
+		d.add(method)
+	}
+	for _, event := range contractABI.Events {
+		d.addEvent(event)
+	}
+}
+
+// LoadABIFile registers the functions and events of a JSON ABI file. Both
+// bare ABIs and compiler artifacts with an "abi" field are accepted.
+func (d *CallDecoder) LoadABIFile(path string) error {
+	_, contractABI, err := ReadABIFile(path)
+	if err != nil {
+		return err
+	}
+	d.AddABI(contractABI)
+	return nil
+}
+
+// AddSignature registers a function from its text signature, e.g. "transfer(address,uint256)"
+func (d *CallDecoder) AddSignature(signature string) error {
+	open := strings.Index(signature, "(")
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return fmt.Errorf("invalid function signature %q", signature)
+	}
+	name := signature[:open]
+	params := signature[open+1 : len(signature)-1]
+
+	var inputs abi.Arguments
+	if params != "" {
+		for i, param := range strings.Split(params, ",") {
+			if strings.ContainsAny(param, "()") {
+				return fmt.Errorf("tuple parameters are not supported in signature %q", signature)
+			}
+			typ, err := abi.NewType(param, "", nil)
+			if err != nil {
+				return fmt.Errorf("invalid parameter type %q in signature %q: %v", param, signature, err)
+			}
+			inputs = append(inputs, abi.Argument{Name: fmt.Sprintf("arg%d", i), Type: typ})
+		}
+	}
+
+	d.add(abi.NewMethod(name, name, abi.Function, "nonpayable", false, false, inputs, nil))
+	return nil
+}
+
+// LoadSignatureDatabase registers the signatures of a local 4byte database: a
+// JSON object mapping selectors to one signature or a list of candidates
+func (d *CallDecoder) LoadSignatureDatabase(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read signature database: %v", err)
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse signature database: %v", err)
+	}
+
+	for _, raw := range entries {
+		var signatures []string
+		if err := json.Unmarshal(raw, &signatures); err != nil {
+			var signature string
+			if err := json.Unmarshal(raw, &signature); err != nil {
+				return fmt.Errorf("failed to parse signature database: %v", err)
+			}
+			signatures = []string{signature}
+		}
+		for _, signature := range signatures {
+			// Signatures using unsupported types are simply not decodable
+			_ = d.AddSignature(signature)
+		}
+	}
+	return nil
+}
+
+// HasSelector reports whether any known function matches the selector
+func (d *CallDecoder) HasSelector(selector [4]byte) bool {
+	return len(d.methods[selector]) > 0
+}
+
+// add registers a method under its selector, skipping duplicates
+func (d *CallDecoder) add(method abi.Method) {
+	var selector [4]byte
+	copy(selector[:], method.ID)
+	for _, known := range d.methods[selector] {
+		if known.Sig == method.Sig {
+			return
+		}
+	}
+	d.methods[selector] = append(d.methods[selector], method)
+}
+
+// addEvent registers an event under its topic, skipping duplicates
+func (d *CallDecoder) addEvent(event abi.Event) {
+	if event.Anonymous {
+		return
+	}
+	for _, known := range d.events[event.ID] {
+		if known.Sig == event.Sig && indexedCount(known) == indexedCount(event) {
+			return
+		}
+	}
+	d.events[event.ID] = append(d.events[event.ID], event)
+}
+
+// indexedCount returns the number of indexed inputs of an event
+func indexedCount(event abi.Event) int {
+	count := 0
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			count++
+		}
+	}
+	return count
+}
+
+// Decode decodes calldata. A candidate only matches if its arguments re-encode
+// to exactly the same bytes, which rules out most selector collisions.
+func (d *CallDecoder) Decode(data []byte) (*DecodedCall, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("calldata too short")
+	}
+
+	var selector [4]byte
+	copy(selector[:], data[:4])
+
+	for _, method := range d.methods[selector] {
+		values, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+		packed, err := method.Inputs.Pack(values...)
+		if err != nil || !bytes.Equal(packed, data[4:]) {
+			continue
+		}
+
+		call := &DecodedCall{Selector: selector, Signature: method.Sig}
+		for i, input := range method.Inputs {
+			call.Args = append(call.Args, DecodedArg{
+				Name:  input.Name,
+				Type:  input.Type.String(),
+				Value: formatABIValue(values[i]),
+			})
+		}
+		return call, nil
+	}
+
+	return nil, fmt.Errorf("unknown function selector 0x%x", selector)
+}
+
+// DecodeLog decodes an event log. A candidate only matches if it indexes as
+// many inputs as the log has topics and its data re-encodes to exactly the
+// same bytes. Indexed strings, bytes and arrays are shown as their hash.
+func (d *CallDecoder) DecodeLog(topics []common.Hash, data []byte) (*DecodedEvent, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("anonymous events cannot be decoded")
+	}
+
+	for _, event := range d.events[topics[0]] {
+		if indexedCount(event) != len(topics)-1 {
+			continue
+		}
+		nonIndexed := event.Inputs.NonIndexed()
+		values, err := nonIndexed.Unpack(data)
+		if err != nil {
+			continue
+		}
+		packed, err := nonIndexed.Pack(values...)
+		if err != nil || !bytes.Equal(packed, data) {
+			continue
+		}
+		var indexed abi.Arguments
+		for _, input := range event.Inputs {
+			if input.Indexed {
+				indexed = append(indexed, input)
+			}
+		}
+		indexedValues := make(map[string]interface{})
+		if err := abi.ParseTopicsIntoMap(indexedValues, indexed, topics[1:]); err != nil {
+			continue
+		}
+
+		decoded := &DecodedEvent{Topic: topics[0], Signature: event.Sig}
+		next := 0
+		for _, input := range event.Inputs {
+			arg := DecodedArg{Name: input.Name, Type: input.Type.String(), Indexed: input.Indexed}
+			if input.Indexed {
+				arg.Value = formatABIValue(indexedValues[input.Name])
+			} else {
+				arg.Value = formatABIValue(values[next])
+				next++
+			}
+			decoded.Args = append(decoded.Args, arg)
+		}
+		return decoded, nil
+	}
+
+	return nil, fmt.Errorf("unknown event topic %s", topics[0].Hex())
+}
+
+// formatABIValue formats a decoded ABI value for display
+func formatABIValue(value interface{}) string {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case []byte:
+		return fmt.Sprintf("0x%x", v)
+	case [32]byte:
+		return fmt.Sprintf("0x%x", v)
+	case common.Hash:
+		return v.Hex()
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -17,15 +18,19 @@ type TypedData struct {
 	Message     map[string]interface{}   `json:"message"`
 }
 
-// SignTypedData signs an EIP-712 typed data message
-func (w *Wallet) SignTypedData(data *TypedData) ([]byte, error) {
-	// Convert to Ethereum's internal format
-	typedData := apitypes.TypedData{
+// toAPITypes converts to Ethereum's internal format
+func (data *TypedData) toAPITypes() apitypes.TypedData {
+	return apitypes.TypedData{
 		Types:       data.Types,
 		PrimaryType: data.PrimaryType,
 		Domain:      data.Domain,
 		Message:     data.Message,
 	}
+}
+
+// encode returns the EIP-712 encoding "\x19\x01" || domainSeparator || hashStruct(message)
+func (data *TypedData) encode() ([]byte, error) {
+	typedData := data.toAPITypes()
 
 	// Get the domain separator
 	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
@@ -39,15 +44,113 @@ func (w *Wallet) SignTypedData(data *TypedData) ([]byte, error) {
 		return nil, fmt.Errorf("failed to hash message: %v", err)
 	}
 
+	encoded := append([]byte("\x19\x01"), domainSeparator...)
+	return append(encoded, messageHash...), nil
+}
+
+// Hash returns the EIP-712 signing hash of the typed data
+func (data *TypedData) Hash() (common.Hash, error) {
+	encoded, err := data.encode()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// Validate checks the message against the types: the primary type and the
+// domain type must be declared, every struct must have exactly its declared
+// fields and every value must encode as its type
+func (data *TypedData) Validate() error {
+	if _, ok := data.Types["EIP712Domain"]; !ok {
+		return fmt.Errorf("typed data does not declare EIP712Domain")
+	}
+	if _, ok := data.Types[data.PrimaryType]; !ok {
+		return fmt.Errorf("primary type %q is not declared", data.PrimaryType)
+	}
+	if err := data.checkFields(data.PrimaryType, data.Message, data.PrimaryType); err != nil {
+		return err
+	}
+	_, err := data.Hash()
+	return err
+}
+
+// checkFields compares the fields of a struct value with its type
+func (data *TypedData) checkFields(typeName string, value map[string]interface{}, path string) error {
+	declared := make(map[string]bool)
+	for _, field := range data.Types[typeName] {
+		declared[field.Name] = true
+		fieldValue, ok := value[field.Name]
+		if !ok {
+			return fmt.Errorf("%s.%s (%s) is missing", path, field.Name, field.Type)
+		}
+		if _, isStruct := data.Types[strings.TrimSuffix(field.Type, "[]")]; !isStruct {
+			continue
+		}
+		items := []interface{}{fieldValue}
+		if strings.HasSuffix(field.Type, "[]") {
+			items, ok = fieldValue.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s is not an array of %s", path, field.Name, strings.TrimSuffix(field.Type, "[]"))
+			}
+		}
+		for _, item := range items {
+			nested, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.%s is not a %s", path, field.Name, field.Type)
+			}
+			if err := data.checkFields(strings.TrimSuffix(field.Type, "[]"), nested, path+"."+field.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for name := range value {
+		if !declared[name] {
+			return fmt.Errorf("%s.%s is not a field of %s", path, name, typeName)
+		}
+	}
+	return nil
+}
+
+// Summary returns a human-readable rendering of the domain and message fields
+func (data *TypedData) Summary() (string, error) {
+	typedData := data.toAPITypes()
+	fields, err := typedData.Format()
+	if err != nil {
+		return "", fmt.Errorf("failed to format typed data: %v", err)
+	}
+
+	var sb strings.Builder
+	for _, field := range fields {
+		sb.WriteString(field.Pprint(0))
+	}
+	return sb.String(), nil
+}
+
+// SignTypedData signs an EIP-712 typed data message
+func (w *Wallet) SignTypedData(data *TypedData) ([]byte, error) {
 	// Create the final hash
-	hash := crypto.Keccak256Hash(
-		[]byte("\x19\x01"),
-		domainSeparator,
-		messageHash,
-	)
+	hash, err := data.Hash()
+	if err != nil {
+		return nil, err
+	}
 
 	// Sign the hash
-	signature, err := crypto.Sign(hash.Bytes(), w.privateKey)
+	signature, err := crypto.Sign(hash.Bytes(), w.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign typed data: %v", err)
+	}
+
+	return signature, nil
+}
+
+// SignTypedDataWithSigner signs an EIP-712 typed data message with a HashSigner
+func SignTypedDataWithSigner(data *TypedData, hashSigner HashSigner) ([]byte, error) {
+	hash, err := data.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := hashSigner.SignHash(hash.Bytes())
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign typed data: %v", err)
 	}
@@ -66,33 +169,18 @@ func ParseTypedData(jsonData string) (*TypedData, error) {
 
 // VerifyTypedDataSignature verifies an EIP-712 signature
 func VerifyTypedDataSignature(data *TypedData, signature []byte) (common.Address, error) {
-	// Convert to Ethereum's internal format
-	typedData := apitypes.TypedData{
-		Types:       data.Types,
-		PrimaryType: data.PrimaryType,
-		Domain:      data.Domain,
-		Message:     data.Message,
-	}
-
-	// Get the domain separator
-	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	// Create the final hash
+	hash, err := data.Hash()
 	if err != nil {
-		return common.Address{}, fmt.Errorf("failed to hash domain separator: %v", err)
+		return common.Address{}, err
 	}
 
-	// Get the message hash
-	messageHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
-	if err != nil {
-		return common.Address{}, fmt.Errorf("failed to hash message: %v", err)
+	// Hardware wallets return V as 27/28, crypto.SigToPub expects 0/1
+	if len(signature) == crypto.SignatureLength && signature[crypto.RecoveryIDOffset] >= 27 {
+		signature = append([]byte(nil), signature...)
+		signature[crypto.RecoveryIDOffset] -= 27
 	}
 
-	// Create the final hash
-	hash := crypto.Keccak256Hash(
-		[]byte("\x19\x01"),
-		domainSeparator,
-		messageHash,
-	)
-
 	// Recover the public key
 	pubKey, err := crypto.SigToPub(hash.Bytes(), signature)
 	if err != nil {
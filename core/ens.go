@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultENSRegistry is the ENS registry on Ethereum mainnet and its testnets
+const DefaultENSRegistry = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+
+var (
+	ensResolverSelector = crypto.Keccak256([]byte("resolver(bytes32)"))[:4]
+	ensAddrSelector     = crypto.Keccak256([]byte("addr(bytes32)"))[:4]
+	ensNameSelector     = crypto.Keccak256([]byte("name(bytes32)"))[:4]
+)
+
+// IsENSName reports whether a value is meant as an ENS name rather than an address
+func IsENSName(value string) bool {
+	return !common.IsHexAddress(value) && strings.Contains(value, ".")
+}
+
+// NormalizeENSName lowercases an ENS name and checks its labels. Only ASCII
+// letters, digits, hyphens and underscores are accepted: full UTS-46
+// normalization is not implemented, and other characters invite look-alike
+// names.
+func NormalizeENSName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("invalid ENS name %q", name)
+	}
+	for _, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("invalid ENS name %q: empty label", name)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return "", fmt.Errorf("unsupported ENS name %q: only ASCII letters, digits, - and _ are accepted", name)
+			}
+		}
+	}
+	return name, nil
+}
+
+// ENSNameHash returns the EIP-137 namehash of a normalized name
+func ENSNameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// ENSResolver resolves ENS names through a registry, caching the results.
+// Names are looked up with the registry's resolver and its addr record;
+// wildcard (ENSIP-10) and offchain (CCIP-read) resolvers are not supported.
+type ENSResolver struct {
+	// Block pins lookups to a block; nil reads the latest block
+	Block *big.Int
+
+	caller   ethereum.ContractCaller
+	registry common.Address
+	mu       sync.Mutex
+	forward  map[string]common.Address
+	reverse  map[common.Address]string
+}
+
+// NewENSResolver creates a resolver on the registry at the given address
+func NewENSResolver(caller ethereum.ContractCaller, registry common.Address) *ENSResolver {
+	return &ENSResolver{
+		caller:   caller,
+		registry: registry,
+		forward:  make(map[string]common.Address),
+		reverse:  make(map[common.Address]string),
+	}
+}
+
+// Resolve returns the address an ENS name points to
+func (r *ENSResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	name, err := NormalizeENSName(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	r.mu.Lock()
+	address, ok := r.forward[name]
+	r.mu.Unlock()
+	if ok {
+		return address, nil
+	}
+
+	node := ENSNameHash(name)
+	resolver, err := r.resolver(ctx, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %v", name, err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("ENS name %s is not registered or has no resolver", name)
+	}
+	output, err := r.call(ctx, resolver, ensAddrSelector, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %v", name, err)
+	}
+	address, err = decodeWordAddress(output)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %v", name, err)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("ENS name %s has no address record", name)
+	}
+
+	r.mu.Lock()
+	r.forward[name] = address
+	r.mu.Unlock()
+	return address, nil
+}
+
+// LookupAddress returns the primary ENS name of an address, or "" if it has
+// none. A name is only returned if it resolves back to the address, since
+// anyone can claim any name in their reverse record.
+func (r *ENSResolver) LookupAddress(ctx context.Context, address common.Address) (string, error) {
+	r.mu.Lock()
+	name, ok := r.reverse[address]
+	r.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	node := ENSNameHash(strings.ToLower(address.Hex()[2:]) + ".addr.reverse")
+	resolver, err := r.resolver(ctx, node)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s: %v", address.Hex(), err)
+	}
+	if resolver != (common.Address{}) {
+		output, err := r.call(ctx, resolver, ensNameSelector, node)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up %s: %v", address.Hex(), err)
+		}
+		if name, err = decodeString(output); err != nil {
+			return "", fmt.Errorf("failed to look up %s: %v", address.Hex(), err)
+		}
+	}
+
+	// Keep only names that point back to the address
+	if name != "" {
+		if forward, err := r.Resolve(ctx, name); err != nil || forward != address {
+			name = ""
+		}
+	}
+
+	r.mu.Lock()
+	r.reverse[address] = name
+	r.mu.Unlock()
+	return name, nil
+}
+
+// resolver returns the resolver the registry records for a node
+func (r *ENSResolver) resolver(ctx context.Context, node common.Hash) (common.Address, error) {
+	output, err := r.call(ctx, r.registry, ensResolverSelector, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return decodeWordAddress(output)
+}
+
+// call calls a function taking a single node argument
+func (r *ENSResolver) call(ctx context.Context, contract common.Address, selector []byte, node common.Hash) ([]byte, error) {
+	data := append(append([]byte{}, selector...), node.Bytes()...)
+	return r.caller.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, r.Block)
+}
+
+// decodeWordAddress decodes an address returned as a single ABI word
+func decodeWordAddress(output []byte) (common.Address, error) {
+	// Calls to accounts without code return nothing
+	if len(output) == 0 {
+		return common.Address{}, nil
+	}
+	if len(output) < 32 {
+		return common.Address{}, fmt.Errorf("unexpected result of %d bytes", len(output))
+	}
+	return common.BytesToAddress(output[12:32]), nil
+}
+
+// decodeString decodes a string returned by a contract call
+func decodeString(output []byte) (string, error) {
+	if len(output) == 0 {
+		return "", nil
+	}
+	stringType, err := abi.NewType("string", "", nil)
+	if err != nil {
+		return "", err
+	}
+	values, err := abi.Arguments{{Type: stringType}}.Unpack(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode name: %v", err)
+	}
+	return values[0].(string), nil
+}
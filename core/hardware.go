@@ -3,36 +3,175 @@ package core
 import (
 	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts"
-	"github.com/ethereum/go-ethereum/accounts/ledger"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
 
+// deviceCapabilities are the signatures the go-ethereum USB drivers can ask
+// each kind of device for. Neither driver implements personal messages, and
+// the Trezor driver has no EIP-712 support.
+var deviceCapabilities = map[string][]Capability{
+	"ledger": {CapTransactions, CapTypedData},
+	"trezor": {CapTransactions},
+}
+
+// DeviceCapabilities returns the kinds of signature a kind of hardware wallet
+// ("ledger" or "trezor") makes
+func DeviceCapabilities(kind string) []Capability {
+	return deviceCapabilities[kind]
+}
+
+// DeviceSupports reports whether a kind of hardware wallet makes a kind of signature
+func DeviceSupports(kind string, capability Capability) bool {
+	for _, supported := range deviceCapabilities[kind] {
+		if supported == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// HardwareOptions selects which device and account a HardwareWallet uses
+type HardwareOptions struct {
+	// Kind restricts the devices to "ledger" or "trezor"; empty allows both
+	Kind string
+	// Device is the index of the device as reported by ListHardwareWallets,
+	// counting only devices of Kind if set
+	Device int
+	// Path is the full derivation path of the signing account
+	Path accounts.DerivationPath
+}
+
+// DefaultHardwareOptions returns options for the first account of the first device
+func DefaultHardwareOptions() HardwareOptions {
+	return HardwareOptions{
+		Device: 0,
+		Path:   AccountDerivationPath(0),
+	}
+}
+
+// AccountDerivationPath returns the default BIP-44 path (m/44'/60'/0'/0/index) for an account index
+func AccountDerivationPath(index uint32) accounts.DerivationPath {
+	path := make(accounts.DerivationPath, len(accounts.DefaultBaseDerivationPath))
+	copy(path, accounts.DefaultBaseDerivationPath)
+	path[len(path)-1] = index
+	return path
+}
+
+// DefaultPathTemplate is the account path of MetaMask and most wallets, the
+// x component being the account index
+const DefaultPathTemplate = "m/44'/60'/0'/0/x"
+
+// PathFromTemplate returns the derivation path of a template such as
+// m/44'/60'/x'/0/0 (Ledger Live) or m/44'/60'/0'/x (legacy), with its x
+// component replaced by index. An x' component is hardened.
+func PathFromTemplate(template string, index uint32) (accounts.DerivationPath, error) {
+	components := strings.Split(template, "/")
+	found := 0
+	for i, component := range components {
+		if component == "x" || component == "x'" {
+			components[i] = strings.Replace(component, "x", strconv.FormatUint(uint64(index), 10), 1)
+			found++
+		}
+	}
+	if found != 1 {
+		return nil, fmt.Errorf("path template %q must have exactly one x component for the account index", template)
+	}
+	path, err := accounts.ParseDerivationPath(strings.Join(components, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %v", template, err)
+	}
+	return path, nil
+}
+
+// DerivedAccount is an account of a hardware wallet at a derivation path
+type DerivedAccount struct {
+	Index   uint32                  `json:"index"`
+	Path    accounts.DerivationPath `json:"path"`
+	Address common.Address          `json:"address"`
+}
+
 // HardwareWallet represents a connected hardware wallet device
 type HardwareWallet struct {
 	device accounts.Wallet
 	path   accounts.DerivationPath
 }
 
+// ListHardwareWallets returns all connected Ledger and Trezor devices
+func ListHardwareWallets() ([]accounts.Wallet, error) {
+	var wallets []accounts.Wallet
+	var hubErrs []error
+
+	// Trezor devices show up over HID (older firmware) or WebUSB (newer firmware)
+	hubs := []struct {
+		name string
+		open func() (*usbwallet.Hub, error)
+	}{
+		{"ledger", usbwallet.NewLedgerHub},
+		{"trezor (HID)", usbwallet.NewTrezorHubWithHID},
+		{"trezor (WebUSB)", usbwallet.NewTrezorHubWithWebUSB},
+	}
+
+	for _, hub := range hubs {
+		h, err := hub.open()
+		if err != nil {
+			hubErrs = append(hubErrs, fmt.Errorf("%s: %v", hub.name, err))
+			continue
+		}
+		wallets = append(wallets, h.Wallets()...)
+	}
+
+	// Only fail if no hub could be started at all
+	if len(hubErrs) == len(hubs) {
+		return nil, fmt.Errorf("failed to initialize hardware wallet hubs: %v", errors.Join(hubErrs...))
+	}
+
+	return wallets, nil
+}
+
 // NewHardwareWallet initializes a new hardware wallet connection
-func NewHardwareWallet() (*HardwareWallet, error) {
-	hub, err := ledger.NewLedgerHub()
+func NewHardwareWallet(opts HardwareOptions) (*HardwareWallet, error) {
+	wallets, err := ListHardwareWallets()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize ledger hub: %v", err)
+		return nil, err
+	}
+
+	if opts.Kind != "" {
+		var matching []accounts.Wallet
+		for _, wallet := range wallets {
+			if wallet.URL().Scheme == opts.Kind {
+				matching = append(matching, wallet)
+			}
+		}
+		wallets = matching
 	}
 
-	wallets := hub.Wallets()
 	if len(wallets) == 0 {
+		if opts.Kind != "" {
+			return nil, fmt.Errorf("no %s hardware wallet found", opts.Kind)
+		}
 		return nil, errors.New("no hardware wallet found")
 	}
+	if opts.Device < 0 || opts.Device >= len(wallets) {
+		return nil, fmt.Errorf("hardware wallet %d not found (%d connected)", opts.Device, len(wallets))
+	}
 
-	// Use the first available wallet
-	wallet := wallets[0]
+	wallet := wallets[opts.Device]
+	if err := wallet.Open(""); err != nil {
+		return nil, fmt.Errorf("failed to open hardware wallet: %v", err)
+	}
 
-	// Default to first account
-	path := accounts.DefaultBaseDerivationPath
+	path := opts.Path
+	if path == nil {
+		path = AccountDerivationPath(0)
+	}
 
 	return &HardwareWallet{
 		device: wallet,
@@ -40,6 +179,86 @@ func NewHardwareWallet() (*HardwareWallet, error) {
 	}, nil
 }
 
+// URL returns the device URL of the hardware wallet
+func (hw *HardwareWallet) URL() string {
+	return hw.device.URL().String()
+}
+
+// Path returns the derivation path used for signing
+func (hw *HardwareWallet) Path() accounts.DerivationPath {
+	return hw.path
+}
+
+// Kind returns "ledger" or "trezor"
+func (hw *HardwareWallet) Kind() string {
+	return hw.device.URL().Scheme
+}
+
+// Fingerprint returns the address of the first account on the default path.
+// It identifies the seed on the device across USB ports and reconnects.
+func (hw *HardwareWallet) Fingerprint() (common.Address, error) {
+	account, err := hw.device.Derive(AccountDerivationPath(0), false)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to derive account: %v", err)
+	}
+	return account.Address, nil
+}
+
+// DeriveAccounts derives count accounts of a path template from index start,
+// without selecting them for signing
+func (hw *HardwareWallet) DeriveAccounts(template string, start, count uint32) ([]DerivedAccount, error) {
+	var derived []DerivedAccount
+	for index := start; index < start+count; index++ {
+		path, err := PathFromTemplate(template, index)
+		if err != nil {
+			return nil, err
+		}
+		account, err := hw.device.Derive(path, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive %s: %v", path, err)
+		}
+		derived = append(derived, DerivedAccount{Index: index, Path: path, Address: account.Address})
+	}
+	return derived, nil
+}
+
+// VerifyAccount has the device sign a typed data message naming the account's
+// address and path, which the user confirms on the device. The device cannot
+// show addresses through the USB drivers used here, so the signature proves
+// instead that the device holds the key of the address at that path. Nothing
+// is sent anywhere.
+func (hw *HardwareWallet) VerifyAccount(account DerivedAccount) error {
+	if err := hw.require(CapTypedData); err != nil {
+		return err
+	}
+	check := &TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {{Name: "name", Type: "string"}, {Name: "version", Type: "string"}},
+			"AccountCheck": {{Name: "account", Type: "address"}, {Name: "path", Type: "string"}},
+		},
+		PrimaryType: "AccountCheck",
+		Domain:      apitypes.TypedDataDomain{Name: "GoSignerVaultCLI", Version: "1"},
+		Message:     map[string]interface{}{"account": account.Address.Hex(), "path": account.Path.String()},
+	}
+	signature, err := hw.signTypedDataAt(account.Path, check)
+	if err != nil {
+		return err
+	}
+	signer, err := VerifyTypedDataSignature(check, signature)
+	if err != nil {
+		return err
+	}
+	if signer != account.Address {
+		return fmt.Errorf("the device signed for %s at %s, not for %s", signer.Hex(), account.Path, account.Address.Hex())
+	}
+	return nil
+}
+
+// Close closes the connection to the device
+func (hw *HardwareWallet) Close() error {
+	return hw.device.Close()
+}
+
 // GetAddress returns the Ethereum address for the current derivation path
 func (hw *HardwareWallet) GetAddress() (common.Address, error) {
 	account, err := hw.device.Derive(hw.path, true)
@@ -49,43 +268,165 @@ func (hw *HardwareWallet) GetAddress() (common.Address, error) {
 	return account.Address, nil
 }
 
-// SignTransaction signs a transaction using the hardware wallet
+// SignTransaction signs a transaction using the hardware wallet and returns
+// the RLP encoded signed transaction
 func (hw *HardwareWallet) SignTransaction(tx *Transaction) ([]byte, error) {
+	if err := tx.Validate(); err != nil {
+		return nil, err
+	}
+	if tx.IsBlob() {
+		return nil, fmt.Errorf("hardware wallets cannot sign blob transactions")
+	}
+
 	account, err := hw.device.Derive(hw.path, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive account: %v", err)
 	}
 
-	// Convert transaction to RLP format
-	rlpTx, err := tx.ToRLP()
+	// Sign the transaction
+	signedTx, err := hw.signTx(account, tx.ToEthereumTx(), tx.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the transaction
+	rawTx, err := signedTx.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode transaction: %v", err)
 	}
 
-	// Sign the transaction
-	signature, err := hw.device.SignTx(account, tx.ToEthereumTx(), nil)
+	return rawTx, nil
+}
+
+// Signer returns a Signer for the account of the hardware wallet. The address
+// is derived once; every signature still needs confirmation on the device.
+func (hw *HardwareWallet) Signer() (Signer, error) {
+	address, err := hw.GetAddress()
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+		return nil, err
 	}
+	return &hardwareSigner{hw: hw, address: address}, nil
+}
 
-	return signature, nil
+// hardwareSigner implements Signer with a hardware wallet account
+type hardwareSigner struct {
+	hw      *HardwareWallet
+	address common.Address
 }
 
-// SignMessage signs an arbitrary message using the hardware wallet
-func (hw *HardwareWallet) SignMessage(message []byte) ([]byte, error) {
+// Address returns the address of the account
+func (s *hardwareSigner) Address() common.Address {
+	return s.address
+}
+
+// Kind returns the kind of device, "ledger" or "trezor"
+func (s *hardwareSigner) Kind() string {
+	return s.hw.Kind()
+}
+
+// Supports reports whether the device makes a kind of signature
+func (s *hardwareSigner) Supports(capability Capability) bool {
+	return s.hw.Supports(capability)
+}
+
+// SignTx signs a transaction on the device
+func (s *hardwareSigner) SignTx(tx *Transaction) (string, error) {
+	rawTx, err := s.hw.SignTransaction(tx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0x%x", rawTx), nil
+}
+
+// SignMessage signs a message with the EIP-191 prefix on the device
+func (s *hardwareSigner) SignMessage(message []byte) ([]byte, error) {
+	return s.hw.SignMessage(message)
+}
+
+// SignTypedData signs an EIP-712 typed data message on the device
+func (s *hardwareSigner) SignTypedData(data *TypedData) ([]byte, error) {
+	return s.hw.SignTypedData(data)
+}
+
+// SignEthereumTx signs an unsigned Ethereum transaction using the hardware
+// wallet and returns the signed transaction
+func (hw *HardwareWallet) SignEthereumTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
 	account, err := hw.device.Derive(hw.path, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive account: %v", err)
 	}
+	return hw.signTx(account, tx, chainID)
+}
+
+// signTx asks the device to confirm and sign a transaction
+func (hw *HardwareWallet) signTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signedTx, err := hw.device.SignTx(account, tx, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	return signedTx, nil
+}
 
-	// Hash the message according to EIP-191
-	hash := crypto.Keccak256Hash(message)
+// SignMessage signs a message with the EIP-191 personal_sign prefix using the
+// hardware wallet
+func (hw *HardwareWallet) SignMessage(message []byte) ([]byte, error) {
+	if err := hw.require(CapMessages); err != nil {
+		return nil, err
+	}
+	account, err := hw.device.Derive(hw.path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive account: %v", err)
+	}
 
-	// Sign the hash
-	signature, err := hw.device.SignText(account, hash.Bytes())
+	// SignText applies the EIP-191 prefix itself, so the message is passed as is
+	signature, err := hw.device.SignText(account, message)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign message: %v", err)
 	}
 
 	return signature, nil
 }
+
+// SignTypedData signs an EIP-712 typed data message using the hardware wallet
+func (hw *HardwareWallet) SignTypedData(data *TypedData) ([]byte, error) {
+	if err := hw.require(CapTypedData); err != nil {
+		return nil, err
+	}
+	return hw.signTypedDataAt(hw.path, data)
+}
+
+// Supports reports whether the device makes a kind of signature
+func (hw *HardwareWallet) Supports(capability Capability) bool {
+	return DeviceSupports(hw.Kind(), capability)
+}
+
+// require returns an error wrapping ErrUnsupported if the device cannot make
+// a kind of signature, before the user is asked to confirm anything
+func (hw *HardwareWallet) require(capability Capability) error {
+	if hw.Supports(capability) {
+		return nil
+	}
+	return fmt.Errorf("%w: a %s device cannot sign %s", ErrUnsupported, hw.Kind(), capability)
+}
+
+// signTypedDataAt signs typed data with the account at a derivation path
+func (hw *HardwareWallet) signTypedDataAt(path accounts.DerivationPath, data *TypedData) ([]byte, error) {
+	account, err := hw.device.Derive(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive account: %v", err)
+	}
+
+	// The device expects the raw "\x19\x01" || domainSeparator || messageHash encoding
+	encoded, err := data.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the typed data
+	signature, err := hw.device.SignData(account, accounts.MimetypeTypedData, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign typed data: %v", err)
+	}
+
+	return signature, nil
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// hardenedOffset marks hardened BIP-32 path components
+const hardenedOffset = 0x80000000
+
+// HDSeed is the BIP-39 seed of a recovery phrase, from which BIP-32 keys
+// are derived
+type HDSeed struct {
+	seed []byte
+}
+
+// NewHDSeed checks a BIP-39 recovery phrase and computes its seed with an
+// optional passphrase
+func NewHDSeed(mnemonic, passphrase string) (*HDSeed, error) {
+	mnemonic = strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recovery phrase: %v", err)
+	}
+	return &HDSeed{seed: seed}, nil
+}
+
+// Wipe zeroes the seed
+func (s *HDSeed) Wipe() {
+	securemem.Wipe(s.seed)
+}
+
+// DeriveKey derives the private key at a BIP-32 path
+func (s *HDSeed) DeriveKey(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(s.seed)
+	node := mac.Sum(nil)
+	defer func() { securemem.Wipe(node) }()
+
+	curveOrder := crypto.S256().Params().N
+	for _, index := range path {
+		key, chainCode := node[:32], node[32:]
+		var data []byte
+		if index >= hardenedOffset {
+			data = append([]byte{0}, key...)
+		} else {
+			parent, err := crypto.ToECDSA(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key at %s: %v", path, err)
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+			securemem.WipeKey(parent)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		child := mac.Sum(nil)
+		securemem.Wipe(data)
+
+		// The child key is IL + parent key (mod n); both must be valid keys
+		tweak := new(big.Int).SetBytes(child[:32])
+		if tweak.Cmp(curveOrder) >= 0 {
+			return nil, fmt.Errorf("path %s derives an invalid key; use the next index", path)
+		}
+		childKey := tweak.Add(tweak, new(big.Int).SetBytes(key))
+		childKey.Mod(childKey, curveOrder)
+		if childKey.Sign() == 0 {
+			return nil, fmt.Errorf("path %s derives an invalid key; use the next index", path)
+		}
+		childKey.FillBytes(child[:32])
+		securemem.Wipe(node)
+		node = child
+	}
+
+	privateKey, err := crypto.ToECDSA(node[:32])
+	if err != nil {
+		return nil, errors.New("derived an invalid private key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,489 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Off-chain order protocols recognized by DecodeOrder
+const (
+	OrderSeaport = "seaport"
+	OrderZeroEx  = "0x"
+	OrderCoW     = "cow"
+)
+
+// Kinds of assets in an order
+const (
+	AssetNative  = "native"
+	AssetERC20   = "erc20"
+	AssetERC721  = "erc721"
+	AssetERC1155 = "erc1155"
+)
+
+// OrderCancelABI covers the functions that cancel signed orders on-chain
+const OrderCancelABI = `[
+	{"inputs":[{"components":[{"name":"offerer","type":"address"},{"name":"zone","type":"address"},{"components":[{"name":"itemType","type":"uint8"},{"name":"token","type":"address"},{"name":"identifierOrCriteria","type":"uint256"},{"name":"startAmount","type":"uint256"},{"name":"endAmount","type":"uint256"}],"name":"offer","type":"tuple[]"},{"components":[{"name":"itemType","type":"uint8"},{"name":"token","type":"address"},{"name":"identifierOrCriteria","type":"uint256"},{"name":"startAmount","type":"uint256"},{"name":"endAmount","type":"uint256"},{"name":"recipient","type":"address"}],"name":"consideration","type":"tuple[]"},{"name":"orderType","type":"uint8"},{"name":"startTime","type":"uint256"},{"name":"endTime","type":"uint256"},{"name":"zoneHash","type":"bytes32"},{"name":"salt","type":"uint256"},{"name":"conduitKey","type":"bytes32"},{"name":"counter","type":"uint256"}],"name":"orders","type":"tuple[]"}],"name":"cancel","outputs":[{"name":"cancelled","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"components":[{"name":"makerToken","type":"address"},{"name":"takerToken","type":"address"},{"name":"makerAmount","type":"uint128"},{"name":"takerAmount","type":"uint128"},{"name":"takerTokenFeeAmount","type":"uint128"},{"name":"maker","type":"address"},{"name":"taker","type":"address"},{"name":"sender","type":"address"},{"name":"feeRecipient","type":"address"},{"name":"pool","type":"bytes32"},{"name":"expiry","type":"uint64"},{"name":"salt","type":"uint256"}],"name":"order","type":"tuple"}],"name":"cancelLimitOrder","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"components":[{"name":"makerToken","type":"address"},{"name":"takerToken","type":"address"},{"name":"makerAmount","type":"uint128"},{"name":"takerAmount","type":"uint128"},{"name":"maker","type":"address"},{"name":"taker","type":"address"},{"name":"txOrigin","type":"address"},{"name":"pool","type":"bytes32"},{"name":"expiry","type":"uint64"},{"name":"salt","type":"uint256"}],"name":"order","type":"tuple"}],"name":"cancelRfqOrder","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"name":"orderUid","type":"bytes"}],"name":"invalidateOrder","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var orderCancelABI = mustParseABI(OrderCancelABI)
+
+// cowNativeToken stands for the native currency in CoW Swap buy tokens
+var cowNativeToken = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+
+// OrderAsset is an amount of a token an order gives or takes
+type OrderAsset struct {
+	Kind  string         `json:"kind"`
+	Token common.Address `json:"token"`
+	ID    *big.Int       `json:"id,omitempty"`
+	// Amount is the amount at the start; EndAmount differs for Seaport auctions
+	Amount    *big.Int        `json:"amount"`
+	EndAmount *big.Int        `json:"endAmount,omitempty"`
+	Recipient *common.Address `json:"recipient,omitempty"`
+}
+
+// Order is an off-chain order of a known protocol, decoded from the EIP-712
+// typed data that is signed for it
+type Order struct {
+	Protocol string         `json:"protocol"`
+	Type     string         `json:"type"`
+	ChainID  *big.Int       `json:"chainId"`
+	Contract common.Address `json:"contract"`
+	// Maker is zero for CoW Swap orders, which are made by their signer
+	Maker common.Address `json:"maker"`
+	Gives []OrderAsset   `json:"gives"`
+	Gets  []OrderAsset   `json:"gets"`
+	Start time.Time      `json:"start,omitempty"`
+	// Expiry is zero for orders without one
+	Expiry time.Time `json:"expiry,omitempty"`
+
+	// cancel builds the calldata cancelling the order for its maker
+	cancel func(maker common.Address, hash common.Hash) ([]byte, error)
+}
+
+// DecodeOrder recognizes a Seaport, 0x or CoW Swap order in typed data by its
+// domain and primary type
+func DecodeOrder(data *TypedData) (*Order, error) {
+	if data.Domain.ChainId == nil {
+		return nil, fmt.Errorf("order domain has no chain ID")
+	}
+	if !common.IsHexAddress(data.Domain.VerifyingContract) {
+		return nil, fmt.Errorf("order domain has no verifying contract")
+	}
+	order := &Order{
+		Type:     data.PrimaryType,
+		ChainID:  (*big.Int)(data.Domain.ChainId),
+		Contract: common.HexToAddress(data.Domain.VerifyingContract),
+	}
+
+	var err error
+	switch {
+	case data.Domain.Name == "Seaport" && data.PrimaryType == "OrderComponents":
+		order.Protocol = OrderSeaport
+		err = order.decodeSeaport(data.Message)
+	case data.Domain.Name == "ZeroEx" && (data.PrimaryType == "LimitOrder" || data.PrimaryType == "RfqOrder"):
+		order.Protocol = OrderZeroEx
+		err = order.decodeZeroEx(data.PrimaryType, data.Message)
+	case data.Domain.Name == "Gnosis Protocol" && data.PrimaryType == "Order":
+		order.Protocol = OrderCoW
+		err = order.decodeCoW(data.Message)
+	default:
+		return nil, fmt.Errorf("%s typed data of domain %q is not a Seaport, 0x or CoW Swap order", data.PrimaryType, data.Domain.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s order: %v", order.Protocol, err)
+	}
+	return order, nil
+}
+
+// CancelData ABI-encodes the call to the order's contract that cancels it
+// on-chain; maker is the signer of the order and hash its EIP-712 hash
+func (o *Order) CancelData(maker common.Address, hash common.Hash) ([]byte, error) {
+	data, err := o.cancel(maker, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s cancellation: %v", o.Protocol, err)
+	}
+	return data, nil
+}
+
+// seaportItem is an offer or consideration item of a Seaport order
+type seaportItem struct {
+	ItemType             uint8
+	Token                common.Address
+	IdentifierOrCriteria *big.Int
+	StartAmount          *big.Int
+	EndAmount            *big.Int
+	Recipient            common.Address
+}
+
+// seaportOfferItem is a Seaport offer item as encoded for cancel()
+type seaportOfferItem struct {
+	ItemType             uint8
+	Token                common.Address
+	IdentifierOrCriteria *big.Int
+	StartAmount          *big.Int
+	EndAmount            *big.Int
+}
+
+// seaportOrderComponents is a Seaport order as encoded for cancel()
+type seaportOrderComponents struct {
+	Offerer       common.Address
+	Zone          common.Address
+	Offer         []seaportOfferItem
+	Consideration []seaportItem
+	OrderType     uint8
+	StartTime     *big.Int
+	EndTime       *big.Int
+	ZoneHash      [32]byte
+	Salt          *big.Int
+	ConduitKey    [32]byte
+	Counter       *big.Int
+}
+
+// decodeSeaport decodes the OrderComponents of a Seaport order
+func (o *Order) decodeSeaport(message map[string]interface{}) error {
+	var components seaportOrderComponents
+	fields := orderFields{message: message}
+	components.Offerer = fields.address("offerer")
+	components.Zone = fields.address("zone")
+	components.OrderType = fields.uint8("orderType")
+	components.StartTime = fields.integer("startTime")
+	components.EndTime = fields.integer("endTime")
+	components.ZoneHash = fields.bytes32("zoneHash")
+	components.Salt = fields.integer("salt")
+	components.ConduitKey = fields.bytes32("conduitKey")
+	components.Counter = fields.integer("counter")
+	offer := fields.items("offer")
+	consideration := fields.items("consideration")
+	if fields.err != nil {
+		return fields.err
+	}
+
+	for i, item := range offer {
+		decoded, err := decodeSeaportItem(item, false)
+		if err != nil {
+			return fmt.Errorf("offer item %d: %v", i, err)
+		}
+		components.Offer = append(components.Offer, seaportOfferItem{
+			ItemType:             decoded.ItemType,
+			Token:                decoded.Token,
+			IdentifierOrCriteria: decoded.IdentifierOrCriteria,
+			StartAmount:          decoded.StartAmount,
+			EndAmount:            decoded.EndAmount,
+		})
+		o.Gives = append(o.Gives, decoded.asset(false))
+	}
+	for i, item := range consideration {
+		decoded, err := decodeSeaportItem(item, true)
+		if err != nil {
+			return fmt.Errorf("consideration item %d: %v", i, err)
+		}
+		components.Consideration = append(components.Consideration, *decoded)
+		o.Gets = append(o.Gets, decoded.asset(true))
+	}
+
+	o.Maker = components.Offerer
+	o.Start = unixTime(components.StartTime)
+	o.Expiry = unixTime(components.EndTime)
+	o.cancel = func(common.Address, common.Hash) ([]byte, error) {
+		return orderCancelABI.Pack("cancel", []seaportOrderComponents{components})
+	}
+	return nil
+}
+
+// decodeSeaportItem decodes an offer or consideration item
+func decodeSeaportItem(item map[string]interface{}, consideration bool) (*seaportItem, error) {
+	fields := orderFields{message: item}
+	decoded := &seaportItem{
+		ItemType:             fields.uint8("itemType"),
+		Token:                fields.address("token"),
+		IdentifierOrCriteria: fields.integer("identifierOrCriteria"),
+		StartAmount:          fields.integer("startAmount"),
+		EndAmount:            fields.integer("endAmount"),
+	}
+	if consideration {
+		decoded.Recipient = fields.address("recipient")
+	}
+	if fields.err != nil {
+		return nil, fields.err
+	}
+	if decoded.ItemType > 5 {
+		return nil, fmt.Errorf("unknown item type %d", decoded.ItemType)
+	}
+	return decoded, nil
+}
+
+// asset describes a Seaport item; items with criteria match any token ID
+// of the criteria and are shown without an ID
+func (i *seaportItem) asset(consideration bool) OrderAsset {
+	asset := OrderAsset{Token: i.Token, Amount: i.StartAmount}
+	switch i.ItemType {
+	case 0:
+		asset.Kind = AssetNative
+	case 1:
+		asset.Kind = AssetERC20
+	case 2, 4:
+		asset.Kind = AssetERC721
+	case 3, 5:
+		asset.Kind = AssetERC1155
+	}
+	if i.ItemType == 2 || i.ItemType == 3 {
+		asset.ID = i.IdentifierOrCriteria
+	}
+	if i.EndAmount.Cmp(i.StartAmount) != 0 {
+		asset.EndAmount = i.EndAmount
+	}
+	if consideration {
+		recipient := i.Recipient
+		asset.Recipient = &recipient
+	}
+	return asset
+}
+
+// zeroExLimitOrder is a 0x v4 limit order as encoded for cancelLimitOrder()
+type zeroExLimitOrder struct {
+	MakerToken          common.Address
+	TakerToken          common.Address
+	MakerAmount         *big.Int
+	TakerAmount         *big.Int
+	TakerTokenFeeAmount *big.Int
+	Maker               common.Address
+	Taker               common.Address
+	Sender              common.Address
+	FeeRecipient        common.Address
+	Pool                [32]byte
+	Expiry              uint64
+	Salt                *big.Int
+}
+
+// zeroExRfqOrder is a 0x v4 RFQ order as encoded for cancelRfqOrder()
+type zeroExRfqOrder struct {
+	MakerToken  common.Address
+	TakerToken  common.Address
+	MakerAmount *big.Int
+	TakerAmount *big.Int
+	Maker       common.Address
+	Taker       common.Address
+	TxOrigin    common.Address
+	Pool        [32]byte
+	Expiry      uint64
+	Salt        *big.Int
+}
+
+// decodeZeroEx decodes a 0x v4 limit or RFQ order
+func (o *Order) decodeZeroEx(primaryType string, message map[string]interface{}) error {
+	fields := orderFields{message: message}
+	makerToken := fields.address("makerToken")
+	takerToken := fields.address("takerToken")
+	makerAmount := fields.integer("makerAmount")
+	takerAmount := fields.integer("takerAmount")
+	maker := fields.address("maker")
+	taker := fields.address("taker")
+	pool := fields.bytes32("pool")
+	expiry := fields.integer("expiry")
+	salt := fields.integer("salt")
+
+	var encoded interface{}
+	method := "cancelRfqOrder"
+	if primaryType == "LimitOrder" {
+		method = "cancelLimitOrder"
+		encoded = zeroExLimitOrder{
+			MakerToken: makerToken, TakerToken: takerToken, MakerAmount: makerAmount, TakerAmount: takerAmount,
+			TakerTokenFeeAmount: fields.integer("takerTokenFeeAmount"), Maker: maker, Taker: taker,
+			Sender: fields.address("sender"), FeeRecipient: fields.address("feeRecipient"),
+			Pool: pool, Expiry: expiry.Uint64(), Salt: salt,
+		}
+	} else {
+		encoded = zeroExRfqOrder{
+			MakerToken: makerToken, TakerToken: takerToken, MakerAmount: makerAmount, TakerAmount: takerAmount,
+			Maker: maker, Taker: taker, TxOrigin: fields.address("txOrigin"),
+			Pool: pool, Expiry: expiry.Uint64(), Salt: salt,
+		}
+	}
+	if fields.err != nil {
+		return fields.err
+	}
+	if !expiry.IsUint64() {
+		return fmt.Errorf("expiry %s does not fit in uint64", expiry)
+	}
+
+	o.Maker = maker
+	o.Gives = []OrderAsset{{Kind: AssetERC20, Token: makerToken, Amount: makerAmount}}
+	o.Gets = []OrderAsset{{Kind: AssetERC20, Token: takerToken, Amount: takerAmount}}
+	o.Expiry = unixTime(expiry)
+	o.cancel = func(common.Address, common.Hash) ([]byte, error) {
+		return orderCancelABI.Pack(method, encoded)
+	}
+	return nil
+}
+
+// decodeCoW decodes a CoW Protocol (GPv2) order
+func (o *Order) decodeCoW(message map[string]interface{}) error {
+	fields := orderFields{message: message}
+	sellToken := fields.address("sellToken")
+	buyToken := fields.address("buyToken")
+	receiver := fields.address("receiver")
+	sellAmount := fields.integer("sellAmount")
+	buyAmount := fields.integer("buyAmount")
+	validTo := fields.integer("validTo")
+	feeAmount := fields.integer("feeAmount")
+	kind := fields.text("kind")
+	if fields.err != nil {
+		return fields.err
+	}
+	if validTo.BitLen() > 32 {
+		return fmt.Errorf("validTo %s does not fit in uint32", validTo)
+	}
+	if kind != "sell" && kind != "buy" {
+		return fmt.Errorf("unknown order kind %q", kind)
+	}
+
+	// The fee is paid in the sell token on top of the sell amount
+	sells := new(big.Int).Add(sellAmount, feeAmount)
+	o.Gives = []OrderAsset{{Kind: AssetERC20, Token: sellToken, Amount: sells}}
+	buys := OrderAsset{Kind: AssetERC20, Token: buyToken, Amount: buyAmount}
+	if buyToken == cowNativeToken {
+		buys.Kind, buys.Token = AssetNative, common.Address{}
+	}
+	if receiver != (common.Address{}) {
+		buys.Recipient = &receiver
+	}
+	o.Gets = []OrderAsset{buys}
+	o.Type = o.Type + " (" + kind + ")"
+	o.Expiry = unixTime(validTo)
+
+	// The order UID is the order digest, the owner and the expiry
+	deadline := uint32(validTo.Uint64())
+	o.cancel = func(maker common.Address, hash common.Hash) ([]byte, error) {
+		uid := append(hash.Bytes(), maker.Bytes()...)
+		uid = binary.BigEndian.AppendUint32(uid, deadline)
+		return orderCancelABI.Pack("invalidateOrder", uid)
+	}
+	return nil
+}
+
+// orderFields reads typed message fields, keeping the first error
+type orderFields struct {
+	message map[string]interface{}
+	err     error
+}
+
+func (f *orderFields) value(name string) (interface{}, bool) {
+	if f.err != nil {
+		return nil, false
+	}
+	value, ok := f.message[name]
+	if !ok {
+		f.err = fmt.Errorf("%s is missing", name)
+	}
+	return value, ok
+}
+
+func (f *orderFields) text(name string) string {
+	value, ok := f.value(name)
+	if !ok {
+		return ""
+	}
+	text, isText := value.(string)
+	if !isText {
+		f.err = fmt.Errorf("%s is not a string", name)
+	}
+	return text
+}
+
+func (f *orderFields) address(name string) common.Address {
+	text := f.text(name)
+	if f.err == nil && !common.IsHexAddress(text) {
+		f.err = fmt.Errorf("%s is not an address: %s", name, text)
+	}
+	return common.HexToAddress(text)
+}
+
+func (f *orderFields) bytes32(name string) [32]byte {
+	var out [32]byte
+	text := f.text(name)
+	if f.err != nil {
+		return out
+	}
+	decoded, err := hexutil.Decode(text)
+	if err != nil || len(decoded) != 32 {
+		f.err = fmt.Errorf("%s is not 32 bytes of hex: %s", name, text)
+		return out
+	}
+	copy(out[:], decoded)
+	return out
+}
+
+// integer accepts decimal and hex strings and integral JSON numbers
+func (f *orderFields) integer(name string) *big.Int {
+	value, ok := f.value(name)
+	if !ok {
+		return new(big.Int)
+	}
+	var result *big.Int
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			result, ok = new(big.Int).SetString(v[2:], 16)
+		} else {
+			result, ok = new(big.Int).SetString(v, 10)
+		}
+	case float64:
+		var accuracy big.Accuracy
+		result, accuracy = new(big.Float).SetFloat64(v).Int(nil)
+		ok = accuracy == big.Exact
+	default:
+		ok = false
+	}
+	if !ok || result.Sign() < 0 {
+		f.err = fmt.Errorf("%s is not an unsigned integer: %v", name, value)
+		return new(big.Int)
+	}
+	return result
+}
+
+func (f *orderFields) uint8(name string) uint8 {
+	value := f.integer(name)
+	if f.err == nil && value.BitLen() > 8 {
+		f.err = fmt.Errorf("%s does not fit in uint8: %s", name, value)
+	}
+	return uint8(value.Uint64())
+}
+
+// items reads an array of structs
+func (f *orderFields) items(name string) []map[string]interface{} {
+	value, ok := f.value(name)
+	if !ok {
+		return nil
+	}
+	list, isList := value.([]interface{})
+	if !isList {
+		f.err = fmt.Errorf("%s is not an array", name)
+		return nil
+	}
+	items := make([]map[string]interface{}, len(list))
+	for i, entry := range list {
+		if items[i], ok = entry.(map[string]interface{}); !ok {
+			f.err = fmt.Errorf("%s[%d] is not a struct", name, i)
+			return nil
+		}
+	}
+	return items
+}
+
+// unixTime converts seconds since the epoch, leaving zero and values past
+// any realistic date (orders "without expiry") as the zero time
+func unixTime(seconds *big.Int) time.Time {
+	if seconds.Sign() == 0 || !seconds.IsInt64() || seconds.Int64() > 1<<40 {
+		return time.Time{}
+	}
+	return time.Unix(seconds.Int64(), 0).UTC()
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+)
+
+// PresetsFile holds the derivation presets added with 'keys hd presets add'
+var PresetsFile = filepath.Join(paths.ConfigDir(), "derivation-presets.json")
+
+// presetNamePattern matches valid preset names
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// DerivationPreset names the account path template of a wallet, whose x
+// component is the account index
+type DerivationPreset struct {
+	Name        string `json:"name"`
+	Template    string `json:"template"`
+	Description string `json:"description,omitempty"`
+	// Builtin is set on the presets shipped with the tool
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// builtinPresets are the account paths of common wallets. Different wallets
+// deriving different paths from the same seed is the usual reason funds seem
+// to be missing after an import.
+var builtinPresets = []DerivationPreset{
+	{Name: "metamask", Template: DefaultPathTemplate, Description: "MetaMask, Rabby and most software wallets"},
+	{Name: "trezor", Template: DefaultPathTemplate, Description: "Trezor Suite"},
+	{Name: "ledger-live", Template: "m/44'/60'/x'/0/0", Description: "Ledger Live"},
+	{Name: "legacy-mew", Template: "m/44'/60'/0'/x", Description: "MyEtherWallet, MyCrypto and the Ledger Chrome app before Ledger Live"},
+}
+
+// DerivationPresets returns the built-in presets followed by the user's,
+// sorted by name
+func DerivationPresets() ([]DerivationPreset, error) {
+	presets := make([]DerivationPreset, len(builtinPresets))
+	for i, preset := range builtinPresets {
+		preset.Builtin = true
+		presets[i] = preset
+	}
+	user, err := loadUserPresets()
+	if err != nil {
+		return nil, err
+	}
+	presets = append(presets, user...)
+	sort.SliceStable(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+// ResolvePathTemplate returns the template of a preset name, or spec itself
+// if it is a path template
+func ResolvePathTemplate(spec string) (string, error) {
+	if strings.HasPrefix(spec, "m/") {
+		if _, err := PathFromTemplate(spec, 0); err != nil {
+			return "", err
+		}
+		return spec, nil
+	}
+	presets, err := DerivationPresets()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, len(presets))
+	for i, preset := range presets {
+		if preset.Name == strings.ToLower(spec) {
+			return preset.Template, nil
+		}
+		names[i] = preset.Name
+	}
+	return "", fmt.Errorf("unknown derivation preset %q (expected a path template or one of %s)", spec, strings.Join(names, ", "))
+}
+
+// AddDerivationPreset adds a user preset. Built-in presets cannot be replaced.
+func AddDerivationPreset(name, template, description string) error {
+	if !presetNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid preset name %q (lower-case letters, digits, '.', '_' and '-')", name)
+	}
+	if _, err := PathFromTemplate(template, 0); err != nil {
+		return err
+	}
+	presets, err := DerivationPresets()
+	if err != nil {
+		return err
+	}
+	for _, preset := range presets {
+		if preset.Name == name {
+			return fmt.Errorf("preset %s already exists", name)
+		}
+	}
+	user, err := loadUserPresets()
+	if err != nil {
+		return err
+	}
+	return saveUserPresets(append(user, DerivationPreset{Name: name, Template: template, Description: description}))
+}
+
+// RemoveDerivationPreset removes a user preset
+func RemoveDerivationPreset(name string) error {
+	for _, preset := range builtinPresets {
+		if preset.Name == name {
+			return fmt.Errorf("preset %s is built in", name)
+		}
+	}
+	user, err := loadUserPresets()
+	if err != nil {
+		return err
+	}
+	for i, preset := range user {
+		if preset.Name == name {
+			return saveUserPresets(append(user[:i], user[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no preset %s", name)
+}
+
+// loadUserPresets reads the user's presets; a missing file holds none
+func loadUserPresets() ([]DerivationPreset, error) {
+	data, err := os.ReadFile(PresetsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read derivation presets: %v", err)
+	}
+	var presets []DerivationPreset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("failed to parse derivation presets: %v", err)
+	}
+	return presets, nil
+}
+
+// saveUserPresets writes the user's presets
+func saveUserPresets(presets []DerivationPreset) error {
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal derivation presets: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(PresetsFile), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(PresetsFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write derivation presets: %v", err)
+	}
+	return nil
+}
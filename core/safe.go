@@ -0,0 +1,223 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Safe operations
+const (
+	SafeOperationCall         uint8 = 0
+	SafeOperationDelegateCall uint8 = 1
+)
+
+// SafeABI covers the Safe functions used to execute multisig transactions
+const SafeABI = `[
+	{"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"signatures","type":"bytes"}],"name":"execTransaction","outputs":[{"name":"success","type":"bool"}],"stateMutability":"payable","type":"function"}
+]`
+
+var safeABI = mustParseABI(SafeABI)
+
+// SafeTransaction is a Gnosis Safe multisig transaction
+type SafeTransaction struct {
+	Safe           common.Address `json:"safe"`
+	ChainID        *big.Int       `json:"chainId"`
+	To             common.Address `json:"to"`
+	Value          *big.Int       `json:"value"`
+	Data           hexutil.Bytes  `json:"data"`
+	Operation      uint8          `json:"operation"`
+	SafeTxGas      *big.Int       `json:"safeTxGas"`
+	BaseGas        *big.Int       `json:"baseGas"`
+	GasPrice       *big.Int       `json:"gasPrice"`
+	GasToken       common.Address `json:"gasToken"`
+	RefundReceiver common.Address `json:"refundReceiver"`
+	Nonce          *big.Int       `json:"nonce"`
+}
+
+// SafeSignature is a signature of a Safe transaction by one owner
+type SafeSignature struct {
+	SafeTxHash common.Hash    `json:"safeTxHash"`
+	Signer     common.Address `json:"signer"`
+	Signature  hexutil.Bytes  `json:"signature"`
+}
+
+// LoadSafeTransaction reads a Safe transaction from a JSON file
+func LoadSafeTransaction(path string) (*SafeTransaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Safe transaction file: %v", err)
+	}
+
+	var safeTx SafeTransaction
+	if err := json.Unmarshal(data, &safeTx); err != nil {
+		return nil, fmt.Errorf("failed to parse Safe transaction: %v", err)
+	}
+	if err := safeTx.Validate(); err != nil {
+		return nil, err
+	}
+	return &safeTx, nil
+}
+
+// Validate checks required fields and fills optional gas fields with zero
+func (t *SafeTransaction) Validate() error {
+	if t.Safe == (common.Address{}) {
+		return fmt.Errorf("Safe transaction is missing the safe address")
+	}
+	if t.ChainID == nil {
+		return fmt.Errorf("Safe transaction is missing the chain ID")
+	}
+	if t.Nonce == nil {
+		return fmt.Errorf("Safe transaction is missing the nonce")
+	}
+	if t.Operation > SafeOperationDelegateCall {
+		return fmt.Errorf("invalid Safe operation %d", t.Operation)
+	}
+
+	for _, field := range []**big.Int{&t.Value, &t.SafeTxGas, &t.BaseGas, &t.GasPrice} {
+		if *field == nil {
+			*field = new(big.Int)
+		}
+	}
+	return nil
+}
+
+// TypedData returns the EIP-712 SafeTx structure signed by the owners (Safe v1.3.0+)
+func (t *SafeTransaction) TypedData() *TypedData {
+	return &TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"SafeTx": {
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "data", Type: "bytes"},
+				{Name: "operation", Type: "uint8"},
+				{Name: "safeTxGas", Type: "uint256"},
+				{Name: "baseGas", Type: "uint256"},
+				{Name: "gasPrice", Type: "uint256"},
+				{Name: "gasToken", Type: "address"},
+				{Name: "refundReceiver", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "SafeTx",
+		Domain: apitypes.TypedDataDomain{
+			ChainId:           (*math.HexOrDecimal256)(t.ChainID),
+			VerifyingContract: t.Safe.Hex(),
+		},
+		Message: map[string]interface{}{
+			"to":             t.To.Hex(),
+			"value":          t.Value.String(),
+			"data":           hexutil.Encode(t.Data),
+			"operation":      fmt.Sprint(t.Operation),
+			"safeTxGas":      t.SafeTxGas.String(),
+			"baseGas":        t.BaseGas.String(),
+			"gasPrice":       t.GasPrice.String(),
+			"gasToken":       t.GasToken.Hex(),
+			"refundReceiver": t.RefundReceiver.Hex(),
+			"nonce":          t.Nonce.String(),
+		},
+	}
+}
+
+// Hash returns the SafeTxHash
+func (t *SafeTransaction) Hash() (common.Hash, error) {
+	return t.TypedData().Hash()
+}
+
+// Sign signs the SafeTxHash with an owner key
+func (t *SafeTransaction) Sign(w *Wallet) (*SafeSignature, error) {
+	signature, err := w.SignTypedData(t.TypedData())
+	if err != nil {
+		return nil, err
+	}
+	return t.NewSignature(signature)
+}
+
+// NewSignature wraps a raw EIP-712 signature of the transaction, recovering the
+// signer and normalizing V to 27/28 as the Safe contract expects
+func (t *SafeTransaction) NewSignature(signature []byte) (*SafeSignature, error) {
+	if len(signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+
+	hash, err := t.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := VerifyTypedDataSignature(t.TypedData(), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := append(hexutil.Bytes(nil), signature...)
+	if normalized[crypto.RecoveryIDOffset] < 27 {
+		normalized[crypto.RecoveryIDOffset] += 27
+	}
+
+	return &SafeSignature{SafeTxHash: hash, Signer: signer, Signature: normalized}, nil
+}
+
+// AggregateSignatures verifies the collected owner signatures and concatenates
+// them sorted by owner address, as required by execTransaction
+func (t *SafeTransaction) AggregateSignatures(signatures []*SafeSignature) ([]byte, error) {
+	hash, err := t.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[common.Address]bool)
+	verified := make([]*SafeSignature, 0, len(signatures))
+	for _, sig := range signatures {
+		if sig.SafeTxHash != hash {
+			return nil, fmt.Errorf("signature by %s is for Safe transaction %s, expected %s",
+				sig.Signer.Hex(), sig.SafeTxHash.Hex(), hash.Hex())
+		}
+
+		signer, err := VerifyTypedDataSignature(t.TypedData(), sig.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if signer != sig.Signer {
+			return nil, fmt.Errorf("signature claims signer %s but was made by %s", sig.Signer.Hex(), signer.Hex())
+		}
+		if seen[signer] {
+			return nil, fmt.Errorf("duplicate signature by %s", signer.Hex())
+		}
+		seen[signer] = true
+		verified = append(verified, sig)
+	}
+
+	sort.Slice(verified, func(i, j int) bool {
+		return bytes.Compare(verified[i].Signer.Bytes(), verified[j].Signer.Bytes()) < 0
+	})
+
+	var packed []byte
+	for _, sig := range verified {
+		packed = append(packed, sig.Signature...)
+	}
+	return packed, nil
+}
+
+// ExecTransactionData ABI-encodes the execTransaction call carrying the aggregated signatures
+func (t *SafeTransaction) ExecTransactionData(signatures []byte) ([]byte, error) {
+	data, err := safeABI.Pack("execTransaction", t.To, t.Value, []byte(t.Data), t.Operation,
+		t.SafeTxGas, t.BaseGas, t.GasPrice, t.GasToken, t.RefundReceiver, signatures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode execTransaction: %v", err)
+	}
+	return data, nil
+}
@@ -2,14 +2,15 @@ package core
 
 import (
 	"crypto/ecdsa"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // Transaction represents an Ethereum transaction
@@ -21,28 +22,212 @@ type Transaction struct {
 	Value    *big.Int
 	Data     []byte
 	ChainID  *big.Int
+
+	// EIP-1559 fees; when MaxFeePerGas is set a dynamic fee transaction is built
+	MaxFeePerGas         *big.Int `json:",omitempty"`
+	MaxPriorityFeePerGas *big.Int `json:",omitempty"`
+
+	// EIP-4844 blob fields; when BlobHashes is set a blob transaction is built
+	MaxFeePerBlobGas *big.Int      `json:",omitempty"`
+	BlobHashes       []common.Hash `json:",omitempty"`
+	Sidecar          *BlobSidecar  `json:",omitempty"`
+}
+
+// IsDynamicFee reports whether the transaction uses EIP-1559 fees
+func (tx *Transaction) IsDynamicFee() bool {
+	return tx.MaxFeePerGas != nil
+}
+
+// FeeCap returns the highest price per gas the transaction can pay
+func (tx *Transaction) FeeCap() *big.Int {
+	if tx.IsDynamicFee() {
+		return tx.MaxFeePerGas
+	}
+	return tx.GasPrice
+}
+
+// ToEthereumTx converts the Transaction to an unsigned Ethereum types.Transaction.
+// A nil To deploys Data as init code.
+func (tx *Transaction) ToEthereumTx() *types.Transaction {
+	if tx.IsBlob() {
+		return tx.blobTx()
+	}
+	if tx.IsDynamicFee() {
+		tip := tx.MaxPriorityFeePerGas
+		if tip == nil {
+			tip = new(big.Int)
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   tx.ChainID,
+			Nonce:     tx.Nonce,
+			GasTipCap: tip,
+			GasFeeCap: tx.MaxFeePerGas,
+			Gas:       tx.GasLimit,
+			To:        tx.To,
+			Value:     tx.Value,
+			Data:      tx.Data,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce,
+		GasPrice: tx.GasPrice,
+		Gas:      tx.GasLimit,
+		To:       tx.To,
+		Value:    tx.Value,
+		Data:     tx.Data,
+	})
 }
 
 // SignTransaction signs a transaction with the given private key
 func SignTransaction(tx *Transaction, privateKey *ecdsa.PrivateKey) (string, error) {
+	if err := tx.Validate(); err != nil {
+		return "", err
+	}
+
 	// Create the transaction
-	ethereumTx := types.NewTransaction(
-		tx.Nonce,
-		*tx.To,
-		tx.Value,
-		tx.GasLimit,
-		tx.GasPrice,
-		tx.Data,
-	)
+	ethereumTx := tx.ToEthereumTx()
 
 	// Sign the transaction
-	signedTx, err := types.SignTx(ethereumTx, types.NewEIP155Signer(tx.ChainID), privateKey)
+	signedTx, err := types.SignTx(ethereumTx, types.LatestSignerForChainID(tx.ChainID), privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	// Encode the transaction; typed transactions use the EIP-2718 envelope
+	rawTx, err := signedTx.MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	return fmt.Sprintf("0x%x", rawTx), nil
+}
+
+// TransactionHash returns the hash of a raw signed transaction. Blob
+// transactions are hashed without the sidecar that travels with them.
+func TransactionHash(rawTx string) common.Hash {
+	var signedTx types.Transaction
+	if err := signedTx.UnmarshalBinary(common.FromHex(rawTx)); err != nil {
+		return crypto.Keccak256Hash(common.FromHex(rawTx))
+	}
+	return signedTx.Hash()
+}
+
+// HashSigner signs 32-byte digests with a key that may not be exportable,
+// returning 65-byte [R || S || V] signatures with V being 0 or 1
+type HashSigner interface {
+	SignHash(hash []byte) ([]byte, error)
+}
+
+// AddressSigner is a HashSigner that knows the address of its key
+type AddressSigner interface {
+	HashSigner
+	Address() common.Address
+}
+
+// Capability is a kind of signature a Signer may be able to make
+type Capability string
+
+const (
+	// CapTransactions is signing transactions
+	CapTransactions Capability = "transactions"
+	// CapMessages is signing EIP-191 personal messages
+	CapMessages Capability = "personal messages"
+	// CapTypedData is signing EIP-712 typed data
+	CapTypedData Capability = "typed data"
+)
+
+// Capabilities lists every kind of signature, in the order they are reported
+var Capabilities = []Capability{CapTransactions, CapMessages, CapTypedData}
+
+// ErrUnsupported is returned for a kind of signature a backend cannot make
+var ErrUnsupported = errors.New("unsupported signature")
+
+// Signer signs with a key of any backend: a decrypted keystore file, a key
+// unlocked in the agent, a remote KMS or a hardware wallet
+type Signer interface {
+	Address() common.Address
+	// SignTx signs a transaction and returns it hex encoded
+	SignTx(tx *Transaction) (string, error)
+	// SignMessage signs a message with the EIP-191 prefix, V being 27 or 28
+	SignMessage(message []byte) ([]byte, error)
+	// SignTypedData signs an EIP-712 typed data message
+	SignTypedData(data *TypedData) ([]byte, error)
+	// Supports reports whether the backend can make a kind of signature, so
+	// commands can refuse before asking for confirmation
+	Supports(capability Capability) bool
+}
+
+// CheckCapability returns an error wrapping ErrUnsupported if a signer cannot
+// make a kind of signature
+func CheckCapability(signer Signer, capability Capability) error {
+	if signer.Supports(capability) {
+		return nil
+	}
+	backend := "this signer"
+	if device, ok := signer.(interface{ Kind() string }); ok {
+		backend = "a " + device.Kind() + " device"
+	}
+	return fmt.Errorf("%w: %s cannot sign %s", ErrUnsupported, backend, capability)
+}
+
+// NewSigner returns the Signer of a key that signs bare hashes. The result is
+// still a HashSigner, e.g. for raw message signatures.
+func NewSigner(signer AddressSigner) Signer {
+	return keySigner{signer}
+}
+
+// keySigner implements Signer on top of an AddressSigner
+type keySigner struct {
+	AddressSigner
+}
+
+// SignTx signs a transaction with the key
+func (s keySigner) SignTx(tx *Transaction) (string, error) {
+	return SignTransactionWithSigner(tx, s.AddressSigner)
+}
+
+// SignMessage signs a message with the EIP-191 prefix
+func (s keySigner) SignMessage(message []byte) ([]byte, error) {
+	signature, err := s.SignHash(MessageHash(message, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %v", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// SignTypedData signs an EIP-712 typed data message
+func (s keySigner) SignTypedData(data *TypedData) ([]byte, error) {
+	return SignTypedDataWithSigner(data, s.AddressSigner)
+}
+
+// Supports reports true: a key that signs hashes makes every kind of signature
+func (s keySigner) Supports(capability Capability) bool {
+	return true
+}
+
+// SignTransactionWithSigner signs a transaction with a HashSigner
+func SignTransactionWithSigner(tx *Transaction, hashSigner HashSigner) (string, error) {
+	if err := tx.Validate(); err != nil {
+		return "", err
+	}
+
+	// Create the transaction
+	ethereumTx := tx.ToEthereumTx()
+	signer := types.LatestSignerForChainID(tx.ChainID)
+
+	// Sign the transaction hash
+	signature, err := hashSigner.SignHash(signer.Hash(ethereumTx).Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	signedTx, err := ethereumTx.WithSignature(signer, signature)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign transaction: %v", err)
 	}
 
-	// Encode the transaction
-	rawTx, err := rlp.EncodeToBytes(signedTx)
+	// Encode the transaction; typed transactions use the EIP-2718 envelope
+	rawTx, err := signedTx.MarshalBinary()
 	if err != nil {
 		return "", fmt.Errorf("failed to encode transaction: %v", err)
 	}
@@ -50,40 +235,75 @@ func SignTransaction(tx *Transaction, privateKey *ecdsa.PrivateKey) (string, err
 	return fmt.Sprintf("0x%x", rawTx), nil
 }
 
-// SignMessage signs a message using EIP-191
-func SignMessage(message []byte, privateKey *ecdsa.PrivateKey) (string, error) {
-	// Create the message hash
-	hash := crypto.Keccak256Hash(message)
+// MessageHash returns the hash signed for a message: the EIP-191 hash of
+// keccak256("\x19Ethereum Signed Message:\n" + len(message) + message) used by
+// personal_sign, or keccak256 of the message alone in raw mode
+func MessageHash(message []byte, raw bool) []byte {
+	if raw {
+		return crypto.Keccak256(message)
+	}
+	return accounts.TextHash(message)
+}
 
-	// Sign the hash
-	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+// SignMessageWithSigner signs a message the same way as SignMessage with a HashSigner
+func SignMessageWithSigner(message []byte, hashSigner HashSigner, raw bool) (string, error) {
+	signature, err := hashSigner.SignHash(MessageHash(message, raw))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign message: %v", err)
 	}
 
-	return fmt.Sprintf("0x%x", signature), nil
+	return formatMessageSignature(signature, raw), nil
 }
 
-// VerifyMessage verifies a signed message
-func VerifyMessage(message []byte, signature string, address common.Address) (bool, error) {
-	// Decode the signature
-	sig, err := hex.DecodeString(signature[2:]) // Remove "0x" prefix
+// SignMessage signs a message with the EIP-191 personal_sign prefix, or the
+// bare keccak256 hash of the message in raw mode
+func SignMessage(message []byte, privateKey *ecdsa.PrivateKey, raw bool) (string, error) {
+	signature, err := crypto.Sign(MessageHash(message, raw), privateKey)
 	if err != nil {
-		return false, fmt.Errorf("failed to decode signature: %v", err)
+		return "", fmt.Errorf("failed to sign message: %v", err)
 	}
 
-	// Create the message hash
-	hash := crypto.Keccak256Hash(message)
+	return formatMessageSignature(signature, raw), nil
+}
 
-	// Recover the public key
-	pubKey, err := crypto.SigToPub(hash.Bytes(), sig)
+// formatMessageSignature encodes a signature as hex. personal_sign signatures
+// carry V as 27/28 like MetaMask and ethers produce them.
+func formatMessageSignature(signature []byte, raw bool) string {
+	if !raw {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
+	return fmt.Sprintf("0x%x", signature)
+}
+
+// RecoverMessageSigner returns the address that signed a message. V may be
+// 0/1 or 27/28.
+func RecoverMessageSigner(message, signature []byte, raw bool) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature must be %d bytes, got %d", crypto.SignatureLength, len(signature))
+	}
+	if signature[crypto.RecoveryIDOffset] >= 27 {
+		signature = append([]byte(nil), signature...)
+		signature[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pubKey, err := crypto.SigToPub(MessageHash(message, raw), signature)
 	if err != nil {
-		return false, fmt.Errorf("failed to recover public key: %v", err)
+		return common.Address{}, fmt.Errorf("failed to recover public key: %v", err)
 	}
+	return crypto.PubkeyToAddress(*pubKey), nil
+}
 
-	// Get the address from the public key
-	recoveredAddr := crypto.PubkeyToAddress(*pubKey)
+// VerifyMessage verifies a signed message
+func VerifyMessage(message []byte, signature string, address common.Address, raw bool) (bool, error) {
+	// Decode the signature
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode signature: %v", err)
+	}
 
-	// Compare addresses
-	return recoveredAddr == address, nil
+	recovered, err := RecoverMessageSigner(message, sig, raw)
+	if err != nil {
+		return false, err
+	}
+	return recovered == address, nil
 }
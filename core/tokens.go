@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ERC20ABI covers the ERC-20 functions and events used to build and decode token transactions
+const ERC20ABI = `[
+	{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"spender","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Approval","type":"event"}
+]`
+
+// ERC721ABI covers the ERC-721 functions used to build token transactions and its events
+const ERC721ABI = `[
+	{"constant":false,"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"name":"safeTransferFrom","outputs":[],"type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Transfer","type":"event"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"operator","type":"address"},{"indexed":false,"name":"approved","type":"bool"}],"name":"ApprovalForAll","type":"event"}
+]`
+
+var (
+	erc20ABI  = mustParseABI(ERC20ABI)
+	erc721ABI = mustParseABI(ERC721ABI)
+)
+
+// mustParseABI parses a built-in ABI definition
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in ABI: %v", err))
+	}
+	return parsed
+}
+
+// EncodeERC20Transfer builds calldata for ERC-20 transfer(to, amount)
+func EncodeERC20Transfer(to common.Address, amount *big.Int) ([]byte, error) {
+	data, err := erc20ABI.Pack("transfer", to, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transfer: %v", err)
+	}
+	return data, nil
+}
+
+// EncodeERC20Approve builds calldata for ERC-20 approve(spender, amount)
+func EncodeERC20Approve(spender common.Address, amount *big.Int) ([]byte, error) {
+	data, err := erc20ABI.Pack("approve", spender, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode approve: %v", err)
+	}
+	return data, nil
+}
+
+// EncodeERC721SafeTransfer builds calldata for ERC-721 safeTransferFrom(from, to, tokenId)
+func EncodeERC721SafeTransfer(from, to common.Address, tokenID *big.Int) ([]byte, error) {
+	data, err := erc721ABI.Pack("safeTransferFrom", from, to, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode safeTransferFrom: %v", err)
+	}
+	return data, nil
+}
+
+// EncodeERC20Call builds calldata for a parameterless ERC-20 getter such as decimals()
+func EncodeERC20Call(method string, args ...interface{}) ([]byte, error) {
+	data, err := erc20ABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %v", method, err)
+	}
+	return data, nil
+}
+
+// DecodeERC20Transfer decodes the recipient and amount of ERC-20 transfer calldata
+func DecodeERC20Transfer(data []byte) (common.Address, *big.Int, error) {
+	method := erc20ABI.Methods["transfer"]
+	if len(data) < 4 || !bytes.Equal(data[:4], method.ID) {
+		return common.Address{}, nil, fmt.Errorf("not an ERC-20 transfer")
+	}
+
+	values, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("failed to decode transfer: %v", err)
+	}
+	to, _ := values[0].(common.Address)
+	amount, _ := values[1].(*big.Int)
+	if amount == nil {
+		return common.Address{}, nil, fmt.Errorf("failed to decode transfer amount")
+	}
+	return to, amount, nil
+}
+
+// DecodeERC20Result decodes the return value of an ERC-20 call
+func DecodeERC20Result(method string, output []byte) ([]interface{}, error) {
+	values, err := erc20ABI.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s result: %v", method, err)
+	}
+	return values, nil
+}
+
+// ParseTokenAmount converts a human-readable decimal amount such as "12.5" into
+// base units for a token with the given number of decimals, without any
+// floating-point conversion. Amounts with more fractional digits than the
+// token supports are rounded with mode, or rejected with RoundExact.
+func ParseTokenAmount(amount string, decimals uint8, mode Rounding) (*big.Int, error) {
+	value, err := ParseDecimal(amount)
+	if err != nil || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	result, _, err := ToBaseUnits(value, decimals, mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %v", amount, err)
+	}
+	return result, nil
+}
+
+// FormatTokenAmount renders base units as a decimal string with the given decimals
+func FormatTokenAmount(value *big.Int, decimals uint8) string {
+	if value == nil {
+		return "0"
+	}
+
+	negative := value.Sign() < 0
+	digits := new(big.Int).Abs(value).String()
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+
+	whole, frac := digits[:len(digits)-int(decimals)], strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+	result := whole
+	if frac != "" {
+		result += "." + frac
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
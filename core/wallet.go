@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/aryehky/gosignervaultcli/securemem"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -39,6 +40,20 @@ func NewWallet() (*Wallet, error) {
 	}, nil
 }
 
+// NewWalletFromPrivateKey wraps an existing private key in a Wallet
+func NewWalletFromPrivateKey(privateKey *ecdsa.PrivateKey) *Wallet {
+	return &Wallet{
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+	}
+}
+
+// Wipe zeroes the private key of the wallet once it is no longer needed
+func (w *Wallet) Wipe() {
+	securemem.WipeKey(w.PrivateKey)
+}
+
 // GetPrivateKeyHex returns the private key as a hex string
 func (w *Wallet) GetPrivateKeyHex() string {
 	return hex.EncodeToString(crypto.FromECDSA(w.PrivateKey))
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39/wordlists"
+)
+
+// ChecksumWordCount is the number of checksum words of an address
+const ChecksumWordCount = 4
+
+// ChecksumWords returns words of the BIP-39 English list taken from the
+// keccak256 hash of an address, 11 bits each. Reading them out checks a
+// printed or copied address more reliably than comparing hex digits. They are
+// derived from the address alone and are not a recovery phrase.
+func ChecksumWords(address common.Address) []string {
+	hash := crypto.Keccak256(address.Bytes())
+	words := make([]string, ChecksumWordCount)
+	for i := range words {
+		index := (int(hash[2*i])<<8 | int(hash[2*i+1])) & 0x7ff
+		words[i] = wordlists.English[index]
+	}
+	return words
+}
+
+// RandomWords returns n words drawn at random from the BIP-39 English list,
+// for phrases typed to confirm an operation
+func RandomWords(n int) ([]string, error) {
+	words := make([]string, n)
+	max := big.NewInt(int64(len(wordlists.English)))
+	for i := range words {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, fmt.Errorf("failed to draw a random word: %v", err)
+		}
+		words[i] = wordlists.English[index.Int64()]
+	}
+	return words, nil
+}
@@ -0,0 +1,242 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsKeySpec is the AWS KMS key spec of secp256k1 keys
+const awsKeySpec = "ECC_SECG_P256K1"
+
+// AWSKMSKeyStore uses secp256k1 keys held by AWS KMS. Keys are named by
+// alias, key ID or ARN and sign inside KMS.
+type AWSKMSKeyStore struct {
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// NewAWSKMSKeyStore creates a keystore for AWS KMS in a region, with
+// credentials from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables
+func NewAWSKMSKeyStore(region string, client *http.Client) (*AWSKMSKeyStore, error) {
+	if region == "" {
+		return nil, fmt.Errorf("AWS region is required")
+	}
+
+	store := &AWSKMSKeyStore{
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       client,
+	}
+	if store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return store, nil
+}
+
+// ListKeys returns the aliases of all keys
+func (k *AWSKMSKeyStore) ListKeys() ([]string, error) {
+	var keys []string
+	marker := ""
+	for {
+		request := map[string]interface{}{}
+		if marker != "" {
+			request["Marker"] = marker
+		}
+
+		var response struct {
+			Aliases []struct {
+				AliasName   string `json:"AliasName"`
+				TargetKeyID string `json:"TargetKeyId"`
+			} `json:"Aliases"`
+			NextMarker string `json:"NextMarker"`
+			Truncated  bool   `json:"Truncated"`
+		}
+		if err := k.call("ListAliases", request, &response); err != nil {
+			return nil, err
+		}
+
+		// AWS managed aliases have no target key of ours
+		for _, alias := range response.Aliases {
+			if alias.TargetKeyID != "" && !strings.HasPrefix(alias.AliasName, "alias/aws/") {
+				keys = append(keys, strings.TrimPrefix(alias.AliasName, "alias/"))
+			}
+		}
+
+		if !response.Truncated {
+			return keys, nil
+		}
+		marker = response.NextMarker
+	}
+}
+
+// DeleteKey is not supported, as deleting a KMS key destroys it irrevocably
+func (k *AWSKMSKeyStore) DeleteKey(name string) error {
+	return fmt.Errorf("AWS KMS keys must be scheduled for deletion in AWS")
+}
+
+// Signer returns a signer for a KMS key
+func (k *AWSKMSKeyStore) Signer(name string) (Signer, error) {
+	keyID := awsKeyID(name)
+
+	var response struct {
+		PublicKey []byte `json:"PublicKey"`
+		KeySpec   string `json:"KeySpec"`
+	}
+	if err := k.call("GetPublicKey", map[string]interface{}{"KeyId": keyID}, &response); err != nil {
+		return nil, err
+	}
+	if response.KeySpec != awsKeySpec {
+		return nil, fmt.Errorf("KMS key %s has key spec %s, expected %s", name, response.KeySpec, awsKeySpec)
+	}
+
+	publicKey, err := parsePublicKey(response.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigner{
+		publicKey: publicKey,
+		sign: func(digest []byte) ([]byte, error) {
+			var response struct {
+				Signature []byte `json:"Signature"`
+			}
+			err := k.call("Sign", map[string]interface{}{
+				"KeyId":            keyID,
+				"Message":          digest,
+				"MessageType":      "DIGEST",
+				"SigningAlgorithm": "ECDSA_SHA_256",
+			}, &response)
+			return response.Signature, err
+		},
+	}, nil
+}
+
+// AWSKMSHost returns the KMS API host of a region
+func AWSKMSHost(region string) string {
+	return fmt.Sprintf("kms.%s.amazonaws.com", region)
+}
+
+// awsKeyID turns a key name into a KMS key ID. Names that are not key IDs or
+// ARNs are treated as aliases.
+func awsKeyID(name string) string {
+	if strings.HasPrefix(name, "alias/") || strings.HasPrefix(name, "arn:") {
+		return name
+	}
+	if len(name) == 36 && strings.Count(name, "-") == 4 {
+		return name
+	}
+	return "alias/" + name
+}
+
+// call invokes a KMS API action with a SigV4 signed request
+func (k *AWSKMSKeyStore) call(action string, request, out interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal KMS request: %v", err)
+	}
+
+	host := AWSKMSHost(k.region)
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create KMS request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	k.sign(req, host, body, time.Now().UTC())
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach AWS KMS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read KMS response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &kmsErr)
+		return fmt.Errorf("AWS KMS %s failed: %s %s", action, kmsErr.Type, kmsErr.Message)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse KMS response: %v", err)
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to a request
+func (k *AWSKMSKeyStore) sign(req *http.Request, host string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if k.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", k.sessionToken)
+	}
+
+	// Canonical headers are lower-case and sorted
+	headers := map[string]string{"host": host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/kms/aws4_request", date, k.region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	// Derive the signing key for this date, region and service
+	key := hmacSHA256([]byte("AWS4"+k.secretKey), date)
+	key = hmacSHA256(key, k.region)
+	key = hmacSHA256(key, "kms")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		k.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
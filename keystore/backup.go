@@ -4,98 +4,536 @@ import (
 	"archive/zip"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/argon2"
 )
 
-// BackupConfig represents the configuration for a keystore backup
-type BackupConfig struct {
-	Version   string            `json:"version"`
-	Timestamp int64             `json:"timestamp"`
-	Keystores []string          `json:"keystores"`
-	Metadata  map[string]string `json:"metadata"`
+// A backup is a zip archive holding every keystore file encrypted under
+// keys/, and a manifest.json in the clear. The manifest lists each file with
+// the SHA-256 of its contents and the Argon2id parameters of the backup key,
+// and is authenticated with an HMAC under a second key derived from the
+// password, so entries cannot be removed, swapped or altered unnoticed.
+
+const (
+	// BackupVersion is the version of the backup format written
+	BackupVersion = 2
+
+	backupManifestName = "manifest.json"
+	backupKeysDir      = "keys/"
+	legacyBackupConfig = "backup.json"
+
+	// backupChunkSize is the plaintext size of each encrypted chunk of a file
+	backupChunkSize = 64 * 1024
+
+	// Limits on the KDF parameters of a backup, so a crafted manifest cannot
+	// exhaust the memory of the machine opening it
+	maxBackupKDFTime   = 64
+	maxBackupKDFMemory = 4 * 1024 * 1024
+)
+
+// errLegacyBackup is returned for backups written before the manifest format
+var errLegacyBackup = errors.New("legacy backup without manifest")
+
+// BackupKDF holds the Argon2id parameters the backup keys are derived with
+type BackupKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      string `json:"salt"`
+	Time      uint32 `json:"time"`
+	// Memory is in KiB
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// defaultBackupKDF takes about a second on a current laptop
+var defaultBackupKDF = BackupKDF{Algorithm: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// BackupEntry is a keystore file of a backup
+type BackupEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupManifest describes the contents of a backup archive
+type BackupManifest struct {
+	Version   int           `json:"version"`
+	Timestamp int64         `json:"timestamp"`
+	KDF       BackupKDF     `json:"kdf"`
+	Entries   []BackupEntry `json:"entries"`
+	MAC       string        `json:"mac"`
 }
 
-// CreateBackup creates an encrypted backup of the keystore directory
-func CreateBackup(keystoreDir string, backupPath string, password string) error {
-	// Create a temporary directory for the backup
-	tempDir, err := os.MkdirTemp("", "keystore-backup-*")
+// backupKeys are the keys derived from a backup password
+type backupKeys struct {
+	cipher cipher.AEAD
+	mac    []byte
+}
+
+// CreateBackup creates an encrypted backup of the keystore directory. Files
+// are streamed through the cipher, so their size is not limited by memory.
+func CreateBackup(keystoreDir string, backupPath string, password string) (err error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+	kdf := defaultBackupKDF
+	kdf.Salt = fmt.Sprintf("0x%x", salt)
+	keys, err := deriveBackupKeys(password, kdf)
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %v", err)
+		return err
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Create backup config
-	config := BackupConfig{
-		Version:   "1.0",
-		Timestamp: time.Now().Unix(),
-		Metadata:  make(map[string]string),
+	file, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %v", err)
 	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(backupPath)
+		}
+	}()
 
-	// Copy keystore files to temp directory
+	archive := zip.NewWriter(file)
+	manifest := &BackupManifest{Version: BackupVersion, Timestamp: time.Now().Unix(), KDF: kdf}
 	err = filepath.Walk(keystoreDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
-		}
-
-		// Skip non-keystore files
-		if filepath.Ext(path) != ".json" {
+		// Skip directories and non-keystore files
+		if info.IsDir() || filepath.Ext(path) != ".json" {
 			return nil
 		}
-
-		// Copy file to temp directory
 		relPath, err := filepath.Rel(keystoreDir, path)
 		if err != nil {
 			return err
 		}
+		entry, err := writeBackupEntry(archive, keys.cipher, path, filepath.ToSlash(relPath))
+		if err != nil {
+			return fmt.Errorf("failed to back up %s: %v", relPath, err)
+		}
+		manifest.Entries = append(manifest.Entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy keystore files: %v", err)
+	}
+
+	if manifest.MAC, err = manifest.sign(keys.mac); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: backupManifestName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %v", err)
+	}
+	return nil
+}
+
+// VerifyBackup checks the manifest of a backup and decrypts every file
+// against it without writing anything
+func VerifyBackup(backupPath string, password string) (*BackupManifest, error) {
+	archive, manifest, keys, err := openBackup(backupPath, password)
+	if errors.Is(err, errLegacyBackup) {
+		return nil, fmt.Errorf("%s is a legacy backup without an integrity manifest; restore it and back up again", backupPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, entry := range manifest.Entries {
+		if err := readBackupEntry(&archive.Reader, keys.cipher, entry, io.Discard); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// RestoreBackup restores a keystore backup to the specified directory. Every
+// file is decrypted and checked against the manifest before any is replaced,
+// and a failure while replacing them puts back the files already replaced.
+func RestoreBackup(backupPath string, keystoreDir string, password string) error {
+	archive, manifest, keys, err := openBackup(backupPath, password)
+	if errors.Is(err, errLegacyBackup) {
+		return restoreLegacyBackup(backupPath, keystoreDir, password)
+	}
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
 
-		destPath := filepath.Join(tempDir, relPath)
+	// Stage the files next to their destination so they can be renamed into place
+	staged := make(map[string]string)
+	defer func() {
+		for _, tempPath := range staged {
+			os.Remove(tempPath)
+		}
+	}()
+	for _, entry := range manifest.Entries {
+		destPath := filepath.Join(keystoreDir, filepath.FromSlash(entry.Path))
 		if err := os.MkdirAll(filepath.Dir(destPath), 0700); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		temp, err := os.CreateTemp(filepath.Dir(destPath), ".restore-*")
+		if err != nil {
+			return fmt.Errorf("failed to create keystore file: %v", err)
+		}
+		staged[destPath] = temp.Name()
+		err = readBackupEntry(&archive.Reader, keys.cipher, entry, temp)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			return err
 		}
+	}
 
-		if err := copyFile(path, destPath); err != nil {
-			return err
+	return installStaged(staged)
+}
+
+// installStaged renames staged files over their destinations, removing each
+// from staged once in place. The files they replace are set aside until all
+// are in place, so on error every destination is restored as it was.
+func installStaged(staged map[string]string) (err error) {
+	type installed struct {
+		destPath, oldPath string
+	}
+	var done []installed
+	defer func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			file := done[i]
+			switch {
+			case err == nil && file.oldPath != "":
+				os.Remove(file.oldPath)
+			case err != nil && file.oldPath != "":
+				os.Rename(file.oldPath, file.destPath)
+			case err != nil:
+				os.Remove(file.destPath)
+			}
 		}
+	}()
+
+	for destPath, tempPath := range staged {
+		var oldPath string
+		if _, err := os.Lstat(destPath); err == nil {
+			oldPath = tempPath + ".old"
+			if err := os.Rename(destPath, oldPath); err != nil {
+				return fmt.Errorf("failed to restore keystore file: %v", err)
+			}
+		}
+		if err := os.Rename(tempPath, destPath); err != nil {
+			if oldPath != "" {
+				os.Rename(oldPath, destPath)
+			}
+			return fmt.Errorf("failed to restore keystore file: %v", err)
+		}
+		done = append(done, installed{destPath: destPath, oldPath: oldPath})
+		delete(staged, destPath)
+	}
+	return nil
+}
 
-		config.Keystores = append(config.Keystores, relPath)
-		return nil
-	})
+// openBackup opens a backup archive and authenticates its manifest with the
+// password. The archive must hold exactly the files the manifest lists.
+func openBackup(backupPath string, password string) (*zip.ReadCloser, *BackupManifest, *backupKeys, error) {
+	archive, err := zip.OpenReader(backupPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open backup: %v", err)
+	}
+	manifest, keys, err := readBackupManifest(&archive.Reader, password)
+	if err != nil {
+		archive.Close()
+		return nil, nil, nil, err
+	}
+	return archive, manifest, keys, nil
+}
 
+// readBackupManifest reads, authenticates and checks the manifest of a backup
+func readBackupManifest(archive *zip.Reader, password string) (*BackupManifest, *backupKeys, error) {
+	var manifestFile *zip.File
+	files := make(map[string]bool)
+	for _, file := range archive.File {
+		switch {
+		case file.Name == backupManifestName:
+			manifestFile = file
+		default:
+			files[file.Name] = true
+		}
+	}
+	if manifestFile == nil {
+		if files[legacyBackupConfig] {
+			return nil, nil, errLegacyBackup
+		}
+		return nil, nil, fmt.Errorf("backup has no manifest")
+	}
+
+	reader, err := manifestFile.Open()
 	if err != nil {
-		return fmt.Errorf("failed to copy keystore files: %v", err)
+		return nil, nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, 16<<20))
+	reader.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	if manifest.Version != BackupVersion {
+		return nil, nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
 	}
 
-	// Create config file
-	configPath := filepath.Join(tempDir, "backup.json")
-	configData, err := json.MarshalIndent(config, "", "  ")
+	keys, err := deriveBackupKeys(password, manifest.KDF)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, err := manifest.sign(keys.mac)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %v", err)
+		return nil, nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(manifest.MAC)) {
+		return nil, nil, fmt.Errorf("wrong backup password or tampered manifest")
+	}
+
+	// The manifest is authentic; the archive must match it exactly
+	for _, entry := range manifest.Entries {
+		if err := checkBackupPath(entry.Path); err != nil {
+			return nil, nil, err
+		}
+		name := backupKeysDir + entry.Path
+		if !files[name] {
+			return nil, nil, fmt.Errorf("backup is missing %s listed in its manifest", entry.Path)
+		}
+		delete(files, name)
+	}
+	for name := range files {
+		return nil, nil, fmt.Errorf("backup holds %s, which is not in its manifest", name)
 	}
+	return &manifest, keys, nil
+}
 
-	if err := os.WriteFile(configPath, configData, 0600); err != nil {
-		return fmt.Errorf("failed to write config: %v", err)
+// sign computes the MAC of the manifest over all fields but the MAC itself
+func (m *BackupManifest) sign(key []byte) (string, error) {
+	unsigned := *m
+	unsigned.MAC = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %v", err)
 	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return fmt.Sprintf("0x%x", mac.Sum(nil)), nil
+}
 
-	// Create encrypted zip archive
-	if err := createEncryptedZip(tempDir, backupPath, password); err != nil {
-		return fmt.Errorf("failed to create encrypted backup: %v", err)
+// deriveBackupKeys derives the encryption and MAC keys of a backup from its
+// password with Argon2id
+func deriveBackupKeys(password string, kdf BackupKDF) (*backupKeys, error) {
+	if kdf.Algorithm != "argon2id" {
+		return nil, fmt.Errorf("unsupported backup KDF %q", kdf.Algorithm)
+	}
+	salt, err := hex.DecodeString(strings.TrimPrefix(kdf.Salt, "0x"))
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("invalid backup KDF salt")
+	}
+	if kdf.Time == 0 || kdf.Time > maxBackupKDFTime || kdf.Threads == 0 ||
+		kdf.Memory < 8*uint32(kdf.Threads) || kdf.Memory > maxBackupKDFMemory {
+		return nil, fmt.Errorf("backup KDF parameters out of range (time %d, memory %d KiB, threads %d)", kdf.Time, kdf.Memory, kdf.Threads)
 	}
 
+	key := argon2.IDKey([]byte(password), salt, kdf.Time, kdf.Memory, kdf.Threads, 64)
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &backupKeys{cipher: gcm, mac: key[32:]}, nil
+}
+
+// writeBackupEntry encrypts a keystore file into the archive, returning its
+// manifest entry
+func writeBackupEntry(archive *zip.Writer, aead cipher.AEAD, path string, name string) (*BackupEntry, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	// Ciphertext does not compress, so store it as is
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: backupKeysDir + name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.New()
+	var size countWriter
+	if err := encryptStream(writer, io.TeeReader(source, io.MultiWriter(digest, &size)), aead, name); err != nil {
+		return nil, err
+	}
+	return &BackupEntry{Path: name, Size: int64(size), SHA256: fmt.Sprintf("0x%x", digest.Sum(nil))}, nil
+}
+
+// readBackupEntry decrypts a file of the archive to w and checks it against
+// its manifest entry
+func readBackupEntry(archive *zip.Reader, aead cipher.AEAD, entry BackupEntry, w io.Writer) error {
+	reader, err := archive.Open(backupKeysDir + entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", entry.Path, err)
+	}
+	defer reader.Close()
+
+	digest := sha256.New()
+	var size countWriter
+	if err := decryptStream(io.MultiWriter(w, digest, &size), reader, aead, entry.Path); err != nil {
+		return fmt.Errorf("failed to decrypt %s: %v", entry.Path, err)
+	}
+	if int64(size) != entry.Size {
+		return fmt.Errorf("%s has %d bytes, manifest lists %d", entry.Path, size, entry.Size)
+	}
+	if sum := fmt.Sprintf("0x%x", digest.Sum(nil)); sum != entry.SHA256 {
+		return fmt.Errorf("%s has SHA-256 %s, manifest lists %s", entry.Path, sum, entry.SHA256)
+	}
 	return nil
 }
 
-// RestoreBackup restores a keystore backup to the specified directory
-func RestoreBackup(backupPath string, keystoreDir string, password string) error {
+// encryptStream encrypts r to w in chunks of backupChunkSize behind a random
+// base nonce. Each chunk is sealed under the base nonce plus its index, with
+// the file name and a final-chunk flag as associated data, so chunks cannot
+// be reordered, truncated or moved to another file.
+func encryptStream(w io.Writer, r io.Reader, aead cipher.AEAD, name string) error {
+	base := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, base); err != nil {
+		return err
+	}
+	if _, err := w.Write(base); err != nil {
+		return err
+	}
+
+	plaintext := make([]byte, backupChunkSize)
+	sealed := make([]byte, 0, backupChunkSize+aead.Overhead())
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(r, plaintext)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return err
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(base, index), plaintext[:n], chunkData(name, final))
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptStream decrypts a stream written by encryptStream from r to w
+func decryptStream(w io.Writer, r io.Reader, aead cipher.AEAD, name string) error {
+	base := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, base); err != nil {
+		return fmt.Errorf("ciphertext too short")
+	}
+
+	// Only the final chunk is shorter than a full one; it may be empty
+	sealed := make([]byte, backupChunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, backupChunkSize)
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(r, sealed)
+		final := err == io.ErrUnexpectedEOF
+		if err == io.EOF {
+			return fmt.Errorf("ciphertext is truncated")
+		}
+		if err != nil && !final {
+			return err
+		}
+		plaintext, err = aead.Open(plaintext[:0], chunkNonce(base, index), sealed[:n], chunkData(name, final))
+		if err != nil {
+			return fmt.Errorf("chunk %d failed authentication", index)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// chunkNonce adds the index of a chunk to the last 8 bytes of the base nonce
+func chunkNonce(base []byte, index uint64) []byte {
+	nonce := append([]byte(nil), base...)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^index)
+	return nonce
+}
+
+// chunkData is the associated data of a chunk
+func chunkData(name string, final bool) []byte {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+	return append([]byte(name), 0, flag)
+}
+
+// checkBackupPath refuses manifest paths that would escape the keystore
+func checkBackupPath(name string) error {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." ||
+		strings.HasPrefix(name, "../") || strings.Contains(name, "\\") {
+		return fmt.Errorf("backup holds invalid path %q", name)
+	}
+	return nil
+}
+
+// countWriter counts the bytes written to it
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+// legacyConfig represents the configuration of a backup written before
+// the manifest format
+type legacyConfig struct {
+	Version   string            `json:"version"`
+	Timestamp int64             `json:"timestamp"`
+	Keystores []string          `json:"keystores"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// restoreLegacyBackup restores a backup written before the manifest format,
+// whose files are each encrypted whole under an unsalted password hash
+func restoreLegacyBackup(backupPath string, keystoreDir string, password string) error {
 	// Create temporary directory for extraction
 	tempDir, err := os.MkdirTemp("", "keystore-restore-*")
 	if err != nil {
@@ -109,32 +547,45 @@ func RestoreBackup(backupPath string, keystoreDir string, password string) error
 	}
 
 	// Read backup config
-	configPath := filepath.Join(tempDir, "backup.json")
-	configData, err := os.ReadFile(configPath)
+	configData, err := os.ReadFile(filepath.Join(tempDir, legacyBackupConfig))
 	if err != nil {
 		return fmt.Errorf("failed to read config: %v", err)
 	}
-
-	var config BackupConfig
+	var config legacyConfig
 	if err := json.Unmarshal(configData, &config); err != nil {
 		return fmt.Errorf("failed to parse config: %v", err)
 	}
 
-	// Restore keystore files
+	// Stage the keystore files next to their destination, then replace them
+	staged := make(map[string]string)
+	defer func() {
+		for _, tempPath := range staged {
+			os.Remove(tempPath)
+		}
+	}()
 	for _, keystorePath := range config.Keystores {
+		if err := checkBackupPath(filepath.ToSlash(keystorePath)); err != nil {
+			return err
+		}
 		srcPath := filepath.Join(tempDir, keystorePath)
 		destPath := filepath.Join(keystoreDir, keystorePath)
 
 		if err := os.MkdirAll(filepath.Dir(destPath), 0700); err != nil {
 			return fmt.Errorf("failed to create directory: %v", err)
 		}
+		temp, err := os.CreateTemp(filepath.Dir(destPath), ".restore-*")
+		if err != nil {
+			return fmt.Errorf("failed to create keystore file: %v", err)
+		}
+		temp.Close()
+		staged[destPath] = temp.Name()
 
-		if err := copyFile(srcPath, destPath); err != nil {
+		if err := copyFile(srcPath, temp.Name()); err != nil {
 			return fmt.Errorf("failed to copy keystore file: %v", err)
 		}
 	}
 
-	return nil
+	return installStaged(staged)
 }
 
 // Helper function to copy a file
@@ -145,70 +596,19 @@ func copyFile(src, dst string) error {
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	destination, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
-	defer destination.Close()
 
 	_, err = io.Copy(destination, source)
-	return err
-}
-
-// Helper function to create an encrypted zip archive
-func createEncryptedZip(srcDir, zipPath, password string) error {
-	// Create zip file
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return err
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
 	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
-
-	// Walk through source directory
-	err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		// Get relative path
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
-			return err
-		}
-
-		// Create zip file entry
-		writer, err := zipWriter.Create(relPath)
-		if err != nil {
-			return err
-		}
-
-		// Read and encrypt file
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-
-		encryptedData, err := encryptData(data, password)
-		if err != nil {
-			return err
-		}
-
-		_, err = writer.Write(encryptedData)
-		return err
-	})
-
 	return err
 }
 
-// Helper function to extract an encrypted zip archive
+// Helper function to extract a legacy encrypted zip archive
 func extractEncryptedZip(zipPath, destDir, password string) error {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -217,6 +617,10 @@ func extractEncryptedZip(zipPath, destDir, password string) error {
 	defer reader.Close()
 
 	for _, file := range reader.File {
+		if err := checkBackupPath(file.Name); err != nil {
+			return err
+		}
+
 		// Create destination file
 		destPath := filepath.Join(destDir, file.Name)
 		if err := os.MkdirAll(filepath.Dir(destPath), 0700); err != nil {
@@ -236,7 +640,7 @@ func extractEncryptedZip(zipPath, destDir, password string) error {
 			return err
 		}
 
-		decryptedData, err := decryptData(data, password)
+		decryptedData, err := decryptLegacyData(data, password)
 		if err != nil {
 			return err
 		}
@@ -250,41 +654,13 @@ func extractEncryptedZip(zipPath, destDir, password string) error {
 	return nil
 }
 
-// Helper function to encrypt data with AES-256-GCM
-func encryptData(data []byte, password string) ([]byte, error) {
-	// Derive key from password
-	key := deriveKey(password)
+// Helper function to decrypt legacy data with AES-256-GCM
+func decryptLegacyData(data []byte, password string) ([]byte, error) {
+	// Legacy backups used the unsalted SHA-256 of the password as key
+	key := sha256.Sum256([]byte(password))
 
 	// Create cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
-	}
-
-	// Encrypt
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-	return ciphertext, nil
-}
-
-// Helper function to decrypt data with AES-256-GCM
-func decryptData(data []byte, password string) ([]byte, error) {
-	// Derive key from password
-	key := deriveKey(password)
-
-	// Create cipher
-	block, err := aes.NewCipher(key)
+	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return nil, err
 	}
@@ -304,18 +680,5 @@ func decryptData(data []byte, password string) ([]byte, error) {
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 
 	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return plaintext, nil
-}
-
-// Helper function to derive a key from a password
-func deriveKey(password string) []byte {
-	// In a real implementation, use a proper key derivation function like PBKDF2
-	// This is a simplified version for demonstration
-	hash := sha256.Sum256([]byte(password))
-	return hash[:]
+	return gcm.Open(nil, nonce, ciphertext, nil)
 }
@@ -11,15 +11,65 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/aryehky/gosignervaultcli/securemem"
 	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/scrypt"
 )
 
+// KDFStrength selects the scrypt cost of new key files. The empty strength
+// selects KDFStandard.
+type KDFStrength string
+
+const (
+	// KDFLight takes well under a second to unlock, for low-value keys
+	KDFLight KDFStrength = "light"
+	// KDFStandard matches the cost of geth's standard key files
+	KDFStandard KDFStrength = "standard"
+	// KDFStrong takes several seconds to unlock, for cold storage
+	KDFStrong KDFStrength = "strong"
+)
+
+// scryptParams are the cost parameters of a KDF strength
+type scryptParams struct {
+	n, r, p int
+}
+
+var kdfStrengths = map[KDFStrength]scryptParams{
+	KDFLight:    {n: 1 << 12, r: 8, p: 6},
+	KDFStandard: {n: 1 << 18, r: 8, p: 1},
+	KDFStrong:   {n: 1 << 20, r: 8, p: 1},
+}
+
+// Limits on the scrypt parameters of key files, so a crafted file cannot
+// exhaust the memory or time of the machine opening it. They admit the
+// strong strength and the standard parameters of other wallets.
+const (
+	maxScryptMemory = 1 << 30
+	maxScryptP      = 16
+)
+
+// legacyKDF labels key files written before scrypt was the default. Despite
+// the label, their key was derived with a single SHA-256 of password and
+// salt; they are re-encrypted with scrypt by keys change-password.
+const legacyKDF = "pbkdf2"
+
+// ParseKDFStrength validates a KDF strength name
+func ParseKDFStrength(value string) (KDFStrength, error) {
+	strength := KDFStrength(value)
+	if _, ok := kdfStrengths[strength]; !ok {
+		return "", fmt.Errorf("unknown KDF strength %q (expected light, standard or strong)", value)
+	}
+	return strength, nil
+}
+
 // EncryptedKey represents an encrypted private key
 type EncryptedKey struct {
-	Address string     `json:"address"`
-	Crypto  CryptoJSON `json:"crypto"`
-	Version int        `json:"version"`
-	ID      string     `json:"id"`
+	Address  string         `json:"address"`
+	Crypto   CryptoJSON     `json:"crypto"`
+	Version  int            `json:"version"`
+	ID       string         `json:"id"`
+	Metadata *KeyMetadata   `json:"metadata,omitempty"`
+	Profile  *SealedProfile `json:"profile,omitempty"`
 }
 
 // CryptoJSON represents the encrypted data structure
@@ -37,8 +87,15 @@ type CipherParamsJSON struct {
 	IV string `json:"iv"`
 }
 
-// EncryptKey encrypts a private key using AES-256-GCM
+// EncryptKey encrypts a private key using AES-256-GCM under a key derived
+// from the password with scrypt at the standard strength
 func EncryptKey(privateKey []byte, password string) (*EncryptedKey, error) {
+	return EncryptKeyWithKDF(privateKey, password, KDFStandard)
+}
+
+// EncryptKeyWithKDF encrypts a private key using AES-256-GCM under a key
+// derived from the password with scrypt at the given strength
+func EncryptKeyWithKDF(privateKey []byte, password string, strength KDFStrength) (*EncryptedKey, error) {
 	// Generate a random salt
 	salt := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
@@ -46,7 +103,25 @@ func EncryptKey(privateKey []byte, password string) (*EncryptedKey, error) {
 	}
 
 	// Derive key from password
-	derivedKey := deriveKey(password, salt)
+	if strength == "" {
+		strength = KDFStandard
+	}
+	params, ok := kdfStrengths[strength]
+	if !ok {
+		return nil, fmt.Errorf("unknown KDF strength %q", strength)
+	}
+	derivedKey, err := scrypt.Key([]byte(password), salt, params.n, params.r, params.p, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	defer securemem.Wipe(derivedKey)
+	kdfParams := map[string]interface{}{
+		"n":     params.n,
+		"r":     params.r,
+		"p":     params.p,
+		"dklen": 32,
+		"salt":  fmt.Sprintf("0x%x", salt),
+	}
 
 	// Generate random IV
 	iv := make([]byte, 12)
@@ -77,6 +152,7 @@ func EncryptKey(privateKey []byte, password string) (*EncryptedKey, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert private key: %v", err)
 	}
+	defer securemem.WipeKey(ecdsaKey)
 
 	// Create the encrypted key structure
 	encryptedKey := &EncryptedKey{
@@ -87,14 +163,9 @@ func EncryptKey(privateKey []byte, password string) (*EncryptedKey, error) {
 			CipherParams: CipherParamsJSON{
 				IV: fmt.Sprintf("0x%x", iv),
 			},
-			KDF: "pbkdf2",
-			KDFParams: map[string]interface{}{
-				"c":     262144,
-				"dklen": 32,
-				"prf":   "hmac-sha256",
-				"salt":  fmt.Sprintf("0x%x", salt),
-			},
-			MAC: fmt.Sprintf("0x%x", mac),
+			KDF:       "scrypt",
+			KDFParams: kdfParams,
+			MAC:       fmt.Sprintf("0x%x", mac),
 		},
 		Version: 3,
 		ID:      fmt.Sprintf("%x", crypto.Keccak256([]byte("GoSignerVaultCLI"))),
@@ -103,6 +174,12 @@ func EncryptKey(privateKey []byte, password string) (*EncryptedKey, error) {
 	return encryptedKey, nil
 }
 
+// ErrWrongPassword is returned when a key does not decrypt with the password
+var ErrWrongPassword = errors.New("wrong password")
+
+// ErrKeyNotFound is returned when a keystore has no key of the given name
+var ErrKeyNotFound = errors.New("key not found")
+
 // DecryptKey decrypts a private key using the provided password
 func DecryptKey(key *EncryptedKey, password string) (*ecdsa.PrivateKey, error) {
 	// Get salt from KDF params
@@ -116,7 +193,23 @@ func DecryptKey(key *EncryptedKey, password string) (*ecdsa.PrivateKey, error) {
 	}
 
 	// Derive key from password
-	derivedKey := deriveKey(password, salt)
+	var derivedKey []byte
+	switch key.Crypto.KDF {
+	case "scrypt":
+		params, err := key.scryptParams()
+		if err != nil {
+			return nil, err
+		}
+		derivedKey, err = scrypt.Key([]byte(password), salt, params.n, params.r, params.p, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %v", err)
+		}
+	case legacyKDF:
+		derivedKey = deriveKey(password, salt)
+	default:
+		return nil, fmt.Errorf("unsupported key file KDF %q", key.Crypto.KDF)
+	}
+	defer securemem.Wipe(derivedKey)
 
 	// Get IV from cipher params
 	iv, err := hex.DecodeString(key.Crypto.CipherParams.IV[2:]) // Remove "0x" prefix
@@ -145,8 +238,9 @@ func DecryptKey(key *EncryptedKey, password string) (*ecdsa.PrivateKey, error) {
 	// Decrypt the private key
 	plaintext, err := aesGCM.Open(nil, iv, ciphertext, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt key: %v", err)
+		return nil, ErrWrongPassword
 	}
+	defer securemem.Wipe(plaintext)
 
 	// Convert to private key
 	privateKey, err := crypto.ToECDSA(plaintext)
@@ -157,10 +251,81 @@ func DecryptKey(key *EncryptedKey, password string) (*ecdsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// deriveKey derives an encryption key from a password and salt
+// Legacy reports whether a key file was written with the original
+// single-hash derivation
+func (key *EncryptedKey) Legacy() bool {
+	return key.Crypto.KDF == legacyKDF
+}
+
+// Strength returns the KDF strength of a key file, or "" if it uses the
+// original derivation or custom scrypt parameters
+func (key *EncryptedKey) Strength() KDFStrength {
+	if key.Crypto.KDF != "scrypt" {
+		return ""
+	}
+	params, err := key.scryptParams()
+	if err != nil {
+		return ""
+	}
+	for strength, candidate := range kdfStrengths {
+		if candidate == params {
+			return strength
+		}
+	}
+	return ""
+}
+
+// scryptParams reads the scrypt cost parameters of a key file
+func (key *EncryptedKey) scryptParams() (scryptParams, error) {
+	param := func(name string) (int, error) {
+		// Parameters are float64 once decoded from JSON
+		switch value := key.Crypto.KDFParams[name].(type) {
+		case float64:
+			if value > 0 && value <= maxScryptMemory && value == float64(int(value)) {
+				return int(value), nil
+			}
+		case int:
+			return value, nil
+		}
+		return 0, fmt.Errorf("invalid scrypt parameter %s in key file", name)
+	}
+	var params scryptParams
+	var err error
+	if params.n, err = param("n"); err != nil {
+		return params, err
+	}
+	if params.r, err = param("r"); err != nil {
+		return params, err
+	}
+	if params.p, err = param("p"); err != nil {
+		return params, err
+	}
+	return params, checkScryptParams(params.n, params.r, params.p)
+}
+
+// checkScryptParams rejects scrypt parameters beyond the limits of key files
+func checkScryptParams(n, r, p int) error {
+	if n < 2 || n&(n-1) != 0 || r <= 0 || p <= 0 || p > maxScryptP ||
+		n > maxScryptMemory/128/r {
+		return fmt.Errorf("scrypt parameters out of range in key file (n %d, r %d, p %d)", n, r, p)
+	}
+	return nil
+}
+
+// LegacyCipher derives the AES-256-GCM cipher data sealed before SealKDF was
+// keyed with, from a single hash of password and salt. It only opens such
+// data to re-seal it; never encrypt with it.
+func LegacyCipher(password string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(password, salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives the key of legacy key files and sealed data from a
+// single hash of password and salt. It is only used to open them.
 func deriveKey(password string, salt []byte) []byte {
-	// Simple key derivation using SHA256
-	// In production, use a proper KDF like PBKDF2
 	key := sha256.Sum256(append([]byte(password), salt...))
 	return key[:]
 }
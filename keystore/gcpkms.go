@@ -0,0 +1,182 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// gcpAlgorithm is the Cloud KMS algorithm of secp256k1 signing keys
+	gcpAlgorithm = "EC_SIGN_SECP256K1_SHA256"
+	// GCPKMSAPI is the base URL of the Cloud KMS REST API
+	GCPKMSAPI = "https://cloudkms.googleapis.com/v1/"
+)
+
+// GCPKMSKeyStore uses secp256k1 keys held by Google Cloud KMS in a key ring.
+// Keys are named by crypto key, optionally followed by "@version" (version 1
+// by default), and sign inside Cloud KMS.
+type GCPKMSKeyStore struct {
+	keyRing string
+	token   string
+	client  *http.Client
+}
+
+// NewGCPKMSKeyStore creates a keystore for a key ring
+// (projects/P/locations/L/keyRings/R). The OAuth access token defaults to the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable, e.g. from
+// `gcloud auth print-access-token`.
+func NewGCPKMSKeyStore(keyRing, token string, client *http.Client) (*GCPKMSKeyStore, error) {
+	if keyRing == "" {
+		return nil, fmt.Errorf("GCP key ring is required")
+	}
+	if token == "" {
+		token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("GCP access token is required")
+	}
+
+	return &GCPKMSKeyStore{
+		keyRing: strings.Trim(keyRing, "/"),
+		token:   token,
+		client:  client,
+	}, nil
+}
+
+// ListKeys returns the names of the secp256k1 signing keys in the key ring
+func (g *GCPKMSKeyStore) ListKeys() ([]string, error) {
+	var keys []string
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		var response struct {
+			CryptoKeys []struct {
+				Name            string `json:"name"`
+				VersionTemplate struct {
+					Algorithm string `json:"algorithm"`
+				} `json:"versionTemplate"`
+			} `json:"cryptoKeys"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := g.request(http.MethodGet, g.keyRing+"/cryptoKeys?"+query.Encode(), nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, key := range response.CryptoKeys {
+			if key.VersionTemplate.Algorithm == gcpAlgorithm {
+				keys = append(keys, path.Base(key.Name))
+			}
+		}
+
+		if response.NextPageToken == "" {
+			return keys, nil
+		}
+		pageToken = response.NextPageToken
+	}
+}
+
+// DeleteKey is not supported, as Cloud KMS keys cannot be deleted
+func (g *GCPKMSKeyStore) DeleteKey(name string) error {
+	return fmt.Errorf("Cloud KMS keys cannot be deleted, destroy their versions in Google Cloud instead")
+}
+
+// Signer returns a signer for a key version
+func (g *GCPKMSKeyStore) Signer(name string) (Signer, error) {
+	key, version, found := strings.Cut(name, "@")
+	if !found {
+		version = "1"
+	}
+	resource := fmt.Sprintf("%s/cryptoKeys/%s/cryptoKeyVersions/%s", g.keyRing, key, version)
+
+	var response struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := g.request(http.MethodGet, resource+"/publicKey", nil, &response); err != nil {
+		return nil, err
+	}
+	if response.Algorithm != gcpAlgorithm {
+		return nil, fmt.Errorf("Cloud KMS key %s has algorithm %s, expected %s", name, response.Algorithm, gcpAlgorithm)
+	}
+
+	block, _ := pem.Decode([]byte(response.Pem))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key PEM for Cloud KMS key %s", name)
+	}
+	publicKey, err := parsePublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsSigner{
+		publicKey: publicKey,
+		sign: func(digest []byte) ([]byte, error) {
+			request := map[string]interface{}{
+				"digest": map[string][]byte{"sha256": digest},
+			}
+			var response struct {
+				Signature []byte `json:"signature"`
+			}
+			err := g.request(http.MethodPost, resource+":asymmetricSign", request, &response)
+			return response.Signature, err
+		},
+	}, nil
+}
+
+// request calls the Cloud KMS REST API
+func (g *GCPKMSKeyStore) request(method, resource string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal Cloud KMS request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, GCPKMSAPI+resource, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create Cloud KMS request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Cloud KMS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Cloud KMS response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var gcpErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &gcpErr)
+		return fmt.Errorf("Cloud KMS returned %s: %s", resp.Status, gcpErr.Error.Message)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse Cloud KMS response: %v", err)
+	}
+	return nil
+}
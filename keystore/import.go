@@ -0,0 +1,176 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// maxPBKDF2Iterations limits the PBKDF2 cost of imported key files, so a
+// crafted file cannot keep the machine busy for hours
+const maxPBKDF2Iterations = 10_000_000
+
+// DecryptKeyJSON decrypts a key file in the Web3 Secret Storage format
+// written by geth, MetaMask, MyEtherWallet and most other wallets, or a key
+// file of this keystore
+func DecryptKeyJSON(data []byte, password string) (*ecdsa.PrivateKey, error) {
+	var key EncryptedKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %v", err)
+	}
+	if key.Version != 3 {
+		return nil, fmt.Errorf("unsupported key file version %d (expected 3)", key.Version)
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	var err error
+	switch key.Crypto.Cipher {
+	case "aes-256-gcm":
+		privateKey, err = DecryptKey(&key, password)
+	case "aes-128-ctr":
+		privateKey, err = decryptWeb3Key(&key.Crypto, password)
+	default:
+		return nil, fmt.Errorf("unsupported key file cipher %q", key.Crypto.Cipher)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The address is optional, but must match the key when present
+	if key.Address != "" {
+		address := crypto.PubkeyToAddress(privateKey.PublicKey)
+		if !common.IsHexAddress(key.Address) || common.HexToAddress(key.Address) != address {
+			return nil, fmt.Errorf("key file is for address %s but holds the key of %s", key.Address, address.Hex())
+		}
+	}
+	return privateKey, nil
+}
+
+// decryptWeb3Key decrypts the AES-128-CTR ciphertext of a Web3 Secret
+// Storage key file after checking its MAC
+func decryptWeb3Key(params *CryptoJSON, password string) (*ecdsa.PrivateKey, error) {
+	salt, err := kdfSalt(params.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	dkLen, err := kdfInt(params.KDFParams, "dklen")
+	if err != nil {
+		return nil, err
+	}
+	if dkLen < 32 || dkLen > 64 {
+		return nil, fmt.Errorf("key file derived key length %d is out of range", dkLen)
+	}
+
+	var derivedKey []byte
+	switch params.KDF {
+	case "scrypt":
+		n, err := kdfInt(params.KDFParams, "n")
+		if err != nil {
+			return nil, err
+		}
+		r, err := kdfInt(params.KDFParams, "r")
+		if err != nil {
+			return nil, err
+		}
+		p, err := kdfInt(params.KDFParams, "p")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkScryptParams(n, r, p); err != nil {
+			return nil, err
+		}
+		if derivedKey, err = scrypt.Key([]byte(password), salt, n, r, p, dkLen); err != nil {
+			return nil, fmt.Errorf("failed to derive key: %v", err)
+		}
+	case "pbkdf2":
+		if prf, _ := params.KDFParams["prf"].(string); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported key file PBKDF2 function %q", prf)
+		}
+		c, err := kdfInt(params.KDFParams, "c")
+		if err != nil {
+			return nil, err
+		}
+		if c > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("PBKDF2 iterations out of range in key file (c %d)", c)
+		}
+		derivedKey = pbkdf2.Key([]byte(password), salt, c, dkLen, sha256.New)
+	default:
+		return nil, fmt.Errorf("unsupported key file KDF %q", params.KDF)
+	}
+	defer securemem.Wipe(derivedKey)
+
+	ciphertext, err := hexField(params.CipherText, "ciphertext")
+	if err != nil {
+		return nil, err
+	}
+	mac, err := hexField(params.MAC, "mac")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(crypto.Keccak256(derivedKey[16:32], ciphertext), mac) {
+		return nil, ErrWrongPassword
+	}
+
+	iv, err := hexField(params.CipherParams.IV, "iv")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derivedKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("invalid IV length %d in key file", len(iv))
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+	defer securemem.Wipe(plaintext)
+
+	privateKey, err := crypto.ToECDSA(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to private key: %v", err)
+	}
+	return privateKey, nil
+}
+
+// kdfSalt reads the salt of a key file, with or without a 0x prefix
+func kdfSalt(params map[string]interface{}) ([]byte, error) {
+	salt, ok := params["salt"].(string)
+	if !ok {
+		return nil, errors.New("invalid salt in key file")
+	}
+	return hexField(salt, "salt")
+}
+
+// kdfInt reads an integer KDF parameter of a key file
+func kdfInt(params map[string]interface{}, name string) (int, error) {
+	// Parameters are float64 once decoded from JSON
+	value, ok := params[name].(float64)
+	if !ok || value <= 0 || value > math.MaxInt32 || value != float64(int(value)) {
+		return 0, fmt.Errorf("invalid KDF parameter %s in key file", name)
+	}
+	return int(value), nil
+}
+
+// hexField decodes a hex field of a key file, with or without a 0x prefix
+func hexField(value, name string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+	return data, nil
+}
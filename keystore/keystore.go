@@ -5,13 +5,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-)
 
-const (
-	// DefaultKeystoreDir is the default directory for storing keystore files
-	DefaultKeystoreDir = ".keystore"
+	"github.com/aryehky/gosignervaultcli/paths"
 )
 
+// DefaultKeystoreDir is the default directory for storing keystore files
+var DefaultKeystoreDir = paths.Resolve("keystore")
+
+// KeyStore is a backend holding named signing keys
+type KeyStore interface {
+	// ListKeys returns the names of all keys in the backend
+	ListKeys() ([]string, error)
+	// DeleteKey removes a key from the backend
+	DeleteKey(name string) error
+}
+
+// RemoteKeyStore is a backend whose keys sign on behalf of the caller and
+// never exist as local files
+type RemoteKeyStore interface {
+	KeyStore
+	// Signer returns a signer for a named key
+	Signer(name string) (Signer, error)
+}
+
 // Manager handles keystore operations
 type Manager struct {
 	keystoreDir string
@@ -44,8 +60,14 @@ func (m *Manager) SaveKey(key *EncryptedKey, name string) error {
 		return fmt.Errorf("failed to marshal key: %v", err)
 	}
 
-	// Write the file with restricted permissions
-	if err := os.WriteFile(filePath, data, 0600); err != nil {
+	// Write the file with restricted permissions, replacing any previous
+	// version atomically so a crash never leaves a truncated key behind
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write keystore file: %v", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("failed to write keystore file: %v", err)
 	}
 
@@ -59,6 +81,9 @@ func (m *Manager) LoadKey(name string) (*EncryptedKey, error) {
 
 	// Read the file
 	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read keystore file: %v", err)
 	}
@@ -89,6 +114,12 @@ func (m *Manager) ListKeys() ([]string, error) {
 	return keys, nil
 }
 
+// HasKey reports whether a named key exists in the keystore
+func (m *Manager) HasKey(name string) bool {
+	_, err := os.Stat(filepath.Join(m.keystoreDir, fmt.Sprintf("%s.json", name)))
+	return err == nil
+}
+
 // DeleteKey removes a key from the keystore
 func (m *Manager) DeleteKey(name string) error {
 	filePath := filepath.Join(m.keystoreDir, fmt.Sprintf("%s.json", name))
@@ -0,0 +1,120 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeyState is the lifecycle state of a key of the file keystore
+type KeyState string
+
+const (
+	// KeyActive keys sign. Keys without a recorded state are active.
+	KeyActive KeyState = "active"
+	// KeySuspended keys refuse to sign until they are made active again
+	KeySuspended KeyState = "suspended"
+	// KeyRetired keys are out of service for good
+	KeyRetired KeyState = "retired"
+	// KeyCompromised keys are known or suspected to be in other hands
+	KeyCompromised KeyState = "compromised"
+)
+
+var (
+	// ErrKeySuspended is returned when a suspended key is asked to sign
+	ErrKeySuspended = errors.New("key is suspended")
+	// ErrKeyRetired is returned when a retired key is asked to sign
+	ErrKeyRetired = errors.New("key is retired")
+	// ErrKeyCompromised is returned when a compromised key is asked to sign
+	ErrKeyCompromised = errors.New("key is compromised")
+)
+
+// keyTransitions lists the states each state may change to. Retired keys can
+// only be marked compromised, and compromised keys stay compromised.
+var keyTransitions = map[KeyState][]KeyState{
+	KeyActive:    {KeySuspended, KeyRetired, KeyCompromised},
+	KeySuspended: {KeyActive, KeyRetired, KeyCompromised},
+	KeyRetired:   {KeyCompromised},
+}
+
+// ParseKeyState parses the name of a lifecycle state
+func ParseKeyState(s string) (KeyState, error) {
+	switch state := KeyState(strings.ToLower(s)); state {
+	case KeyActive, KeySuspended, KeyRetired, KeyCompromised:
+		return state, nil
+	}
+	return "", fmt.Errorf("unknown key state %q (expected active, suspended, retired or compromised)", s)
+}
+
+// State returns the lifecycle state of the key
+func (k *EncryptedKey) State() KeyState {
+	if k.Metadata == nil || k.Metadata.State == "" {
+		return KeyActive
+	}
+	return k.Metadata.State
+}
+
+// CheckState returns the error of the key's state if it may not sign
+func (k *EncryptedKey) CheckState() error {
+	var err error
+	switch k.State() {
+	case KeyActive:
+		return nil
+	case KeySuspended:
+		err = ErrKeySuspended
+	case KeyRetired:
+		err = ErrKeyRetired
+	default:
+		err = ErrKeyCompromised
+	}
+	if k.Metadata.StateReason != "" {
+		return fmt.Errorf("%w (%s)", err, k.Metadata.StateReason)
+	}
+	return err
+}
+
+// CheckState returns an error if the named key may not sign because of its
+// lifecycle state
+func (m *Manager) CheckState(name string) error {
+	key, err := m.LoadKey(name)
+	if err != nil {
+		return err
+	}
+	if err := key.CheckState(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// SetState moves a named key to a new lifecycle state, recording when and why.
+// It returns the previous state.
+func (m *Manager) SetState(name string, state KeyState, reason string) (KeyState, error) {
+	key, err := m.LoadKey(name)
+	if err != nil {
+		return "", err
+	}
+	from := key.State()
+	if from == state {
+		return "", fmt.Errorf("key %s is already %s", name, state)
+	}
+	allowed := false
+	for _, next := range keyTransitions[from] {
+		allowed = allowed || next == state
+	}
+	if !allowed {
+		return "", fmt.Errorf("key %s cannot change from %s to %s", name, from, state)
+	}
+
+	if key.Metadata == nil {
+		key.Metadata = &KeyMetadata{}
+	}
+	now := time.Now().UTC()
+	key.Metadata.State = state
+	key.Metadata.StateChangedAt = &now
+	key.Metadata.StateReason = reason
+	if err := m.SaveKey(key, name); err != nil {
+		return "", err
+	}
+	return from, nil
+}
@@ -0,0 +1,244 @@
+package keystore
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// KeyProfile describes what a key is for. Unlike KeyMetadata it is encrypted
+// in the key file, with a metadata password shared by all keys, so labels and
+// tags can be read without unlocking any key.
+type KeyProfile struct {
+	Label          string   `json:"label,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	DerivationPath string   `json:"derivationPath,omitempty"`
+	// AllowedChains records the chains the key is meant for; signing limits
+	// are enforced by the signing policy
+	AllowedChains []string `json:"allowedChains,omitempty"`
+	Notes         string   `json:"notes,omitempty"`
+}
+
+// SealedProfile is a KeyProfile encrypted with the metadata password.
+// Profiles sealed before KDF was recorded carry a Salt for LegacyCipher
+// instead and are re-sealed when they are next saved.
+type SealedProfile struct {
+	Salt       string   `json:"salt,omitempty"`
+	KDF        *SealKDF `json:"kdf,omitempty"`
+	Nonce      string   `json:"nonce"`
+	CipherText string   `json:"ciphertext"`
+}
+
+// profileCipherKey identifies a cipher derived for profiles
+type profileCipherKey struct {
+	kdf      SealKDF
+	password string
+}
+
+var (
+	profileMu sync.Mutex
+	// profileCiphers caches the ciphers derived for profile KDFs, which keys
+	// sealed with the same password share, so listing keys derives once
+	profileCiphers = make(map[profileCipherKey]cipher.AEAD)
+)
+
+// ErrWrongMetadataPassword is returned when a profile does not decrypt
+var ErrWrongMetadataPassword = errors.New("wrong metadata password")
+
+// HasTag reports whether the profile carries a tag, ignoring case
+func (p *KeyProfile) HasTag(tag string) bool {
+	for _, t := range p.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags adds and removes tags, keeping them sorted and unique
+func (p *KeyProfile) SetTags(add, remove []string) {
+	tags := make(map[string]bool)
+	for _, tag := range p.Tags {
+		tags[tag] = true
+	}
+	for _, tag := range add {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags[tag] = true
+		}
+	}
+	for _, tag := range remove {
+		delete(tags, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	p.Tags = p.Tags[:0]
+	for tag := range tags {
+		p.Tags = append(p.Tags, tag)
+	}
+	sort.Strings(p.Tags)
+}
+
+// SealProfile encrypts a profile with the metadata password under a new
+// Argon2id salt
+func SealProfile(profile *KeyProfile, password string) (*SealedProfile, error) {
+	if password == "" {
+		return nil, errors.New("metadata password is empty")
+	}
+	kdf, err := NewSealKDF(DefaultSealKDF)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := kdf.Cipher(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata cipher: %v", err)
+	}
+	profileMu.Lock()
+	profileCiphers[profileCipherKey{*kdf, password}] = aead
+	profileMu.Unlock()
+	return sealProfile(profile, kdf, aead)
+}
+
+// sealProfile encrypts a profile with a derived cipher
+func sealProfile(profile *KeyProfile, kdf *SealKDF, aead cipher.AEAD) (*SealedProfile, error) {
+	plaintext, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key profile: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &SealedProfile{
+		KDF:        kdf,
+		Nonce:      hexutil.Encode(nonce),
+		CipherText: hexutil.Encode(aead.Seal(nil, nonce, plaintext, nil)),
+	}, nil
+}
+
+// Open decrypts a sealed profile with the metadata password
+func (s *SealedProfile) Open(password string) (*KeyProfile, error) {
+	_, plaintext, err := s.open(password)
+	if err != nil {
+		return nil, err
+	}
+	var profile KeyProfile
+	if err := json.Unmarshal(plaintext, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse key profile: %v", err)
+	}
+	return &profile, nil
+}
+
+// open decrypts a sealed profile and returns the cipher that opened it
+func (s *SealedProfile) open(password string) (cipher.AEAD, []byte, error) {
+	nonce, err := hexutil.Decode(s.Nonce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid profile nonce: %v", err)
+	}
+	ciphertext, err := hexutil.Decode(s.CipherText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid profile ciphertext: %v", err)
+	}
+	decrypt := func(aead cipher.AEAD) ([]byte, error) {
+		if len(nonce) != aead.NonceSize() {
+			return nil, errors.New("invalid profile nonce length")
+		}
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return nil, ErrWrongMetadataPassword
+		}
+		return plaintext, nil
+	}
+
+	if s.KDF == nil {
+		salt, err := hexutil.Decode(s.Salt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid profile salt: %v", err)
+		}
+		aead, err := LegacyCipher(password, salt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create metadata cipher: %v", err)
+		}
+		plaintext, err := decrypt(aead)
+		return nil, plaintext, err
+	}
+
+	cacheKey := profileCipherKey{*s.KDF, password}
+	profileMu.Lock()
+	aead := profileCiphers[cacheKey]
+	profileMu.Unlock()
+	if aead == nil {
+		if aead, err = s.KDF.Cipher(password); err != nil {
+			return nil, nil, fmt.Errorf("failed to create metadata cipher: %v", err)
+		}
+		profileMu.Lock()
+		profileCiphers[cacheKey] = aead
+		profileMu.Unlock()
+	}
+	plaintext, err := decrypt(aead)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, plaintext, nil
+}
+
+// LoadProfile returns the profile of a named key, or an empty profile if it
+// has none
+func (m *Manager) LoadProfile(name, password string) (*KeyProfile, error) {
+	key, err := m.LoadKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if key.Profile == nil {
+		return &KeyProfile{}, nil
+	}
+	profile, err := key.Profile.Open(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profile of key %s: %v", name, err)
+	}
+	return profile, nil
+}
+
+// SaveProfile encrypts the profile of a named key into its key file
+func (m *Manager) SaveProfile(name, password string, profile *KeyProfile) error {
+	key, err := m.LoadKey(name)
+	if err != nil {
+		return err
+	}
+	key.Profile, err = m.sealProfile(profile, password)
+	if err != nil {
+		return err
+	}
+	return m.SaveKey(key, name)
+}
+
+// sealProfile seals a profile under the KDF of another key's profile that
+// opens with the same password, so all profiles can be opened with one
+// derivation, or under a new salt if there is none
+func (m *Manager) sealProfile(profile *KeyProfile, password string) (*SealedProfile, error) {
+	if password == "" {
+		return nil, errors.New("metadata password is empty")
+	}
+	names, err := m.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		key, err := m.LoadKey(name)
+		if err != nil || key.Profile == nil || key.Profile.KDF == nil {
+			continue
+		}
+		// Only the first such profile is tried; a mismatch means the keys
+		// use different metadata passwords
+		if aead, _, err := key.Profile.open(password); err == nil {
+			return sealProfile(profile, key.Profile.KDF, aead)
+		}
+		break
+	}
+	return SealProfile(profile, password)
+}
@@ -0,0 +1,132 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+)
+
+// DefaultProfileName names the keystore selected by --keystore when no
+// configured profile uses the same directory
+const DefaultProfileName = "default"
+
+// DefaultProfilesFile is the default location of the keystore profiles
+var DefaultProfilesFile = filepath.Join(paths.ConfigDir(), "profiles.json")
+
+// profileNamePattern matches valid profile names
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// StoreProfile names a file keystore, so keys spread over several keystores
+// can be found and signed with without remembering which one holds them
+type StoreProfile struct {
+	Name     string `json:"name"`
+	Keystore string `json:"keystore"`
+}
+
+// LoadProfiles reads the profiles file, sorted by name. A missing file holds
+// no profiles.
+func LoadProfiles(path string) ([]StoreProfile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %v", err)
+	}
+	var profiles []StoreProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %v", err)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// SaveProfiles writes the profiles file
+func SaveProfiles(path string, profiles []StoreProfile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profiles: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write profiles: %v", err)
+	}
+	return nil
+}
+
+// AddProfile adds a profile for a keystore directory, which is stored as an
+// absolute path so the profile works from any directory
+func AddProfile(path, name, keystoreDir string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	if name == DefaultProfileName {
+		return fmt.Errorf("%s names the --keystore directory and cannot be configured", DefaultProfileName)
+	}
+	dir, err := filepath.Abs(keystoreDir)
+	if err != nil {
+		return fmt.Errorf("invalid keystore directory: %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("keystore directory %s does not exist", dir)
+	}
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return fmt.Errorf("profile %s already exists", name)
+		}
+		if profile.Keystore == dir {
+			return fmt.Errorf("keystore %s is already profile %s", dir, profile.Name)
+		}
+	}
+	return SaveProfiles(path, append(profiles, StoreProfile{Name: name, Keystore: dir}))
+}
+
+// RemoveProfile removes a profile. The keystore itself is left untouched.
+func RemoveProfile(path, name string) error {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	for i, profile := range profiles {
+		if profile.Name == name {
+			return SaveProfiles(path, append(profiles[:i], profiles[i+1:]...))
+		}
+	}
+	return fmt.Errorf("no profile %s", name)
+}
+
+// SearchProfiles returns the configured profiles together with the keystore
+// in use, which is named after the profile using the same directory or else
+// "default"
+func SearchProfiles(path, keystoreDir string) ([]StoreProfile, error) {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if keystoreDir == "" {
+		keystoreDir = DefaultKeystoreDir
+	}
+	current, err := filepath.Abs(keystoreDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore directory: %v", err)
+	}
+	for _, profile := range profiles {
+		if profile.Keystore == current {
+			return profiles, nil
+		}
+	}
+	return append([]StoreProfile{{Name: DefaultProfileName, Keystore: current}}, profiles...), nil
+}
@@ -0,0 +1,130 @@
+package keystore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// KeyMetadata records the lifecycle of a key
+type KeyMetadata struct {
+	CreatedAt time.Time  `json:"createdAt,omitempty"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	// ReplacedBy is the address of the key that took over this key's name
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// Replaces and ReplacesName identify the retired key this key replaced
+	Replaces     string `json:"replaces,omitempty"`
+	ReplacesName string `json:"replacesName,omitempty"`
+	// State is the lifecycle state of the key, active if empty
+	State          KeyState   `json:"state,omitempty"`
+	StateChangedAt *time.Time `json:"stateChangedAt,omitempty"`
+	StateReason    string     `json:"stateReason,omitempty"`
+}
+
+// Rotation describes a completed key rotation
+type Rotation struct {
+	Name        string
+	RetiredName string
+	OldAddress  string
+	NewAddress  string
+}
+
+// ChangePassword re-encrypts a key under a new password. The private key,
+// address and metadata stay the same.
+func (m *Manager) ChangePassword(name, oldPassword, newPassword string) error {
+	if newPassword == "" {
+		return fmt.Errorf("new password must not be empty")
+	}
+
+	encryptedKey, err := m.LoadKey(name)
+	if err != nil {
+		return err
+	}
+	privateKey, err := DecryptKey(encryptedKey, oldPassword)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	defer securemem.WipeKey(privateKey)
+	plaintext := crypto.FromECDSA(privateKey)
+	defer securemem.Wipe(plaintext)
+
+	reencrypted, err := EncryptKeyWithKDF(plaintext, newPassword, encryptedKey.Strength())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key: %v", err)
+	}
+	reencrypted.Metadata = encryptedKey.Metadata
+	reencrypted.Profile = encryptedKey.Profile
+
+	return m.SaveKey(reencrypted, name)
+}
+
+// Rotate replaces a named key with a freshly generated one encrypted under
+// newPassword. The old key is kept as "<name>-<address prefix>" so funds can
+// still be swept from it, and both keys record the old→new address mapping.
+func (m *Manager) Rotate(name, password, newPassword string) (*Rotation, error) {
+	if newPassword == "" {
+		newPassword = password
+	}
+
+	// Unlock the old key to prove ownership before touching any file
+	oldKey, err := m.LoadKey(name)
+	if err != nil {
+		return nil, err
+	}
+	oldPrivateKey, err := DecryptKey(oldKey, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	securemem.WipeKey(oldPrivateKey)
+
+	retiredName := fmt.Sprintf("%s-%s", name, strings.ToLower(strings.TrimPrefix(oldKey.Address, "0x"))[:8])
+	if m.HasKey(retiredName) {
+		return nil, fmt.Errorf("key %s already exists", retiredName)
+	}
+
+	// Generate and encrypt the new key
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	defer securemem.WipeKey(privateKey)
+	plaintext := crypto.FromECDSA(privateKey)
+	defer securemem.Wipe(plaintext)
+	newKey, err := EncryptKeyWithKDF(plaintext, newPassword, oldKey.Strength())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %v", err)
+	}
+
+	// Record the old→new mapping on both keys
+	now := time.Now().UTC()
+	if oldKey.Metadata == nil {
+		oldKey.Metadata = &KeyMetadata{}
+	}
+	oldKey.Metadata.RotatedAt = &now
+	oldKey.Metadata.ReplacedBy = newKey.Address
+	newKey.Metadata = &KeyMetadata{
+		CreatedAt:    now,
+		Replaces:     oldKey.Address,
+		ReplacesName: retiredName,
+	}
+	// The successor takes over the purpose of the name
+	newKey.Profile = oldKey.Profile
+
+	// Retire the old key first so it survives a failure while saving the new one
+	if err := m.SaveKey(oldKey, retiredName); err != nil {
+		return nil, err
+	}
+	if err := m.SaveKey(newKey, name); err != nil {
+		return nil, err
+	}
+
+	return &Rotation{
+		Name:        name,
+		RetiredName: retiredName,
+		OldAddress:  oldKey.Address,
+		NewAddress:  newKey.Address,
+	}, nil
+}
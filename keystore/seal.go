@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/crypto/argon2"
+)
+
+// Limits on the KDF parameters of sealed data, so a crafted file cannot
+// exhaust the memory of the machine opening it
+const (
+	maxSealKDFTime   = 64
+	maxSealKDFMemory = 4 * 1024 * 1024
+)
+
+// SealKDF holds the Argon2id parameters data other than keys is encrypted
+// with under a password, such as key profiles, the address book and the
+// encrypted history. They are stored next to the data.
+type SealKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      string `json:"salt"`
+	Time      uint32 `json:"time"`
+	// Memory is in KiB
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultSealKDF takes about a second on a current laptop
+var DefaultSealKDF = SealKDF{Algorithm: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// NewSealKDF returns the parameters with a fresh random salt
+func NewSealKDF(params SealKDF) (*SealKDF, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	params.Salt = hexutil.Encode(salt)
+	return &params, nil
+}
+
+// Cipher derives the AES-256-GCM cipher of a password with Argon2id
+func (k *SealKDF) Cipher(password string) (cipher.AEAD, error) {
+	if k.Algorithm != "argon2id" {
+		return nil, fmt.Errorf("unsupported KDF %q", k.Algorithm)
+	}
+	salt, err := hexutil.Decode(k.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("invalid KDF salt")
+	}
+	if k.Time == 0 || k.Time > maxSealKDFTime || k.Threads == 0 ||
+		k.Memory < 8*uint32(k.Threads) || k.Memory > maxSealKDFMemory {
+		return nil, fmt.Errorf("KDF parameters out of range (time %d, memory %d KiB, threads %d)", k.Time, k.Memory, k.Threads)
+	}
+	block, err := aes.NewCipher(argon2.IDKey([]byte(password), salt, k.Time, k.Memory, k.Threads, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,126 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// secp256k1HalfN is half the order of the secp256k1 curve, the bound for
+// canonical low-s signatures
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+// Signer signs 32-byte digests with a key it does not have to expose
+type Signer interface {
+	// Address returns the Ethereum address of the key
+	Address() common.Address
+	// SignHash returns a 65-byte [R || S || V] signature of a digest, V being 0 or 1
+	SignHash(hash []byte) ([]byte, error)
+}
+
+// KeySigner is a Signer over a private key sealed in locked memory
+type KeySigner struct {
+	key *securemem.Key
+}
+
+// NewKeySigner seals a private key in locked memory for signing. The key
+// passed in is wiped, also on failure.
+func NewKeySigner(privateKey *ecdsa.PrivateKey) (*KeySigner, error) {
+	key, err := securemem.NewKey(privateKey)
+	if err != nil {
+		securemem.WipeKey(privateKey)
+		return nil, err
+	}
+	return &KeySigner{key: key}, nil
+}
+
+// Address returns the Ethereum address of the key
+func (s *KeySigner) Address() common.Address {
+	return s.key.Address()
+}
+
+// SignHash signs a digest with the key
+func (s *KeySigner) SignHash(hash []byte) ([]byte, error) {
+	return s.key.SignHash(hash)
+}
+
+// Close wipes the key
+func (s *KeySigner) Close() {
+	s.key.Destroy()
+}
+
+// parsePublicKey parses a DER SubjectPublicKeyInfo holding a secp256k1 key,
+// which crypto/x509 does not support
+func parsePublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	publicKey, err := crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key is not a secp256k1 key: %v", err)
+	}
+	return publicKey, nil
+}
+
+// recoverableSignature converts a DER ECDSA signature returned by a KMS into
+// the [R || S || V] form Ethereum expects. KMS signatures are not necessarily
+// low-s and carry no recovery id, so s is normalized and V is found by
+// recovering the known public key.
+func recoverableSignature(hash, der []byte, publicKey *ecdsa.PublicKey) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %v", err)
+	}
+	if sig.S.Cmp(secp256k1HalfN) > 0 {
+		sig.S.Sub(crypto.S256().Params().N, sig.S)
+	}
+
+	signature := make([]byte, crypto.SignatureLength)
+	sig.R.FillBytes(signature[:32])
+	sig.S.FillBytes(signature[32:64])
+
+	expected := crypto.FromECDSAPub(publicKey)
+	for v := byte(0); v < 2; v++ {
+		signature[64] = v
+		recovered, err := crypto.Ecrecover(hash, signature)
+		if err == nil && bytes.Equal(recovered, expected) {
+			return signature, nil
+		}
+	}
+	return nil, fmt.Errorf("signature does not recover to the key's public key")
+}
+
+// kmsSigner is a Signer for a key held by a cloud KMS, which returns DER
+// signatures of SHA-256 sized digests
+type kmsSigner struct {
+	publicKey *ecdsa.PublicKey
+	sign      func(digest []byte) ([]byte, error)
+}
+
+// Address returns the Ethereum address of the key
+func (s *kmsSigner) Address() common.Address {
+	return crypto.PubkeyToAddress(*s.publicKey)
+}
+
+// SignHash has the KMS sign a digest
+func (s *kmsSigner) SignHash(hash []byte) ([]byte, error) {
+	der, err := s.sign(hash)
+	if err != nil {
+		return nil, err
+	}
+	return recoverableSignature(hash, der, s.publicKey)
+}
@@ -0,0 +1,182 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// DefaultVaultMount is the default KV version 2 secrets engine mount
+	DefaultVaultMount = "secret"
+	// DefaultVaultPath is the default path of keys within the mount
+	DefaultVaultPath = "gosignervault"
+)
+
+// VaultKeyStore keeps keys in a HashiCorp Vault KV version 2 secrets engine.
+// Vault's transit engine has no secp256k1 keys, so keys are read into memory
+// for signing and never written to local files.
+type VaultKeyStore struct {
+	addr   string
+	token  string
+	mount  string
+	path   string
+	client *http.Client
+}
+
+// vaultSecret is the secret stored for each key
+type vaultSecret struct {
+	Address    string `json:"address"`
+	PrivateKey string `json:"privateKey"`
+}
+
+// NewVaultKeyStore creates a keystore on the Vault server at addr
+func NewVaultKeyStore(addr, token, mount, path string, client *http.Client) (*VaultKeyStore, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault token is required")
+	}
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	if path == "" {
+		path = DefaultVaultPath
+	}
+
+	return &VaultKeyStore{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		path:   strings.Trim(path, "/"),
+		client: client,
+	}, nil
+}
+
+// ImportKey stores a private key under a name
+func (v *VaultKeyStore) ImportKey(name string, privateKey *ecdsa.PrivateKey) error {
+	body := map[string]interface{}{
+		"data": vaultSecret{
+			Address:    crypto.PubkeyToAddress(privateKey.PublicKey).Hex(),
+			PrivateKey: hexutil.Encode(crypto.FromECDSA(privateKey)),
+		},
+		// Refuse to overwrite an existing key
+		"options": map[string]interface{}{"cas": 0},
+	}
+	return v.request(http.MethodPost, "data/"+name, body, nil)
+}
+
+// ListKeys returns the names of all keys under the configured path
+func (v *VaultKeyStore) ListKeys() ([]string, error) {
+	var response struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err := v.request("LIST", "metadata/", nil, &response); err != nil {
+		return nil, err
+	}
+
+	// Skip sub-paths, which are listed with a trailing slash
+	var keys []string
+	for _, key := range response.Data.Keys {
+		if !strings.HasSuffix(key, "/") {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// DeleteKey removes a key and all its versions
+func (v *VaultKeyStore) DeleteKey(name string) error {
+	return v.request(http.MethodDelete, "metadata/"+name, nil, nil)
+}
+
+// Signer reads a key into memory and returns a signer for it
+func (v *VaultKeyStore) Signer(name string) (Signer, error) {
+	var response struct {
+		Data struct {
+			Data vaultSecret `json:"data"`
+		} `json:"data"`
+	}
+	if err := v.request(http.MethodGet, "data/"+name, nil, &response); err != nil {
+		return nil, err
+	}
+
+	keyBytes, err := hexutil.Decode(response.Data.Data.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in vault secret %s: %v", name, err)
+	}
+	defer securemem.Wipe(keyBytes)
+	privateKey, err := crypto.ToECDSA(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in vault secret %s: %v", name, err)
+	}
+
+	return NewKeySigner(privateKey)
+}
+
+// request calls the KV engine API below the configured path
+func (v *VaultKeyStore) request(method, endpoint string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal vault request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	// The path is inserted after the data/ or metadata/ prefix
+	kind, name, _ := strings.Cut(endpoint, "/")
+	url := fmt.Sprintf("%s/v1/%s/%s/%s/%s", v.addr, v.mount, kind, v.path, name)
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		// Listing an empty path is not an error
+		if method == "LIST" {
+			return nil
+		}
+		return fmt.Errorf("%w: %s in vault at %s/%s", ErrKeyNotFound, name, v.mount, v.path)
+	}
+	if resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(data, &vaultErr)
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(vaultErr.Errors, "; "))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse vault response: %v", err)
+		}
+	}
+	return nil
+}
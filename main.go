@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aryehky/gosignervaultcli/cmd"
+	"github.com/aryehky/gosignervaultcli/cmd/output"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/aryehky/gosignervaultcli/tx"
 	"github.com/spf13/cobra"
 )
 
@@ -14,17 +18,133 @@ var rootCmd = &cobra.Command{
 	Long: `GoSignerVaultCLI is a lightweight, secure, and extensible command-line interface (CLI) wallet
 and transaction signer built in Go. It allows you to securely generate and manage private keys
 offline, sign transactions for Ethereum-compatible blockchains, and export signed payloads for broadcast.`,
+	PersistentPreRunE: func(c *cobra.Command, args []string) error {
+		securemem.ProtectCoreDumps(noCoreDumps)
+		if err := output.Configure(outputFormat, dryRun); err != nil {
+			return err
+		}
+		if err := output.CheckDryRun(c); err != nil {
+			return err
+		}
+		if err := cmd.ConfigureRounding(roundingMode); err != nil {
+			return err
+		}
+		if err := cmd.ConfigureExplain(explainTopics); err != nil {
+			return err
+		}
+		cmd.ConfigureNicknames(rawAddresses)
+		if err := cmd.ConfigurePortable(c, portableDir); err != nil {
+			return err
+		}
+		if err := cmd.ConfigureEnvironment(c, environment); err != nil {
+			return err
+		}
+		cmd.WarnLegacyPaths(c)
+		if err := cmd.ConfigureNetwork(proxyURL, dohURL); err != nil {
+			return err
+		}
+		if err := cmd.ConfigureRetry(rpcAttempts, rpcTimeout, rpcFailover); err != nil {
+			return output.WithCode(output.ExitUsage, err)
+		}
+		if err := cmd.ConfigureBackend(c, backend, simURL); err != nil {
+			return err
+		}
+		return cmd.ConfigureRPCSession(c, recordRPC, replayRPC, backend)
+	},
 }
 
+var (
+	proxyURL      string
+	dohURL        string
+	roundingMode  string
+	portableDir   string
+	environment   string
+	backend       string
+	simURL        string
+	outputFormat  string
+	explainTopics []string
+	rawAddresses  bool
+	dryRun        bool
+	noCoreDumps   bool
+	rpcAttempts   int
+	rpcTimeout    time.Duration
+	rpcFailover   bool
+	recordRPC     string
+	replayRPC     string
+)
+
 func init() {
+	// Run the root network setup before subcommand hooks
+	cobra.EnableTraverseRunHooks = true
+	rootCmd.PersistentFlags().StringVar(&proxyURL, "proxy", "", "Proxy for all outbound connections (e.g. socks5://127.0.0.1:9050 for Tor)")
+	rootCmd.PersistentFlags().StringVar(&dohURL, "doh", "", "Resolve RPC hostnames via DNS-over-HTTPS (e.g. https://1.1.1.1/dns-query)")
+	rootCmd.PersistentFlags().IntVar(&rpcAttempts, "rpc-attempts", tx.DefaultRetryPolicy.Attempts, "Tries of each RPC call before an unreachable endpoint is reported")
+	rootCmd.PersistentFlags().DurationVar(&rpcTimeout, "rpc-timeout", tx.DefaultRetryPolicy.Timeout, "Timeout of each RPC call attempt (0 for none)")
+	rootCmd.PersistentFlags().BoolVar(&rpcFailover, "rpc-failover", false, "Resend requests a provider refuses for its rate limit to the chain's fallback RPCs")
+	rootCmd.PersistentFlags().StringVar(&recordRPC, "record-rpc", "", "Record the RPC calls of the command and their answers to this session file, without credentials")
+	rootCmd.PersistentFlags().StringVar(&replayRPC, "replay-rpc", "", "Answer RPC calls from a session file recorded with --record-rpc instead of the network")
+	rootCmd.PersistentFlags().StringVar(&roundingMode, "rounding", "exact", "Rounding of amounts with more decimals than supported (exact rejects them, down, up, half-even)")
+	rootCmd.PersistentFlags().StringSliceVar(&explainTopics, "explain", nil, "Explain how derived values were computed (nonce, fees, gas, amounts, rpc or all)")
+	rootCmd.PersistentFlags().Lookup("explain").NoOptDefVal = "all"
+	rootCmd.PersistentFlags().BoolVar(&rawAddresses, "raw", false, "Print bare addresses instead of address book, key and ENS names")
+	rootCmd.PersistentFlags().StringVar(&portableDir, "portable", "", "Keep keystore, policy, history and logs in this portable vault directory")
+	rootCmd.PersistentFlags().StringVar(&environment, "env", "", "Environment whose chain and policy overlays apply (defaults to $GOSIGNERVAULT_ENV)")
+	rootCmd.PersistentFlags().StringVar(&backend, "backend", "rpc", "Chain backend: rpc (the chain's endpoints) or sim (the simulator at --sim-url)")
+	rootCmd.PersistentFlags().StringVar(&simURL, "sim-url", tx.DefaultSimulatorURL, "Endpoint of the simulator used with --backend sim")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output-format", output.FormatText, "Output format: text or json (one JSON document on stdout, text moves to stderr)")
+	rootCmd.PersistentFlags().BoolVar(&noCoreDumps, "no-core-dumps", false, "Disable core dumps (and ptrace on Linux) while keys are held in memory")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Check and report what would be done without signing, sending or saving anything")
+	rootCmd.SetFlagErrorFunc(func(c *cobra.Command, err error) error {
+		return output.WithCode(output.ExitUsage, err)
+	})
+
 	// Add commands
+	rootCmd.AddCommand(cmd.InitCmd)
 	rootCmd.AddCommand(cmd.KeysCmd)
 	rootCmd.AddCommand(cmd.SignCmd)
+	rootCmd.AddCommand(cmd.ContextCmd)
+	rootCmd.AddCommand(cmd.HardwareCmd)
+	rootCmd.AddCommand(cmd.TxCmd)
+	rootCmd.AddCommand(cmd.SafeCmd)
+	rootCmd.AddCommand(cmd.NonceCmd)
+	rootCmd.AddCommand(cmd.ServeCmd)
+	rootCmd.AddCommand(cmd.AccountCmd)
+	rootCmd.AddCommand(cmd.MigratePathsCmd)
+	rootCmd.AddCommand(cmd.PortableCmd)
+	rootCmd.AddCommand(cmd.DoctorCmd)
+	rootCmd.AddCommand(cmd.AddressCmd)
+	rootCmd.AddCommand(cmd.AuditCmd)
+	rootCmd.AddCommand(cmd.ChainsCmd)
+	rootCmd.AddCommand(cmd.VerifyCmd)
+	rootCmd.AddCommand(cmd.SimCmd)
+	rootCmd.AddCommand(cmd.ENSCmd)
+	rootCmd.AddCommand(cmd.DrillCmd)
+	rootCmd.AddCommand(cmd.AgentCmd)
+	rootCmd.AddCommand(cmd.TemplatesCmd)
+	rootCmd.AddCommand(cmd.ABICmd)
+	rootCmd.AddCommand(cmd.OrdersCmd)
+	rootCmd.AddCommand(cmd.SecretsCmd)
+	rootCmd.AddCommand(cmd.TuiCmd)
+	rootCmd.AddCommand(cmd.LinkCmd)
+	rootCmd.AddCommand(cmd.ReportCmd)
+	rootCmd.AddCommand(cmd.RPCCmd)
+	rootCmd.AddCommand(cmd.WCCmd)
+	rootCmd.AddCommand(cmd.JobsCmd)
+	rootCmd.AddCommand(cmd.ExamplesCmd)
+	rootCmd.AddCommand(cmd.PolicyCmd)
+	rootCmd.AddCommand(cmd.ClipboardCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	err := rootCmd.Execute()
+	// Wipe keys still held before the process exits
+	securemem.DestroyAll()
+	cmd.ReportRateLimits()
+	cmd.SaveRPCSession()
+
+	// Seal the portable vault even if the command failed after writing to it
+	if sealErr := cmd.SealPortable(); sealErr != nil {
+		fmt.Println(sealErr)
 	}
+	os.Exit(output.Finish(err))
 }
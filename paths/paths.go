@@ -0,0 +1,203 @@
+// Package paths resolves the default locations of keystores, history and
+// configuration following OS conventions, and migrates data left in the
+// working-directory locations used by earlier versions.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	// EnvHome overrides the base directory of all default locations
+	EnvHome = "GOSIGNERVAULT_HOME"
+
+	// appDir is the application directory below the OS base directories
+	appDir = "gosignervault"
+)
+
+// Location is a default location together with the working-directory
+// location earlier versions used for the same data
+type Location struct {
+	Name    string
+	Legacy  string
+	Current string
+}
+
+// ConfigDir returns the directory holding configuration such as the policy:
+// $XDG_CONFIG_HOME/gosignervault (~/.config) on Linux,
+// ~/Library/Application Support/gosignervault on macOS and
+// %APPDATA%\gosignervault on Windows
+func ConfigDir() string {
+	if portableRoot != "" {
+		return portableRoot
+	}
+	if home := os.Getenv(EnvHome); home != "" {
+		return home
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, appDir)
+}
+
+// DataDir returns the directory holding keys and history:
+// $XDG_DATA_HOME/gosignervault (~/.local/share) on Linux and other Unix
+// systems, and the configuration directory on macOS and Windows
+func DataDir() string {
+	if portableRoot != "" {
+		return portableRoot
+	}
+	if home := os.Getenv(EnvHome); home != "" {
+		return home
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return ConfigDir()
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDir)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", appDir)
+}
+
+// LogDir returns the directory holding logs
+func LogDir() string {
+	return join(DataDir(), "logs")
+}
+
+// Locations returns the default locations that have a legacy counterpart.
+// A portable vault has none, so nothing outside of it is ever picked up.
+func Locations() []Location {
+	if portableRoot != "" {
+		return []Location{
+			{Name: "keystore", Current: filepath.Join(portableRoot, "keystore")},
+			{Name: "history", Current: filepath.Join(portableRoot, "history")},
+			{Name: "policy", Current: filepath.Join(portableRoot, "policy.json")},
+		}
+	}
+	return []Location{
+		{Name: "keystore", Legacy: ".keystore", Current: join(DataDir(), "keystore")},
+		{Name: "history", Legacy: ".history", Current: join(DataDir(), "history")},
+		{Name: "policy", Legacy: "policy.json", Current: join(ConfigDir(), "policy.json")},
+	}
+}
+
+// Resolve returns the default path of a named location. Data that still sits
+// in the legacy working-directory location keeps being used there until it
+// is migrated, so existing keystores are never silently replaced.
+func Resolve(name string) string {
+	for _, loc := range Locations() {
+		if loc.Name == name {
+			if loc.InLegacy() {
+				return loc.Legacy
+			}
+			return loc.Current
+		}
+	}
+	panic(fmt.Sprintf("paths: unknown location %q", name))
+}
+
+// InLegacy reports whether the location is served from its legacy path
+func (l Location) InLegacy() bool {
+	if l.Legacy == "" {
+		return false
+	}
+	return l.Current == l.Legacy || (exists(l.Legacy) && !exists(l.Current))
+}
+
+// Migrate moves the legacy data of a location to its current path. It
+// refuses to overwrite existing data at the destination.
+func (l Location) Migrate() error {
+	if l.Current == l.Legacy {
+		return fmt.Errorf("no OS default location for %s is available", l.Name)
+	}
+	if !exists(l.Legacy) {
+		return fmt.Errorf("%s has no data at %s", l.Name, l.Legacy)
+	}
+	if exists(l.Current) {
+		return fmt.Errorf("%s already exists; merge %s into it by hand", l.Current, l.Legacy)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.Current), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(l.Current), err)
+	}
+
+	// Rename fails across file systems; copy and remove the original instead
+	if err := os.Rename(l.Legacy, l.Current); err == nil {
+		return nil
+	}
+	if err := copyTree(l.Legacy, l.Current); err != nil {
+		os.RemoveAll(l.Current)
+		return fmt.Errorf("failed to copy %s to %s: %v", l.Legacy, l.Current, err)
+	}
+	if err := os.RemoveAll(l.Legacy); err != nil {
+		return fmt.Errorf("copied %s but failed to remove it: %v", l.Legacy, err)
+	}
+	return nil
+}
+
+// join joins a base directory and a name, falling back to the working
+// directory when the OS base directory is unknown
+func join(base, name string) string {
+	if base == "" {
+		return "." + name
+	}
+	return filepath.Join(base, name)
+}
+
+// exists reports whether a path exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// copyTree copies a file or directory tree, keeping permissions
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return errors.New("unsupported file type at " + path)
+		}
+	})
+}
+
+// copyFile copies a regular file
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,201 @@
+package paths
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ManifestFile is the integrity manifest at the root of a portable vault. Its
+// presence next to the executable turns on portable mode automatically.
+const ManifestFile = "vault-manifest.json"
+
+// sealedEntries are the parts of a portable vault covered by the manifest.
+// Logs are left out since they change on every run.
+var sealedEntries = []string{"keystore", "history", "policy.json", "chains.json", "environments", "audit", "secrets.json"}
+
+// portableRoot is the root of the portable vault in use, if any
+var portableRoot = detectPortable()
+
+// Manifest records the SHA-256 of every file in a portable vault. Paths are
+// relative to the vault root with forward slashes, so the vault can be
+// mounted anywhere on any OS.
+type Manifest struct {
+	Version int               `json:"version"`
+	Sealed  time.Time         `json:"sealed"`
+	Files   map[string]string `json:"files"`
+}
+
+// ManifestChange is a difference between a vault and its manifest
+type ManifestChange struct {
+	Path   string
+	Change string
+}
+
+// detectPortable returns the directory of the executable if it holds a manifest
+func detectPortable() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Dir(exe)
+	if !exists(filepath.Join(dir, ManifestFile)) {
+		return ""
+	}
+	return dir
+}
+
+// SetPortable makes every default location live under root. An empty root
+// leaves the current mode unchanged.
+func SetPortable(root string) error {
+	if root == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve portable directory: %v", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("failed to open portable directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", abs)
+	}
+	portableRoot = abs
+	return nil
+}
+
+// PortableRoot returns the root of the portable vault in use, or "" if the
+// standard locations are used
+func PortableRoot() string {
+	return portableRoot
+}
+
+// InitPortable creates the layout of a portable vault and seals it
+func InitPortable(root string) error {
+	for _, dir := range []string{"keystore", "history", "logs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+	if exists(filepath.Join(root, ManifestFile)) {
+		return fmt.Errorf("%s is already a portable vault", root)
+	}
+	return Seal(root)
+}
+
+// Seal records the current contents of a portable vault in its manifest
+func Seal(root string) error {
+	manifest, err := scan(root)
+	if err != nil {
+		return err
+	}
+	manifest.Version = 1
+	manifest.Sealed = time.Now().UTC()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+
+	// Write atomically so an unplugged stick never leaves a torn manifest
+	path := filepath.Join(root, ManifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
+
+// Verify compares a portable vault with its manifest and returns the files
+// that were added, removed or modified since it was last sealed
+func Verify(root string) ([]ManifestChange, error) {
+	data, err := os.ReadFile(filepath.Join(root, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	var sealed Manifest
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	current, err := scan(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ManifestChange
+	for path, sum := range sealed.Files {
+		switch now, ok := current.Files[path]; {
+		case !ok:
+			changes = append(changes, ManifestChange{Path: path, Change: "missing"})
+		case now != sum:
+			changes = append(changes, ManifestChange{Path: path, Change: "modified"})
+		}
+	}
+	for path := range current.Files {
+		if _, ok := sealed.Files[path]; !ok {
+			changes = append(changes, ManifestChange{Path: path, Change: "added"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// scan hashes every regular file of the sealed entries below root
+func scan(root string) (*Manifest, error) {
+	manifest := &Manifest{Files: make(map[string]string)}
+
+	for _, entry := range sealedEntries {
+		start := filepath.Join(root, entry)
+		if !exists(start) {
+			continue
+		}
+		err := filepath.Walk(start, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			manifest.Files[filepath.ToSlash(rel)] = sum
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan portable vault: %v", err)
+		}
+	}
+	return manifest, nil
+}
+
+// hashFile returns the hex SHA-256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,311 @@
+package policy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// DefaultBundleStateFile is the default record of the installed policy bundle
+var DefaultBundleStateFile = filepath.Join(paths.ConfigDir(), "bundle-state.json")
+
+var (
+	// ErrBundleUntrusted is returned for a bundle not signed by a trusted administrator
+	ErrBundleUntrusted = errors.New("bundle is not signed by a trusted administrator")
+	// ErrBundleNotNewer is returned for a bundle whose version is not above the installed one
+	ErrBundleNotNewer = errors.New("bundle is not newer than the installed one")
+)
+
+// Bundle is the configuration an organization distributes to its vaults
+type Bundle struct {
+	Organization string    `json:"organization"`
+	Version      uint64    `json:"version"`
+	Created      time.Time `json:"created"`
+	// Policy replaces the signing policy; nil installs an empty one
+	Policy *Policy `json:"policy,omitempty"`
+	// Chains are merged over the user chains by name
+	Chains map[string]*core.ChainConfig `json:"chains,omitempty"`
+	// Denylist is added to the denied destinations of the policy
+	Denylist []string `json:"denylist,omitempty"`
+	// Contacts are added to the allowed destinations of the policy and to
+	// the address book
+	Contacts []Contact `json:"contacts,omitempty"`
+	// Admins, when non-empty, replace the administrators trusted to sign
+	// later bundles
+	Admins []common.Address `json:"admins,omitempty"`
+}
+
+// Contact is a counterparty on the allowlist of a bundle
+type Contact struct {
+	Label   string         `json:"label"`
+	Address common.Address `json:"address"`
+	Note    string         `json:"note,omitempty"`
+}
+
+// SignedBundle is a bundle with the signature of an administrator over its
+// exact encoding
+type SignedBundle struct {
+	Bundle    json.RawMessage `json:"bundle"`
+	Signer    common.Address  `json:"signer"`
+	Signature hexutil.Bytes   `json:"signature"`
+}
+
+// BundleState records the bundle installed on this vault and the
+// administrators trusted to sign the next one
+type BundleState struct {
+	Organization string           `json:"organization"`
+	Version      uint64           `json:"version"`
+	Hash         string           `json:"hash"`
+	Signer       common.Address   `json:"signer"`
+	Admins       []common.Address `json:"admins"`
+	InstalledAt  time.Time        `json:"installedAt"`
+}
+
+// Validate checks the bundle's policy, lists and contacts
+func (b *Bundle) Validate() error {
+	if strings.TrimSpace(b.Organization) == "" {
+		return errors.New("organization is empty")
+	}
+	if b.Version == 0 {
+		return errors.New("version must be at least 1")
+	}
+	if b.Policy != nil {
+		if err := b.Policy.Validate(); err != nil {
+			return fmt.Errorf("invalid policy: %v", err)
+		}
+	}
+	for name, chain := range b.Chains {
+		if chain == nil {
+			return fmt.Errorf("chain %s is empty", name)
+		}
+		// Entries of built-in chains only carry what differs from the default
+		if _, builtin := core.DefaultChains[name]; !builtin && chain.ChainID == nil {
+			return fmt.Errorf("chain %s has no chain ID", name)
+		}
+	}
+	for _, addr := range b.Denylist {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid denylist address %q", addr)
+		}
+	}
+	for _, contact := range b.Contacts {
+		if strings.TrimSpace(contact.Label) == "" {
+			return fmt.Errorf("contact %s has no label", contact.Address.Hex())
+		}
+	}
+	return nil
+}
+
+// InstalledPolicy returns the policy the bundle installs: its policy with the
+// denylist added to the denied and the contacts to the allowed destinations
+func (b *Bundle) InstalledPolicy() *Policy {
+	p := &Policy{}
+	if b.Policy != nil {
+		copied := *b.Policy
+		p = &copied
+	}
+	p.DeniedDestinations = appendAddresses(p.DeniedDestinations, b.Denylist...)
+	for _, contact := range b.Contacts {
+		p.AllowedDestinations = appendAddresses(p.AllowedDestinations, contact.Address.Hex())
+	}
+	return p
+}
+
+// appendAddresses appends the addresses not yet in list
+func appendAddresses(list []string, addrs ...string) []string {
+	result := append([]string(nil), list...)
+	for _, addr := range addrs {
+		if !containsAddress(result, common.HexToAddress(addr)) {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// BundleMessage is the EIP-191 message an administrator signs for a bundle
+// encoding. It names the bundle so a hardware wallet shows what is signed.
+func BundleMessage(organization string, version uint64, encoded []byte) []byte {
+	return []byte(fmt.Sprintf("Policy bundle of %s\nVersion: %d\nSHA-256: %x", organization, version, sha256.Sum256(encoded)))
+}
+
+// EncodeBundle returns the encoding of a bundle that is signed and distributed
+func EncodeBundle(b *Bundle) ([]byte, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %v", err)
+	}
+	return encoded, nil
+}
+
+// LoadSignedBundle reads a signed bundle and checks that its signature was
+// made by the signer it names. Whether that signer is trusted is up to Verify.
+func LoadSignedBundle(path string) (*SignedBundle, *Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle: %v", err)
+	}
+	var signed SignedBundle
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse bundle: %v", err)
+	}
+	// The signature covers the compact encoding; the file may be indented
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, signed.Bundle); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse bundle contents: %v", err)
+	}
+	signed.Bundle = compact.Bytes()
+
+	var bundle Bundle
+	decoder := json.NewDecoder(bytes.NewReader(signed.Bundle))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse bundle contents: %v", err)
+	}
+	if err := bundle.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+
+	recovered, err := core.RecoverMessageSigner(BundleMessage(bundle.Organization, bundle.Version, signed.Bundle), signed.Signature, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle signature: %v", err)
+	}
+	if recovered != signed.Signer {
+		return nil, nil, fmt.Errorf("invalid bundle signature: signed by %s, not %s", recovered.Hex(), signed.Signer.Hex())
+	}
+	return &signed, &bundle, nil
+}
+
+// Hash returns the SHA-256 of the signed bundle encoding
+func (s *SignedBundle) Hash() string {
+	return fmt.Sprintf("%x", sha256.Sum256(s.Bundle))
+}
+
+// Verify checks that a bundle may replace the installed one: it is signed by
+// one of the trusted administrators, belongs to the same organization and has
+// a higher version
+func (s *BundleState) Verify(signed *SignedBundle, bundle *Bundle) error {
+	trusted := false
+	for _, admin := range s.Admins {
+		trusted = trusted || admin == signed.Signer
+	}
+	if !trusted {
+		return fmt.Errorf("%w: %s", ErrBundleUntrusted, signed.Signer.Hex())
+	}
+	if s.Organization != "" && s.Organization != bundle.Organization {
+		return fmt.Errorf("bundle is for %s, but this vault follows %s", bundle.Organization, s.Organization)
+	}
+	if bundle.Version <= s.Version {
+		return fmt.Errorf("%w: version %d, installed %d", ErrBundleNotNewer, bundle.Version, s.Version)
+	}
+	return nil
+}
+
+// Installed returns the state after installing a bundle
+func (s *BundleState) Installed(signed *SignedBundle, bundle *Bundle) *BundleState {
+	admins := s.Admins
+	if len(bundle.Admins) > 0 {
+		admins = bundle.Admins
+	}
+	return &BundleState{
+		Organization: bundle.Organization,
+		Version:      bundle.Version,
+		Hash:         signed.Hash(),
+		Signer:       signed.Signer,
+		Admins:       admins,
+		InstalledAt:  time.Now().UTC(),
+	}
+}
+
+// LoadBundleState reads the record of the installed bundle, or returns nil if
+// no bundle was installed yet
+func LoadBundleState(path string) (*BundleState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle state: %v", err)
+	}
+	var state BundleState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle state: %v", err)
+	}
+	return &state, nil
+}
+
+// SaveBundleState writes the record of the installed bundle
+func SaveBundleState(path string, state *BundleState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle state: %v", err)
+	}
+	return writeFile(path, data)
+}
+
+// Save writes a policy as JSON
+func Save(path string, p *Policy) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy: %v", err)
+	}
+	return writeFile(path, data)
+}
+
+// writeFile replaces a file through a temporary file in the same directory
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// ReadAddressList reads addresses one per line, ignoring blank lines and
+// # comments
+func ReadAddressList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read address list: %v", err)
+	}
+	defer f.Close()
+
+	var addrs []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if !common.IsHexAddress(text) {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, line, text)
+		}
+		addrs = append(addrs, common.HexToAddress(text).Hex())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read address list: %v", err)
+	}
+	return addrs, nil
+}
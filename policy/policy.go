@@ -0,0 +1,394 @@
+package policy
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultPolicyFile is the default location of the signing policy
+var DefaultPolicyFile = paths.Resolve("policy")
+
+const (
+	// AnyContract matches every destination in ContractCalls
+	AnyContract = "*"
+
+	// DefaultPhraseWords is the length of confirmation phrases
+	DefaultPhraseWords = 3
+	// maxPhraseWords bounds the phrase length a policy may ask for
+	maxPhraseWords = 12
+)
+
+// Destructive operations confirmed by typing a generated phrase
+const (
+	PhraseDeleteKey = "delete-key"
+	PhraseExportKey = "export-key"
+	PhraseOverride  = "override-policy"
+	PhraseSweep     = "sweep"
+	PhraseRetireKey = "retire-key"
+)
+
+// PhraseOperations lists the operations confirmed with a phrase
+var PhraseOperations = []string{PhraseDeleteKey, PhraseExportKey, PhraseOverride, PhraseSweep, PhraseRetireKey}
+
+// Policy describes the rules a transaction must satisfy before it is signed
+type Policy struct {
+	// AllowedDestinations, when non-empty, is the only set of addresses that may be sent to
+	AllowedDestinations []string `json:"allowedDestinations,omitempty"`
+	// AllowDeployments lets contract deployments pass a policy with
+	// AllowedDestinations or ContractCalls, whose constructors could otherwise
+	// do anything those rules forbid
+	AllowDeployments bool `json:"allowDeployments,omitempty"`
+	// DeniedDestinations are never allowed as a destination
+	DeniedDestinations []string `json:"deniedDestinations,omitempty"`
+	// AllowedChains, when non-empty, restricts signing to these chain IDs
+	AllowedChains []uint64 `json:"allowedChains,omitempty"`
+	// DailyLimits maps a key name to the maximum value it may send per 24 hours,
+	// in wei or with a unit such as "5 ether"
+	DailyLimits map[string]string `json:"dailyLimits,omitempty"`
+	// ContractCalls, when non-empty, maps contract addresses (or "*") to the
+	// 4-byte method selectors that may be called on them
+	ContractCalls map[string][]string `json:"contractCalls,omitempty"`
+	// RequireSimulation refuses transactions without a successful prior simulation
+	RequireSimulation bool `json:"requireSimulation,omitempty"`
+	// Duplicates configures the duplicate signing check
+	Duplicates *DuplicateRule `json:"duplicates,omitempty"`
+	// Approvals makes the signing daemon hold requests until approvers sign off
+	Approvals *ApprovalRule `json:"approvals,omitempty"`
+	// Confirmation configures the phrases typed to confirm destructive operations
+	Confirmation *ConfirmationRule `json:"confirmation,omitempty"`
+	// Signatures restricts the messages and typed data the daemon signs
+	Signatures *SignatureRule `json:"signatures,omitempty"`
+}
+
+// ConfirmationRule sets the length of the random phrase typed to confirm a
+// destructive operation, and the operations confirmed with y/N instead
+type ConfirmationRule struct {
+	Words  int      `json:"words,omitempty"`
+	Exempt []string `json:"exempt,omitempty"`
+}
+
+// DuplicateRule configures how recently signed identical transactions are handled
+type DuplicateRule struct {
+	Mode   string `json:"mode"`
+	Window string `json:"window"`
+}
+
+// ApprovalRule lists the approvers whose approval tokens release daemon
+// requests and how many distinct approvers are needed
+type ApprovalRule struct {
+	Approvers []string `json:"approvers"`
+	// Threshold is the number of approvals needed; 0 (unset) means 1
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// Required returns the number of approvals a request needs; zero when the
+// rule names no approvers
+func (r *ApprovalRule) Required() int {
+	if r == nil || len(r.Approvers) == 0 {
+		return 0
+	}
+	if r.Threshold <= 0 {
+		return 1
+	}
+	return r.Threshold
+}
+
+// IsApprover reports whether an address is in the approver set
+func (r *ApprovalRule) IsApprover(address common.Address) bool {
+	return r != nil && containsAddress(r.Approvers, address)
+}
+
+// Request is a transaction presented to the policy for evaluation
+type Request struct {
+	KeyName    string
+	To         *common.Address
+	Value      *big.Int
+	Data       []byte
+	ChainID    *big.Int
+	Simulated  bool
+	SpentToday *big.Int
+}
+
+// Violation describes a single rule a request failed
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// ErrPolicyDenied matches every ViolationError
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// ViolationError is returned when a request is refused for breaking rules
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("transaction violates %d policy rule(s)", len(e.Violations))
+}
+
+// Is matches ErrPolicyDenied
+func (e *ViolationError) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+// Load loads a policy from a JSON file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+
+	return &p, nil
+}
+
+// Validate checks that all addresses, limits and selectors in the policy are well-formed
+func (p *Policy) Validate() error {
+	for _, addr := range append(append([]string{}, p.AllowedDestinations...), p.DeniedDestinations...) {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+
+	for key, limit := range p.DailyLimits {
+		if _, err := core.ParseAmount(limit, core.RoundExact); err != nil {
+			return fmt.Errorf("invalid daily limit for key %s: %v", key, err)
+		}
+	}
+
+	for contract, selectors := range p.ContractCalls {
+		if contract != AnyContract && !common.IsHexAddress(contract) {
+			return fmt.Errorf("invalid contract address %q", contract)
+		}
+		for _, selector := range selectors {
+			if b, err := hex.DecodeString(strings.TrimPrefix(selector, "0x")); err != nil || len(b) != 4 {
+				return fmt.Errorf("invalid method selector %q", selector)
+			}
+		}
+	}
+
+	if p.Approvals != nil {
+		for _, addr := range p.Approvals.Approvers {
+			if !common.IsHexAddress(addr) {
+				return fmt.Errorf("invalid approver address %q", addr)
+			}
+		}
+		// An unset threshold is 0 and requires a single approval
+		if p.Approvals.Threshold < 0 || p.Approvals.Threshold > len(p.Approvals.Approvers) {
+			return fmt.Errorf("approval threshold %d must be between 1 and the %d approvers, or 0 for one approval", p.Approvals.Threshold, len(p.Approvals.Approvers))
+		}
+	}
+
+	if p.Signatures != nil {
+		for _, addr := range append(append([]string{}, p.Signatures.VerifyingContracts...), p.Signatures.Spenders...) {
+			if !common.IsHexAddress(addr) {
+				return fmt.Errorf("invalid signature rule address %q", addr)
+			}
+		}
+	}
+
+	if p.Duplicates != nil && p.Duplicates.Window != "" {
+		if _, err := time.ParseDuration(p.Duplicates.Window); err != nil {
+			return fmt.Errorf("invalid duplicate window %q", p.Duplicates.Window)
+		}
+	}
+
+	if p.Confirmation != nil {
+		if p.Confirmation.Words < 0 || p.Confirmation.Words > maxPhraseWords {
+			return fmt.Errorf("confirmation phrases must have 1 to %d words", maxPhraseWords)
+		}
+		for _, operation := range p.Confirmation.Exempt {
+			if !containsString(PhraseOperations, operation) {
+				return fmt.Errorf("unknown confirmation operation %q (expected one of %s)", operation, strings.Join(PhraseOperations, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// PhraseWords returns the length of the phrase that confirms an operation,
+// or zero if it is confirmed with y/N. Every operation of PhraseOperations
+// needs a phrase of DefaultPhraseWords unless the policy says otherwise.
+func (p *Policy) PhraseWords(operation string) int {
+	rule := p.Confirmation
+	if rule == nil {
+		return DefaultPhraseWords
+	}
+	if containsString(rule.Exempt, operation) {
+		return 0
+	}
+	if rule.Words == 0 {
+		return DefaultPhraseWords
+	}
+	return rule.Words
+}
+
+// DailyLimit returns the daily limit for a key, or nil if it has none
+func (p *Policy) DailyLimit(keyName string) *big.Int {
+	limit, ok := p.DailyLimits[keyName]
+	if !ok {
+		return nil
+	}
+	value, _ := core.ParseAmount(limit, core.RoundExact)
+	return value
+}
+
+// Evaluate checks a request against every rule and returns all violations
+func (p *Policy) Evaluate(req *Request) []Violation {
+	var violations []Violation
+
+	// Deployments have no destination for the lists to check
+	if req.To == nil && !p.AllowDeployments && (len(p.AllowedDestinations) > 0 || len(p.ContractCalls) > 0) {
+		violations = append(violations, Violation{
+			Rule:    "allowDeployments",
+			Message: "contract deployments are not allowed by a policy restricting destinations or contract calls",
+		})
+	}
+
+	// Destination allow/deny lists
+	if req.To != nil {
+		if containsAddress(p.DeniedDestinations, *req.To) {
+			violations = append(violations, Violation{
+				Rule:    "deniedDestinations",
+				Message: fmt.Sprintf("destination %s is denied", req.To.Hex()),
+			})
+		}
+		if len(p.AllowedDestinations) > 0 && !containsAddress(p.AllowedDestinations, *req.To) {
+			violations = append(violations, Violation{
+				Rule:    "allowedDestinations",
+				Message: fmt.Sprintf("destination %s is not in the allowlist", req.To.Hex()),
+			})
+		}
+	}
+
+	// Chain restrictions
+	if len(p.AllowedChains) > 0 && !p.chainAllowed(req.ChainID) {
+		violations = append(violations, Violation{
+			Rule:    "allowedChains",
+			Message: fmt.Sprintf("chain %v is not allowed", req.ChainID),
+		})
+	}
+
+	// Per-key daily value limit
+	if limit := p.DailyLimit(req.KeyName); limit != nil {
+		total := new(big.Int)
+		if req.SpentToday != nil {
+			total.Set(req.SpentToday)
+		}
+		if req.Value != nil {
+			total.Add(total, req.Value)
+		}
+		if total.Cmp(limit) > 0 {
+			violations = append(violations, Violation{
+				Rule:    "dailyLimits",
+				Message: fmt.Sprintf("key %s would send %s wei in 24h, limit is %s", req.KeyName, total, limit),
+			})
+		}
+	}
+
+	// Contract call allowlist by method selector; the data of a deployment
+	// is init code, not a call
+	if len(p.ContractCalls) > 0 && len(req.Data) > 0 && req.To != nil {
+		if !p.callAllowed(req.To, req.Data) {
+			violations = append(violations, Violation{
+				Rule:    "contractCalls",
+				Message: fmt.Sprintf("call data with selector 0x%x is not allowed for this destination", selector(req.Data)),
+			})
+		}
+	}
+
+	// Mandatory simulation
+	if p.RequireSimulation && !req.Simulated {
+		violations = append(violations, Violation{
+			Rule:    "requireSimulation",
+			Message: "transaction has not been successfully simulated",
+		})
+	}
+
+	return violations
+}
+
+// chainAllowed reports whether the chain ID is in the allowed list
+func (p *Policy) chainAllowed(chainID *big.Int) bool {
+	if chainID == nil || !chainID.IsUint64() {
+		return false
+	}
+	for _, id := range p.AllowedChains {
+		if id == chainID.Uint64() {
+			return true
+		}
+	}
+	return false
+}
+
+// callAllowed reports whether the call data's selector is allowed on the destination
+func (p *Policy) callAllowed(to *common.Address, data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	sel := fmt.Sprintf("0x%x", selector(data))
+
+	for contract, selectors := range p.ContractCalls {
+		if contract != AnyContract && (to == nil || !strings.EqualFold(contract, to.Hex())) {
+			continue
+		}
+		for _, allowed := range selectors {
+			if strings.EqualFold(allowed, sel) || strings.EqualFold("0x"+allowed, sel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selector returns the first four bytes of call data
+func selector(data []byte) []byte {
+	if len(data) < 4 {
+		return data
+	}
+	return data[:4]
+}
+
+// containsAddress reports whether addr is in the list (case-insensitive)
+func containsAddress(list []string, addr common.Address) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, addr.Hex()) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether value is in the list
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SignatureRule restricts the messages and typed data the signing daemon
+// signs. Typed data can move funds as well as transactions can: EIP-2612
+// permits and Permit2 approvals grant a spender tokens.
+type SignatureRule struct {
+	// Keys, when non-empty, are the only keys that may sign messages and typed data
+	Keys []string `json:"keys,omitempty"`
+	// DenyMessages refuses personal messages, whose meaning cannot be checked
+	DenyMessages bool `json:"denyMessages,omitempty"`
+	// VerifyingContracts, when non-empty, are the only EIP-712 domains that
+	// typed data may be signed for
+	VerifyingContracts []string `json:"verifyingContracts,omitempty"`
+	// Spenders, when non-empty, are the only addresses typed data may name
+	// as spender
+	Spenders []string `json:"spenders,omitempty"`
+}
+
+// SignatureRequest is a message or typed data presented to the policy
+type SignatureRequest struct {
+	KeyName string
+	// Typed is set for EIP-712 typed data; the fields below are only
+	// filled in for it
+	Typed             bool
+	ChainID           *big.Int
+	VerifyingContract *common.Address
+	// Spenders are the addresses of every spender field of the message
+	Spenders []common.Address
+}
+
+// NewTypedDataRequest describes typed data for EvaluateSignature
+func NewTypedDataRequest(keyName string, data *core.TypedData) *SignatureRequest {
+	req := &SignatureRequest{KeyName: keyName, Typed: true}
+	if data.Domain.ChainId != nil {
+		req.ChainID = (*big.Int)(data.Domain.ChainId)
+	}
+	if common.IsHexAddress(data.Domain.VerifyingContract) {
+		contract := common.HexToAddress(data.Domain.VerifyingContract)
+		req.VerifyingContract = &contract
+	}
+	seen := make(map[common.Address]bool)
+	collectSpenders(data.Message, seen)
+	for spender := range seen {
+		req.Spenders = append(req.Spenders, spender)
+	}
+	sort.Slice(req.Spenders, func(i, j int) bool {
+		return req.Spenders[i].Hex() < req.Spenders[j].Hex()
+	})
+	return req
+}
+
+// collectSpenders finds the spender fields of a message at any depth, such
+// as the spender of a Permit2 PermitBatch
+func collectSpenders(value interface{}, spenders map[common.Address]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if address, ok := field.(string); ok && strings.EqualFold(name, "spender") && common.IsHexAddress(address) {
+				spenders[common.HexToAddress(address)] = true
+				continue
+			}
+			collectSpenders(field, spenders)
+		}
+	case []interface{}:
+		for _, item := range value {
+			collectSpenders(item, spenders)
+		}
+	}
+}
+
+// EvaluateSignature checks a message or typed data request against the key,
+// chain, destination and signature rules and returns all violations
+func (p *Policy) EvaluateSignature(req *SignatureRequest) []Violation {
+	var violations []Violation
+	rule := p.Signatures
+	if rule == nil {
+		rule = &SignatureRule{}
+	}
+
+	if len(rule.Keys) > 0 && !containsString(rule.Keys, req.KeyName) {
+		violations = append(violations, Violation{
+			Rule:    "signatures.keys",
+			Message: fmt.Sprintf("key %s may not sign messages or typed data", req.KeyName),
+		})
+	}
+	if !req.Typed {
+		if rule.DenyMessages {
+			violations = append(violations, Violation{
+				Rule:    "signatures.denyMessages",
+				Message: "personal messages are not signed",
+			})
+		}
+		return violations
+	}
+
+	// Typed data without a chain ID is valid on every chain, so it is refused
+	// when chains are restricted
+	if len(p.AllowedChains) > 0 && !p.chainAllowed(req.ChainID) {
+		violations = append(violations, Violation{
+			Rule:    "allowedChains",
+			Message: fmt.Sprintf("typed data for chain %v is not allowed", req.ChainID),
+		})
+	}
+
+	if req.VerifyingContract != nil && containsAddress(p.DeniedDestinations, *req.VerifyingContract) {
+		violations = append(violations, Violation{
+			Rule:    "deniedDestinations",
+			Message: fmt.Sprintf("verifying contract %s is denied", req.VerifyingContract.Hex()),
+		})
+	}
+	if len(rule.VerifyingContracts) > 0 && (req.VerifyingContract == nil || !containsAddress(rule.VerifyingContracts, *req.VerifyingContract)) {
+		contract := "none"
+		if req.VerifyingContract != nil {
+			contract = req.VerifyingContract.Hex()
+		}
+		violations = append(violations, Violation{
+			Rule:    "signatures.verifyingContracts",
+			Message: fmt.Sprintf("verifying contract %s is not in the allowlist", contract),
+		})
+	}
+
+	for _, spender := range req.Spenders {
+		if containsAddress(p.DeniedDestinations, spender) {
+			violations = append(violations, Violation{
+				Rule:    "deniedDestinations",
+				Message: fmt.Sprintf("spender %s is denied", spender.Hex()),
+			})
+		}
+		if len(rule.Spenders) > 0 && !containsAddress(rule.Spenders, spender) {
+			violations = append(violations, Violation{
+				Rule:    "signatures.spenders",
+				Message: fmt.Sprintf("spender %s is not in the allowlist", spender.Hex()),
+			})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,387 @@
+// Package qr encodes payloads as QR codes and UR-style multi-part fragments
+// for moving transactions across an air gap.
+package qr
+
+import (
+	"fmt"
+)
+
+// Code is an encoded QR symbol. Modules[y][x] is true for dark modules.
+type Code struct {
+	Version int
+	Size    int
+	Modules [][]bool
+}
+
+// versionInfo describes the error correction block layout of a version at level L
+type versionInfo struct {
+	ecPerBlock int
+	groups     [][2]int // {number of blocks, data codewords per block}
+	alignment  []int
+}
+
+// versions holds the level L block structure for versions 1-10
+var versions = []versionInfo{
+	{7, [][2]int{{1, 19}}, nil},
+	{10, [][2]int{{1, 34}}, []int{6, 18}},
+	{15, [][2]int{{1, 55}}, []int{6, 22}},
+	{20, [][2]int{{1, 80}}, []int{6, 26}},
+	{26, [][2]int{{1, 108}}, []int{6, 30}},
+	{18, [][2]int{{2, 68}}, []int{6, 34}},
+	{20, [][2]int{{2, 78}}, []int{6, 22, 38}},
+	{24, [][2]int{{2, 97}}, []int{6, 24, 42}},
+	{30, [][2]int{{2, 116}}, []int{6, 26, 46}},
+	{18, [][2]int{{2, 68}, {2, 69}}, []int{6, 28, 50}},
+}
+
+// MaxBytes is the largest payload that fits in the biggest supported version
+var MaxBytes = capacity(len(versions))
+
+// capacity returns the number of payload bytes a version holds in byte mode
+func capacity(version int) int {
+	info := versions[version-1]
+	dataBits := 8 * dataCodewords(info)
+	return (dataBits - 4 - countBits(version)) / 8
+}
+
+// dataCodewords returns the total number of data codewords of a version
+func dataCodewords(info versionInfo) int {
+	total := 0
+	for _, g := range info.groups {
+		total += g[0] * g[1]
+	}
+	return total
+}
+
+// countBits returns the length of the byte mode character count field
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// Encode encodes data as a QR code in byte mode with error correction level L,
+// using the smallest version that fits
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= len(versions); v++ {
+		if len(data) <= capacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("payload of %d bytes exceeds QR capacity of %d bytes", len(data), MaxBytes)
+	}
+
+	info := versions[version-1]
+	codewords := addErrorCorrection(encodeData(data, version, info), info)
+
+	code := newCode(version)
+	code.drawFunctionPatterns(info)
+	code.drawCodewords(codewords)
+	code.applyMask()
+	code.drawFormat(0)
+	return &code.Code, nil
+}
+
+// encodeData builds the padded data codeword sequence
+func encodeData(data []byte, version int, info versionInfo) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4) // byte mode
+	bits.append(uint32(len(data)), countBits(version))
+	for _, b := range data {
+		bits.append(uint32(b), 8)
+	}
+
+	capacityBits := 8 * dataCodewords(info)
+
+	// Terminator and byte alignment
+	terminator := capacityBits - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+
+	// Pad bytes
+	for pad := uint32(0xEC); len(bits) < capacityBits; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	return bits.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends Reed-Solomon codewords
+// and interleaves the result
+func addErrorCorrection(data []byte, info versionInfo) []byte {
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for _, g := range info.groups {
+		for i := 0; i < g[0]; i++ {
+			block := data[offset : offset+g[1]]
+			offset += g[1]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, reedSolomon(block, info.ecPerBlock))
+		}
+	}
+
+	var result []byte
+	for i := 0; ; i++ {
+		added := false
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, ec := range ecBlocks {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// builder tracks which modules are function patterns while drawing a code
+type builder struct {
+	Code
+	function [][]bool
+}
+
+func newCode(version int) *builder {
+	size := 17 + 4*version
+	b := &builder{
+		Code: Code{
+			Version: version,
+			Size:    size,
+			Modules: make([][]bool, size),
+		},
+		function: make([][]bool, size),
+	}
+	for i := range b.Modules {
+		b.Modules[i] = make([]bool, size)
+		b.function[i] = make([]bool, size)
+	}
+	return b
+}
+
+// set sets a function module at column x, row y
+func (b *builder) set(x, y int, dark bool) {
+	b.Modules[y][x] = dark
+	b.function[y][x] = true
+}
+
+// drawFunctionPatterns draws finder, timing, alignment and version patterns
+// and reserves the format information area
+func (b *builder) drawFunctionPatterns(info versionInfo) {
+	// Timing patterns
+	for i := 0; i < b.Size; i++ {
+		b.set(6, i, i%2 == 0)
+		b.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with separators
+	b.drawFinder(3, 3)
+	b.drawFinder(b.Size-4, 3)
+	b.drawFinder(3, b.Size-4)
+
+	// Alignment patterns, skipping the three finder corners
+	n := len(info.alignment)
+	for i, x := range info.alignment {
+		for j, y := range info.alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			b.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve format bits, they are drawn after masking
+	b.drawFormat(0)
+
+	// Version information for versions 7 and up
+	if b.Version >= 7 {
+		rem := b.Version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := b.Version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			x, y := b.Size-11+i%3, i/3
+			b.set(x, y, dark)
+			b.set(y, x, dark)
+		}
+	}
+}
+
+func (b *builder) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= b.Size || y < 0 || y >= b.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			b.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (b *builder) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			b.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws the format information for level L and the given mask
+func (b *builder) drawFormat(mask int) {
+	data := 1<<3 | mask // level L
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// First copy around the top-left finder
+	for i := 0; i <= 5; i++ {
+		b.set(8, i, bit(i))
+	}
+	b.set(8, 7, bit(6))
+	b.set(8, 8, bit(7))
+	b.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		b.set(14-i, 8, bit(i))
+	}
+
+	// Second copy split between the other two finders
+	for i := 0; i < 8; i++ {
+		b.set(b.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		b.set(8, b.Size-15+i, bit(i))
+	}
+	b.set(8, b.Size-8, true) // dark module
+}
+
+// drawCodewords places data in the zigzag pattern over non-function modules
+func (b *builder) drawCodewords(data []byte) {
+	i := 0
+	for right := b.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < b.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = b.Size - 1 - vert
+				}
+				if !b.function[y][x] && i < len(data)*8 {
+					b.Modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask applies mask pattern 0 ((x + y) mod 2 == 0) to non-function modules
+func (b *builder) applyMask() {
+	for y := 0; y < b.Size; y++ {
+		for x := 0; x < b.Size; x++ {
+			if !b.function[y][x] && (x+y)%2 == 0 {
+				b.Modules[y][x] = !b.Modules[y][x]
+			}
+		}
+	}
+}
+
+// bitBuffer is a sequence of bits, most significant first
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>uint(i))&1 != 0)
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	result := make([]byte, (len(bb)+7)/8)
+	for i, bit := range bb {
+		if bit {
+			result[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return result
+}
+
+// Galois field tables for GF(256) with the QR polynomial 0x11D
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// reedSolomon returns the error correction codewords for a data block
+func reedSolomon(data []byte, degree int) []byte {
+	// Generator polynomial, highest degree first
+	gen := []byte{1}
+	for i := 0; i < degree; i++ {
+		next := make([]byte, len(gen)+1)
+		for j, coef := range gen {
+			next[j] ^= coef
+			next[j+1] ^= gfMul(coef, gfExp[i])
+		}
+		gen = next
+	}
+
+	remainder := make([]byte, len(data)+degree)
+	copy(remainder, data)
+	for i := range data {
+		coef := remainder[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(gen); j++ {
+			remainder[i+j] ^= gfMul(gen[j], coef)
+		}
+	}
+	return remainder[len(data):]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,26 @@
+package qr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SVG draws a QR code as a scalable SVG image for printing, with each module
+// scale units wide and a quiet zone of four modules as the standard requires
+func SVG(code *Code, scale int) string {
+	const border = 4
+	size := (code.Size + 2*border) * scale
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, size, size)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y, row := range code.Modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&sb, "M%d %dh%dv%dh-%dz", (x+border)*scale, (y+border)*scale, scale, scale, scale)
+			}
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+package qr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// quietZone is the light border around a rendered code, in modules
+	quietZone = 2
+
+	// DefaultFragmentLen keeps each UR part small enough for a version 10 code
+	// that terminals and phone cameras handle reliably
+	DefaultFragmentLen = 100
+)
+
+// Render draws a QR code using half-block characters, two module rows per
+// text line, in black on white so it scans on both light and dark terminals
+func Render(code *Code) string {
+	dark := func(x, y int) bool {
+		x, y = x-quietZone, y-quietZone
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return false
+		}
+		return code.Modules[y][x]
+	}
+
+	var sb strings.Builder
+	size := code.Size + 2*quietZone
+	for y := 0; y < size; y += 2 {
+		sb.WriteString("\x1b[30;47m")
+		for x := 0; x < size; x++ {
+			top, bottom := dark(x, y), dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	return sb.String()
+}
+
+// Display renders UR parts to w. A single part is drawn once; multiple parts
+// are cycled as an animated QR code until ctx is cancelled.
+func Display(ctx context.Context, w io.Writer, parts []string, interval time.Duration) error {
+	frames := make([]string, 0, len(parts))
+	for _, part := range parts {
+		// Uppercase keeps the content in a form scanners commonly expect for UR
+		code, err := Encode([]byte(strings.ToUpper(part)))
+		if err != nil {
+			return err
+		}
+		frames = append(frames, Render(code))
+	}
+
+	if len(frames) == 1 {
+		_, err := fmt.Fprint(w, frames[0])
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := 0; ; i = (i + 1) % len(frames) {
+		// Clear the screen and redraw from the top-left corner
+		if _, err := fmt.Fprintf(w, "\x1b[H\x1b[2J%sPart %d of %d (Ctrl-C to stop)\n", frames[i], i+1, len(frames)); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// bytewords is the Bytewords alphabet used by the UR format (BCR-2020-012)
+var bytewords = strings.Fields(`
+able acid also apex aqua arch atom aunt away axis back bald barn belt beta bias
+blue body brag brew bulb buzz calm cash cats chef city claw code cola cook cost
+crux curl cusp cyan dark data days deli dice diet door down draw drop drum dull
+duty each easy echo edge epic even exam exit eyes fact fair fern figs film fish
+fizz flap flew flux foxy free frog fuel fund gala game gear gems gift girl glow
+good gray grim guru gush gyro half hang hard hawk heat help high hill holy hope
+horn huts iced idea idle inch inky into iris iron item jade jazz join jolt jowl
+judo jugs jump junk jury keep keno kept keys kick kiln king kite kiwi knob lamb
+lava lazy leaf legs liar limp lion list logo loud love luau luck lung main many
+math maze memo menu meow mild mint miss monk nail navy need news next noon note
+numb obey oboe omit onyx open oval owls paid part peck play plus poem pool pose
+puff puma purr quad quiz race ramp real redo rich road rock roof ruby ruin runs
+rust safe saga scar sets silk skew slot soap solo song stub surf swan taco task
+taxi tent tied time tiny toil tomb toys trip tuna twin ugly undo unit urge user
+vast very veto vial vibe view visa void vows wall wand warm wasp wave waxy webs
+what when whiz wolf work yank yawn yell yoga yurt zaps zero zest zinc zone zoom`)
+
+// minimalIndex maps the first and last letter of each byteword to its value
+var minimalIndex = func() map[string]byte {
+	index := make(map[string]byte, len(bytewords))
+	for i, word := range bytewords {
+		index[word[:1]+word[3:]] = byte(i)
+	}
+	return index
+}()
+
+// encodeBytewords encodes data plus its CRC32 checksum in minimal Bytewords form
+func encodeBytewords(data []byte) string {
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(data))
+
+	var sb strings.Builder
+	for _, b := range append(append([]byte(nil), data...), checksum...) {
+		word := bytewords[b]
+		sb.WriteByte(word[0])
+		sb.WriteByte(word[3])
+	}
+	return sb.String()
+}
+
+// decodeBytewords decodes minimal Bytewords and verifies the trailing checksum
+func decodeBytewords(s string) ([]byte, error) {
+	s = strings.ToLower(s)
+	if len(s)%2 != 0 || len(s) < 8 {
+		return nil, errors.New("invalid bytewords length")
+	}
+
+	decoded := make([]byte, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		b, ok := minimalIndex[s[i:i+2]]
+		if !ok {
+			return nil, fmt.Errorf("invalid byteword %q", s[i:i+2])
+		}
+		decoded = append(decoded, b)
+	}
+
+	data, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	if binary.BigEndian.Uint32(checksum) != crc32.ChecksumIEEE(data) {
+		return nil, errors.New("bytewords checksum mismatch")
+	}
+	return data, nil
+}
+
+// partHeaderLen is the length of the header that opens every part of a
+// multi-part payload: the CRC32 checksum and the length of the whole payload
+const partHeaderLen = 8
+
+// EncodeUR splits a payload into UR-style parts of at most fragmentLen payload
+// bytes each: "ur:<type>/<bytewords>" for a single part or
+// "ur:<type>/<seq>-<total>/<bytewords>" for multi-part payloads. Parts are sent
+// sequentially (without fountain coding), each with its own CRC32 checksum.
+// Each part of a multi-part payload also names the checksum and length of the
+// whole payload, so parts of different payloads are never combined. The parts
+// use the UR syntax and Bytewords but not its CBOR and fountain encoding, so
+// they are only read by this tool, not by EIP-4527 wallets.
+func EncodeUR(urType string, payload []byte, fragmentLen int) ([]string, error) {
+	if fragmentLen <= 0 {
+		return nil, errors.New("fragment length must be positive")
+	}
+	if len(payload) <= fragmentLen {
+		return []string{fmt.Sprintf("ur:%s/%s", urType, encodeBytewords(payload))}, nil
+	}
+
+	header := make([]byte, partHeaderLen)
+	binary.BigEndian.PutUint32(header, crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+
+	total := (len(payload) + fragmentLen - 1) / fragmentLen
+	parts := make([]string, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*fragmentLen, len(payload))
+		fragment := append(append([]byte(nil), header...), payload[i*fragmentLen:end]...)
+		parts = append(parts, fmt.Sprintf("ur:%s/%d-%d/%s", urType, i+1, total, encodeBytewords(fragment)))
+	}
+	return parts, nil
+}
+
+// Decoder reassembles a payload from UR parts received in any order
+type Decoder struct {
+	urType string
+	total  int
+	// header is the checksum and length of the payload the first part named
+	header    []byte
+	fragments map[int][]byte
+}
+
+// NewDecoder creates a decoder that accepts parts of the given UR type
+func NewDecoder(urType string) *Decoder {
+	return &Decoder{
+		urType:    urType,
+		fragments: make(map[int][]byte),
+	}
+}
+
+// Receive processes a single scanned part. Repeated parts are ignored; parts
+// of another payload and a part that differs from an earlier one with the
+// same sequence number are rejected.
+func (d *Decoder) Receive(part string) error {
+	part = strings.ToLower(strings.TrimSpace(part))
+	if !strings.HasPrefix(part, "ur:") {
+		return errors.New("not a UR part")
+	}
+
+	components := strings.Split(strings.TrimPrefix(part, "ur:"), "/")
+	if components[0] != d.urType {
+		return fmt.Errorf("unexpected UR type %q, expected %q", components[0], d.urType)
+	}
+
+	seq, total := 1, 1
+	switch len(components) {
+	case 2:
+	case 3:
+		var err error
+		seq, total, err = parseSequence(components[1])
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("malformed UR part")
+	}
+
+	if d.total != 0 && d.total != total {
+		return fmt.Errorf("part belongs to a %d-part payload, expected %d parts", total, d.total)
+	}
+
+	fragment, err := decodeBytewords(components[len(components)-1])
+	if err != nil {
+		return fmt.Errorf("part %d: %v", seq, err)
+	}
+
+	// Every part of a multi-part payload names the payload it belongs to
+	var header []byte
+	if len(components) == 3 {
+		if len(fragment) <= partHeaderLen {
+			return fmt.Errorf("part %d: too short", seq)
+		}
+		header, fragment = fragment[:partHeaderLen], fragment[partHeaderLen:]
+		if d.header != nil && !bytes.Equal(header, d.header) {
+			return fmt.Errorf("part %d belongs to another payload", seq)
+		}
+	}
+	if existing, ok := d.fragments[seq]; ok {
+		if !bytes.Equal(existing, fragment) {
+			return fmt.Errorf("part %d differs from the part %d received before", seq, seq)
+		}
+		return nil
+	}
+
+	d.total = total
+	d.header = header
+	d.fragments[seq] = fragment
+	return nil
+}
+
+// parseSequence parses a "<seq>-<total>" component
+func parseSequence(s string) (int, int, error) {
+	seqStr, totalStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed sequence %q", s)
+	}
+	seq, err := strconv.Atoi(seqStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed sequence %q", s)
+	}
+	total, err := strconv.Atoi(totalStr)
+	if err != nil || total < 1 || seq < 1 || seq > total {
+		return 0, 0, fmt.Errorf("malformed sequence %q", s)
+	}
+	return seq, total, nil
+}
+
+// Progress returns the number of distinct parts received and the total expected
+func (d *Decoder) Progress() (int, int) {
+	return len(d.fragments), d.total
+}
+
+// Complete reports whether every part has been received
+func (d *Decoder) Complete() bool {
+	return d.total > 0 && len(d.fragments) == d.total
+}
+
+// Result returns the reassembled payload
+func (d *Decoder) Result() ([]byte, error) {
+	if !d.Complete() {
+		received, total := d.Progress()
+		return nil, fmt.Errorf("payload incomplete: %d of %d parts received", received, total)
+	}
+
+	var payload []byte
+	for i := 1; i <= d.total; i++ {
+		payload = append(payload, d.fragments[i]...)
+	}
+	if d.header != nil {
+		if uint32(len(payload)) != binary.BigEndian.Uint32(d.header[4:]) ||
+			crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(d.header) {
+			return nil, errors.New("reassembled payload does not match the checksum of its parts")
+		}
+	}
+	return payload, nil
+}
@@ -0,0 +1,227 @@
+// Package secrets resolves references to secrets kept outside configuration
+// files, so chains, schedules and flags can name an API key or token without
+// containing it. A reference is a whole value of the form
+//
+//	env:NAME                  environment variable NAME
+//	file:PATH                 contents of a file, without surrounding whitespace
+//	keyring:SERVICE/ACCOUNT   password in the OS keyring
+//	vault:MOUNT/PATH#FIELD    field of a HashiCorp Vault KV version 2 secret
+//	local:NAME                secret NAME of the local secrets store
+//
+// or is embedded in a value as ${env:NAME}, ${file:PATH} and so on. $NAME and
+// ${NAME} are read from the environment.
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultVaultField is the field read from a Vault secret when a reference names none
+const DefaultVaultField = "value"
+
+// schemes are the kinds of references and their resolvers
+var schemes = map[string]func(ref string) (string, error){
+	"env":     resolveEnv,
+	"file":    resolveFile,
+	"keyring": resolveKeyring,
+	"vault":   resolveVault,
+	"local":   resolveLocal,
+}
+
+// HTTPClient returns the client used to reach Vault at an address. It is
+// replaced to honor the configured proxies and offline mode.
+var HTTPClient = func(endpoint string) (*http.Client, error) {
+	return http.DefaultClient, nil
+}
+
+// resolved caches resolutions, so keyring prompts and Vault requests happen
+// once per reference and run
+var (
+	mu       sync.Mutex
+	resolved = make(map[string]result)
+)
+
+// result is a cached resolution
+type result struct {
+	value string
+	err   error
+}
+
+// IsReference reports whether a whole value is a secret reference
+func IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return false
+	}
+	_, known := schemes[scheme]
+	return known
+}
+
+// Resolve returns the secret a reference points to. Values that are not
+// references are returned unchanged.
+func Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	mu.Lock()
+	cached, ok := resolved[value]
+	mu.Unlock()
+	if ok {
+		return cached.value, cached.err
+	}
+
+	scheme, ref, _ := strings.Cut(value, ":")
+	secret, err := schemes[scheme](ref)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve %s: %v", value, err)
+	}
+
+	mu.Lock()
+	resolved[value] = result{secret, err}
+	mu.Unlock()
+	return secret, err
+}
+
+// Expand resolves a whole-value reference, or the references and environment
+// variables embedded in value. The first reference that cannot be resolved is
+// returned as the error.
+func Expand(value string) (string, error) {
+	if IsReference(value) {
+		return Resolve(value)
+	}
+
+	var firstErr error
+	expanded := os.Expand(value, func(key string) string {
+		if !IsReference(key) {
+			key = "env:" + key
+		}
+		secret, err := Resolve(key)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return secret
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return expanded, nil
+}
+
+// resolveEnv reads an environment variable
+func resolveEnv(name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return secret, nil
+}
+
+// resolveFile reads a file holding a single secret
+func resolveFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolveKeyring reads a password from the macOS keychain or, elsewhere, the
+// Secret Service through secret-tool
+func resolveKeyring(ref string) (string, error) {
+	service, account, ok := strings.Cut(ref, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("expected keyring:SERVICE/ACCOUNT")
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "windows":
+		return "", fmt.Errorf("the Windows credential manager is not supported")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %v: %s", cmd.Path, err, message)
+		}
+		return "", fmt.Errorf("%s: %v", cmd.Path, err)
+	}
+	secret := strings.TrimRight(string(output), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("no password stored for service %s and account %s", service, account)
+	}
+	return secret, nil
+}
+
+// resolveVault reads a field of a KV version 2 secret from the Vault server
+// at $VAULT_ADDR with $VAULT_TOKEN
+func resolveVault(ref string) (string, error) {
+	location, field, _ := strings.Cut(ref, "#")
+	if field == "" {
+		field = DefaultVaultField
+	}
+	mount, path, ok := strings.Cut(strings.Trim(location, "/"), "/")
+	if !ok || path == "" {
+		return "", fmt.Errorf("expected vault:MOUNT/PATH#FIELD")
+	}
+
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required")
+	}
+
+	client, err := HTTPClient(addr)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s/data/%s", addr, mount, path), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var response struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %v", err)
+	}
+	secret, ok := response.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no string field %s", mount, path, field)
+	}
+	return secret, nil
+}
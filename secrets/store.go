@@ -0,0 +1,379 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/paths"
+	"golang.org/x/crypto/argon2"
+)
+
+// EnvMasterPassword supplies the master password of the secrets store
+const EnvMasterPassword = "GOSIGNERVAULT_MASTER_PASSWORD"
+
+// StoreVersion is the version of the secrets store format written
+const StoreVersion = 1
+
+// Limits on the KDF parameters of a store, so a crafted file cannot exhaust
+// the memory of the machine opening it
+const (
+	maxStoreKDFTime   = 64
+	maxStoreKDFMemory = 4 * 1024 * 1024
+)
+
+// DefaultStoreFile is the default location of the local secrets store
+var DefaultStoreFile = filepath.Join(paths.DataDir(), "secrets.json")
+
+// MasterPassword returns the master password when a local: reference is
+// resolved. It reads $GOSIGNERVAULT_MASTER_PASSWORD and is replaced to prompt
+// for it interactively.
+var MasterPassword = func() (string, error) {
+	if password := os.Getenv(EnvMasterPassword); password != "" {
+		return password, nil
+	}
+	return "", fmt.Errorf("$%s is not set", EnvMasterPassword)
+}
+
+// ErrWrongMasterPassword is returned when the store does not open with the master password
+var ErrWrongMasterPassword = errors.New("wrong master password")
+
+// validName matches the names secrets may be stored under
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// storeCheck is sealed under the master key so a wrong password is detected
+// before anything is decrypted or written
+var storeCheck = []byte("gosignervault secrets store")
+
+// StoreKDF holds the Argon2id parameters the master key is derived with
+type StoreKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	// Memory is in KiB
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// defaultStoreKDF takes about a second on a current laptop
+var defaultStoreKDF = StoreKDF{Algorithm: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// StoredSecret is an encrypted secret. Its name is authenticated with the
+// ciphertext, so secrets cannot be swapped between names.
+type StoredSecret struct {
+	Nonce      []byte    `json:"nonce"`
+	CipherText []byte    `json:"ciphertext"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+}
+
+// SecretInfo describes a stored secret without its value
+type SecretInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// storeFile is the JSON layout of the store
+type storeFile struct {
+	Version int                      `json:"version"`
+	KDF     StoreKDF                 `json:"kdf"`
+	Check   *StoredSecret            `json:"check"`
+	Secrets map[string]*StoredSecret `json:"secrets"`
+}
+
+// Store is a file of small secrets such as API keys and tokens, encrypted
+// under a master password. Secret names are not encrypted.
+type Store struct {
+	path string
+}
+
+// OpenStore opens a secrets store file; it is created by the first Set
+func OpenStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Exists reports whether the store file has been created
+func (s *Store) Exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+// List returns the stored secrets by name, without decrypting them
+func (s *Store) List() ([]SecretInfo, error) {
+	file, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	infos := []SecretInfo{}
+	for name, secret := range file.Secrets {
+		infos = append(infos, SecretInfo{Name: name, Created: secret.Created, Updated: secret.Updated})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Get decrypts a secret with the master password
+func (s *Store) Get(name, password string) (string, error) {
+	file, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	if file.Check == nil {
+		return "", fmt.Errorf("no secret %s in %s", name, s.path)
+	}
+	aead, err := file.unlock(password)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := file.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("no secret %s in %s", name, s.path)
+	}
+	value, err := open(aead, secret, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s is corrupted: %v", name, err)
+	}
+	return string(value), nil
+}
+
+// Set encrypts and stores a secret, replacing one of the same name. The
+// first secret creates the store under the given master password.
+func (s *Store) Set(name, value, password string) error {
+	return s.SetMany(map[string]string{name: value}, password)
+}
+
+// SetMany stores several secrets at once, unlocking the store only once
+func (s *Store) SetMany(values map[string]string, password string) error {
+	for name := range values {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("invalid secret name %q (letters, digits, '.', '_', '/' and '-')", name)
+		}
+	}
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+	if file.Check == nil {
+		if password == "" {
+			return errors.New("master password is empty")
+		}
+		if err := file.init(password); err != nil {
+			return err
+		}
+	}
+	aead, err := file.unlock(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for name, value := range values {
+		secret, err := seal(aead, []byte(value), name)
+		if err != nil {
+			return err
+		}
+		secret.Created, secret.Updated = now, now
+		if previous, ok := file.Secrets[name]; ok {
+			secret.Created = previous.Created
+		}
+		file.Secrets[name] = secret
+	}
+	return s.write(file)
+}
+
+// Delete removes a secret
+func (s *Store) Delete(name string) error {
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Secrets[name]; !ok {
+		return fmt.Errorf("no secret %s in %s", name, s.path)
+	}
+	delete(file.Secrets, name)
+	return s.write(file)
+}
+
+// ChangePassword re-encrypts every secret under a new master password
+func (s *Store) ChangePassword(oldPassword, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("master password is empty")
+	}
+	file, err := s.read()
+	if err != nil {
+		return err
+	}
+	if file.Check == nil {
+		return fmt.Errorf("secrets store %s does not exist", s.path)
+	}
+	oldAEAD, err := file.unlock(oldPassword)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]byte, len(file.Secrets))
+	for name, secret := range file.Secrets {
+		if values[name], err = open(oldAEAD, secret, name); err != nil {
+			return fmt.Errorf("secret %s is corrupted: %v", name, err)
+		}
+	}
+	if err := file.init(newPassword); err != nil {
+		return err
+	}
+	newAEAD, err := file.unlock(newPassword)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		secret, err := seal(newAEAD, value, name)
+		if err != nil {
+			return err
+		}
+		secret.Created, secret.Updated = file.Secrets[name].Created, file.Secrets[name].Updated
+		file.Secrets[name] = secret
+	}
+	return s.write(file)
+}
+
+// read loads the store, returning an empty one if the file does not exist
+func (s *Store) read() (*storeFile, error) {
+	file := &storeFile{Version: StoreVersion, Secrets: make(map[string]*StoredSecret)}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets store: %v", err)
+	}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets store: %v", err)
+	}
+	if file.Version != StoreVersion {
+		return nil, fmt.Errorf("unsupported secrets store version %d", file.Version)
+	}
+	if file.Secrets == nil {
+		file.Secrets = make(map[string]*StoredSecret)
+	}
+	return file, nil
+}
+
+// write saves the store, replacing the file atomically
+func (s *Store) write(file *storeFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets store: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets store directory: %v", err)
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets store: %v", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write secrets store: %v", err)
+	}
+	return nil
+}
+
+// init picks a fresh salt and seals the password check under a new master password
+func (f *storeFile) init(password string) error {
+	f.KDF = defaultStoreKDF
+	f.KDF.Salt = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, f.KDF.Salt); err != nil {
+		return err
+	}
+	aead, err := f.KDF.cipher(password)
+	if err != nil {
+		return err
+	}
+	f.Check, err = seal(aead, storeCheck, "")
+	return err
+}
+
+// unlock derives the master key and checks it against the sealed check value
+func (f *storeFile) unlock(password string) (cipher.AEAD, error) {
+	aead, err := f.KDF.cipher(password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := open(aead, f.Check, ""); err != nil {
+		return nil, ErrWrongMasterPassword
+	}
+	return aead, nil
+}
+
+// cipher derives the AES-256-GCM master key from a password with Argon2id
+func (k StoreKDF) cipher(password string) (cipher.AEAD, error) {
+	if k.Algorithm != "argon2id" {
+		return nil, fmt.Errorf("unsupported secrets store KDF %q", k.Algorithm)
+	}
+	if len(k.Salt) < 16 || k.Time == 0 || k.Time > maxStoreKDFTime || k.Threads == 0 ||
+		k.Memory < 8*uint32(k.Threads) || k.Memory > maxStoreKDFMemory {
+		return nil, fmt.Errorf("secrets store KDF parameters out of range (time %d, memory %d KiB, threads %d)", k.Time, k.Memory, k.Threads)
+	}
+	block, err := aes.NewCipher(argon2.IDKey([]byte(password), k.Salt, k.Time, k.Memory, k.Threads, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts a value bound to its name
+func seal(aead cipher.AEAD, value []byte, name string) (*StoredSecret, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &StoredSecret{Nonce: nonce, CipherText: aead.Seal(nil, nonce, value, []byte(name))}, nil
+}
+
+// open decrypts a value sealed under its name
+func open(aead cipher.AEAD, secret *StoredSecret, name string) ([]byte, error) {
+	if secret == nil || len(secret.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	return aead.Open(nil, secret.Nonce, secret.CipherText, []byte(name))
+}
+
+// unlocked holds the master password once it opened the store, so it is
+// asked for once per run however many local: references there are
+var unlocked struct {
+	sync.Mutex
+	password string
+}
+
+// resolveLocal reads a secret from the local secrets store
+func resolveLocal(name string) (string, error) {
+	store := OpenStore(DefaultStoreFile)
+	if !store.Exists() {
+		return "", fmt.Errorf("secrets store %s does not exist; add secrets with 'secrets set'", DefaultStoreFile)
+	}
+
+	unlocked.Lock()
+	defer unlocked.Unlock()
+	password := unlocked.password
+	if password == "" {
+		var err error
+		if password, err = MasterPassword(); err != nil {
+			return "", err
+		}
+	}
+	secret, err := store.Get(name, password)
+	if !errors.Is(err, ErrWrongMasterPassword) {
+		unlocked.password = password
+	}
+	return secret, err
+}
@@ -0,0 +1,14 @@
+package securemem
+
+import "syscall"
+
+// setUndumpable clears the dumpable flag, which also keeps other processes
+// of the user from attaching with ptrace and reading memory
+func setUndumpable() (func(), error) {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0); errno != 0 {
+		return nil, errno
+	}
+	return func() {
+		syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 1, 0)
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package securemem
+
+// memoryLocking reports whether lockedBuffer keeps keys out of swap
+const memoryLocking = false
+
+// lockedBuffer allocates key memory; this platform cannot lock it
+func lockedBuffer(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+// releaseBuffer wipes a buffer from lockedBuffer
+func releaseBuffer(buf []byte) {
+	Wipe(buf)
+}
+
+// disableCoreDumps does nothing; this platform has no core dump limit
+func disableCoreDumps() (func(), error) {
+	return func() {}, nil
+}
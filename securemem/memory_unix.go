@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd
+
+package securemem
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// memoryLocking reports whether lockedBuffer keeps keys out of swap
+const memoryLocking = true
+
+// lockedBuffer allocates memory outside the Go heap and locks it against
+// being swapped to disk
+func lockedBuffer(size int) ([]byte, error) {
+	buf, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate key memory: %v", err)
+	}
+	if err := syscall.Mlock(buf); err != nil {
+		syscall.Munmap(buf)
+		return nil, fmt.Errorf("failed to lock key memory: %v", err)
+	}
+	return buf, nil
+}
+
+// releaseBuffer wipes and frees a buffer from lockedBuffer
+func releaseBuffer(buf []byte) {
+	Wipe(buf)
+	syscall.Munlock(buf)
+	syscall.Munmap(buf)
+}
+
+// disableCoreDumps sets the core file size limit to zero, returning a
+// function that restores the previous limit
+func disableCoreDumps() (func(), error) {
+	var previous syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &previous); err != nil {
+		return nil, err
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: previous.Max}); err != nil {
+		return nil, err
+	}
+	restoreDumpable, err := setUndumpable()
+	if err != nil {
+		syscall.Setrlimit(syscall.RLIMIT_CORE, &previous)
+		return nil, err
+	}
+	return func() {
+		restoreDumpable()
+		syscall.Setrlimit(syscall.RLIMIT_CORE, &previous)
+	}, nil
+}
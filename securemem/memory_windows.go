@@ -0,0 +1,34 @@
+//go:build windows
+
+package securemem
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// memoryLocking reports whether lockedBuffer keeps keys out of swap
+const memoryLocking = true
+
+// lockedBuffer allocates memory and locks it into the working set so it is
+// not paged to disk. The Go heap does not move allocations.
+func lockedBuffer(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if err := syscall.VirtualLock(uintptr(unsafe.Pointer(&buf[0])), uintptr(size)); err != nil {
+		return nil, fmt.Errorf("failed to lock key memory: %v", err)
+	}
+	return buf, nil
+}
+
+// releaseBuffer wipes and unlocks a buffer from lockedBuffer
+func releaseBuffer(buf []byte) {
+	Wipe(buf)
+	syscall.VirtualUnlock(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+}
+
+// disableCoreDumps does nothing; Windows writes no core files, and crash
+// dumps are configured system-wide through Windows Error Reporting
+func disableCoreDumps() (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,188 @@
+// Package securemem keeps key material in memory that is locked against being
+// swapped to disk and wiped as soon as it is no longer needed
+package securemem
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	mu sync.Mutex
+	// live holds every buffer not destroyed yet, for DestroyAll
+	live = make(map[*Buffer]struct{})
+	// noCoreDumps disables core dumps while a buffer is live
+	noCoreDumps  bool
+	restoreDumps func()
+)
+
+// ErrDestroyed is returned when a destroyed key is used
+var ErrDestroyed = errors.New("key material has been wiped")
+
+// Locked reports whether buffers are locked against swapping on this platform
+func Locked() bool {
+	return memoryLocking
+}
+
+// ProtectCoreDumps disables core dumps, and on Linux ptrace attachment by
+// other processes of the user, whenever key material is held. They are
+// restored once every buffer is destroyed.
+func ProtectCoreDumps(enable bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	noCoreDumps = enable
+}
+
+// Wipe zeroes a byte slice holding secret data
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// WipeKey zeroes the secret scalar of a private key in place. The key is
+// unusable afterwards.
+func WipeKey(key *ecdsa.PrivateKey) {
+	if key == nil || key.D == nil {
+		return
+	}
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+	runtime.KeepAlive(words)
+}
+
+// Buffer is memory for key material outside the Go heap where the platform
+// allows it, locked against swapping and wiped when destroyed
+type Buffer struct {
+	data []byte
+}
+
+// Alloc allocates a locked buffer of size bytes
+func Alloc(size int) (*Buffer, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if noCoreDumps && len(live) == 0 {
+		restore, err := disableCoreDumps()
+		if err != nil {
+			return nil, fmt.Errorf("failed to disable core dumps: %v", err)
+		}
+		restoreDumps = restore
+	}
+	data, err := lockedBuffer(size)
+	if err != nil {
+		releaseDumps()
+		return nil, err
+	}
+	b := &Buffer{data: data}
+	live[b] = struct{}{}
+	return b, nil
+}
+
+// Bytes returns the memory of the buffer; nil once destroyed
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Destroy wipes and frees the buffer. Destroying it twice does nothing.
+func (b *Buffer) Destroy() {
+	mu.Lock()
+	defer mu.Unlock()
+	b.destroy()
+}
+
+// destroy wipes and frees the buffer; the caller holds mu
+func (b *Buffer) destroy() {
+	if b.data == nil {
+		return
+	}
+	releaseBuffer(b.data)
+	b.data = nil
+	delete(live, b)
+	releaseDumps()
+}
+
+// releaseDumps restores core dumps once no buffer is live; the caller holds mu
+func releaseDumps() {
+	if len(live) == 0 && restoreDumps != nil {
+		restoreDumps()
+		restoreDumps = nil
+	}
+}
+
+// DestroyAll wipes every buffer still live, e.g. before the process exits
+func DestroyAll() {
+	mu.Lock()
+	defer mu.Unlock()
+	for b := range live {
+		b.destroy()
+	}
+}
+
+// Key is a private key sealed in a locked buffer. The key only exists as an
+// *ecdsa.PrivateKey while it signs and is wiped right after.
+type Key struct {
+	mu      sync.Mutex
+	buf     *Buffer
+	address common.Address
+}
+
+// NewKey seals a private key in locked memory and wipes the original
+func NewKey(privateKey *ecdsa.PrivateKey) (*Key, error) {
+	buf, err := Alloc(32)
+	if err != nil {
+		return nil, err
+	}
+	privateKey.D.FillBytes(buf.Bytes())
+	key := &Key{buf: buf, address: crypto.PubkeyToAddress(privateKey.PublicKey)}
+	WipeKey(privateKey)
+	return key, nil
+}
+
+// Address returns the Ethereum address of the key
+func (k *Key) Address() common.Address {
+	return k.address
+}
+
+// Use passes the key to fn, wiping the copy fn received once it returns.
+// fn must not keep the key.
+func (k *Key) Use(fn func(privateKey *ecdsa.PrivateKey) error) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.buf.Bytes() == nil {
+		return ErrDestroyed
+	}
+	privateKey, err := crypto.ToECDSA(k.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	defer WipeKey(privateKey)
+	return fn(privateKey)
+}
+
+// SignHash returns a 65-byte [R || S || V] signature of a digest, V being 0 or 1
+func (k *Key) SignHash(hash []byte) ([]byte, error) {
+	var signature []byte
+	err := k.Use(func(privateKey *ecdsa.PrivateKey) error {
+		var err error
+		signature, err = crypto.Sign(hash, privateKey)
+		return err
+	})
+	return signature, err
+}
+
+// Destroy wipes the key
+func (k *Key) Destroy() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.buf.Destroy()
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ApprovalRequest is the export of a sign request held for approval. It
+// carries the full payload so an approver on another machine can check that
+// the payload hash and ID match what they review before signing the ID.
+type ApprovalRequest struct {
+	ID          common.Hash    `json:"id"`
+	Operation   string         `json:"operation"`
+	Key         string         `json:"key"`
+	Signer      common.Address `json:"signer"`
+	ChainID     *big.Int       `json:"chainId,omitempty"`
+	PayloadHash common.Hash    `json:"payloadHash"`
+	// Expiry is the unix time the request expires at
+	Expiry int64 `json:"expiry"`
+
+	// Transaction is the unsigned transaction in its binary encoding
+	Transaction hexutil.Bytes   `json:"transaction,omitempty"`
+	Message     hexutil.Bytes   `json:"message,omitempty"`
+	TypedData   json.RawMessage `json:"typedData,omitempty"`
+
+	Threshold int              `json:"threshold"`
+	Approvals []common.Address `json:"approvals"`
+	// RejectedBy is the approver who rejected the request, if any
+	RejectedBy *common.Address `json:"rejectedBy,omitempty"`
+}
+
+// ApprovalToken approves a held request. The approver signs the approval
+// message of the request ID as an EIP-191 personal message. With Reject set
+// the approver signs the rejection message instead, and the request is
+// refused at once.
+type ApprovalToken struct {
+	Request   common.Hash    `json:"request"`
+	Approver  common.Address `json:"approver"`
+	Signature hexutil.Bytes  `json:"signature"`
+	Reject    bool           `json:"reject,omitempty"`
+}
+
+// pendingApproval is a request waiting for approval tokens. approved is
+// closed once the request is approved or rejected.
+type pendingApproval struct {
+	request  *ApprovalRequest
+	approved chan struct{}
+}
+
+// ApprovalMessage returns the message an approver signs for a request
+func ApprovalMessage(id common.Hash) []byte {
+	return []byte("Approve GoSignerVault sign request " + id.Hex())
+}
+
+// RejectionMessage returns the message an approver signs to reject a request
+func RejectionMessage(id common.Hash) []byte {
+	return []byte("Reject GoSignerVault sign request " + id.Hex())
+}
+
+// approvalID commits to the operation, signer, payload and expiry of a request
+func approvalID(operation string, signer common.Address, payloadHash common.Hash, expiry int64) common.Hash {
+	var encodedExpiry [8]byte
+	binary.BigEndian.PutUint64(encodedExpiry[:], uint64(expiry))
+	return crypto.Keccak256Hash([]byte(operation), signer.Bytes(), payloadHash.Bytes(), encodedExpiry[:])
+}
+
+// UnsignedTransaction decodes the transaction of a transaction request
+func (r *ApprovalRequest) UnsignedTransaction() (*types.Transaction, error) {
+	var transaction types.Transaction
+	if err := transaction.UnmarshalBinary(r.Transaction); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %v", err)
+	}
+	return &transaction, nil
+}
+
+// ParsedTypedData decodes the typed data of a typed data request
+func (r *ApprovalRequest) ParsedTypedData() (*core.TypedData, error) {
+	return parseTypedData(r.TypedData)
+}
+
+// Verify recomputes the payload hash from the payload and the ID from the
+// request, so that what an approver reviews is what the ID commits to
+func (r *ApprovalRequest) Verify() error {
+	var payloadHash common.Hash
+	switch r.Operation {
+	case audit.OpSignTransaction:
+		if r.ChainID == nil {
+			return errors.New("transaction request has no chain ID")
+		}
+		transaction, err := r.UnsignedTransaction()
+		if err != nil {
+			return err
+		}
+		payloadHash = types.LatestSignerForChainID(r.ChainID).Hash(transaction)
+	case audit.OpSignMessage:
+		payloadHash = common.BytesToHash(accounts.TextHash(r.Message))
+	case audit.OpSignTypedData:
+		typedData, err := r.ParsedTypedData()
+		if err != nil {
+			return err
+		}
+		if payloadHash, err = typedData.Hash(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", r.Operation)
+	}
+
+	if payloadHash != r.PayloadHash {
+		return fmt.Errorf("payload hash %s does not match the payload (%s)", r.PayloadHash.Hex(), payloadHash.Hex())
+	}
+	if id := approvalID(r.Operation, r.Signer, r.PayloadHash, r.Expiry); id != r.ID {
+		return fmt.Errorf("request ID %s does not match the request (%s)", r.ID.Hex(), id.Hex())
+	}
+	return nil
+}
+
+// Message returns the message the token's approver signed
+func (t *ApprovalToken) Message() []byte {
+	if t.Reject {
+		return RejectionMessage(t.Request)
+	}
+	return ApprovalMessage(t.Request)
+}
+
+// Verify checks that the token was signed by its approver
+func (t *ApprovalToken) Verify() error {
+	signer, err := core.RecoverMessageSigner(t.Message(), t.Signature, false)
+	if err != nil {
+		return fmt.Errorf("invalid approval signature: %v", err)
+	}
+	if signer != t.Approver {
+		return fmt.Errorf("approval was signed by %s, not %s", signer.Hex(), t.Approver.Hex())
+	}
+	return nil
+}
+
+// approvalsRequired reports whether the policy holds requests for approval
+func (s *Server) approvalsRequired() bool {
+	return s.policy.Approvals.Required() > 0
+}
+
+// awaitApproval holds a request until enough approvers sent tokens for it or
+// it expires, returning the approvers
+func (s *Server) awaitApproval(request *ApprovalRequest, expiry time.Time) ([]common.Address, error) {
+	request.Expiry = expiry.Unix()
+	request.ID = approvalID(request.Operation, request.Signer, request.PayloadHash, request.Expiry)
+	request.Threshold = s.policy.Approvals.Required()
+	request.Approvals = []common.Address{}
+
+	pending := &pendingApproval{request: request, approved: make(chan struct{})}
+	s.approvalMu.Lock()
+	if _, ok := s.pending[request.ID]; ok {
+		s.approvalMu.Unlock()
+		return nil, fmt.Errorf("an identical request %s is already awaiting approval", request.ID.Hex())
+	}
+	s.pending[request.ID] = pending
+	s.approvalMu.Unlock()
+	defer func() {
+		s.approvalMu.Lock()
+		delete(s.pending, request.ID)
+		s.approvalMu.Unlock()
+	}()
+
+	log.Printf("Request %s with %s awaits %d approvals", request.ID.Hex(), request.Signer.Hex(), request.Threshold)
+	timer := time.NewTimer(time.Until(expiry))
+	defer timer.Stop()
+	select {
+	case <-pending.approved:
+	case <-timer.C:
+	}
+
+	s.approvalMu.Lock()
+	defer s.approvalMu.Unlock()
+	if request.RejectedBy != nil {
+		return nil, &DeniedError{Violations: []policy.Violation{{
+			Rule:    "approvals",
+			Message: fmt.Sprintf("rejected by %s", request.RejectedBy.Hex()),
+		}}}
+	}
+	approvers := append([]common.Address(nil), request.Approvals...)
+	if len(approvers) < request.Threshold {
+		return nil, fmt.Errorf("%w awaiting approval (%d of %d approvals)", ErrRequestExpired, len(approvers), request.Threshold)
+	}
+	return approvers, nil
+}
+
+// Approve adds an approval token to a held request, releasing it once
+// enough distinct approvers approved it. A rejection token from any approver
+// refuses the request unless it was already released.
+func (s *Server) Approve(token *ApprovalToken) (*ApprovalRequest, error) {
+	if err := token.Verify(); err != nil {
+		return nil, err
+	}
+	if !s.policy.Approvals.IsApprover(token.Approver) {
+		return nil, &DeniedError{Violations: []policy.Violation{{
+			Rule:    "approvals",
+			Message: fmt.Sprintf("%s is not an approver", token.Approver.Hex()),
+		}}}
+	}
+
+	s.approvalMu.Lock()
+	defer s.approvalMu.Unlock()
+	pending, ok := s.pending[token.Request]
+	if !ok {
+		return nil, fmt.Errorf("no request %s is awaiting approval", token.Request.Hex())
+	}
+	request := pending.request
+	if request.RejectedBy != nil {
+		return nil, fmt.Errorf("request %s was rejected by %s", request.ID.Hex(), request.RejectedBy.Hex())
+	}
+	if token.Reject {
+		if len(request.Approvals) >= request.Threshold {
+			return nil, fmt.Errorf("request %s is already approved", request.ID.Hex())
+		}
+		approver := token.Approver
+		request.RejectedBy = &approver
+		log.Printf("Request %s rejected by %s", request.ID.Hex(), token.Approver.Hex())
+		close(pending.approved)
+		return copyApprovalRequest(request), nil
+	}
+	for _, approver := range request.Approvals {
+		if approver == token.Approver {
+			return copyApprovalRequest(request), nil
+		}
+	}
+	request.Approvals = append(request.Approvals, token.Approver)
+	log.Printf("Request %s approved by %s (%d of %d)", request.ID.Hex(), token.Approver.Hex(), len(request.Approvals), request.Threshold)
+	if len(request.Approvals) == request.Threshold {
+		close(pending.approved)
+	}
+	return copyApprovalRequest(request), nil
+}
+
+// PendingApprovals returns the requests awaiting approval, soonest expiry first
+func (s *Server) PendingApprovals() []*ApprovalRequest {
+	s.approvalMu.Lock()
+	defer s.approvalMu.Unlock()
+	requests := make([]*ApprovalRequest, 0, len(s.pending))
+	for _, pending := range s.pending {
+		requests = append(requests, copyApprovalRequest(pending.request))
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Expiry < requests[j].Expiry })
+	return requests
+}
+
+// PendingApproval returns a request awaiting approval
+func (s *Server) PendingApproval(id common.Hash) (*ApprovalRequest, error) {
+	s.approvalMu.Lock()
+	defer s.approvalMu.Unlock()
+	pending, ok := s.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("no request %s is awaiting approval", id.Hex())
+	}
+	return copyApprovalRequest(pending.request), nil
+}
+
+// copyApprovalRequest copies a request so its approvals can be read unlocked
+func copyApprovalRequest(request *ApprovalRequest) *ApprovalRequest {
+	copied := *request
+	copied.Approvals = append([]common.Address{}, request.Approvals...)
+	return &copied
+}
+
+// approvalDecisions describes the approvals of a request for the audit trail
+func approvalDecisions(approvers []common.Address) []string {
+	if len(approvers) == 0 {
+		return nil
+	}
+	names := make([]string, len(approvers))
+	for i, approver := range approvers {
+		names[i] = approver.Hex()
+	}
+	return []string{"approved by " + strings.Join(names, ", ")}
+}
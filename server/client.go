@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/tx"
+)
+
+// ApprovalClient lists the requests a signing daemon holds for approval and
+// submits approval and rejection tokens for them
+type ApprovalClient struct {
+	url   string
+	token string
+}
+
+// NewApprovalClient creates a client for the daemon at url, authenticated
+// with its auth token
+func NewApprovalClient(url, token string) *ApprovalClient {
+	return &ApprovalClient{url: strings.TrimRight(url, "/"), token: token}
+}
+
+// Pending returns the requests awaiting approval, soonest expiry first. The
+// requests are not verified; call Verify before showing them.
+func (c *ApprovalClient) Pending(ctx context.Context) ([]*ApprovalRequest, error) {
+	var result struct {
+		Requests []*ApprovalRequest `json:"requests"`
+	}
+	if err := c.do(ctx, http.MethodGet, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Requests, nil
+}
+
+// Submit sends an approval or rejection token and returns the request as the
+// daemon holds it afterwards
+func (c *ApprovalClient) Submit(ctx context.Context, token *ApprovalToken) (*ApprovalRequest, error) {
+	var request ApprovalRequest
+	if err := c.do(ctx, http.MethodPost, token, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// do sends a request to /v1/approvals and decodes the response
+func (c *ApprovalClient) do(ctx context.Context, method string, body, result interface{}) error {
+	client, err := tx.HTTPClient(c.url)
+	if err != nil {
+		return err
+	}
+	var encoded []byte
+	if body != nil {
+		if encoded, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal approval token: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, c.url+"/v1/approvals", bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to create daemon request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach signing daemon: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Error != "" {
+			return fmt.Errorf("signing daemon: %s", failure.Error)
+		}
+		return fmt.Errorf("signing daemon returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse daemon response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// ExpiryHeader carries the expiry of a sign request as a unix timestamp
+	// or an RFC 3339 time
+	ExpiryHeader = "X-Sign-Expiry"
+	// DefaultMaxExpiry is how far in the future a request may expire
+	DefaultMaxExpiry = 15 * time.Minute
+)
+
+// ErrRequestExpired is returned when a sign request expired before its
+// signature could be released. Signatures made after the expiry are discarded.
+var ErrRequestExpired = errors.New("sign request expired")
+
+// ParseExpiry parses the value of the expiry header. An empty value yields
+// the zero time, which checkExpiry refuses.
+func ParseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: expected a unix timestamp or an RFC 3339 time", ExpiryHeader, value)
+	}
+	return expiry, nil
+}
+
+// checkExpiry refuses requests without an expiry, already expired or
+// expiring further ahead than the server allows
+func (s *Server) checkExpiry(expiry time.Time) error {
+	if expiry.IsZero() {
+		return fmt.Errorf("sign requests must carry an expiry in the %s header", ExpiryHeader)
+	}
+	now := time.Now()
+	if !now.Before(expiry) {
+		return fmt.Errorf("%w at %s", ErrRequestExpired, expiry.Format(time.RFC3339))
+	}
+	if expiry.Sub(now) > s.maxExpiry {
+		return fmt.Errorf("expiry %s is more than %s ahead", expiry.Format(time.RFC3339), s.maxExpiry)
+	}
+	return nil
+}
+
+// expired reports whether a signature made now would be released too late
+func expired(expiry time.Time) bool {
+	return !time.Now().Before(expiry)
+}
+
+// expiredError is returned for a signature made after its request expired
+func expiredError() error {
+	return fmt.Errorf("%w before the signature could be released; it was discarded", ErrRequestExpired)
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Defaults for hardware wallet accounts
+const (
+	// DefaultHardwareTimeout bounds how long a request waits in the queue and
+	// for confirmation on the device
+	DefaultHardwareTimeout = 2 * time.Minute
+	// DefaultHardwareQueue is the number of requests that may wait for a device
+	DefaultHardwareQueue = 8
+)
+
+var (
+	// ErrHardwareTimeout is returned when a request was not confirmed on the
+	// device in time
+	ErrHardwareTimeout = errors.New("timed out waiting for confirmation on the hardware wallet")
+	// ErrHardwareBusy is returned when too many requests are waiting for a device
+	ErrHardwareBusy = errors.New("hardware wallet queue is full")
+)
+
+// hardwareQueue serializes requests to one hardware wallet, which can only
+// show one confirmation at a time
+type hardwareQueue struct {
+	wallet  *core.HardwareWallet
+	timeout time.Duration
+	limit   int
+
+	mu      sync.Mutex
+	waiting int
+	turn    chan struct{}
+}
+
+// hardwareResult is the outcome of a device operation
+type hardwareResult struct {
+	value interface{}
+	err   error
+}
+
+// newHardwareQueue creates the queue of a device
+func newHardwareQueue(wallet *core.HardwareWallet, timeout time.Duration, limit int) *hardwareQueue {
+	turn := make(chan struct{}, 1)
+	turn <- struct{}{}
+	return &hardwareQueue{wallet: wallet, timeout: timeout, limit: limit, turn: turn}
+}
+
+// do runs an operation on the device once earlier requests are done, giving up
+// when the timeout or the request's expiry passes. The operation itself cannot
+// be cancelled: a request confirmed after that is discarded and the device
+// stays busy until the user answers it.
+func (q *hardwareQueue) do(what string, expiry time.Time, operation func(*core.HardwareWallet) (interface{}, error)) (interface{}, error) {
+	q.mu.Lock()
+	if q.waiting >= q.limit {
+		q.mu.Unlock()
+		return nil, ErrHardwareBusy
+	}
+	q.waiting++
+	position := q.waiting
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		q.mu.Unlock()
+	}()
+
+	timeout, timeoutErr := q.timeout, ErrHardwareTimeout
+	if remaining := time.Until(expiry); remaining < timeout {
+		timeout, timeoutErr = remaining, ErrRequestExpired
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	if position > 1 {
+		log.Printf("Queued %s for hardware wallet %s (%d waiting)", what, q.wallet.URL(), position-1)
+	}
+	select {
+	case <-q.turn:
+	case <-timer.C:
+		return nil, timeoutErr
+	}
+
+	log.Printf("Awaiting confirmation of %s on hardware wallet %s", what, q.wallet.URL())
+	done := make(chan hardwareResult, 1)
+	go func() {
+		value, err := operation(q.wallet)
+		q.turn <- struct{}{}
+		done <- hardwareResult{value: value, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-timer.C:
+		log.Printf("Gave up on %s after %s; a late confirmation on the device is discarded", what, timeout)
+		return nil, timeoutErr
+	}
+}
+
+// AddHardwareAccount makes a hardware wallet account available for signing.
+// Every signature must be confirmed on the device.
+func (s *Server) AddHardwareAccount(name string, wallet *core.HardwareWallet) (*Account, error) {
+	address, err := wallet.GetAddress()
+	if err != nil {
+		return nil, err
+	}
+	return s.addAccount(&Account{Name: name, Address: address, device: newHardwareQueue(wallet, s.hardwareTimeout, s.hardwareQueue)}), nil
+}
+
+// signTx signs a transaction with the key or device of an account
+func (s *Server) signTx(account *Account, unsigned *types.Transaction, chainID *big.Int, expiry time.Time) (*types.Transaction, error) {
+	if account.device == nil {
+		var signed *types.Transaction
+		err := account.key.Use(func(privateKey *ecdsa.PrivateKey) error {
+			var err error
+			signed, err = types.SignTx(unsigned, types.LatestSignerForChainID(chainID), privateKey)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign transaction: %v", err)
+		}
+		return signed, nil
+	}
+
+	value, err := account.device.do("transaction", expiry, func(wallet *core.HardwareWallet) (interface{}, error) {
+		return wallet.SignEthereumTx(unsigned, chainID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	signed := value.(*types.Transaction)
+	if from, err := types.Sender(types.LatestSignerForChainID(chainID), signed); err != nil || from != account.Address {
+		return nil, fmt.Errorf("hardware wallet signed with another account than %s", account.Address.Hex())
+	}
+	return signed, nil
+}
+
+// checkCapability refuses a kind of signature the device of an account cannot
+// make, before the request waits for approvals or the device
+func checkCapability(account *Account, capability core.Capability) error {
+	if account.device == nil || account.device.wallet.Supports(capability) {
+		return nil
+	}
+	return fmt.Errorf("%w: the %s device of %s cannot sign %s", core.ErrUnsupported, account.device.wallet.Kind(), account.Name, capability)
+}
+
+// signMessage signs a message with the key or device of an account
+func (s *Server) signMessage(account *Account, data []byte, hash []byte, expiry time.Time) ([]byte, error) {
+	if account.device == nil {
+		signature, err := account.key.SignHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign message: %v", err)
+		}
+		signature[crypto.RecoveryIDOffset] += 27
+		return signature, nil
+	}
+
+	value, err := account.device.do("message", expiry, func(wallet *core.HardwareWallet) (interface{}, error) {
+		return wallet.SignMessage(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deviceSignature(value.([]byte)), nil
+}
+
+// signTypedData signs EIP-712 typed data with the key or device of an account
+func (s *Server) signTypedData(account *Account, typedData *core.TypedData, expiry time.Time) ([]byte, error) {
+	if account.device == nil {
+		signature, err := core.SignTypedDataWithSigner(typedData, account.key)
+		if err != nil {
+			return nil, err
+		}
+		signature[crypto.RecoveryIDOffset] += 27
+		return signature, nil
+	}
+
+	value, err := account.device.do("typed data "+typedData.PrimaryType, expiry, func(wallet *core.HardwareWallet) (interface{}, error) {
+		return wallet.SignTypedData(typedData)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deviceSignature(value.([]byte)), nil
+}
+
+// deviceSignature returns a device signature with a 27/28 recovery ID, as the
+// daemon returns for keystore keys
+func deviceSignature(signature []byte) []byte {
+	if len(signature) == crypto.SignatureLength && signature[crypto.RecoveryIDOffset] < 27 {
+		signature[crypto.RecoveryIDOffset] += 27
+	}
+	return signature
+}
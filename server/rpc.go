@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// rpcRequest is a JSON-RPC 2.0 request
+type rpcRequest struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// handleRPC serves the JSON-RPC API
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "JSON-RPC requires POST"})
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{Version: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{Code: codeParseError, Message: err.Error()}})
+		return
+	}
+
+	if req.Version != "2.0" {
+		writeJSON(w, http.StatusOK, rpcResponse{Version: "2.0", ID: req.ID,
+			Error: &rpcError{Code: codeInvalidRequest, Message: "jsonrpc must be 2.0"}})
+		return
+	}
+
+	expiry, err := ParseExpiry(r.Header.Get(ExpiryHeader))
+	if err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{Version: "2.0", ID: req.ID,
+			Error: &rpcError{Code: codeInvalidRequest, Message: err.Error()}})
+		return
+	}
+
+	result, rpcErr := s.dispatch(&req, expiry)
+	writeJSON(w, http.StatusOK, rpcResponse{Version: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+}
+
+// dispatch executes a JSON-RPC method. Both clef's account_* names and the
+// eth_* names used by dapps are accepted. Signing methods need an expiry.
+func (s *Server) dispatch(req *rpcRequest, expiry time.Time) (interface{}, *rpcError) {
+	switch req.Method {
+	case "account_list", "eth_accounts":
+		return s.Accounts(), nil
+
+	case "account_signTransaction", "eth_signTransaction":
+		var args apitypes.SendTxArgs
+		if err := params(req, &args); err != nil {
+			return nil, err
+		}
+		return toRPCResult(s.SignTransaction(&args, expiry))
+
+	case "eth_sign":
+		var address common.Address
+		var data hexutil.Bytes
+		if err := params(req, &address, &data); err != nil {
+			return nil, err
+		}
+		return toRPCResult(s.SignMessage(address, data, expiry))
+
+	case "personal_sign":
+		var data hexutil.Bytes
+		var address common.Address
+		if err := params(req, &data, &address); err != nil {
+			return nil, err
+		}
+		return toRPCResult(s.SignMessage(address, data, expiry))
+
+	case "account_signData":
+		var contentType string
+		var address common.MixedcaseAddress
+		var data hexutil.Bytes
+		if err := params(req, &contentType, &address, &data); err != nil {
+			return nil, err
+		}
+		if contentType != "text/plain" {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unsupported content type %q", contentType)}
+		}
+		return toRPCResult(s.SignMessage(address.Address(), data, expiry))
+
+	case "account_signTypedData", "eth_signTypedData_v4", "eth_signTypedData":
+		var address common.MixedcaseAddress
+		var raw json.RawMessage
+		if err := params(req, &address, &raw); err != nil {
+			return nil, err
+		}
+		typedData, err := parseTypedData(raw)
+		if err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return toRPCResult(s.SignTypedData(address.Address(), typedData, expiry))
+
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not supported", req.Method)}
+	}
+}
+
+// params decodes positional JSON-RPC parameters
+func params(req *rpcRequest, targets ...interface{}) *rpcError {
+	if len(req.Params) < len(targets) {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("expected %d parameters, got %d", len(targets), len(req.Params))}
+	}
+	for i, target := range targets {
+		if err := json.Unmarshal(req.Params[i], target); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid parameter %d: %v", i, err)}
+		}
+	}
+	return nil
+}
+
+// toRPCResult converts a signing result into a JSON-RPC result or error
+func toRPCResult(result interface{}, err error) (interface{}, *rpcError) {
+	if err != nil {
+		if violations := violationsOf(err); violations != nil {
+			return nil, &rpcError{Code: codeSigningDenied, Message: err.Error(), Data: violations}
+		}
+		return nil, &rpcError{Code: codeSigningDenied, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// parseTypedData accepts typed data as a JSON object or as a JSON-encoded string
+func parseTypedData(raw json.RawMessage) (*core.TypedData, error) {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = json.RawMessage(encoded)
+	}
+	return core.ParseTypedData(string(raw))
+}
+
+// handleAccounts serves GET /v1/accounts
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": s.Accounts()})
+}
+
+// handleSignTransaction serves POST /v1/sign/transaction with eth_signTransaction arguments
+func (s *Server) handleSignTransaction(w http.ResponseWriter, r *http.Request) {
+	var args apitypes.SendTxArgs
+	if !decodeBody(w, r, &args) {
+		return
+	}
+	expiry, ok := requestExpiry(w, r)
+	if !ok {
+		return
+	}
+	result, err := s.SignTransaction(&args, expiry)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleSignMessage serves POST /v1/sign/message
+func (s *Server) handleSignMessage(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address common.Address `json:"address"`
+		Data    hexutil.Bytes  `json:"data"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	expiry, ok := requestExpiry(w, r)
+	if !ok {
+		return
+	}
+	signature, err := s.SignMessage(body.Address, body.Data, expiry)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"signature": signature})
+}
+
+// handleSignTypedData serves POST /v1/sign/typed-data
+func (s *Server) handleSignTypedData(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Address   common.Address  `json:"address"`
+		TypedData json.RawMessage `json:"typedData"`
+	}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	expiry, ok := requestExpiry(w, r)
+	if !ok {
+		return
+	}
+	typedData, err := parseTypedData(body.TypedData)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	signature, err := s.SignTypedData(body.Address, typedData, expiry)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"signature": signature})
+}
+
+// handleApprovals serves GET /v1/approvals, listing the requests awaiting
+// approval, and POST /v1/approvals, which submits an approval or rejection
+// token
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"requests": s.PendingApprovals()})
+		return
+	}
+	var token ApprovalToken
+	if !decodeBody(w, r, &token) {
+		return
+	}
+	request, err := s.Approve(&token)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, request)
+}
+
+// handleApproval serves GET /v1/approvals/<id>, the export of one request
+// awaiting approval
+func (s *Server) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/approvals/")
+	value, err := hexutil.Decode(id)
+	if err != nil || len(value) != common.HashLength {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request ID %q", id)})
+		return
+	}
+	request, err := s.PendingApproval(common.BytesToHash(value))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, request)
+}
+
+// requestExpiry parses the expiry header of a REST request, writing an error
+// response if it is malformed
+func requestExpiry(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	expiry, err := ParseExpiry(r.Header.Get(ExpiryHeader))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return time.Time{}, false
+	}
+	return expiry, true
+}
+
+// decodeBody decodes a POST request body, writing an error response on failure
+func decodeBody(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/securemem"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeSigningDenied  = -32000
+)
+
+// Account is a key unlocked for the signing daemon
+type Account struct {
+	Name    string
+	Address common.Address
+	key     *securemem.Key
+	// device is set for hardware wallet accounts
+	device *hardwareQueue
+}
+
+// Config configures a signing server
+type Config struct {
+	// Token is the bearer token every request must present
+	Token string
+	// Policy is enforced on every transaction; it is never overridden
+	Policy *policy.Policy
+	// History records signed transactions for duplicate and daily limit checks
+	History *tx.History
+	// SimulationCache is consulted when the policy requires simulation
+	SimulationCache *tx.SimulationCache
+	// Audit records every signature and refusal, if set
+	Audit *audit.Log
+	// Operator is recorded in audit records
+	Operator string
+	// HardwareTimeout bounds the wait for confirmation on a hardware wallet
+	HardwareTimeout time.Duration
+	// HardwareQueue is the number of requests that may wait for a hardware wallet
+	HardwareQueue int
+	// MaxExpiry bounds how far in the future a sign request may expire
+	MaxExpiry time.Duration
+	// KeyState returns an error if an unlocked key may no longer sign, such
+	// as a key suspended since the server started. It is checked on every request.
+	KeyState func(name string) error
+	// HeadBlock returns the latest block of a chain, which cached simulations
+	// are aged against. Without it the requireSimulation rule refuses all.
+	HeadBlock func(ctx context.Context, chainID *big.Int) (uint64, error)
+}
+
+// Server serves a clef-compatible JSON-RPC API and an equivalent REST API for
+// signing with unlocked keystore keys
+type Server struct {
+	token    string
+	policy   *policy.Policy
+	history  *tx.History
+	simCache *tx.SimulationCache
+	audit    *audit.Log
+	operator string
+
+	hardwareTimeout time.Duration
+	hardwareQueue   int
+	maxExpiry       time.Duration
+	keyState        func(name string) error
+	headBlock       func(ctx context.Context, chainID *big.Int) (uint64, error)
+
+	accounts map[common.Address]*Account
+	order    []common.Address
+
+	// mu serializes signing so policy checks see every earlier signature
+	mu sync.Mutex
+
+	// approvalMu guards the requests awaiting approval
+	approvalMu sync.Mutex
+	pending    map[common.Hash]*pendingApproval
+}
+
+// New creates a signing server
+func New(cfg Config) (*Server, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("signing server requires an auth token")
+	}
+	if cfg.History == nil {
+		return nil, errors.New("signing server requires a transaction history")
+	}
+	if cfg.Policy == nil {
+		cfg.Policy = &policy.Policy{}
+	}
+	if cfg.HardwareTimeout <= 0 {
+		cfg.HardwareTimeout = DefaultHardwareTimeout
+	}
+	if cfg.HardwareQueue <= 0 {
+		cfg.HardwareQueue = DefaultHardwareQueue
+	}
+	if cfg.MaxExpiry <= 0 {
+		cfg.MaxExpiry = DefaultMaxExpiry
+	}
+
+	return &Server{
+		token:    cfg.Token,
+		policy:   cfg.Policy,
+		history:  cfg.History,
+		simCache: cfg.SimulationCache,
+		audit:    cfg.Audit,
+		operator: cfg.Operator,
+
+		hardwareTimeout: cfg.HardwareTimeout,
+		hardwareQueue:   cfg.HardwareQueue,
+		maxExpiry:       cfg.MaxExpiry,
+		keyState:        cfg.KeyState,
+		headBlock:       cfg.HeadBlock,
+
+		accounts: make(map[common.Address]*Account),
+		pending:  make(map[common.Hash]*pendingApproval),
+	}, nil
+}
+
+// AddAccount seals a key in locked memory and makes it available for
+// signing. The key passed in is wiped.
+func (s *Server) AddAccount(name string, privateKey *ecdsa.PrivateKey) (*Account, error) {
+	key, err := securemem.NewKey(privateKey)
+	if err != nil {
+		securemem.WipeKey(privateKey)
+		return nil, err
+	}
+	return s.addAccount(&Account{Name: name, Address: key.Address(), key: key}), nil
+}
+
+// addAccount registers an account, replacing any with the same address
+func (s *Server) addAccount(account *Account) *Account {
+	if _, ok := s.accounts[account.Address]; !ok {
+		s.order = append(s.order, account.Address)
+	}
+	s.accounts[account.Address] = account
+	return account
+}
+
+// Accounts returns the addresses of all unlocked accounts
+func (s *Server) Accounts() []common.Address {
+	return append([]common.Address(nil), s.order...)
+}
+
+// account looks up an unlocked account
+func (s *Server) account(address common.Address) (*Account, error) {
+	account, ok := s.accounts[address]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %s", address.Hex())
+	}
+	if account.key != nil && s.keyState != nil {
+		if err := s.keyState(account.Name); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// Handler returns the HTTP handler of the API. JSON-RPC is served on "/",
+// REST endpoints under "/v1/".
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRPC)
+	mux.HandleFunc("/v1/accounts", s.handleAccounts)
+	mux.HandleFunc("/v1/sign/transaction", s.handleSignTransaction)
+	mux.HandleFunc("/v1/sign/message", s.handleSignMessage)
+	mux.HandleFunc("/v1/sign/typed-data", s.handleSignTypedData)
+	mux.HandleFunc("/v1/approvals", s.handleApprovals)
+	mux.HandleFunc("/v1/approvals/", s.handleApproval)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			log.Printf("Rejected unauthenticated request from %s", r.RemoteAddr)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing auth token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes a REST error response
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		status = http.StatusForbidden
+	}
+	if errors.Is(err, ErrRequestExpired) {
+		status = http.StatusRequestTimeout
+	}
+	writeJSON(w, status, map[string]interface{}{"error": err.Error(), "violations": violationsOf(err)})
+}
+
+// violationsOf returns the policy violations carried by an error, if any
+func violationsOf(err error) []policy.Violation {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		return denied.Violations
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/audit"
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/policy"
+	"github.com/aryehky/gosignervaultcli/tx"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// DeniedError is returned when the signing policy refuses a request
+type DeniedError struct {
+	Violations []policy.Violation
+}
+
+func (e *DeniedError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return "signing denied by policy: " + strings.Join(messages, "; ")
+}
+
+// SignTransactionResult is the result of eth_signTransaction
+type SignTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// SignTransaction checks a transaction against the policy and signs it,
+// unless the request expires before the signature can be released
+func (s *Server) SignTransaction(args *apitypes.SendTxArgs, expiry time.Time) (*SignTransactionResult, error) {
+	account, err := s.account(args.From.Address())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkExpiry(expiry); err != nil {
+		return nil, err
+	}
+	if args.ChainID == nil {
+		return nil, errors.New("chainId is required")
+	}
+	if args.GasPrice == nil && args.MaxFeePerGas == nil {
+		return nil, errors.New("gasPrice or maxFeePerGas is required")
+	}
+	if args.Data != nil && args.Input != nil && !strings.EqualFold(args.Data.String(), args.Input.String()) {
+		return nil, errors.New("data and input are both set and differ")
+	}
+	chainID := args.ChainID.ToInt()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unsigned := args.ToTransaction()
+	payloadHash := types.LatestSignerForChainID(chainID).Hash(unsigned)
+	refuse := func(err error) error {
+		log.Printf("Refused transaction from %s to %v: %v", account.Address.Hex(), unsigned.To(), err)
+		var decisions []string
+		var denied *DeniedError
+		if errors.As(err, &denied) {
+			for _, v := range denied.Violations {
+				decisions = append(decisions, "violation: "+v.String())
+			}
+		}
+		if auditErr := s.record(&audit.Record{
+			Operation:   audit.OpSignTransaction,
+			Outcome:     audit.OutcomeRefused,
+			Key:         account.Name,
+			Signer:      account.Address.Hex(),
+			ChainID:     chainID.String(),
+			PayloadHash: payloadHash,
+			Policy:      decisions,
+		}); auditErr != nil {
+			log.Printf("Warning: %v", auditErr)
+		}
+		return err
+	}
+	if err := s.checkPolicy(account, unsigned, chainID); err != nil {
+		return nil, refuse(err)
+	}
+
+	// Hold the request until approvers release it. Other requests are
+	// served meanwhile, so the policy is checked again once it is approved.
+	var approvers []common.Address
+	if s.approvalsRequired() {
+		encoded, err := unsigned.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode transaction: %v", err)
+		}
+		s.mu.Unlock()
+		approvers, err = s.awaitApproval(&ApprovalRequest{
+			Operation:   audit.OpSignTransaction,
+			Key:         account.Name,
+			Signer:      account.Address,
+			ChainID:     chainID,
+			PayloadHash: payloadHash,
+			Transaction: encoded,
+		}, expiry)
+		s.mu.Lock()
+		if err != nil {
+			return nil, refuse(err)
+		}
+		if err := s.checkPolicy(account, unsigned, chainID); err != nil {
+			return nil, refuse(err)
+		}
+	}
+
+	var signed *types.Transaction
+	if account.device != nil {
+		// Other requests are served while the device awaits confirmation, so
+		// the policy is checked again against the history as it is now
+		s.mu.Unlock()
+		signed, err = s.signTx(account, unsigned, chainID, expiry)
+		s.mu.Lock()
+		if err == nil {
+			if err := s.checkPolicy(account, unsigned, chainID); err != nil {
+				return nil, refuse(err)
+			}
+		}
+	} else {
+		signed, err = s.signTx(account, unsigned, chainID, expiry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiry) {
+		return nil, refuse(expiredError())
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	// Record the signature for later duplicate and daily limit checks
+	to, value, data, chain := transactionKey(signed, chainID)
+	record := &tx.TransactionRecord{
+		Hash:     signed.Hash(),
+		From:     account.Address.Hex(),
+		To:       to,
+		Value:    value,
+		Data:     data,
+		ChainID:  chain,
+		GasPrice: signed.GasPrice().String(),
+	}
+	if err := s.history.RecordSigned(record); err != nil {
+		return nil, fmt.Errorf("failed to record transaction in history: %v", err)
+	}
+	hash := signed.Hash()
+	if err := s.record(&audit.Record{
+		Operation:   audit.OpSignTransaction,
+		Outcome:     audit.OutcomeSigned,
+		Key:         account.Name,
+		Signer:      account.Address.Hex(),
+		ChainID:     chainID.String(),
+		PayloadHash: payloadHash,
+		TxHash:      &hash,
+		Policy:      append([]string{"policy passed"}, approvalDecisions(approvers)...),
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Signed transaction %s from %s (key %s)", signed.Hash().Hex(), account.Address.Hex(), account.Name)
+	return &SignTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+// SignMessage signs data with the EIP-191 personal message prefix, as eth_sign does
+func (s *Server) SignMessage(address common.Address, data []byte, expiry time.Time) (hexutil.Bytes, error) {
+	account, err := s.account(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkExpiry(expiry); err != nil {
+		return nil, err
+	}
+	if err := checkCapability(account, core.CapMessages); err != nil {
+		return nil, err
+	}
+
+	hash := accounts.TextHash(data)
+	if violations := s.policy.EvaluateSignature(&policy.SignatureRequest{KeyName: account.Name}); len(violations) > 0 {
+		return nil, s.refuseSignature(audit.OpSignMessage, account, common.BytesToHash(hash), "", &DeniedError{Violations: violations})
+	}
+	var approvers []common.Address
+	if s.approvalsRequired() {
+		approvers, err = s.awaitApproval(&ApprovalRequest{
+			Operation:   audit.OpSignMessage,
+			Key:         account.Name,
+			Signer:      address,
+			PayloadHash: common.BytesToHash(hash),
+			Message:     data,
+		}, expiry)
+		if err != nil {
+			return nil, s.refuseSignature(audit.OpSignMessage, account, common.BytesToHash(hash), "", err)
+		}
+	}
+	signature, err := s.signMessage(account, data, hash, expiry)
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiry) {
+		return nil, s.refuseSignature(audit.OpSignMessage, account, common.BytesToHash(hash), "", expiredError())
+	}
+	if err := s.record(&audit.Record{
+		Operation:   audit.OpSignMessage,
+		Outcome:     audit.OutcomeSigned,
+		Key:         account.Name,
+		Signer:      address.Hex(),
+		PayloadHash: common.BytesToHash(hash),
+		Policy:      approvalDecisions(approvers),
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Signed message with %s (key %s)", address.Hex(), account.Name)
+	return signature, nil
+}
+
+// SignTypedData signs EIP-712 typed data
+func (s *Server) SignTypedData(address common.Address, typedData *core.TypedData, expiry time.Time) (hexutil.Bytes, error) {
+	account, err := s.account(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkExpiry(expiry); err != nil {
+		return nil, err
+	}
+	if err := checkCapability(account, core.CapTypedData); err != nil {
+		return nil, err
+	}
+
+	hash, err := typedData.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if violations := s.policy.EvaluateSignature(policy.NewTypedDataRequest(account.Name, typedData)); len(violations) > 0 {
+		return nil, s.refuseSignature(audit.OpSignTypedData, account, hash, typedData.PrimaryType, &DeniedError{Violations: violations})
+	}
+	var approvers []common.Address
+	if s.approvalsRequired() {
+		encoded, err := json.Marshal(typedData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode typed data: %v", err)
+		}
+		approvers, err = s.awaitApproval(&ApprovalRequest{
+			Operation:   audit.OpSignTypedData,
+			Key:         account.Name,
+			Signer:      address,
+			PayloadHash: hash,
+			TypedData:   encoded,
+		}, expiry)
+		if err != nil {
+			return nil, s.refuseSignature(audit.OpSignTypedData, account, hash, typedData.PrimaryType, err)
+		}
+	}
+	signature, err := s.signTypedData(account, typedData, expiry)
+	if err != nil {
+		return nil, err
+	}
+	if expired(expiry) {
+		return nil, s.refuseSignature(audit.OpSignTypedData, account, hash, typedData.PrimaryType, expiredError())
+	}
+	if err := s.record(&audit.Record{
+		Operation:   audit.OpSignTypedData,
+		Outcome:     audit.OutcomeSigned,
+		Key:         account.Name,
+		Signer:      address.Hex(),
+		PayloadHash: hash,
+		Detail:      typedData.PrimaryType,
+		Policy:      approvalDecisions(approvers),
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Signed typed data %s with %s (key %s)", typedData.PrimaryType, address.Hex(), account.Name)
+	return signature, nil
+}
+
+// refuseSignature records the refusal of a message or typed data request,
+// whether the policy denied it, it was not approved or its signature came
+// after the expiry
+func (s *Server) refuseSignature(operation string, account *Account, payloadHash common.Hash, detail string, err error) error {
+	log.Printf("Refused %s with %s: %v", operation, account.Address.Hex(), err)
+	var decisions []string
+	for _, v := range violationsOf(err) {
+		decisions = append(decisions, "violation: "+v.String())
+	}
+	if auditErr := s.record(&audit.Record{
+		Operation:   operation,
+		Outcome:     audit.OutcomeRefused,
+		Key:         account.Name,
+		Signer:      account.Address.Hex(),
+		PayloadHash: payloadHash,
+		Detail:      detail,
+		Policy:      decisions,
+	}); auditErr != nil {
+		log.Printf("Warning: %v", auditErr)
+	}
+	return err
+}
+
+// record appends a record to the audit trail, if one is configured. A
+// signature is only returned once it has been recorded.
+func (s *Server) record(record *audit.Record) error {
+	if s.audit == nil {
+		return nil
+	}
+	record.Operator = s.operator
+	if err := s.audit.Append(record); err != nil {
+		return fmt.Errorf("failed to write audit record: %v", err)
+	}
+	return nil
+}
+
+// checkPolicy applies the duplicate check and the signing policy. Unlike the
+// CLI, the daemon has no way to override a violation.
+func (s *Server) checkPolicy(account *Account, transaction *types.Transaction, chainID *big.Int) error {
+	to, value, data, chain := transactionKey(transaction, chainID)
+
+	// Duplicate check
+	dupPolicy := tx.DefaultDuplicatePolicy()
+	if rule := s.policy.Duplicates; rule != nil {
+		if rule.Mode != "" {
+			dupPolicy.Mode = rule.Mode
+		}
+		if rule.Window != "" {
+			dupPolicy.Window, _ = time.ParseDuration(rule.Window)
+		}
+	}
+	if record, block := dupPolicy.Check(s.history, to, value, data, chain); record != nil {
+		if block {
+			return &DeniedError{Violations: []policy.Violation{{
+				Rule:    "duplicates",
+				Message: fmt.Sprintf("an identical transaction (%s) was signed at %s", record.Hash.Hex(), record.Timestamp.Format(time.RFC3339)),
+			}}}
+		}
+		log.Printf("Warning: identical transaction %s was signed at %s", record.Hash.Hex(), record.Timestamp.Format(time.RFC3339))
+	}
+
+	req := &policy.Request{
+		KeyName:    account.Name,
+		To:         transaction.To(),
+		Value:      transaction.Value(),
+		Data:       transaction.Data(),
+		ChainID:    chainID,
+		SpentToday: s.history.SpentSince(account.Address.Hex(), chain, time.Now().Add(-24*time.Hour)),
+	}
+
+	// Look for a successful simulation of this exact payload
+	if s.policy.RequireSimulation && s.simCache != nil {
+		payloadHash, err := tx.PayloadHash(&tx.Transaction{
+			From:     account.Address,
+			To:       transaction.To(),
+			Value:    transaction.Value(),
+			Gas:      transaction.Gas(),
+			GasPrice: transaction.GasPrice(),
+			Data:     transaction.Data(),
+			Nonce:    transaction.Nonce(),
+			ChainID:  chainID,
+		})
+		if err != nil {
+			return err
+		}
+		// Results older than the cache window do not count, so the head must
+		// be known
+		if s.headBlock == nil {
+			return errors.New("requireSimulation needs the head block, which the daemon cannot read")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		head, err := s.headBlock(ctx, chainID)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to check the age of the cached simulation: %v", err)
+		}
+		result, ok := s.simCache.Get(payloadHash, head)
+		req.Simulated = ok && result.Success
+	}
+
+	if violations := s.policy.Evaluate(req); len(violations) > 0 {
+		return &DeniedError{Violations: violations}
+	}
+	return nil
+}
+
+// transactionKey returns the fields used to identify duplicate transactions,
+// formatted as in the transaction history
+func transactionKey(transaction *types.Transaction, chainID *big.Int) (to, value, data, chain string) {
+	if transaction.To() != nil {
+		to = transaction.To().Hex()
+	}
+	return to, transaction.Value().String(), fmt.Sprintf("0x%x", transaction.Data()), chainID.String()
+}
@@ -0,0 +1,154 @@
+package templates
+
+import "encoding/json"
+
+// builtins returns fresh copies of the built-in templates
+func builtins() []*Template {
+	return []*Template{
+		{
+			Name:        "permit",
+			Description: "EIP-2612 permit granting a spender an ERC-20 allowance without a transaction",
+			Kind:        KindTypedData,
+			Params: []Param{
+				{Name: "token", Type: "address", Description: "Token contract"},
+				{Name: "tokenName", Type: "string", Description: "Token name of the EIP-712 domain, as returned by name()"},
+				{Name: "version", Type: "string", Description: "Domain version of the token", Default: defaultValue("1")},
+				{Name: "chainId", Type: "uint256", Description: "Chain of the token", Default: defaultValue("{{chainId}}")},
+				{Name: "owner", Type: "address", Description: "Token owner", Default: defaultValue("{{signer}}")},
+				{Name: "spender", Type: "address", Description: "Address allowed to spend"},
+				{Name: "value", Type: "uint256", Description: "Allowance in base units"},
+				{Name: "nonce", Type: "uint256", Description: "Permit nonce of the owner, as returned by nonces(owner)"},
+				{Name: "deadline", Type: "uint256", Description: "Unix time after which the permit expires"},
+			},
+			TypedData: json.RawMessage(`{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Permit": [
+			{"name": "owner", "type": "address"},
+			{"name": "spender", "type": "address"},
+			{"name": "value", "type": "uint256"},
+			{"name": "nonce", "type": "uint256"},
+			{"name": "deadline", "type": "uint256"}
+		]
+	},
+	"primaryType": "Permit",
+	"domain": {"name": "{{tokenName}}", "version": "{{version}}", "chainId": "{{chainId}}", "verifyingContract": "{{token}}"},
+	"message": {"owner": "{{owner}}", "spender": "{{spender}}", "value": "{{value}}", "nonce": "{{nonce}}", "deadline": "{{deadline}}"}
+}`),
+			Source: SourceBuiltin,
+		},
+		{
+			Name:        "siwe",
+			Description: "EIP-4361 Sign-In with Ethereum message",
+			Kind:        KindMessage,
+			Params: []Param{
+				{Name: "domain", Type: "string", Description: "Domain asking for the sign-in, e.g. app.example.com"},
+				{Name: "address", Type: "address", Description: "Account signing in", Default: defaultValue("{{signer}}")},
+				{Name: "statement", Type: "string", Description: "Statement the user agrees to"},
+				{Name: "uri", Type: "string", Description: "URI of the resource, e.g. https://app.example.com/login"},
+				{Name: "chainId", Type: "uint256", Description: "Chain of the account", Default: defaultValue("{{chainId}}")},
+				{Name: "nonce", Type: "string", Description: "Nonce issued by the site", Default: defaultValue("{{random}}")},
+				{Name: "issuedAt", Type: "datetime", Description: "Time of the sign-in", Default: defaultValue("{{now}}")},
+			},
+			Message: "{{domain}} wants you to sign in with your Ethereum account:\n" +
+				"{{address}}\n" +
+				"\n" +
+				"{{statement}}\n" +
+				"\n" +
+				"URI: {{uri}}\n" +
+				"Version: 1\n" +
+				"Chain ID: {{chainId}}\n" +
+				"Nonce: {{nonce}}\n" +
+				"Issued At: {{issuedAt}}",
+			Source: SourceBuiltin,
+		},
+		{
+			Name:        "safe-tx",
+			Description: "SafeTx confirmation of a Gnosis Safe multisig transaction (Safe v1.3.0+)",
+			Kind:        KindTypedData,
+			Params: []Param{
+				{Name: "safe", Type: "address", Description: "Safe account"},
+				{Name: "chainId", Type: "uint256", Description: "Chain of the Safe", Default: defaultValue("{{chainId}}")},
+				{Name: "to", Type: "address", Description: "Destination of the Safe transaction"},
+				{Name: "value", Type: "uint256", Description: "Value in wei", Default: defaultValue("0")},
+				{Name: "data", Type: "bytes", Description: "Calldata", Default: defaultValue("0x")},
+				{Name: "operation", Type: "uint8", Description: "0 for a call, 1 for a delegate call", Default: defaultValue("0")},
+				{Name: "safeTxGas", Type: "uint256", Default: defaultValue("0")},
+				{Name: "baseGas", Type: "uint256", Default: defaultValue("0")},
+				{Name: "gasPrice", Type: "uint256", Default: defaultValue("0")},
+				{Name: "gasToken", Type: "address", Default: defaultValue("0x0000000000000000000000000000000000000000")},
+				{Name: "refundReceiver", Type: "address", Default: defaultValue("0x0000000000000000000000000000000000000000")},
+				{Name: "nonce", Type: "uint256", Description: "Safe nonce"},
+			},
+			TypedData: json.RawMessage(`{
+	"types": {
+		"EIP712Domain": [
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"SafeTx": [
+			{"name": "to", "type": "address"},
+			{"name": "value", "type": "uint256"},
+			{"name": "data", "type": "bytes"},
+			{"name": "operation", "type": "uint8"},
+			{"name": "safeTxGas", "type": "uint256"},
+			{"name": "baseGas", "type": "uint256"},
+			{"name": "gasPrice", "type": "uint256"},
+			{"name": "gasToken", "type": "address"},
+			{"name": "refundReceiver", "type": "address"},
+			{"name": "nonce", "type": "uint256"}
+		]
+	},
+	"primaryType": "SafeTx",
+	"domain": {"chainId": "{{chainId}}", "verifyingContract": "{{safe}}"},
+	"message": {
+		"to": "{{to}}", "value": "{{value}}", "data": "{{data}}", "operation": "{{operation}}",
+		"safeTxGas": "{{safeTxGas}}", "baseGas": "{{baseGas}}", "gasPrice": "{{gasPrice}}",
+		"gasToken": "{{gasToken}}", "refundReceiver": "{{refundReceiver}}", "nonce": "{{nonce}}"
+	}
+}`),
+			Source: SourceBuiltin,
+		},
+		{
+			Name:        "vote",
+			Description: "Ballot of an OpenZeppelin Governor, cast on-chain by a relayer with castVoteBySig",
+			Kind:        KindTypedData,
+			Params: []Param{
+				{Name: "governor", Type: "address", Description: "Governor contract"},
+				{Name: "governorName", Type: "string", Description: "Governor name of the EIP-712 domain, as returned by name()"},
+				{Name: "version", Type: "string", Description: "Domain version of the governor", Default: defaultValue("1")},
+				{Name: "chainId", Type: "uint256", Description: "Chain of the governor", Default: defaultValue("{{chainId}}")},
+				{Name: "proposalId", Type: "uint256", Description: "Proposal to vote on"},
+				{Name: "support", Type: "uint8", Description: "0 against, 1 for, 2 abstain"},
+			},
+			TypedData: json.RawMessage(`{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Ballot": [
+			{"name": "proposalId", "type": "uint256"},
+			{"name": "support", "type": "uint8"}
+		]
+	},
+	"primaryType": "Ballot",
+	"domain": {"name": "{{governorName}}", "version": "{{version}}", "chainId": "{{chainId}}", "verifyingContract": "{{governor}}"},
+	"message": {"proposalId": "{{proposalId}}", "support": "{{support}}"}
+}`),
+			Source: SourceBuiltin,
+		},
+	}
+}
+
+// defaultValue returns a parameter default
+func defaultValue(value string) *string {
+	return &value
+}
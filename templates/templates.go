@@ -0,0 +1,448 @@
+// Package templates instantiates parameterized EIP-712 typed data and EIP-191
+// message templates. Built-in templates cover common signatures; templates of
+// an organization are JSON files in the templates directory.
+package templates
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// KindTypedData templates produce EIP-712 typed data
+	KindTypedData = "typed-data"
+	// KindMessage templates produce EIP-191 personal messages
+	KindMessage = "message"
+
+	// SourceBuiltin marks templates shipped with the vault
+	SourceBuiltin = "built-in"
+)
+
+// Dir holds the organization's templates, one <name>.json file each
+var Dir = filepath.Join(paths.ConfigDir(), "templates")
+
+// Param is a value a template is instantiated with. Defaults may refer to
+// the context values {{signer}}, {{chainId}}, {{now}} and {{random}}.
+type Param struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Description string  `json:"description,omitempty"`
+	Default     *string `json:"default,omitempty"`
+}
+
+// Template is a typed data or message body with {{param}} placeholders
+type Template struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Kind        string          `json:"kind"`
+	Params      []Param         `json:"params"`
+	TypedData   json.RawMessage `json:"typedData,omitempty"`
+	Message     string          `json:"message,omitempty"`
+
+	// Source is the file the template was loaded from, or SourceBuiltin
+	Source string `json:"-"`
+}
+
+// Context holds the values available to parameter defaults
+type Context struct {
+	Signer  common.Address
+	ChainID *big.Int
+	Now     time.Time
+}
+
+// Instance is an instantiated template
+type Instance struct {
+	Template  *Template
+	Values    map[string]string
+	TypedData *core.TypedData
+	Message   string
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+	namePattern        = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	sizedTypePattern   = regexp.MustCompile(`^(u?int|bytes)([0-9]+)$`)
+)
+
+// contextValues are the placeholders parameter defaults may use
+var contextValues = map[string]bool{"signer": true, "chainId": true, "now": true, "random": true}
+
+// List returns the built-in templates and those in dir, sorted by name. A
+// template in dir replaces the built-in template of the same name.
+func List(dir string) ([]*Template, error) {
+	byName := make(map[string]*Template)
+	for _, template := range builtins() {
+		byName[template.Name] = template
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %v", err)
+	}
+	for _, file := range files {
+		template, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		byName[template.Name] = template
+	}
+
+	templates := make([]*Template, 0, len(byName))
+	for _, template := range byName {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Find returns the template of a name from dir or the built-in templates
+func Find(dir, name string) (*Template, error) {
+	templates, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, template := range templates {
+		if template.Name == name {
+			return template, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown template %q; see 'templates list'", name)
+}
+
+// loadFile reads and checks a template file; its name is the file name
+func loadFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %v", err)
+	}
+	var template Template
+	if err := json.Unmarshal(data, &template); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %v", path, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	if template.Name != "" && template.Name != name {
+		return nil, fmt.Errorf("template %s is named %q; name the file %s.json", path, template.Name, template.Name)
+	}
+	template.Name = name
+	template.Source = path
+	if err := template.Check(); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", path, err)
+	}
+	return &template, nil
+}
+
+// Check verifies that the template is well formed: a known kind and body,
+// parameters of known types and placeholders that name parameters
+func (t *Template) Check() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name %q", t.Name)
+	}
+
+	var body string
+	switch t.Kind {
+	case KindTypedData:
+		if len(t.TypedData) == 0 || t.Message != "" {
+			return fmt.Errorf("typed data templates need typedData and no message")
+		}
+		// The domain holds placeholders where values are expected
+		var typedData struct {
+			Types       map[string]json.RawMessage `json:"types"`
+			PrimaryType string                     `json:"primaryType"`
+		}
+		if err := json.Unmarshal(t.TypedData, &typedData); err != nil {
+			return fmt.Errorf("failed to parse typed data: %v", err)
+		}
+		if _, ok := typedData.Types[typedData.PrimaryType]; !ok {
+			return fmt.Errorf("primary type %q is not declared", typedData.PrimaryType)
+		}
+		body = string(t.TypedData)
+	case KindMessage:
+		if t.Message == "" || len(t.TypedData) != 0 {
+			return fmt.Errorf("message templates need a message and no typedData")
+		}
+		body = t.Message
+	default:
+		return fmt.Errorf("unknown kind %q (expected %s or %s)", t.Kind, KindTypedData, KindMessage)
+	}
+
+	declared := make(map[string]bool)
+	for _, param := range t.Params {
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %q is declared twice", param.Name)
+		}
+		if !knownType(param.Type) {
+			return fmt.Errorf("parameter %s has unknown type %q", param.Name, param.Type)
+		}
+		declared[param.Name] = true
+		if param.Default != nil {
+			for _, match := range placeholderPattern.FindAllStringSubmatch(*param.Default, -1) {
+				if !contextValues[match[1]] {
+					return fmt.Errorf("default of %s refers to %q, which is not a context value", param.Name, match[1])
+				}
+			}
+		}
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(body, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("placeholder {{%s}} is not a declared parameter", match[1])
+		}
+	}
+	return nil
+}
+
+// Instantiate fills the template with values, falling back to the parameter
+// defaults, and validates the result: every value against its parameter type
+// and typed data against its EIP-712 types
+func (t *Template) Instantiate(values map[string]string, ctx Context) (*Instance, error) {
+	if err := t.Check(); err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string)
+	var missing []string
+	for _, param := range t.Params {
+		value, ok := values[param.Name]
+		if !ok {
+			if param.Default == nil {
+				missing = append(missing, param.Name)
+				continue
+			}
+			var err error
+			value, err = expandDefault(*param.Default, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("default of %s: %v", param.Name, err)
+			}
+		}
+		normalized, err := checkValue(param.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", param.Name, err)
+		}
+		if t.Kind == KindMessage && strings.ContainsAny(normalized, "\r\n") {
+			return nil, fmt.Errorf("invalid %s: message values cannot contain line breaks", param.Name)
+		}
+		resolved[param.Name] = normalized
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing parameters: %s", strings.Join(missing, ", "))
+	}
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			return nil, fmt.Errorf("template %s has no parameter %q", t.Name, name)
+		}
+	}
+
+	instance := &Instance{Template: t, Values: resolved}
+	if t.Kind == KindMessage {
+		instance.Message = substitute(t.Message, resolved)
+		return instance, nil
+	}
+
+	// Placeholders that make up a whole JSON string become the typed value
+	decoder := json.NewDecoder(bytes.NewReader(t.TypedData))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to parse typed data: %v", err)
+	}
+	data, err := json.Marshal(t.fill(body, resolved))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode typed data: %v", err)
+	}
+	typedData, err := core.ParseTypedData(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := typedData.Validate(); err != nil {
+		return nil, fmt.Errorf("instantiated typed data does not match its types: %v", err)
+	}
+	instance.TypedData = typedData
+	return instance, nil
+}
+
+// fill replaces the placeholders in a decoded JSON value
+func (t *Template) fill(value interface{}, values map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = t.fill(item, values)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = t.fill(item, values)
+		}
+		return v
+	case string:
+		if match := placeholderPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			if t.param(match[1]).Type == "bool" {
+				return values[match[1]] == "true"
+			}
+			return values[match[1]]
+		}
+		return substitute(v, values)
+	default:
+		return v
+	}
+}
+
+// param returns the declared parameter of a name
+func (t *Template) param(name string) Param {
+	for _, param := range t.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return Param{}
+}
+
+// substitute replaces the placeholders of text
+func substitute(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		return values[placeholder[2:len(placeholder)-2]]
+	})
+}
+
+// expandDefault fills the context values of a parameter default
+func expandDefault(value string, ctx Context) (string, error) {
+	var err error
+	expanded := placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		switch placeholder[2 : len(placeholder)-2] {
+		case "signer":
+			return ctx.Signer.Hex()
+		case "chainId":
+			if ctx.ChainID == nil {
+				err = fmt.Errorf("no chain ID given")
+				return ""
+			}
+			return ctx.ChainID.String()
+		case "now":
+			return ctx.Now.UTC().Format(time.RFC3339)
+		case "random":
+			var nonce string
+			nonce, err = randomNonce()
+			return nonce
+		}
+		return placeholder
+	})
+	return expanded, err
+}
+
+// randomNonce returns 16 random alphanumeric characters, as used by Sign-In
+// with Ethereum nonces
+func randomNonce() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	nonce := make([]byte, 16)
+	for i := range nonce {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate nonce: %v", err)
+		}
+		nonce[i] = alphabet[n.Int64()]
+	}
+	return string(nonce), nil
+}
+
+// knownType reports whether a parameter type is supported: string, address,
+// bool, bytes, datetime, bytes1 to bytes32 and the Solidity integer types
+func knownType(typ string) bool {
+	switch typ {
+	case "string", "address", "bool", "bytes", "datetime":
+		return true
+	}
+	match := sizedTypePattern.FindStringSubmatch(typ)
+	if match == nil {
+		return false
+	}
+	size, _ := strconv.Atoi(match[2])
+	if match[1] == "bytes" {
+		return size >= 1 && size <= 32
+	}
+	return size >= 8 && size <= 256 && size%8 == 0
+}
+
+// checkValue validates a value against a parameter type and returns it in
+// canonical form: checksummed addresses, decimal integers and lower case hex
+func checkValue(typ, value string) (string, error) {
+	switch typ {
+	case "string":
+		return value, nil
+	case "address":
+		if !common.IsHexAddress(value) {
+			return "", fmt.Errorf("%q is not an address", value)
+		}
+		return common.HexToAddress(value).Hex(), nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a bool", value)
+		}
+		return strconv.FormatBool(b), nil
+	case "bytes":
+		if !isHex(value) {
+			return "", fmt.Errorf("%q is not 0x-prefixed hex", value)
+		}
+		return strings.ToLower(value), nil
+	case "datetime":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an RFC 3339 time", value)
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	}
+
+	if !knownType(typ) {
+		return "", fmt.Errorf("unknown type %q", typ)
+	}
+	match := sizedTypePattern.FindStringSubmatch(typ)
+	size, _ := strconv.Atoi(match[2])
+	if match[1] == "bytes" {
+		if !isHex(value) || len(value) != 2+2*size {
+			return "", fmt.Errorf("%q is not %d bytes of 0x-prefixed hex", value, size)
+		}
+		return strings.ToLower(value), nil
+	}
+
+	n, ok := new(big.Int).SetString(value, 10)
+	if strings.HasPrefix(value, "0x") {
+		n, ok = new(big.Int).SetString(value[2:], 16)
+	}
+	if !ok {
+		return "", fmt.Errorf("%q is not a decimal or 0x-prefixed hex integer", value)
+	}
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(size))
+	if match[1] == "int" {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+		return "", fmt.Errorf("%s is out of range for %s", value, typ)
+	}
+	return n.String(), nil
+}
+
+// isHex reports whether a value is 0x-prefixed hex of whole bytes
+func isHex(value string) bool {
+	if !strings.HasPrefix(value, "0x") || len(value)%2 != 0 {
+		return false
+	}
+	for _, c := range value[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
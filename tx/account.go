@@ -0,0 +1,143 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// TokenBalance is the balance of an ERC-20 token held by an address
+type TokenBalance struct {
+	TokenSnapshot
+	Balance *big.Int `json:"balance"`
+}
+
+// AccountInfo is the state of an address on a chain at the latest block
+type AccountInfo struct {
+	AccountSnapshot
+	ChainID      *big.Int       `json:"chainId"`
+	BlockNumber  uint64         `json:"blockNumber"`
+	PendingNonce uint64         `json:"pendingNonce"`
+	Tokens       []TokenBalance `json:"tokens,omitempty"`
+}
+
+// FetchAccountInfo queries the native balance, nonces and token balances of an address
+func FetchAccountInfo(ctx context.Context, rpcURL string, address common.Address, tokens []common.Address) (*AccountInfo, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %v", err)
+	}
+
+	// Pin every query to the same block so the balances are consistent
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+
+	balance, err := client.BalanceAt(ctx, address, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance of %s: %v", address.Hex(), err)
+	}
+	nonce, err := client.NonceAt(ctx, address, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce of %s: %v", address.Hex(), err)
+	}
+	pendingNonce, err := client.PendingNonceAt(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending nonce of %s: %v", address.Hex(), err)
+	}
+	code, err := client.CodeAt(ctx, address, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get code of %s: %v", address.Hex(), err)
+	}
+
+	info := &AccountInfo{
+		AccountSnapshot: AccountSnapshot{
+			Address:    address,
+			Balance:    balance,
+			Nonce:      nonce,
+			CodeHash:   crypto.Keccak256Hash(code),
+			IsContract: len(code) > 0,
+		},
+		ChainID:      chainID,
+		BlockNumber:  header.Number.Uint64(),
+		PendingNonce: pendingNonce,
+	}
+
+	for _, token := range tokens {
+		tokenBalance, err := tokenBalanceOf(ctx, client, token, address, header.Number)
+		if err != nil {
+			return nil, err
+		}
+		info.Tokens = append(info.Tokens, *tokenBalance)
+	}
+
+	return info, nil
+}
+
+// FetchBalances queries the native balances and nonces of addresses at the
+// latest block, e.g. to find which of many derived accounts were used
+func FetchBalances(ctx context.Context, rpcURL string, addresses []common.Address) ([]AccountSnapshot, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+	snapshots := make([]AccountSnapshot, len(addresses))
+	for i, address := range addresses {
+		balance, err := client.BalanceAt(ctx, address, header.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance of %s: %v", address.Hex(), err)
+		}
+		nonce, err := client.NonceAt(ctx, address, header.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nonce of %s: %v", address.Hex(), err)
+		}
+		snapshots[i] = AccountSnapshot{Address: address, Balance: balance, Nonce: nonce}
+	}
+	return snapshots, nil
+}
+
+// tokenBalanceOf reads the metadata of a token and the balance an address holds
+func tokenBalanceOf(ctx context.Context, client *ethclient.Client, token, owner common.Address, block *big.Int) (*TokenBalance, error) {
+	metadata, err := tokenMetadata(ctx, client, token, block)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := core.EncodeERC20Call("balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: input}, block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance of token %s: %v", token.Hex(), err)
+	}
+	values, err := core.DecodeERC20Result("balanceOf", output)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected balanceOf result from token %s", token.Hex())
+	}
+
+	return &TokenBalance{TokenSnapshot: *metadata, Balance: balance}, nil
+}
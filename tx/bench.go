@@ -0,0 +1,286 @@
+package tx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBenchmarkFile is the default location of the endpoint benchmarks
+var DefaultBenchmarkFile = filepath.Join(historyDir, "benchmarks.json")
+
+const (
+	// BenchmarkMaxAge is how long a benchmark steers endpoint selection
+	BenchmarkMaxAge = 6 * time.Hour
+	// maxBenchmarkLag is how many blocks an endpoint may trail the best head
+	// and still count as healthy
+	maxBenchmarkLag = 2
+)
+
+// EndpointBenchmark is the latency and correctness of one RPC endpoint,
+// measured over a number of eth_blockNumber calls
+type EndpointBenchmark struct {
+	// Endpoint is the host only; URLs may carry API keys
+	Endpoint string        `json:"endpoint"`
+	Time     time.Time     `json:"time"`
+	ChainID  *big.Int      `json:"chainId,omitempty"`
+	Samples  int           `json:"samples"`
+	Errors   int           `json:"errors"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	Head     uint64        `json:"head"`
+	// Lag is how many blocks the head trails the best head among the
+	// endpoints of the chain benchmarked together
+	Lag        uint64 `json:"lag"`
+	WrongChain bool   `json:"wrongChain,omitempty"`
+	Healthy    bool   `json:"healthy"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BenchmarkTarget is a chain and the endpoints serving it
+type BenchmarkTarget struct {
+	Name      string
+	ChainID   *big.Int
+	Endpoints []string
+}
+
+// BenchmarkEndpoints measures every endpoint of a chain in parallel, taking
+// samples calls each, and compares their heads. Endpoints that serve another
+// chain, fail half their calls or trail the best head are marked unhealthy.
+func BenchmarkEndpoints(ctx context.Context, chainID *big.Int, endpoints []string, samples int) []*EndpointBenchmark {
+	if samples < 1 {
+		samples = 1
+	}
+	results := make([]*EndpointBenchmark, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			results[i] = benchmarkEndpoint(ctx, endpoint, samples)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, result := range results {
+		result.WrongChain = result.ChainID != nil && chainID != nil && result.ChainID.Cmp(chainID) != 0
+		if result.Error == "" && !result.WrongChain && result.Head > best {
+			best = result.Head
+		}
+	}
+	for _, result := range results {
+		if result.Error != "" || result.WrongChain {
+			continue
+		}
+		result.Lag = best - result.Head
+		result.Healthy = result.Errors*2 < result.Samples && result.Lag <= maxBenchmarkLag
+	}
+	return results
+}
+
+// benchmarkEndpoint takes samples eth_blockNumber calls against one endpoint
+func benchmarkEndpoint(ctx context.Context, endpoint string, samples int) *EndpointBenchmark {
+	result := &EndpointBenchmark{Endpoint: endpointHost(endpoint), Time: time.Now(), Samples: samples}
+	client, err := dialEndpoint(ctx, endpoint)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		result.Error = rpcFailure(err).Error()
+		return result
+	}
+	result.ChainID = chainID
+
+	var latencies []time.Duration
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			result.Errors++
+			if ctx.Err() != nil {
+				result.Errors += samples - i - 1
+				break
+			}
+			continue
+		}
+		latencies = append(latencies, time.Since(start))
+		if head > result.Head {
+			result.Head = head
+		}
+	}
+	if len(latencies) == 0 {
+		result.Error = "no call succeeded"
+		return result
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.P50 = percentile(latencies, 50)
+	result.P95 = percentile(latencies, 95)
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Benchmarks stores the latest benchmark of each endpoint, keyed by a hash of
+// its URL so API keys in URLs stay out of the file
+type Benchmarks struct {
+	results  map[string]*EndpointBenchmark
+	mu       sync.RWMutex
+	filePath string
+}
+
+// OpenBenchmarks loads the benchmarks persisted at filePath. An empty
+// filePath keeps them in memory only.
+func OpenBenchmarks(filePath string) (*Benchmarks, error) {
+	b := &Benchmarks{results: make(map[string]*EndpointBenchmark), filePath: filePath}
+	if filePath == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read benchmarks: %v", err)
+	}
+	if err := json.Unmarshal(data, &b.results); err != nil {
+		return nil, fmt.Errorf("failed to parse benchmarks %s: %v", filePath, err)
+	}
+	return b, nil
+}
+
+// benchmarkKey identifies an endpoint without revealing its URL
+func benchmarkKey(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Get returns the latest benchmark of an endpoint
+func (b *Benchmarks) Get(endpoint string) (*EndpointBenchmark, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result, ok := b.results[benchmarkKey(endpoint)]
+	return result, ok
+}
+
+// Record stores the benchmarks of endpoints, in the same order, and saves them
+func (b *Benchmarks) Record(endpoints []string, results []*EndpointBenchmark) error {
+	b.mu.Lock()
+	for i, endpoint := range endpoints {
+		b.results[benchmarkKey(endpoint)] = results[i]
+	}
+	b.mu.Unlock()
+	return b.save()
+}
+
+// Rank orders endpoints for selection: endpoints with a healthy benchmark
+// younger than BenchmarkMaxAge come first, fastest p95 first, followed by
+// endpoints without a recent benchmark in their configured order and
+// finally the unhealthy ones
+func (b *Benchmarks) Rank(endpoints []string) []string {
+	class := func(endpoint string) (int, time.Duration) {
+		result, ok := b.Get(endpoint)
+		switch {
+		case !ok || time.Since(result.Time) > BenchmarkMaxAge:
+			return 1, 0
+		case result.Healthy:
+			return 0, result.P95
+		default:
+			return 2, 0
+		}
+	}
+	ranked := append([]string{}, endpoints...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ci, pi := class(ranked[i])
+		cj, pj := class(ranked[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return pi < pj
+	})
+	return ranked
+}
+
+// Run benchmarks the endpoints of targets every interval until ctx is done,
+// starting as soon as a benchmark is missing or older than interval
+func (b *Benchmarks) Run(ctx context.Context, targets []BenchmarkTarget, interval time.Duration, samples int) error {
+	next := b.due(targets, interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+		for _, target := range targets {
+			runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			results := BenchmarkEndpoints(runCtx, target.ChainID, target.Endpoints, samples)
+			cancel()
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := b.Record(target.Endpoints, results); err != nil {
+				return err
+			}
+		}
+		next = time.Now().Add(interval)
+	}
+}
+
+// due returns when the first benchmark of targets gets older than interval,
+// or now if an endpoint has none
+func (b *Benchmarks) due(targets []BenchmarkTarget, interval time.Duration) time.Time {
+	var next time.Time
+	for _, target := range targets {
+		for _, endpoint := range target.Endpoints {
+			result, ok := b.Get(endpoint)
+			if !ok {
+				return time.Now()
+			}
+			if due := result.Time.Add(interval); next.IsZero() || due.Before(next) {
+				next = due
+			}
+		}
+	}
+	return next
+}
+
+// save writes the benchmarks to file
+func (b *Benchmarks) save() error {
+	if b.filePath == "" {
+		return nil
+	}
+
+	b.mu.RLock()
+	data, err := json.MarshalIndent(b.results, "", "  ")
+	b.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal benchmarks: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(b.filePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write benchmarks: %v", err)
+	}
+	return nil
+}
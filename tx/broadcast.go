@@ -0,0 +1,130 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Broadcaster submits signed transactions to one of several RPC endpoints
+type Broadcaster struct {
+	// OnDelay is called with the random delay chosen in privacy mode
+	OnDelay func(delay time.Duration)
+	// OnAttempt is called after each endpoint was tried, with its error if it failed
+	OnAttempt func(endpoint string, err error)
+	// PollInterval is how often inclusion is checked, usually the chain's block
+	// time; zero uses a default
+	PollInterval time.Duration
+
+	endpoints []string
+	privacy   *PrivacyOptions
+}
+
+// NewBroadcaster creates a broadcaster over the given RPC endpoints, tried in order
+func NewBroadcaster(endpoints []string) (*Broadcaster, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("at least one RPC endpoint is required")
+	}
+
+	return &Broadcaster{
+		endpoints: endpoints,
+	}, nil
+}
+
+// SetPrivacy enables privacy mode: a random delay before each broadcast and a
+// randomly chosen endpoint per transaction instead of always the first one
+func (b *Broadcaster) SetPrivacy(opts *PrivacyOptions) {
+	b.privacy = opts
+}
+
+// Broadcast sends an RLP encoded signed transaction and returns its hash
+func (b *Broadcaster) Broadcast(ctx context.Context, rawTx []byte) (common.Hash, error) {
+	var signedTx types.Transaction
+	if err := signedTx.UnmarshalBinary(rawTx); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to decode signed transaction: %v", err)
+	}
+
+	endpoints, err := b.order()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// Wait a random amount of time so submission timing doesn't link operations
+	if b.privacy != nil {
+		delay, err := b.privacy.RandomDelay()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if b.OnDelay != nil {
+			b.OnDelay(delay)
+		}
+		select {
+		case <-ctx.Done():
+			return common.Hash{}, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	var errs []error
+	for _, endpoint := range endpoints {
+		err := send(ctx, endpoint, &signedTx)
+		if b.OnAttempt != nil {
+			b.OnAttempt(endpoint, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return signedTx.Hash(), nil
+	}
+
+	// Only an outage of every endpoint is an RPC failure; a rejection is not
+	for _, err := range errs {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			return common.Hash{}, fmt.Errorf("failed to broadcast transaction: %v", errors.Join(errs...))
+		}
+	}
+	return common.Hash{}, fmt.Errorf("failed to broadcast transaction: %w", errors.Join(errs...))
+}
+
+// order returns the endpoints in the order they should be tried
+func (b *Broadcaster) order() ([]string, error) {
+	endpoints := append([]string(nil), b.endpoints...)
+	if b.privacy == nil {
+		return endpoints, nil
+	}
+
+	// Shuffle so each transaction goes out through a different endpoint
+	for i := len(endpoints) - 1; i > 0; i-- {
+		j, err := randomInt(int64(i + 1))
+		if err != nil {
+			return nil, err
+		}
+		endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+	}
+	return endpoints, nil
+}
+
+// send submits a transaction through a single endpoint
+func send(ctx context.Context, endpoint string, signedTx *types.Transaction) error {
+	client, pooled, err := pooledDial(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if !pooled {
+		defer client.Close()
+	}
+
+	_, err = call(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, client.SendTransaction(ctx, signedTx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send transaction: %w", err)
+	}
+	return nil
+}
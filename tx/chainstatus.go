@@ -0,0 +1,87 @@
+package tx
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EndpointStatus is the chain head as served by one RPC endpoint. Fields an
+// endpoint does not support stay unset.
+type EndpointStatus struct {
+	Endpoint  string        `json:"endpoint"`
+	ChainID   *big.Int      `json:"chainId,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	Latest    *uint64       `json:"latest,omitempty"`
+	Safe      *uint64       `json:"safe,omitempty"`
+	Finalized *uint64       `json:"finalized,omitempty"`
+	BaseFee   *big.Int      `json:"baseFee,omitempty"`
+	HeadTime  time.Time     `json:"headTime,omitempty"`
+	// HeadAge is the local clock minus the timestamp of the latest block; a
+	// negative age means the local clock is behind the chain
+	HeadAge time.Duration `json:"headAge"`
+	// Syncing is set while the node catches up, with its current and highest
+	// known block
+	Syncing     bool    `json:"syncing"`
+	SyncCurrent uint64  `json:"syncCurrent,omitempty"`
+	SyncHighest uint64  `json:"syncHighest,omitempty"`
+	Peers       *uint64 `json:"peers,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// CheckEndpoint reads the head, safe and finalized blocks, sync state and
+// peer count of a single RPC endpoint, without falling back to others
+func CheckEndpoint(ctx context.Context, rpcURL string) *EndpointStatus {
+	status := &EndpointStatus{Endpoint: rpcURL}
+	start := time.Now()
+	client, err := dialEndpoint(ctx, rpcURL)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		status.Error = rpcFailure(err).Error()
+		return status
+	}
+	status.ChainID = chainID
+	status.Latency = time.Since(start)
+
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		status.Error = rpcFailure(err).Error()
+		return status
+	}
+	latest := head.Number.Uint64()
+	status.Latest = &latest
+	status.BaseFee = head.BaseFee
+	status.HeadTime = time.Unix(int64(head.Time), 0)
+	status.HeadAge = time.Since(status.HeadTime)
+
+	// Endpoints without the safe and finalized tags predate the merge or proxy
+	// another chain; leave them unset
+	if header, err := client.HeaderByNumber(ctx, big.NewInt(int64(rpc.SafeBlockNumber))); err == nil {
+		number := header.Number.Uint64()
+		status.Safe = &number
+	}
+	if header, err := client.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber))); err == nil {
+		number := header.Number.Uint64()
+		status.Finalized = &number
+	}
+
+	if progress, err := client.SyncProgress(ctx); err == nil && progress != nil {
+		status.Syncing = true
+		status.SyncCurrent, status.SyncHighest = progress.CurrentBlock, progress.HighestBlock
+	}
+	var peers hexutil.Uint64
+	if err := client.Client().CallContext(ctx, &peers, "net_peerCount"); err == nil {
+		count := uint64(peers)
+		status.Peers = &count
+	}
+	return status
+}
@@ -0,0 +1,200 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// LinkScheme is the URI scheme of signature request deep links
+const LinkScheme = "gosigner"
+
+// maxLinkPayload bounds payloads fetched for a deep link
+const maxLinkPayload = 1 << 20
+
+// SignLink is a signature request handed to the local signer by a web tool,
+// as gosigner://sign?chain=NAME&payload=BASE64URL or
+// gosigner://sign?chain=NAME&url=URL&hash=KECCAK256, optionally with
+// &callback=URL to post the signed payload to. The link only carries the
+// request; the payload is reviewed and signed like any other.
+type SignLink struct {
+	Chain string
+	// Payload is the unsigned payload carried in the link itself
+	Payload []byte
+	// PayloadURL is where the payload is fetched from when the link does
+	// not carry it; PayloadHash is then required
+	PayloadURL  string
+	PayloadHash *common.Hash
+	Callback    string
+}
+
+// ParseSignLink parses and checks a gosigner:// deep link
+func ParseSignLink(link string) (*SignLink, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link: %v", err)
+	}
+	if u.Scheme != LinkScheme {
+		return nil, fmt.Errorf("invalid link: scheme is %q, not %s", u.Scheme, LinkScheme)
+	}
+	if u.Host != "sign" {
+		return nil, fmt.Errorf("unsupported link action %q (expected sign)", u.Host)
+	}
+
+	query := u.Query()
+	parsed := &SignLink{
+		Chain:      query.Get("chain"),
+		PayloadURL: query.Get("url"),
+		Callback:   query.Get("callback"),
+	}
+	if hash := query.Get("hash"); hash != "" {
+		hashBytes := common.FromHex(hash)
+		if len(hashBytes) != common.HashLength {
+			return nil, fmt.Errorf("invalid payload hash: %s", hash)
+		}
+		payloadHash := common.BytesToHash(hashBytes)
+		parsed.PayloadHash = &payloadHash
+	}
+	if payload := query.Get("payload"); payload != "" {
+		parsed.Payload, err = base64.RawURLEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload in link: %v", err)
+		}
+	}
+
+	switch {
+	case parsed.Payload == nil && parsed.PayloadURL == "":
+		return nil, errors.New("link carries neither a payload nor a payload URL")
+	case parsed.Payload != nil && parsed.PayloadURL != "":
+		return nil, errors.New("link carries both a payload and a payload URL")
+	case parsed.PayloadURL != "" && parsed.PayloadHash == nil:
+		return nil, errors.New("a link with a payload URL needs the payload hash")
+	}
+	if parsed.PayloadURL != "" {
+		if err := checkLinkURL(parsed.PayloadURL); err != nil {
+			return nil, fmt.Errorf("invalid payload URL: %v", err)
+		}
+	}
+	if parsed.Callback != "" {
+		if err := checkLinkURL(parsed.Callback); err != nil {
+			return nil, fmt.Errorf("invalid callback: %v", err)
+		}
+	}
+	return parsed, nil
+}
+
+// checkLinkURL accepts https URLs, and http only on the loopback interface
+// where local dashboards listen
+func checkLinkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+		return fmt.Errorf("%s must use https unless it is on localhost", u.Host)
+	}
+	return fmt.Errorf("unsupported scheme %q", u.Scheme)
+}
+
+// String encodes the link as a gosigner:// URI
+func (l *SignLink) String() string {
+	query := url.Values{}
+	if l.Chain != "" {
+		query.Set("chain", l.Chain)
+	}
+	if l.Payload != nil {
+		query.Set("payload", base64.RawURLEncoding.EncodeToString(l.Payload))
+	}
+	if l.PayloadURL != "" {
+		query.Set("url", l.PayloadURL)
+	}
+	if l.PayloadHash != nil {
+		query.Set("hash", l.PayloadHash.Hex())
+	}
+	if l.Callback != "" {
+		query.Set("callback", l.Callback)
+	}
+	return (&url.URL{Scheme: LinkScheme, Host: "sign", RawQuery: query.Encode()}).String()
+}
+
+// FetchPayload returns the unsigned payload of the link, downloading it from
+// the payload URL if needed. A payload hash given in the link must match the
+// keccak256 of the payload bytes.
+func (l *SignLink) FetchPayload(ctx context.Context) ([]byte, error) {
+	data := l.Payload
+	if data == nil {
+		client, err := HTTPClient(l.PayloadURL)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.PayloadURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create payload request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch payload: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("payload URL returned %s", resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxLinkPayload+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload: %v", err)
+		}
+		if len(data) > maxLinkPayload {
+			return nil, fmt.Errorf("payload exceeds %d bytes", maxLinkPayload)
+		}
+	}
+
+	if l.PayloadHash != nil {
+		if hash := crypto.Keccak256Hash(data); hash != *l.PayloadHash {
+			return nil, fmt.Errorf("payload hash is %s, but the link expects %s", hash.Hex(), l.PayloadHash.Hex())
+		}
+	}
+	return data, nil
+}
+
+// PostSigned posts a signed payload as JSON to the callback of the link
+func (l *SignLink) PostSigned(ctx context.Context, payload *SignedPayload) error {
+	client, err := HTTPClient(l.Callback)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signed payload: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.Callback, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to callback: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DNS record types queried over DoH
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// DoHResolver resolves hostnames with DNS-over-HTTPS using the JSON API
+// (application/dns-json) offered by Cloudflare, Google and most providers
+type DoHResolver struct {
+	endpoint string
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[string]dohEntry
+}
+
+type dohEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		TTL  int    `json:"TTL"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// NewDoHResolver creates a resolver for a DoH endpoint. The endpoint should use
+// an IP address (e.g. https://1.1.1.1/dns-query) so that no plaintext DNS lookup
+// is needed to reach it.
+func NewDoHResolver(endpoint string) (*DoHResolver, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DoH endpoint %q: %v", endpoint, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DoH endpoint %q: must be an https URL", endpoint)
+	}
+
+	transport := &http.Transport{
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if proxy := proxyFor(endpoint); proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &DoHResolver{
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		cache:    make(map[string]dohEntry),
+	}, nil
+}
+
+// LookupHost resolves a hostname to its IPv4 and IPv6 addresses
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	entry, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	var addrs []string
+	ttl := time.Hour
+	for _, qtype := range []int{dnsTypeA, dnsTypeAAAA} {
+		answers, minTTL, err := r.query(ctx, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, answers...)
+		if len(answers) > 0 {
+			ttl = min(ttl, minTTL)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("DoH lookup for %s returned no addresses", host)
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+
+	return addrs, nil
+}
+
+// query performs a single DoH query and returns the matching answers
+func (r *DoHResolver) query(ctx context.Context, host string, qtype int) ([]string, time.Duration, error) {
+	u, _ := url.Parse(r.endpoint)
+	q := u.Query()
+	q.Set("name", host)
+	q.Set("type", fmt.Sprint(qtype))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create DoH request: %v", err)
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query DoH resolver: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH resolver returned %s", resp.Status)
+	}
+
+	var result dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode DoH response: %v", err)
+	}
+	if result.Status != 0 {
+		return nil, 0, fmt.Errorf("DoH lookup for %s failed with rcode %d", host, result.Status)
+	}
+
+	var addrs []string
+	ttl := time.Hour
+	for _, answer := range result.Answer {
+		if answer.Type != qtype || net.ParseIP(answer.Data) == nil {
+			continue
+		}
+		addrs = append(addrs, answer.Data)
+		ttl = min(ttl, time.Duration(answer.TTL)*time.Second)
+	}
+
+	return addrs, ttl, nil
+}
+
+// DialContext resolves the address with DoH and dials the first reachable IP
+func (r *DoHResolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
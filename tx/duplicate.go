@@ -0,0 +1,57 @@
+package tx
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DuplicateWarn prints a warning when an identical transaction was signed recently
+	DuplicateWarn = "warn"
+	// DuplicateBlock refuses to sign an identical transaction unless overridden
+	DuplicateBlock = "block"
+	// DuplicateOff disables duplicate detection
+	DuplicateOff = "off"
+)
+
+// DuplicatePolicy controls how signing an identical (to, value, data, chain)
+// transaction within a short window is handled
+type DuplicatePolicy struct {
+	Mode   string        `json:"mode"`
+	Window time.Duration `json:"window"`
+}
+
+// DefaultDuplicatePolicy returns the policy used when none is configured
+func DefaultDuplicatePolicy() DuplicatePolicy {
+	return DuplicatePolicy{
+		Mode:   DuplicateWarn,
+		Window: 10 * time.Minute,
+	}
+}
+
+// Validate checks that the policy mode and window are usable
+func (p DuplicatePolicy) Validate() error {
+	switch p.Mode {
+	case DuplicateWarn, DuplicateBlock, DuplicateOff:
+	default:
+		return fmt.Errorf("invalid duplicate policy mode %q (expected warn, block or off)", p.Mode)
+	}
+	if p.Window < 0 {
+		return fmt.Errorf("duplicate window must not be negative")
+	}
+	return nil
+}
+
+// Check looks up a recent duplicate in the history. It returns the matching
+// record (if any) and whether signing should be blocked under this policy.
+func (p DuplicatePolicy) Check(h *History, to, value, data, chainID string) (*TransactionRecord, bool) {
+	if p.Mode == DuplicateOff {
+		return nil, false
+	}
+
+	record := h.FindDuplicate(to, value, data, chainID, time.Now().Add(-p.Window))
+	if record == nil {
+		return nil, false
+	}
+	return record, p.Mode == DuplicateBlock
+}
@@ -0,0 +1,325 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// BalanceChange is the net change of one asset balance of one account. Token
+// is nil for the native currency.
+type BalanceChange struct {
+	Account  common.Address  `json:"account"`
+	Token    *common.Address `json:"token,omitempty"`
+	Symbol   string          `json:"symbol,omitempty"`
+	Decimals uint8           `json:"decimals"`
+	Delta    *big.Int        `json:"delta"`
+}
+
+// Effects are the net balance changes of a simulated transaction. The fee is
+// kept apart from the sender's native balance change so that a declared
+// "send 1 ETH" matches a transfer of exactly 1 ETH.
+type Effects struct {
+	Sender  common.Address  `json:"sender"`
+	Fee     *big.Int        `json:"fee"`
+	Changes []BalanceChange `json:"changes,omitempty"`
+}
+
+// Expectation directions
+const (
+	ExpectSend    = "send"
+	ExpectReceive = "receive"
+	ExpectFee     = "fee"
+)
+
+// Expectation is a balance change of the sender declared before signing, e.g.
+// "send 1.0 ETH", "receive >=1800 USDC" or "fee <=0.01 ETH". Asset is a token
+// symbol or address; the native currency goes by its symbol or "native".
+type Expectation struct {
+	Direction  string   `json:"direction"`
+	Comparator string   `json:"comparator"`
+	Amount     *big.Rat `json:"amount"`
+	Asset      string   `json:"asset"`
+}
+
+// ParseExpectation parses an expectation of the form DIRECTION [CMP]AMOUNT
+// ASSET, where CMP is one of =, >= or <= and defaults to an exact match
+func ParseExpectation(s string) (*Expectation, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 4 && (fields[1] == ">=" || fields[1] == "<=" || fields[1] == "=") {
+		fields = []string{fields[0], fields[1] + fields[2], fields[3]}
+	}
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid expectation %q (expected e.g. \"send 1.0 ETH\" or \"receive >=1800 USDC\")", s)
+	}
+
+	expectation := &Expectation{Direction: strings.ToLower(fields[0]), Comparator: "=", Asset: fields[2]}
+	switch expectation.Direction {
+	case ExpectSend, ExpectReceive, ExpectFee:
+	default:
+		return nil, fmt.Errorf("invalid expectation %q: direction must be send, receive or fee", s)
+	}
+
+	amount := fields[1]
+	for _, cmp := range []string{">=", "<=", "="} {
+		if strings.HasPrefix(amount, cmp) {
+			expectation.Comparator = cmp
+			amount = amount[len(cmp):]
+			break
+		}
+	}
+	value, err := core.ParseDecimal(strings.ReplaceAll(amount, ",", ""))
+	if err != nil || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid expectation %q: invalid amount %q", s, amount)
+	}
+	expectation.Amount = value
+	return expectation, nil
+}
+
+// String formats the expectation as it is parsed
+func (e *Expectation) String() string {
+	cmp := ""
+	if e.Comparator != "=" {
+		cmp = e.Comparator
+	}
+	return fmt.Sprintf("%s %s%s %s", e.Direction, cmp, e.Amount.RatString(), e.Asset)
+}
+
+// matches reports whether an amount satisfies the expectation
+func (e *Expectation) matches(amount *big.Rat) bool {
+	cmp := amount.Cmp(e.Amount)
+	switch e.Comparator {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// computeEffects derives the net balance changes of a successful trace. Value
+// moved by calls and self-destructs that did not revert counts toward the
+// native balances, ERC-20 Transfer events toward the token balances.
+func computeEffects(sender common.Address, frame *CallFrame, fee *big.Int) *Effects {
+	type key struct {
+		account common.Address
+		token   common.Address
+		native  bool
+	}
+	deltas := make(map[key]*big.Int)
+	move := func(from, to common.Address, token common.Address, native bool, amount *big.Int) {
+		debit := key{account: from, token: token, native: native}
+		credit := key{account: to, token: token, native: native}
+		for _, k := range []key{debit, credit} {
+			if deltas[k] == nil {
+				deltas[k] = new(big.Int)
+			}
+		}
+		deltas[debit].Sub(deltas[debit], amount)
+		deltas[credit].Add(deltas[credit], amount)
+	}
+
+	var walk func(frame *CallFrame)
+	walk = func(frame *CallFrame) {
+		if frame.Error != "" {
+			return
+		}
+		// Delegate calls report the value of their parent without moving it
+		if frame.Type != "DELEGATECALL" && frame.Type != "STATICCALL" && frame.To != nil &&
+			frame.Value != nil && frame.Value.ToInt().Sign() > 0 {
+			move(frame.From, *frame.To, common.Address{}, true, frame.Value.ToInt())
+		}
+		for i := range frame.Calls {
+			walk(&frame.Calls[i])
+		}
+	}
+	walk(frame)
+	for _, transfer := range TokenTransfers(frame) {
+		if transfer.Value != nil {
+			move(transfer.From, transfer.To, transfer.Token, false, transfer.Value)
+		}
+	}
+
+	effects := &Effects{Sender: sender, Fee: fee}
+	for k, delta := range deltas {
+		if delta.Sign() == 0 {
+			continue
+		}
+		change := BalanceChange{Account: k.account, Delta: delta}
+		if !k.native {
+			token := k.token
+			change.Token = &token
+		}
+		effects.Changes = append(effects.Changes, change)
+	}
+
+	// Sender first, then by account and asset
+	sort.Slice(effects.Changes, func(i, j int) bool {
+		a, b := effects.Changes[i], effects.Changes[j]
+		if (a.Account == sender) != (b.Account == sender) {
+			return a.Account == sender
+		}
+		if a.Account != b.Account {
+			return a.Account.Hex() < b.Account.Hex()
+		}
+		if (a.Token == nil) != (b.Token == nil) {
+			return a.Token == nil
+		}
+		return a.Token != nil && a.Token.Hex() < b.Token.Hex()
+	})
+	return effects
+}
+
+// describeTokens fills in the symbol and decimals of the token changes. Tokens
+// whose metadata cannot be read are left in base units.
+func (e *Effects) describeTokens(ctx context.Context, client *ethclient.Client, block *big.Int) {
+	metadata := make(map[common.Address]*TokenSnapshot)
+	for i := range e.Changes {
+		change := &e.Changes[i]
+		if change.Token == nil {
+			continue
+		}
+		token, ok := metadata[*change.Token]
+		if !ok {
+			token, _ = tokenMetadata(ctx, client, *change.Token, block)
+			metadata[*change.Token] = token
+		}
+		if token != nil {
+			change.Symbol = token.Symbol
+			change.Decimals = token.Decimals
+		}
+	}
+}
+
+// SenderChanges returns the balance changes of the sender
+func (e *Effects) SenderChanges() []BalanceChange {
+	var changes []BalanceChange
+	for _, change := range e.Changes {
+		if change.Account == e.Sender {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Summary describes the sender's side of the effects in one line, e.g. "you
+// send 1 ETH, receive 1832 USDC, pay 0.004 ETH fee". nativeSymbol and
+// nativeDecimals describe the chain's native currency.
+func (e *Effects) Summary(nativeSymbol string, nativeDecimals uint8) string {
+	var parts []string
+	for _, change := range e.SenderChanges() {
+		verb := "receive"
+		if change.Delta.Sign() < 0 {
+			verb = "send"
+		}
+		amount := new(big.Int).Abs(change.Delta)
+		parts = append(parts, verb+" "+change.Format(amount, nativeSymbol, nativeDecimals))
+	}
+	if e.Fee != nil && e.Fee.Sign() > 0 {
+		parts = append(parts, fmt.Sprintf("pay %s %s fee", core.FormatTokenAmount(e.Fee, nativeDecimals), nativeSymbol))
+	}
+	if len(parts) == 0 {
+		return "you send and receive nothing"
+	}
+	return "you " + strings.Join(parts, ", ")
+}
+
+// Format formats an amount of the changed asset with its symbol. Tokens of
+// unknown metadata are shown in base units with their address.
+func (c *BalanceChange) Format(amount *big.Int, nativeSymbol string, nativeDecimals uint8) string {
+	switch {
+	case c.Token == nil:
+		return core.FormatTokenAmount(amount, nativeDecimals) + " " + nativeSymbol
+	case c.Symbol == "":
+		return fmt.Sprintf("%s base units of %s", amount, c.Token.Hex())
+	default:
+		return core.FormatTokenAmount(amount, c.Decimals) + " " + c.Symbol
+	}
+}
+
+// asset reports whether the change is of the named asset: a token symbol or
+// address, or the native symbol or "native"
+func (c *BalanceChange) asset(name, nativeSymbol string) bool {
+	if c.Token == nil {
+		return strings.EqualFold(name, nativeSymbol) || strings.EqualFold(name, "native")
+	}
+	if common.IsHexAddress(name) {
+		return common.HexToAddress(name) == *c.Token
+	}
+	return c.Symbol != "" && strings.EqualFold(name, c.Symbol)
+}
+
+// Check compares the sender's balance changes with the declared expectations
+// and returns every mismatch. Each change of the sender must be declared, so
+// calldata that moves more assets than advertised is caught.
+func (e *Effects) Check(expectations []*Expectation, nativeSymbol string, nativeDecimals uint8) []string {
+	var mismatches []string
+	declared := make([]bool, len(e.Changes))
+	for _, expectation := range expectations {
+		if expectation.Direction == ExpectFee {
+			if !strings.EqualFold(expectation.Asset, nativeSymbol) && !strings.EqualFold(expectation.Asset, "native") {
+				mismatches = append(mismatches, fmt.Sprintf("%s: the fee is paid in %s", expectation, nativeSymbol))
+				continue
+			}
+			fee := e.Fee
+			if fee == nil {
+				fee = new(big.Int)
+			}
+			if !expectation.matches(scaleDown(fee, nativeDecimals)) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: fee is %s %s", expectation, core.FormatTokenAmount(fee, nativeDecimals), nativeSymbol))
+			}
+			continue
+		}
+
+		found := false
+		for i, change := range e.Changes {
+			if change.Account != e.Sender || !change.asset(expectation.Asset, nativeSymbol) {
+				continue
+			}
+			found = true
+			declared[i] = true
+
+			decimals := change.Decimals
+			if change.Token == nil {
+				decimals = nativeDecimals
+			}
+			amount := new(big.Int).Abs(change.Delta)
+			verb := "receives"
+			if change.Delta.Sign() < 0 {
+				verb = "sends"
+			}
+			if (expectation.Direction == ExpectSend) != (change.Delta.Sign() < 0) || !expectation.matches(scaleDown(amount, decimals)) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: sender %s %s", expectation, verb, change.Format(amount, nativeSymbol, nativeDecimals)))
+			}
+		}
+		if !found && expectation.Amount.Sign() != 0 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: the balance of %s does not change", expectation, expectation.Asset))
+		}
+	}
+
+	for i, change := range e.Changes {
+		if change.Account != e.Sender || declared[i] {
+			continue
+		}
+		verb := "receives"
+		if change.Delta.Sign() < 0 {
+			verb = "sends"
+		}
+		amount := new(big.Int).Abs(change.Delta)
+		mismatches = append(mismatches, fmt.Sprintf("undeclared: sender %s %s", verb, change.Format(amount, nativeSymbol, nativeDecimals)))
+	}
+	return mismatches
+}
+
+// scaleDown converts base units to a decimal amount
+func scaleDown(value *big.Int, decimals uint8) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(value, scale)
+}
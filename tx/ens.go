@@ -0,0 +1,39 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+)
+
+// rpcCaller makes contract calls through an RPC endpoint
+type rpcCaller struct {
+	rpcURL string
+}
+
+// CallContract implements ethereum.ContractCaller
+func (c *rpcCaller) CallContract(ctx context.Context, call ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	client, err := dial(ctx, c.rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	output, err := client.CallContract(ctx, call, block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %v", call.To.Hex(), err)
+	}
+	return output, nil
+}
+
+// NewENSResolver returns a resolver on the ENS registry of a chain
+func NewENSResolver(chain *core.ChainConfig) (*core.ENSResolver, error) {
+	registry, ok := chain.ENS()
+	if !ok {
+		return nil, fmt.Errorf("chain %s has no ENS registry (set ensRegistry in the chain config)", chain.Name)
+	}
+	return core.NewENSResolver(&rpcCaller{rpcURL: chain.RPCURL}, registry), nil
+}
@@ -0,0 +1,80 @@
+package tx
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors returned by RPC operations, for errors.Is. Failures to reach an
+// endpoint match ErrRPCUnavailable; transactions the node rejected match one
+// of the rejection errors.
+var (
+	// ErrRPCUnavailable matches every RPCError
+	ErrRPCUnavailable = errors.New("RPC endpoint unavailable")
+	// ErrRateLimited matches RPCErrors of providers refusing requests over
+	// their rate limit
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrNonceTooLow is returned when the nonce of a transaction was already used
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrNonceTooHigh is returned when a transaction leaves a gap in the nonces
+	ErrNonceTooHigh = errors.New("nonce too high")
+	// ErrInsufficientFunds is returned when the sender cannot pay for gas and value
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrUnderpriced is returned when a transaction or replacement pays too little
+	ErrUnderpriced = errors.New("transaction underpriced")
+	// ErrAlreadyKnown is returned when the node already has the transaction
+	ErrAlreadyKnown = errors.New("transaction already known")
+	// ErrReverted is returned when a call or gas estimate reverts
+	ErrReverted = errors.New("execution reverted")
+)
+
+// rejections maps the messages nodes answer with to their errors. Geth,
+// Erigon, Nethermind and Besu use these phrases or contain them.
+var rejections = []struct {
+	phrase string
+	err    error
+}{
+	{"nonce too low", ErrNonceTooLow},
+	{"nonce has already been used", ErrNonceTooLow},
+	{"oldnonce", ErrNonceTooLow},
+	{"nonce too high", ErrNonceTooHigh},
+	{"insufficient funds", ErrInsufficientFunds},
+	{"underpriced", ErrUnderpriced},
+	{"already known", ErrAlreadyKnown},
+	{"alreadyknown", ErrAlreadyKnown},
+	{"known transaction", ErrAlreadyKnown},
+	{"execution reverted", ErrReverted},
+}
+
+// NodeError is an error the node answered an RPC call with. Kind is the
+// matching rejection error, if any; errors.Is matches both Kind and the
+// original error.
+type NodeError struct {
+	Kind error
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the rejection error of the answer
+func (e *NodeError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// nodeError classifies an error the node answered with
+func nodeError(err error) error {
+	message := strings.ToLower(err.Error())
+	for _, rejection := range rejections {
+		if strings.Contains(message, rejection.phrase) {
+			return &NodeError{Kind: rejection.err, Err: err}
+		}
+	}
+	return &NodeError{Err: err}
+}
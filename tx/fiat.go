@@ -0,0 +1,321 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+)
+
+// DefaultPriceCacheFile is the default location of the cache of daily prices
+var DefaultPriceCacheFile = filepath.Join(historyDir, "prices.json")
+
+// CoinGeckoHistoryAPI is the public CoinGecko endpoint of a coin's price on a
+// past day
+const CoinGeckoHistoryAPI = "https://api.coingecko.com/api/v3/coins/%s/history"
+
+// priceDay is the layout of the days prices are kept by
+const priceDay = "2006-01-02"
+
+// HistoricalPriceSource prices the gas token of a chain on a past day
+type HistoricalPriceSource interface {
+	Name() string
+	// DailyPrices returns the prices of the gas token on a UTC day by
+	// lower-case currency code, e.g. "usd" or "eur"
+	DailyPrices(ctx context.Context, chain *core.ChainConfig, day time.Time) (map[string]float64, error)
+}
+
+// NewHistoricalPriceSource returns the historical price source named by spec:
+// "coingecko", or "file:PATH" for a JSON object of daily prices by token
+// symbol, day and currency, e.g. {"ETH": {"2026-03-02": {"USD": 3150.5}}}
+func NewHistoricalPriceSource(spec string) (HistoricalPriceSource, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "coingecko":
+		return coinGeckoSource{}, nil
+	case "chainlink":
+		return nil, errors.New("the chainlink price source has no historical prices; use coingecko or file:PATH")
+	case "file":
+		if path == "" {
+			return nil, errors.New("price source file: needs a path")
+		}
+		return loadPriceHistoryFile(path)
+	}
+	return nil, fmt.Errorf("unknown price source %q (expected coingecko or file:PATH)", spec)
+}
+
+// DailyPrices returns the CoinGecko prices of a gas token at 00:00 UTC of a day
+func (coinGeckoSource) DailyPrices(ctx context.Context, chain *core.ChainConfig, day time.Time) (map[string]float64, error) {
+	id, err := coinGeckoID(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf(CoinGeckoHistoryAPI, url.PathEscape(id))
+	client, err := HTTPClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"date": {day.UTC().Format("02-01-2006")}, "localization": {"false"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CoinGecko request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query CoinGecko: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CoinGecko returned %s", resp.Status)
+	}
+
+	var history struct {
+		MarketData *struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, fmt.Errorf("failed to decode CoinGecko response: %v", err)
+	}
+	if history.MarketData == nil || len(history.MarketData.CurrentPrice) == 0 {
+		return nil, fmt.Errorf("CoinGecko has no prices of %s on %s", id, day.UTC().Format(priceDay))
+	}
+	return history.MarketData.CurrentPrice, nil
+}
+
+// filePriceHistory prices gas tokens from a file of daily prices, for offline
+// use and for prices taken from an accountant's own source
+type filePriceHistory struct {
+	path string
+	// prices holds the prices by upper-case symbol, day and lower-case currency
+	prices map[string]map[string]map[string]float64
+}
+
+// loadPriceHistoryFile reads a JSON object of daily prices by token symbol
+func loadPriceHistoryFile(path string) (*filePriceHistory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %v", err)
+	}
+	var prices map[string]map[string]map[string]float64
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price file (expected daily prices by symbol, day and currency): %v", err)
+	}
+	source := &filePriceHistory{path: path, prices: make(map[string]map[string]map[string]float64)}
+	for symbol, days := range prices {
+		normalized := make(map[string]map[string]float64, len(days))
+		for day, currencies := range days {
+			if _, err := time.Parse(priceDay, day); err != nil {
+				return nil, fmt.Errorf("invalid day %q of %s in price file (expected 2006-01-02)", day, symbol)
+			}
+			normalized[day] = make(map[string]float64, len(currencies))
+			for currency, price := range currencies {
+				normalized[day][strings.ToLower(currency)] = price
+			}
+		}
+		source.prices[strings.ToUpper(symbol)] = normalized
+	}
+	return source, nil
+}
+
+func (s *filePriceHistory) Name() string { return "file:" + s.path }
+
+func (s *filePriceHistory) DailyPrices(ctx context.Context, chain *core.ChainConfig, day time.Time) (map[string]float64, error) {
+	symbol, _ := chain.GasTokenInfo()
+	prices, ok := s.prices[strings.ToUpper(symbol)][day.UTC().Format(priceDay)]
+	if !ok {
+		return nil, fmt.Errorf("%s has no price for %s on %s", s.path, symbol, day.UTC().Format(priceDay))
+	}
+	return prices, nil
+}
+
+// PriceHistory looks up the daily prices of gas tokens, keeping the prices of
+// past days in a local cache so each day is fetched once. Prices of the
+// current day still move and are only kept in memory.
+type PriceHistory struct {
+	source   HistoricalPriceSource
+	filePath string
+	// prices holds the prices by cache key and lower-case currency
+	prices map[string]map[string]float64
+	dirty  bool
+}
+
+// NewPriceHistory looks up prices with source, caching them at filePath. An
+// empty filePath keeps the cache in memory only.
+func NewPriceHistory(source HistoricalPriceSource, filePath string) (*PriceHistory, error) {
+	h := &PriceHistory{source: source, filePath: filePath, prices: make(map[string]map[string]float64)}
+	if filePath == "" {
+		return h, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price cache: %v", err)
+	}
+	if err := json.Unmarshal(data, &h.prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price cache: %v", err)
+	}
+	return h, nil
+}
+
+// Source returns the name of the price source
+func (h *PriceHistory) Source() string {
+	return h.source.Name()
+}
+
+// priceKey is the cache key of a gas token's prices on a day. Chains with a
+// priceId are kept apart from others sharing their symbol.
+func (h *PriceHistory) priceKey(chain *core.ChainConfig, day string) string {
+	asset, _ := chain.GasTokenInfo()
+	asset = strings.ToUpper(asset)
+	if chain.PriceID != "" {
+		asset = chain.PriceID
+	}
+	return h.source.Name() + "|" + asset + "|" + day
+}
+
+// Price returns the price of a chain's gas token in a currency on the UTC day
+// of at
+func (h *PriceHistory) Price(ctx context.Context, chain *core.ChainConfig, currency string, at time.Time) (float64, error) {
+	day := at.UTC().Truncate(24 * time.Hour)
+	key := h.priceKey(chain, day.Format(priceDay))
+	prices, ok := h.prices[key]
+	if !ok {
+		var err error
+		if prices, err = h.source.DailyPrices(ctx, chain, day); err != nil {
+			return 0, err
+		}
+		h.prices[key] = prices
+		h.dirty = true
+	}
+
+	price, ok := prices[strings.ToLower(currency)]
+	if !ok {
+		symbol, _ := chain.GasTokenInfo()
+		return 0, fmt.Errorf("%s has no %s price for %s on %s", h.source.Name(), strings.ToUpper(currency), symbol, day.Format(priceDay))
+	}
+	return price, nil
+}
+
+// Save writes the prices of past days to the cache file
+func (h *PriceHistory) Save() error {
+	if h.filePath == "" || !h.dirty {
+		return nil
+	}
+	today := time.Now().UTC().Format(priceDay)
+	past := make(map[string]map[string]float64, len(h.prices))
+	for key, prices := range h.prices {
+		if day := key[strings.LastIndex(key, "|")+1:]; day < today {
+			past[key] = prices
+		}
+	}
+
+	data, err := json.MarshalIndent(past, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal price cache: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(h.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(h.filePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write price cache: %v", err)
+	}
+	h.dirty = false
+	return nil
+}
+
+// FiatValue is the value a record moved and the fee it paid in one currency,
+// at the price of the gas token on the day of the record
+type FiatValue struct {
+	Price float64 `json:"price"`
+	Value float64 `json:"value"`
+	// Fee is set once the transaction was mined
+	Fee *float64 `json:"fee,omitempty"`
+}
+
+// FiatValues holds the fiat values of history records by upper-case currency
+type FiatValues struct {
+	Currencies []string
+	Source     string
+	records    map[*TransactionRecord]map[string]*FiatValue
+}
+
+// Of returns the fiat values of a record by currency, or nil if it was not
+// valued
+func (v *FiatValues) Of(record *TransactionRecord) map[string]*FiatValue {
+	if v == nil {
+		return nil
+	}
+	return v.records[record]
+}
+
+// ValueRecords values the native value and fee of records in each currency at
+// the price of their day. Records on testnets and on chains that are not
+// configured have no price and are left out.
+func (h *PriceHistory) ValueRecords(ctx context.Context, records []*TransactionRecord, currencies []string) (*FiatValues, error) {
+	chains, err := core.Chains()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*core.ChainConfig, len(chains))
+	for _, chain := range chains {
+		byID[chain.ChainID.String()] = chain
+	}
+
+	values := &FiatValues{Source: h.source.Name(), records: make(map[*TransactionRecord]map[string]*FiatValue)}
+	for _, currency := range currencies {
+		values.Currencies = append(values.Currencies, strings.ToUpper(currency))
+	}
+	sort.Strings(values.Currencies)
+
+	for _, record := range records {
+		chain, ok := byID[record.ChainID]
+		if !ok || chain.IsTestnet {
+			continue
+		}
+		_, decimals := chain.GasTokenInfo()
+		amount := new(big.Rat)
+		if value, ok := new(big.Int).SetString(record.Value, 10); ok {
+			amount = scaleDown(value, decimals)
+		}
+		var fee *big.Rat
+		if f := record.Fee(); f != nil {
+			fee = scaleDown(f, decimals)
+		}
+
+		valued := make(map[string]*FiatValue, len(values.Currencies))
+		for _, currency := range values.Currencies {
+			price, err := h.Price(ctx, chain, currency, record.Timestamp)
+			if err != nil {
+				return nil, fmt.Errorf("failed to price transaction %s: %v", record.Hash.Hex(), err)
+			}
+			fiat := &FiatValue{Price: price, Value: fiatAmount(amount, price)}
+			if fee != nil {
+				feeValue := fiatAmount(fee, price)
+				fiat.Fee = &feeValue
+			}
+			valued[currency] = fiat
+		}
+		values.records[record] = valued
+	}
+	return values, nil
+}
+
+// fiatAmount multiplies an amount of whole tokens by their price
+func fiatAmount(amount *big.Rat, price float64) float64 {
+	value, _ := new(big.Rat).Mul(amount, new(big.Rat).SetFloat64(price)).Float64()
+	return value
+}
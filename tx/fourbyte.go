@@ -0,0 +1,51 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FourByteAPI is the public 4byte.directory signature lookup endpoint
+const FourByteAPI = "https://www.4byte.directory/api/v1/signatures/"
+
+// LookupSelector returns the text signatures registered for a function
+// selector in the 4byte directory, oldest first
+func LookupSelector(ctx context.Context, selector [4]byte) ([]string, error) {
+	client, err := HTTPClient(FourByteAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s?hex_signature=0x%x&ordering=created_at", FourByteAPI, selector)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create 4byte request: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query 4byte directory: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("4byte directory returned %s", resp.Status)
+	}
+
+	var result struct {
+		Results []struct {
+			TextSignature string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode 4byte response: %v", err)
+	}
+
+	signatures := make([]string, 0, len(result.Results))
+	for _, r := range result.Results {
+		signatures = append(signatures, r.TextSignature)
+	}
+	return signatures, nil
+}
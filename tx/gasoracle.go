@@ -0,0 +1,227 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// GasPresetSlow targets inclusion within a few minutes
+	GasPresetSlow = "slow"
+	// GasPresetStandard targets inclusion within a few blocks
+	GasPresetStandard = "standard"
+	// GasPresetFast targets inclusion in the next block
+	GasPresetFast = "fast"
+
+	// DefaultFeeHistoryBlocks is the number of blocks the gas oracle samples
+	DefaultFeeHistoryBlocks = 20
+	// DefaultBaseFeeMultiplier is how many times the next base fee maxFeePerGas
+	// covers, so a transaction survives several full blocks in a row
+	DefaultBaseFeeMultiplier = "2"
+)
+
+// GasPresets lists the fee presets from cheapest to fastest
+var GasPresets = []string{GasPresetSlow, GasPresetStandard, GasPresetFast}
+
+// GasOracleConfig configures how fee suggestions are derived from fee history
+type GasOracleConfig struct {
+	// Blocks is the number of recent blocks sampled with eth_feeHistory
+	Blocks int
+	// Percentiles maps each preset to the priority fee percentile of the sampled blocks
+	Percentiles map[string]*big.Rat
+	// BaseFeeMultiplier is how many times the next base fee maxFeePerGas covers
+	BaseFeeMultiplier *big.Rat
+}
+
+// DefaultGasOracleConfig returns the default gas oracle configuration
+func DefaultGasOracleConfig() *GasOracleConfig {
+	multiplier, _ := new(big.Rat).SetString(DefaultBaseFeeMultiplier)
+	return &GasOracleConfig{
+		Blocks: DefaultFeeHistoryBlocks,
+		Percentiles: map[string]*big.Rat{
+			GasPresetSlow:     big.NewRat(10, 1),
+			GasPresetStandard: big.NewRat(50, 1),
+			GasPresetFast:     big.NewRat(90, 1),
+		},
+		BaseFeeMultiplier: multiplier,
+	}
+}
+
+// Validate checks the configuration
+func (c *GasOracleConfig) Validate() error {
+	if c.Blocks < 1 || c.Blocks > 1024 {
+		return fmt.Errorf("fee history must sample between 1 and 1024 blocks, got %d", c.Blocks)
+	}
+	if c.BaseFeeMultiplier == nil || c.BaseFeeMultiplier.Cmp(big.NewRat(1, 1)) < 0 {
+		return errors.New("base fee multiplier must be at least 1")
+	}
+	for _, preset := range GasPresets {
+		percentile, ok := c.Percentiles[preset]
+		if !ok || percentile == nil {
+			return fmt.Errorf("no percentile configured for preset %q", preset)
+		}
+		if percentile.Sign() < 0 || percentile.Cmp(big.NewRat(100, 1)) > 0 {
+			return fmt.Errorf("percentile of preset %q must be between 0 and 100, got %s", preset, percentile.RatString())
+		}
+	}
+	return nil
+}
+
+// FeeSuggestion is the suggested fee of one preset. On chains without
+// EIP-1559 the base fee is zero and MaxFeePerGas is a legacy gas price.
+type FeeSuggestion struct {
+	Preset               string   `json:"preset"`
+	Percentile           string   `json:"percentile"`
+	MaxFeePerGas         *big.Int `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *big.Int `json:"maxPriorityFeePerGas"`
+}
+
+// FeeSuggestions are the fee suggestions of every preset
+type FeeSuggestions struct {
+	OldestBlock *big.Int         `json:"oldestBlock"`
+	Blocks      int              `json:"blocks"`
+	BaseFee     *big.Int         `json:"baseFee"`
+	Suggestions []*FeeSuggestion `json:"suggestions"`
+}
+
+// Legacy reports whether the chain has no base fee and needs legacy gas prices
+func (f *FeeSuggestions) Legacy() bool {
+	return f.BaseFee.Sign() == 0
+}
+
+// Preset returns the suggestion of a preset
+func (f *FeeSuggestions) Preset(preset string) (*FeeSuggestion, error) {
+	for _, suggestion := range f.Suggestions {
+		if suggestion.Preset == preset {
+			return suggestion, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown gas preset %q (expected slow, standard or fast)", preset)
+}
+
+// SuggestFees derives slow, standard and fast fees from a single batched
+// eth_feeHistory call. The priority fee of a preset is the median across the
+// sampled blocks of that preset's reward percentile; maxFeePerGas adds it to
+// a multiple of the next block's base fee.
+func (s *Simulator) SuggestFees(ctx context.Context, config *GasOracleConfig) (*FeeSuggestions, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Percentiles must be passed in ascending order
+	percentiles := make([]*big.Rat, len(GasPresets))
+	for i, preset := range GasPresets {
+		percentiles[i] = config.Percentiles[preset]
+	}
+	sort.Slice(percentiles, func(i, j int) bool { return percentiles[i].Cmp(percentiles[j]) < 0 })
+
+	history, err := s.feeHistory(ctx, config.Blocks, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.BaseFee) == 0 {
+		return nil, errors.New("node returned an empty fee history")
+	}
+
+	// The last base fee is the projection for the next block
+	baseFee := history.BaseFee[len(history.BaseFee)-1].ToInt()
+	result := &FeeSuggestions{
+		OldestBlock: history.OldestBlock.ToInt(),
+		Blocks:      len(history.Reward),
+		BaseFee:     baseFee,
+	}
+
+	for _, preset := range GasPresets {
+		column := sort.Search(len(percentiles), func(i int) bool {
+			return percentiles[i].Cmp(config.Percentiles[preset]) >= 0
+		})
+		tip := medianReward(history.Reward, column)
+
+		// Round the base fee share up so the cap never falls short
+		maxFee, err := core.MulDecimal(baseFee, config.BaseFeeMultiplier, core.RoundUp)
+		if err != nil {
+			return nil, err
+		}
+		maxFee.Add(maxFee, tip)
+
+		result.Suggestions = append(result.Suggestions, &FeeSuggestion{
+			Preset:               preset,
+			Percentile:           formatPercentile(config.Percentiles[preset]),
+			MaxFeePerGas:         maxFee,
+			MaxPriorityFeePerGas: tip,
+		})
+	}
+
+	// Keep presets monotonic when blocks were sparse
+	for i := 1; i < len(result.Suggestions); i++ {
+		prev, cur := result.Suggestions[i-1], result.Suggestions[i]
+		if cur.MaxPriorityFeePerGas.Cmp(prev.MaxPriorityFeePerGas) < 0 {
+			cur.MaxPriorityFeePerGas = new(big.Int).Set(prev.MaxPriorityFeePerGas)
+			cur.MaxFeePerGas = new(big.Int).Set(prev.MaxFeePerGas)
+		}
+	}
+
+	return result, nil
+}
+
+// feeHistoryResult is the eth_feeHistory response
+type feeHistoryResult struct {
+	OldestBlock *hexutil.Big     `json:"oldestBlock"`
+	Reward      [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee     []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+}
+
+// feeHistory calls eth_feeHistory directly so percentiles are sent as exact
+// decimal numbers instead of going through float64
+func (s *Simulator) feeHistory(ctx context.Context, blocks int, percentiles []*big.Rat) (*feeHistoryResult, error) {
+	params := make([]json.Number, len(percentiles))
+	for i, percentile := range percentiles {
+		params[i] = json.Number(formatPercentile(percentile))
+	}
+
+	var result feeHistoryResult
+	if err := s.client.Client().CallContext(ctx, &result, "eth_feeHistory", hexutil.Uint(blocks), "latest", params); err != nil {
+		return nil, fmt.Errorf("failed to get fee history: %v", err)
+	}
+	if result.OldestBlock == nil {
+		return nil, errors.New("node returned an empty fee history")
+	}
+	for _, fee := range result.BaseFee {
+		if fee == nil {
+			return nil, errors.New("node returned a fee history without base fees")
+		}
+	}
+	return &result, nil
+}
+
+// formatPercentile renders a percentile as a decimal with at most 4 places
+func formatPercentile(percentile *big.Rat) string {
+	formatted := percentile.FloatString(4)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+// medianReward returns the median of one reward percentile across blocks,
+// skipping empty blocks that report no rewards
+func medianReward(rewards [][]*hexutil.Big, column int) *big.Int {
+	var values []*big.Int
+	for _, block := range rewards {
+		if column < len(block) && block[column] != nil && block[column].ToInt().Sign() > 0 {
+			values = append(values, block[column].ToInt())
+		}
+	}
+	if len(values) == 0 {
+		return new(big.Int)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return new(big.Int).Set(values[len(values)/2])
+}
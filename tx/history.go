@@ -3,18 +3,38 @@ package tx
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/aryehky/gosignervaultcli/paths"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// historyDir holds the history and the other local transaction state
+var historyDir = paths.Resolve("history")
+
+// DefaultHistoryFile is the default location of the transaction history
+var DefaultHistoryFile = filepath.Join(historyDir, "history.json")
+
+const (
+	// StatusSigned marks a record that was signed locally but not yet observed on-chain
+	StatusSigned = "signed"
+	// StatusReplaced marks a record whose nonce was reused by a speed-up or cancellation
+	StatusReplaced = "replaced"
+	// StatusHeld marks a record that is checked but not yet signed, see History.Hold
+	StatusHeld = "held"
+)
+
 // TransactionRecord represents a historical transaction record
 type TransactionRecord struct {
 	Hash        common.Hash `json:"hash"`
@@ -27,27 +47,86 @@ type TransactionRecord struct {
 	Status      string      `json:"status"`
 	Timestamp   time.Time   `json:"timestamp"`
 	Data        string      `json:"data,omitempty"`
+	Function    string      `json:"function,omitempty"`
+	ChainID     string      `json:"chainId,omitempty"`
 	Error       string      `json:"error,omitempty"`
+
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// TimelineEvent is a step in the submission of a transaction
+type TimelineEvent struct {
+	Time   time.Time    `json:"time"`
+	Event  string       `json:"event"`
+	Hash   *common.Hash `json:"hash,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+}
+
+// HistoryFilter selects history records. Zero fields match everything.
+type HistoryFilter struct {
+	Since   time.Time
+	Until   time.Time
+	Address string
+	ChainID string
+	Status  string
+
+	// Offset and Limit paginate the matching records, newest first
+	Offset int
+	Limit  int
+}
+
+// matches reports whether a record passes the filter
+func (f *HistoryFilter) matches(record *TransactionRecord) bool {
+	if !f.Since.IsZero() && record.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !record.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.Address != "" && !strings.EqualFold(record.From, f.Address) && !strings.EqualFold(record.To, f.Address) {
+		return false
+	}
+	if f.ChainID != "" && record.ChainID != f.ChainID {
+		return false
+	}
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	return true
 }
 
-// History manages transaction history
+// History manages transaction history. Records are indexed by chain ID and
+// hash, so identical hashes on different networks do not collide.
 type History struct {
 	client   *ethclient.Client
-	records  map[common.Hash]*TransactionRecord
+	records  map[string]*TransactionRecord
 	mu       sync.RWMutex
 	filePath string
+
+	// Encrypted histories are append-only: changed records are appended and
+	// the latest entry of a record wins when loading
+	journal *historyJournal
+	dirty   map[string]bool
+
+	// held records count in checks but are never saved
+	held []*TransactionRecord
+}
+
+// recordKey returns the index key of a record
+func recordKey(chainID string, hash common.Hash) string {
+	return chainID + ":" + hash.Hex()
 }
 
 // NewHistory creates a new transaction history manager
 func NewHistory(rpcURL, filePath string) (*History, error) {
-	client, err := ethclient.Dial(rpcURL)
+	client, err := dial(context.Background(), rpcURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RPC: %v", err)
+		return nil, err
 	}
 
 	history := &History{
 		client:   client,
-		records:  make(map[common.Hash]*TransactionRecord),
+		records:  make(map[string]*TransactionRecord),
 		filePath: filePath,
 	}
 
@@ -59,33 +138,90 @@ func NewHistory(rpcURL, filePath string) (*History, error) {
 	return history, nil
 }
 
+// OpenHistory opens a transaction history file without an RPC connection,
+// for offline use such as recording and checking locally signed transactions
+func OpenHistory(filePath string) (*History, error) {
+	history := &History{
+		records:  make(map[string]*TransactionRecord),
+		filePath: filePath,
+	}
+
+	// Load existing history
+	if err := history.load(); err != nil {
+		return nil, fmt.Errorf("failed to load history: %v", err)
+	}
+
+	return history, nil
+}
+
+// OpenEncryptedHistory opens an append-only history file encrypted with a
+// password, creating it if it does not exist
+func OpenEncryptedHistory(filePath, password string) (*History, error) {
+	journal, records, err := openHistoryJournal(filePath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load history: %v", err)
+	}
+
+	history := &History{
+		records:  make(map[string]*TransactionRecord),
+		filePath: filePath,
+		journal:  journal,
+		dirty:    make(map[string]bool),
+	}
+	for _, record := range records {
+		history.records[recordKey(record.ChainID, record.Hash)] = record
+	}
+
+	return history, nil
+}
+
 // AddTransaction adds a transaction to the history
 func (h *History) AddTransaction(ctx context.Context, hash common.Hash) error {
+	if h.client == nil {
+		return fmt.Errorf("history has no RPC connection")
+	}
+
 	// Get transaction details
-	tx, isPending, err := h.client.TransactionByHash(ctx, hash)
+	var isPending bool
+	tx, err := call(ctx, func(ctx context.Context) (*types.Transaction, error) {
+		tx, pending, err := h.client.TransactionByHash(ctx, hash)
+		isPending = pending
+		return tx, err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get transaction: %v", err)
+		return fmt.Errorf("failed to get transaction: %w", err)
 	}
 
 	// Get receipt if transaction is not pending
 	var receipt *types.Receipt
 	if !isPending {
-		receipt, err = h.client.TransactionReceipt(ctx, hash)
+		receipt, err = call(ctx, func(ctx context.Context) (*types.Receipt, error) {
+			return h.client.TransactionReceipt(ctx, hash)
+		})
 		if err != nil {
-			return fmt.Errorf("failed to get receipt: %v", err)
+			return fmt.Errorf("failed to get receipt: %w", err)
 		}
 	}
 
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return fmt.Errorf("failed to recover sender: %v", err)
+	}
+
 	// Create record
 	record := &TransactionRecord{
 		Hash:      hash,
-		From:      tx.From().String(),
-		To:        tx.To().String(),
+		ChainID:   tx.ChainId().String(),
+		From:      from.Hex(),
 		Value:     tx.Value().String(),
 		GasPrice:  tx.GasPrice().String(),
 		Timestamp: time.Now(),
 		Data:      fmt.Sprintf("0x%x", tx.Data()),
 	}
+	// Contract creations have no recipient
+	if tx.To() != nil {
+		record.To = tx.To().Hex()
+	}
 
 	if receipt != nil {
 		record.GasUsed = receipt.GasUsed
@@ -100,61 +236,243 @@ func (h *History) AddTransaction(ctx context.Context, hash common.Hash) error {
 	}
 
 	// Save record
+	h.put(record)
+
+	// Save to file
+	return h.save()
+}
+
+// Sync updates the records of a chain that are not final yet from their
+// receipts at rpcURL, saving after each one so an interrupted sync keeps its
+// progress. Transactions not mined yet are left as they are. It returns how
+// many records were updated.
+func (h *History) Sync(ctx context.Context, rpcURL, chainID string, progress JobProgress) (int, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	var open []*TransactionRecord
+	h.mu.RLock()
+	for _, record := range h.records {
+		if record.ChainID == chainID && !recordFinal(record) {
+			open = append(open, record)
+		}
+	}
+	h.mu.RUnlock()
+	sort.Slice(open, func(i, j int) bool { return open[i].Timestamp.Before(open[j].Timestamp) })
+
+	updated := 0
+	for i, record := range open {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		receipt, err := call(ctx, func(ctx context.Context) (*types.Receipt, error) {
+			return client.TransactionReceipt(ctx, record.Hash)
+		})
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			progress(i+1, len(open), "")
+			continue
+		case err != nil:
+			return updated, fmt.Errorf("failed to get receipt of %s: %w", record.Hash.Hex(), err)
+		}
+
+		h.mu.Lock()
+		record.GasUsed = receipt.GasUsed
+		record.BlockNumber = receipt.BlockNumber.Uint64()
+		record.Status = "success"
+		if receipt.Status == types.ReceiptStatusFailed {
+			record.Status = "failed"
+		}
+		h.markDirty(recordKey(record.ChainID, record.Hash))
+		h.mu.Unlock()
+		if err := h.save(); err != nil {
+			return updated, err
+		}
+		updated++
+		progress(i+1, len(open), fmt.Sprintf("%s %s in block %d", record.Hash.Hex(), record.Status, record.BlockNumber))
+	}
+	return updated, nil
+}
+
+// recordFinal reports whether a record's outcome can no longer change
+func recordFinal(record *TransactionRecord) bool {
+	switch record.Status {
+	case "success", "failed", StatusReplaced, StatusHeld:
+		return true
+	}
+	return false
+}
+
+// RecordSigned adds a locally signed transaction to the history
+func (h *History) RecordSigned(record *TransactionRecord) error {
+	if record.Status == "" {
+		record.Status = StatusSigned
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	h.put(record)
+	return h.save()
+}
+
+// RecordTimeline appends submission events to the record of a transaction and
+// updates its status, creating the record if the transaction was signed elsewhere
+func (h *History) RecordTimeline(hash common.Hash, chainID, status string, events []TimelineEvent) error {
 	h.mu.Lock()
-	h.records[hash] = record
+	key := recordKey(chainID, hash)
+	record, ok := h.records[key]
+	if !ok {
+		record = &TransactionRecord{Hash: hash, ChainID: chainID, Timestamp: time.Now()}
+		h.records[key] = record
+	}
+	record.Status = status
+	record.Timeline = append(record.Timeline, events...)
+	h.markDirty(key)
 	h.mu.Unlock()
 
-	// Save to file
 	return h.save()
 }
 
-// GetTransaction returns a transaction record
-func (h *History) GetTransaction(hash common.Hash) (*TransactionRecord, error) {
+// Hold adds a checked transaction that is signed later, so the duplicate and
+// spending checks of the transactions after it count it. Held records are
+// kept in memory only and stay until the history is closed.
+func (h *History) Hold(record *TransactionRecord) {
+	record.Status = StatusHeld
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	h.mu.Lock()
+	h.held = append(h.held, record)
+	h.mu.Unlock()
+}
+
+// checked returns the records that duplicate and spending checks consider.
+// The caller must hold the lock.
+func (h *History) checked() []*TransactionRecord {
+	records := make([]*TransactionRecord, 0, len(h.records)+len(h.held))
+	for _, record := range h.records {
+		records = append(records, record)
+	}
+	return append(records, h.held...)
+}
+
+// FindDuplicate returns the most recent record with the same destination, value,
+// data and chain that was recorded at or after since, or nil if there is none
+func (h *History) FindDuplicate(to, value, data, chainID string, since time.Time) *TransactionRecord {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if record, exists := h.records[hash]; exists {
-		return record, nil
+	var match *TransactionRecord
+	for _, record := range h.checked() {
+		if record.Timestamp.Before(since) {
+			continue
+		}
+		if !strings.EqualFold(record.To, to) || record.Value != value ||
+			!strings.EqualFold(record.Data, data) || record.ChainID != chainID {
+			continue
+		}
+		if match == nil || record.Timestamp.After(match.Timestamp) {
+			match = record
+		}
 	}
-	return nil, fmt.Errorf("transaction not found in history")
+	return match
 }
 
-// GetTransactionsByAddress returns all transactions for an address
-func (h *History) GetTransactionsByAddress(address string) []*TransactionRecord {
+// SpentSince returns the total value sent from an address on a chain by
+// records at or after since, excluding failed transactions
+func (h *History) SpentSince(from, chainID string, since time.Time) *big.Int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	var records []*TransactionRecord
-	for _, record := range h.records {
-		if record.From == address || record.To == address {
-			records = append(records, record)
+	total := new(big.Int)
+	for _, record := range h.checked() {
+		if record.Timestamp.Before(since) || record.Status == "failed" {
+			continue
+		}
+		if !strings.EqualFold(record.From, from) || record.ChainID != chainID {
+			continue
+		}
+		if value, ok := new(big.Int).SetString(record.Value, 10); ok {
+			total.Add(total, value)
 		}
 	}
-	return records
+	return total
+}
+
+// GetTransaction returns the record of a transaction on a chain
+func (h *History) GetTransaction(chainID string, hash common.Hash) (*TransactionRecord, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if record, exists := h.records[recordKey(chainID, hash)]; exists {
+		return record, nil
+	}
+	return nil, fmt.Errorf("transaction not found in history")
+}
+
+// GetTransactionsByAddress returns all transactions for an address
+func (h *History) GetTransactionsByAddress(address string) []*TransactionRecord {
+	return h.Query(HistoryFilter{Address: address})
 }
 
 // GetRecentTransactions returns the most recent transactions
 func (h *History) GetRecentTransactions(limit int) []*TransactionRecord {
+	return h.Query(HistoryFilter{Limit: limit})
+}
+
+// Query returns the records matching a filter, newest first
+func (h *History) Query(filter HistoryFilter) []*TransactionRecord {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	var records []*TransactionRecord
 	for _, record := range h.records {
-		records = append(records, record)
+		if filter.matches(record) {
+			records = append(records, record)
+		}
 	}
 
-	// Sort by timestamp
+	// Sort by timestamp, breaking ties by hash for stable pages
 	sort.Slice(records, func(i, j int) bool {
-		return records[i].Timestamp.After(records[j].Timestamp)
+		if !records[i].Timestamp.Equal(records[j].Timestamp) {
+			return records[i].Timestamp.After(records[j].Timestamp)
+		}
+		return records[i].Hash.Hex() < records[j].Hash.Hex()
 	})
 
-	if limit > 0 && limit < len(records) {
-		records = records[:limit]
+	if filter.Offset >= len(records) {
+		return nil
+	}
+	records = records[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(records) {
+		records = records[:filter.Limit]
 	}
 
 	return records
 }
 
+// put stores a record under its chain ID and hash
+func (h *History) put(record *TransactionRecord) {
+	h.mu.Lock()
+	key := recordKey(record.ChainID, record.Hash)
+	h.records[key] = record
+	h.markDirty(key)
+	h.mu.Unlock()
+}
+
+// markDirty queues a record for appending to an encrypted history. The caller
+// must hold the lock.
+func (h *History) markDirty(key string) {
+	if h.dirty != nil {
+		h.dirty[key] = true
+	}
+}
+
 // load loads the transaction history from file
 func (h *History) load() error {
 	if _, err := os.Stat(h.filePath); os.IsNotExist(err) {
@@ -166,13 +484,20 @@ func (h *History) load() error {
 		return fmt.Errorf("failed to read history file: %v", err)
 	}
 
-	var records map[common.Hash]*TransactionRecord
+	if isHistoryJournal(data) {
+		return fmt.Errorf("history file %s is encrypted and needs a password", h.filePath)
+	}
+
+	// Older histories were keyed by hash alone; every record is re-indexed
+	var records map[string]*TransactionRecord
 	if err := json.Unmarshal(data, &records); err != nil {
 		return fmt.Errorf("failed to parse history: %v", err)
 	}
 
 	h.mu.Lock()
-	h.records = records
+	for _, record := range records {
+		h.records[recordKey(record.ChainID, record.Hash)] = record
+	}
 	h.mu.Unlock()
 
 	return nil
@@ -180,6 +505,10 @@ func (h *History) load() error {
 
 // save saves the transaction history to file
 func (h *History) save() error {
+	if h.journal != nil {
+		return h.appendDirty()
+	}
+
 	h.mu.RLock()
 	data, err := json.MarshalIndent(h.records, "", "  ")
 	h.mu.RUnlock()
@@ -201,6 +530,26 @@ func (h *History) save() error {
 	return nil
 }
 
+// appendDirty appends changed records to an encrypted history
+func (h *History) appendDirty() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.dirty))
+	for key := range h.dirty {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := h.journal.append(h.records[key]); err != nil {
+			return err
+		}
+		delete(h.dirty, key)
+	}
+	return nil
+}
+
 // Close closes the history manager
 func (h *History) Close() {
 	if h.client != nil {
@@ -0,0 +1,355 @@
+package tx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultJobFile is the default location of the job queue
+var DefaultJobFile = filepath.Join(historyDir, "jobs.json")
+
+const (
+	// JobQueued marks a job waiting to run
+	JobQueued = "queued"
+	// JobRunning marks a job a process is working on
+	JobRunning = "running"
+	// JobSucceeded marks a job that finished without error
+	JobSucceeded = "succeeded"
+	// JobFailed marks a job that returned an error or whose process died
+	JobFailed = "failed"
+	// JobCancelled marks a job stopped by 'jobs cancel'
+	JobCancelled = "cancelled"
+
+	// jobHeartbeatInterval is how often a running job proves it is alive and
+	// looks for a cancellation request
+	jobHeartbeatInterval = 5 * time.Second
+	// staleJobAge is how long a running job may miss heartbeats before it
+	// counts as interrupted
+	staleJobAge = time.Minute
+	// maxJobLog is how many events are kept per job
+	maxJobLog = 100
+)
+
+// ErrJobCancelled is returned by Jobs.Run when a job was cancelled while running
+var ErrJobCancelled = errors.New("job cancelled")
+
+// Job is a long-running operation whose state outlives the process running it
+type Job struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// Command is the command line that runs the job again, without secrets
+	Command  []string `json:"command,omitempty"`
+	State    string   `json:"state"`
+	Attempts int      `json:"attempts"`
+	PID      int      `json:"pid,omitempty"`
+
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	Heartbeat time.Time `json:"heartbeat"`
+
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	CancelRequested bool       `json:"cancelRequested,omitempty"`
+	Log             []JobEvent `json:"log"`
+}
+
+// JobEvent is a step in the life of a job
+type JobEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Finished reports whether a job has reached a final state
+func (j *Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled
+}
+
+// event appends an event to the log of a job, dropping the oldest beyond maxJobLog
+func (j *Job) event(event, detail string) {
+	now := time.Now()
+	j.Updated = now
+	j.Log = append(j.Log, JobEvent{Time: now, Event: event, Detail: detail})
+	if len(j.Log) > maxJobLog {
+		j.Log = j.Log[len(j.Log)-maxJobLog:]
+	}
+}
+
+// JobProgress reports how far a job got: done of total steps, with an
+// optional event for the job's log
+type JobProgress func(done, total int, detail string)
+
+// Jobs is a file of jobs shared between the processes running them and the
+// 'jobs' commands that list, retry and cancel them
+type Jobs struct {
+	path string
+}
+
+// OpenJobs opens a job queue file
+func OpenJobs(path string) (*Jobs, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %v", err)
+	}
+	return &Jobs{path: path}, nil
+}
+
+// Add queues a job under a new ID
+func (q *Jobs) Add(job *Job) error {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	job.ID = hex.EncodeToString(id)
+	job.State = JobQueued
+	job.Created = time.Now()
+	job.event("queued", job.Description)
+
+	return q.update(func(jobs []*Job) ([]*Job, error) {
+		return append(jobs, job), nil
+	})
+}
+
+// List returns all jobs, oldest first
+func (q *Jobs) List() ([]*Job, error) {
+	var result []*Job
+	err := q.update(func(jobs []*Job) ([]*Job, error) {
+		result = jobs
+		return jobs, nil
+	})
+	return result, err
+}
+
+// Get returns the job with an ID or a unique prefix of one
+func (q *Jobs) Get(id string) (*Job, error) {
+	var result *Job
+	err := q.update(func(jobs []*Job) ([]*Job, error) {
+		job, err := findJob(jobs, id)
+		result = job
+		return jobs, err
+	})
+	return result, err
+}
+
+// Cancel stops a job: a queued job is cancelled at once, a running one at its
+// next heartbeat
+func (q *Jobs) Cancel(id string) (*Job, error) {
+	var result *Job
+	err := q.update(func(jobs []*Job) ([]*Job, error) {
+		job, err := findJob(jobs, id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case job.Finished():
+			return nil, fmt.Errorf("job %s has already %s", job.ID, job.State)
+		case job.State == JobQueued:
+			job.State = JobCancelled
+			job.event("cancelled", "")
+		case !job.CancelRequested:
+			job.CancelRequested = true
+			job.event("cancel requested", "")
+		}
+		result = job
+		return jobs, nil
+	})
+	return result, err
+}
+
+// Requeue queues a failed or cancelled job for another attempt
+func (q *Jobs) Requeue(id string) (*Job, error) {
+	var result *Job
+	err := q.update(func(jobs []*Job) ([]*Job, error) {
+		job, err := findJob(jobs, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.State != JobFailed && job.State != JobCancelled {
+			return nil, fmt.Errorf("job %s is %s; only failed and cancelled jobs are retried", job.ID, job.State)
+		}
+		job.State = JobQueued
+		job.CancelRequested = false
+		job.Error = ""
+		job.event("queued", "retry")
+		result = job
+		return jobs, nil
+	})
+	return result, err
+}
+
+// Run runs a queued job in this process. The job's heartbeat is kept fresh
+// while fn runs, and its context is cancelled once 'jobs cancel' asks for it.
+// The outcome is recorded as the job's final state, with fn's one-line summary
+// of what it produced; fn's error is returned, or ErrJobCancelled if the job
+// was cancelled.
+func (q *Jobs) Run(ctx context.Context, id string, fn func(ctx context.Context, progress JobProgress) (string, error)) error {
+	err := q.modify(id, func(job *Job) error {
+		if job.State != JobQueued {
+			return fmt.Errorf("job %s is %s, not queued", job.ID, job.State)
+		}
+		job.State = JobRunning
+		job.Attempts++
+		job.PID = os.Getpid()
+		job.Heartbeat = time.Now()
+		job.Done, job.Total = 0, 0
+		job.Result = ""
+		job.event("started", fmt.Sprintf("attempt %d, pid %d", job.Attempts, job.PID))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var cancelled bool
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				q.modify(id, func(job *Job) error {
+					job.Heartbeat = time.Now()
+					if job.CancelRequested && !cancelled {
+						cancelled = true
+						cancel()
+					}
+					return nil
+				})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	progress := func(done, total int, detail string) {
+		q.modify(id, func(job *Job) error {
+			job.Done, job.Total = done, total
+			job.Heartbeat = time.Now()
+			if detail != "" {
+				job.event("progress", detail)
+			}
+			return nil
+		})
+	}
+	result, runErr := fn(ctx, progress)
+	cancel()
+	<-stopped
+
+	if cancelled {
+		runErr = ErrJobCancelled
+	}
+	err = q.modify(id, func(job *Job) error {
+		job.PID = 0
+		switch {
+		case cancelled:
+			job.State = JobCancelled
+			job.event("cancelled", "")
+		case runErr != nil:
+			job.State = JobFailed
+			job.Error = runErr.Error()
+			job.event("failed", job.Error)
+		default:
+			job.State = JobSucceeded
+			job.Result = result
+			job.event("succeeded", result)
+		}
+		return nil
+	})
+	if err != nil && runErr == nil {
+		return err
+	}
+	return runErr
+}
+
+// modify applies fn to a single job
+func (q *Jobs) modify(id string, fn func(*Job) error) error {
+	return q.update(func(jobs []*Job) ([]*Job, error) {
+		job, err := findJob(jobs, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(job); err != nil {
+			return nil, err
+		}
+		return jobs, nil
+	})
+}
+
+// findJob returns the job with an ID or a unique prefix of one
+func findJob(jobs []*Job, id string) (*Job, error) {
+	var found *Job
+	for _, job := range jobs {
+		if job.ID == id {
+			return job, nil
+		}
+		if id != "" && strings.HasPrefix(job.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("job ID %q is ambiguous", id)
+			}
+			found = job
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no job %q", id)
+	}
+	return found, nil
+}
+
+// update applies fn to the job queue while holding its lock. Running jobs
+// whose process stopped sending heartbeats are marked failed first.
+func (q *Jobs) update(fn func([]*Job) ([]*Job, error)) error {
+	unlock, err := lockFile(q.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var jobs []*Job
+	data, err := os.ReadFile(q.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read job queue: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return fmt.Errorf("failed to parse job queue: %v", err)
+		}
+	}
+
+	for _, job := range jobs {
+		if job.State == JobRunning && time.Since(job.Heartbeat) > staleJobAge {
+			job.State = JobFailed
+			job.Error = fmt.Sprintf("interrupted: process %d stopped responding", job.PID)
+			job.PID = 0
+			job.event("failed", job.Error)
+		}
+	}
+
+	jobs, err = fn(jobs)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job queue: %v", err)
+	}
+	if err := writeFileAtomic(q.path, data); err != nil {
+		return fmt.Errorf("failed to write job queue: %v", err)
+	}
+	return nil
+}
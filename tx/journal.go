@@ -0,0 +1,250 @@
+package tx
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aryehky/gosignervaultcli/keystore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// journalFormat identifies the header line of an encrypted history
+	journalFormat = "gosignervaultcli-encrypted-history"
+	// journalCheck is sealed into the header to detect a wrong password
+	journalCheck = "history"
+	// journalVersion is the current header version; version 1 histories were
+	// keyed with keystore.LegacyCipher and are upgraded when opened
+	journalVersion = 2
+)
+
+// journalHeader is the first line of an encrypted history
+type journalHeader struct {
+	Format  string            `json:"format"`
+	Version int               `json:"version"`
+	Salt    string            `json:"salt,omitempty"`
+	KDF     *keystore.SealKDF `json:"kdf,omitempty"`
+	Check   string            `json:"check"`
+}
+
+// historyJournal is an append-only history file with one encrypted record per line
+type historyJournal struct {
+	path string
+	aead cipher.AEAD
+}
+
+// isHistoryJournal reports whether a history file is encrypted
+func isHistoryJournal(data []byte) bool {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	var header journalHeader
+	return json.Unmarshal(line, &header) == nil && header.Format == journalFormat
+}
+
+// openHistoryJournal opens or creates an encrypted history and decrypts its records
+func openHistoryJournal(path, password string) (*historyJournal, []*TransactionRecord, error) {
+	if password == "" {
+		return nil, nil, fmt.Errorf("history password is empty")
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		journal, err := createHistoryJournal(path, password)
+		return journal, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read history file: %v", err)
+	}
+	if !isHistoryJournal(data) {
+		return nil, nil, fmt.Errorf("history file %s is not encrypted", path)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	scanner.Scan()
+
+	var header journalHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse history header: %v", err)
+	}
+	aead, err := header.cipher(password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create history cipher: %v", err)
+	}
+	journal := &historyJournal{path: path, aead: aead}
+
+	if check, err := journal.open(header.Check); err != nil || string(check) != journalCheck {
+		return nil, nil, fmt.Errorf("wrong history password")
+	}
+
+	// Later entries of a record supersede earlier ones
+	var records []*TransactionRecord
+	for line := 2; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		plaintext, err := journal.open(scanner.Text())
+		if err != nil {
+			return nil, nil, fmt.Errorf("history line %d: %v", line, err)
+		}
+		var record TransactionRecord
+		if err := json.Unmarshal(plaintext, &record); err != nil {
+			return nil, nil, fmt.Errorf("history line %d: failed to parse record: %v", line, err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read history file: %v", err)
+	}
+
+	if header.Version < journalVersion {
+		if journal, err = upgradeHistoryJournal(path, password, records); err != nil {
+			return nil, nil, err
+		}
+	}
+	return journal, records, nil
+}
+
+// cipher derives the cipher of the history from its password
+func (h *journalHeader) cipher(password string) (cipher.AEAD, error) {
+	if h.Version < journalVersion {
+		salt, err := hexutil.Decode(h.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history salt: %v", err)
+		}
+		return keystore.LegacyCipher(password, salt)
+	}
+	if h.KDF == nil {
+		return nil, fmt.Errorf("history header has no KDF parameters")
+	}
+	return h.KDF.Cipher(password)
+}
+
+// createHistoryJournal writes the header of a new encrypted history
+func createHistoryJournal(path, password string) (*historyJournal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+	journal, header, err := newHistoryJournal(path, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, header, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write history file: %v", err)
+	}
+	return journal, nil
+}
+
+// upgradeHistoryJournal re-encrypts a version 1 history under a new header,
+// replacing the file only once every record is written
+func upgradeHistoryJournal(path, password string, records []*TransactionRecord) (*historyJournal, error) {
+	journal, data, err := newHistoryJournal(path, password)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		plaintext, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal history record: %v", err)
+		}
+		line, err := journal.seal(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, line+"\n"...)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write history file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to replace history file: %v", err)
+	}
+	return journal, nil
+}
+
+// newHistoryJournal derives the cipher of a new history and returns the
+// header line to start its file with
+func newHistoryJournal(path, password string) (*historyJournal, []byte, error) {
+	kdf, err := keystore.NewSealKDF(keystore.DefaultSealKDF)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := kdf.Cipher(password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create history cipher: %v", err)
+	}
+	journal := &historyJournal{path: path, aead: aead}
+
+	check, err := journal.seal([]byte(journalCheck))
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := json.Marshal(journalHeader{
+		Format:  journalFormat,
+		Version: journalVersion,
+		KDF:     kdf,
+		Check:   check,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal history header: %v", err)
+	}
+	return journal, append(header, '\n'), nil
+}
+
+// append encrypts a record and appends it to the journal
+func (j *historyJournal) append(record *TransactionRecord) error {
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %v", err)
+	}
+	line, err := j.seal(plaintext)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	return nil
+}
+
+// seal encrypts data into a hex line of nonce and ciphertext
+func (j *historyJournal) seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, j.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return hexutil.Encode(j.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// open decrypts a line produced by seal
+func (j *historyJournal) open(line string) ([]byte, error) {
+	data, err := hexutil.Decode(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted record: %v", err)
+	}
+	if len(data) < j.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted record is truncated")
+	}
+	nonce, ciphertext := data[:j.aead.NonceSize()], data[j.aead.NonceSize():]
+	plaintext, err := j.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record: %v", err)
+	}
+	return plaintext, nil
+}
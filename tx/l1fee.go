@@ -0,0 +1,95 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// opGasPriceOracle is the predeploy pricing L1 data on OP-stack chains
+	opGasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+	// arbNodeInterface is the virtual contract answering gas questions on Arbitrum
+	arbNodeInterface = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+
+	opGetL1FeeSelector       = crypto.Keccak256([]byte("getL1Fee(bytes)"))[:4]
+	arbL1ComponentSelector   = crypto.Keccak256([]byte("gasEstimateL1Component(address,bool,bytes)"))[:4]
+	errUnsupportedL1FeeModel = fmt.Errorf("unsupported L1 fee model (expected %s or %s)", core.L1FeesOPStack, core.L1FeesArbitrum)
+)
+
+// l1Fee returns the L1 data fee of a transaction on a rollup, and whether the
+// estimated gas already pays for it
+func (s *Simulator) l1Fee(ctx context.Context, tx *Transaction, msg ethereum.CallMsg, gasPrice *big.Int) (*big.Int, bool, error) {
+	switch s.l1Fees {
+	case core.L1FeesOPStack:
+		// The oracle prices the serialized transaction, signature excluded
+		encoded, err := tx.ToEthereumTx().MarshalBinary()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to encode transaction: %v", err)
+		}
+		data, err := packArguments(opGetL1FeeSelector, []string{"bytes"}, encoded)
+		if err != nil {
+			return nil, false, err
+		}
+		output, err := s.callContract(ctx, ethereum.CallMsg{To: &opGasPriceOracle, Data: data})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get L1 fee from the gas price oracle: %w", err)
+		}
+		if len(output) < 32 {
+			return nil, false, fmt.Errorf("unexpected L1 fee of %d bytes", len(output))
+		}
+		return new(big.Int).SetBytes(output[:32]), false, nil
+
+	case core.L1FeesArbitrum:
+		// Arbitrum includes the L1 part in the gas estimate; the node interface
+		// tells how much of it that is
+		to := common.Address{}
+		if msg.To != nil {
+			to = *msg.To
+		}
+		data, err := packArguments(arbL1ComponentSelector, []string{"address", "bool", "bytes"}, to, msg.To == nil, msg.Data)
+		if err != nil {
+			return nil, false, err
+		}
+		output, err := s.callContract(ctx, ethereum.CallMsg{From: msg.From, To: &arbNodeInterface, Data: data})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get L1 gas from the node interface: %w", err)
+		}
+		if len(output) < 32 {
+			return nil, false, fmt.Errorf("unexpected L1 gas of %d bytes", len(output))
+		}
+		l1Gas := new(big.Int).SetBytes(output[:32])
+		return l1Gas.Mul(l1Gas, gasPrice), true, nil
+	}
+	return nil, false, errUnsupportedL1FeeModel
+}
+
+// callContract makes a read-only call against the latest block
+func (s *Simulator) callContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
+	return call(ctx, func(ctx context.Context) ([]byte, error) {
+		return s.client.CallContract(ctx, msg, nil)
+	})
+}
+
+// packArguments encodes a call of the function with the selector
+func packArguments(selector []byte, types []string, values ...interface{}) ([]byte, error) {
+	var arguments abi.Arguments
+	for _, name := range types {
+		argType, err := abi.NewType(name, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, abi.Argument{Type: argType})
+	}
+	packed, err := arguments.Pack(values...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode call: %v", err)
+	}
+	return append(append([]byte{}, selector...), packed...), nil
+}
@@ -0,0 +1,145 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// DefaultLadderSteps is the default number of fee levels signed for a ladder
+	DefaultLadderSteps = 4
+	// DefaultLadderBump is the default fee increase between ladder levels
+	DefaultLadderBump = "20%"
+
+	// ladderPollInterval is how often inclusion is checked while a ladder is running
+	// on a chain without a configured block time
+	ladderPollInterval = 3 * time.Second
+)
+
+// LadderLevel is one pre-signed fee level of a transaction
+type LadderLevel struct {
+	GasPrice       *big.Int    `json:"gasPrice"`
+	Hash           common.Hash `json:"hash"`
+	RawTransaction string      `json:"rawTransaction"`
+}
+
+// LadderResult describes the outcome of a ladder submission
+type LadderResult struct {
+	Hash     common.Hash
+	Level    int
+	Released int
+	Included bool
+	Timeline []TimelineEvent
+}
+
+// minLadderBump is the smallest bump nodes accept for a replacement transaction
+var minLadderBump = big.NewRat(1, 10)
+
+// LadderGasPrices returns ascending gas prices starting at base, each bump (a
+// fraction, e.g. 0.2) above the previous one so every level is accepted as a
+// replacement. Prices are rounded up so no level undercuts the bump.
+func LadderGasPrices(base *big.Int, steps int, bump *big.Rat) ([]*big.Int, error) {
+	if base == nil || base.Sign() <= 0 {
+		return nil, errors.New("a fee ladder needs a positive base gas price")
+	}
+	if steps < 2 {
+		return nil, fmt.Errorf("a fee ladder needs at least 2 levels, got %d", steps)
+	}
+	if bump.Cmp(minLadderBump) < 0 {
+		return nil, errors.New("ladder bump must be at least 10% to replace a pending transaction")
+	}
+
+	factor := new(big.Rat).Add(big.NewRat(1, 1), bump)
+	prices := []*big.Int{new(big.Int).Set(base)}
+	for i := 1; i < steps; i++ {
+		next, err := core.MulDecimal(prices[i-1], factor, core.RoundUp)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, next)
+	}
+	return prices, nil
+}
+
+// Levels returns every fee level of the payload in ascending order. Payloads
+// without a ladder have a single level.
+func (p *SignedPayload) Levels() []LadderLevel {
+	levels := []LadderLevel{{Hash: p.Hash, RawTransaction: p.RawTransaction}}
+	return append(levels, p.Ladder...)
+}
+
+// BroadcastLadder submits the lowest fee level of a payload and releases the
+// next higher level each time another deadline/levels interval passes without
+// inclusion, so the highest fee is on the network before the deadline
+func (b *Broadcaster) BroadcastLadder(ctx context.Context, payload *SignedPayload, deadline time.Duration) (*LadderResult, error) {
+	levels := payload.Levels()
+	interval := deadline / time.Duration(len(levels))
+
+	client, err := dial(ctx, b.endpoints[0])
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	poll := ladderPollInterval
+	if b.PollInterval > 0 {
+		poll = b.PollInterval
+	}
+
+	start := time.Now()
+	result := &LadderResult{Level: -1}
+	for {
+		// Release the next level when its time has come
+		if result.Released < len(levels) && time.Since(start) >= interval*time.Duration(result.Released) {
+			level := levels[result.Released]
+			hash, err := b.Broadcast(ctx, common.FromHex(level.RawTransaction))
+			event := TimelineEvent{Time: time.Now(), Event: fmt.Sprintf("released level %d", result.Released), Hash: &level.Hash}
+			switch {
+			case err == nil:
+				result.Hash, result.Level = hash, result.Released
+			case strings.Contains(err.Error(), "nonce too low"):
+				// An earlier level was included; the receipt check below finds it
+				event.Detail = err.Error()
+			case result.Released == 0:
+				return nil, err
+			default:
+				event.Detail = err.Error()
+			}
+			result.Timeline = append(result.Timeline, event)
+			result.Released++
+		}
+
+		// Check whether any released level was included
+		for i := 0; i < result.Released; i++ {
+			// Not found and transient errors alike mean "not included yet"
+			if receipt, err := client.TransactionReceipt(ctx, levels[i].Hash); err == nil && receipt != nil {
+				result.Hash, result.Level, result.Included = levels[i].Hash, i, true
+				result.Timeline = append(result.Timeline, TimelineEvent{
+					Time:   time.Now(),
+					Event:  fmt.Sprintf("included level %d", i),
+					Hash:   &levels[i].Hash,
+					Detail: fmt.Sprintf("block %s", receipt.BlockNumber),
+				})
+				return result, nil
+			}
+		}
+
+		// Give the last level one more interval before giving up
+		if result.Released == len(levels) && time.Since(start) >= deadline+interval {
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, nil
+		case <-time.After(min(poll, interval)):
+		}
+	}
+}
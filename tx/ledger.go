@@ -0,0 +1,289 @@
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// commodityPattern matches commodity names valid in both Beancount and Ledger
+var commodityPattern = regexp.MustCompile(`^[A-Z][A-Z0-9._-]{0,22}[A-Z0-9]$`)
+
+// LedgerToken describes an ERC-20 token for bookkeeping
+type LedgerToken struct {
+	Commodity string `json:"commodity"`
+	Decimals  uint8  `json:"decimals"`
+}
+
+// LedgerMapping maps addresses and assets to bookkeeping accounts
+type LedgerMapping struct {
+	// Accounts maps addresses (vault keys and counterparties) to accounts
+	Accounts map[string]string `json:"accounts"`
+	// VaultAccount is the account prefix of unmapped senders, followed by the address
+	VaultAccount string `json:"vaultAccount"`
+	// UnknownAccount receives transfers to unmapped counterparties
+	UnknownAccount string `json:"unknownAccount"`
+	// FeeAccount receives gas fees
+	FeeAccount string `json:"feeAccount"`
+	// Commodities maps chain IDs to the native commodity, defaulting to the chain symbol
+	Commodities map[string]string `json:"commodities"`
+	// Tokens maps "chainID:address" of ERC-20 tokens to their commodity
+	Tokens map[string]LedgerToken `json:"tokens"`
+}
+
+// DefaultLedgerMapping returns the mapping used when no mapping file is given
+func DefaultLedgerMapping() *LedgerMapping {
+	return &LedgerMapping{
+		Accounts:       make(map[string]string),
+		VaultAccount:   "Assets:Vault",
+		UnknownAccount: "Expenses:Unmapped",
+		FeeAccount:     "Expenses:Fees:Gas",
+		Commodities:    make(map[string]string),
+		Tokens:         make(map[string]LedgerToken),
+	}
+}
+
+// LoadLedgerMapping reads a mapping file over the defaults
+func LoadLedgerMapping(path string) (*LedgerMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger mapping: %v", err)
+	}
+
+	mapping := DefaultLedgerMapping()
+	if err := json.Unmarshal(data, mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse ledger mapping: %v", err)
+	}
+
+	// Addresses are matched case-insensitively
+	accounts := make(map[string]string, len(mapping.Accounts))
+	for address, account := range mapping.Accounts {
+		accounts[strings.ToLower(address)] = account
+	}
+	mapping.Accounts = accounts
+
+	tokens := make(map[string]LedgerToken, len(mapping.Tokens))
+	for key, token := range mapping.Tokens {
+		if !commodityPattern.MatchString(token.Commodity) {
+			return nil, fmt.Errorf("invalid commodity %q for token %s", token.Commodity, key)
+		}
+		tokens[strings.ToLower(key)] = token
+	}
+	mapping.Tokens = tokens
+
+	return mapping, nil
+}
+
+// account returns the account of an address
+func (m *LedgerMapping) account(address string, vault bool) string {
+	if account, ok := m.Accounts[strings.ToLower(address)]; ok {
+		return account
+	}
+	if vault {
+		return m.VaultAccount + ":" + address
+	}
+	return m.UnknownAccount
+}
+
+// nativeCommodity returns the commodity of a chain's native currency
+func (m *LedgerMapping) nativeCommodity(chainID string) (string, error) {
+	if commodity, ok := m.Commodities[chainID]; ok {
+		return commodity, nil
+	}
+	chains, err := core.Chains()
+	if err != nil {
+		return "", err
+	}
+	for _, chain := range chains {
+		symbol, _ := chain.GasTokenInfo()
+		if chain.ChainID.String() == chainID && commodityPattern.MatchString(symbol) {
+			return symbol, nil
+		}
+	}
+	return "", fmt.Errorf("no commodity for chain %s; add it to the mapping's commodities", chainID)
+}
+
+// nativeDecimals returns the decimals of a chain's native currency, 18 for
+// unknown chains
+func nativeDecimals(chainID string) (uint8, error) {
+	chains, err := core.Chains()
+	if err != nil {
+		return 0, err
+	}
+	for _, chain := range chains {
+		if chain.ChainID.String() == chainID {
+			_, decimals := chain.GasTokenInfo()
+			return decimals, nil
+		}
+	}
+	return 18, nil
+}
+
+// LedgerPosting is one leg of a ledger entry
+type LedgerPosting struct {
+	Account   string
+	Amount    string
+	Commodity string
+}
+
+// LedgerEntry is a balanced double-entry transaction
+type LedgerEntry struct {
+	Record    *TransactionRecord
+	Payee     string
+	Narration string
+	Postings  []LedgerPosting
+	// Native is the commodity of the chain's native currency
+	Native string
+}
+
+// BuildLedgerEntries turns confirmed history records into balanced entries.
+// Value and token transfers move from the sender's account to the
+// counterparty's; fees, also paid by failed transactions, go to the fee account.
+func BuildLedgerEntries(records []*TransactionRecord, mapping *LedgerMapping) ([]LedgerEntry, error) {
+	var entries []LedgerEntry
+	for _, record := range records {
+		if record.Status != "success" && record.Status != "failed" {
+			continue
+		}
+
+		native, err := mapping.nativeCommodity(record.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		decimals, err := nativeDecimals(record.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		entry := LedgerEntry{Record: record, Payee: record.To, Narration: "Transfer", Native: native}
+		from := mapping.account(record.From, true)
+
+		// posting moves an amount from the sender to an account
+		posting := func(account string, amount *big.Int, decimals uint8, commodity string) {
+			if amount == nil || amount.Sign() == 0 {
+				return
+			}
+			formatted := core.FormatTokenAmount(amount, decimals)
+			entry.Postings = append(entry.Postings,
+				LedgerPosting{Account: from, Amount: "-" + formatted, Commodity: commodity},
+				LedgerPosting{Account: account, Amount: formatted, Commodity: commodity})
+		}
+
+		if record.Status == "success" {
+			value, _ := new(big.Int).SetString(record.Value, 10)
+			posting(mapping.account(record.To, false), value, decimals, native)
+
+			if to, amount, err := core.DecodeERC20Transfer(common.FromHex(record.Data)); err == nil {
+				token, ok := mapping.Tokens[strings.ToLower(record.ChainID+":"+record.To)]
+				if !ok {
+					return nil, fmt.Errorf("transaction %s transfers unknown token %s on chain %s; add it to the mapping's tokens",
+						record.Hash.Hex(), record.To, record.ChainID)
+				}
+				entry.Payee = to.Hex()
+				entry.Narration = "Token transfer"
+				posting(mapping.account(to.Hex(), false), amount, token.Decimals, token.Commodity)
+			} else if len(common.FromHex(record.Data)) > 0 {
+				entry.Narration = "Contract call"
+			}
+		} else {
+			entry.Narration = "Failed transaction"
+		}
+
+		posting(mapping.FeeAccount, record.Fee(), decimals, native)
+
+		if len(entry.Postings) > 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Record.Timestamp.Before(entries[j].Record.Timestamp)
+	})
+	return entries, nil
+}
+
+// ledgerPrice is the price of a native commodity in a currency on a day
+type ledgerPrice struct {
+	day       string
+	commodity string
+	currency  string
+	price     float64
+}
+
+// ledgerPrices collects the prices of the native commodities on the days of
+// the entries, one per day, commodity and currency
+func ledgerPrices(entries []LedgerEntry, values *FiatValues) []ledgerPrice {
+	seen := make(map[string]bool)
+	var prices []ledgerPrice
+	for _, entry := range entries {
+		day := entry.Record.Timestamp.UTC().Format(priceDay)
+		fiat := values.Of(entry.Record)
+		for _, currency := range values.Currencies {
+			value, ok := fiat[currency]
+			key := day + "|" + entry.Native + "|" + currency
+			if !ok || seen[key] {
+				continue
+			}
+			seen[key] = true
+			prices = append(prices, ledgerPrice{day: day, commodity: entry.Native, currency: currency, price: value.Price})
+		}
+	}
+	return prices
+}
+
+// WriteBeancount writes entries in Beancount syntax. With fiat values the
+// entries are preceded by price directives of the native commodities.
+func WriteBeancount(w io.Writer, entries []LedgerEntry, values *FiatValues) error {
+	if values != nil {
+		for _, price := range ledgerPrices(entries, values) {
+			fmt.Fprintf(w, "%s price %s %s %s\n", price.day, price.commodity, strconv.FormatFloat(price.price, 'f', -1, 64), price.currency)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, entry := range entries {
+		record := entry.Record
+		fmt.Fprintf(w, "%s * %q %q\n", record.Timestamp.UTC().Format("2006-01-02"), entry.Payee, entry.Narration)
+		fmt.Fprintf(w, "  txhash: %q\n", record.Hash.Hex())
+		fmt.Fprintf(w, "  chainid: %q\n", record.ChainID)
+		for _, posting := range entry.Postings {
+			fmt.Fprintf(w, "  %-50s %s %s\n", posting.Account, posting.Amount, posting.Commodity)
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return fmt.Errorf("failed to write Beancount entries: %v", err)
+		}
+	}
+	return nil
+}
+
+// WriteLedger writes entries in Ledger-CLI syntax. With fiat values the
+// entries are preceded by P directives of the native commodities.
+func WriteLedger(w io.Writer, entries []LedgerEntry, values *FiatValues) error {
+	if values != nil {
+		for _, price := range ledgerPrices(entries, values) {
+			day := strings.ReplaceAll(price.day, "-", "/")
+			fmt.Fprintf(w, "P %s %s %s %s\n", day, price.commodity, strconv.FormatFloat(price.price, 'f', -1, 64), price.currency)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, entry := range entries {
+		record := entry.Record
+		fmt.Fprintf(w, "%s * %s  ; %s\n", record.Timestamp.UTC().Format("2006/01/02"), entry.Payee, entry.Narration)
+		fmt.Fprintf(w, "    ; txhash: %s\n", record.Hash.Hex())
+		fmt.Fprintf(w, "    ; chainid: %s\n", record.ChainID)
+		for _, posting := range entry.Postings {
+			fmt.Fprintf(w, "    %-50s  %s %s\n", posting.Account, posting.Amount, posting.Commodity)
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return fmt.Errorf("failed to write Ledger entries: %v", err)
+		}
+	}
+	return nil
+}
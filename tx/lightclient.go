@@ -0,0 +1,268 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// emptyCodeHash is the code hash of accounts without code
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// LightClient verifies chain data instead of trusting a single RPC provider.
+// Block headers are only trusted when their hash matches a checkpoint taken
+// from a beacon-chain light client, or when a quorum of independent providers
+// agree on them. State and receipts are then checked against Merkle proofs
+// rooted in those headers.
+type LightClient struct {
+	endpoints  []string
+	quorum     int
+	checkpoint common.Hash
+}
+
+// NewLightClient creates a light client over independent RPC endpoints. A
+// quorum of 0 requires a majority of the endpoints to agree.
+func NewLightClient(endpoints []string, quorum int) (*LightClient, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("light client requires at least one RPC endpoint")
+	}
+	if quorum == 0 {
+		quorum = len(endpoints)/2 + 1
+	}
+	if quorum < 1 || quorum > len(endpoints) {
+		return nil, fmt.Errorf("invalid quorum %d for %d endpoints", quorum, len(endpoints))
+	}
+
+	return &LightClient{endpoints: endpoints, quorum: quorum}, nil
+}
+
+// SetCheckpoint anchors verification to the execution block hash of a
+// finalized beacon block, e.g. as reported by a beacon light client
+func (lc *LightClient) SetCheckpoint(hash common.Hash) {
+	lc.checkpoint = hash
+}
+
+// FinalizedHeader returns the checkpoint header or, without a checkpoint, the
+// most recent finalized header all providers have reached that a quorum agrees on
+func (lc *LightClient) FinalizedHeader(ctx context.Context) (*types.Header, error) {
+	if lc.checkpoint != (common.Hash{}) {
+		return lc.checkpointHeader(ctx)
+	}
+
+	var number *big.Int
+	finalized := big.NewInt(int64(rpc.FinalizedBlockNumber))
+	for _, endpoint := range lc.endpoints {
+		header, err := lc.header(ctx, endpoint, finalized)
+		if err != nil {
+			continue
+		}
+		if number == nil || header.Number.Cmp(number) < 0 {
+			number = header.Number
+		}
+	}
+	if number == nil {
+		return nil, fmt.Errorf("no RPC endpoint returned a finalized block")
+	}
+
+	return lc.HeaderByNumber(ctx, number)
+}
+
+// checkpointHeader fetches the checkpoint header from any provider. Its hash
+// is recomputed locally, so the provider does not need to be trusted.
+func (lc *LightClient) checkpointHeader(ctx context.Context) (*types.Header, error) {
+	for _, endpoint := range lc.endpoints {
+		client, err := dial(ctx, endpoint)
+		if err != nil {
+			continue
+		}
+		header, err := client.HeaderByHash(ctx, lc.checkpoint)
+		client.Close()
+		if err == nil && header.Hash() == lc.checkpoint {
+			return header, nil
+		}
+	}
+	return nil, fmt.Errorf("no RPC endpoint returned checkpoint block %s", lc.checkpoint.Hex())
+}
+
+// HeaderByNumber returns the header a quorum of providers agree on
+func (lc *LightClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	votes := make(map[common.Hash]int)
+	var errs []error
+	for _, endpoint := range lc.endpoints {
+		header, err := lc.header(ctx, endpoint, number)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Hashes are recomputed locally from the header fields
+		hash := header.Hash()
+		votes[hash]++
+		if votes[hash] >= lc.quorum {
+			return header, nil
+		}
+	}
+
+	if len(votes) > 1 {
+		return nil, fmt.Errorf("RPC endpoints disagree on block %s: possible RPC-level deception", number)
+	}
+	return nil, fmt.Errorf("fewer than %d RPC endpoints confirmed block %s: %v", lc.quorum, number, errs)
+}
+
+// header fetches a header from a single provider. Fallbacks are not used, so
+// every vote comes from the provider it is counted for.
+func (lc *LightClient) header(ctx context.Context, endpoint string, number *big.Int) (*types.Header, error) {
+	client, err := dialEndpoint(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	header, err := client.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header from %s: %v", endpoint, err)
+	}
+	return header, nil
+}
+
+// Account returns the state of an address at a verified header, checked
+// against an eth_getProof Merkle proof of the header's state root
+func (lc *LightClient) Account(ctx context.Context, header *types.Header, address common.Address) (*AccountSnapshot, error) {
+	client, err := dial(ctx, lc.endpoints[0])
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result, err := gethclient.New(client.Client()).GetProof(ctx, address, nil, header.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get proof for %s: %v", address.Hex(), err)
+	}
+
+	proof := make([][]byte, 0, len(result.AccountProof))
+	for _, node := range result.AccountProof {
+		raw, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node for %s: %v", address.Hex(), err)
+		}
+		proof = append(proof, raw)
+	}
+
+	value, err := verifyProof(header.Root, crypto.Keccak256(address.Bytes()), proof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify state of %s: %v", address.Hex(), err)
+	}
+
+	// Absent accounts are empty
+	account := &AccountSnapshot{Address: address, Balance: new(big.Int), CodeHash: emptyCodeHash}
+	if value != nil {
+		var state types.StateAccount
+		if err := rlp.DecodeBytes(value, &state); err != nil {
+			return nil, fmt.Errorf("failed to decode state of %s: %v", address.Hex(), err)
+		}
+		account.Balance = state.Balance
+		account.Nonce = state.Nonce
+		account.CodeHash = common.BytesToHash(state.CodeHash)
+		account.IsContract = account.CodeHash != emptyCodeHash
+	}
+
+	return account, nil
+}
+
+// Receipt returns a transaction receipt checked against the receipts root of
+// a block header a quorum of providers agree on
+func (lc *LightClient) Receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	client, err := dial(ctx, lc.endpoints[0])
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %v", err)
+	}
+
+	header, err := lc.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != receipt.BlockHash {
+		return nil, fmt.Errorf("receipt block %s is not the verified block %s", receipt.BlockHash.Hex(), header.Hash().Hex())
+	}
+
+	// Locate the transaction in the verified transaction trie
+	block, err := client.BlockByHash(ctx, receipt.BlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block: %v", err)
+	}
+	transactions := block.Transactions()
+	index := -1
+	for i, transaction := range transactions {
+		if transaction.Hash() == hash {
+			index = i
+		}
+	}
+	if root := derivableRoot(transactions); root != header.TxHash {
+		return nil, fmt.Errorf("transactions of block %s do not match its transactions root: possible RPC-level deception", header.Number)
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("transaction %s not found in block %s", hash.Hex(), header.Number)
+	}
+
+	// Rebuild the receipt trie of the whole block
+	receipts, err := client.BlockReceipts(ctx, rpc.BlockNumberOrHashWithHash(receipt.BlockHash, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block receipts: %v", err)
+	}
+	if root := derivableRoot(types.Receipts(receipts)); root != header.ReceiptHash {
+		return nil, fmt.Errorf("receipts of block %s do not match its receipts root: possible RPC-level deception", header.Number)
+	}
+	if index >= len(receipts) {
+		return nil, fmt.Errorf("block %s has %d receipts for %d transactions", header.Number, len(receipts), len(transactions))
+	}
+
+	// Fields outside the receipt encoding come from the verified header
+	verified := receipts[index]
+	verified.TxHash = hash
+	verified.BlockHash = header.Hash()
+	verified.BlockNumber = header.Number
+	return verified, nil
+}
+
+// FetchReceipt returns a transaction receipt as reported by a single RPC provider
+func FetchReceipt(ctx context.Context, rpcURL string, hash common.Hash) (*types.Receipt, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %v", err)
+	}
+	return receipt, nil
+}
+
+// derivableRoot computes the trie root of a transaction or receipt list, as
+// committed to by the transactions and receipts roots of a header
+func derivableRoot(list types.DerivableList) common.Hash {
+	entries := make([]trieEntry, list.Len())
+	for i := range entries {
+		key, _ := rlp.EncodeToBytes(uint64(i))
+		var value bytes.Buffer
+		list.EncodeIndex(i, &value)
+		entries[i] = trieEntry{key: key, value: value.Bytes()}
+	}
+	return trieRoot(entries)
+}
@@ -2,44 +2,83 @@ package tx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-// TransactionStatus represents the status of a monitored transaction
+const (
+	// DefaultConfirmations is the default number of confirmations after which a
+	// transaction is final
+	DefaultConfirmations = 12
+	// DefaultMonitorPollInterval is how often new blocks are polled for when the
+	// endpoint does not support newHeads subscriptions
+	DefaultMonitorPollInterval = 5 * time.Second
+)
+
+// TransactionStatus represents the status of a monitored transaction.
+// Confirmations counts the including block; Reorgs counts the times the
+// transaction was dropped from or moved out of a block it was included in.
 type TransactionStatus struct {
-	Hash      common.Hash `json:"hash"`
-	Status    string      `json:"status"`
-	BlockNum  uint64      `json:"blockNum,omitempty"`
-	GasUsed   uint64      `json:"gasUsed,omitempty"`
-	Error     string      `json:"error,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
+	Hash          common.Hash `json:"hash"`
+	Status        string      `json:"status"`
+	BlockNum      uint64      `json:"blockNum,omitempty"`
+	BlockHash     common.Hash `json:"blockHash,omitempty"`
+	GasUsed       uint64      `json:"gasUsed,omitempty"`
+	Confirmations uint64      `json:"confirmations"`
+	Final         bool        `json:"final"`
+	Reorgs        int         `json:"reorgs,omitempty"`
+	Event         string      `json:"event,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	Timestamp     time.Time   `json:"timestamp"`
 }
 
-// Monitor handles transaction monitoring
+// Monitor handles transaction monitoring. New blocks come from a newHeads
+// subscription on WebSocket endpoints and from polling otherwise; every
+// monitored transaction is rechecked on each new block.
 type Monitor struct {
-	client    *ethclient.Client
-	statuses  map[common.Hash]*TransactionStatus
-	mu        sync.RWMutex
-	callbacks map[common.Hash][]func(*TransactionStatus)
+	// Confirmations is the number of confirmations after which a transaction is final
+	Confirmations uint64
+	// PollInterval is how often new blocks are polled for without subscriptions
+	PollInterval time.Duration
+	// OnSource is called with the source of new blocks once monitoring starts
+	OnSource func(source string)
+
+	client       *ethclient.Client
+	statuses     map[common.Hash]*TransactionStatus
+	mu           sync.RWMutex
+	callbacks    map[common.Hash][]statusCallback
+	nextCallback CallbackID
+}
+
+// CallbackID identifies a callback added with AddCallback
+type CallbackID uint64
+
+// statusCallback is a callback for the status updates of a transaction
+type statusCallback struct {
+	id CallbackID
+	fn func(*TransactionStatus)
 }
 
 // NewMonitor creates a new transaction monitor
 func NewMonitor(rpcURL string) (*Monitor, error) {
-	client, err := ethclient.Dial(rpcURL)
+	client, err := dial(context.Background(), rpcURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RPC: %v", err)
+		return nil, err
 	}
 
 	return &Monitor{
-		client:    client,
-		statuses:  make(map[common.Hash]*TransactionStatus),
-		callbacks: make(map[common.Hash][]func(*TransactionStatus)),
+		Confirmations: DefaultConfirmations,
+		PollInterval:  DefaultMonitorPollInterval,
+		client:        client,
+		statuses:      make(map[common.Hash]*TransactionStatus),
+		callbacks:     make(map[common.Hash][]statusCallback),
 	}, nil
 }
 
@@ -65,89 +104,252 @@ func (m *Monitor) MonitorTransaction(ctx context.Context, hash common.Hash) erro
 	return nil
 }
 
-// monitorTransaction continuously monitors a transaction
+// monitorTransaction checks a transaction on every new block until it is
+// final, fails to be checked or ctx is done
 func (m *Monitor) monitorTransaction(ctx context.Context, hash common.Hash) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	heads := m.watchHeads(ctx)
 
+	// Check once right away; the transaction may already be included
+	head, err := call(ctx, m.client.BlockNumber)
 	for {
+		if err == nil {
+			final, err := m.check(ctx, hash, head)
+			if err != nil {
+				m.fail(hash, err)
+				return
+			}
+			if final {
+				return
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			receipt, err := m.client.TransactionReceipt(ctx, hash)
-			if err != nil {
-				if err.Error() == "not found" {
-					continue
-				}
-				m.updateStatus(hash, "error", 0, 0, err.Error())
+		case number, ok := <-heads:
+			if !ok {
 				return
 			}
+			head, err = number, nil
+		}
+	}
+}
 
-			status := "success"
-			if receipt.Status == types.ReceiptStatusFailed {
-				status = "failed"
+// check updates the status of a transaction at a new head and reports whether
+// it is final
+func (m *Monitor) check(ctx context.Context, hash common.Hash, head uint64) (bool, error) {
+	receipt, err := call(ctx, func(ctx context.Context) (*types.Receipt, error) {
+		return m.client.TransactionReceipt(ctx, hash)
+	})
+	if errors.Is(err, ethereum.NotFound) {
+		// A transaction that was included and has no receipt any more was reorged out
+		m.updateStatus(hash, func(status *TransactionStatus) bool {
+			if status.BlockNum == 0 {
+				return false
 			}
+			status.Event = fmt.Sprintf("dropped from block %d by a reorg, pending again", status.BlockNum)
+			status.Status = "pending"
+			status.Reorgs++
+			status.BlockNum, status.BlockHash, status.GasUsed, status.Confirmations = 0, common.Hash{}, 0, 0
+			return true
+		})
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-			m.updateStatus(hash, status, receipt.BlockNumber.Uint64(), receipt.GasUsed, "")
-			return
+	// Nodes may briefly serve receipts of a block that is no longer canonical
+	header, err := call(ctx, func(ctx context.Context) (*types.Header, error) {
+		return m.client.HeaderByNumber(ctx, receipt.BlockNumber)
+	})
+	if err != nil {
+		return false, err
+	}
+	if header.Hash() != receipt.BlockHash {
+		return false, nil
+	}
+
+	number := receipt.BlockNumber.Uint64()
+	var confirmations uint64
+	if head >= number {
+		confirmations = head - number + 1
+	}
+	final := confirmations >= m.Confirmations
+
+	result := "success"
+	if receipt.Status == types.ReceiptStatusFailed {
+		result = "failed"
+	}
+
+	m.updateStatus(hash, func(status *TransactionStatus) bool {
+		switch {
+		case status.BlockNum == 0:
+			status.Event = fmt.Sprintf("included in block %d", number)
+		case status.BlockHash != receipt.BlockHash:
+			status.Event = fmt.Sprintf("moved from block %d to block %d by a reorg", status.BlockNum, number)
+			status.Reorgs++
+		case status.Confirmations != confirmations:
+			status.Event = fmt.Sprintf("%d of %d confirmations", confirmations, m.Confirmations)
+		default:
+			return false
 		}
+		if final {
+			status.Event = fmt.Sprintf("final after %d confirmations", confirmations)
+		}
+		status.Status = result
+		status.BlockNum, status.BlockHash, status.GasUsed = number, receipt.BlockHash, receipt.GasUsed
+		status.Confirmations, status.Final = confirmations, final
+		return true
+	})
+	return final, nil
+}
+
+// fail marks a transaction whose status could not be checked
+func (m *Monitor) fail(hash common.Hash, err error) {
+	m.updateStatus(hash, func(status *TransactionStatus) bool {
+		status.Status = "error"
+		status.Error = err.Error()
+		status.Event = "monitoring stopped"
+		return true
+	})
+}
+
+// watchHeads delivers new block numbers from a newHeads subscription, or by
+// polling when the endpoint does not support subscriptions. Numbers that were
+// not received in time are replaced by newer ones.
+func (m *Monitor) watchHeads(ctx context.Context) <-chan uint64 {
+	heads := make(chan uint64, 1)
+	headers := make(chan *types.Header, 16)
+
+	sub, err := m.client.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		m.source(fmt.Sprintf("polling every %s", m.PollInterval))
+		go m.pollHeads(ctx, heads)
+		return heads
 	}
+
+	m.source("newHeads subscription")
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				close(heads)
+				return
+			case err := <-sub.Err():
+				// Keep going by polling when the subscription breaks
+				m.source(fmt.Sprintf("polling every %s (subscription ended: %v)", m.PollInterval, err))
+				m.pollHeads(ctx, heads)
+				return
+			case header := <-headers:
+				offerHead(heads, header.Number.Uint64())
+			}
+		}
+	}()
+	return heads
 }
 
-// updateStatus updates the status of a transaction
-func (m *Monitor) updateStatus(hash common.Hash, status string, blockNum, gasUsed uint64, errMsg string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// pollHeads polls the latest block number until ctx is done, then closes heads
+func (m *Monitor) pollHeads(ctx context.Context, heads chan uint64) {
+	defer close(heads)
+
+	interval := m.PollInterval
+	if interval <= 0 {
+		interval = DefaultMonitorPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	if txStatus, exists := m.statuses[hash]; exists {
-		txStatus.Status = status
-		txStatus.BlockNum = blockNum
-		txStatus.GasUsed = gasUsed
-		txStatus.Error = errMsg
-		txStatus.Timestamp = time.Now()
-
-		// Call callbacks
-		if callbacks, exists := m.callbacks[hash]; exists {
-			for _, callback := range callbacks {
-				callback(txStatus)
+	var last uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Transient errors just skip a tick
+			if number, err := m.client.BlockNumber(ctx); err == nil && number != last {
+				last = number
+				offerHead(heads, number)
 			}
 		}
 	}
 }
 
-// GetStatus returns the current status of a transaction
+// offerHead replaces an undelivered block number with a newer one
+func offerHead(heads chan uint64, number uint64) {
+	select {
+	case <-heads:
+	default:
+	}
+	heads <- number
+}
+
+// source reports the source of new blocks
+func (m *Monitor) source(source string) {
+	if m.OnSource != nil {
+		m.OnSource(source)
+	}
+}
+
+// updateStatus applies change to the status of a transaction and, if change
+// reports an update, calls the callbacks with a copy outside the lock
+func (m *Monitor) updateStatus(hash common.Hash, change func(*TransactionStatus) bool) {
+	m.mu.Lock()
+	txStatus, exists := m.statuses[hash]
+	if !exists || !change(txStatus) {
+		m.mu.Unlock()
+		return
+	}
+	txStatus.Timestamp = time.Now()
+	snapshot := *txStatus
+	callbacks := make([]statusCallback, len(m.callbacks[hash]))
+	copy(callbacks, m.callbacks[hash])
+	m.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback.fn(&snapshot)
+	}
+}
+
+// GetStatus returns a copy of the current status of a transaction
 func (m *Monitor) GetStatus(hash common.Hash) (*TransactionStatus, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	if status, exists := m.statuses[hash]; exists {
-		return status, nil
+		snapshot := *status
+		return &snapshot, nil
 	}
 	return nil, fmt.Errorf("transaction not being monitored")
 }
 
-// AddCallback adds a callback function for status updates
-func (m *Monitor) AddCallback(hash common.Hash, callback func(*TransactionStatus)) {
+// AddCallback adds a callback function for status updates and returns the
+// ID to remove it with
+func (m *Monitor) AddCallback(hash common.Hash, callback func(*TransactionStatus)) CallbackID {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.callbacks[hash] = append(m.callbacks[hash], callback)
+	m.nextCallback++
+	m.callbacks[hash] = append(m.callbacks[hash], statusCallback{id: m.nextCallback, fn: callback})
+	return m.nextCallback
 }
 
-// RemoveCallback removes a callback function
-func (m *Monitor) RemoveCallback(hash common.Hash, callback func(*TransactionStatus)) {
+// RemoveCallback removes the callback with the ID AddCallback returned
+func (m *Monitor) RemoveCallback(hash common.Hash, id CallbackID) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if callbacks, exists := m.callbacks[hash]; exists {
-		for i, cb := range callbacks {
-			if fmt.Sprintf("%v", cb) == fmt.Sprintf("%v", callback) {
-				m.callbacks[hash] = append(callbacks[:i], callbacks[i+1:]...)
-				break
-			}
+	callbacks := m.callbacks[hash]
+	for i, callback := range callbacks {
+		if callback.id == id {
+			m.callbacks[hash] = append(callbacks[:i], callbacks[i+1:]...)
+			break
 		}
 	}
+	if len(m.callbacks[hash]) == 0 {
+		delete(m.callbacks, hash)
+	}
 }
 
 // Close closes the monitor
@@ -0,0 +1,217 @@
+package tx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// errProofMismatch is returned when a Merkle-Patricia proof does not lead to the expected root
+var errProofMismatch = errors.New("proof does not match the trusted root")
+
+// keyNibbles expands a key into its hex nibbles
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, 0, len(key)*2)
+	for _, b := range key {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	return nibbles
+}
+
+// compactDecode decodes a hex-prefix encoded path, reporting whether it belongs to a leaf
+func compactDecode(path []byte) ([]byte, bool, error) {
+	if len(path) == 0 {
+		return nil, false, fmt.Errorf("empty node path")
+	}
+	nibbles := keyNibbles(path)
+	flag := nibbles[0]
+	if flag > 3 {
+		return nil, false, fmt.Errorf("invalid node path flag %d", flag)
+	}
+	if flag&1 == 1 {
+		nibbles = nibbles[1:]
+	} else {
+		nibbles = nibbles[2:]
+	}
+	return nibbles, flag >= 2, nil
+}
+
+// compactEncode hex-prefix encodes a nibble path
+func compactEncode(nibbles []byte, leaf bool) []byte {
+	flag := byte(0)
+	if leaf {
+		flag = 2
+	}
+	if len(nibbles)%2 == 1 {
+		nibbles = append([]byte{flag + 1}, nibbles...)
+	} else {
+		nibbles = append([]byte{flag, 0}, nibbles...)
+	}
+
+	encoded := make([]byte, len(nibbles)/2)
+	for i := range encoded {
+		encoded[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return encoded
+}
+
+// verifyProof walks a Merkle-Patricia proof from the root and returns the
+// value stored under key, or nil if the proof shows the key is absent
+func verifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	nodes := make(map[common.Hash][]byte, len(proof))
+	for _, node := range proof {
+		nodes[crypto.Keccak256Hash(node)] = node
+	}
+
+	node, ok := nodes[root]
+	if !ok {
+		return nil, errProofMismatch
+	}
+	nibbles := keyNibbles(key)
+
+	for {
+		var items []rlp.RawValue
+		if err := rlp.DecodeBytes(node, &items); err != nil {
+			return nil, fmt.Errorf("invalid proof node: %v", err)
+		}
+
+		var child rlp.RawValue
+		switch len(items) {
+		case 17:
+			if len(nibbles) == 0 {
+				return stringContent(items[16])
+			}
+			child, nibbles = items[nibbles[0]], nibbles[1:]
+
+		case 2:
+			path, err := stringContent(items[0])
+			if err != nil {
+				return nil, err
+			}
+			prefix, leaf, err := compactDecode(path)
+			if err != nil {
+				return nil, err
+			}
+			if leaf {
+				if !bytes.Equal(prefix, nibbles) {
+					return nil, nil
+				}
+				return stringContent(items[1])
+			}
+			if !bytes.HasPrefix(nibbles, prefix) {
+				return nil, nil
+			}
+			child, nibbles = items[1], nibbles[len(prefix):]
+
+		default:
+			return nil, fmt.Errorf("invalid proof node with %d items", len(items))
+		}
+
+		// Children are either embedded nodes or references by hash
+		kind, content, _, err := rlp.Split(child)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node: %v", err)
+		}
+		switch {
+		case kind == rlp.List:
+			node = child
+		case len(content) == 0:
+			return nil, nil
+		case len(content) == common.HashLength:
+			if node, ok = nodes[common.BytesToHash(content)]; !ok {
+				return nil, errProofMismatch
+			}
+		default:
+			return nil, fmt.Errorf("invalid child reference of %d bytes", len(content))
+		}
+	}
+}
+
+// stringContent returns the content of an RLP string item
+func stringContent(item rlp.RawValue) ([]byte, error) {
+	content, _, err := rlp.SplitString(item)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proof node: %v", err)
+	}
+	return content, nil
+}
+
+// trieEntry is a key/value pair inserted into a trie
+type trieEntry struct {
+	key   []byte
+	value []byte
+}
+
+// trieRoot computes the Merkle-Patricia root of a set of key/value pairs
+func trieRoot(entries []trieEntry) common.Hash {
+	if len(entries) == 0 {
+		return common.HexToHash("0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	}
+
+	nodes := make([]trieEntry, len(entries))
+	for i, e := range entries {
+		nodes[i] = trieEntry{key: keyNibbles(e.key), value: e.value}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return bytes.Compare(nodes[i].key, nodes[j].key) < 0 })
+
+	return crypto.Keccak256Hash(encodeTrieNode(nodes, 0))
+}
+
+// encodeTrieNode returns the RLP encoding of the node holding entries below depth.
+// Entries must be sorted and share their first depth nibbles.
+func encodeTrieNode(entries []trieEntry, depth int) []byte {
+	if len(entries) == 1 {
+		node, _ := rlp.EncodeToBytes([][]byte{compactEncode(entries[0].key[depth:], true), entries[0].value})
+		return node
+	}
+
+	// Extension over the prefix shared by all entries
+	first, last := entries[0].key, entries[len(entries)-1].key
+	shared := 0
+	for depth+shared < len(first) && depth+shared < len(last) && first[depth+shared] == last[depth+shared] {
+		shared++
+	}
+	if shared > 0 {
+		node, _ := rlp.EncodeToBytes([]interface{}{
+			compactEncode(first[depth:depth+shared], false),
+			trieReference(encodeTrieNode(entries, depth+shared)),
+		})
+		return node
+	}
+
+	// Branch on the next nibble
+	branch := make([]interface{}, 17)
+	branch[16] = []byte{}
+	for len(entries) > 0 && len(entries[0].key) == depth {
+		branch[16] = entries[0].value
+		entries = entries[1:]
+	}
+	for nibble := byte(0); nibble < 16; nibble++ {
+		end := 0
+		for end < len(entries) && entries[end].key[depth] == nibble {
+			end++
+		}
+		if end == 0 {
+			branch[nibble] = []byte{}
+			continue
+		}
+		branch[nibble] = trieReference(encodeTrieNode(entries[:end], depth+1))
+		entries = entries[end:]
+	}
+
+	node, _ := rlp.EncodeToBytes(branch)
+	return node
+}
+
+// trieReference embeds small nodes and references larger ones by hash
+func trieReference(node []byte) interface{} {
+	if len(node) < 32 {
+		return rlp.RawValue(node)
+	}
+	return crypto.Keccak256(node)
+}
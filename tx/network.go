@@ -0,0 +1,358 @@
+package tx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	proxyMu        sync.RWMutex
+	globalProxy    *url.URL
+	endpointProxys = make(map[string]*url.URL)
+	endpointPins   = make(map[string][]string)
+	fallbacks      = make(map[string][]string)
+	ranking        *Benchmarks
+	dohResolver    *DoHResolver
+	// backendOverride replaces every RPC endpoint with a simulator or a
+	// replayed session
+	backendOverride func(ctx context.Context, rpcURL string) (*ethclient.Client, error)
+)
+
+// probeTimeout bounds the check that an endpoint with fallbacks answers
+const probeTimeout = 5 * time.Second
+
+// parseProxy validates a proxy URL. socks5:// (hostnames resolved by the proxy,
+// as required for Tor and .onion endpoints), http:// and https:// are supported.
+func parseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %v", proxy, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		// net/http always lets SOCKS5 proxies resolve hostnames
+		u.Scheme = "socks5"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected socks5, http or https)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", proxy)
+	}
+	return u, nil
+}
+
+// SetProxy routes all outbound connections through the given proxy. An empty
+// string falls back to the standard proxy environment variables.
+func SetProxy(proxy string) error {
+	var u *url.URL
+	if proxy != "" {
+		var err error
+		if u, err = parseProxy(proxy); err != nil {
+			return err
+		}
+	}
+
+	proxyMu.Lock()
+	globalProxy = u
+	proxyMu.Unlock()
+	return nil
+}
+
+// SetEndpointProxy routes connections to a single endpoint through the given
+// proxy, taking precedence over the global proxy
+func SetEndpointProxy(endpoint, proxy string) error {
+	u, err := parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+
+	proxyMu.Lock()
+	endpointProxys[endpoint] = u
+	proxyMu.Unlock()
+	return nil
+}
+
+// SetDoH resolves the hostnames of all directly dialed endpoints through the
+// given DNS-over-HTTPS endpoint. An empty string restores the system resolver.
+func SetDoH(endpoint string) error {
+	var resolver *DoHResolver
+	if endpoint != "" {
+		var err error
+		if resolver, err = NewDoHResolver(endpoint); err != nil {
+			return err
+		}
+	}
+
+	proxyMu.Lock()
+	dohResolver = resolver
+	proxyMu.Unlock()
+	return nil
+}
+
+// SetEndpointPins pins the TLS certificates accepted for an endpoint to the
+// given SPKI SHA-256 hashes
+func SetEndpointPins(endpoint string, pins []string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "wss" {
+		return fmt.Errorf("cannot pin certificates for %s: endpoint does not use TLS", endpoint)
+	}
+
+	normalized, err := normalizePins(pins)
+	if err != nil {
+		return err
+	}
+
+	proxyMu.Lock()
+	endpointPins[endpoint] = normalized
+	proxyMu.Unlock()
+	return nil
+}
+
+// SetEndpointFallbacks registers endpoints that are tried in order when an
+// endpoint does not answer
+func SetEndpointFallbacks(endpoint string, urls []string) {
+	proxyMu.Lock()
+	fallbacks[endpoint] = urls
+	proxyMu.Unlock()
+}
+
+// UseBenchmarks orders an endpoint and its fallbacks by their benchmarks
+// before dialing, preferring the fastest healthy one
+func UseBenchmarks(b *Benchmarks) {
+	proxyMu.Lock()
+	ranking = b
+	proxyMu.Unlock()
+}
+
+// proxyFor returns the proxy configured for an endpoint, or nil
+func proxyFor(endpoint string) *url.URL {
+	proxyMu.RLock()
+	defer proxyMu.RUnlock()
+
+	if u, ok := endpointProxys[endpoint]; ok {
+		return u
+	}
+	return globalProxy
+}
+
+// HTTPClient returns an HTTP client for an endpoint that honors offline mode,
+// the configured proxies, DoH resolution and certificate pins. It is meant for every outbound HTTP request,
+// including explorer APIs, price feeds and webhooks.
+func HTTPClient(endpoint string) (*http.Client, error) {
+	if offline.Load() {
+		return nil, ErrOffline
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+
+	proxy := proxyFor(endpoint)
+	if proxy == nil && strings.HasSuffix(u.Hostname(), ".onion") {
+		return nil, fmt.Errorf("endpoint %s is a Tor hidden service and requires a socks5 proxy", u.Host)
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	proxyMu.RLock()
+	resolver := dohResolver
+	pins := endpointPins[endpoint]
+	proxyMu.RUnlock()
+
+	// Resolve hostnames over DoH instead of the (possibly hostile) local resolver
+	if resolver != nil {
+		transport.DialContext = resolver.DialContext
+	}
+
+	// Only accept the pinned certificates for this endpoint
+	if len(pins) > 0 {
+		transport.TLSClientConfig = &tls.Config{
+			VerifyConnection: verifyPins(u.Hostname(), pins),
+		}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// dial connects to an RPC endpoint or, if it has fallbacks and does not answer
+// eth_chainId, to the first of its fallbacks that does. With UseBenchmarks the
+// endpoints are tried in the order of their benchmarks.
+func dial(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+	proxyMu.RLock()
+	urls := fallbacks[rpcURL]
+	benchmarks := ranking
+	proxyMu.RUnlock()
+	if len(urls) == 0 {
+		return dialEndpoint(ctx, rpcURL)
+	}
+
+	endpoints := append([]string{rpcURL}, urls...)
+	if benchmarks != nil {
+		endpoints = benchmarks.Rank(endpoints)
+	}
+	// Endpoints that just rate limited requests are tried last
+	endpoints = deprioritizeThrottled(endpoints)
+	var failures []string
+	for _, endpoint := range endpoints {
+		client, err := dialEndpoint(ctx, endpoint)
+		if err == nil {
+			probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+			_, err = client.ChainID(probeCtx)
+			cancel()
+			if err == nil {
+				return client, nil
+			}
+			client.Close()
+		}
+		if errors.Is(err, ErrOffline) {
+			return nil, err
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", endpointHost(endpoint), rpcFailure(err)))
+	}
+	return nil, &RPCError{Err: fmt.Errorf("no RPC endpoint answered (%s)", strings.Join(failures, "; "))}
+}
+
+// RPCError marks a failure to reach an RPC endpoint or to get an answer from
+// it, as opposed to an error the node answered with such as a revert
+type RPCError struct {
+	Err error
+}
+
+func (e *RPCError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrRPCUnavailable
+func (e *RPCError) Is(target error) bool {
+	return target == ErrRPCUnavailable
+}
+
+// answered reports whether an error of an RPC call came from the node itself
+func answered(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr)
+}
+
+// rpcFailure classifies an error of an RPC call: answers of the node become
+// NodeErrors, and failures to get one as well as rate limit refusals become
+// RPCErrors. Missing results, disabled network access and errors classified
+// before are returned unchanged.
+func rpcFailure(err error) error {
+	var marked *RPCError
+	var node *NodeError
+	switch {
+	case err == nil, errors.Is(err, ethereum.NotFound), errors.Is(err, ErrOffline), errors.As(err, &marked), errors.As(err, &node):
+		return err
+	}
+	// Providers refuse requests over their rate limit with answers too
+	if limit := asRateLimit(err); limit != nil {
+		return &RPCError{Err: limit}
+	}
+	if answered(err) {
+		return nodeError(err)
+	}
+	return &RPCError{Err: err}
+}
+
+// endpointHost returns the host of an endpoint, leaving out paths that may carry API keys
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return endpoint
+}
+
+// dialEndpoint connects to an RPC endpoint, to the simulator selected with
+// UseSimulatedChain or UseSimulator, or to the session replayed with ReplayRPC
+func dialEndpoint(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+	proxyMu.RLock()
+	override := backendOverride
+	proxyMu.RUnlock()
+	if override != nil {
+		return override(ctx, rpcURL)
+	}
+	return dialDirect(ctx, rpcURL)
+}
+
+// WebSocketDialer returns a WebSocket dialer for an endpoint with the same
+// network settings as HTTPClient
+func WebSocketDialer(endpoint string) (*websocket.Dialer, error) {
+	httpClient, err := HTTPClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	dialer := webSocketDialer(httpClient.Transport.(*http.Transport))
+	return &dialer, nil
+}
+
+// webSocketDialer returns a WebSocket dialer using the settings of an HTTP transport
+func webSocketDialer(transport *http.Transport) websocket.Dialer {
+	return websocket.Dialer{
+		Proxy:            transport.Proxy,
+		NetDialContext:   transport.DialContext,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: 30 * time.Second,
+	}
+}
+
+// dialDirect connects to an RPC endpoint unless offline mode is enabled, applying
+// the network settings of HTTPClient to both HTTP and WebSocket connections
+func dialDirect(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+	configured := rpcURL
+	// Chain URLs arrive resolved; what is left is a reference that failed or
+	// an endpoint given on the command line
+	rpcURL, err := secrets.Expand(rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve RPC URL: %v", err)
+	}
+
+	httpClient, err := HTTPClient(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := httpClient.Transport.(*http.Transport)
+	// Sessions recorded with RecordRPC see the calls as the provider answered them
+	recording := recordingTransportFor(configured, rpcURL, &rateLimitTransport{endpoint: configured, next: transport})
+	client, err := rpc.DialOptions(ctx, rpcURL,
+		rpc.WithHTTPClient(&http.Client{Transport: recording}),
+		rpc.WithWebsocketDialer(webSocketDialer(transport)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RPC: %v", err)
+	}
+	return ethclient.NewClient(client), nil
+}
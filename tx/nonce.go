@@ -0,0 +1,255 @@
+package tx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultNonceLeaseFile is the default location of the shared nonce lease table
+var DefaultNonceLeaseFile = filepath.Join(historyDir, "nonces.json")
+
+const (
+	// DefaultNonceLeaseTTL is how long a nonce stays reserved without being broadcast
+	DefaultNonceLeaseTTL = 10 * time.Minute
+
+	// LeaseActive marks a nonce reserved by an operator
+	LeaseActive = "leased"
+	// LeaseBroadcast marks a nonce whose transaction was broadcast
+	LeaseBroadcast = "broadcast"
+
+	// staleLockAge is the age after which a lock file left by a crashed process is removed
+	staleLockAge = 30 * time.Second
+)
+
+// NonceLease is a nonce reserved by one operator of a shared address
+type NonceLease struct {
+	Address   common.Address `json:"address"`
+	ChainID   string         `json:"chainId"`
+	Nonce     uint64         `json:"nonce"`
+	Holder    string         `json:"holder"`
+	Status    string         `json:"status"`
+	LeasedAt  time.Time      `json:"leasedAt"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	TxHash    *common.Hash   `json:"txHash,omitempty"`
+}
+
+// expired reports whether an unbroadcast lease can be reclaimed
+func (l *NonceLease) expired(now time.Time) bool {
+	return l.Status == LeaseActive && now.After(l.ExpiresAt)
+}
+
+// NonceAllocator leases nonces from a lease table shared by several operators,
+// e.g. on a network drive. Every operation holds an exclusive lock file, so
+// two operators never receive the same nonce.
+type NonceAllocator struct {
+	path string
+	ttl  time.Duration
+}
+
+// NewNonceAllocator creates an allocator over a lease table file
+func NewNonceAllocator(path string, ttl time.Duration) (*NonceAllocator, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("nonce lease TTL must be positive")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create nonce lease directory: %v", err)
+	}
+	return &NonceAllocator{path: path, ttl: ttl}, nil
+}
+
+// Lease reserves the lowest nonce at or above the account's pending nonce that
+// no other operator holds. Leases below the pending nonce have been mined and
+// are dropped; expired leases are reclaimed.
+func (a *NonceAllocator) Lease(address common.Address, chainID string, pendingNonce uint64, holder string) (*NonceLease, error) {
+	var lease *NonceLease
+	err := a.update(func(leases []*NonceLease) ([]*NonceLease, error) {
+		now := time.Now()
+		leases = prune(leases, address, chainID, pendingNonce, now)
+
+		held := make(map[uint64]bool)
+		for _, l := range leases {
+			if l.Address == address && l.ChainID == chainID {
+				held[l.Nonce] = true
+			}
+		}
+
+		nonce := pendingNonce
+		for held[nonce] {
+			nonce++
+		}
+
+		lease = &NonceLease{
+			Address:   address,
+			ChainID:   chainID,
+			Nonce:     nonce,
+			Holder:    holder,
+			Status:    LeaseActive,
+			LeasedAt:  now,
+			ExpiresAt: now.Add(a.ttl),
+		}
+		return append(leases, lease), nil
+	})
+	return lease, err
+}
+
+// MarkBroadcast records that the transaction using a leased nonce was broadcast,
+// so the lease no longer expires. It reports whether a lease was found.
+func (a *NonceAllocator) MarkBroadcast(address common.Address, chainID string, nonce uint64, hash common.Hash) (bool, error) {
+	found := false
+	err := a.update(func(leases []*NonceLease) ([]*NonceLease, error) {
+		for _, l := range leases {
+			if l.Address == address && l.ChainID == chainID && l.Nonce == nonce {
+				l.Status = LeaseBroadcast
+				l.TxHash = &hash
+				found = true
+			}
+		}
+		return leases, nil
+	})
+	return found, err
+}
+
+// Release gives up an unbroadcast lease so the nonce can be reused immediately
+func (a *NonceAllocator) Release(address common.Address, chainID string, nonce uint64) error {
+	return a.update(func(leases []*NonceLease) ([]*NonceLease, error) {
+		for i, l := range leases {
+			if l.Address != address || l.ChainID != chainID || l.Nonce != nonce {
+				continue
+			}
+			if l.Status == LeaseBroadcast {
+				return nil, fmt.Errorf("nonce %d was already broadcast in %s", nonce, l.TxHash.Hex())
+			}
+			return append(leases[:i], leases[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("no lease for nonce %d of %s", nonce, address.Hex())
+	})
+}
+
+// Leases returns the current leases of an address, reclaiming expired ones
+func (a *NonceAllocator) Leases(address common.Address, chainID string) ([]*NonceLease, error) {
+	var result []*NonceLease
+	err := a.update(func(leases []*NonceLease) ([]*NonceLease, error) {
+		now := time.Now()
+		var kept []*NonceLease
+		for _, l := range leases {
+			if l.expired(now) {
+				continue
+			}
+			kept = append(kept, l)
+			if l.Address == address && l.ChainID == chainID {
+				result = append(result, l)
+			}
+		}
+		return kept, nil
+	})
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Nonce < result[j].Nonce })
+	return result, err
+}
+
+// prune drops mined and expired leases of an address
+func prune(leases []*NonceLease, address common.Address, chainID string, pendingNonce uint64, now time.Time) []*NonceLease {
+	var kept []*NonceLease
+	for _, l := range leases {
+		if l.expired(now) {
+			continue
+		}
+		if l.Address == address && l.ChainID == chainID && l.Nonce < pendingNonce {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+// update applies fn to the lease table while holding the lock
+func (a *NonceAllocator) update(fn func([]*NonceLease) ([]*NonceLease, error)) error {
+	unlock, err := lockFile(a.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var leases []*NonceLease
+	data, err := os.ReadFile(a.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read nonce leases: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &leases); err != nil {
+			return fmt.Errorf("failed to parse nonce leases: %v", err)
+		}
+	}
+
+	leases, err = fn(leases)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(leases, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal nonce leases: %v", err)
+	}
+
+	if err := writeFileAtomic(a.path, data); err != nil {
+		return fmt.Errorf("failed to write nonce leases: %v", err)
+	}
+	return nil
+}
+
+// lockFile acquires a lock file next to a shared file, waiting for other
+// processes and removing locks left behind by crashed ones
+func lockFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(2 * staleLockAge)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic replaces a file atomically so readers never see a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// String returns a one-line description of the lease
+func (l *NonceLease) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "nonce %d %s by %s", l.Nonce, l.Status, l.Holder)
+	if l.TxHash != nil {
+		fmt.Fprintf(&sb, " (%s)", l.TxHash.Hex())
+	} else {
+		fmt.Fprintf(&sb, ", expires %s", l.ExpiresAt.Format(time.RFC3339))
+	}
+	return sb.String()
+}
@@ -0,0 +1,22 @@
+package tx
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrOffline is returned by every RPC connection attempt while offline mode is enabled
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+// offline disables all RPC connections made by this package when set
+var offline atomic.Bool
+
+// SetOffline enables or disables offline mode for all RPC connections
+func SetOffline(enabled bool) {
+	offline.Store(enabled)
+}
+
+// IsOffline reports whether offline mode is enabled
+func IsOffline() bool {
+	return offline.Load()
+}
@@ -0,0 +1,165 @@
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// DefaultOrderFile is the default location of the book of signed off-chain orders
+var DefaultOrderFile = filepath.Join(historyDir, "orders.json")
+
+const (
+	// OrderOpen marks a signed order that can still be filled
+	OrderOpen = "open"
+	// OrderExpired marks an open order past its expiry
+	OrderExpired = "expired"
+	// OrderCancelling marks an order whose cancellation was broadcast but not yet included
+	OrderCancelling = "cancelling"
+	// OrderCancelled marks an order cancelled on-chain
+	OrderCancelled = "cancelled"
+)
+
+// SignedOrder is an off-chain order signed by the vault, kept to track its
+// expiry and to cancel it on-chain later
+type SignedOrder struct {
+	Hash      common.Hash     `json:"hash"`
+	Protocol  string          `json:"protocol"`
+	Chain     string          `json:"chain"`
+	ChainID   *big.Int        `json:"chainId"`
+	Contract  common.Address  `json:"contract"`
+	Signer    common.Address  `json:"signer"`
+	Signed    time.Time       `json:"signed"`
+	Expiry    time.Time       `json:"expiry,omitempty"`
+	Status    string          `json:"status"`
+	CancelTx  *common.Hash    `json:"cancelTx,omitempty"`
+	Signature hexutil.Bytes   `json:"signature"`
+	TypedData *core.TypedData `json:"typedData"`
+}
+
+// State returns the status of the order, reporting open orders past their
+// expiry as expired
+func (o *SignedOrder) State(now time.Time) string {
+	if o.Status == OrderOpen && !o.Expiry.IsZero() && now.After(o.Expiry) {
+		return OrderExpired
+	}
+	return o.Status
+}
+
+// OrderBook is a file of signed off-chain orders
+type OrderBook struct {
+	path string
+}
+
+// OpenOrderBook opens an order book file
+func OpenOrderBook(path string) (*OrderBook, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create order book directory: %v", err)
+	}
+	return &OrderBook{path: path}, nil
+}
+
+// Add records a signed order; signing the same order again replaces it
+func (b *OrderBook) Add(order *SignedOrder) error {
+	order.Status = OrderOpen
+	return b.update(func(orders []*SignedOrder) ([]*SignedOrder, error) {
+		for i, o := range orders {
+			if o.Hash == order.Hash {
+				orders[i] = order
+				return orders, nil
+			}
+		}
+		return append(orders, order), nil
+	})
+}
+
+// Orders returns all recorded orders, oldest first
+func (b *OrderBook) Orders() ([]*SignedOrder, error) {
+	var result []*SignedOrder
+	err := b.update(func(orders []*SignedOrder) ([]*SignedOrder, error) {
+		result = orders
+		return orders, nil
+	})
+	return result, err
+}
+
+// Find returns the order whose hash starts with a prefix of at least 8 hex digits
+func (b *OrderBook) Find(prefix string) (*SignedOrder, error) {
+	prefix = strings.ToLower(strings.TrimPrefix(prefix, "0x"))
+	if len(prefix) < 8 {
+		return nil, fmt.Errorf("order hash prefix %q is too short; give at least 8 hex digits", prefix)
+	}
+	orders, err := b.Orders()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *SignedOrder
+	for _, order := range orders {
+		if strings.HasPrefix(strings.TrimPrefix(order.Hash.Hex(), "0x"), prefix) {
+			if found != nil {
+				return nil, fmt.Errorf("order hash prefix %s matches several orders", prefix)
+			}
+			found = order
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no order %s in the order book", prefix)
+	}
+	return found, nil
+}
+
+// SetStatus updates the status of an order and the transaction cancelling it
+func (b *OrderBook) SetStatus(hash common.Hash, status string, cancelTx *common.Hash) error {
+	return b.update(func(orders []*SignedOrder) ([]*SignedOrder, error) {
+		for _, order := range orders {
+			if order.Hash == hash {
+				order.Status, order.CancelTx = status, cancelTx
+				return orders, nil
+			}
+		}
+		return nil, fmt.Errorf("no order %s in the order book", hash.Hex())
+	})
+}
+
+// update applies a change to the order book under its lock
+func (b *OrderBook) update(fn func([]*SignedOrder) ([]*SignedOrder, error)) error {
+	unlock, err := lockFile(b.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var orders []*SignedOrder
+	data, err := os.ReadFile(b.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read order book: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &orders); err != nil {
+			return fmt.Errorf("failed to parse order book: %v", err)
+		}
+	}
+
+	orders, err = fn(orders)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(orders, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal order book: %v", err)
+	}
+	if err := writeFileAtomic(b.path, data); err != nil {
+		return fmt.Errorf("failed to write order book: %v", err)
+	}
+	return nil
+}
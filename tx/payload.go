@@ -0,0 +1,182 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// PayloadVersion is the current version of the payload envelopes
+	PayloadVersion = 1
+
+	// URTypeUnsigned is the UR type of unsigned transaction payloads
+	URTypeUnsigned = "gsv-unsigned-tx"
+	// URTypeSigned is the UR type of signed transaction payloads
+	URTypeSigned = "gsv-signed-tx"
+)
+
+// UnsignedPayload carries a transaction from the online machine to the offline
+// signer. It holds no timestamps, so identical inputs give identical payloads.
+type UnsignedPayload struct {
+	Version     int             `json:"version"`
+	Chain       string          `json:"chain"`
+	ChainID     *big.Int        `json:"chainId"`
+	From        *common.Address `json:"from,omitempty"`
+	Transaction json.RawMessage `json:"transaction"`
+	Build       *BuildContext   `json:"build,omitempty"`
+}
+
+// BuildContext records the chain data 'tx build' derived a transaction from,
+// so another machine can regenerate the payload and compare it byte for byte
+type BuildContext struct {
+	Type     string                    `json:"type"`
+	Decimals *uint8                    `json:"decimals,omitempty"`
+	Block    *BlockRef                 `json:"block,omitempty"`
+	ENS      map[string]common.Address `json:"ens,omitempty"`
+}
+
+// BlockRef pins chain reads to one block
+type BlockRef struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// SignedPayload carries a signed transaction from the offline signer back for
+// broadcast. Ladder holds pre-signed replacements at ascending fees, if any.
+type SignedPayload struct {
+	Version        int           `json:"version"`
+	Chain          string        `json:"chain"`
+	ChainID        *big.Int      `json:"chainId"`
+	Hash           common.Hash   `json:"hash"`
+	RawTransaction string        `json:"rawTransaction"`
+	Ladder         []LadderLevel `json:"ladder,omitempty"`
+}
+
+// ParseUnsignedPayload parses and checks an unsigned payload envelope
+func ParseUnsignedPayload(data []byte) (*UnsignedPayload, error) {
+	var payload UnsignedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse payload: %v", err)
+	}
+	if payload.Version != PayloadVersion {
+		return nil, fmt.Errorf("unsupported payload version %d", payload.Version)
+	}
+	if len(payload.Transaction) == 0 {
+		return nil, errors.New("payload contains no transaction")
+	}
+	return &payload, nil
+}
+
+// EncodeUnsignedPayload encodes a payload canonically: fields in declaration
+// order, the transaction compacted and the whole indented by two spaces
+func EncodeUnsignedPayload(payload *UnsignedPayload) ([]byte, error) {
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	return data, nil
+}
+
+// UnwrapTransaction returns the transaction of an unsigned payload envelope,
+// or data itself if it is a bare transaction
+func UnwrapTransaction(data []byte) (json.RawMessage, *UnsignedPayload, error) {
+	if !IsUnsignedPayload(data) {
+		return data, nil, nil
+	}
+	payload, err := ParseUnsignedPayload(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload.Transaction, payload, nil
+}
+
+// DiffPayloads lists the fields in which two encoded payloads differ, as
+// dotted paths with the expected and actual values
+func DiffPayloads(expected, actual []byte) ([]string, error) {
+	decode := func(data []byte) (interface{}, error) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to parse payload: %v", err)
+		}
+		return value, nil
+	}
+	a, err := decode(expected)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decode(actual)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []string
+	diffValues("", a, b, &differences)
+	return differences, nil
+}
+
+// diffValues appends the paths at which two decoded JSON values differ
+func diffValues(path string, a, b interface{}, differences *[]string) {
+	objectA, okA := a.(map[string]interface{})
+	objectB, okB := b.(map[string]interface{})
+	if !okA || !okB {
+		encodedA, _ := json.Marshal(a)
+		encodedB, _ := json.Marshal(b)
+		if !bytes.Equal(encodedA, encodedB) {
+			*differences = append(*differences, fmt.Sprintf("%s: expected %s, got %s", path, encodedA, encodedB))
+		}
+		return
+	}
+
+	keys := make(map[string]bool)
+	for key := range objectA {
+		keys[key] = true
+	}
+	for key := range objectB {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		diffValues(child, objectA[key], objectB[key], differences)
+	}
+}
+
+// ParseSignedPayload parses and checks a signed payload envelope
+func ParseSignedPayload(data []byte) (*SignedPayload, error) {
+	var payload SignedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse payload: %v", err)
+	}
+	if payload.Version != PayloadVersion {
+		return nil, fmt.Errorf("unsupported payload version %d", payload.Version)
+	}
+	if payload.RawTransaction == "" {
+		return nil, errors.New("payload contains no signed transaction")
+	}
+	return &payload, nil
+}
+
+// IsUnsignedPayload reports whether data looks like an unsigned payload envelope
+// rather than a bare transaction
+func IsUnsignedPayload(data []byte) bool {
+	var probe struct {
+		Transaction json.RawMessage `json:"transaction"`
+	}
+	return json.Unmarshal(data, &probe) == nil && len(probe.Transaction) > 0
+}
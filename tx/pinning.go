@@ -0,0 +1,55 @@
+package tx
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// pinPrefix is the prefix of SPKI pins, as used by HPKP and curl --pinnedpubkey
+const pinPrefix = "sha256//"
+
+// SPKIPin returns the pin of a certificate: the base64 SHA-256 of its
+// SubjectPublicKeyInfo
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// normalizePins validates pins and adds the sha256// prefix when missing
+func normalizePins(pins []string) ([]string, error) {
+	normalized := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		hash := strings.TrimPrefix(pin, pinPrefix)
+		raw, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin %q: expected base64 SHA-256 of the SPKI", pin)
+		}
+		normalized = append(normalized, pinPrefix+hash)
+	}
+	return normalized, nil
+}
+
+// verifyPins returns a TLS callback that accepts the connection only if a
+// certificate in the verified chain matches one of the pins
+func verifyPins(host string, pins []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			pin := SPKIPin(cert)
+			for _, expected := range pins {
+				if pin == expected {
+					return nil
+				}
+			}
+		}
+
+		var got string
+		if len(cs.PeerCertificates) > 0 {
+			got = SPKIPin(cs.PeerCertificates[0])
+		}
+		return fmt.Errorf("certificate pin mismatch for %s: got %s, possible man-in-the-middle", host, got)
+	}
+}
@@ -0,0 +1,108 @@
+package tx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ClientPool shares one RPC connection per endpoint between concurrent
+// users, so work on many chains at once does not dial for every query.
+// Pooled connections stay open until the pool is closed.
+type ClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*ethclient.Client
+}
+
+var (
+	poolMu     sync.RWMutex
+	activePool *ClientPool
+)
+
+// NewClientPool creates an empty connection pool
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: make(map[string]*ethclient.Client)}
+}
+
+// UseClientPool routes simulator queries and broadcasts through a pool until
+// it is called with nil
+func UseClientPool(pool *ClientPool) {
+	poolMu.Lock()
+	activePool = pool
+	poolMu.Unlock()
+}
+
+// Client returns the connection to an endpoint, dialing it on first use
+func (p *ClientPool) Client(ctx context.Context, endpoint string) (*ethclient.Client, error) {
+	p.mu.Lock()
+	client, ok := p.clients[endpoint]
+	p.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	// Dial unlocked so slow endpoints do not hold up other chains
+	client, err := dial(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.clients[endpoint]; ok {
+		client.Close()
+		return existing, nil
+	}
+	p.clients[endpoint] = client
+	return client, nil
+}
+
+// WaitReceipt polls an endpoint for the receipt of a transaction until it is
+// included or the context ends
+func (p *ClientPool) WaitReceipt(ctx context.Context, endpoint string, hash common.Hash, poll time.Duration) (*types.Receipt, error) {
+	client, err := p.Client(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if poll <= 0 {
+		poll = ladderPollInterval
+	}
+	for {
+		// Not found and transient errors alike mean "not included yet"
+		if receipt, err := client.TransactionReceipt(ctx, hash); err == nil && receipt != nil {
+			return receipt, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
+
+// Close closes every pooled connection
+func (p *ClientPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for endpoint, client := range p.clients {
+		client.Close()
+		delete(p.clients, endpoint)
+	}
+}
+
+// pooledDial connects to an endpoint through the active pool, if any. Pooled
+// connections must not be closed by the caller.
+func pooledDial(ctx context.Context, endpoint string) (*ethclient.Client, bool, error) {
+	poolMu.RLock()
+	pool := activePool
+	poolMu.RUnlock()
+	if pool == nil {
+		client, err := dial(ctx, endpoint)
+		return client, false, err
+	}
+	client, err := pool.Client(ctx, endpoint)
+	return client, true, err
+}
@@ -0,0 +1,232 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// CoinGeckoAPI is the public CoinGecko price endpoint
+const CoinGeckoAPI = "https://api.coingecko.com/api/v3/simple/price"
+
+// maxFeedAge is how old a Chainlink answer may be before it counts as stale
+const maxFeedAge = 25 * time.Hour
+
+var (
+	chainlinkLatestRoundSelector = crypto.Keccak256([]byte("latestRoundData()"))[:4]
+	chainlinkDecimalsSelector    = crypto.Keccak256([]byte("decimals()"))[:4]
+)
+
+// coinGeckoIDs are the CoinGecko IDs of common gas tokens, used for chains
+// without a priceId
+var coinGeckoIDs = map[string]string{
+	"ETH":   "ethereum",
+	"MATIC": "matic-network",
+	"POL":   "polygon-ecosystem-token",
+	"BNB":   "binancecoin",
+	"AVAX":  "avalanche-2",
+	"XDAI":  "xdai",
+}
+
+// PriceSource prices the gas token of a chain in USD
+type PriceSource interface {
+	Name() string
+	USDPrice(ctx context.Context, chain *core.ChainConfig) (float64, error)
+}
+
+// NewPriceSource returns the price source named by spec: "coingecko",
+// "chainlink" or "file:PATH" for a JSON object of USD prices by token symbol,
+// e.g. {"ETH": 3150.5}, which needs no network access
+func NewPriceSource(spec string) (PriceSource, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "coingecko":
+		return coinGeckoSource{}, nil
+	case "chainlink":
+		return chainlinkSource{}, nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("price source file: needs a path")
+		}
+		return loadPriceFile(path)
+	}
+	return nil, fmt.Errorf("unknown price source %q (expected coingecko, chainlink or file:PATH)", spec)
+}
+
+// PriceCost fills in the total cost of a result in whole gas tokens and, with
+// a price source, in USD. Testnet tokens have no price.
+func (r *SimulationResult) PriceCost(ctx context.Context, chain *core.ChainConfig, source PriceSource) error {
+	if r.TotalCost == nil {
+		return nil
+	}
+	symbol, decimals := chain.GasTokenInfo()
+	r.TotalCostNative = core.FormatTokenAmount(r.TotalCost, decimals) + " " + symbol
+	if source == nil || chain.IsTestnet {
+		return nil
+	}
+
+	price, err := source.USDPrice(ctx, chain)
+	if err != nil {
+		return fmt.Errorf("failed to price %s: %v", symbol, err)
+	}
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	cost, _ := new(big.Float).Quo(new(big.Float).SetInt(r.TotalCost), unit).Float64()
+	usd := cost * price
+	r.TotalCostUSD = &usd
+	r.PriceSource = source.Name()
+	return nil
+}
+
+// coinGeckoSource prices gas tokens with the public CoinGecko API
+type coinGeckoSource struct{}
+
+func (coinGeckoSource) Name() string { return "coingecko" }
+
+// coinGeckoID returns the CoinGecko ID of a chain's gas token
+func coinGeckoID(chain *core.ChainConfig) (string, error) {
+	symbol, _ := chain.GasTokenInfo()
+	id := chain.PriceID
+	if id == "" {
+		id = coinGeckoIDs[strings.ToUpper(symbol)]
+	}
+	if id == "" {
+		return "", fmt.Errorf("no CoinGecko ID for %s; set priceId in the chain config", symbol)
+	}
+	return id, nil
+}
+
+func (coinGeckoSource) USDPrice(ctx context.Context, chain *core.ChainConfig) (float64, error) {
+	id, err := coinGeckoID(chain)
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := HTTPClient(CoinGeckoAPI)
+	if err != nil {
+		return 0, err
+	}
+	query := url.Values{"ids": {id}, "vs_currencies": {"usd"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, CoinGeckoAPI+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create CoinGecko request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query CoinGecko: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("CoinGecko returned %s", resp.Status)
+	}
+
+	var prices map[string]map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, fmt.Errorf("failed to decode CoinGecko response: %v", err)
+	}
+	price, ok := prices[id]["usd"]
+	if !ok {
+		return 0, fmt.Errorf("CoinGecko has no USD price for %s", id)
+	}
+	return price, nil
+}
+
+// chainlinkSource reads the USD feed of a chain's gas token. Chains paying gas
+// in ETH without a feed of their own use the feed on Ethereum mainnet.
+type chainlinkSource struct{}
+
+func (chainlinkSource) Name() string { return "chainlink" }
+
+func (chainlinkSource) USDPrice(ctx context.Context, chain *core.ChainConfig) (float64, error) {
+	feedChain := chain
+	if chain.USDFeed == "" {
+		if symbol, _ := chain.GasTokenInfo(); !strings.EqualFold(symbol, "ETH") {
+			return 0, fmt.Errorf("chain %s has no Chainlink feed; set usdFeed in the chain config", chain.Name)
+		}
+		mainnet, err := core.GetChainConfig("ethereum")
+		if err != nil {
+			return 0, err
+		}
+		feedChain = mainnet
+	}
+	if !common.IsHexAddress(feedChain.USDFeed) {
+		return 0, fmt.Errorf("invalid Chainlink feed %q on %s", feedChain.USDFeed, feedChain.Name)
+	}
+	feed := common.HexToAddress(feedChain.USDFeed)
+	caller := &rpcCaller{rpcURL: feedChain.RPCURL}
+
+	output, err := caller.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: chainlinkDecimalsSelector}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(output) < 32 {
+		return 0, fmt.Errorf("unexpected feed decimals of %d bytes", len(output))
+	}
+	decimals := new(big.Int).SetBytes(output[:32])
+
+	// latestRoundData returns (roundId, answer, startedAt, updatedAt, answeredInRound)
+	output, err = caller.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: chainlinkLatestRoundSelector}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(output) < 5*32 {
+		return 0, fmt.Errorf("unexpected feed answer of %d bytes", len(output))
+	}
+	answer := new(big.Int).SetBytes(output[32:64])
+	if answer.Sign() <= 0 || output[32]&0x80 != 0 {
+		return 0, errors.New("feed answer is not positive")
+	}
+	updated := time.Unix(new(big.Int).SetBytes(output[96:128]).Int64(), 0)
+	if age := time.Since(updated); age > maxFeedAge {
+		return 0, fmt.Errorf("feed answer is stale (updated %s ago)", age.Round(time.Minute))
+	}
+
+	unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), decimals, nil))
+	price, _ := new(big.Float).Quo(new(big.Float).SetInt(answer), unit).Float64()
+	return price, nil
+}
+
+// filePriceSource prices gas tokens from a static file, for offline use
+type filePriceSource struct {
+	path   string
+	prices map[string]float64
+}
+
+// loadPriceFile reads a JSON object of USD prices by token symbol
+func loadPriceFile(path string) (*filePriceSource, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %v", err)
+	}
+	var prices map[string]float64
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price file: %v", err)
+	}
+	source := &filePriceSource{path: path, prices: make(map[string]float64)}
+	for symbol, price := range prices {
+		source.prices[strings.ToUpper(symbol)] = price
+	}
+	return source, nil
+}
+
+func (s *filePriceSource) Name() string { return "file:" + s.path }
+
+func (s *filePriceSource) USDPrice(ctx context.Context, chain *core.ChainConfig) (float64, error) {
+	symbol, _ := chain.GasTokenInfo()
+	price, ok := s.prices[strings.ToUpper(symbol)]
+	if !ok {
+		return 0, fmt.Errorf("%s has no price for %s", s.path, symbol)
+	}
+	return price, nil
+}
@@ -0,0 +1,99 @@
+package tx
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PrivacyOptions configures metadata randomization used to reduce linkage of
+// vault operations by observers. All randomness comes from crypto/rand, which
+// is backed by the operating system (and the CPU's hardware RNG where available).
+type PrivacyOptions struct {
+	// MaxDelay is the upper bound of the random delay before a broadcast
+	MaxDelay time.Duration `json:"maxDelay"`
+	// FeeStep is the granularity (in wei) gas prices are rounded up to
+	FeeStep *big.Int `json:"feeStep"`
+	// MaxFeeSteps is the maximum number of extra random FeeSteps added on top
+	MaxFeeSteps int64 `json:"maxFeeSteps"`
+	// MaxGasPaddingPercent is the maximum random padding added to gas limits
+	MaxGasPaddingPercent int64 `json:"maxGasPaddingPercent"`
+}
+
+// DefaultPrivacyOptions returns the privacy settings used by --privacy
+func DefaultPrivacyOptions() *PrivacyOptions {
+	return &PrivacyOptions{
+		MaxDelay:             2 * time.Minute,
+		FeeStep:              big.NewInt(100000000), // 0.1 gwei
+		MaxFeeSteps:          3,
+		MaxGasPaddingPercent: 5,
+	}
+}
+
+// RandomizeGasPrice rounds a gas price up to the fee step and adds a random
+// number of extra steps, so fees don't fingerprint the tool or operator
+func (p *PrivacyOptions) RandomizeGasPrice(gasPrice *big.Int) (*big.Int, error) {
+	if gasPrice == nil || p.FeeStep == nil || p.FeeStep.Sign() <= 0 {
+		return gasPrice, nil
+	}
+
+	// Round up to the next multiple of the fee step
+	steps := new(big.Int).Add(gasPrice, new(big.Int).Sub(p.FeeStep, big.NewInt(1)))
+	steps.Div(steps, p.FeeStep)
+
+	// Add random extra steps
+	extra, err := randomInt(p.MaxFeeSteps + 1)
+	if err != nil {
+		return nil, err
+	}
+	steps.Add(steps, big.NewInt(extra))
+
+	return steps.Mul(steps, p.FeeStep), nil
+}
+
+// RandomizeGasLimit pads a gas limit by a random percentage so repeated
+// operations don't reuse an identical, recognizable gas limit
+func (p *PrivacyOptions) RandomizeGasLimit(gasLimit uint64) (uint64, error) {
+	if gasLimit == 0 || p.MaxGasPaddingPercent <= 0 {
+		return gasLimit, nil
+	}
+
+	maxPadding := int64(gasLimit) * p.MaxGasPaddingPercent / 100
+	if maxPadding == 0 {
+		return gasLimit, nil
+	}
+
+	// Always add at least one unit so the limit never matches the input
+	padding, err := randomInt(maxPadding)
+	if err != nil {
+		return 0, err
+	}
+	return gasLimit + uint64(padding) + 1, nil
+}
+
+// RandomDelay returns a random delay in [0, MaxDelay]
+func (p *PrivacyOptions) RandomDelay() (time.Duration, error) {
+	if p.MaxDelay <= 0 {
+		return 0, nil
+	}
+
+	delay, err := randomInt(int64(p.MaxDelay) + 1)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(delay), nil
+}
+
+// randomInt returns a uniform random integer in [0, max)
+func randomInt(max int64) (int64, error) {
+	if max <= 0 {
+		return 0, nil
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read random number: %v", err)
+	}
+	return n.Int64(), nil
+}
@@ -0,0 +1,373 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/secrets"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// throttlePeriod is how long a rate-limited endpoint that sent no
+	// Retry-After is tried after its fallbacks
+	throttlePeriod = 30 * time.Second
+	// maxRetryAfter caps the wait a provider may ask for before a retry
+	maxRetryAfter = time.Minute
+)
+
+// throttleCodes are the JSON-RPC error codes providers refuse requests over
+// their rate limit with: -32005 ("limit exceeded" in EIP-1474, Infura) and
+// 429 (Alchemy)
+var throttleCodes = map[int]bool{-32005: true, 429: true}
+
+// throttlePhrases identify rate limiting in the messages of providers that
+// use generic error codes
+var throttlePhrases = []string{
+	"rate limit",
+	"too many requests",
+	"request limit",
+	"request rate exceeded",
+	"daily request count exceeded",
+	"compute units per second",
+	"throttled",
+}
+
+// RateLimitError is a request an RPC provider refused because its rate limit
+// was exceeded. It matches ErrRateLimited.
+type RateLimitError struct {
+	// Provider is the host of the endpoint, if known
+	Provider string
+	// RetryAfter is the wait the provider asked for, if any
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	provider := "the RPC provider"
+	if e.Provider != "" {
+		provider = "provider " + e.Provider
+	}
+	message := "rate limited by " + provider
+	if e.RetryAfter > 0 {
+		message += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return message + ": " + e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrRateLimited
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitSummary counts the rate limiting of one provider during a run
+type RateLimitSummary struct {
+	Provider   string        `json:"provider"`
+	Refused    int           `json:"refused"`
+	Waited     time.Duration `json:"waited"`
+	FailedOver int           `json:"failedOver"`
+}
+
+var (
+	throttleMu sync.Mutex
+	// throttled holds the endpoints that refused requests and until when
+	// they are tried after their fallbacks
+	throttled      = make(map[string]time.Time)
+	rateLimitStats = make(map[string]*RateLimitSummary)
+	failover       bool
+)
+
+// SetRateLimitFailover resends requests a provider refused for its rate
+// limit to the next fallback endpoint of the chain, instead of waiting for
+// the provider
+func SetRateLimitFailover(enabled bool) {
+	throttleMu.Lock()
+	failover = enabled
+	throttleMu.Unlock()
+}
+
+// RateLimits returns the providers that rate limited requests, by host
+func RateLimits() []RateLimitSummary {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	summaries := make([]RateLimitSummary, 0, len(rateLimitStats))
+	for _, summary := range rateLimitStats {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Provider < summaries[j].Provider })
+	return summaries
+}
+
+// rateLimitSummary returns the stats of a provider; the caller holds throttleMu
+func rateLimitSummary(provider string) *RateLimitSummary {
+	if provider == "" {
+		provider = "unknown provider"
+	}
+	summary, ok := rateLimitStats[provider]
+	if !ok {
+		summary = &RateLimitSummary{Provider: provider}
+		rateLimitStats[provider] = summary
+	}
+	return summary
+}
+
+// noteRateLimit records a refused request and avoids the endpoint for a while
+func noteRateLimit(endpoint string, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = throttlePeriod
+	}
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	throttled[endpoint] = time.Now().Add(retryAfter)
+	rateLimitSummary(endpointHost(endpoint)).Refused++
+}
+
+// noteRateLimitWait records a backoff after a rate-limited call
+func noteRateLimitWait(provider string, wait time.Duration) {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	rateLimitSummary(provider).Waited += wait
+}
+
+// deprioritizeThrottled moves endpoints that recently rate limited requests
+// to the end, keeping the order otherwise
+func deprioritizeThrottled(endpoints []string) []string {
+	throttleMu.Lock()
+	now := time.Now()
+	isThrottled := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		isThrottled[endpoint] = throttled[endpoint].After(now)
+	}
+	throttleMu.Unlock()
+
+	ordered := append([]string{}, endpoints...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return !isThrottled[ordered[i]] && isThrottled[ordered[j]]
+	})
+	return ordered
+}
+
+// asRateLimit returns the rate limit refusal an RPC error stands for, if any
+func asRateLimit(err error) *RateLimitError {
+	var limit *RateLimitError
+	if errors.As(err, &limit) {
+		return limit
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{Err: err}
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && throttleAnswer(rpcErr.ErrorCode(), rpcErr.Error()) {
+		return &RateLimitError{Err: err}
+	}
+	return nil
+}
+
+// throttleAnswer reports whether a JSON-RPC error refuses a request over the
+// rate limit
+func throttleAnswer(code int, message string) bool {
+	if throttleCodes[code] {
+		return true
+	}
+	message = strings.ToLower(message)
+	for _, phrase := range throttlePhrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// jitter spreads a backoff over its upper half, so clients refused together
+// do not retry together
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// rateLimitTransport turns the rate limit refusals of an RPC endpoint into
+// RateLimitErrors naming the provider and, with SetRateLimitFailover, resends
+// refused requests to the fallbacks of the endpoint
+type rateLimitTransport struct {
+	// endpoint is the URL as configured, for looking up fallbacks
+	endpoint string
+	next     http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	limit := refusal(t.endpoint, resp)
+	if limit == nil {
+		return resp, nil
+	}
+	noteRateLimit(t.endpoint, limit.RetryAfter)
+
+	throttleMu.Lock()
+	enabled := failover
+	throttleMu.Unlock()
+	if enabled && req.GetBody != nil {
+		if resp := t.resend(req); resp != nil {
+			return resp, nil
+		}
+	}
+	return nil, limit
+}
+
+// resend sends a refused request to the first fallback that answers it
+// without refusing it too
+func (t *rateLimitTransport) resend(req *http.Request) *http.Response {
+	for _, endpoint := range deprioritizeThrottled(endpointGroup(t.endpoint)) {
+		if endpoint == t.endpoint {
+			continue
+		}
+		target, err := secrets.Expand(endpoint)
+		if err != nil {
+			continue
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		client, err := HTTPClient(target)
+		if err != nil {
+			continue
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil
+		}
+
+		retry := req.Clone(req.Context())
+		retry.Body = body
+		retry.URL = u
+		retry.Host = u.Host
+		// Credentials in the URL are the endpoint's own
+		retry.Header.Del("Authorization")
+		if u.User != nil {
+			password, _ := u.User.Password()
+			retry.SetBasicAuth(u.User.Username(), password)
+		}
+		resp, err := client.Transport.RoundTrip(retry)
+		if err != nil {
+			continue
+		}
+		if limit := refusal(endpoint, resp); limit != nil {
+			noteRateLimit(endpoint, limit.RetryAfter)
+			continue
+		}
+		throttleMu.Lock()
+		rateLimitSummary(endpointHost(t.endpoint)).FailedOver++
+		throttleMu.Unlock()
+		return resp
+	}
+	return nil
+}
+
+// endpointGroup returns an endpoint with the endpoints it falls back to or
+// that fall back to it, in the order dial tries them
+func endpointGroup(endpoint string) []string {
+	proxyMu.RLock()
+	defer proxyMu.RUnlock()
+	for primary, urls := range fallbacks {
+		group := append([]string{primary}, urls...)
+		for _, member := range group {
+			if member == endpoint {
+				if ranking != nil {
+					group = ranking.Rank(group)
+				}
+				return group
+			}
+		}
+	}
+	return nil
+}
+
+// refusal returns the rate limit refusal a response carries, closing its
+// body if so. JSON-RPC errors arrive with status 200, so the body of those
+// responses is read and put back.
+func refusal(endpoint string, resp *http.Response) *RateLimitError {
+	provider := endpointHost(endpoint)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return &RateLimitError{
+			Provider:   provider,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("HTTP %s", resp.Status),
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errorReader{err}))
+	if err != nil || !bytes.Contains(body, []byte(`"error"`)) {
+		return nil
+	}
+	// Batch responses are left to the RPC client
+	var answer struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &answer) != nil || answer.Error == nil || !throttleAnswer(answer.Error.Code, answer.Error.Message) {
+		return nil
+	}
+	return &RateLimitError{
+		Provider:   provider,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Err:        fmt.Errorf("%s (code %d)", answer.Error.Message, answer.Error.Code),
+	}
+}
+
+// errorReader returns err once the body read before it is consumed, or EOF
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,230 @@
+package tx
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRedactionSaltFile is the default location of the local salt of redacted exports
+var DefaultRedactionSaltFile = filepath.Join(historyDir, "redaction.salt")
+
+// redactedColumns are the CSV columns of a redacted history export
+var redactedColumns = []string{
+	"hour", "chain_id", "tx", "status", "from", "to", "value_range",
+	"gas_used", "gas_price", "function", "error",
+}
+
+// hexPattern matches addresses, hashes and other hex blobs in free text
+var hexPattern = regexp.MustCompile(`0x[0-9a-fA-F]{40,}`)
+
+// RedactedRecord is a history record stripped of what links it to the chain:
+// addresses and the hash are pseudonyms, the value is a range and amounts and
+// times are coarsened
+type RedactedRecord struct {
+	Hour       time.Time `json:"hour"`
+	ChainID    string    `json:"chainId,omitempty"`
+	Tx         string    `json:"tx"`
+	Status     string    `json:"status"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	ValueRange string    `json:"valueRange"`
+	GasUsed    uint64    `json:"gasUsed,omitempty"`
+	GasPrice   string    `json:"gasPrice,omitempty"`
+	Function   string    `json:"function,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Redactor pseudonymizes history records with a keyed hash, so the same
+// address maps to the same pseudonym in every export made with the same salt
+type Redactor struct {
+	salt []byte
+}
+
+// NewRedactor returns a redactor keyed with salt
+func NewRedactor(salt []byte) *Redactor {
+	return &Redactor{salt: salt}
+}
+
+// LoadRedactionSalt reads the salt at path, creating a random one the first time
+func LoadRedactionSalt(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		salt, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(salt) < 16 {
+			return nil, fmt.Errorf("invalid redaction salt in %s", path)
+		}
+		return salt, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read redaction salt: %v", err)
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate redaction salt: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create salt directory: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte(hex.EncodeToString(salt)+"\n")); err != nil {
+		return nil, fmt.Errorf("failed to write redaction salt: %v", err)
+	}
+	return salt, nil
+}
+
+// pseudonym returns a short keyed hash of value, prefixed with its kind
+func (r *Redactor) pseudonym(kind, value string) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(kind + ":" + strings.ToLower(value)))
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// Address returns the pseudonym of an address, or "" for an empty one
+func (r *Redactor) Address(address string) string {
+	if address == "" {
+		return ""
+	}
+	return r.pseudonym("addr", address)
+}
+
+// Text replaces the addresses and hashes in free text, such as an error
+// message, by their pseudonyms and any other hex data by a placeholder
+func (r *Redactor) Text(text string) string {
+	return hexPattern.ReplaceAllStringFunc(text, func(match string) string {
+		switch len(match) - 2 {
+		case 40:
+			return r.Address(match)
+		case 64:
+			return r.pseudonym("tx", match)
+		default:
+			return "0x…"
+		}
+	})
+}
+
+// Redact returns the redacted form of records. Calldata, block numbers and
+// timelines are dropped; the function signature and outcome are kept.
+func (r *Redactor) Redact(records []*TransactionRecord) []*RedactedRecord {
+	redacted := make([]*RedactedRecord, 0, len(records))
+	for _, record := range records {
+		entry := &RedactedRecord{
+			Hour:       record.Timestamp.UTC().Truncate(time.Hour),
+			ChainID:    record.ChainID,
+			Tx:         r.pseudonym("tx", record.Hash.Hex()),
+			Status:     record.Status,
+			From:       r.Address(record.From),
+			To:         r.Address(record.To),
+			ValueRange: ValueRange(record.Value),
+			GasUsed:    roundSignificant(new(big.Int).SetUint64(record.GasUsed)).Uint64(),
+			Function:   record.Function,
+			Error:      r.Text(record.Error),
+		}
+		if gasPrice, ok := new(big.Int).SetString(record.GasPrice, 10); ok {
+			entry.GasPrice = roundSignificant(gasPrice).String()
+		}
+		redacted = append(redacted, entry)
+	}
+	return redacted
+}
+
+// ValueRange returns the decade of native units (of 18 decimals) that a
+// value in wei falls in, such as "0.1-1", or "" if it is not a number
+func ValueRange(wei string) string {
+	value, ok := new(big.Int).SetString(wei, 10)
+	if !ok {
+		return ""
+	}
+	if value.Sign() == 0 {
+		return "0"
+	}
+	if value.Cmp(decade(-4)) < 0 {
+		return "<" + decadeString(-4)
+	}
+	for exp := -4; exp < 4; exp++ {
+		if value.Cmp(decade(exp+1)) < 0 {
+			return decadeString(exp) + "-" + decadeString(exp+1)
+		}
+	}
+	return ">=" + decadeString(4)
+}
+
+// decade returns 10^exp native units in wei
+func decade(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(18+exp)), nil)
+}
+
+// decadeString formats 10^exp as a decimal, such as 0.001 or 100
+func decadeString(exp int) string {
+	if exp < 0 {
+		return "0." + strings.Repeat("0", -exp-1) + "1"
+	}
+	return "1" + strings.Repeat("0", exp)
+}
+
+// roundSignificant rounds a non-negative value down to two significant digits
+func roundSignificant(value *big.Int) *big.Int {
+	digits := len(value.String())
+	if digits <= 2 {
+		return value
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits-2)), nil)
+	rounded := new(big.Int).Quo(value, scale)
+	return rounded.Mul(rounded, scale)
+}
+
+// WriteRedactedCSV writes redacted records as CSV
+func WriteRedactedCSV(w io.Writer, records []*RedactedRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(redactedColumns); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+
+	for _, record := range records {
+		row := []string{
+			record.Hour.Format(time.RFC3339),
+			record.ChainID,
+			record.Tx,
+			record.Status,
+			record.From,
+			record.To,
+			record.ValueRange,
+			strconv.FormatUint(record.GasUsed, 10),
+			record.GasPrice,
+			record.Function,
+			record.Error,
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+// WriteRedactedJSON writes redacted records as an indented JSON array
+func WriteRedactedJSON(w io.Writer, records []*RedactedRecord) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(records); err != nil {
+		return fmt.Errorf("failed to write JSON: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultReplacementBump is the default fee increase of a speed-up or cancellation
+const DefaultReplacementBump = "20%"
+
+// cancelGasLimit is the gas of the zero-value self-send replacing a cancelled transaction
+const cancelGasLimit = 21000
+
+// ErrTransactionUnknown is returned when no endpoint knows a transaction to replace
+var ErrTransactionUnknown = errors.New("transaction not found")
+
+// Replaceable is a pending transaction that can be replaced by one with the
+// same nonce
+type Replaceable struct {
+	Transaction *types.Transaction
+	From        common.Address
+}
+
+// FetchReplaceable returns a pending transaction from the chain. It fails if
+// the transaction was already included.
+func FetchReplaceable(ctx context.Context, rpcURL string, hash common.Hash) (*Replaceable, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	transaction, pending, err := client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionUnknown, hash.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %v", err)
+	}
+	if !pending {
+		if receipt, err := client.TransactionReceipt(ctx, hash); err == nil {
+			return nil, fmt.Errorf("transaction %s was already included in block %s", hash.Hex(), receipt.BlockNumber)
+		}
+		return nil, fmt.Errorf("transaction %s was already included", hash.Hex())
+	}
+	return NewReplaceable(transaction)
+}
+
+// NewReplaceable recovers the sender of a signed transaction to replace
+func NewReplaceable(transaction *types.Transaction) (*Replaceable, error) {
+	from, err := types.Sender(types.LatestSignerForChainID(transaction.ChainId()), transaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender: %v", err)
+	}
+	return &Replaceable{Transaction: transaction, From: from}, nil
+}
+
+// CheckNonceOpen fails if a transaction with the nonce of r was already
+// included, so a replacement could never be
+func (r *Replaceable) CheckNonceOpen(ctx context.Context, rpcURL string) error {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	confirmed, err := client.NonceAt(ctx, r.From, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %v", err)
+	}
+	if confirmed > r.Transaction.Nonce() {
+		return fmt.Errorf("nonce %d of %s was already used by an included transaction", r.Transaction.Nonce(), r.From.Hex())
+	}
+	return nil
+}
+
+// SpeedUp returns a copy of the transaction to be re-signed at higher fees
+func (r *Replaceable) SpeedUp() (*core.Transaction, error) {
+	original := r.Transaction
+	transaction := &core.Transaction{
+		Nonce:    original.Nonce(),
+		GasLimit: original.Gas(),
+		To:       original.To(),
+		Value:    original.Value(),
+		Data:     original.Data(),
+		ChainID:  original.ChainId(),
+	}
+	switch original.Type() {
+	case types.LegacyTxType:
+		transaction.GasPrice = original.GasPrice()
+	case types.DynamicFeeTxType:
+		transaction.MaxFeePerGas = original.GasFeeCap()
+		transaction.MaxPriorityFeePerGas = original.GasTipCap()
+	default:
+		return nil, fmt.Errorf("cannot replace transactions of type %d", original.Type())
+	}
+	return transaction, nil
+}
+
+// Cancel returns a zero-value self-send with the nonce and fees of the
+// transaction, to be re-signed at higher fees
+func (r *Replaceable) Cancel() (*core.Transaction, error) {
+	transaction, err := r.SpeedUp()
+	if err != nil {
+		return nil, err
+	}
+	from := r.From
+	transaction.To = &from
+	transaction.Value = new(big.Int)
+	transaction.Data = nil
+	transaction.GasLimit = cancelGasLimit
+	return transaction, nil
+}
+
+// BumpFees raises the fees of a replacement by bump (a fraction, e.g. 0.2),
+// rounding up, and to at least the fees the chain currently suggests. Nodes
+// only accept a replacement at least 10% above the transaction it replaces.
+func BumpFees(ctx context.Context, rpcURL string, transaction *core.Transaction, bump *big.Rat) error {
+	if bump.Cmp(minLadderBump) < 0 {
+		return errors.New("fee bump must be at least 10% to replace a pending transaction")
+	}
+	factor := new(big.Rat).Add(big.NewRat(1, 1), bump)
+	raise := func(value *big.Int) (*big.Int, error) {
+		return core.MulDecimal(value, factor, core.RoundUp)
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if !transaction.IsDynamicFee() {
+		bumped, err := raise(transaction.GasPrice)
+		if err != nil {
+			return err
+		}
+		suggested, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get gas price: %v", err)
+		}
+		transaction.GasPrice = maxBig(bumped, suggested)
+		return nil
+	}
+
+	tip, err := raise(transaction.MaxPriorityFeePerGas)
+	if err != nil {
+		return err
+	}
+	feeCap, err := raise(transaction.MaxFeePerGas)
+	if err != nil {
+		return err
+	}
+	suggestedTip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get priority fee: %v", err)
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %v", err)
+	}
+	tip = maxBig(tip, suggestedTip)
+	if head.BaseFee != nil {
+		// Leave room for the base fee to double, like wallets do
+		feeCap = maxBig(feeCap, new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip))
+	}
+	transaction.MaxPriorityFeePerGas, transaction.MaxFeePerGas = tip, maxBig(feeCap, tip)
+	return nil
+}
+
+// maxBig returns the larger of two values
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// FetchIncluded returns an included transaction, its sender and the block it
+// was included in
+func FetchIncluded(ctx context.Context, rpcURL string, hash common.Hash) (*Replaceable, *big.Int, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	transaction, pending, err := client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTransactionUnknown, hash.Hex())
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get transaction: %v", err)
+	}
+	if pending {
+		return nil, nil, fmt.Errorf("transaction %s is still pending", hash.Hex())
+	}
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get receipt: %v", err)
+	}
+	included, err := NewReplaceable(transaction)
+	if err != nil {
+		return nil, nil, err
+	}
+	return included, receipt.BlockNumber, nil
+}
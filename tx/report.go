@@ -0,0 +1,129 @@
+package tx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyColumns are the CSV columns of a history export
+var historyColumns = []string{
+	"timestamp", "chain_id", "hash", "status", "from", "to", "value",
+	"gas_used", "gas_price", "fee", "block_number", "error",
+}
+
+// Fee returns the fee paid by a record in wei, or nil if it was not mined
+func (r *TransactionRecord) Fee() *big.Int {
+	gasPrice, ok := new(big.Int).SetString(r.GasPrice, 10)
+	if !ok || r.GasUsed == 0 {
+		return nil
+	}
+	return gasPrice.Mul(gasPrice, new(big.Int).SetUint64(r.GasUsed))
+}
+
+// WriteHistoryCSV writes records as CSV with amounts in wei. With fiat values
+// each currency adds the price of the day, the value and the fee in it.
+func WriteHistoryCSV(w io.Writer, records []*TransactionRecord, values *FiatValues) error {
+	writer := csv.NewWriter(w)
+	columns := historyColumns
+	if values != nil {
+		columns = append([]string(nil), historyColumns...)
+		for _, currency := range values.Currencies {
+			c := strings.ToLower(currency)
+			columns = append(columns, "price_"+c, "value_"+c, "fee_"+c)
+		}
+	}
+	if err := writer.Write(columns); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+
+	for _, record := range records {
+		fee := ""
+		if f := record.Fee(); f != nil {
+			fee = f.String()
+		}
+		blockNumber := ""
+		if record.BlockNumber != 0 {
+			blockNumber = strconv.FormatUint(record.BlockNumber, 10)
+		}
+
+		row := []string{
+			record.Timestamp.UTC().Format(time.RFC3339),
+			record.ChainID,
+			record.Hash.Hex(),
+			record.Status,
+			record.From,
+			record.To,
+			record.Value,
+			strconv.FormatUint(record.GasUsed, 10),
+			record.GasPrice,
+			fee,
+			blockNumber,
+			record.Error,
+		}
+		if values != nil {
+			fiat := values.Of(record)
+			for _, currency := range values.Currencies {
+				value, ok := fiat[currency]
+				if !ok {
+					row = append(row, "", "", "")
+					continue
+				}
+				fee := ""
+				if value.Fee != nil {
+					fee = formatFiat(*value.Fee)
+				}
+				row = append(row, strconv.FormatFloat(value.Price, 'f', -1, 64), formatFiat(value.Value), fee)
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+// valuedRecord is a history record with its fiat values by currency
+type valuedRecord struct {
+	*TransactionRecord
+	Fiat map[string]*FiatValue `json:"fiat,omitempty"`
+}
+
+// WriteHistoryJSON writes records as an indented JSON array. With fiat values
+// each record carries them in a fiat object keyed by currency.
+func WriteHistoryJSON(w io.Writer, records []*TransactionRecord, values *FiatValues) error {
+	var out interface{} = records
+	if records == nil {
+		out = []*TransactionRecord{}
+	}
+	if values != nil {
+		valued := make([]valuedRecord, len(records))
+		for i, record := range records {
+			valued[i] = valuedRecord{TransactionRecord: record, Fiat: values.Of(record)}
+		}
+		out = valued
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(out); err != nil {
+		return fmt.Errorf("failed to write JSON: %v", err)
+	}
+	return nil
+}
+
+// formatFiat formats a fiat amount for exports, with enough decimals for the
+// fees of cheap chains
+func formatFiat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
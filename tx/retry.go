@@ -0,0 +1,102 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how RPC calls are retried when the endpoint cannot be
+// reached or does not answer in time. Answers of the node, including
+// rejections and reverts, are never retried.
+type RetryPolicy struct {
+	// Attempts is the number of tries of a call, including the first
+	Attempts int
+	// Backoff is the wait before the first retry; it doubles on every
+	// further retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each attempt; zero leaves attempts bounded only by the
+	// caller's context
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy tries calls three times within about a second and a half
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+	Timeout:    30 * time.Second,
+}
+
+var (
+	retryMu     sync.RWMutex
+	retryPolicy = DefaultRetryPolicy
+)
+
+// SetRetryPolicy sets the retry policy of the RPC calls of History,
+// Simulator, Monitor and Broadcaster
+func SetRetryPolicy(policy RetryPolicy) error {
+	if policy.Attempts < 1 {
+		return fmt.Errorf("RPC attempts must be at least 1, got %d", policy.Attempts)
+	}
+	if policy.Backoff < 0 || policy.Timeout < 0 {
+		return errors.New("RPC backoff and timeout must not be negative")
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+
+	retryMu.Lock()
+	retryPolicy = policy
+	retryMu.Unlock()
+	return nil
+}
+
+// call runs an RPC call under the retry policy and classifies its error with
+// rpcFailure. Only RPCErrors are retried, and only while ctx is not done.
+// Waits are jittered; a rate-limited call waits at least as long as the
+// provider asked, unless that outlasts ctx.
+func call[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) (T, error) {
+	retryMu.RLock()
+	policy := retryPolicy
+	retryMu.RUnlock()
+
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		result, err := fn(attemptCtx)
+		cancel()
+
+		err = rpcFailure(err)
+		if err == nil || attempt >= policy.Attempts || !errors.Is(err, ErrRPCUnavailable) || ctx.Err() != nil {
+			return result, err
+		}
+
+		wait := jitter(backoff)
+		var limit *RateLimitError
+		if errors.As(err, &limit) {
+			if retryAfter := min(limit.RetryAfter, maxRetryAfter); retryAfter > wait {
+				wait = retryAfter
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return result, err
+			}
+			noteRateLimitWait(limit.Provider, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
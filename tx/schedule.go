@@ -0,0 +1,689 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultScheduleFile is the default location of the broadcast schedule
+var DefaultScheduleFile = filepath.Join(historyDir, "schedule.json")
+
+const (
+	// ScheduleWaiting marks a broadcast held until its start time
+	ScheduleWaiting = "waiting"
+	// ScheduleSubmitting marks a broadcast whose fee levels are being released
+	ScheduleSubmitting = "submitting"
+	// ScheduleIncluded marks a broadcast that was included on-chain
+	ScheduleIncluded = "included"
+	// ScheduleAborted marks a broadcast that was not included by its deadline
+	ScheduleAborted = "aborted"
+	// ScheduleCancelled marks a broadcast withdrawn before it was submitted
+	ScheduleCancelled = "cancelled"
+
+	// schedulePollInterval is how often the scheduler looks for due broadcasts
+	schedulePollInterval = 5 * time.Second
+	// conditionPollInterval is how often the release conditions of a held
+	// broadcast are checked against the chain
+	conditionPollInterval = 15 * time.Second
+	// unreachableBackoff is the wait before a broadcast held for unreachable
+	// endpoints is tried again; it doubles on every further attempt up to
+	// maxUnreachableBackoff
+	unreachableBackoff    = 15 * time.Second
+	maxUnreachableBackoff = 10 * time.Minute
+)
+
+// errConditionFailed marks release conditions that can no longer be met
+var errConditionFailed = errors.New("release condition failed")
+
+// ScheduledBroadcast is a signed transaction held for submission between a
+// start time and a deadline
+type ScheduledBroadcast struct {
+	ID        string          `json:"id"`
+	Chain     string          `json:"chain"`
+	Endpoints []string        `json:"endpoints"`
+	Payload   *SignedPayload  `json:"payload"`
+	NotBefore time.Time       `json:"notBefore"`
+	Deadline  time.Time       `json:"deadline"`
+	Notify    string          `json:"notify,omitempty"`
+	Status    string          `json:"status"`
+	Timeline  []TimelineEvent `json:"timeline"`
+
+	// Conditions hold the broadcast past NotBefore. Its deadline is set to
+	// Window after the conditions are met.
+	Conditions *ReleaseConditions `json:"conditions,omitempty"`
+	Window     time.Duration      `json:"window,omitempty"`
+	// Forced releases the broadcast without waiting for its start time or conditions
+	Forced bool `json:"forced,omitempty"`
+	// Retry holds a broadcast that failed because no endpoint could be
+	// reached, until one can. Its deadline is set to Window after that.
+	Retry *BroadcastRetry `json:"retry,omitempty"`
+	// NotifyTemplate renders the notification sent to Notify: a built-in
+	// template name or a template file (see LoadNotificationTemplate)
+	NotifyTemplate string `json:"notifyTemplate,omitempty"`
+}
+
+// BroadcastRetry tracks the attempts to reach the endpoints of a held broadcast
+type BroadcastRetry struct {
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	// Expires aborts the broadcast if no endpoint could be reached by then
+	Expires time.Time `json:"expires"`
+}
+
+// ReleaseConditions hold a scheduled broadcast until the chain is in the
+// expected state. All conditions that are set must be met.
+type ReleaseConditions struct {
+	// MaxBaseFee is met once the base fee of the latest block is at or below it
+	MaxBaseFee *big.Int `json:"maxBaseFee,omitempty"`
+	// After is met once this transaction succeeded with Confirmations confirmations
+	After         *common.Hash `json:"after,omitempty"`
+	Confirmations uint64       `json:"confirmations,omitempty"`
+	// Expires aborts the broadcast if the conditions are not met by then
+	Expires time.Time `json:"expires"`
+}
+
+// String describes the conditions in one line
+func (c *ReleaseConditions) String() string {
+	var parts []string
+	if c.MaxBaseFee != nil {
+		parts = append(parts, fmt.Sprintf("base fee at most %s wei", c.MaxBaseFee))
+	}
+	if c.After != nil {
+		parts = append(parts, fmt.Sprintf("%s with %d confirmations", c.After.Hex(), c.Confirmations))
+	}
+	if !c.Expires.IsZero() {
+		parts = append(parts, "expires "+c.Expires.Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Schedule is a file of scheduled broadcasts shared between the CLI, which
+// adds entries, and the daemon scheduler, which submits them
+type Schedule struct {
+	path string
+}
+
+// OpenSchedule opens a schedule file
+func OpenSchedule(path string) (*Schedule, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create schedule directory: %v", err)
+	}
+	return &Schedule{path: path}, nil
+}
+
+// Add schedules a broadcast
+func (s *Schedule) Add(entry *ScheduledBroadcast) error {
+	if len(entry.Endpoints) == 0 {
+		return fmt.Errorf("scheduled broadcast needs at least one RPC endpoint")
+	}
+	switch {
+	case entry.Conditions != nil:
+		if entry.Conditions.MaxBaseFee == nil && entry.Conditions.After == nil {
+			return fmt.Errorf("release conditions need a base fee or a prior transaction")
+		}
+		if entry.Window <= 0 {
+			return fmt.Errorf("conditional broadcast needs a window for its inclusion")
+		}
+		if c := entry.Conditions; !c.Expires.IsZero() && !c.Expires.After(time.Now()) {
+			return fmt.Errorf("expiry %s has already passed", c.Expires.Format(time.RFC3339))
+		}
+	case entry.Retry != nil:
+		if entry.Window <= 0 {
+			return fmt.Errorf("held broadcast needs a window for its inclusion")
+		}
+		if !entry.Retry.Expires.After(time.Now()) {
+			return fmt.Errorf("expiry %s has already passed", entry.Retry.Expires.Format(time.RFC3339))
+		}
+	default:
+		if !entry.Deadline.After(entry.NotBefore) {
+			return fmt.Errorf("deadline %s is not after the start time %s",
+				entry.Deadline.Format(time.RFC3339), entry.NotBefore.Format(time.RFC3339))
+		}
+		if entry.Deadline.Before(time.Now()) {
+			return fmt.Errorf("deadline %s has already passed", entry.Deadline.Format(time.RFC3339))
+		}
+	}
+
+	entry.ID = entry.Payload.Hash.Hex()
+	entry.Status = ScheduleWaiting
+	entry.Timeline = []TimelineEvent{{Time: time.Now(), Event: "scheduled", Hash: &entry.Payload.Hash}}
+
+	// A transaction with the nonce of a waiting one replaces it, as it
+	// would in the mempool
+	from, nonce, senderErr := entry.sender()
+	return s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		for _, e := range entries {
+			if e.ID == entry.ID {
+				return nil, fmt.Errorf("transaction %s is already scheduled", entry.ID)
+			}
+		}
+		for _, e := range entries {
+			if e.Status != ScheduleWaiting || senderErr != nil {
+				continue
+			}
+			if eFrom, eNonce, err := e.sender(); err == nil && eFrom == from && eNonce == nonce {
+				e.Status = ScheduleCancelled
+				e.Timeline = append(e.Timeline, TimelineEvent{Time: time.Now(), Event: "replaced", Hash: &entry.Payload.Hash,
+					Detail: fmt.Sprintf("nonce %d of %s is held for %s", nonce, from.Hex(), entry.ID)})
+			}
+		}
+		return append(entries, entry), nil
+	})
+}
+
+// sender returns the sender and nonce of a scheduled transaction
+func (e *ScheduledBroadcast) sender() (common.Address, uint64, error) {
+	var signed types.Transaction
+	if err := signed.UnmarshalBinary(common.FromHex(e.Payload.RawTransaction)); err != nil {
+		return common.Address{}, 0, fmt.Errorf("failed to decode signed transaction: %v", err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(signed.ChainId()), &signed)
+	if err != nil {
+		return common.Address{}, 0, fmt.Errorf("failed to recover sender: %v", err)
+	}
+	return from, signed.Nonce(), nil
+}
+
+// Entries returns all scheduled broadcasts
+func (s *Schedule) Entries() ([]*ScheduledBroadcast, error) {
+	var result []*ScheduledBroadcast
+	err := s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		result = entries
+		return entries, nil
+	})
+	return result, err
+}
+
+// Get returns the scheduled broadcast with an ID or a unique prefix of one
+func (s *Schedule) Get(id string) (*ScheduledBroadcast, error) {
+	var result *ScheduledBroadcast
+	err := s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		entry, err := findScheduled(entries, id)
+		result = entry
+		return entries, err
+	})
+	return result, err
+}
+
+// Release lets the scheduler submit a waiting broadcast at its next poll,
+// without waiting for its start time or conditions
+func (s *Schedule) Release(id string) (*ScheduledBroadcast, error) {
+	return s.withdraw(id, func(entry *ScheduledBroadcast) {
+		entry.Forced = true
+		entry.Timeline = append(entry.Timeline, TimelineEvent{Time: time.Now(), Event: "released", Hash: &entry.Payload.Hash})
+	})
+}
+
+// Cancel withdraws a waiting broadcast before it is submitted
+func (s *Schedule) Cancel(id string) (*ScheduledBroadcast, error) {
+	return s.withdraw(id, func(entry *ScheduledBroadcast) {
+		entry.Status = ScheduleCancelled
+		entry.Timeline = append(entry.Timeline, TimelineEvent{Time: time.Now(), Event: "cancelled", Hash: &entry.Payload.Hash})
+	})
+}
+
+// withdraw applies fn to a broadcast that is still waiting
+func (s *Schedule) withdraw(id string, fn func(*ScheduledBroadcast)) (*ScheduledBroadcast, error) {
+	var result *ScheduledBroadcast
+	err := s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		entry, err := findScheduled(entries, id)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Status != ScheduleWaiting {
+			return nil, fmt.Errorf("transaction %s is %s, not waiting", entry.ID, entry.Status)
+		}
+		fn(entry)
+		result = entry
+		return entries, nil
+	})
+	return result, err
+}
+
+// findScheduled returns the broadcast with an ID or a unique prefix of one
+func findScheduled(entries []*ScheduledBroadcast, id string) (*ScheduledBroadcast, error) {
+	var found *ScheduledBroadcast
+	for _, entry := range entries {
+		if strings.EqualFold(entry.ID, id) {
+			return entry, nil
+		}
+		if len(id) > 2 && strings.HasPrefix(strings.ToLower(entry.ID), strings.ToLower(id)) {
+			if found != nil {
+				return nil, fmt.Errorf("transaction ID %q is ambiguous", id)
+			}
+			found = entry
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no scheduled transaction %q", id)
+	}
+	return found, nil
+}
+
+// setDeadline records the deadline of a conditional broadcast once it is released
+func (s *Schedule) setDeadline(id string, deadline time.Time) error {
+	return s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		for _, e := range entries {
+			if e.ID == id {
+				e.Deadline = deadline
+			}
+		}
+		return entries, nil
+	})
+}
+
+// setRetry records the next attempt to reach the endpoints of a held broadcast
+func (s *Schedule) setRetry(id string, retry BroadcastRetry) error {
+	return s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		for _, e := range entries {
+			if e.ID == id && e.Retry != nil {
+				*e.Retry = retry
+			}
+		}
+		return entries, nil
+	})
+}
+
+// record sets the status of an entry and appends events to its timeline
+func (s *Schedule) record(id, status string, events ...TimelineEvent) error {
+	return s.update(func(entries []*ScheduledBroadcast) ([]*ScheduledBroadcast, error) {
+		for _, e := range entries {
+			if e.ID == id {
+				e.Status = status
+				e.Timeline = append(e.Timeline, events...)
+			}
+		}
+		return entries, nil
+	})
+}
+
+// update applies fn to the schedule while holding its lock
+func (s *Schedule) update(fn func([]*ScheduledBroadcast) ([]*ScheduledBroadcast, error)) error {
+	unlock, err := lockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var entries []*ScheduledBroadcast
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read schedule: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("failed to parse schedule: %v", err)
+		}
+	}
+
+	entries, err = fn(entries)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %v", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write schedule: %v", err)
+	}
+	return nil
+}
+
+// Scheduler submits scheduled broadcasts once their start time has come. Fee
+// levels of a ladder are released across the window up to the deadline, and
+// broadcasts that are not included by then are aborted with a notification.
+type Scheduler struct {
+	schedule *Schedule
+	history  *History
+
+	// OnEvent, if set, is called for every timeline event
+	OnEvent func(entry *ScheduledBroadcast, event TimelineEvent)
+	// Describe, if set, adds the decoded call and policy outcome to notifications
+	Describe func(n *Notification)
+
+	mu      sync.Mutex
+	running map[string]bool
+	checked map[string]time.Time
+}
+
+// NewScheduler creates a scheduler recording timelines in history
+func NewScheduler(schedule *Schedule, history *History) *Scheduler {
+	return &Scheduler{
+		schedule: schedule,
+		history:  history,
+		running:  make(map[string]bool),
+		checked:  make(map[string]time.Time),
+	}
+}
+
+// Run submits due broadcasts until ctx is cancelled, once their release
+// conditions are met. Broadcasts interrupted by a restart are resumed.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		entries, err := s.schedule.Entries()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, entry := range entries {
+			if entry.Status != ScheduleWaiting && entry.Status != ScheduleSubmitting {
+				continue
+			}
+			if !entry.Forced && (now.Before(entry.NotBefore) || !s.due(entry, now)) {
+				continue
+			}
+			if !s.start(entry.ID) {
+				continue
+			}
+
+			wg.Add(1)
+			go func(entry *ScheduledBroadcast) {
+				defer wg.Done()
+				defer s.finish(entry.ID)
+				s.execute(ctx, entry)
+			}(entry)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(schedulePollInterval):
+		}
+	}
+}
+
+// start marks an entry as running, reporting false if it already is
+func (s *Scheduler) start(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+// due reports whether the conditions of a waiting entry are to be checked,
+// so the chain is asked at most every conditionPollInterval, or whether its
+// unreachable endpoints are to be tried again
+func (s *Scheduler) due(entry *ScheduledBroadcast, now time.Time) bool {
+	if entry.Status == ScheduleWaiting && entry.Retry != nil {
+		return !now.Before(entry.Retry.NextAttempt)
+	}
+	if entry.Status != ScheduleWaiting || entry.Conditions == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.checked[entry.ID]) < conditionPollInterval {
+		return false
+	}
+	s.checked[entry.ID] = now
+	return true
+}
+
+// finish marks an entry as no longer running
+func (s *Scheduler) finish(id string) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+}
+
+// execute submits one scheduled broadcast and records its outcome
+func (s *Scheduler) execute(ctx context.Context, entry *ScheduledBroadcast) {
+	if entry.Status == ScheduleWaiting && entry.Conditions != nil && !entry.Forced {
+		if c := entry.Conditions; !c.Expires.IsZero() && time.Now().After(c.Expires) {
+			s.abort(entry, fmt.Sprintf("release conditions not met by %s", c.Expires.Format(time.RFC3339)))
+			return
+		}
+		detail, err := s.conditionsMet(ctx, entry)
+		if errors.Is(err, errConditionFailed) {
+			s.abort(entry, err.Error())
+			return
+		}
+		if err != nil || detail == "" {
+			// Checked again at the next poll
+			return
+		}
+		s.emit(entry, ScheduleWaiting, TimelineEvent{Time: time.Now(), Event: "conditions met", Detail: detail})
+	}
+	if entry.Status == ScheduleWaiting && entry.Retry != nil && !entry.Forced {
+		if time.Now().After(entry.Retry.Expires) {
+			s.abort(entry, fmt.Sprintf("no RPC endpoint could be reached by %s", entry.Retry.Expires.Format(time.RFC3339)))
+			return
+		}
+		included, err := s.checkNonce(ctx, entry)
+		switch {
+		case errors.Is(err, errConditionFailed):
+			s.abort(entry, err.Error())
+			return
+		case err != nil:
+			s.retryLater(entry, err)
+			return
+		case included:
+			s.emit(entry, ScheduleIncluded, TimelineEvent{Time: time.Now(), Event: "included", Detail: "found on-chain once an endpoint could be reached"})
+			s.notify(entry)
+			return
+		}
+		s.emit(entry, ScheduleWaiting, TimelineEvent{Time: time.Now(), Event: "endpoint reachable",
+			Detail: fmt.Sprintf("after %d attempts", entry.Retry.Attempts+1)})
+	}
+	if entry.Deadline.IsZero() {
+		entry.Deadline = time.Now().Add(entry.Window)
+		s.schedule.setDeadline(entry.ID, entry.Deadline)
+	}
+
+	window := time.Until(entry.Deadline)
+	if window <= 0 {
+		s.abort(entry, "deadline passed before submission could start")
+		return
+	}
+
+	s.emit(entry, ScheduleSubmitting, TimelineEvent{Time: time.Now(), Event: "submission started",
+		Detail: fmt.Sprintf("%d fee levels until %s", len(entry.Payload.Levels()), entry.Deadline.Format(time.RFC3339))})
+
+	broadcaster, err := NewBroadcaster(entry.Endpoints)
+	if err != nil {
+		s.abort(entry, err.Error())
+		return
+	}
+
+	// Fees escalate across the remaining window, the last level well before the deadline
+	ladderCtx, cancel := context.WithDeadline(ctx, entry.Deadline)
+	defer cancel()
+	result, err := broadcaster.BroadcastLadder(ladderCtx, entry.Payload, window)
+	if err != nil && entry.Retry != nil && errors.Is(err, ErrRPCUnavailable) {
+		// Connectivity was lost again before the first level went out
+		entry.Deadline = time.Time{}
+		s.schedule.setDeadline(entry.ID, entry.Deadline)
+		s.retryLater(entry, err)
+		return
+	}
+	if err != nil {
+		s.abort(entry, err.Error())
+		return
+	}
+
+	for _, event := range result.Timeline {
+		s.emit(entry, ScheduleSubmitting, event)
+	}
+
+	switch {
+	case result.Included:
+		s.emit(entry, ScheduleIncluded)
+		if entry.Retry != nil {
+			s.notify(entry)
+		}
+	case ctx.Err() != nil:
+		// Interrupted by shutdown; the entry is resumed on the next start
+	default:
+		s.abort(entry, fmt.Sprintf("not included by the deadline after releasing %d fee levels", result.Released))
+	}
+}
+
+// conditionsMet checks the release conditions of an entry against the chain,
+// returning what met them, or "" if they are not met yet
+func (s *Scheduler) conditionsMet(ctx context.Context, entry *ScheduledBroadcast) (string, error) {
+	conditions := entry.Conditions
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	client, err := dial(ctx, entry.Endpoints[0])
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	var met []string
+	if conditions.MaxBaseFee != nil {
+		head, err := call(ctx, func(ctx context.Context) (*types.Header, error) {
+			return client.HeaderByNumber(ctx, nil)
+		})
+		if err != nil {
+			return "", err
+		}
+		if head.BaseFee == nil {
+			return "", fmt.Errorf("%w: %s has no base fee", errConditionFailed, entry.Chain)
+		}
+		if head.BaseFee.Cmp(conditions.MaxBaseFee) > 0 {
+			return "", nil
+		}
+		met = append(met, fmt.Sprintf("base fee %s wei at block %s", head.BaseFee, head.Number))
+	}
+	if conditions.After != nil {
+		receipt, err := call(ctx, func(ctx context.Context) (*types.Receipt, error) {
+			return client.TransactionReceipt(ctx, *conditions.After)
+		})
+		if errors.Is(err, ethereum.NotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return "", fmt.Errorf("%w: %s reverted", errConditionFailed, conditions.After.Hex())
+		}
+		head, err := call(ctx, client.BlockNumber)
+		if err != nil {
+			return "", err
+		}
+		confirmations := head - receipt.BlockNumber.Uint64() + 1
+		if head < receipt.BlockNumber.Uint64() || confirmations < conditions.Confirmations {
+			return "", nil
+		}
+		met = append(met, fmt.Sprintf("%s has %d confirmations", conditions.After.Hex(), confirmations))
+	}
+	return strings.Join(met, ", "), nil
+}
+
+// checkNonce reaches the endpoints of a broadcast held for them and checks
+// that its nonce is still open. It returns an RPCError while no endpoint
+// answers, whether a level of the broadcast was already included, and
+// errConditionFailed if another transaction used the nonce.
+func (s *Scheduler) checkNonce(ctx context.Context, entry *ScheduledBroadcast) (bool, error) {
+	from, nonce, err := entry.sender()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errConditionFailed, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var failures []error
+	for _, endpoint := range entry.Endpoints {
+		client, err := dial(ctx, endpoint)
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		defer client.Close()
+
+		confirmed, err := call(ctx, func(ctx context.Context) (uint64, error) {
+			return client.NonceAt(ctx, from, nil)
+		})
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		if confirmed <= nonce {
+			return false, nil
+		}
+		for _, level := range entry.Payload.Levels() {
+			if receipt, err := client.TransactionReceipt(ctx, level.Hash); err == nil && receipt != nil {
+				return true, nil
+			}
+		}
+		return false, fmt.Errorf("%w: nonce %d of %s was used by another transaction", errConditionFailed, nonce, from.Hex())
+	}
+	return false, fmt.Errorf("failed to reach any endpoint: %w", errors.Join(failures...))
+}
+
+// retryLater records a failed attempt to reach the endpoints of a held
+// broadcast and schedules the next one, backing off up to maxUnreachableBackoff
+func (s *Scheduler) retryLater(entry *ScheduledBroadcast, err error) {
+	entry.Retry.Attempts++
+	backoff := maxUnreachableBackoff
+	if shift := entry.Retry.Attempts - 1; shift < 10 {
+		backoff = min(unreachableBackoff<<shift, maxUnreachableBackoff)
+	}
+	entry.Retry.NextAttempt = time.Now().Add(jitter(backoff))
+	s.schedule.setRetry(entry.ID, *entry.Retry)
+	s.emit(entry, ScheduleWaiting, TimelineEvent{Time: time.Now(), Event: "endpoints unreachable",
+		Detail: fmt.Sprintf("attempt %d: %v; next at %s", entry.Retry.Attempts, err, entry.Retry.NextAttempt.Format(time.RFC3339))})
+}
+
+// abort marks a broadcast as aborted and sends its notification
+func (s *Scheduler) abort(entry *ScheduledBroadcast, reason string) {
+	s.emit(entry, ScheduleAborted, TimelineEvent{Time: time.Now(), Event: "aborted", Detail: reason})
+	s.notify(entry)
+}
+
+// notify posts a broadcast to its webhook, if it has one, and records the outcome
+func (s *Scheduler) notify(entry *ScheduledBroadcast) {
+	if entry.Notify == "" {
+		return
+	}
+	if err := sendNotification(entry.Notify, entry.NotifyTemplate, s.notification(entry)); err != nil {
+		s.emit(entry, entry.Status, TimelineEvent{Time: time.Now(), Event: "notification failed", Detail: err.Error()})
+		return
+	}
+	s.emit(entry, entry.Status, TimelineEvent{Time: time.Now(), Event: "notified", Detail: entry.Notify})
+}
+
+// emit records events in the schedule and the history and reports them
+func (s *Scheduler) emit(entry *ScheduledBroadcast, status string, events ...TimelineEvent) {
+	entry.Status = status
+	entry.Timeline = append(entry.Timeline, events...)
+
+	// Recording is best effort; a failed write must not stop the submission
+	s.schedule.record(entry.ID, status, events...)
+	if s.history != nil {
+		chainID := ""
+		if entry.Payload.ChainID != nil {
+			chainID = entry.Payload.ChainID.String()
+		}
+		s.history.RecordTimeline(entry.Payload.Hash, chainID, status, events)
+	}
+
+	if s.OnEvent != nil {
+		for _, event := range events {
+			s.OnEvent(entry, event)
+		}
+	}
+}
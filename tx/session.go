@@ -0,0 +1,359 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RPCSessionVersion is the format version of recorded RPC sessions
+const RPCSessionVersion = 1
+
+// redacted replaces secrets found in recorded requests and answers
+const redacted = "[redacted]"
+
+// replayURL is dialed for every endpoint while replaying; requests never
+// leave the process
+const replayURL = "http://replay.invalid"
+
+var (
+	sessionMu sync.Mutex
+	recorder  *RPCSession
+)
+
+// RPCSession is the JSON-RPC traffic of a command, recorded with --record-rpc
+// and answered again with --replay-rpc. Endpoints are kept as hosts only and
+// no headers are recorded, so API keys in URLs and credentials stay out.
+type RPCSession struct {
+	Version  int        `json:"version"`
+	Command  string     `json:"command,omitempty"`
+	Recorded time.Time  `json:"recorded"`
+	Calls    []*RPCCall `json:"calls"`
+	// Unrecorded are the hosts of WebSocket endpoints, whose traffic is not
+	// captured
+	Unrecorded []string `json:"unrecorded,omitempty"`
+
+	// replayed counts the answers given per call key while replaying
+	replayed map[string]int
+}
+
+// RPCCall is a recorded JSON-RPC call and the answer of the node
+type RPCCall struct {
+	Endpoint string          `json:"endpoint"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    *RPCCallError   `json:"error,omitempty"`
+}
+
+// rpcMessage is a JSON-RPC request or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCCallError   `json:"error,omitempty"`
+}
+
+// RPCCallError is the error a node answered a call with
+type RPCCallError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// RecordRPC records the JSON-RPC traffic of every endpoint dialed from now on
+// into a session saved with SaveRPCSession
+func RecordRPC(command string) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	recorder = &RPCSession{Version: RPCSessionVersion, Command: command, Recorded: time.Now().UTC()}
+}
+
+// SaveRPCSession writes the session being recorded, if any, to path
+func SaveRPCSession(path string) (*RPCSession, error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if recorder == nil {
+		return nil, nil
+	}
+	data, err := json.MarshalIndent(recorder, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal RPC session: %v", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write RPC session: %v", err)
+	}
+	return recorder, nil
+}
+
+// LoadRPCSession reads a recorded session
+func LoadRPCSession(path string) (*RPCSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RPC session: %v", err)
+	}
+	var session RPCSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse RPC session: %v", err)
+	}
+	if session.Version != RPCSessionVersion {
+		return nil, fmt.Errorf("unsupported RPC session version %d (expected %d)", session.Version, RPCSessionVersion)
+	}
+	return &session, nil
+}
+
+// ReplayRPC answers every RPC request of this process from a recorded session
+// instead of the configured endpoints. Calls are matched by endpoint host,
+// method and parameters; repeated calls get the recorded answers in order,
+// the last one again once they run out. A call that was not recorded fails
+// as an unreachable endpoint would.
+func ReplayRPC(session *RPCSession) {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+
+	session.replayed = make(map[string]int)
+	backendOverride = func(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+		transport := &replayTransport{session: session, endpoint: endpointHost(rpcURL)}
+		client, err := rpc.DialOptions(ctx, replayURL, rpc.WithHTTPClient(&http.Client{Transport: transport}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay RPC session: %v", err)
+		}
+		return ethclient.NewClient(client), nil
+	}
+}
+
+// recordingTransport adds the calls sent through an endpoint to the session
+// being recorded
+type recordingTransport struct {
+	endpoint string
+	// credentials are the parts of the resolved URL that may carry them
+	credentials []string
+	next        http.RoundTripper
+}
+
+// recordingTransportFor wraps the transport of an endpoint while a session is
+// recorded. configured is the URL as configured, resolved the one dialed.
+func recordingTransportFor(configured, resolved string, next http.RoundTripper) http.RoundTripper {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if recorder == nil {
+		return next
+	}
+	u, err := url.Parse(resolved)
+	if err != nil {
+		return next
+	}
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		host := endpointHost(configured)
+		for _, unrecorded := range recorder.Unrecorded {
+			if unrecorded == host {
+				return next
+			}
+		}
+		recorder.Unrecorded = append(recorder.Unrecorded, host)
+		return next
+	}
+
+	var credentials []string
+	if u.User != nil {
+		credentials = append(credentials, u.User.String())
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		credentials = append(credentials, u.Path)
+	}
+	if u.RawQuery != "" {
+		credentials = append(credentials, u.RawQuery)
+	}
+	return &recordingTransport{endpoint: endpointHost(configured), credentials: credentials, next: next}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	answer, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(answer))
+
+	calls, _ := parseMessages(t.sanitize(request))
+	answers, _ := parseMessages(t.sanitize(answer))
+	byID := make(map[string]*rpcMessage, len(answers))
+	for _, answer := range answers {
+		byID[string(answer.ID)] = answer
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	for _, call := range calls {
+		answer, ok := byID[string(call.ID)]
+		if !ok || recorder == nil {
+			continue
+		}
+		recorder.Calls = append(recorder.Calls, &RPCCall{
+			Endpoint: t.endpoint,
+			Method:   call.Method,
+			Params:   compactJSON(call.Params),
+			Result:   answer.Result,
+			Error:    answer.Error,
+		})
+	}
+	return resp, nil
+}
+
+// sanitize removes the credentials of the endpoint URL from a message, such
+// as an API key an error message repeats
+func (t *recordingTransport) sanitize(data []byte) []byte {
+	for _, credential := range t.credentials {
+		data = bytes.ReplaceAll(data, []byte(credential), []byte(redacted))
+	}
+	return data
+}
+
+// replayTransport answers the requests of an endpoint from a session
+type replayTransport struct {
+	session  *RPCSession
+	endpoint string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	calls, batch := parseMessages(request)
+	if calls == nil {
+		return nil, fmt.Errorf("invalid JSON-RPC request to %s", t.endpoint)
+	}
+
+	answers := make([]*rpcMessage, len(calls))
+	for i, call := range calls {
+		recorded := t.session.answer(t.endpoint, call.Method, call.Params)
+		if recorded == nil {
+			return nil, fmt.Errorf("%s %s was not recorded in the RPC session", t.endpoint, call.Method)
+		}
+		answers[i] = &rpcMessage{JSONRPC: "2.0", ID: call.ID, Result: recorded.Result, Error: recorded.Error}
+	}
+
+	var body []byte
+	if batch {
+		body, err = json.Marshal(answers)
+	} else {
+		body, err = json.Marshal(answers[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// answer returns the next recorded answer of a call, or nil
+func (s *RPCSession) answer(endpoint, method string, params json.RawMessage) *RPCCall {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	key := endpoint + " " + method + " " + string(compactJSON(params))
+	var matches []*RPCCall
+	for _, call := range s.Calls {
+		if call.Endpoint == endpoint && call.Method == method && bytes.Equal(compactJSON(call.Params), compactJSON(params)) {
+			matches = append(matches, call)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	next := s.replayed[key]
+	if next >= len(matches) {
+		next = len(matches) - 1
+	}
+	s.replayed[key] = next + 1
+	return matches[next]
+}
+
+// readBody returns the body of a request and leaves it readable for the
+// next transport
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
+
+// parseMessages parses a JSON-RPC message or batch and reports whether it was
+// a batch
+func parseMessages(data []byte) ([]*rpcMessage, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []*rpcMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, true
+		}
+		return batch, true
+	}
+	var message rpcMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, false
+	}
+	return []*rpcMessage{&message}, false
+}
+
+// compactJSON removes insignificant space, so parameters compare equal
+// however they were encoded
+func compactJSON(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var out bytes.Buffer
+	if err := json.Compact(&out, data); err != nil {
+		return data
+	}
+	if out.String() == "[]" || out.String() == "null" {
+		return nil
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,160 @@
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DefaultSimulationCacheFile is the default location of the simulation cache
+var DefaultSimulationCacheFile = filepath.Join(historyDir, "simulations.json")
+
+const (
+	// DefaultSimulationCacheBlocks is how many blocks a cached result stays valid
+	DefaultSimulationCacheBlocks = 3
+)
+
+// cachedSimulation is a simulation result together with the block it was computed at
+type cachedSimulation struct {
+	BlockNumber uint64            `json:"blockNumber"`
+	Result      *SimulationResult `json:"result"`
+}
+
+// SimulationCache stores simulation results keyed by payload hash so the same
+// transaction simulated at several stages only hits the RPC once per block window
+type SimulationCache struct {
+	entries   map[common.Hash]*cachedSimulation
+	mu        sync.RWMutex
+	maxBlocks uint64
+	filePath  string
+}
+
+// NewSimulationCache creates a simulation cache persisted at filePath. Entries
+// are invalidated once the head advances more than maxBlocks past the block they
+// were simulated at. An empty filePath keeps the cache in memory only.
+func NewSimulationCache(filePath string, maxBlocks uint64) (*SimulationCache, error) {
+	cache := &SimulationCache{
+		entries:   make(map[common.Hash]*cachedSimulation),
+		maxBlocks: maxBlocks,
+		filePath:  filePath,
+	}
+
+	if err := cache.load(); err != nil {
+		return nil, fmt.Errorf("failed to load simulation cache: %v", err)
+	}
+
+	return cache, nil
+}
+
+// PayloadHash returns a canonical hash of the fields that affect a simulation
+func PayloadHash(tx *Transaction) (common.Hash, error) {
+	encoded, err := rlp.EncodeToBytes([]interface{}{
+		tx.From,
+		tx.To,
+		tx.Value,
+		tx.Gas,
+		tx.GasPrice,
+		tx.Data,
+		tx.Nonce,
+		tx.ChainID,
+	})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode payload: %v", err)
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// Get returns the cached result for a payload if it is still valid at head
+func (c *SimulationCache) Get(key common.Hash, head uint64) (*SimulationResult, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists || !c.valid(entry, head) {
+		return nil, false
+	}
+	return entry.Result, true
+}
+
+// Put stores a result simulated at blockNumber and drops expired entries
+func (c *SimulationCache) Put(key common.Hash, blockNumber uint64, result *SimulationResult) error {
+	c.mu.Lock()
+	c.entries[key] = &cachedSimulation{
+		BlockNumber: blockNumber,
+		Result:      result,
+	}
+	for k, entry := range c.entries {
+		if !c.valid(entry, blockNumber) {
+			delete(c.entries, k)
+		}
+	}
+	c.mu.Unlock()
+
+	return c.save()
+}
+
+// valid reports whether an entry may still be used at the given head
+func (c *SimulationCache) valid(entry *cachedSimulation, head uint64) bool {
+	if head < entry.BlockNumber {
+		// The head went backwards (reorg or different endpoint), don't trust it
+		return false
+	}
+	return head-entry.BlockNumber <= c.maxBlocks
+}
+
+// load loads the cache from file
+func (c *SimulationCache) load() error {
+	if c.filePath == "" {
+		return nil
+	}
+	if _, err := os.Stat(c.filePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read cache file: %v", err)
+	}
+
+	entries := make(map[common.Hash]*cachedSimulation)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse cache: %v", err)
+	}
+
+	c.mu.Lock()
+	c.entries = entries
+	c.mu.Unlock()
+
+	return nil
+}
+
+// save saves the cache to file
+func (c *SimulationCache) save() error {
+	if c.filePath == "" {
+		return nil
+	}
+
+	c.mu.RLock()
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	if err := os.WriteFile(c.filePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cache file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package tx
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// DefaultSimulatorURL is the endpoint of 'sim start' and of --backend sim
+const DefaultSimulatorURL = "http://127.0.0.1:8545"
+
+// SimulatedChainConfig configures a simulated chain. Listen is the host:port
+// serving HTTP and WebSocket RPC; without it the chain is only reachable in
+// process.
+type SimulatedChainConfig struct {
+	ChainID     *big.Int
+	Alloc       map[common.Address]*big.Int
+	Listen      string
+	BlockPeriod uint64
+}
+
+// UseSimulator sends every RPC request to the endpoint of a simulator such as
+// 'sim start' or Anvil instead of the configured endpoints. "" restores them.
+func UseSimulator(endpoint string) {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+
+	if endpoint == "" {
+		backendOverride = nil
+		return
+	}
+	backendOverride = func(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+		return dialDirect(ctx, endpoint)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build sim
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/eth/catalyst"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simulatedGasLimit is the block gas limit of simulated chains
+const simulatedGasLimit = 30_000_000
+
+// SimulatedChain is an in-memory chain with all protocol changes up to
+// Shanghai. Blocks are sealed as soon as a transaction arrives, or every
+// BlockPeriod seconds. Nothing is written to disk.
+type SimulatedChain struct {
+	ChainID *big.Int
+
+	stack   *node.Node
+	backend *eth.Ethereum
+	beacon  *catalyst.SimulatedBeacon
+}
+
+// NewSimulatedChain starts a simulated chain with the given chain ID and
+// funded accounts
+func NewSimulatedChain(cfg SimulatedChainConfig) (*SimulatedChain, error) {
+	nodeConfig := node.DefaultConfig
+	nodeConfig.DataDir = ""
+	nodeConfig.P2P = p2p.Config{NoDiscovery: true, MaxPeers: 0}
+	nodeConfig.HTTPHost, nodeConfig.WSHost = "", ""
+	if cfg.Listen != "" {
+		host, portValue, err := net.SplitHostPort(cfg.Listen)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %v", cfg.Listen, err)
+		}
+		port, err := strconv.Atoi(portValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen port %q: %v", portValue, err)
+		}
+		nodeConfig.HTTPHost, nodeConfig.HTTPPort = host, port
+		nodeConfig.WSHost, nodeConfig.WSPort = host, port
+		nodeConfig.HTTPModules = []string{"eth", "net", "web3", "txpool", "debug"}
+		nodeConfig.WSModules = nodeConfig.HTTPModules
+		nodeConfig.HTTPVirtualHosts = []string{"*"}
+	}
+	stack, err := node.New(&nodeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create simulated node: %v", err)
+	}
+
+	chainConfig := *params.AllDevChainProtocolChanges
+	chainConfig.ChainID = new(big.Int).Set(cfg.ChainID)
+	alloc := make(core.GenesisAlloc, len(cfg.Alloc))
+	for address, balance := range cfg.Alloc {
+		alloc[address] = core.GenesisAccount{Balance: balance}
+	}
+
+	ethConfig := ethconfig.Defaults
+	ethConfig.Genesis = &core.Genesis{Config: &chainConfig, GasLimit: simulatedGasLimit, Alloc: alloc}
+	ethConfig.SyncMode = downloader.FullSync
+	ethConfig.TxPool.NoLocals = true
+	backend, err := eth.New(stack, &ethConfig)
+	if err != nil {
+		stack.Close()
+		return nil, fmt.Errorf("failed to create simulated chain: %v", err)
+	}
+	filterSystem := filters.NewFilterSystem(backend.APIBackend, filters.Config{})
+	stack.RegisterAPIs([]rpc.API{{
+		Namespace: "eth",
+		Service:   filters.NewFilterAPI(filterSystem, false),
+	}})
+
+	// Seal blocks like a post-merge chain; period 0 seals one per transaction
+	beacon, err := catalyst.NewSimulatedBeacon(cfg.BlockPeriod, backend)
+	if err != nil {
+		stack.Close()
+		return nil, fmt.Errorf("failed to create simulated beacon: %v", err)
+	}
+	catalyst.RegisterSimulatedBeaconAPIs(stack, beacon)
+	stack.RegisterLifecycle(beacon)
+
+	if err := stack.Start(); err != nil {
+		stack.Close()
+		return nil, fmt.Errorf("failed to start simulated chain: %v", err)
+	}
+	return &SimulatedChain{ChainID: chainConfig.ChainID, stack: stack, backend: backend, beacon: beacon}, nil
+}
+
+// URL returns the HTTP endpoint of the chain, or "" if it only runs in process
+func (s *SimulatedChain) URL() string {
+	return s.stack.HTTPEndpoint()
+}
+
+// Client returns a new in-process client of the chain
+func (s *SimulatedChain) Client() *ethclient.Client {
+	return ethclient.NewClient(s.stack.Attach())
+}
+
+// Commit seals a block with the pending transactions and returns its hash
+func (s *SimulatedChain) Commit() common.Hash {
+	return s.beacon.Commit()
+}
+
+// Fork rewinds the chain to an ancestor block, so blocks committed afterwards
+// reorg out the ones that followed it
+func (s *SimulatedChain) Fork(parent common.Hash) error {
+	return s.beacon.Fork(parent)
+}
+
+// Close stops the chain and discards its state
+func (s *SimulatedChain) Close() error {
+	return s.stack.Close()
+}
+
+// UseSimulatedChain sends every RPC request of this process to a simulated
+// chain instead of the configured endpoints. nil restores the endpoints.
+func UseSimulatedChain(chain *SimulatedChain) {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+
+	if chain == nil {
+		backendOverride = nil
+		return
+	}
+	backendOverride = func(ctx context.Context, rpcURL string) (*ethclient.Client, error) {
+		return chain.Client(), nil
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !sim
+
+package tx
+
+import (
+	"errors"
+	"math/big"
+)
+
+// errNoSimulatedChain is returned by builds without the in-process chain,
+// whose go-ethereum node does not link on every Go release
+var errNoSimulatedChain = errors.New("this build has no simulated chain; rebuild with -tags sim or point --backend sim at Anvil or Hardhat")
+
+// SimulatedChain is an in-memory chain, available in builds with the sim tag
+type SimulatedChain struct {
+	ChainID *big.Int
+}
+
+// NewSimulatedChain fails in builds without the sim tag
+func NewSimulatedChain(cfg SimulatedChainConfig) (*SimulatedChain, error) {
+	return nil, errNoSimulatedChain
+}
+
+// URL returns the HTTP endpoint of the chain
+func (s *SimulatedChain) URL() string {
+	return ""
+}
+
+// Close stops the chain
+func (s *SimulatedChain) Close() error {
+	return nil
+}
@@ -0,0 +1,146 @@
+//go:build sim
+
+package tx
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// simulatedEndpoint is the endpoint the pipeline is configured with; every
+// request it makes goes to the simulated chain instead
+const simulatedEndpoint = "http://simulated.invalid"
+
+// TestSimulatedPipeline builds, signs and broadcasts a transfer on a simulated
+// chain, follows it to finality with the monitor and records it in the history
+func TestSimulatedPipeline(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed")
+
+	chain, err := NewSimulatedChain(SimulatedChainConfig{
+		ChainID: big.NewInt(1337),
+		Alloc:   map[common.Address]*big.Int{from: big.NewInt(params.Ether)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	UseSimulatedChain(chain)
+	defer UseSimulatedChain(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Build: fill in nonce, fees and gas like 'tx prepare'
+	simulator, err := NewSimulator(simulatedEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulator.Close()
+	nonce, err := simulator.PendingNonce(ctx, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasPrice, err := simulator.GetGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := big.NewInt(params.GWei)
+	gas, err := simulator.EstimateGas(ctx, &Transaction{From: from, To: &to, Value: value, GasPrice: gasPrice, ChainID: chain.ChainID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign
+	signedTx, err := core.SignTransaction(&core.Transaction{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    value,
+		GasLimit: gas,
+		GasPrice: gasPrice,
+		ChainID:  chain.ChainID,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Broadcast and monitor until final
+	broadcaster, err := NewBroadcaster([]string{simulatedEndpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := broadcaster.Broadcast(ctx, common.FromHex(signedTx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != core.TransactionHash(signedTx) {
+		t.Fatalf("broadcast returned %s, signed transaction is %s", hash.Hex(), core.TransactionHash(signedTx).Hex())
+	}
+
+	monitor, err := NewMonitor(simulatedEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Close()
+	monitor.Confirmations = 3
+	monitor.PollInterval = 50 * time.Millisecond
+	final := make(chan *TransactionStatus, 1)
+	monitor.AddCallback(hash, func(status *TransactionStatus) {
+		if status.Final {
+			select {
+			case final <- status:
+			default:
+			}
+		}
+	})
+	if err := monitor.MonitorTransaction(ctx, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	var status *TransactionStatus
+	for status == nil {
+		chain.Commit()
+		select {
+		case status = <-final:
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("transaction did not become final")
+		}
+	}
+	if status.Status != "success" {
+		t.Fatalf("transaction status is %q, want success", status.Status)
+	}
+
+	// Record in the history from the chain
+	history, err := NewHistory(simulatedEndpoint, filepath.Join(t.TempDir(), "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	if err := history.AddTransaction(ctx, hash); err != nil {
+		t.Fatal(err)
+	}
+	record, err := history.GetTransaction(chain.ChainID.String(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.From != from.Hex() || record.To != to.Hex() || record.Value != value.String() {
+		t.Errorf("history recorded %s -> %s of %s, want %s -> %s of %s",
+			record.From, record.To, record.Value, from.Hex(), to.Hex(), value)
+	}
+	if record.Status != "success" || record.BlockNumber != status.BlockNum {
+		t.Errorf("history recorded status %q in block %d, want success in block %d", record.Status, record.BlockNumber, status.BlockNum)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"math/big"
 
+	"github.com/aryehky/gosignervaultcli/core"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
@@ -16,27 +18,69 @@ type SimulationResult struct {
 	GasPrice     *big.Int          `json:"gasPrice"`
 	TotalCost    *big.Int          `json:"totalCost"`
 	Error        string            `json:"error,omitempty"`
+	RevertReason string            `json:"revertReason,omitempty"`
 	Trace        []string          `json:"trace,omitempty"`
 	StateChanges map[string]string `json:"stateChanges,omitempty"`
+
+	// Traced is set when the call was traced with debug_traceCall; otherwise
+	// TraceError says why the simulation fell back to eth_call
+	Traced         bool            `json:"traced"`
+	TraceError     string          `json:"traceError,omitempty"`
+	Calls          *CallFrame      `json:"calls,omitempty"`
+	TokenTransfers []TokenTransfer `json:"tokenTransfers,omitempty"`
+
+	// L1Fee is the L1 data fee of rollups. OP-stack chains charge it on top
+	// of the gas, so it is added to TotalCost; on Arbitrum the gas includes it.
+	L1Fee *big.Int `json:"l1Fee,omitempty"`
+	// TotalCostNative is TotalCost in whole gas tokens and TotalCostUSD its
+	// value in USD, filled in by PriceCost
+	TotalCostNative string   `json:"totalCostNative,omitempty"`
+	TotalCostUSD    *float64 `json:"totalCostUsd,omitempty"`
+	PriceSource     string   `json:"priceSource,omitempty"`
+
+	// Effects are the net balance changes of traced, successful calls
+	Effects *Effects `json:"effects,omitempty"`
 }
 
 // Simulator handles transaction simulation and gas estimation
 type Simulator struct {
 	client *ethclient.Client
+	tracer *ethclient.Client
+	cache  *SimulationCache
+	l1Fees string
+	// pooled clients belong to the active client pool
+	pooled bool
 }
 
-// NewSimulator creates a new transaction simulator
+// NewSimulator creates a new transaction simulator, using the active client
+// pool if there is one
 func NewSimulator(rpcURL string) (*Simulator, error) {
-	client, err := ethclient.Dial(rpcURL)
+	client, pooled, err := pooledDial(context.Background(), rpcURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RPC: %v", err)
+		return nil, err
 	}
 
 	return &Simulator{
 		client: client,
+		pooled: pooled,
 	}, nil
 }
 
+// SetCache enables result caching for SimulateTransaction
+func (s *Simulator) SetCache(cache *SimulationCache) {
+	s.cache = cache
+}
+
+// SetL1Fees adds the L1 data fee of a rollup fee model (see
+// core.ChainConfig.L1Fees) to the results of SimulateTransaction
+func (s *Simulator) SetL1Fees(model string) error {
+	if model != "" && model != core.L1FeesOPStack && model != core.L1FeesArbitrum {
+		return fmt.Errorf("%w: %s", errUnsupportedL1FeeModel, model)
+	}
+	s.l1Fees = model
+	return nil
+}
+
 // EstimateGas estimates the gas required for a transaction
 func (s *Simulator) EstimateGas(ctx context.Context, tx *Transaction) (uint64, error) {
 	// Convert to Ethereum transaction
@@ -44,7 +88,7 @@ func (s *Simulator) EstimateGas(ctx context.Context, tx *Transaction) (uint64, e
 
 	// Create call message
 	msg := ethereum.CallMsg{
-		From:     ethTx.From(),
+		From:     tx.From,
 		To:       ethTx.To(),
 		Gas:      ethTx.Gas(),
 		GasPrice: ethTx.GasPrice(),
@@ -53,9 +97,11 @@ func (s *Simulator) EstimateGas(ctx context.Context, tx *Transaction) (uint64, e
 	}
 
 	// Estimate gas
-	gasLimit, err := s.client.EstimateGas(ctx, msg)
+	gasLimit, err := call(ctx, func(ctx context.Context) (uint64, error) {
+		return s.client.EstimateGas(ctx, msg)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to estimate gas: %v", err)
+		return 0, fmt.Errorf("failed to estimate gas: %w", err)
 	}
 
 	return gasLimit, nil
@@ -68,7 +114,7 @@ func (s *Simulator) SimulateTransaction(ctx context.Context, tx *Transaction) (*
 
 	// Create call message
 	msg := ethereum.CallMsg{
-		From:     ethTx.From(),
+		From:     tx.From,
 		To:       ethTx.To(),
 		Gas:      ethTx.Gas(),
 		GasPrice: ethTx.GasPrice(),
@@ -77,9 +123,21 @@ func (s *Simulator) SimulateTransaction(ctx context.Context, tx *Transaction) (*
 	}
 
 	// Get current block number
-	blockNumber, err := s.client.BlockNumber(ctx)
+	blockNumber, err := call(ctx, s.client.BlockNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get block number: %v", err)
+		return nil, fmt.Errorf("failed to get block number: %w", err)
+	}
+
+	// Reuse a result simulated recently enough
+	var payloadHash common.Hash
+	if s.cache != nil {
+		payloadHash, err = PayloadHash(tx)
+		if err != nil {
+			return nil, err
+		}
+		if cached, ok := s.cache.Get(payloadHash, blockNumber); ok {
+			return cached, nil
+		}
 	}
 
 	// Simulate transaction
@@ -87,79 +145,142 @@ func (s *Simulator) SimulateTransaction(ctx context.Context, tx *Transaction) (*
 		StateChanges: make(map[string]string),
 	}
 
-	// Call the transaction
-	_, err = s.client.CallContract(ctx, msg, big.NewInt(int64(blockNumber)))
-	if err != nil {
-		result.Success = false
-		result.Error = err.Error()
-		return result, nil
+	// Trace the call where the RPC supports it, otherwise fall back to eth_call
+	frame, err := s.traceCall(ctx, msg, blockNumber)
+	if err == nil {
+		result.applyTrace(frame)
+		if diff, err := s.traceStateDiff(ctx, msg, blockNumber); err == nil {
+			result.applyStateDiff(diff)
+		}
+		if result.Error != "" {
+			return result, nil
+		}
+	} else {
+		result.TraceError = err.Error()
+		_, err = call(ctx, func(ctx context.Context) ([]byte, error) {
+			return s.client.CallContract(ctx, msg, big.NewInt(int64(blockNumber)))
+		})
+		if err != nil && !answered(err) {
+			return nil, fmt.Errorf("failed to call contract: %w", err)
+		}
+		if err != nil {
+			result.Success = false
+			result.Error = err.Error()
+			result.RevertReason = DecodeRevert(revertData(err))
+			return result, nil
+		}
 	}
 
 	// Get gas price
-	gasPrice, err := s.client.SuggestGasPrice(ctx)
+	gasPrice, err := call(ctx, s.client.SuggestGasPrice)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get gas price: %v", err)
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
 	}
 
 	// Estimate gas
-	gasLimit, err := s.client.EstimateGas(ctx, msg)
+	gasLimit, err := call(ctx, func(ctx context.Context) (uint64, error) {
+		return s.client.EstimateGas(ctx, msg)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to estimate gas: %v", err)
+		return nil, fmt.Errorf("failed to estimate gas: %w", err)
 	}
 
 	// Calculate total cost
 	totalCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
 
+	// Rollups also charge for posting the transaction to L1
+	if s.l1Fees != "" {
+		l1Fee, included, err := s.l1Fee(ctx, tx, msg, gasPrice)
+		if err != nil {
+			return nil, err
+		}
+		if !included {
+			totalCost.Add(totalCost, l1Fee)
+		}
+		result.L1Fee = l1Fee
+	}
+
 	result.Success = true
 	result.GasUsed = gasLimit
 	result.GasPrice = gasPrice
 	result.TotalCost = totalCost
 
+	// Net balance changes need the trace of internal calls and events
+	if result.Traced {
+		result.Effects = computeEffects(tx.From, result.Calls, totalCost)
+		result.Effects.describeTokens(ctx, s.client, new(big.Int).SetUint64(blockNumber))
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Put(payloadHash, blockNumber, result); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
+// PendingNonce returns the next nonce for an address, including pending transactions
+func (s *Simulator) PendingNonce(ctx context.Context, address common.Address) (uint64, error) {
+	nonce, err := call(ctx, func(ctx context.Context) (uint64, error) {
+		return s.client.PendingNonceAt(ctx, address)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// BlockNumber returns the number of the latest block
+func (s *Simulator) BlockNumber(ctx context.Context) (uint64, error) {
+	blockNumber, err := call(ctx, s.client.BlockNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block number: %w", err)
+	}
+	return blockNumber, nil
+}
+
+// ChainID returns the chain ID reported by the RPC endpoint
+func (s *Simulator) ChainID(ctx context.Context) (*big.Int, error) {
+	chainID, err := call(ctx, s.client.ChainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	return chainID, nil
+}
+
 // GetGasPrice returns the current gas price
 func (s *Simulator) GetGasPrice(ctx context.Context) (*big.Int, error) {
-	gasPrice, err := s.client.SuggestGasPrice(ctx)
+	gasPrice, err := call(ctx, s.client.SuggestGasPrice)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get gas price: %v", err)
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
 	}
 	return gasPrice, nil
 }
 
-// GetGasPriceHistory returns historical gas prices
+// GetGasPriceHistory returns the base fees of the latest blocks, oldest first.
+// Blocks before EIP-1559 report a base fee of zero.
 func (s *Simulator) GetGasPriceHistory(ctx context.Context, blocks int) ([]*big.Int, error) {
-	// Get current block number
-	currentBlock, err := s.client.BlockNumber(ctx)
+	history, err := call(ctx, func(ctx context.Context) (*ethereum.FeeHistory, error) {
+		return s.client.FeeHistory(ctx, uint64(blocks), nil, nil)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get block number: %v", err)
+		return nil, fmt.Errorf("failed to get fee history: %w", err)
 	}
 
-	var prices []*big.Int
-	for i := 0; i < blocks; i++ {
-		blockNumber := currentBlock - uint64(i)
-		block, err := s.client.BlockByNumber(ctx, big.NewInt(int64(blockNumber)))
-		if err != nil {
-			return nil, fmt.Errorf("failed to get block %d: %v", blockNumber, err)
-		}
-
-		// Get base fee if available (EIP-1559)
-		if block.BaseFee() != nil {
-			prices = append(prices, block.BaseFee())
-		} else {
-			// Fallback to gas price from the first transaction
-			if len(block.Transactions()) > 0 {
-				prices = append(prices, block.Transactions()[0].GasPrice())
-			}
-		}
+	// The last base fee is the projection for the next block
+	if len(history.BaseFee) == 0 {
+		return nil, nil
 	}
-
-	return prices, nil
+	return history.BaseFee[:len(history.BaseFee)-1], nil
 }
 
 // Close closes the RPC connection
 func (s *Simulator) Close() {
-	if s.client != nil {
+	if s.client != nil && !s.pooled {
 		s.client.Close()
 	}
+	if s.tracer != nil {
+		s.tracer.Close()
+	}
 }
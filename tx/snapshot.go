@@ -0,0 +1,337 @@
+package tx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// AccountSnapshot captures the on-chain state of an address
+type AccountSnapshot struct {
+	Address    common.Address `json:"address"`
+	Balance    *big.Int       `json:"balance"`
+	Nonce      uint64         `json:"nonce"`
+	CodeHash   common.Hash    `json:"codeHash"`
+	IsContract bool           `json:"isContract"`
+}
+
+// TokenSnapshot captures ERC-20 token metadata
+type TokenSnapshot struct {
+	Address  common.Address `json:"address"`
+	Name     string         `json:"name"`
+	Symbol   string         `json:"symbol"`
+	Decimals uint8          `json:"decimals"`
+}
+
+// Snapshot is a signed record of chain data captured online for use by an offline signer
+type Snapshot struct {
+	Chain       string            `json:"chain"`
+	ChainID     *big.Int          `json:"chainId"`
+	BlockNumber uint64            `json:"blockNumber"`
+	BlockHash   common.Hash       `json:"blockHash"`
+	BlockTime   time.Time         `json:"blockTime"`
+	BaseFee     *big.Int          `json:"baseFee,omitempty"`
+	GasPrice    *big.Int          `json:"gasPrice"`
+	GasTipCap   *big.Int          `json:"gasTipCap,omitempty"`
+	Accounts    []AccountSnapshot `json:"accounts"`
+	Tokens      []TokenSnapshot   `json:"tokens,omitempty"`
+	Verified    bool              `json:"verified,omitempty"`
+	Signer      common.Address    `json:"signer"`
+	Signature   string            `json:"signature"`
+}
+
+// TakeSnapshot captures chain data for the given addresses and tokens at the latest block
+func TakeSnapshot(ctx context.Context, rpcURL, chain string, addresses, tokens []common.Address) (*Snapshot, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+
+	return takeSnapshot(ctx, client, chain, header, addresses, tokens)
+}
+
+// TakeVerifiedSnapshot captures chain data at the finalized block and checks
+// every account against a Merkle proof under a header verified by the light client
+func TakeVerifiedSnapshot(ctx context.Context, lc *LightClient, rpcURL, chain string, addresses, tokens []common.Address) (*Snapshot, error) {
+	header, err := lc.FinalizedHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	snapshot, err := takeSnapshot(ctx, client, chain, header, addresses, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, account := range snapshot.Accounts {
+		verified, err := lc.Account(ctx, header, account.Address)
+		if err != nil {
+			return nil, err
+		}
+		if verified.Balance.Cmp(account.Balance) != 0 || verified.Nonce != account.Nonce || verified.CodeHash != account.CodeHash {
+			return nil, fmt.Errorf("RPC state of %s does not match its proof (balance %s, nonce %d; proven balance %s, nonce %d)",
+				account.Address.Hex(), account.Balance, account.Nonce, verified.Balance, verified.Nonce)
+		}
+		snapshot.Accounts[i] = *verified
+	}
+
+	snapshot.Verified = true
+	return snapshot, nil
+}
+
+// takeSnapshot captures chain data for the given addresses and tokens at the given header
+func takeSnapshot(ctx context.Context, client *ethclient.Client, chain string, header *types.Header, addresses, tokens []common.Address) (*Snapshot, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %v", err)
+	}
+
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %v", err)
+	}
+
+	snapshot := &Snapshot{
+		Chain:       chain,
+		ChainID:     chainID,
+		BlockNumber: header.Number.Uint64(),
+		BlockHash:   header.Hash(),
+		BlockTime:   time.Unix(int64(header.Time), 0).UTC(),
+		BaseFee:     header.BaseFee,
+		GasPrice:    gasPrice,
+	}
+
+	// Tip cap is only available on EIP-1559 chains
+	if header.BaseFee != nil {
+		if tip, err := client.SuggestGasTipCap(ctx); err == nil {
+			snapshot.GasTipCap = tip
+		}
+	}
+
+	// Pin every query to the same block so the snapshot is consistent
+	for _, address := range addresses {
+		balance, err := client.BalanceAt(ctx, address, header.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance of %s: %v", address.Hex(), err)
+		}
+		nonce, err := client.NonceAt(ctx, address, header.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get nonce of %s: %v", address.Hex(), err)
+		}
+		code, err := client.CodeAt(ctx, address, header.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get code of %s: %v", address.Hex(), err)
+		}
+
+		snapshot.Accounts = append(snapshot.Accounts, AccountSnapshot{
+			Address:    address,
+			Balance:    balance,
+			Nonce:      nonce,
+			CodeHash:   crypto.Keccak256Hash(code),
+			IsContract: len(code) > 0,
+		})
+	}
+
+	for _, token := range tokens {
+		metadata, err := tokenMetadata(ctx, client, token, header.Number)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Tokens = append(snapshot.Tokens, *metadata)
+	}
+
+	return snapshot, nil
+}
+
+// FetchTokenMetadata reads the ERC-20 name, symbol and decimals of a token at the latest block
+func FetchTokenMetadata(ctx context.Context, rpcURL string, token common.Address) (*TokenSnapshot, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return tokenMetadata(ctx, client, token, nil)
+}
+
+// FetchTokenMetadataAt reads the ERC-20 name, symbol and decimals of a token at
+// the given block, or at the latest block if number is 0, and returns the block used
+func FetchTokenMetadataAt(ctx context.Context, rpcURL string, token common.Address, number uint64) (*TokenSnapshot, *BlockRef, error) {
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.Close()
+
+	var block *big.Int
+	if number != 0 {
+		block = new(big.Int).SetUint64(number)
+	}
+	header, err := client.HeaderByNumber(ctx, block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get block header: %v", err)
+	}
+
+	metadata, err := tokenMetadata(ctx, client, token, header.Number)
+	if err != nil {
+		return nil, nil, err
+	}
+	return metadata, &BlockRef{Number: header.Number.Uint64(), Hash: header.Hash()}, nil
+}
+
+// tokenMetadata reads the ERC-20 name, symbol and decimals of a token
+func tokenMetadata(ctx context.Context, client *ethclient.Client, token common.Address, block *big.Int) (*TokenSnapshot, error) {
+	call := func(method string) ([]interface{}, error) {
+		input, err := core.EncodeERC20Call(method)
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: input}, block)
+		if err != nil {
+			return nil, err
+		}
+		return core.DecodeERC20Result(method, output)
+	}
+
+	metadata := &TokenSnapshot{Address: token}
+	for _, method := range []string{"name", "symbol", "decimals"} {
+		values, err := call(method)
+		if err != nil || len(values) == 0 {
+			return nil, fmt.Errorf("failed to get %s of token %s: %v", method, token.Hex(), err)
+		}
+		switch method {
+		case "name":
+			metadata.Name, _ = values[0].(string)
+		case "symbol":
+			metadata.Symbol, _ = values[0].(string)
+		case "decimals":
+			metadata.Decimals, _ = values[0].(uint8)
+		}
+	}
+
+	return metadata, nil
+}
+
+// digest returns the hash the snapshot signature commits to
+func (s *Snapshot) digest() (common.Hash, error) {
+	unsigned := *s
+	unsigned.Signature = ""
+
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to marshal snapshot: %v", err)
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
+// Sign signs the snapshot contents with the given key
+func (s *Snapshot) Sign(privateKey *ecdsa.PrivateKey) error {
+	s.Signer = crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	hash, err := s.digest()
+	if err != nil {
+		return err
+	}
+
+	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign snapshot: %v", err)
+	}
+	s.Signature = fmt.Sprintf("0x%x", signature)
+	return nil
+}
+
+// Verify checks the snapshot signature and returns the signer address
+func (s *Snapshot) Verify() (common.Address, error) {
+	hash, err := s.digest()
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	pubKey, err := crypto.SigToPub(hash.Bytes(), common.FromHex(s.Signature))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover snapshot signer: %v", err)
+	}
+
+	signer := crypto.PubkeyToAddress(*pubKey)
+	if signer != s.Signer {
+		return common.Address{}, fmt.Errorf("snapshot signature does not match signer %s", s.Signer.Hex())
+	}
+	return signer, nil
+}
+
+// Account returns the snapshot of an address, if it was captured
+func (s *Snapshot) Account(address common.Address) (*AccountSnapshot, bool) {
+	for i := range s.Accounts {
+		if s.Accounts[i].Address == address {
+			return &s.Accounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// Token returns the metadata of a token, if it was captured
+func (s *Snapshot) Token(address common.Address) (*TokenSnapshot, bool) {
+	for i := range s.Tokens {
+		if s.Tokens[i].Address == address {
+			return &s.Tokens[i], true
+		}
+	}
+	return nil, false
+}
+
+// SaveSnapshot writes a snapshot to a JSON file
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+
+	return nil
+}
+
+// LoadSnapshot reads a snapshot file and verifies its signature
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %v", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %v", err)
+	}
+
+	if _, err := snapshot.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,224 @@
+package tx
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SpendingReport aggregates the transactions sent by one address on one chain.
+// Value counts confirmed transactions only; fees count every mined one,
+// failed transactions included.
+type SpendingReport struct {
+	Key            string         `json:"key,omitempty"`
+	From           string         `json:"from"`
+	ChainID        string         `json:"chainId"`
+	Transactions   int            `json:"transactions"`
+	Confirmed      int            `json:"confirmed"`
+	Failed         int            `json:"failed"`
+	Pending        int            `json:"pending"`
+	FailureRate    float64        `json:"failureRate"`
+	Value          *big.Int       `json:"value"`
+	Fees           *big.Int       `json:"fees"`
+	Counterparties []Counterparty `json:"counterparties"`
+	// Fiat holds the value and fees by currency, each transaction priced on
+	// its own day
+	Fiat map[string]*FiatTotal `json:"fiat,omitempty"`
+}
+
+// FiatTotal sums the value and fees of a sender's transactions in a currency
+type FiatTotal struct {
+	Value float64 `json:"value"`
+	Fees  float64 `json:"fees"`
+}
+
+// Counterparty is a recipient of a sender's transactions
+type Counterparty struct {
+	Address      string   `json:"address"`
+	Transactions int      `json:"transactions"`
+	Value        *big.Int `json:"value"`
+}
+
+// spendingColumns are the CSV columns of a spending report
+var spendingColumns = []string{
+	"key", "from", "chain_id", "counterparty", "transactions", "confirmed",
+	"failed", "pending", "failure_rate", "value", "fees",
+}
+
+// BuildSpendingReports aggregates records per sender and chain. keys names
+// the senders to report on by address, and gives their key names; records of
+// other senders are ignored unless keys is empty. Replaced records are left
+// out, since their replacement carries the nonce. With fiat values the
+// reports also sum the value and fees in each currency.
+func BuildSpendingReports(records []*TransactionRecord, keys map[string]string, values *FiatValues) []*SpendingReport {
+	reports := make(map[string]*SpendingReport)
+	counterparties := make(map[string]map[string]*Counterparty)
+	for _, record := range records {
+		from := strings.ToLower(record.From)
+		key, ok := keys[from]
+		if (len(keys) > 0 && !ok) || record.Status == StatusReplaced {
+			continue
+		}
+
+		group := from + ":" + record.ChainID
+		report, ok := reports[group]
+		if !ok {
+			report = &SpendingReport{Key: key, From: record.From, ChainID: record.ChainID, Value: new(big.Int), Fees: new(big.Int)}
+			reports[group] = report
+			counterparties[group] = make(map[string]*Counterparty)
+		}
+		report.Transactions++
+
+		value, _ := new(big.Int).SetString(record.Value, 10)
+		switch record.Status {
+		case "success":
+			report.Confirmed++
+			if value != nil {
+				report.Value.Add(report.Value, value)
+			}
+		case "failed":
+			report.Failed++
+		default:
+			report.Pending++
+		}
+		if fee := record.Fee(); fee != nil {
+			report.Fees.Add(report.Fees, fee)
+		}
+		// Records on testnets have no fiat value
+		for currency, fiat := range values.Of(record) {
+			if report.Fiat == nil {
+				report.Fiat = make(map[string]*FiatTotal)
+			}
+			total, ok := report.Fiat[currency]
+			if !ok {
+				total = &FiatTotal{}
+				report.Fiat[currency] = total
+			}
+			if record.Status == "success" {
+				total.Value += fiat.Value
+			}
+			if fiat.Fee != nil {
+				total.Fees += *fiat.Fee
+			}
+		}
+
+		to := strings.ToLower(record.To)
+		party, ok := counterparties[group][to]
+		if !ok {
+			party = &Counterparty{Address: record.To, Value: new(big.Int)}
+			counterparties[group][to] = party
+		}
+		party.Transactions++
+		if record.Status == "success" && value != nil {
+			party.Value.Add(party.Value, value)
+		}
+	}
+
+	result := make([]*SpendingReport, 0, len(reports))
+	for group, report := range reports {
+		if mined := report.Confirmed + report.Failed; mined > 0 {
+			report.FailureRate = float64(report.Failed) / float64(mined)
+		}
+		for _, party := range counterparties[group] {
+			report.Counterparties = append(report.Counterparties, *party)
+		}
+		// Largest recipients first
+		sort.Slice(report.Counterparties, func(i, j int) bool {
+			a, b := report.Counterparties[i], report.Counterparties[j]
+			if c := a.Value.Cmp(b.Value); c != 0 {
+				return c > 0
+			}
+			return a.Transactions > b.Transactions
+		})
+		result = append(result, report)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Key != result[j].Key {
+			return result[i].Key < result[j].Key
+		}
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+		return result[i].ChainID < result[j].ChainID
+	})
+	return result
+}
+
+// WriteSpendingCSV writes reports as CSV with amounts in wei: one totals row
+// per sender and chain, followed by a row per counterparty. Each of currencies
+// adds the value and fees in it to the totals rows.
+func WriteSpendingCSV(w io.Writer, reports []*SpendingReport, currencies []string) error {
+	writer := csv.NewWriter(w)
+	columns := spendingColumns
+	if len(currencies) > 0 {
+		columns = append([]string(nil), spendingColumns...)
+		for _, currency := range currencies {
+			c := strings.ToLower(currency)
+			columns = append(columns, "value_"+c, "fees_"+c)
+		}
+	}
+	if err := writer.Write(columns); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+
+	for _, report := range reports {
+		rows := [][]string{{
+			report.Key,
+			report.From,
+			report.ChainID,
+			"",
+			strconv.Itoa(report.Transactions),
+			strconv.Itoa(report.Confirmed),
+			strconv.Itoa(report.Failed),
+			strconv.Itoa(report.Pending),
+			strconv.FormatFloat(report.FailureRate, 'f', 4, 64),
+			report.Value.String(),
+			report.Fees.String(),
+		}}
+		for _, currency := range currencies {
+			if total, ok := report.Fiat[currency]; ok {
+				rows[0] = append(rows[0], formatFiat(total.Value), formatFiat(total.Fees))
+			} else {
+				rows[0] = append(rows[0], "", "")
+			}
+		}
+		for _, party := range report.Counterparties {
+			row := []string{
+				report.Key, report.From, report.ChainID, party.Address,
+				strconv.Itoa(party.Transactions), "", "", "", "", party.Value.String(), "",
+			}
+			for range currencies {
+				row = append(row, "", "")
+			}
+			rows = append(rows, row)
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %v", err)
+	}
+	return nil
+}
+
+// WriteSpendingJSON writes reports as an indented JSON array
+func WriteSpendingJSON(w io.Writer, reports []*SpendingReport) error {
+	if reports == nil {
+		reports = []*SpendingReport{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reports); err != nil {
+		return fmt.Errorf("failed to write JSON: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// transferTopic is the topic of the ERC-20 and ERC-721 Transfer event
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// CallFrame is one call of a callTracer trace
+type CallFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to,omitempty"`
+	Value        *hexutil.Big    `json:"value,omitempty"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Calls        []CallFrame     `json:"calls,omitempty"`
+	Logs         []CallLog       `json:"logs,omitempty"`
+}
+
+// CallLog is an event emitted during a traced call
+type CallLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// TokenTransfer is an ERC-20 or ERC-721 Transfer event of a traced call.
+// ERC-721 transfers carry a TokenID instead of a Value.
+type TokenTransfer struct {
+	Token   common.Address `json:"token"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *big.Int       `json:"value,omitempty"`
+	TokenID *big.Int       `json:"tokenId,omitempty"`
+}
+
+// prestateAccount is an account of a prestateTracer diff
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// prestateDiff is the result of the prestateTracer in diff mode
+type prestateDiff struct {
+	Pre  map[common.Address]*prestateAccount `json:"pre"`
+	Post map[common.Address]*prestateAccount `json:"post"`
+}
+
+// SetTraceRPC sends debug_traceCall requests to a separate endpoint, e.g. a
+// Tenderly or archive node, instead of the simulation RPC
+func (s *Simulator) SetTraceRPC(rpcURL string) error {
+	client, err := dial(context.Background(), rpcURL)
+	if err != nil {
+		return err
+	}
+	s.tracer = client
+	return nil
+}
+
+// traceCall runs debug_traceCall with the callTracer, including logs
+func (s *Simulator) traceCall(ctx context.Context, msg ethereum.CallMsg, block uint64) (*CallFrame, error) {
+	var frame CallFrame
+	config := map[string]interface{}{
+		"tracer":       "callTracer",
+		"tracerConfig": map[string]interface{}{"withLog": true},
+	}
+	if err := s.traceClient().CallContext(ctx, &frame, "debug_traceCall", callArgs(msg), hexutil.EncodeUint64(block), config); err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// traceStateDiff runs debug_traceCall with the prestateTracer in diff mode
+func (s *Simulator) traceStateDiff(ctx context.Context, msg ethereum.CallMsg, block uint64) (*prestateDiff, error) {
+	var diff prestateDiff
+	config := map[string]interface{}{
+		"tracer":       "prestateTracer",
+		"tracerConfig": map[string]interface{}{"diffMode": true},
+	}
+	if err := s.traceClient().CallContext(ctx, &diff, "debug_traceCall", callArgs(msg), hexutil.EncodeUint64(block), config); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// traceClient returns the RPC client used for tracing
+func (s *Simulator) traceClient() *rpc.Client {
+	if s.tracer != nil {
+		return s.tracer.Client()
+	}
+	return s.client.Client()
+}
+
+// callArgs converts a call message to the JSON arguments of eth_call
+func callArgs(msg ethereum.CallMsg) map[string]interface{} {
+	args := map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+	}
+	if len(msg.Data) > 0 {
+		args["input"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		args["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		args["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	if msg.GasPrice != nil {
+		args["gasPrice"] = (*hexutil.Big)(msg.GasPrice)
+	}
+	return args
+}
+
+// applyTrace fills a simulation result from a call trace
+func (result *SimulationResult) applyTrace(frame *CallFrame) {
+	result.Traced = true
+	result.Calls = frame
+	result.Trace = FormatCallTrace(frame, nil, nil)
+	result.TokenTransfers = TokenTransfers(frame)
+	result.GasUsed = uint64(frame.GasUsed)
+
+	if frame.Error != "" {
+		result.Success = false
+		result.Error = frame.Error
+		result.RevertReason = frame.RevertReason
+		if result.RevertReason == "" {
+			result.RevertReason = DecodeRevert(frame.Output)
+		}
+	}
+}
+
+// applyStateDiff fills the state changes of a simulation result from a
+// prestateTracer diff. Keys name the account and the field that changes.
+func (result *SimulationResult) applyStateDiff(diff *prestateDiff) {
+	changes := make(map[string]string)
+	for address, pre := range diff.Pre {
+		post, ok := diff.Post[address]
+		if !ok {
+			// Accounts only in pre were destroyed
+			changes[address.Hex()] = "deleted"
+			continue
+		}
+		if post.Balance != nil && (pre.Balance == nil || pre.Balance.ToInt().Cmp(post.Balance.ToInt()) != 0) {
+			changes[address.Hex()+" balance"] = formatChange(pre.Balance, post.Balance)
+		}
+		if post.Nonce != 0 && post.Nonce != pre.Nonce {
+			changes[address.Hex()+" nonce"] = fmt.Sprintf("%d -> %d", pre.Nonce, post.Nonce)
+		}
+		if len(post.Code) > 0 {
+			changes[address.Hex()+" code"] = fmt.Sprintf("%d -> %d bytes", len(pre.Code), len(post.Code))
+		}
+		// Slots cleared to zero are left out of post
+		for slot, old := range pre.Storage {
+			changes[fmt.Sprintf("%s storage[%s]", address.Hex(), slot.Hex())] = old.Hex() + " -> " + post.Storage[slot].Hex()
+		}
+		for slot, value := range post.Storage {
+			if _, ok := pre.Storage[slot]; !ok {
+				changes[fmt.Sprintf("%s storage[%s]", address.Hex(), slot.Hex())] = common.Hash{}.Hex() + " -> " + value.Hex()
+			}
+		}
+	}
+	for address, post := range diff.Post {
+		if _, ok := diff.Pre[address]; ok {
+			continue
+		}
+		changes[address.Hex()] = "created"
+		if post.Balance != nil {
+			changes[address.Hex()+" balance"] = formatChange(nil, post.Balance)
+		}
+		for slot, value := range post.Storage {
+			changes[fmt.Sprintf("%s storage[%s]", address.Hex(), slot.Hex())] = common.Hash{}.Hex() + " -> " + value.Hex()
+		}
+	}
+	result.StateChanges = changes
+}
+
+// formatChange formats a balance change in wei
+func formatChange(old, updated *hexutil.Big) string {
+	format := func(value *hexutil.Big) string {
+		if value == nil {
+			return "0"
+		}
+		return value.ToInt().String()
+	}
+	return format(old) + " -> " + format(updated)
+}
+
+// revertData extracts the revert data of a failed eth_call
+func revertData(err error) []byte {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil
+	}
+	data, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil
+	}
+	return common.FromHex(data)
+}
+
+// DecodeRevert decodes revert data into a readable reason. Error(string) and
+// Panic(uint256) are decoded; custom errors are shown by their selector.
+func DecodeRevert(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	return fmt.Sprintf("custom error 0x%x", data[:4])
+}
+
+// EventLogs collects the logs of a call trace in emission order
+func EventLogs(frame *CallFrame) []CallLog {
+	var logs []CallLog
+	var walk func(frame *CallFrame)
+	walk = func(frame *CallFrame) {
+		// Events of reverted calls never happen
+		if frame.Error != "" {
+			return
+		}
+		logs = append(logs, frame.Logs...)
+		for i := range frame.Calls {
+			walk(&frame.Calls[i])
+		}
+	}
+	walk(frame)
+	return logs
+}
+
+// TokenTransfers collects the Transfer events of a call trace in order
+func TokenTransfers(frame *CallFrame) []TokenTransfer {
+	var transfers []TokenTransfer
+	for _, log := range EventLogs(frame) {
+		if len(log.Topics) < 3 || log.Topics[0] != transferTopic {
+			continue
+		}
+		transfer := TokenTransfer{
+			Token: log.Address,
+			From:  common.BytesToAddress(log.Topics[1].Bytes()),
+			To:    common.BytesToAddress(log.Topics[2].Bytes()),
+		}
+		switch {
+		case len(log.Topics) == 4:
+			transfer.TokenID = log.Topics[3].Big()
+		case len(log.Data) == 32:
+			transfer.Value = new(big.Int).SetBytes(log.Data)
+		default:
+			continue
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers
+}
+
+// FormatCallTrace renders a call trace as an indented tree. label names the
+// function of a call's input; without it the selector is shown. name formats
+// the called addresses; without it they are shown bare.
+func FormatCallTrace(frame *CallFrame, label func(input []byte) string, name func(common.Address) string) []string {
+	var lines []string
+	var walk func(frame *CallFrame, depth int)
+	walk = func(frame *CallFrame, depth int) {
+		to := "(create)"
+		if frame.To != nil {
+			to = frame.To.Hex()
+			if name != nil {
+				to = name(*frame.To)
+			}
+		}
+
+		function := ""
+		if len(frame.Input) >= 4 && !strings.HasPrefix(frame.Type, "CREATE") {
+			if label != nil {
+				function = label(frame.Input)
+			}
+			if function == "" {
+				function = fmt.Sprintf("0x%x", frame.Input[:4])
+			}
+		}
+
+		line := fmt.Sprintf("%s%s %s", strings.Repeat("  ", depth), frame.Type, to)
+		if function != "" {
+			line += " " + function
+		}
+		if frame.Value != nil && frame.Value.ToInt().Sign() > 0 {
+			line += fmt.Sprintf(" value %s", frame.Value.ToInt())
+		}
+		line += fmt.Sprintf(" gas %d", uint64(frame.GasUsed))
+		if frame.Error != "" {
+			line += " [" + frame.Error
+			reason := frame.RevertReason
+			if reason == "" {
+				reason = DecodeRevert(frame.Output)
+			}
+			if reason != "" {
+				line += ": " + reason
+			}
+			line += "]"
+		}
+		lines = append(lines, line)
+
+		for i := range frame.Calls {
+			walk(&frame.Calls[i], depth+1)
+		}
+	}
+	walk(frame, 0)
+	return lines
+}
+
+// SortedStateChanges returns the keys of state changes in a stable order
+func SortedStateChanges(changes map[string]string) []string {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
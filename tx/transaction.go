@@ -19,16 +19,17 @@ type Transaction struct {
 	ChainID  *big.Int        `json:"chainId"`
 }
 
-// ToEthereumTx converts the Transaction to an Ethereum types.Transaction
+// ToEthereumTx converts the Transaction to an Ethereum types.Transaction; a
+// nil To deploys Data as init code
 func (t *Transaction) ToEthereumTx() *types.Transaction {
-	return types.NewTransaction(
-		t.Nonce,
-		*t.To,
-		t.Value,
-		t.Gas,
-		t.GasPrice,
-		t.Data,
-	)
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    t.Nonce,
+		GasPrice: t.GasPrice,
+		Gas:      t.Gas,
+		To:       t.To,
+		Value:    t.Value,
+		Data:     t.Data,
+	})
 }
 
 // FromEthereumTx creates a Transaction from an Ethereum types.Transaction
@@ -3,6 +3,9 @@ package tx
 import (
 	"fmt"
 	"math/big"
+
+	"github.com/aryehky/gosignervaultcli/core"
+	"github.com/ethereum/go-ethereum/core/types"
 )
 
 // ValidationError represents a transaction validation error
@@ -71,11 +74,11 @@ func (v *Validator) ValidateTransaction(tx *Transaction) []ValidationError {
 		})
 	}
 
-	// Validate address
-	if tx.To == nil {
+	// Validate address; only contract deployments have no recipient
+	if tx.To == nil && len(tx.Data) == 0 {
 		errors = append(errors, ValidationError{
 			Field:   "to",
-			Message: "recipient address is required",
+			Message: "recipient address or init code to deploy is required",
 		})
 	}
 
@@ -106,3 +109,37 @@ func (v *Validator) SetValueLimits(min, max *big.Int) {
 	v.MinValue = min
 	v.MaxValue = max
 }
+
+// ValidateForChain checks that the chain accepts the type and fees of a
+// transaction according to its capabilities
+func (v *Validator) ValidateForChain(transaction *types.Transaction, chain *core.ChainConfig) []ValidationError {
+	var errors []ValidationError
+
+	// Unsigned and pre-EIP-155 legacy transactions carry no chain ID
+	if transaction.Protected() && transaction.ChainId().Cmp(chain.ChainID) != 0 {
+		errors = append(errors, ValidationError{
+			Field:   "chainId",
+			Message: fmt.Sprintf("transaction is for chain ID %s, not %s (%s)", transaction.ChainId(), chain.ChainID, chain.Name),
+		})
+	}
+
+	switch {
+	case chain.LegacyOnly && transaction.Type() != types.LegacyTxType:
+		errors = append(errors, ValidationError{
+			Field:   "type",
+			Message: fmt.Sprintf("%s only accepts legacy transactions, not type %d", chain.Name, transaction.Type()),
+		})
+	case transaction.Type() == types.DynamicFeeTxType && !chain.DynamicFees():
+		errors = append(errors, ValidationError{
+			Field:   "type",
+			Message: fmt.Sprintf("%s does not support EIP-1559 fees; use a gas price", chain.Name),
+		})
+	case transaction.Type() == types.BlobTxType && !chain.SupportsBlobs:
+		errors = append(errors, ValidationError{
+			Field:   "type",
+			Message: fmt.Sprintf("%s does not support blob transactions", chain.Name),
+		})
+	}
+
+	return errors
+}
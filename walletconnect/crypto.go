@@ -0,0 +1,89 @@
+// Package walletconnect is the wallet side of the WalletConnect v2 sign
+// protocol: it pairs with a dapp over the relay, settles a session and passes
+// the dapp's requests to a handler
+package walletconnect
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// envelopeSymmetric is the envelope type of messages sealed with the topic's
+// symmetric key
+const envelopeSymmetric = 0
+
+// topicOf returns the topic of a symmetric key: hex(sha256(key))
+func topicOf(symKey []byte) string {
+	sum := sha256.Sum256(symKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// deriveSymKey derives the symmetric key of a session from an X25519 key
+// agreement, with HKDF-SHA256 and no salt or info
+func deriveSymKey(private *ecdh.PrivateKey, peerPublic []byte) ([]byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer public key: %v", err)
+	}
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement failed: %v", err)
+	}
+	symKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, nil), symKey); err != nil {
+		return nil, err
+	}
+	return symKey, nil
+}
+
+// seal encrypts a message with ChaCha20-Poly1305 into a base64 type 0 envelope
+func seal(symKey, message []byte) (string, error) {
+	aead, err := chacha20poly1305.New(symKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, chacha20poly1305.NonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	envelope := append([]byte{envelopeSymmetric}, iv...)
+	envelope = aead.Seal(envelope, iv, message, nil)
+	return base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+// open decrypts a base64 type 0 envelope. Type 1 envelopes only carry
+// messages to wallets that announced a public key, which this one never does.
+func open(symKey []byte, encoded string) ([]byte, error) {
+	envelope, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope: %v", err)
+	}
+	if len(envelope) == 0 {
+		return nil, errors.New("empty envelope")
+	}
+	if envelope[0] != envelopeSymmetric {
+		return nil, fmt.Errorf("unsupported envelope type %d", envelope[0])
+	}
+	body := envelope[1:]
+	if len(body) < chacha20poly1305.NonceSize {
+		return nil, errors.New("truncated envelope")
+	}
+	aead, err := chacha20poly1305.New(symKey)
+	if err != nil {
+		return nil, err
+	}
+	message, err := aead.Open(nil, body[:chacha20poly1305.NonceSize], body[chacha20poly1305.NonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt message")
+	}
+	return message, nil
+}
@@ -0,0 +1,294 @@
+package walletconnect
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultRelayURL is the public WalletConnect relay
+const DefaultRelayURL = "wss://relay.walletconnect.com"
+
+const (
+	// authLifetime is how long a relay auth token is valid
+	authLifetime = 24 * time.Hour
+	// pingInterval keeps the relay connection alive between requests
+	pingInterval = 30 * time.Second
+	// callTimeout bounds a relay call that gets no answer
+	callTimeout = 30 * time.Second
+)
+
+// ErrRelayClosed is returned once the relay connection is lost
+var ErrRelayClosed = errors.New("relay connection closed")
+
+// message is a message the relay delivered on a subscribed topic
+type message struct {
+	Topic   string
+	Message string
+}
+
+// rpcMessage is a JSON-RPC request, response or notification
+type rpcMessage struct {
+	ID      int64           `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// relay is a connection to a WalletConnect relay
+type relay struct {
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	pending  map[int64]chan *rpcMessage
+	messages chan message
+	done     chan struct{}
+	err      error
+}
+
+// dialRelay connects to a relay, authenticating with a fresh client key
+func dialRelay(ctx context.Context, relayURL, projectID string, dialer *websocket.Dialer) (*relay, error) {
+	token, err := authToken(relayURL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay URL %q: %v", relayURL, err)
+	}
+	query := u.Query()
+	query.Set("auth", token)
+	query.Set("projectId", projectID)
+	u.RawQuery = query.Encode()
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to relay %s: %v (HTTP %s)", u.Host, err, resp.Status)
+		}
+		return nil, fmt.Errorf("failed to connect to relay %s: %v", u.Host, err)
+	}
+	r := &relay{
+		conn:     conn,
+		pending:  make(map[int64]chan *rpcMessage),
+		messages: make(chan message, 64),
+		done:     make(chan struct{}),
+	}
+	go r.read()
+	go r.keepAlive()
+	return r, nil
+}
+
+// read dispatches responses to their calls and acknowledges delivered messages
+func (r *relay) read() {
+	var err error
+	defer func() { r.close(err) }()
+	for {
+		var msg rpcMessage
+		if err = r.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Method == "" {
+			r.mu.Lock()
+			reply, ok := r.pending[msg.ID]
+			delete(r.pending, msg.ID)
+			r.mu.Unlock()
+			if ok {
+				reply <- &msg
+			}
+			continue
+		}
+		if msg.Method != "irn_subscription" {
+			continue
+		}
+		var params struct {
+			Data struct {
+				Topic   string `json:"topic"`
+				Message string `json:"message"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(msg.Params, &params) != nil {
+			continue
+		}
+		if err = r.write(&rpcMessage{ID: msg.ID, JSONRPC: "2.0", Result: json.RawMessage("true")}); err != nil {
+			return
+		}
+		select {
+		case r.messages <- message{Topic: params.Data.Topic, Message: params.Data.Message}:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// keepAlive pings the relay so idle connections are not dropped
+func (r *relay) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.writeMu.Lock()
+			err := r.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			r.writeMu.Unlock()
+			if err != nil {
+				r.close(err)
+				return
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *relay) write(msg *rpcMessage) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	return r.conn.WriteJSON(msg)
+}
+
+// call sends a request to the relay and waits for its result
+func (r *relay) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	id := newID()
+	reply := make(chan *rpcMessage, 1)
+	r.mu.Lock()
+	r.pending[id] = reply
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	if err := r.write(&rpcMessage{ID: id, JSONRPC: "2.0", Method: method, Params: encoded}); err != nil {
+		r.close(err)
+		return nil, ErrRelayClosed
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return nil, fmt.Errorf("relay refused %s: %v", method, msg.Error)
+		}
+		return msg.Result, nil
+	case <-r.done:
+		return nil, ErrRelayClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("relay did not answer %s: %v", method, ctx.Err())
+	}
+}
+
+// subscribe asks the relay to deliver the messages of a topic, including
+// those published before
+func (r *relay) subscribe(ctx context.Context, topic string) error {
+	_, err := r.call(ctx, "irn_subscribe", map[string]string{"topic": topic})
+	return err
+}
+
+// publish sends an encrypted message to a topic. The tag tells the relay
+// which protocol message it is.
+func (r *relay) publish(ctx context.Context, topic, sealed string, tag int, ttl time.Duration) error {
+	_, err := r.call(ctx, "irn_publish", map[string]interface{}{
+		"topic":   topic,
+		"message": sealed,
+		"ttl":     int64(ttl / time.Second),
+		"tag":     tag,
+		"prompt":  false,
+	})
+	return err
+}
+
+// close shuts the connection down, keeping the first error
+func (r *relay) close(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.err = err
+	close(r.done)
+	r.conn.Close()
+}
+
+// authToken returns the JWT the relay authenticates clients with, signed by a
+// new Ed25519 key whose did:key is the client ID
+func authToken(relayURL string) (string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	subject := make([]byte, 32)
+	if _, err := rand.Read(subject); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": "did:key:z" + base58(append([]byte{0xed, 0x01}, public...)),
+		"sub": hex.EncodeToString(subject),
+		"aud": relayURL,
+		"iat": now.Unix(),
+		"exp": now.Add(authLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	signed := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	return signed + "." + encoding.EncodeToString(ed25519.Sign(private, []byte(signed))), nil
+}
+
+// base58 encodes data with the Bitcoin alphabet, as did:key uses it
+func base58(data []byte) string {
+	const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// newID returns a JSON-RPC ID like the WalletConnect SDKs make them: the time
+// in milliseconds followed by three random digits
+func newID() int64 {
+	var random [2]byte
+	rand.Read(random[:])
+	return time.Now().UnixMilli()*1000 + int64(binary.BigEndian.Uint16(random[:])%1000)
+}
@@ -0,0 +1,500 @@
+package walletconnect
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tags of the sign protocol messages, which the relay uses to route them
+const (
+	tagPairingDeleteResponse = 1001
+	tagPairingPingResponse   = 1003
+	tagProposeResponse       = 1101
+	tagSettle                = 1102
+	tagUpdateResponse        = 1105
+	tagExtendResponse        = 1107
+	tagRequestResponse       = 1109
+	tagEventResponse         = 1111
+	tagDelete                = 1112
+	tagDeleteResponse        = 1113
+	tagPingResponse          = 1115
+)
+
+const (
+	// messageTTL is how long the relay keeps a published message
+	messageTTL = 5 * time.Minute
+	// SessionLifetime is how long a settled session lasts
+	SessionLifetime = 7 * 24 * time.Hour
+)
+
+// Error codes of the sign protocol
+const (
+	CodeUserRejected       = 5000
+	CodeUnsupportedChains  = 5100
+	CodeUnsupportedMethods = 5101
+	CodeUserDisconnected   = 6000
+	CodeInternal           = -32000
+)
+
+// Error is a JSON-RPC error sent to or received from the dapp
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Rejected returns the error answering a request the user declined
+func Rejected(message string) *Error {
+	return &Error{Code: CodeUserRejected, Message: message}
+}
+
+// ErrSessionDeleted is returned by Serve once the dapp disconnects
+var ErrSessionDeleted = errors.New("the dapp ended the session")
+
+// Metadata describes a dapp or wallet to its peer. A dapp's metadata is
+// whatever it claims and is not verified.
+type Metadata struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Icons       []string `json:"icons"`
+}
+
+// Namespace is what a dapp asks for or a wallet grants in one chain namespace
+type Namespace struct {
+	Chains   []string `json:"chains,omitempty"`
+	Accounts []string `json:"accounts,omitempty"`
+	Methods  []string `json:"methods"`
+	Events   []string `json:"events"`
+}
+
+// Proposal is a session proposed by a dapp
+type Proposal struct {
+	ID       int64
+	Proposer Metadata
+	// Required and Optional are the namespaces the dapp asked for
+	Required map[string]Namespace
+	Optional map[string]Namespace
+
+	pairingTopic string
+	pairingKey   []byte
+	publicKey    []byte
+}
+
+// EIP155Chains returns the chain IDs of the eip155 namespace, in order of
+// the proposal, separating those the dapp requires
+func (p *Proposal) EIP155Chains() (required, optional []*big.Int, err error) {
+	if required, err = namespaceChains(p.Required); err != nil {
+		return nil, nil, err
+	}
+	if optional, err = namespaceChains(p.Optional); err != nil {
+		return nil, nil, err
+	}
+	for _, key := range sortedKeys(p.Required) {
+		if key != "eip155" && !strings.HasPrefix(key, "eip155:") {
+			return nil, nil, &Error{Code: CodeUnsupportedChains, Message: fmt.Sprintf("unsupported namespace %s", key)}
+		}
+	}
+	return required, optional, nil
+}
+
+// Methods returns the eip155 methods the dapp asked for
+func (p *Proposal) Methods() []string {
+	var methods []string
+	for _, namespaces := range []map[string]Namespace{p.Required, p.Optional} {
+		for key, namespace := range namespaces {
+			if key == "eip155" || strings.HasPrefix(key, "eip155:") {
+				methods = appendMissing(methods, namespace.Methods...)
+			}
+		}
+	}
+	return methods
+}
+
+// namespaceChains returns the eip155 chain IDs of namespaces, which list them
+// under the namespace or name a single chain in the key
+func namespaceChains(namespaces map[string]Namespace) ([]*big.Int, error) {
+	var chains []*big.Int
+	seen := make(map[string]bool)
+	for _, key := range sortedKeys(namespaces) {
+		references := namespaces[key].Chains
+		if strings.HasPrefix(key, "eip155:") {
+			references = append(references, key)
+		} else if key != "eip155" {
+			continue
+		}
+		for _, reference := range references {
+			id, err := ParseChainID(reference)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[id.String()] {
+				seen[id.String()] = true
+				chains = append(chains, id)
+			}
+		}
+	}
+	return chains, nil
+}
+
+// ParseChainID parses a CAIP-2 eip155 chain such as eip155:1
+func ParseChainID(reference string) (*big.Int, error) {
+	id, ok := new(big.Int).SetString(strings.TrimPrefix(reference, "eip155:"), 10)
+	if !strings.HasPrefix(reference, "eip155:") || !ok || id.Sign() <= 0 {
+		return nil, &Error{Code: CodeUnsupportedChains, Message: fmt.Sprintf("unsupported chain %q", reference)}
+	}
+	return id, nil
+}
+
+// Request is a request of the dapp within a session
+type Request struct {
+	ID      int64
+	ChainID *big.Int
+	Method  string
+	Params  json.RawMessage
+	// Expiry is when the dapp stops waiting for the answer; zero if not set
+	Expiry time.Time
+}
+
+// Handler answers a session request with a result, or with an error that is
+// sent to the dapp. An *Error keeps its code.
+type Handler func(ctx context.Context, request *Request) (interface{}, error)
+
+// Client is a wallet connected to a WalletConnect relay
+type Client struct {
+	relay    *relay
+	metadata Metadata
+}
+
+// Dial connects to a relay as a wallet described by metadata
+func Dial(ctx context.Context, relayURL, projectID string, dialer *websocket.Dialer, metadata Metadata) (*Client, error) {
+	if projectID == "" {
+		return nil, errors.New("a WalletConnect project ID is required by the relay")
+	}
+	r, err := dialRelay(ctx, relayURL, projectID, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{relay: r, metadata: metadata}, nil
+}
+
+// Close disconnects from the relay
+func (c *Client) Close() {
+	c.relay.close(nil)
+}
+
+// Pair joins the pairing of a URI and waits for the dapp's session proposal
+func (c *Client) Pair(ctx context.Context, uri *URI) (*Proposal, error) {
+	if !uri.Expiry.IsZero() && time.Now().After(uri.Expiry) {
+		return nil, fmt.Errorf("the pairing URI expired at %s; get a new one from the dapp", uri.Expiry.Format(time.RFC3339))
+	}
+	if err := c.relay.subscribe(ctx, uri.Topic); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := c.next(ctx, uri.Topic, uri.SymKey)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Method != "wc_sessionPropose" {
+			c.answerPairing(ctx, uri, msg)
+			continue
+		}
+		var params struct {
+			Proposer struct {
+				PublicKey string   `json:"publicKey"`
+				Metadata  Metadata `json:"metadata"`
+			} `json:"proposer"`
+			RequiredNamespaces map[string]Namespace `json:"requiredNamespaces"`
+			OptionalNamespaces map[string]Namespace `json:"optionalNamespaces"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid session proposal: %v", err)
+		}
+		publicKey, err := hex.DecodeString(params.Proposer.PublicKey)
+		if err != nil || len(publicKey) != 32 {
+			return nil, errors.New("invalid session proposal: bad proposer public key")
+		}
+		return &Proposal{
+			ID:           msg.ID,
+			Proposer:     params.Proposer.Metadata,
+			Required:     params.RequiredNamespaces,
+			Optional:     params.OptionalNamespaces,
+			pairingTopic: uri.Topic,
+			pairingKey:   uri.SymKey,
+			publicKey:    publicKey,
+		}, nil
+	}
+}
+
+// answerPairing answers pings and deletes that arrive on a pairing topic
+func (c *Client) answerPairing(ctx context.Context, uri *URI, msg *rpcMessage) {
+	switch msg.Method {
+	case "wc_pairingPing":
+		c.respond(ctx, uri.Topic, uri.SymKey, msg.ID, true, nil, tagPairingPingResponse)
+	case "wc_pairingDelete":
+		c.respond(ctx, uri.Topic, uri.SymKey, msg.ID, true, nil, tagPairingDeleteResponse)
+	}
+}
+
+// Reject declines a session proposal
+func (c *Client) Reject(ctx context.Context, proposal *Proposal, reason *Error) error {
+	return c.respond(ctx, proposal.pairingTopic, proposal.pairingKey, proposal.ID, nil, reason, tagProposeResponse)
+}
+
+// Session is a settled session with a dapp
+type Session struct {
+	client *Client
+	topic  string
+	symKey []byte
+	Peer   Metadata
+	Expiry time.Time
+}
+
+// Approve accepts a proposal, granting the eip155 namespace with accounts
+// (CAIP-10, e.g. eip155:1:0xab...), and settles the session
+func (c *Client) Approve(ctx context.Context, proposal *Proposal, chains []*big.Int, accounts, methods, events []string) (*Session, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	symKey, err := deriveSymKey(private, proposal.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{
+		client: c,
+		topic:  topicOf(symKey),
+		symKey: symKey,
+		Peer:   proposal.Proposer,
+		Expiry: time.Now().Add(SessionLifetime).Truncate(time.Second),
+	}
+	if err := c.relay.subscribe(ctx, session.topic); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"relay":              map[string]string{"protocol": "irn"},
+		"responderPublicKey": hex.EncodeToString(private.PublicKey().Bytes()),
+	}
+	if err := c.respond(ctx, proposal.pairingTopic, proposal.pairingKey, proposal.ID, result, nil, tagProposeResponse); err != nil {
+		return nil, err
+	}
+
+	caip2 := make([]string, len(chains))
+	for i, chain := range chains {
+		caip2[i] = "eip155:" + chain.String()
+	}
+	settle, err := json.Marshal(map[string]interface{}{
+		"relay": map[string]string{"protocol": "irn"},
+		"namespaces": map[string]Namespace{
+			"eip155": {Chains: caip2, Accounts: accounts, Methods: methods, Events: events},
+		},
+		"controller": map[string]interface{}{
+			"publicKey": hex.EncodeToString(private.PublicKey().Bytes()),
+			"metadata":  c.metadata,
+		},
+		"expiry":       session.Expiry.Unix(),
+		"pairingTopic": proposal.pairingTopic,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.send(ctx, session.topic, symKey, &rpcMessage{ID: newID(), JSONRPC: "2.0", Method: "wc_sessionSettle", Params: settle}, tagSettle); err != nil {
+		return nil, fmt.Errorf("failed to settle the session: %v", err)
+	}
+	return session, nil
+}
+
+// Serve passes the dapp's requests to handler one at a time and sends back
+// its answers, until ctx is done, the session expires or the dapp ends it
+func (s *Session) Serve(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithDeadline(ctx, s.Expiry)
+	defer cancel()
+	c := s.client
+	answered := make(map[int64]bool)
+	for {
+		msg, err := c.next(ctx, s.topic, s.symKey)
+		if err != nil {
+			return err
+		}
+		if msg.Method == "" {
+			// Acknowledgements of the settlement and of our own messages
+			if msg.Error != nil {
+				return fmt.Errorf("the dapp refused the session: %v", msg.Error)
+			}
+			continue
+		}
+
+		var tag int
+		var result interface{} = true
+		var reply *Error
+		switch msg.Method {
+		case "wc_sessionRequest":
+			tag = tagRequestResponse
+			if answered[msg.ID] {
+				continue
+			}
+			answered[msg.ID] = true
+			result, reply = s.handle(ctx, handler, msg)
+		case "wc_sessionPing":
+			tag = tagPingResponse
+		case "wc_sessionEvent":
+			tag = tagEventResponse
+		case "wc_sessionUpdate":
+			tag = tagUpdateResponse
+		case "wc_sessionExtend":
+			tag = tagExtendResponse
+		case "wc_sessionDelete":
+			s.client.respond(ctx, s.topic, s.symKey, msg.ID, true, nil, tagDeleteResponse)
+			return ErrSessionDeleted
+		default:
+			continue
+		}
+		if reply != nil {
+			result = nil
+		}
+		if err := c.respond(ctx, s.topic, s.symKey, msg.ID, result, reply, tag); err != nil {
+			return err
+		}
+	}
+}
+
+// handle decodes a session request and runs the handler on it
+func (s *Session) handle(ctx context.Context, handler Handler, msg *rpcMessage) (interface{}, *Error) {
+	var params struct {
+		Request struct {
+			Method          string          `json:"method"`
+			Params          json.RawMessage `json:"params"`
+			ExpiryTimestamp int64           `json:"expiryTimestamp"`
+		} `json:"request"`
+		ChainID string `json:"chainId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, &Error{Code: CodeInternal, Message: "invalid request"}
+	}
+	chainID, ok := new(big.Int).SetString(strings.TrimPrefix(params.ChainID, "eip155:"), 10)
+	if !strings.HasPrefix(params.ChainID, "eip155:") || !ok {
+		return nil, &Error{Code: CodeUnsupportedChains, Message: fmt.Sprintf("unsupported chain %q", params.ChainID)}
+	}
+	request := &Request{ID: msg.ID, ChainID: chainID, Method: params.Request.Method, Params: params.Request.Params}
+	if params.Request.ExpiryTimestamp > 0 {
+		request.Expiry = time.Unix(params.Request.ExpiryTimestamp, 0)
+		if time.Now().After(request.Expiry) {
+			return nil, &Error{Code: CodeInternal, Message: "request expired"}
+		}
+	}
+
+	result, err := handler(ctx, request)
+	if err != nil {
+		var reply *Error
+		if errors.As(err, &reply) {
+			return nil, reply
+		}
+		return nil, &Error{Code: CodeInternal, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// Disconnect ends the session for the dapp
+func (s *Session) Disconnect(ctx context.Context) error {
+	params, err := json.Marshal(&Error{Code: CodeUserDisconnected, Message: "User disconnected."})
+	if err != nil {
+		return err
+	}
+	return s.client.send(ctx, s.topic, s.symKey, &rpcMessage{ID: newID(), JSONRPC: "2.0", Method: "wc_sessionDelete", Params: params}, tagDelete)
+}
+
+// next returns the next decryptable message on a topic, skipping others
+func (c *Client) next(ctx context.Context, topic string, symKey []byte) (*rpcMessage, error) {
+	for {
+		select {
+		case delivered := <-c.relay.messages:
+			if delivered.Topic != topic {
+				continue
+			}
+			plain, err := open(symKey, delivered.Message)
+			if err != nil {
+				continue
+			}
+			var msg rpcMessage
+			if json.Unmarshal(plain, &msg) != nil {
+				continue
+			}
+			return &msg, nil
+		case <-c.relay.done:
+			if c.relay.err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrRelayClosed, c.relay.err)
+			}
+			return nil, ErrRelayClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// respond sends the result of or error for a request
+func (c *Client) respond(ctx context.Context, topic string, symKey []byte, id int64, result interface{}, reply *Error, tag int) error {
+	msg := &rpcMessage{ID: id, JSONRPC: "2.0", Error: reply}
+	if reply == nil {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = encoded
+	}
+	return c.send(ctx, topic, symKey, msg, tag)
+}
+
+// send encrypts a message for a topic and publishes it
+func (c *Client) send(ctx context.Context, topic string, symKey []byte, msg *rpcMessage, tag int) error {
+	plain, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(symKey, plain)
+	if err != nil {
+		return err
+	}
+	return c.relay.publish(ctx, topic, sealed, tag, messageTTL)
+}
+
+func sortedKeys(namespaces map[string]Namespace) []string {
+	keys := make([]string, 0, len(namespaces))
+	for key := range namespaces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendMissing appends the values not in list yet
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,60 @@
+package walletconnect
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URI is a WalletConnect v2 pairing URI:
+// wc:<topic>@2?relay-protocol=irn&symKey=<hex>[&expiryTimestamp=<unix>]
+type URI struct {
+	Topic  string
+	SymKey []byte
+	Relay  string
+	// Expiry is when the pairing expires; zero if the URI does not say
+	Expiry time.Time
+}
+
+// ParseURI parses a pairing URI as shown by a dapp's "WalletConnect" QR code
+func ParseURI(raw string) (*URI, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(raw), "wc:")
+	if !ok {
+		return nil, fmt.Errorf("not a WalletConnect URI: %q", raw)
+	}
+	target, query, _ := strings.Cut(rest, "?")
+	topic, version, ok := strings.Cut(target, "@")
+	if !ok || version != "2" {
+		return nil, fmt.Errorf("unsupported WalletConnect version %q; only v2 pairing URIs are supported", version)
+	}
+	if _, err := hex.DecodeString(topic); err != nil || len(topic) != 64 {
+		return nil, fmt.Errorf("invalid pairing topic %q", topic)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WalletConnect URI: %v", err)
+	}
+
+	uri := &URI{Topic: topic, Relay: values.Get("relay-protocol")}
+	if uri.Relay != "irn" {
+		return nil, fmt.Errorf("unsupported relay protocol %q", uri.Relay)
+	}
+	uri.SymKey, err = hex.DecodeString(values.Get("symKey"))
+	if err != nil || len(uri.SymKey) != 32 {
+		return nil, fmt.Errorf("invalid symKey in WalletConnect URI")
+	}
+	if topicOf(uri.SymKey) != topic {
+		return nil, fmt.Errorf("pairing topic does not match the symKey")
+	}
+	if expiry := values.Get("expiryTimestamp"); expiry != "" {
+		seconds, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiryTimestamp %q", expiry)
+		}
+		uri.Expiry = time.Unix(seconds, 0)
+	}
+	return uri, nil
+}